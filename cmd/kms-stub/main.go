@@ -0,0 +1,56 @@
+// TeamVault KMS stand-in
+//
+// A minimal local KMS implementing the protocol used by KEY_PROVIDER=kms.
+// It keeps the root keyring in its own process so the API server never holds
+// it. Intended for development and integration testing only.
+//
+// Usage:
+//
+//	KMS_STUB_KEYS=<hex or 1:<hex>,2:<hex>> KMS_TOKEN=... kms-stub
+package main
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/teamvault/teamvault/internal/crypto"
+)
+
+func main() {
+	keySpec := os.Getenv("KMS_STUB_KEYS")
+	if keySpec == "" {
+		log.Fatal("KMS_STUB_KEYS environment variable required")
+	}
+	keys, err := crypto.ParseKeyring(keySpec)
+	if err != nil {
+		log.Fatalf("Invalid KMS_STUB_KEYS: %v", err)
+	}
+
+	keyID := getEnv("KMS_KEY_ID", "teamvault")
+	listenAddr := getEnv("LISTEN_ADDR", "127.0.0.1:8200")
+
+	stub, err := crypto.NewKMSStub(keyID, os.Getenv("KMS_TOKEN"), keys)
+	if err != nil {
+		log.Fatalf("Failed to initialize KMS stub: %v", err)
+	}
+
+	srv := &http.Server{
+		Addr:              listenAddr,
+		Handler:           stub,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	log.Printf("KMS stub serving key %q on %s (development only)", keyID, listenAddr)
+	if err := srv.ListenAndServe(); err != nil {
+		log.Fatalf("KMS stub error: %v", err)
+	}
+}
+
+func getEnv(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
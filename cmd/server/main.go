@@ -4,6 +4,8 @@
 //
 //	server            Start the HTTP server
 //	server -migrate   Run database migrations and exit
+//	server -upgrade-ciphertexts
+//	                  Re-encrypt legacy secret versions with associated data and exit
 package main
 
 import (
@@ -22,14 +24,21 @@ import (
 	"github.com/teamvault/teamvault/internal/auth"
 	"github.com/teamvault/teamvault/internal/crypto"
 	"github.com/teamvault/teamvault/internal/db"
+	"github.com/teamvault/teamvault/internal/kek"
 	"github.com/teamvault/teamvault/internal/lease"
 	"github.com/teamvault/teamvault/internal/policy"
+	"github.com/teamvault/teamvault/internal/retention"
+	"github.com/teamvault/teamvault/internal/rewrap"
 	"github.com/teamvault/teamvault/internal/rotation"
+	"github.com/teamvault/teamvault/internal/seal"
+	"github.com/teamvault/teamvault/internal/transit"
+	"github.com/teamvault/teamvault/internal/webhooks"
 )
 
 func main() {
 	migrateOnly := flag.Bool("migrate", false, "Run migrations and exit")
 	migrationsDir := flag.String("migrations-dir", "migrations", "Path to migrations directory")
+	upgradeCiphertexts := flag.Bool("upgrade-ciphertexts", false, "Re-encrypt legacy (format v1) secret versions with associated data and exit")
 	flag.Parse()
 
 	ctx, cancel := context.WithCancel(context.Background())
@@ -58,12 +67,59 @@ func main() {
 		return
 	}
 
-	// Initialize crypto (envelope encryption)
-	cryptoSvc, err := crypto.NewEnvelopeCryptoFromEnv()
-	if err != nil {
-		log.Fatalf("Failed to initialize crypto: %v", err)
+	// Initialize crypto (envelope encryption). With KEY_PROVIDER=shamir the
+	// server boots sealed and the keyring is loaded once operators unseal.
+	var cryptoSvc *crypto.EnvelopeCrypto
+	var sealManager *seal.Manager
+	if os.Getenv("KEY_PROVIDER") == "shamir" {
+		sealManager, err = seal.NewManager(ctx, database)
+		if err != nil {
+			log.Fatalf("Failed to initialize seal manager: %v", err)
+		}
+		importKeys, err := crypto.KeyringFromEnv()
+		if err != nil {
+			log.Fatalf("Failed to parse MASTER_KEY for import: %v", err)
+		}
+		if importKeys != nil {
+			if sealManager.Status().Initialized {
+				log.Println("WARNING: MASTER_KEY is ignored once the vault is initialized; remove it from the environment")
+			} else {
+				sealManager.SetImportKeyring(importKeys)
+				log.Println("MASTER_KEY will be sealed into the keyring at init")
+			}
+		}
+		cryptoSvc, err = crypto.NewEnvelopeCryptoWithProvider(sealManager)
+		if err != nil {
+			log.Fatalf("Failed to initialize crypto: %v", err)
+		}
+		st := sealManager.Status()
+		log.Printf("Envelope encryption initialized (provider shamir, sealed, initialized=%v, threshold %d)", st.Initialized, st.Threshold)
+	} else {
+		cryptoSvc, err = crypto.NewEnvelopeCryptoFromEnv()
+		if err != nil {
+			log.Fatalf("Failed to initialize crypto: %v", err)
+		}
+		log.Printf("Envelope encryption initialized (provider %s, master key v%d, versions %v)",
+			cryptoSvc.Provider().Name(), cryptoSvc.CurrentKeyVersion(), cryptoSvc.KeyVersions())
+	}
+
+	// Per-project key encryption keys (master key -> project KEK -> DEK)
+	kekManager := kek.NewManager(database, cryptoSvc)
+
+	if *upgradeCiphertexts {
+		if cryptoSvc.Sealed() {
+			log.Fatal("Cannot upgrade ciphertexts while sealed; run with KEY_PROVIDER=local or kms")
+		}
+		result, err := rewrap.UpgradeCiphertexts(ctx, database, cryptoSvc, kekManager, 500)
+		if err != nil {
+			log.Fatalf("Ciphertext upgrade failed: %v", err)
+		}
+		log.Printf("Ciphertext upgrade complete: %d upgraded, %d failed (of %d)", result.Upgraded, result.Failed, result.Total)
+		if result.Failed > 0 {
+			os.Exit(1)
+		}
+		return
 	}
-	log.Println("Envelope encryption initialized")
 
 	// Initialize auth
 	authSvc := auth.New(jwtSecret)
@@ -94,20 +150,53 @@ func main() {
 	}
 
 	// Initialize rotation scheduler
-	rotationScheduler := rotation.NewScheduler(database, cryptoSvc)
+	rotationScheduler := rotation.NewScheduler(database, cryptoSvc, kekManager)
 	go rotationScheduler.Start(ctx)
 	log.Println("Rotation scheduler started")
 
 	// Initialize lease manager
-	leaseManager := lease.NewManager(database, cryptoSvc)
+	leaseManager := lease.NewManager(database, cryptoSvc, kekManager)
 	go leaseManager.StartCleanup(ctx)
 	log.Println("Lease cleanup goroutine started")
 
+	// Initialize master key re-wrap job (admin-triggered via /api/v1/sys/rewrap)
+	rewrapJob := rewrap.NewJob(database, cryptoSvc, auditSvc)
+
+	// Initialize deleted secret purge (DELETED_SECRET_RETENTION, default 30
+	// days; 0 disables)
+	retentionPeriod, err := time.ParseDuration(getEnv("DELETED_SECRET_RETENTION", "720h"))
+	if err != nil {
+		log.Fatalf("Invalid DELETED_SECRET_RETENTION: %v", err)
+	}
+	secretPurger := retention.NewPurger(database, auditSvc, retentionPeriod)
+	go secretPurger.Start(ctx)
+
+	// Initialize secret version pruning (max_versions / max_version_age limits)
+	versionPruner := retention.NewPruner(database, auditSvc)
+	go versionPruner.Start(ctx)
+
+	// Initialize webhook delivery
+	webhookManager := webhooks.NewWebhookManager(database.Pool)
+
+	// Initialize change request expiry (two-person approval)
+	changeExpirer := retention.NewExpirer(database, auditSvc, webhookManager)
+	go changeExpirer.Start(ctx)
+
+	// Initialize transit (encryption as a service) key manager
+	transitManager := transit.NewManager(database, cryptoSvc)
+
 	// Create API server with all production dependencies
 	serverConfig := api.ServerConfig{
 		OIDCClient:        oidcClient,
 		RotationScheduler: rotationScheduler,
 		LeaseManager:      leaseManager,
+		RewrapJob:         rewrapJob,
+		SealManager:       sealManager,
+		TransitManager:    transitManager,
+		KEKManager:        kekManager,
+		SecretPurger:      secretPurger,
+		VersionPruner:     versionPruner,
+		WebhookManager:    webhookManager,
 	}
 	apiServer := api.NewServerWithConfig(database, authSvc, cryptoSvc, policySvc, auditSvc, serverConfig)
 
@@ -138,6 +227,10 @@ func main() {
 	cancel()
 	rotationScheduler.Stop()
 	leaseManager.Stop()
+	rewrapJob.Stop()
+	secretPurger.Stop()
+	versionPruner.Stop()
+	changeExpirer.Stop()
 
 	// Graceful HTTP shutdown with timeout
 	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 30*time.Second)
@@ -0,0 +1,364 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// --- Change request API types ---
+
+// ApprovalRule protects the secrets of a project matching Path: writes by
+// anyone but the project owner need Approvals approvals from members of the
+// team TeamID.
+type ApprovalRule struct {
+	Path      string `json:"path"`
+	TeamID    string `json:"team_id"`
+	Approvals int    `json:"approvals"`
+}
+
+// ChangeReview is one approver's decision on a change request.
+type ChangeReview struct {
+	UserID    string    `json:"user_id"`
+	Decision  string    `json:"decision"`
+	Comment   string    `json:"comment,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ChangeRequest is a write to a protected secret waiting for approval.
+type ChangeRequest struct {
+	ID                string         `json:"id"`
+	Project           string         `json:"project"`
+	Path              string         `json:"path"`
+	SecretType        string         `json:"secret_type"`
+	BaseVersion       int            `json:"base_version"`
+	TeamID            string         `json:"team_id"`
+	RequiredApprovals int            `json:"required_approvals"`
+	Approvals         int            `json:"approvals"`
+	Status            string         `json:"status"`
+	Error             string         `json:"error,omitempty"`
+	Comment           string         `json:"comment,omitempty"`
+	RequestedByType   string         `json:"requested_by_type"`
+	RequestedBy       string         `json:"requested_by"`
+	AppliedVersion    *int           `json:"applied_version,omitempty"`
+	ExpiresAt         time.Time      `json:"expires_at"`
+	CreatedAt         time.Time      `json:"created_at"`
+	Reviews           []ChangeReview `json:"reviews,omitempty"`
+	// Only set when the proposed value is asked for
+	Value      string `json:"value,omitempty"`
+	Encryption string `json:"encryption,omitempty"`
+}
+
+// --- API client methods ---
+
+// SetApprovalRules replaces the approval rules of a project.
+func (c *APIClient) SetApprovalRules(project string, rules []ApprovalRule) error {
+	return c.do("PATCH", fmt.Sprintf("/api/v1/projects/%s", project), map[string]interface{}{
+		"approval_rules": rules,
+	}, nil)
+}
+
+// ListChangeRequests lists the change requests of a project the caller may
+// see, optionally only those with a status.
+func (c *APIClient) ListChangeRequests(project, status string) ([]ChangeRequest, error) {
+	endpoint := fmt.Sprintf("/api/v1/projects/%s/change-requests", project)
+	if status != "" {
+		endpoint += "?status=" + status
+	}
+	var resp struct {
+		ChangeRequests []ChangeRequest `json:"change_requests"`
+	}
+	if err := c.do("GET", endpoint, nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp.ChangeRequests, nil
+}
+
+// GetChangeRequest returns a change request, with its proposed value if
+// value is set. Values of end-to-end encrypted projects are decrypted
+// locally.
+func (c *APIClient) GetChangeRequest(id string, value bool) (*ChangeRequest, error) {
+	endpoint := "/api/v1/change-requests/" + id
+	if value {
+		endpoint += "?value=true"
+	}
+	var resp ChangeRequest
+	if err := c.do("GET", endpoint, nil, &resp); err != nil {
+		return nil, err
+	}
+	if resp.Encryption == "e2e" {
+		p, err := c.e2eProject(resp.Project)
+		if err != nil {
+			return nil, err
+		}
+		if p == nil {
+			return nil, fmt.Errorf("%s is not end-to-end encrypted", resp.Project)
+		}
+		if resp.Value, err = p.openValue(resp.Path, resp.Value); err != nil {
+			return nil, fmt.Errorf("failed to decrypt proposed value: %w", err)
+		}
+	}
+	return &resp, nil
+}
+
+// ReviewChangeRequest approves or rejects a change request.
+func (c *APIClient) ReviewChangeRequest(id, decision, comment string) (*ChangeRequest, error) {
+	var resp ChangeRequest
+	if err := c.do("POST", fmt.Sprintf("/api/v1/change-requests/%s/%s", id, decision), map[string]string{"comment": comment}, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// CancelChangeRequest withdraws a pending change request.
+func (c *APIClient) CancelChangeRequest(id string) error {
+	return c.do("POST", fmt.Sprintf("/api/v1/change-requests/%s/cancel", id), nil, nil)
+}
+
+// --- Cobra commands ---
+
+var changeCmd = &cobra.Command{
+	Use:   "change",
+	Short: "Review writes to protected secrets (two-person approval)",
+	Long: `Protect paths of a project with approval rules and review the change
+requests they produce.
+
+A write to a protected path by anyone but the project owner is not applied:
+it becomes a change request holding the proposed value, encrypted, until
+enough members of the rule's approver team approve it. The last approval
+applies it, provided the secret has not changed since the request was made.
+A single rejection closes the request; unreviewed requests expire after
+seven days.
+
+Examples:
+  teamvault change protect myapp 'prod/**=TEAM_ID:2'
+  teamvault change list myapp
+  teamvault change show 3b0e... --value
+  teamvault change approve 3b0e... --comment "rotation ticket OPS-42"`,
+}
+
+var (
+	changeListStatus    string
+	changeShowValue     bool
+	changeReviewComment string
+)
+
+var changeProtectCmd = &cobra.Command{
+	Use:   "protect PROJECT PATTERN=TEAM_ID[:APPROVALS]...",
+	Short: "Set the approval rules of a project",
+	Long: `Replace the approval rules of a project. Each rule protects the paths
+matching PATTERN (e.g. "prod/**") with approval by APPROVALS members of the
+team (default 1, which with the requester makes two people). The first
+matching rule applies. Without rules, all protection is removed.
+
+Examples:
+  teamvault change protect myapp 'prod/**=6c1d...'
+  teamvault change protect myapp 'prod/**=6c1d...:2' 'billing/*=9f2a...'
+  teamvault change protect myapp`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: runChangeProtect,
+}
+
+var changeListCmd = &cobra.Command{
+	Use:   "list PROJECT",
+	Short: "List the change requests of a project",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runChangeList,
+}
+
+var changeShowCmd = &cobra.Command{
+	Use:   "show ID",
+	Short: "Show a change request and its reviews",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runChangeShow,
+}
+
+var changeApproveCmd = &cobra.Command{
+	Use:   "approve ID",
+	Short: "Approve a change request (the last approval applies it)",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runChangeApprove,
+}
+
+var changeRejectCmd = &cobra.Command{
+	Use:   "reject ID",
+	Short: "Reject a change request",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runChangeReject,
+}
+
+var changeCancelCmd = &cobra.Command{
+	Use:   "cancel ID",
+	Short: "Withdraw a pending change request",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runChangeCancel,
+}
+
+func init() {
+	changeListCmd.Flags().StringVar(&changeListStatus, "status", "pending", "Only list requests with this status (\"\" for all)")
+	changeShowCmd.Flags().BoolVar(&changeShowValue, "value", false, "Also print the proposed value (needs read access)")
+	changeApproveCmd.Flags().StringVar(&changeReviewComment, "comment", "", "Comment recorded with the review")
+	changeRejectCmd.Flags().StringVar(&changeReviewComment, "comment", "", "Comment recorded with the review")
+
+	changeCmd.AddCommand(changeProtectCmd)
+	changeCmd.AddCommand(changeListCmd)
+	changeCmd.AddCommand(changeShowCmd)
+	changeCmd.AddCommand(changeApproveCmd)
+	changeCmd.AddCommand(changeRejectCmd)
+	changeCmd.AddCommand(changeCancelCmd)
+}
+
+func runChangeProtect(cmd *cobra.Command, args []string) error {
+	rules := make([]ApprovalRule, 0, len(args)-1)
+	for _, arg := range args[1:] {
+		pattern, team, ok := strings.Cut(arg, "=")
+		if !ok || pattern == "" || team == "" {
+			return fmt.Errorf("rule %q must be PATTERN=TEAM_ID[:APPROVALS]", arg)
+		}
+		rule := ApprovalRule{Path: pattern, TeamID: team, Approvals: 1}
+		if id, n, ok := strings.Cut(team, ":"); ok {
+			approvals, err := strconv.Atoi(n)
+			if err != nil || approvals < 1 {
+				return fmt.Errorf("rule %q: approvals must be a positive number", arg)
+			}
+			rule.TeamID, rule.Approvals = id, approvals
+		}
+		rules = append(rules, rule)
+	}
+
+	client, err := NewClient()
+	if err != nil {
+		return err
+	}
+	if err := client.SetApprovalRules(args[0], rules); err != nil {
+		return fmt.Errorf("failed to set approval rules: %w", err)
+	}
+
+	if len(rules) == 0 {
+		fmt.Fprintf(os.Stderr, "✓ Approval rules of %s removed\n", args[0])
+	} else {
+		fmt.Fprintf(os.Stderr, "✓ Approval rules of %s set\n", args[0])
+	}
+	return nil
+}
+
+func runChangeList(cmd *cobra.Command, args []string) error {
+	client, err := NewClient()
+	if err != nil {
+		return err
+	}
+
+	requests, err := client.ListChangeRequests(args[0], changeListStatus)
+	if err != nil {
+		return fmt.Errorf("failed to list change requests: %w", err)
+	}
+	if len(requests) == 0 {
+		fmt.Fprintf(os.Stderr, "No change requests\n")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tPATH\tSTATUS\tAPPROVALS\tREQUESTED BY\tCREATED")
+	for _, cr := range requests {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d/%d\t%s\t%s\n", cr.ID, cr.Path, cr.Status,
+			cr.Approvals, cr.RequiredApprovals, cr.RequestedBy, cr.CreatedAt.Local().Format("2006-01-02 15:04"))
+	}
+	w.Flush()
+	return nil
+}
+
+func runChangeShow(cmd *cobra.Command, args []string) error {
+	client, err := NewClient()
+	if err != nil {
+		return err
+	}
+
+	cr, err := client.GetChangeRequest(args[0], changeShowValue)
+	if err != nil {
+		return fmt.Errorf("failed to get change request %s: %w", args[0], err)
+	}
+
+	fmt.Fprintf(os.Stdout, "Secret:     %s/%s (%s)\n", cr.Project, cr.Path, cr.SecretType)
+	if cr.BaseVersion == 0 {
+		fmt.Fprintf(os.Stdout, "Change:     create\n")
+	} else {
+		fmt.Fprintf(os.Stdout, "Change:     new version on top of v%d\n", cr.BaseVersion)
+	}
+	fmt.Fprintf(os.Stdout, "Status:     %s\n", cr.Status)
+	if cr.Error != "" {
+		fmt.Fprintf(os.Stdout, "Error:      %s\n", cr.Error)
+	}
+	if cr.AppliedVersion != nil {
+		fmt.Fprintf(os.Stdout, "Applied:    v%d\n", *cr.AppliedVersion)
+	}
+	fmt.Fprintf(os.Stdout, "Approvals:  %d of %d (team %s)\n", cr.Approvals, cr.RequiredApprovals, cr.TeamID)
+	fmt.Fprintf(os.Stdout, "Requested:  %s by %s %s\n", cr.CreatedAt.Local().Format(time.RFC1123), cr.RequestedByType, cr.RequestedBy)
+	if cr.Status == "pending" {
+		fmt.Fprintf(os.Stdout, "Expires:    %s\n", cr.ExpiresAt.Local().Format(time.RFC1123))
+	}
+	if cr.Comment != "" {
+		fmt.Fprintf(os.Stdout, "Comment:    %s\n", cr.Comment)
+	}
+	for _, review := range cr.Reviews {
+		line := fmt.Sprintf("%s by %s on %s", review.Decision, review.UserID, review.CreatedAt.Local().Format(time.RFC1123))
+		if review.Comment != "" {
+			line += ": " + review.Comment
+		}
+		fmt.Fprintf(os.Stdout, "Review:     %s\n", line)
+	}
+	if changeShowValue {
+		fmt.Fprintf(os.Stdout, "Value:      %s\n", cr.Value)
+	}
+	return nil
+}
+
+func runChangeApprove(cmd *cobra.Command, args []string) error {
+	return reviewChange(args[0], "approve")
+}
+
+func runChangeReject(cmd *cobra.Command, args []string) error {
+	return reviewChange(args[0], "reject")
+}
+
+func reviewChange(id, decision string) error {
+	client, err := NewClient()
+	if err != nil {
+		return err
+	}
+
+	cr, err := client.ReviewChangeRequest(id, decision, changeReviewComment)
+	if err != nil {
+		return fmt.Errorf("failed to %s change request %s: %w", decision, id, err)
+	}
+
+	switch cr.Status {
+	case "applied":
+		fmt.Fprintf(os.Stderr, "✓ Change request approved and applied: %s/%s is now at version %d\n", cr.Project, cr.Path, *cr.AppliedVersion)
+	case "failed":
+		return fmt.Errorf("change request approved but could not be applied: %s", cr.Error)
+	case "rejected":
+		fmt.Fprintf(os.Stderr, "✓ Change request rejected\n")
+	default:
+		fmt.Fprintf(os.Stderr, "✓ Change request approved (%d of %d approvals)\n", cr.Approvals, cr.RequiredApprovals)
+	}
+	return nil
+}
+
+func runChangeCancel(cmd *cobra.Command, args []string) error {
+	client, err := NewClient()
+	if err != nil {
+		return err
+	}
+
+	if err := client.CancelChangeRequest(args[0]); err != nil {
+		return fmt.Errorf("failed to cancel change request %s: %w", args[0], err)
+	}
+
+	fmt.Fprintf(os.Stderr, "✓ Change request %s cancelled\n", args[0])
+	return nil
+}
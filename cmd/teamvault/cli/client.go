@@ -3,11 +3,16 @@ package cli
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
 	"time"
+
+	"github.com/teamvault/teamvault/internal/jsonfield"
 )
 
 // APIClient handles HTTP communication with the TeamVault server.
@@ -15,6 +20,8 @@ type APIClient struct {
 	BaseURL    string
 	Token      string
 	HTTPClient *http.Client
+
+	e2eProjects map[string]*e2eProject // cached per project; nil value = server-encrypted
 }
 
 // APIError represents an error response from the API.
@@ -22,6 +29,8 @@ type APIError struct {
 	StatusCode int
 	Message    string `json:"error"`
 	Detail     string `json:"detail"`
+
+	body []byte // raw response, for endpoints that return details with errors
 }
 
 func (e *APIError) Error() string {
@@ -34,12 +43,17 @@ func (e *APIError) Error() string {
 	return fmt.Sprintf("API error (%d)", e.StatusCode)
 }
 
-// NewClient creates a new APIClient from stored credentials.
+// NewClient creates a new APIClient from stored credentials. An access token
+// about to expire is refreshed first, so logins last as long as the session.
 func NewClient() (*APIClient, error) {
 	tokenData, err := LoadToken()
 	if err != nil {
 		return nil, err
 	}
+	tokenData, err = refreshToken(tokenData)
+	if err != nil {
+		return nil, err
+	}
 	return &APIClient{
 		BaseURL: strings.TrimRight(tokenData.Server, "/"),
 		Token:   tokenData.Token,
@@ -49,6 +63,29 @@ func NewClient() (*APIClient, error) {
 	}, nil
 }
 
+// refreshToken exchanges the stored refresh token for new tokens when the
+// access token expires within a minute, and saves them.
+func refreshToken(data TokenData) (TokenData, error) {
+	if data.RefreshToken == "" || data.ExpiresAt.IsZero() || time.Until(data.ExpiresAt) > time.Minute {
+		return data, nil
+	}
+	resp, err := NewClientWithURL(data.Server).Refresh(data.RefreshToken)
+	if err != nil {
+		var apiErr *APIError
+		if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusUnauthorized {
+			return data, fmt.Errorf("session expired. Run 'teamvault login' to re-authenticate")
+		}
+		return data, fmt.Errorf("failed to refresh session: %w", err)
+	}
+	data.Token = resp.Token
+	data.RefreshToken = resp.RefreshToken
+	data.ExpiresAt = resp.ExpiresAt
+	if err := SaveToken(data); err != nil {
+		return data, err
+	}
+	return data, nil
+}
+
 // NewClientWithURL creates a new APIClient with an explicit server URL (for login).
 func NewClientWithURL(serverURL string) *APIClient {
 	return &APIClient{
@@ -60,6 +97,11 @@ func NewClientWithURL(serverURL string) *APIClient {
 }
 
 func (c *APIClient) do(method, path string, body interface{}, result interface{}) error {
+	return c.doWithHeaders(method, path, nil, body, result)
+}
+
+// doWithHeaders is do with extra request headers.
+func (c *APIClient) doWithHeaders(method, path string, headers map[string]string, body interface{}, result interface{}) error {
 	var bodyReader io.Reader
 	if body != nil {
 		b, err := json.Marshal(body)
@@ -80,6 +122,9 @@ func (c *APIClient) do(method, path string, body interface{}, result interface{}
 	if c.Token != "" {
 		req.Header.Set("Authorization", "Bearer "+c.Token)
 	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
 
 	resp, err := c.HTTPClient.Do(req)
 	if err != nil {
@@ -93,7 +138,7 @@ func (c *APIClient) do(method, path string, body interface{}, result interface{}
 	}
 
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		apiErr := &APIError{StatusCode: resp.StatusCode}
+		apiErr := &APIError{StatusCode: resp.StatusCode, body: respBody}
 		// Try to parse structured error
 		_ = json.Unmarshal(respBody, apiErr)
 		if apiErr.Message == "" {
@@ -111,26 +156,73 @@ func (c *APIClient) do(method, path string, body interface{}, result interface{}
 	return nil
 }
 
-// Login authenticates with email/password and returns a JWT token.
-func (c *APIClient) Login(email, password string) (string, error) {
-	var resp struct {
-		Token string `json:"token"`
-	}
+// LoginResponse holds the tokens of a new or refreshed session. When the
+// user has MFA enabled, a login returns MFARequired and an MFAToken instead,
+// to complete with LoginMFA.
+type LoginResponse struct {
+	Token        string    `json:"token"`
+	RefreshToken string    `json:"refresh_token"`
+	ExpiresAt    time.Time `json:"expires_at"`
+	MFARequired  bool      `json:"mfa_required,omitempty"`
+	MFAToken     string    `json:"mfa_token,omitempty"`
+}
 
+// Login authenticates with email/password and returns the session's tokens,
+// or the MFA challenge to complete.
+func (c *APIClient) Login(email, password string) (*LoginResponse, error) {
+	var resp LoginResponse
 	err := c.do("POST", "/api/v1/auth/login", map[string]string{
 		"email":    email,
 		"password": password,
 	}, &resp)
+	if err != nil {
+		return nil, err
+	}
 
+	if resp.MFARequired {
+		return &resp, nil
+	}
+	if resp.Token == "" {
+		return nil, fmt.Errorf("server returned empty token")
+	}
+
+	return &resp, nil
+}
+
+// LoginMFA completes a login with the MFA token from Login and a TOTP or
+// recovery code.
+func (c *APIClient) LoginMFA(mfaToken, code string) (*LoginResponse, error) {
+	var resp LoginResponse
+	err := c.do("POST", "/api/v1/auth/login/mfa", map[string]string{
+		"mfa_token": mfaToken,
+		"code":      code,
+	}, &resp)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	if resp.Token == "" {
-		return "", fmt.Errorf("server returned empty token")
+		return nil, fmt.Errorf("server returned empty token")
 	}
 
-	return resp.Token, nil
+	return &resp, nil
+}
+
+// Refresh exchanges a refresh token for new session tokens.
+func (c *APIClient) Refresh(refreshToken string) (*LoginResponse, error) {
+	var resp LoginResponse
+	err := c.do("POST", "/api/v1/auth/refresh", map[string]string{
+		"refresh_token": refreshToken,
+	}, &resp)
+	if err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Logout ends the session of the client's token.
+func (c *APIClient) Logout() error {
+	return c.do("POST", "/api/v1/auth/logout", nil, nil)
 }
 
 // SecretResponse represents a secret returned by the API.
@@ -140,35 +232,461 @@ type SecretResponse struct {
 	Path        string `json:"path"`
 	Value       string `json:"value"`
 	Version     int    `json:"version"`
+	Field       string `json:"field,omitempty"`
 	Description string `json:"description"`
-	CreatedAt   string `json:"created_at"`
-	CreatedBy   string `json:"created_by"`
+	Encryption  string `json:"encryption,omitempty"`
+	MovedTo     string `json:"moved_to,omitempty"` // set when read through the alias of a moved secret
+	// Set when the value is inherited from a parent environment
+	InheritedFrom string `json:"inherited_from,omitempty"`
+	CreatedAt     string `json:"created_at"`
+	CreatedBy     string `json:"created_by"`
+	// Set instead of the rest when a write to a protected path is waiting
+	// for approval
+	ChangeRequest *ChangeRequest `json:"change_request,omitempty"`
 }
 
 // SecretListItem is a secret in list output (no value exposed).
 type SecretListItem struct {
-	ID          string `json:"id"`
-	Path        string `json:"path"`
-	Description string `json:"description"`
-	Version     int    `json:"version"`
-	CreatedAt   string `json:"created_at"`
+	ID          string            `json:"id"`
+	Project     string            `json:"project,omitempty"` // set in search results
+	Path        string            `json:"path"`
+	Description string            `json:"description"`
+	Version     int               `json:"version"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	CreatedAt   string            `json:"created_at"`
 }
 
-// GetSecret fetches a secret value.
+// GetSecret fetches a secret value. Values of end-to-end encrypted projects
+// are decrypted locally.
 func (c *APIClient) GetSecret(project, path string) (*SecretResponse, error) {
+	return c.GetSecretVersion(project, path, 0, false)
+}
+
+// GetSecretVersion fetches a specific version of a secret, or the latest if
+// version is 0. References in the value are resolved by the server unless raw
+// is set.
+func (c *APIClient) GetSecretVersion(project, path string, version int, raw bool) (*SecretResponse, error) {
+	q := url.Values{}
+	if version > 0 {
+		q.Set("version", strconv.Itoa(version))
+	}
+	if raw {
+		q.Set("raw", "true")
+	}
+	endpoint := fmt.Sprintf("/api/v1/secrets/%s/%s", project, path)
+	if len(q) > 0 {
+		endpoint += "?" + q.Encode()
+	}
+
 	var resp SecretResponse
-	err := c.do("GET", fmt.Sprintf("/api/v1/secrets/%s/%s", project, path), nil, &resp)
+	err := c.do("GET", endpoint, nil, &resp)
 	if err != nil {
 		return nil, err
 	}
+	if resp.Encryption == "e2e" {
+		if resp.Value, err = c.openMovedValue(project, path, resp.MovedTo+resp.InheritedFrom, resp.Value); err != nil {
+			return nil, err
+		}
+	}
+	return &resp, nil
+}
+
+// openMovedValue decrypts an end-to-end encrypted value read at
+// project/path. A value read through the alias of a moved secret, or
+// inherited from a parent environment, is encrypted for where it is stored,
+// storedAt ("project/path"; at most one of the two is ever set).
+func (c *APIClient) openMovedValue(project, path, storedAt, value string) (string, error) {
+	if storedAt != "" {
+		project, path, _ = strings.Cut(storedAt, "/")
+	}
+	p, err := c.e2eProject(project)
+	if err != nil {
+		return "", err
+	}
+	if p == nil {
+		return "", fmt.Errorf("project %s returned an end-to-end encrypted value but is not end-to-end encrypted", project)
+	}
+	v, err := p.openValue(path, value)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt %s/%s: %w", project, path, err)
+	}
+	return v, nil
+}
+
+// GetSecretField reads one field of a JSON secret (version 0: the latest).
+// Fields of end-to-end encrypted secrets are taken from the value after it is
+// decrypted locally. References are resolved unless raw is set.
+func (c *APIClient) GetSecretField(project, path, field string, version int, raw bool) (*SecretResponse, error) {
+	p, err := c.e2eProject(project)
+	if err != nil {
+		return nil, err
+	}
+	if p != nil {
+		resp, err := c.GetSecretVersion(project, path, version, raw)
+		if err != nil {
+			return nil, err
+		}
+		if resp.Value, err = jsonfield.Get([]byte(resp.Value), field); err != nil {
+			return nil, fmt.Errorf("%s/%s: %w", project, path, err)
+		}
+		resp.Field = field
+		return resp, nil
+	}
+
+	q := url.Values{"field": {field}}
+	if version > 0 {
+		q.Set("version", strconv.Itoa(version))
+	}
+	if raw {
+		q.Set("raw", "true")
+	}
+	var resp SecretResponse
+	if err := c.do("GET", fmt.Sprintf("/api/v1/secrets/%s/%s?%s", project, path, q.Encode()), nil, &resp); err != nil {
+		return nil, err
+	}
 	return &resp, nil
 }
 
-// PutSecret creates or updates a secret.
+// PatchSecretFields changes fields of a JSON secret with a JSON merge patch
+// (a nil value removes the field) and returns the version created. cas, if
+// set, is the version the patch expects to replace. End-to-end encrypted
+// secrets are read, patched and encrypted again locally.
+func (c *APIClient) PatchSecretFields(project, path string, patch map[string]interface{}, cas *int) (int, error) {
+	p, err := c.e2eProject(project)
+	if err != nil {
+		return 0, err
+	}
+	if p != nil {
+		current, err := c.GetSecret(project, path)
+		if err != nil {
+			return 0, err
+		}
+		if cas != nil && *cas != current.Version {
+			return 0, fmt.Errorf("version mismatch: latest version is %d", current.Version)
+		}
+		patchJSON, err := json.Marshal(patch)
+		if err != nil {
+			return 0, err
+		}
+		doc, err := jsonfield.MergePatch([]byte(current.Value), patchJSON)
+		if err != nil {
+			return 0, err
+		}
+		var resp SecretResponse
+		if err := c.putSecret(project, path, string(doc), &current.Version, &resp); err != nil {
+			return 0, err
+		}
+		return resp.Version, nil
+	}
+
+	body := map[string]interface{}{"fields": patch}
+	if cas != nil {
+		body["cas"] = *cas
+	}
+	var resp SecretResponse
+	if err := c.do("PATCH", fmt.Sprintf("/api/v1/secrets/%s/%s", project, path), body, &resp); err != nil {
+		return 0, err
+	}
+	return resp.Version, nil
+}
+
+// batchChunkSize is the most secrets the server accepts per batch request.
+const batchChunkSize = 500
+
+// BatchResult is the outcome for one secret of a batch read or write. Status
+// is the HTTP status the secret would have had as a single request.
+type BatchResult struct {
+	Path       string `json:"path"`
+	Status     int    `json:"status"`
+	Error      string `json:"error,omitempty"`
+	Version    int    `json:"version,omitempty"`
+	Value      string `json:"value,omitempty"`
+	Encryption string `json:"encryption,omitempty"`
+	SecretType string `json:"secret_type,omitempty"`
+	MovedTo    string `json:"moved_to,omitempty"`
+	// Set when the value is inherited from a parent environment
+	InheritedFrom string `json:"inherited_from,omitempty"`
+}
+
+// OK reports whether the secret was read or written.
+func (r *BatchResult) OK() bool {
+	return r.Status == http.StatusOK
+}
+
+// BatchPutItem is one secret of a batch write.
+type BatchPutItem struct {
+	Path        string `json:"path"`
+	Value       string `json:"value"`
+	Description string `json:"description,omitempty"`
+	CAS         *int   `json:"cas,omitempty"` // 0: only create
+}
+
+type batchResponse struct {
+	Error   string        `json:"error"`
+	Results []BatchResult `json:"results"`
+}
+
+// BatchGetSecrets reads the latest values of several secrets, with one
+// request per 500 paths. A path may name one field of a JSON secret as
+// "path#field". Results are in the order of paths; secrets that could not be
+// read have a non-200 status. References are resolved by the server unless raw
+// is set. Values of end-to-end encrypted projects are decrypted locally.
+func (c *APIClient) BatchGetSecrets(project string, paths []string, raw bool) ([]BatchResult, error) {
+	// The server cannot look into end-to-end encrypted values, so their
+	// fields are taken from the whole secret once it is decrypted here
+	request := paths
+	var p *e2eProject
+	for _, path := range paths {
+		if _, field := jsonfield.Split(path); field != "" {
+			var err error
+			if p, err = c.e2eProject(project); err != nil {
+				return nil, err
+			}
+			break
+		}
+	}
+	if p != nil {
+		request = make([]string, 0, len(paths))
+		seen := make(map[string]bool, len(paths))
+		for _, ref := range paths {
+			path, _ := jsonfield.Split(ref)
+			if !seen[path] {
+				seen[path] = true
+				request = append(request, path)
+			}
+		}
+	}
+
+	results := make([]BatchResult, 0, len(request))
+	for start := 0; start < len(request); start += batchChunkSize {
+		end := min(start+batchChunkSize, len(request))
+		body := map[string]interface{}{"paths": request[start:end]}
+		if raw {
+			body["raw"] = true
+		}
+		var resp batchResponse
+		err := c.do("POST", fmt.Sprintf("/api/v1/secrets/%s:batchGet", project), body, &resp)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, resp.Results...)
+	}
+
+	for i := range results {
+		r := &results[i]
+		if r.Encryption != "e2e" {
+			continue
+		}
+		var err error
+		if r.Value, err = c.openMovedValue(project, r.Path, r.MovedTo+r.InheritedFrom, r.Value); err != nil {
+			return nil, err
+		}
+		r.Encryption = ""
+	}
+
+	if p == nil {
+		return results, nil
+	}
+	byPath := make(map[string]BatchResult, len(results))
+	for _, r := range results {
+		byPath[r.Path] = r
+	}
+	fieldResults := make([]BatchResult, len(paths))
+	for i, ref := range paths {
+		path, field := jsonfield.Split(ref)
+		r := byPath[path]
+		r.Path = ref
+		if r.OK() && field != "" {
+			var err error
+			if r.Value, err = jsonfield.Get([]byte(r.Value), field); err != nil {
+				r.Status, r.Error, r.Value = http.StatusNotFound, err.Error(), ""
+			}
+		}
+		fieldResults[i] = r
+	}
+	return fieldResults, nil
+}
+
+// BatchPutSecrets writes up to 500 secrets in one transaction: either all are
+// written or none is. If the server rejects the batch, the per-secret results
+// are returned together with the error. Values of end-to-end encrypted
+// projects are encrypted locally before they are sent.
+func (c *APIClient) BatchPutSecrets(project string, items []BatchPutItem) ([]BatchResult, error) {
+	p, err := c.e2eProject(project)
+	if err != nil {
+		return nil, err
+	}
+	if p != nil {
+		sealed := make([]BatchPutItem, len(items))
+		for i, item := range items {
+			if item.Value, err = p.sealValue(item.Path, item.Value); err != nil {
+				return nil, fmt.Errorf("failed to encrypt %s/%s: %w", project, item.Path, err)
+			}
+			sealed[i] = item
+		}
+		items = sealed
+	}
+
+	var resp batchResponse
+	err = c.do("POST", fmt.Sprintf("/api/v1/secrets/%s:batchPut", project),
+		map[string]interface{}{"secrets": items}, &resp)
+	if apiErr, ok := err.(*APIError); ok {
+		_ = json.Unmarshal(apiErr.body, &resp)
+		return resp.Results, err
+	}
+	if err != nil {
+		return nil, err
+	}
+	return resp.Results, nil
+}
+
+// PutSecret creates or updates a secret. Values of end-to-end encrypted
+// projects are encrypted locally before they are sent.
 func (c *APIClient) PutSecret(project, path, value string) error {
-	return c.do("PUT", fmt.Sprintf("/api/v1/secrets/%s/%s", project, path), map[string]string{
-		"value": value,
-	}, nil)
+	return c.putSecret(project, path, value, nil, nil)
+}
+
+// PutSecretCAS writes a secret only if its latest version is still cas
+// (0: the secret must not exist yet) and returns the version created.
+func (c *APIClient) PutSecretCAS(project, path, value string, cas int) (int, error) {
+	var resp SecretResponse
+	if err := c.putSecret(project, path, value, &cas, &resp); err != nil {
+		return 0, err
+	}
+	return resp.Version, nil
+}
+
+func (c *APIClient) putSecret(project, path, value string, cas *int, result interface{}) error {
+	p, err := c.e2eProject(project)
+	if err != nil {
+		return err
+	}
+	if p != nil {
+		if value, err = p.sealValue(path, value); err != nil {
+			return fmt.Errorf("failed to encrypt %s/%s: %w", project, path, err)
+		}
+	}
+	body := map[string]interface{}{"value": value}
+	if cas != nil {
+		body["cas"] = *cas
+	}
+	return c.do("PUT", fmt.Sprintf("/api/v1/secrets/%s/%s", project, path), body, result)
+}
+
+// SecretVersionInfo is a secret version in history output (no value exposed).
+type SecretVersionInfo struct {
+	ID          string `json:"id"`
+	Version     int    `json:"version"`
+	CreatedBy   string `json:"created_by"`
+	CreatedAt   string `json:"created_at"`
+	DestroyedAt string `json:"destroyed_at,omitempty"`
+}
+
+// ListSecretVersions lists the versions of a secret, newest first.
+func (c *APIClient) ListSecretVersions(project, path string) ([]SecretVersionInfo, error) {
+	var resp []SecretVersionInfo
+	err := c.do("GET", fmt.Sprintf("/api/v1/secret-versions/%s/%s", project, path), nil, &resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// RollbackSecret writes an older version of a secret as its new latest
+// version and returns the version number created. cas, if set, is the
+// version the rollback expects to replace. Values of end-to-end encrypted
+// projects are re-encrypted locally with the current project key.
+func (c *APIClient) RollbackSecret(project, path string, version int, cas *int) (int, error) {
+	p, err := c.e2eProject(project)
+	if err != nil {
+		return 0, err
+	}
+	if p != nil {
+		old, err := c.GetSecretVersion(project, path, version, true)
+		if err != nil {
+			return 0, err
+		}
+		var resp SecretResponse
+		if err := c.putSecret(project, path, old.Value, cas, &resp); err != nil {
+			return 0, err
+		}
+		return resp.Version, nil
+	}
+
+	body := map[string]interface{}{"version": version}
+	if cas != nil {
+		body["cas"] = *cas
+	}
+	var resp SecretResponse
+	err = c.do("POST", fmt.Sprintf("/api/v1/secrets/%s/%s/rollback", project, path), body, &resp)
+	if err != nil {
+		return 0, err
+	}
+	return resp.Version, nil
+}
+
+// TransferResult is the outcome of moving or copying a secret.
+type TransferResult struct {
+	ID             string `json:"id"`
+	Project        string `json:"project"`
+	Path           string `json:"path"`
+	From           string `json:"from"`
+	Versions       int    `json:"versions"`
+	AliasExpiresAt string `json:"alias_expires_at,omitempty"`
+}
+
+// MoveSecret moves a secret with its version history to toProject/toPath.
+// aliasTTL, if set, keeps reads of the old path working for that long (e.g.
+// "720h"). Versions of end-to-end encrypted secrets are re-encrypted locally
+// for the destination.
+func (c *APIClient) MoveSecret(project, path, toProject, toPath, aliasTTL string) (*TransferResult, error) {
+	body := map[string]interface{}{"to": toProject + "/" + toPath}
+	if aliasTTL != "" {
+		body["alias_ttl"] = aliasTTL
+	}
+	return c.transferSecret("move", project, path, toProject, toPath, body)
+}
+
+// CopySecret copies a secret with its version history to toProject/toPath.
+func (c *APIClient) CopySecret(project, path, toProject, toPath string) (*TransferResult, error) {
+	body := map[string]interface{}{"to": toProject + "/" + toPath}
+	return c.transferSecret("copy", project, path, toProject, toPath, body)
+}
+
+func (c *APIClient) transferSecret(op, project, path, toProject, toPath string, body map[string]interface{}) (*TransferResult, error) {
+	// End-to-end encrypted values are bound to their project and path, so
+	// every version is sent encrypted again for the destination
+	dst, err := c.e2eProject(toProject)
+	if err != nil {
+		return nil, err
+	}
+	if dst != nil {
+		versions, err := c.ListSecretVersions(project, path)
+		if err != nil {
+			return nil, err
+		}
+		values := make(map[int]string, len(versions))
+		for _, v := range versions {
+			if v.DestroyedAt != "" {
+				continue
+			}
+			old, err := c.GetSecretVersion(project, path, v.Version, true)
+			if err != nil {
+				return nil, err
+			}
+			if values[v.Version], err = dst.sealValue(toPath, old.Value); err != nil {
+				return nil, fmt.Errorf("failed to encrypt %s/%s: %w", toProject, toPath, err)
+			}
+		}
+		body["values"] = values
+	}
+
+	var resp TransferResult
+	err = c.do("POST", fmt.Sprintf("/api/v1/secrets/%s/%s/%s", project, path, op), body, &resp)
+	if err != nil {
+		return nil, err
+	}
+	return &resp, nil
 }
 
 // ListSecrets lists secrets in a project.
@@ -181,6 +699,40 @@ func (c *APIClient) ListSecrets(project string) ([]SecretListItem, error) {
 	return resp, nil
 }
 
+// SearchSecrets finds secrets by label selector and path prefix, in one
+// project or (project "") in every project the caller can list.
+func (c *APIClient) SearchSecrets(project, prefix, selector string) ([]SecretListItem, error) {
+	q := url.Values{}
+	if project != "" {
+		q.Set("project", project)
+	}
+	if prefix != "" {
+		q.Set("prefix", prefix)
+	}
+	if selector != "" {
+		q.Set("selector", selector)
+	}
+	var resp []SecretListItem
+	err := c.do("GET", "/api/v1/search/secrets?"+q.Encode(), nil, &resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// UpdateSecretLabels sets labels of a secret; a nil value removes the label.
+// It returns the secret's labels after the update.
+func (c *APIClient) UpdateSecretLabels(project, path string, labels map[string]*string) (map[string]string, error) {
+	var resp struct {
+		Labels map[string]string `json:"labels"`
+	}
+	err := c.do("PATCH", fmt.Sprintf("/api/v1/secrets/%s/%s", project, path), map[string]interface{}{"labels": labels}, &resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Labels, nil
+}
+
 // ServiceAccountToken is the response from creating a service account.
 type ServiceAccountToken struct {
 	ID        string `json:"id"`
@@ -202,3 +754,15 @@ func (c *APIClient) CreateServiceAccountToken(project string, scopes []string, t
 	}
 	return &resp, nil
 }
+
+// RotateServiceAccountToken replaces the token of a service account and
+// returns the new one.
+func (c *APIClient) RotateServiceAccountToken(id string) (string, error) {
+	var resp struct {
+		Token string `json:"token"`
+	}
+	if err := c.do("POST", "/api/v1/service-accounts/"+id+"/rotate-token", nil, &resp); err != nil {
+		return "", err
+	}
+	return resp.Token, nil
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"time"
 )
 
 const (
@@ -19,10 +20,13 @@ type Config struct {
 	Email  string `json:"email"`
 }
 
-// TokenData holds the authentication token and server info.
+// TokenData holds the authentication token and server info. With a refresh
+// token the access token is renewed before ExpiresAt.
 type TokenData struct {
-	Token  string `json:"token"`
-	Server string `json:"server"`
+	Token        string    `json:"token"`
+	Server       string    `json:"server"`
+	RefreshToken string    `json:"refresh_token,omitempty"`
+	ExpiresAt    time.Time `json:"expires_at,omitempty"`
 }
 
 func configDirPath() (string, error) {
@@ -91,6 +95,18 @@ func LoadToken() (TokenData, error) {
 	return data, nil
 }
 
+// DeleteToken removes the stored token.
+func DeleteToken() error {
+	dir, err := configDirPath()
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(filepath.Join(dir, tokenFile)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("cannot remove token file: %w", err)
+	}
+	return nil
+}
+
 // SaveConfig persists CLI config (server URL, email).
 func SaveConfig(cfg Config) error {
 	dir, err := ensureConfigDir()
@@ -0,0 +1,537 @@
+package cli
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/teamvault/teamvault/internal/e2e"
+)
+
+const e2eKeyFile = "e2e_key"
+
+// --- E2E API types ---
+
+// E2EKeyPair is the user's X25519 key pair, stored in ~/.teamvault/e2e_key.
+// The private key never leaves this machine.
+type E2EKeyPair struct {
+	PublicKey  []byte `json:"public_key"`
+	PrivateKey []byte `json:"private_key"`
+}
+
+// E2EMember is a user holding the current key of an E2E project.
+type E2EMember struct {
+	UserID     string `json:"user_id"`
+	Email      string `json:"email"`
+	PublicKey  []byte `json:"public_key"`
+	KeyVersion int    `json:"key_version"`
+}
+
+// E2ESealedKey is a project key version sealed to one user.
+type E2ESealedKey struct {
+	UserID     string `json:"user_id,omitempty"`
+	KeyVersion int    `json:"key_version,omitempty"`
+	SealedKey  []byte `json:"sealed_key"`
+}
+
+// ProjectE2E describes a project's encryption mode and, for E2E projects,
+// its members and the keys sealed to the caller.
+type ProjectE2E struct {
+	Project        string         `json:"project"`
+	ProjectID      string         `json:"project_id"`
+	EncryptionMode string         `json:"encryption_mode"`
+	KeyVersion     int            `json:"key_version"`
+	Members        []E2EMember    `json:"members"`
+	Keys           []E2ESealedKey `json:"keys"`
+}
+
+// PublicKeyInfo is a user's registered public key.
+type PublicKeyInfo struct {
+	UserID      string `json:"user_id"`
+	Email       string `json:"email"`
+	PublicKey   []byte `json:"public_key"`
+	Fingerprint string `json:"fingerprint"`
+}
+
+// e2eProject is an E2E project with its opened key versions.
+type e2eProject struct {
+	info ProjectE2E
+	keys map[int][]byte
+}
+
+// --- API client methods ---
+
+// GetProjectE2E fetches a project's encryption mode and sealed keys.
+func (c *APIClient) GetProjectE2E(project string) (*ProjectE2E, error) {
+	var resp ProjectE2E
+	if err := c.do("GET", fmt.Sprintf("/api/v1/projects/%s/e2e", project), nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// SetPublicKey registers the caller's public key.
+func (c *APIClient) SetPublicKey(publicKey []byte) (*PublicKeyInfo, error) {
+	var resp PublicKeyInfo
+	if err := c.do("PUT", "/api/v1/auth/me/public-key", map[string][]byte{"public_key": publicKey}, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// GetPublicKey looks up a user's public key by email.
+func (c *APIClient) GetPublicKey(email string) (*PublicKeyInfo, error) {
+	var resp PublicKeyInfo
+	if err := c.do("GET", "/api/v1/users/public-key?email="+url.QueryEscape(email), nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// CreateE2EProject creates an end-to-end encrypted project.
+func (c *APIClient) CreateE2EProject(name string) (*ProjectE2E, error) {
+	var resp struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	}
+	err := c.do("POST", "/api/v1/projects", map[string]string{
+		"name":            name,
+		"encryption_mode": "e2e",
+	}, &resp)
+	if err != nil {
+		return nil, err
+	}
+	return &ProjectE2E{Project: resp.Name, ProjectID: resp.ID, EncryptionMode: "e2e"}, nil
+}
+
+// AddE2EMember shares the given sealed key versions with a user.
+func (c *APIClient) AddE2EMember(project, email string, keys []E2ESealedKey) error {
+	return c.do("POST", fmt.Sprintf("/api/v1/projects/%s/e2e/members", project), map[string]interface{}{
+		"email": email,
+		"keys":  keys,
+	}, nil)
+}
+
+// RotateE2EKey publishes a new project key version sealed to members.
+func (c *APIClient) RotateE2EKey(project string, version int, members []E2ESealedKey) error {
+	return c.do("POST", fmt.Sprintf("/api/v1/projects/%s/e2e/rotate", project), map[string]interface{}{
+		"key_version": version,
+		"members":     members,
+	}, nil)
+}
+
+// e2eProject returns the project's E2E state, or nil for server-encrypted
+// projects. Key versions sealed to the caller are opened with the local key
+// pair. Results are cached for the lifetime of the client.
+func (c *APIClient) e2eProject(project string) (*e2eProject, error) {
+	if p, ok := c.e2eProjects[project]; ok {
+		return p, nil
+	}
+
+	info, err := c.GetProjectE2E(project)
+	if err != nil {
+		return nil, err
+	}
+	var p *e2eProject
+	if info.EncryptionMode == "e2e" {
+		keys, err := openProjectKeys(info)
+		if err != nil {
+			return nil, fmt.Errorf("project %s: %w", project, err)
+		}
+		p = &e2eProject{info: *info, keys: keys}
+	}
+
+	if c.e2eProjects == nil {
+		c.e2eProjects = make(map[string]*e2eProject)
+	}
+	c.e2eProjects[project] = p
+	return p, nil
+}
+
+// sealValue encrypts a value for an E2E project with its current key.
+func (p *e2eProject) sealValue(path, value string) (string, error) {
+	key, ok := p.keys[p.info.KeyVersion]
+	if !ok {
+		if p.info.KeyVersion == 0 {
+			return "", fmt.Errorf("project %s has no key yet. Run 'teamvault e2e rotate %s'", p.info.Project, p.info.Project)
+		}
+		return "", fmt.Errorf("project key v%d is not shared with you", p.info.KeyVersion)
+	}
+	blob, err := e2e.Encrypt(key, p.info.KeyVersion, p.info.ProjectID, path, []byte(value))
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(blob), nil
+}
+
+// openValue decrypts a value read from an E2E project.
+func (p *e2eProject) openValue(path, value string) (string, error) {
+	blob, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return "", e2e.ErrInvalidBlob
+	}
+	plaintext, err := e2e.Decrypt(p.keys, p.info.ProjectID, path, blob)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// openProjectKeys opens every key version sealed to the caller.
+func openProjectKeys(info *ProjectE2E) (map[int][]byte, error) {
+	keys := make(map[int][]byte, len(info.Keys))
+	if len(info.Keys) == 0 {
+		return keys, nil
+	}
+	kp, err := LoadE2EKeyPair()
+	if err != nil {
+		return nil, err
+	}
+	if kp == nil {
+		return nil, fmt.Errorf("no end-to-end encryption key on this machine. Copy ~/.teamvault/%s from the machine you registered it on", e2eKeyFile)
+	}
+	for _, k := range info.Keys {
+		key, err := e2e.OpenKey(k.SealedKey, kp.PublicKey, kp.PrivateKey)
+		if err != nil {
+			return nil, fmt.Errorf("project key v%d: %w", k.KeyVersion, err)
+		}
+		keys[k.KeyVersion] = key
+	}
+	return keys, nil
+}
+
+// LoadE2EKeyPair reads the key pair from ~/.teamvault/e2e_key. It returns
+// nil if none has been generated yet.
+func LoadE2EKeyPair() (*E2EKeyPair, error) {
+	dir, err := configDirPath()
+	if err != nil {
+		return nil, err
+	}
+	b, err := os.ReadFile(filepath.Join(dir, e2eKeyFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("cannot read key file: %w", err)
+	}
+	var kp E2EKeyPair
+	if err := json.Unmarshal(b, &kp); err != nil {
+		return nil, fmt.Errorf("corrupt key file: %w", err)
+	}
+	return &kp, nil
+}
+
+// SaveE2EKeyPair persists the key pair to ~/.teamvault/e2e_key with 0600
+// permissions.
+func SaveE2EKeyPair(kp *E2EKeyPair) error {
+	dir, err := ensureConfigDir()
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(kp)
+	if err != nil {
+		return fmt.Errorf("cannot marshal key pair: %w", err)
+	}
+	path := filepath.Join(dir, e2eKeyFile)
+	if err := os.WriteFile(path, b, 0600); err != nil {
+		return fmt.Errorf("cannot write key file %s: %w", path, err)
+	}
+	return nil
+}
+
+// ensureE2EKeyPair loads the local key pair, generating and registering one
+// on first use.
+func ensureE2EKeyPair(client *APIClient) (*E2EKeyPair, error) {
+	kp, err := LoadE2EKeyPair()
+	if err != nil || kp != nil {
+		return kp, err
+	}
+
+	pub, priv, err := e2e.GenerateKeyPair()
+	if err != nil {
+		return nil, err
+	}
+	kp = &E2EKeyPair{PublicKey: pub, PrivateKey: priv}
+	if err := SaveE2EKeyPair(kp); err != nil {
+		return nil, err
+	}
+	info, err := client.SetPublicKey(pub)
+	if err != nil {
+		return nil, fmt.Errorf("failed to register public key: %w", err)
+	}
+	fmt.Fprintf(os.Stderr, "✓ Generated end-to-end encryption key (fingerprint %s)\n", info.Fingerprint)
+	return kp, nil
+}
+
+// --- Commands ---
+
+var e2eCmd = &cobra.Command{
+	Use:   "e2e",
+	Short: "Manage end-to-end encrypted projects",
+	Long: `Manage end-to-end encrypted projects. Values in these projects are encrypted
+on your machine with a project key that is sealed to each member's public key;
+the server only ever stores ciphertext. kv get/put, run, export and import
+encrypt and decrypt transparently.
+
+Examples:
+  teamvault e2e init
+  teamvault e2e create payments-root
+  teamvault e2e add-member payments-root alice@example.com
+  teamvault e2e remove-member payments-root bob@example.com`,
+}
+
+var e2eInitCmd = &cobra.Command{
+	Use:   "init",
+	Short: "Generate your key pair and register the public key",
+	Args:  cobra.NoArgs,
+	RunE:  runE2EInit,
+}
+
+var e2eCreateCmd = &cobra.Command{
+	Use:   "create PROJECT",
+	Short: "Create an end-to-end encrypted project",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runE2ECreate,
+}
+
+var e2eMembersCmd = &cobra.Command{
+	Use:   "members PROJECT",
+	Short: "List members and their key fingerprints",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runE2EMembers,
+}
+
+var e2eAddMemberCmd = &cobra.Command{
+	Use:   "add-member PROJECT EMAIL",
+	Short: "Share the project key with a user",
+	Long: `Seal every project key version to the user's registered public key.
+Compare the printed fingerprint with the user out of band before relying on it.`,
+	Args: cobra.ExactArgs(2),
+	RunE: runE2EAddMember,
+}
+
+var e2eRemoveMemberCmd = &cobra.Command{
+	Use:   "remove-member PROJECT EMAIL",
+	Short: "Re-key the project without a user",
+	Long: `Publish a new project key to every member except the given user. New values
+are encrypted with the new key; values the user could already read stay
+readable to them until they are rewritten.`,
+	Args: cobra.ExactArgs(2),
+	RunE: runE2ERemoveMember,
+}
+
+var e2eRotateCmd = &cobra.Command{
+	Use:   "rotate PROJECT",
+	Short: "Publish a new project key to the current members",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runE2ERotate,
+}
+
+var e2eInitForce bool
+
+func init() {
+	e2eInitCmd.Flags().BoolVar(&e2eInitForce, "force", false, "Replace an existing key pair (you lose access to projects shared with the old key)")
+
+	e2eCmd.AddCommand(e2eInitCmd)
+	e2eCmd.AddCommand(e2eCreateCmd)
+	e2eCmd.AddCommand(e2eMembersCmd)
+	e2eCmd.AddCommand(e2eAddMemberCmd)
+	e2eCmd.AddCommand(e2eRemoveMemberCmd)
+	e2eCmd.AddCommand(e2eRotateCmd)
+}
+
+func runE2EInit(cmd *cobra.Command, args []string) error {
+	client, err := NewClient()
+	if err != nil {
+		return err
+	}
+
+	kp, err := LoadE2EKeyPair()
+	if err != nil {
+		return err
+	}
+	if kp == nil || e2eInitForce {
+		pub, priv, err := e2e.GenerateKeyPair()
+		if err != nil {
+			return err
+		}
+		kp = &E2EKeyPair{PublicKey: pub, PrivateKey: priv}
+		if err := SaveE2EKeyPair(kp); err != nil {
+			return err
+		}
+	}
+
+	info, err := client.SetPublicKey(kp.PublicKey)
+	if err != nil {
+		return fmt.Errorf("failed to register public key: %w", err)
+	}
+	fmt.Fprintf(os.Stderr, "✓ Public key registered for %s\n", info.Email)
+	fmt.Fprintf(os.Stdout, "Fingerprint: %s\n", info.Fingerprint)
+	return nil
+}
+
+func runE2ECreate(cmd *cobra.Command, args []string) error {
+	client, err := NewClient()
+	if err != nil {
+		return err
+	}
+	if _, err := ensureE2EKeyPair(client); err != nil {
+		return err
+	}
+
+	if _, err := client.CreateE2EProject(args[0]); err != nil {
+		return fmt.Errorf("failed to create project: %w", err)
+	}
+	fmt.Fprintf(os.Stderr, "✓ End-to-end encrypted project %s created\n", args[0])
+
+	return rotateE2EProject(client, args[0], "")
+}
+
+func runE2EMembers(cmd *cobra.Command, args []string) error {
+	client, err := NewClient()
+	if err != nil {
+		return err
+	}
+
+	info, err := client.GetProjectE2E(args[0])
+	if err != nil {
+		return fmt.Errorf("failed to get project: %w", err)
+	}
+	if info.EncryptionMode != "e2e" {
+		return fmt.Errorf("project %s is not end-to-end encrypted", args[0])
+	}
+
+	fmt.Fprintf(os.Stderr, "Project key version: %d\n", info.KeyVersion)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "EMAIL\tKEY VERSION\tFINGERPRINT")
+	for _, m := range info.Members {
+		fingerprint := "-"
+		if len(m.PublicKey) > 0 {
+			fingerprint = e2e.Fingerprint(m.PublicKey)
+		}
+		fmt.Fprintf(w, "%s\t%d\t%s\n", m.Email, m.KeyVersion, fingerprint)
+	}
+	return w.Flush()
+}
+
+func runE2EAddMember(cmd *cobra.Command, args []string) error {
+	project, email := args[0], args[1]
+	client, err := NewClient()
+	if err != nil {
+		return err
+	}
+
+	p, err := client.e2eProject(project)
+	if err != nil {
+		return err
+	}
+	if p == nil {
+		return fmt.Errorf("project %s is not end-to-end encrypted", project)
+	}
+	if len(p.keys) == 0 {
+		return fmt.Errorf("no key of project %s is shared with you", project)
+	}
+
+	member, err := client.GetPublicKey(email)
+	if err != nil {
+		return fmt.Errorf("failed to get public key of %s (they must run 'teamvault e2e init' first): %w", email, err)
+	}
+
+	keys := make([]E2ESealedKey, 0, len(p.keys))
+	for version, key := range p.keys {
+		sealed, err := e2e.SealKey(key, member.PublicKey)
+		if err != nil {
+			return err
+		}
+		keys = append(keys, E2ESealedKey{KeyVersion: version, SealedKey: sealed})
+	}
+
+	if err := client.AddE2EMember(project, email, keys); err != nil {
+		return fmt.Errorf("failed to add member: %w", err)
+	}
+	fmt.Fprintf(os.Stderr, "✓ Shared %s with %s (fingerprint %s — verify it with them)\n", project, email, member.Fingerprint)
+	return nil
+}
+
+func runE2ERemoveMember(cmd *cobra.Command, args []string) error {
+	client, err := NewClient()
+	if err != nil {
+		return err
+	}
+	return rotateE2EProject(client, args[0], args[1])
+}
+
+func runE2ERotate(cmd *cobra.Command, args []string) error {
+	client, err := NewClient()
+	if err != nil {
+		return err
+	}
+	return rotateE2EProject(client, args[0], "")
+}
+
+// rotateE2EProject generates the next project key and seals it to every
+// current member except removeEmail, plus the caller.
+func rotateE2EProject(client *APIClient, project, removeEmail string) error {
+	kp, err := ensureE2EKeyPair(client)
+	if err != nil {
+		return err
+	}
+	me, err := client.WhoAmI()
+	if err != nil {
+		return fmt.Errorf("failed to get current user: %w", err)
+	}
+	myID, _ := me["id"].(string)
+
+	info, err := client.GetProjectE2E(project)
+	if err != nil {
+		return fmt.Errorf("failed to get project: %w", err)
+	}
+	if info.EncryptionMode != "e2e" {
+		return fmt.Errorf("project %s is not end-to-end encrypted", project)
+	}
+
+	key, err := e2e.NewProjectKey()
+	if err != nil {
+		return err
+	}
+	version := info.KeyVersion + 1
+
+	recipients := map[string][]byte{myID: kp.PublicKey}
+	removed := false
+	for _, m := range info.Members {
+		if m.Email == removeEmail {
+			removed = true
+			continue
+		}
+		if m.UserID == myID {
+			continue
+		}
+		if len(m.PublicKey) == 0 {
+			return fmt.Errorf("member %s has no public key", m.Email)
+		}
+		recipients[m.UserID] = m.PublicKey
+	}
+	if removeEmail != "" && !removed {
+		return fmt.Errorf("%s is not a member of %s", removeEmail, project)
+	}
+
+	members := make([]E2ESealedKey, 0, len(recipients))
+	for userID, pub := range recipients {
+		sealed, err := e2e.SealKey(key, pub)
+		if err != nil {
+			return err
+		}
+		members = append(members, E2ESealedKey{UserID: userID, SealedKey: sealed})
+	}
+
+	if err := client.RotateE2EKey(project, version, members); err != nil {
+		return fmt.Errorf("failed to publish project key: %w", err)
+	}
+	fmt.Fprintf(os.Stderr, "✓ Project key v%d of %s shared with %d member(s)\n", version, project, len(members))
+	return nil
+}
@@ -0,0 +1,334 @@
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+)
+
+// --- Environment API types ---
+
+// Environment is an environment of a project. Its secrets live under
+// "<name>/"; it inherits the keys it does not define from its parent.
+type Environment struct {
+	Name      string   `json:"name"`
+	Parent    string   `json:"parent,omitempty"`
+	Inherits  []string `json:"inherits,omitempty"`
+	PromoteTo string   `json:"promote_to,omitempty"`
+}
+
+// EnvironmentSecret is a secret as an environment sees it (no value).
+type EnvironmentSecret struct {
+	Key           string `json:"key"`
+	Path          string `json:"path"`
+	SecretType    string `json:"secret_type"`
+	InheritedFrom string `json:"inherited_from,omitempty"`
+	CreatedAt     string `json:"created_at"`
+}
+
+// PromoteResult is the outcome of promoting one key.
+type PromoteResult struct {
+	Key         string `json:"key"`
+	Status      int    `json:"status"`
+	Error       string `json:"error,omitempty"`
+	Change      string `json:"change,omitempty"` // "create", "update" or "unchanged"
+	FromPath    string `json:"from_path,omitempty"`
+	FromVersion int    `json:"from_version,omitempty"`
+	ToVersion   int    `json:"to_version,omitempty"`
+}
+
+// Promotion is the response of a promotion or its preview.
+type Promotion struct {
+	From    string          `json:"from"`
+	To      string          `json:"to"`
+	DryRun  bool            `json:"dry_run"`
+	Results []PromoteResult `json:"results"`
+}
+
+// --- API client methods ---
+
+// ListEnvironments returns the environments of a project in promotion order.
+func (c *APIClient) ListEnvironments(project string) ([]Environment, error) {
+	var resp struct {
+		Environments []Environment `json:"environments"`
+	}
+	if err := c.do("GET", fmt.Sprintf("/api/v1/projects/%s/environments", project), nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Environments, nil
+}
+
+// SetEnvironments replaces the environments of a project.
+func (c *APIClient) SetEnvironments(project string, envs []Environment) error {
+	return c.do("PATCH", fmt.Sprintf("/api/v1/projects/%s", project), map[string]interface{}{
+		"environments": envs,
+	}, nil)
+}
+
+// ListEnvironmentSecrets lists the effective secrets of an environment,
+// inherited ones included.
+func (c *APIClient) ListEnvironmentSecrets(project, env string) ([]EnvironmentSecret, error) {
+	var resp struct {
+		Secrets []EnvironmentSecret `json:"secrets"`
+	}
+	if err := c.do("GET", fmt.Sprintf("/api/v1/projects/%s/environments/%s/secrets", project, env), nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Secrets, nil
+}
+
+// PromoteSecrets copies the latest versions of keys (all if empty) from one
+// environment to another (the next one if to is empty). With dryRun nothing
+// is written and the result previews the changes.
+func (c *APIClient) PromoteSecrets(project, from, to string, keys []string, dryRun bool) (*Promotion, error) {
+	body := map[string]interface{}{"from": from, "dry_run": dryRun}
+	if to != "" {
+		body["to"] = to
+	}
+	if len(keys) > 0 {
+		body["keys"] = keys
+	}
+	var resp Promotion
+	if err := c.do("POST", fmt.Sprintf("/api/v1/projects/%s/promote", project), body, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// --- Cobra commands ---
+
+var envCmd = &cobra.Command{
+	Use:   "env",
+	Short: "Manage project environments",
+	Long: `Manage the environments of a project and promote secrets between them.
+
+The secrets of an environment live under "<env>/" in the project, e.g.
+"staging/DB_URL". An environment with a parent reads every key it does not
+define from the parent, so shared values only need to be stored once.
+
+Examples:
+  teamvault env set myapp dev staging prod prod-eu:prod
+  teamvault env list myapp
+  teamvault env show myapp prod-eu
+  teamvault env promote myapp staging`,
+}
+
+var (
+	envPromoteTo     string
+	envPromoteKeys   []string
+	envPromoteYes    bool
+	envPromoteDryRun bool
+)
+
+var envListCmd = &cobra.Command{
+	Use:   "list PROJECT",
+	Short: "List the environments of a project",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runEnvList,
+}
+
+var envSetCmd = &cobra.Command{
+	Use:   "set PROJECT ENV[:PARENT]...",
+	Short: "Set the environments of a project",
+	Long: `Replace the environments of a project. Environments without a parent are
+promoted to in the order given; a parent must be listed before its children.
+
+Examples:
+  teamvault env set myapp dev staging prod
+  teamvault env set myapp dev staging prod prod-eu:prod prod-us:prod`,
+	Args: cobra.MinimumNArgs(2),
+	RunE: runEnvSet,
+}
+
+var envShowCmd = &cobra.Command{
+	Use:   "show PROJECT ENV",
+	Short: "List the secrets of an environment, inherited ones included",
+	Args:  cobra.ExactArgs(2),
+	RunE:  runEnvShow,
+}
+
+var envPromoteCmd = &cobra.Command{
+	Use:   "promote PROJECT FROM",
+	Short: "Copy secrets from one environment to the next",
+	Long: `Copy the latest versions of the secrets of an environment to the next one
+in the promotion order (or --to). The changes are previewed first and
+written, all or nothing, after confirmation. Keys whose value is already the
+same are left alone. Values are never shown.
+
+Examples:
+  teamvault env promote myapp staging
+  teamvault env promote myapp staging --keys DB_URL,API_KEY --yes
+  teamvault env promote myapp prod --to prod-eu --dry-run`,
+	Args: cobra.ExactArgs(2),
+	RunE: runEnvPromote,
+}
+
+func init() {
+	envPromoteCmd.Flags().StringVar(&envPromoteTo, "to", "", "Target environment (default: the next one)")
+	envPromoteCmd.Flags().StringSliceVar(&envPromoteKeys, "keys", nil, "Keys to promote (default: every key of FROM)")
+	envPromoteCmd.Flags().BoolVarP(&envPromoteYes, "yes", "y", false, "Promote without asking for confirmation")
+	envPromoteCmd.Flags().BoolVar(&envPromoteDryRun, "dry-run", false, "Only show what would change")
+
+	envCmd.AddCommand(envListCmd)
+	envCmd.AddCommand(envSetCmd)
+	envCmd.AddCommand(envShowCmd)
+	envCmd.AddCommand(envPromoteCmd)
+}
+
+func runEnvList(cmd *cobra.Command, args []string) error {
+	client, err := NewClient()
+	if err != nil {
+		return err
+	}
+
+	envs, err := client.ListEnvironments(args[0])
+	if err != nil {
+		return fmt.Errorf("failed to list environments: %w", err)
+	}
+	if len(envs) == 0 {
+		fmt.Fprintf(os.Stderr, "No environments defined\n")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tINHERITS\tPROMOTES TO")
+	for _, env := range envs {
+		inherits, next := strings.Join(env.Inherits, " → "), env.PromoteTo
+		if inherits == "" {
+			inherits = "-"
+		}
+		if next == "" {
+			next = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", env.Name, inherits, next)
+	}
+	w.Flush()
+	return nil
+}
+
+func runEnvSet(cmd *cobra.Command, args []string) error {
+	client, err := NewClient()
+	if err != nil {
+		return err
+	}
+
+	envs := make([]Environment, 0, len(args)-1)
+	for _, arg := range args[1:] {
+		name, parent, _ := strings.Cut(arg, ":")
+		envs = append(envs, Environment{Name: name, Parent: parent})
+	}
+	if err := client.SetEnvironments(args[0], envs); err != nil {
+		return fmt.Errorf("failed to set environments: %w", err)
+	}
+
+	fmt.Fprintf(os.Stderr, "✓ Environments of %s set\n", args[0])
+	return nil
+}
+
+func runEnvShow(cmd *cobra.Command, args []string) error {
+	client, err := NewClient()
+	if err != nil {
+		return err
+	}
+
+	secrets, err := client.ListEnvironmentSecrets(args[0], args[1])
+	if err != nil {
+		return fmt.Errorf("failed to list secrets: %w", err)
+	}
+	if len(secrets) == 0 {
+		fmt.Fprintf(os.Stderr, "No secrets in %s\n", args[1])
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "KEY\tTYPE\tINHERITED FROM")
+	for _, sec := range secrets {
+		from := sec.InheritedFrom
+		if from == "" {
+			from = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", sec.Key, sec.SecretType, from)
+	}
+	w.Flush()
+	return nil
+}
+
+func runEnvPromote(cmd *cobra.Command, args []string) error {
+	client, err := NewClient()
+	if err != nil {
+		return err
+	}
+	project, from := args[0], args[1]
+
+	preview, err := client.PromoteSecrets(project, from, envPromoteTo, envPromoteKeys, true)
+	if err != nil {
+		return fmt.Errorf("failed to preview promotion: %w", err)
+	}
+	changes := printPromotion(preview)
+	if changes == 0 {
+		fmt.Fprintf(os.Stderr, "Nothing to promote: %s is up to date with %s\n", preview.To, from)
+		return nil
+	}
+	if envPromoteDryRun {
+		return nil
+	}
+
+	if !envPromoteYes {
+		fmt.Fprintf(os.Stderr, "Promote %d secret(s) from %s to %s? [y/N] ", changes, from, preview.To)
+		answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		if a := strings.ToLower(strings.TrimSpace(answer)); a != "y" && a != "yes" {
+			return fmt.Errorf("promotion cancelled")
+		}
+	}
+
+	// Promote exactly the keys previewed; the server refuses if any target
+	// changed in the meantime
+	var keys []string
+	for _, res := range preview.Results {
+		if res.Change != "unchanged" {
+			keys = append(keys, res.Key)
+		}
+	}
+	promoted, err := client.PromoteSecrets(project, from, preview.To, keys, false)
+	if err != nil {
+		return fmt.Errorf("failed to promote: %w", err)
+	}
+
+	fmt.Fprintf(os.Stderr, "✓ Promoted %d secret(s) from %s to %s\n", len(promoted.Results), from, promoted.To)
+	return nil
+}
+
+// printPromotion prints the per-key changes of a promotion and returns how
+// many keys would change.
+func printPromotion(p *Promotion) int {
+	changes := 0
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "KEY\tCHANGE\t%s\t%s\n", strings.ToUpper(p.From), strings.ToUpper(p.To))
+	for _, res := range p.Results {
+		to := "-"
+		if res.ToVersion > 0 {
+			to = fmt.Sprintf("v%d", res.ToVersion)
+		}
+		from := fmt.Sprintf("v%d", res.FromVersion)
+		if res.FromPath != "" && res.FromPath != p.From+"/"+res.Key {
+			from += " (" + res.FromPath + ")"
+		}
+		sign := "~"
+		switch res.Change {
+		case "create":
+			sign = "+"
+		case "unchanged":
+			sign = "="
+		}
+		fmt.Fprintf(w, "%s %s\t%s\t%s\t%s\n", sign, res.Key, res.Change, from, to)
+		if res.Change != "unchanged" {
+			changes++
+		}
+	}
+	w.Flush()
+	return changes
+}
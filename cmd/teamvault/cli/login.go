@@ -1,6 +1,7 @@
 package cli
 
 import (
+	"bufio"
 	"context"
 	"crypto/rand"
 	"encoding/hex"
@@ -32,12 +33,23 @@ var loginCmd = &cobra.Command{
 For email/password login:
   teamvault login --server https://vault.example.com --email user@example.com
 
+If you have MFA enabled, you are prompted for a code from your authenticator
+app (or a recovery code) after the password.
+
 For OIDC (SSO) login:
   teamvault login --server https://vault.example.com --oidc
   Opens your browser for single sign-on authentication.`,
 	RunE: runLogin,
 }
 
+var logoutCmd = &cobra.Command{
+	Use:   "logout",
+	Short: "End your session and forget the stored token",
+	Long: `End the session on the server, so its tokens stop working, and remove
+the token stored in ~/.teamvault/token.`,
+	RunE: runLogout,
+}
+
 func init() {
 	loginCmd.Flags().StringVar(&loginServer, "server", "", "TeamVault server URL (e.g. https://vault.example.com)")
 	loginCmd.Flags().StringVar(&loginEmail, "email", "", "Email address for authentication")
@@ -75,15 +87,22 @@ func runLogin(cmd *cobra.Command, args []string) error {
 	client := NewClientWithURL(server)
 	fmt.Fprintf(os.Stderr, "Authenticating with %s...\n", server)
 
-	token, err := client.Login(loginEmail, password)
+	session, err := client.Login(loginEmail, password)
 	if err != nil {
 		return fmt.Errorf("login failed: %w", err)
 	}
+	if session.MFARequired {
+		if session, err = completeMFALogin(client, session.MFAToken); err != nil {
+			return err
+		}
+	}
 
-	// Save token securely
+	// Save token securely; the refresh token keeps it valid
 	if err := SaveToken(TokenData{
-		Token:  token,
-		Server: server,
+		Token:        session.Token,
+		Server:       server,
+		RefreshToken: session.RefreshToken,
+		ExpiresAt:    session.ExpiresAt,
 	}); err != nil {
 		return fmt.Errorf("failed to save token: %w", err)
 	}
@@ -102,11 +121,49 @@ func runLogin(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
+func runLogout(cmd *cobra.Command, args []string) error {
+	tokenData, err := LoadToken()
+	if err != nil {
+		return err
+	}
+
+	// The session may be over already; forget the token either way
+	client, err := NewClient()
+	if err == nil {
+		err = client.Logout()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: could not end the session on the server: %v\n", err)
+	}
+
+	if err := DeleteToken(); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "✓ Logged out of %s\n", tokenData.Server)
+	return nil
+}
+
+// completeMFALogin prompts for an MFA code and completes a login with it.
+func completeMFALogin(client *APIClient, mfaToken string) (*LoginResponse, error) {
+	code, err := readLine("MFA code (or recovery code): ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read MFA code: %w", err)
+	}
+	session, err := client.LoginMFA(mfaToken, code)
+	if err != nil {
+		return nil, fmt.Errorf("login failed: %w", err)
+	}
+	return session, nil
+}
+
 // OIDCCallbackResponse is the response received on the local callback server.
 type OIDCCallbackResponse struct {
-	Token string `json:"token"`
-	Email string `json:"email"`
-	Error string `json:"error"`
+	MFAToken     string    `json:"mfa_token"` // set instead of Token when MFA is required
+	Token        string    `json:"token"`
+	RefreshToken string    `json:"refresh_token"`
+	ExpiresAt    time.Time `json:"expires_at"`
+	Email        string    `json:"email"`
+	Error        string    `json:"error"`
 }
 
 // runLoginOIDC performs the OIDC browser-based authentication flow.
@@ -155,6 +212,9 @@ func runLoginOIDC(server string) error {
 		// Extract token from query params or POST body
 		token := r.URL.Query().Get("token")
 		email := r.URL.Query().Get("email")
+		refresh := r.URL.Query().Get("refresh_token")
+		mfaToken := r.URL.Query().Get("mfa_token")
+		expiresAt, _ := time.Parse(time.RFC3339, r.URL.Query().Get("expires_at"))
 
 		// If not in query params, try to read from POST JSON body
 		if token == "" && r.Method == http.MethodPost {
@@ -162,10 +222,13 @@ func runLoginOIDC(server string) error {
 			if err := json.NewDecoder(r.Body).Decode(&body); err == nil {
 				token = body.Token
 				email = body.Email
+				refresh = body.RefreshToken
+				mfaToken = body.MFAToken
+				expiresAt = body.ExpiresAt
 			}
 		}
 
-		if token == "" {
+		if token == "" && mfaToken == "" {
 			http.Error(w, "No token received", http.StatusBadRequest)
 			errCh <- fmt.Errorf("OIDC callback did not include a token")
 			return
@@ -181,8 +244,11 @@ func runLoginOIDC(server string) error {
 		</body></html>`, email)
 
 		resultCh <- OIDCCallbackResponse{
-			Token: token,
-			Email: email,
+			MFAToken:     mfaToken,
+			Token:        token,
+			RefreshToken: refresh,
+			ExpiresAt:    expiresAt,
+			Email:        email,
 		}
 	})
 
@@ -219,10 +285,23 @@ func runLoginOIDC(server string) error {
 	// Wait for the callback or timeout
 	select {
 	case result := <-resultCh:
+		// Users with MFA enabled complete the login here
+		if result.Token == "" {
+			session, err := completeMFALogin(NewClientWithURL(server), result.MFAToken)
+			if err != nil {
+				return err
+			}
+			result.Token = session.Token
+			result.RefreshToken = session.RefreshToken
+			result.ExpiresAt = session.ExpiresAt
+		}
+
 		// Save token
 		if err := SaveToken(TokenData{
-			Token:  result.Token,
-			Server: server,
+			Token:        result.Token,
+			Server:       server,
+			RefreshToken: result.RefreshToken,
+			ExpiresAt:    result.ExpiresAt,
 		}); err != nil {
 			return fmt.Errorf("failed to save token: %w", err)
 		}
@@ -269,6 +348,16 @@ func openBrowser(url string) error {
 	return cmd.Start()
 }
 
+// readLine prompts for a line of input.
+func readLine(prompt string) (string, error) {
+	fmt.Fprint(os.Stderr, prompt)
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", err
+	}
+	return strings.TrimSpace(line), nil
+}
+
 // readPassword prompts for a password without echoing input.
 func readPassword(prompt string) (string, error) {
 	fmt.Fprint(os.Stderr, prompt)
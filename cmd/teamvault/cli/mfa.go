@@ -0,0 +1,297 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// --- MFA API types ---
+
+// MFAStatus is the MFA state of the logged-in user.
+type MFAStatus struct {
+	Enabled           bool       `json:"enabled"`
+	EnabledAt         *time.Time `json:"enabled_at,omitempty"`
+	RecoveryCodesLeft int        `json:"recovery_codes_left"`
+	Verified          bool       `json:"verified"` // whether the current token carries the mfa claim
+}
+
+// MFAEnrollment is a new TOTP secret waiting to be confirmed.
+type MFAEnrollment struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauth_uri"`
+}
+
+// --- API client methods ---
+
+// GetMFAStatus returns the MFA state of the logged-in user.
+func (c *APIClient) GetMFAStatus() (*MFAStatus, error) {
+	var resp MFAStatus
+	if err := c.do("GET", "/api/v1/auth/mfa", nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// EnrollMFA starts TOTP enrollment.
+func (c *APIClient) EnrollMFA() (*MFAEnrollment, error) {
+	var resp MFAEnrollment
+	if err := c.do("POST", "/api/v1/auth/mfa/enroll", nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// ConfirmMFA enables MFA with a first TOTP code and returns the recovery codes.
+func (c *APIClient) ConfirmMFA(code string) ([]string, error) {
+	var resp struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+	if err := c.do("POST", "/api/v1/auth/mfa/confirm", map[string]string{"code": code}, &resp); err != nil {
+		return nil, err
+	}
+	return resp.RecoveryCodes, nil
+}
+
+// VerifyMFA re-verifies MFA for the current session (step-up) and returns
+// the new access token.
+func (c *APIClient) VerifyMFA(code string) (*LoginResponse, error) {
+	var resp LoginResponse
+	if err := c.do("POST", "/api/v1/auth/mfa/verify", map[string]string{"code": code}, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes of the logged-in user.
+func (c *APIClient) RegenerateRecoveryCodes(code string) ([]string, error) {
+	var resp struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+	if err := c.do("POST", "/api/v1/auth/mfa/recovery-codes", map[string]string{"code": code}, &resp); err != nil {
+		return nil, err
+	}
+	return resp.RecoveryCodes, nil
+}
+
+// DisableMFA turns off MFA for the logged-in user.
+func (c *APIClient) DisableMFA(code string) error {
+	return c.do("POST", "/api/v1/auth/mfa/disable", map[string]string{"code": code}, nil)
+}
+
+// ResetUserMFA removes the MFA enrollment of another user (admin).
+func (c *APIClient) ResetUserMFA(userID string) error {
+	return c.do("DELETE", "/api/v1/users/"+userID+"/mfa", nil, nil)
+}
+
+// --- Commands ---
+
+var mfaCmd = &cobra.Command{
+	Use:   "mfa",
+	Short: "Manage multi-factor authentication (TOTP)",
+	Long: `Enroll an authenticator app, re-verify MFA for your session, and manage
+recovery codes. Policies can require MFA with the "mfa" attribute; run
+'teamvault mfa verify' when a request is denied for lack of it.`,
+}
+
+var mfaStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show whether MFA is enabled",
+	Args:  cobra.NoArgs,
+	RunE:  runMFAStatus,
+}
+
+var mfaEnrollCmd = &cobra.Command{
+	Use:   "enroll",
+	Short: "Enable MFA with an authenticator app",
+	Long: `Enable TOTP MFA. Prints a secret and an otpauth:// URI to add to your
+authenticator app (most apps accept the secret typed in, or a QR code made
+from the URI), then asks for a code to confirm and prints recovery codes.`,
+	Args: cobra.NoArgs,
+	RunE: runMFAEnroll,
+}
+
+var mfaVerifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Re-verify MFA for your session (step-up)",
+	Long: `Re-verify MFA with a code, so your session's token carries the mfa claim
+again and policies that require MFA allow your requests.`,
+	Args: cobra.NoArgs,
+	RunE: runMFAVerify,
+}
+
+var mfaRecoveryCodesCmd = &cobra.Command{
+	Use:   "recovery-codes",
+	Short: "Replace your recovery codes",
+	Args:  cobra.NoArgs,
+	RunE:  runMFARecoveryCodes,
+}
+
+var mfaDisableCmd = &cobra.Command{
+	Use:   "disable",
+	Short: "Disable MFA",
+	Args:  cobra.NoArgs,
+	RunE:  runMFADisable,
+}
+
+var mfaResetCmd = &cobra.Command{
+	Use:   "reset USER_ID",
+	Short: "Remove a user's MFA enrollment (admin)",
+	Long: `Remove the MFA enrollment of a user who lost their authenticator and
+recovery codes, so they can log in with their password and enroll again.`,
+	Args: cobra.ExactArgs(1),
+	RunE: runMFAReset,
+}
+
+func init() {
+	mfaCmd.AddCommand(mfaStatusCmd)
+	mfaCmd.AddCommand(mfaEnrollCmd)
+	mfaCmd.AddCommand(mfaVerifyCmd)
+	mfaCmd.AddCommand(mfaRecoveryCodesCmd)
+	mfaCmd.AddCommand(mfaDisableCmd)
+	mfaCmd.AddCommand(mfaResetCmd)
+}
+
+func runMFAStatus(cmd *cobra.Command, args []string) error {
+	client, err := NewClient()
+	if err != nil {
+		return err
+	}
+
+	status, err := client.GetMFAStatus()
+	if err != nil {
+		return fmt.Errorf("failed to get MFA status: %w", err)
+	}
+	if !status.Enabled {
+		fmt.Println("MFA:            disabled")
+		return nil
+	}
+	fmt.Println("MFA:            enabled")
+	if status.EnabledAt != nil {
+		fmt.Printf("Enabled:        %s\n", status.EnabledAt.Local().Format("2006-01-02 15:04"))
+	}
+	fmt.Printf("Recovery codes: %d left\n", status.RecoveryCodesLeft)
+	if status.Verified {
+		fmt.Println("Session:        verified")
+	} else {
+		fmt.Println("Session:        not verified (run 'teamvault mfa verify')")
+	}
+	return nil
+}
+
+func runMFAEnroll(cmd *cobra.Command, args []string) error {
+	client, err := NewClient()
+	if err != nil {
+		return err
+	}
+
+	enrollment, err := client.EnrollMFA()
+	if err != nil {
+		return fmt.Errorf("failed to start MFA enrollment: %w", err)
+	}
+	fmt.Fprintf(os.Stderr, "Add this account to your authenticator app:\n\n")
+	fmt.Fprintf(os.Stderr, "  Secret: %s\n", enrollment.Secret)
+	fmt.Fprintf(os.Stderr, "  URI:    %s\n\n", enrollment.OTPAuthURI)
+
+	code, err := readLine("Code from the app: ")
+	if err != nil {
+		return fmt.Errorf("failed to read code: %w", err)
+	}
+	codes, err := client.ConfirmMFA(code)
+	if err != nil {
+		return fmt.Errorf("failed to enable MFA: %w", err)
+	}
+
+	fmt.Fprintf(os.Stderr, "✓ MFA enabled\n\n")
+	printRecoveryCodes(codes)
+	return nil
+}
+
+func runMFAVerify(cmd *cobra.Command, args []string) error {
+	client, err := NewClient()
+	if err != nil {
+		return err
+	}
+
+	code, err := readLine("MFA code (or recovery code): ")
+	if err != nil {
+		return fmt.Errorf("failed to read code: %w", err)
+	}
+	resp, err := client.VerifyMFA(code)
+	if err != nil {
+		return fmt.Errorf("failed to verify MFA: %w", err)
+	}
+
+	// Loaded after NewClient, which may have refreshed the stored token
+	tokenData, err := LoadToken()
+	if err != nil {
+		return err
+	}
+	tokenData.Token = resp.Token
+	tokenData.ExpiresAt = resp.ExpiresAt
+	if err := SaveToken(tokenData); err != nil {
+		return fmt.Errorf("failed to save token: %w", err)
+	}
+	fmt.Fprintf(os.Stderr, "✓ MFA verified for this session\n")
+	return nil
+}
+
+func runMFARecoveryCodes(cmd *cobra.Command, args []string) error {
+	client, err := NewClient()
+	if err != nil {
+		return err
+	}
+
+	code, err := readLine("MFA code: ")
+	if err != nil {
+		return fmt.Errorf("failed to read code: %w", err)
+	}
+	codes, err := client.RegenerateRecoveryCodes(code)
+	if err != nil {
+		return fmt.Errorf("failed to replace recovery codes: %w", err)
+	}
+	fmt.Fprintf(os.Stderr, "✓ Recovery codes replaced; the old ones no longer work\n\n")
+	printRecoveryCodes(codes)
+	return nil
+}
+
+func runMFADisable(cmd *cobra.Command, args []string) error {
+	client, err := NewClient()
+	if err != nil {
+		return err
+	}
+
+	code, err := readLine("MFA code (or recovery code): ")
+	if err != nil {
+		return fmt.Errorf("failed to read code: %w", err)
+	}
+	if err := client.DisableMFA(code); err != nil {
+		return fmt.Errorf("failed to disable MFA: %w", err)
+	}
+	fmt.Fprintf(os.Stderr, "✓ MFA disabled\n")
+	return nil
+}
+
+func runMFAReset(cmd *cobra.Command, args []string) error {
+	client, err := NewClient()
+	if err != nil {
+		return err
+	}
+
+	if err := client.ResetUserMFA(args[0]); err != nil {
+		return fmt.Errorf("failed to reset MFA of %s: %w", args[0], err)
+	}
+	fmt.Fprintf(os.Stderr, "✓ MFA of %s reset\n", args[0])
+	return nil
+}
+
+// printRecoveryCodes prints recovery codes to stdout, with a note to keep
+// them.
+func printRecoveryCodes(codes []string) {
+	fmt.Fprintf(os.Stderr, "Recovery codes (each works once; store them somewhere safe, they are not shown again):\n\n")
+	for _, c := range codes {
+		fmt.Println("  " + c)
+	}
+}
@@ -0,0 +1,343 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+// --- Operator API types ---
+
+// RewrapProgress mirrors the server's re-wrap job progress.
+type RewrapProgress struct {
+	State         string `json:"state"`
+	TargetVersion int    `json:"target_version"`
+	Total         int64  `json:"total"`
+	Rewrapped     int64  `json:"rewrapped"`
+	Failed        int64  `json:"failed"`
+	StartedBy     string `json:"started_by,omitempty"`
+	StartedAt     string `json:"started_at,omitempty"`
+	FinishedAt    string `json:"finished_at,omitempty"`
+	Error         string `json:"error,omitempty"`
+}
+
+// RewrapStatus describes the server's master keyring and pending re-wrap work.
+type RewrapStatus struct {
+	KeyProvider       string `json:"key_provider"`
+	CurrentKeyVersion int    `json:"current_key_version"`
+	KeyVersions       []int  `json:"key_versions"`
+	Pending           struct {
+		SecretVersions     int64 `json:"secret_versions"`
+		Leases             int64 `json:"leases"`
+		TransitKeyVersions int64 `json:"transit_key_versions"`
+		ProjectKeys        int64 `json:"project_keys"`
+		WrappingTokens     int64 `json:"wrapping_tokens"`
+		ChangeRequests     int64 `json:"change_requests"`
+	} `json:"pending"`
+	Job RewrapProgress `json:"job"`
+}
+
+// SealStatus mirrors the server's seal state.
+type SealStatus struct {
+	Initialized bool `json:"initialized"`
+	Sealed      bool `json:"sealed"`
+	Shares      int  `json:"secret_shares"`
+	Threshold   int  `json:"secret_threshold"`
+	Progress    int  `json:"progress"`
+}
+
+// InitResult holds the unseal shares returned by init.
+type InitResult struct {
+	Shares          []string `json:"shares"`
+	SecretShares    int      `json:"secret_shares"`
+	SecretThreshold int      `json:"secret_threshold"`
+}
+
+// --- API client methods ---
+
+// GetSealStatus returns whether the vault is initialized and sealed.
+func (c *APIClient) GetSealStatus() (*SealStatus, error) {
+	var resp SealStatus
+	if err := c.do("GET", "/api/v1/sys/seal-status", nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// InitVault seals the master keyring and returns the unseal shares.
+func (c *APIClient) InitVault(shares, threshold int) (*InitResult, error) {
+	var resp InitResult
+	err := c.do("POST", "/api/v1/sys/init", map[string]int{
+		"secret_shares":    shares,
+		"secret_threshold": threshold,
+	}, &resp)
+	if err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Unseal submits one unseal share, or discards progress if reset is set.
+func (c *APIClient) Unseal(share string, reset bool) (*SealStatus, error) {
+	var resp SealStatus
+	err := c.do("POST", "/api/v1/sys/unseal", map[string]interface{}{
+		"share": share,
+		"reset": reset,
+	}, &resp)
+	if err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Seal drops the server's master keyring from memory.
+func (c *APIClient) Seal() (*SealStatus, error) {
+	var resp SealStatus
+	if err := c.do("POST", "/api/v1/sys/seal", nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// GetRewrapStatus returns keyring versions and re-wrap progress.
+func (c *APIClient) GetRewrapStatus() (*RewrapStatus, error) {
+	var resp RewrapStatus
+	if err := c.do("GET", "/api/v1/sys/rewrap", nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// StartRewrap starts re-wrapping all DEKs under the current master key.
+func (c *APIClient) StartRewrap() (*RewrapProgress, error) {
+	var resp RewrapProgress
+	if err := c.do("POST", "/api/v1/sys/rewrap", nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// --- Cobra commands ---
+
+var operatorCmd = &cobra.Command{
+	Use:   "operator",
+	Short: "Server operations: seal/unseal and master key re-wrap (admin only)",
+	Long: `Administrative operations against the TeamVault server.
+
+Examples:
+  teamvault operator init --shares 5 --threshold 3
+  teamvault operator unseal
+  teamvault operator status
+  teamvault operator seal
+  teamvault operator rewrap --status
+  teamvault operator rewrap`,
+}
+
+var (
+	rewrapStatusOnly bool
+	initShares       int
+	initThreshold    int
+	unsealReset      bool
+)
+
+var operatorInitCmd = &cobra.Command{
+	Use:   "init",
+	Short: "Initialize sealed mode and print unseal shares",
+	Long: `Seal the master keyring under a new root key and split that root key into
+Shamir shares. The server must run with KEY_PROVIDER=shamir. If MASTER_KEY is
+still set on the server, the existing keyring is sealed; otherwise a fresh
+master key is generated.
+
+The shares are printed exactly once. Distribute them to different operators;
+any --threshold of them can unseal the server.
+
+Examples:
+  teamvault operator init --shares 5 --threshold 3`,
+	RunE: runOperatorInit,
+}
+
+var operatorUnsealCmd = &cobra.Command{
+	Use:   "unseal [SHARE]",
+	Short: "Submit an unseal share",
+	Long: `Submit one unseal share. The server unseals once enough operators have
+submitted their shares. If SHARE is omitted you are prompted for it without echo.
+
+Examples:
+  teamvault operator unseal
+  teamvault operator unseal --reset`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runOperatorUnseal,
+}
+
+var operatorSealCmd = &cobra.Command{
+	Use:   "seal",
+	Short: "Seal the server (emergency)",
+	Long: `Drop the master keyring from server memory. All secret endpoints return 503
+until operators unseal again.
+
+Examples:
+  teamvault operator seal`,
+	Args: cobra.NoArgs,
+	RunE: runOperatorSeal,
+}
+
+var operatorStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show seal status",
+	Args:  cobra.NoArgs,
+	RunE:  runOperatorStatus,
+}
+
+var operatorRewrapCmd = &cobra.Command{
+	Use:   "rewrap",
+	Short: "Re-wrap all DEKs under the newest master key",
+	Long: `Start an online job that re-encrypts every data encryption key with the
+current (highest) master key version. Secret ciphertext is not touched.
+
+Add the new key to MASTER_KEY as "1:<old-hex>,2:<new-hex>", restart the
+server, then run this command. Once nothing is pending, the old key can be
+removed from the keyring.
+
+Examples:
+  teamvault operator rewrap
+  teamvault operator rewrap --status`,
+	RunE: runOperatorRewrap,
+}
+
+func init() {
+	operatorRewrapCmd.Flags().BoolVar(&rewrapStatusOnly, "status", false, "Only show keyring and re-wrap progress")
+	operatorInitCmd.Flags().IntVar(&initShares, "shares", 5, "Number of unseal shares to create")
+	operatorInitCmd.Flags().IntVar(&initThreshold, "threshold", 3, "Number of shares required to unseal")
+	operatorUnsealCmd.Flags().BoolVar(&unsealReset, "reset", false, "Discard shares submitted so far")
+
+	operatorCmd.AddCommand(operatorInitCmd)
+	operatorCmd.AddCommand(operatorUnsealCmd)
+	operatorCmd.AddCommand(operatorSealCmd)
+	operatorCmd.AddCommand(operatorStatusCmd)
+	operatorCmd.AddCommand(operatorRewrapCmd)
+}
+
+func runOperatorInit(cmd *cobra.Command, args []string) error {
+	client, err := NewClient()
+	if err != nil {
+		return err
+	}
+
+	result, err := client.InitVault(initShares, initThreshold)
+	if err != nil {
+		return fmt.Errorf("failed to initialize: %w", err)
+	}
+
+	for i, share := range result.Shares {
+		fmt.Fprintf(os.Stdout, "Unseal Share %d: %s\n", i+1, share)
+	}
+	fmt.Fprintf(os.Stderr, "\n✓ Vault initialized with %d shares, threshold %d\n", result.SecretShares, result.SecretThreshold)
+	fmt.Fprintf(os.Stderr, "  These shares will not be shown again. Distribute them to separate operators.\n")
+	fmt.Fprintf(os.Stderr, "  The server is sealed; run 'teamvault operator unseal' %d times to unseal it.\n", result.SecretThreshold)
+	return nil
+}
+
+func runOperatorUnseal(cmd *cobra.Command, args []string) error {
+	client, err := NewClient()
+	if err != nil {
+		return err
+	}
+
+	var share string
+	if !unsealReset {
+		if len(args) == 1 {
+			share = args[0]
+		} else {
+			share, err = readPassword("Unseal share: ")
+			if err != nil {
+				return fmt.Errorf("reading share: %w", err)
+			}
+		}
+	}
+
+	status, err := client.Unseal(share, unsealReset)
+	if err != nil {
+		return fmt.Errorf("unseal failed: %w", err)
+	}
+
+	switch {
+	case unsealReset:
+		fmt.Fprintf(os.Stderr, "✓ Unseal progress reset\n")
+	case !status.Sealed:
+		fmt.Fprintf(os.Stderr, "✓ Vault unsealed\n")
+	default:
+		fmt.Fprintf(os.Stderr, "✓ Share accepted (%d/%d)\n", status.Progress, status.Threshold)
+	}
+	return nil
+}
+
+func runOperatorSeal(cmd *cobra.Command, args []string) error {
+	client, err := NewClient()
+	if err != nil {
+		return err
+	}
+
+	if _, err := client.Seal(); err != nil {
+		return fmt.Errorf("seal failed: %w", err)
+	}
+	fmt.Fprintf(os.Stderr, "✓ Vault sealed\n")
+	return nil
+}
+
+func runOperatorStatus(cmd *cobra.Command, args []string) error {
+	client, err := NewClient()
+	if err != nil {
+		return err
+	}
+
+	status, err := client.GetSealStatus()
+	if err != nil {
+		return fmt.Errorf("failed to get seal status: %w", err)
+	}
+
+	fmt.Fprintf(os.Stdout, "Initialized: %v\n", status.Initialized)
+	fmt.Fprintf(os.Stdout, "Sealed:      %v\n", status.Sealed)
+	if status.Threshold > 0 {
+		fmt.Fprintf(os.Stdout, "Shares:      %d (threshold %d)\n", status.Shares, status.Threshold)
+	}
+	if status.Sealed && status.Initialized {
+		fmt.Fprintf(os.Stdout, "Progress:    %d/%d\n", status.Progress, status.Threshold)
+	}
+	return nil
+}
+
+func runOperatorRewrap(cmd *cobra.Command, args []string) error {
+	client, err := NewClient()
+	if err != nil {
+		return err
+	}
+
+	if !rewrapStatusOnly {
+		progress, err := client.StartRewrap()
+		if err != nil {
+			return fmt.Errorf("failed to start re-wrap: %w", err)
+		}
+		fmt.Fprintf(os.Stderr, "✓ Re-wrap started: %d DEKs to move to master key v%d\n", progress.Total, progress.TargetVersion)
+	}
+
+	status, err := client.GetRewrapStatus()
+	if err != nil {
+		return fmt.Errorf("failed to get re-wrap status: %w", err)
+	}
+
+	fmt.Fprintf(os.Stdout, "Key Provider:        %s\n", status.KeyProvider)
+	fmt.Fprintf(os.Stdout, "Current Key Version: %d\n", status.CurrentKeyVersion)
+	fmt.Fprintf(os.Stdout, "Keyring:             %v\n", status.KeyVersions)
+	fmt.Fprintf(os.Stdout, "Pending:             %d secret versions, %d leases, %d transit key versions, %d wrapping tokens, %d change requests, %d project keys\n",
+		status.Pending.SecretVersions, status.Pending.Leases, status.Pending.TransitKeyVersions, status.Pending.WrappingTokens, status.Pending.ChangeRequests, status.Pending.ProjectKeys)
+	fmt.Fprintf(os.Stdout, "Job State:           %s\n", status.Job.State)
+	if status.Job.State != "idle" {
+		fmt.Fprintf(os.Stdout, "Progress:            %d/%d re-wrapped, %d failed\n", status.Job.Rewrapped, status.Job.Total, status.Job.Failed)
+	}
+	if status.Job.Error != "" {
+		fmt.Fprintf(os.Stdout, "Last Error:          %s\n", status.Job.Error)
+	}
+
+	return nil
+}
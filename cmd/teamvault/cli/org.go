@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"strings"
 	"text/tabwriter"
 
 	"github.com/spf13/cobra"
@@ -52,6 +53,20 @@ func (c *APIClient) ListOrgs() ([]OrgResponse, error) {
 	return resp, nil
 }
 
+// BreakGlassRule lets members of the team TeamID break glass on the secrets
+// matching Path ("project/path" pattern).
+type BreakGlassRule struct {
+	TeamID string `json:"team_id"`
+	Path   string `json:"path"`
+}
+
+// SetBreakGlassRules replaces the break-glass rules of an organization.
+func (c *APIClient) SetBreakGlassRules(orgID string, rules []BreakGlassRule) error {
+	return c.do("PUT", fmt.Sprintf("/api/v1/orgs/%s/break-glass", orgID), map[string]interface{}{
+		"rules": rules,
+	}, nil)
+}
+
 // --- Cobra commands ---
 
 var orgCmd = &cobra.Command{
@@ -91,6 +106,22 @@ Examples:
 	RunE: runOrgList,
 }
 
+var orgBreakGlassCmd = &cobra.Command{
+	Use:   "break-glass ORG_ID [PATTERN=TEAM_ID]...",
+	Short: "Set which teams may break glass on which secrets",
+	Long: `Replace the break-glass rules of an organization. Each rule lets members
+of a team break glass (read a secret for 30 minutes without approval) on the
+secrets of the org's projects matching PATTERN. Without rules, nobody can
+break glass in the organization.
+
+Examples:
+  teamvault org break-glass 1a2b... 'payments/prod/**=6c1d...'
+  teamvault org break-glass 1a2b... 'payments/prod/db/*=6c1d...' '*/prod/**=9f2a...'
+  teamvault org break-glass 1a2b...`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: runOrgBreakGlass,
+}
+
 func init() {
 	orgCreateCmd.Flags().StringVar(&orgCreateName, "name", "", "Organization name (slug, required)")
 	orgCreateCmd.Flags().StringVar(&orgCreateDisplayName, "display-name", "", "Display name")
@@ -99,6 +130,7 @@ func init() {
 
 	orgCmd.AddCommand(orgCreateCmd)
 	orgCmd.AddCommand(orgListCmd)
+	orgCmd.AddCommand(orgBreakGlassCmd)
 }
 
 func runOrgCreate(cmd *cobra.Command, args []string) error {
@@ -159,3 +191,29 @@ func runOrgList(cmd *cobra.Command, args []string) error {
 
 	return nil
 }
+
+func runOrgBreakGlass(cmd *cobra.Command, args []string) error {
+	rules := make([]BreakGlassRule, 0, len(args)-1)
+	for _, arg := range args[1:] {
+		pattern, team, ok := strings.Cut(arg, "=")
+		if !ok || pattern == "" || team == "" {
+			return fmt.Errorf("rule %q must be PATTERN=TEAM_ID", arg)
+		}
+		rules = append(rules, BreakGlassRule{TeamID: team, Path: pattern})
+	}
+
+	client, err := NewClient()
+	if err != nil {
+		return err
+	}
+	if err := client.SetBreakGlassRules(args[0], rules); err != nil {
+		return fmt.Errorf("failed to set break-glass rules: %w", err)
+	}
+
+	if len(rules) == 0 {
+		fmt.Fprintf(os.Stderr, "✓ Break glass disabled for organization %s\n", args[0])
+	} else {
+		fmt.Fprintf(os.Stderr, "✓ Break-glass rules of organization %s set\n", args[0])
+	}
+	return nil
+}
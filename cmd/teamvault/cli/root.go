@@ -20,6 +20,7 @@ func Execute() error {
 
 func init() {
 	rootCmd.AddCommand(loginCmd)
+	rootCmd.AddCommand(logoutCmd)
 	rootCmd.AddCommand(kvCmd)
 	rootCmd.AddCommand(runCmd)
 	rootCmd.AddCommand(tokenCmd)
@@ -28,6 +29,18 @@ func init() {
 	rootCmd.AddCommand(orgCmd)
 	rootCmd.AddCommand(teamCmd)
 
+	// Project environments and promotion
+	rootCmd.AddCommand(envCmd)
+
+	// Two-person approval for protected paths
+	rootCmd.AddCommand(changeCmd)
+
+	// Just-in-time access requests
+	rootCmd.AddCommand(accessCmd)
+
+	// One-time sharing (response wrapping)
+	rootCmd.AddCommand(shareCmd)
+
 	// Secret rotation
 	rootCmd.AddCommand(rotationCmd)
 	rootCmd.AddCommand(rotateCmd)
@@ -44,4 +57,16 @@ func init() {
 
 	// Secret scanning
 	rootCmd.AddCommand(scanCmd)
+
+	// Login sessions (admin)
+	rootCmd.AddCommand(sessionCmd)
+
+	// Multi-factor authentication
+	rootCmd.AddCommand(mfaCmd)
+
+	// Server operations
+	rootCmd.AddCommand(operatorCmd)
+
+	// End-to-end encrypted projects
+	rootCmd.AddCommand(e2eCmd)
 }
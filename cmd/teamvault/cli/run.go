@@ -13,6 +13,7 @@ import (
 var (
 	runProject string
 	runMap     string
+	runEnv     string
 )
 
 var runCmd = &cobra.Command{
@@ -22,21 +23,27 @@ var runCmd = &cobra.Command{
 into a child process. Secrets are NEVER printed to stdout or stderr.
 
 The --map flag specifies mappings from environment variable names to secret
-paths within the project. Multiple mappings are comma-separated.
+paths within the project. Multiple mappings are comma-separated. A path may
+name one field of a JSON secret as path#field. With --env, paths are read
+from that environment of the project ("<env>/path"), including the keys it
+inherits from its parent environments.
 
 The child process inherits the current environment plus the injected secrets.
 When the child exits, the secrets are gone (they only exist in the child's env).
 
 Examples:
   teamvault run --project myproject --map "STRIPE_KEY=api-keys/stripe,DB_URL=db/postgres-url" -- node server.js
-  teamvault run --project myproject --map "API_KEY=keys/main" -- ./my-app --port 8080`,
+  teamvault run --project myproject --map "API_KEY=keys/main" -- ./my-app --port 8080
+  teamvault run --project myproject --map "DB_USER=db/config#user,DB_PASS=db/config#password" -- ./migrate
+  teamvault run --project myproject --env staging --map "DB_URL=db/postgres-url" -- ./my-app`,
 	DisableFlagParsing: false,
 	RunE:               runRun,
 }
 
 func init() {
 	runCmd.Flags().StringVar(&runProject, "project", "", "Project containing the secrets")
-	runCmd.Flags().StringVar(&runMap, "map", "", "Secret mappings as ENV=path,ENV2=path2")
+	runCmd.Flags().StringVar(&runMap, "map", "", "Secret mappings as ENV=path,ENV2=path2#field")
+	runCmd.Flags().StringVar(&runEnv, "env", "", "Project environment to read the mapped paths from")
 	runCmd.MarkFlagRequired("project")
 	runCmd.MarkFlagRequired("map")
 }
@@ -91,15 +98,40 @@ func runRun(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
-	// Fetch all secrets
+	// Fetch all secrets in one batch request
 	// SECURITY: Secret values are NEVER printed to stdout/stderr
-	secretEnv := make(map[string]string, len(mappings))
+	envVars := make([]string, 0, len(mappings))
+	paths := make([]string, 0, len(mappings))
+	seen := make(map[string]bool, len(mappings))
 	for envVar, secretPath := range mappings {
-		secret, err := client.GetSecret(runProject, secretPath)
-		if err != nil {
-			return fmt.Errorf("failed to fetch secret %s/%s for %s: %w", runProject, secretPath, envVar, err)
+		if runEnv != "" {
+			secretPath = runEnv + "/" + secretPath
+			mappings[envVar] = secretPath
+		}
+		envVars = append(envVars, envVar)
+		if !seen[secretPath] {
+			seen[secretPath] = true
+			paths = append(paths, secretPath)
+		}
+	}
+	results, err := client.BatchGetSecrets(runProject, paths, false)
+	if err != nil {
+		return fmt.Errorf("failed to fetch secrets from %s: %w", runProject, err)
+	}
+	values := make(map[string]string, len(results))
+	for _, r := range results {
+		if !r.OK() {
+			return fmt.Errorf("failed to fetch secret %s/%s: %s (%d)", runProject, r.Path, r.Error, r.Status)
+		}
+		if r.MovedTo != "" {
+			fmt.Fprintf(os.Stderr, "⚠ %s/%s has moved to %s; update your mapping before the old path stops working\n", runProject, r.Path, r.MovedTo)
 		}
-		secretEnv[envVar] = secret.Value
+		values[r.Path] = r.Value
+	}
+
+	secretEnv := make(map[string]string, len(mappings))
+	for _, envVar := range envVars {
+		secretEnv[envVar] = values[mappings[envVar]]
 	}
 
 	// Log that we fetched secrets (but NEVER the values themselves)
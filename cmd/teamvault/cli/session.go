@@ -0,0 +1,161 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// --- Session API types ---
+
+// Session is a login of a user.
+type Session struct {
+	ID         string     `json:"id"`
+	UserID     string     `json:"user_id"`
+	IP         string     `json:"ip,omitempty"`
+	UserAgent  string     `json:"user_agent,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt time.Time  `json:"last_used_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+// --- API client methods ---
+
+// ListUserSessions lists the active sessions of a user, or all of them.
+func (c *APIClient) ListUserSessions(userID string, all bool) ([]Session, error) {
+	endpoint := "/api/v1/users/" + userID + "/sessions"
+	if all {
+		endpoint += "?all=true"
+	}
+	var resp struct {
+		Sessions []Session `json:"sessions"`
+	}
+	if err := c.do("GET", endpoint, nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Sessions, nil
+}
+
+// RevokeSession ends one session.
+func (c *APIClient) RevokeSession(id string) error {
+	return c.do("DELETE", "/api/v1/sessions/"+id, nil, nil)
+}
+
+// RevokeUserSessions ends every active session of a user and returns how
+// many there were.
+func (c *APIClient) RevokeUserSessions(userID string) (int, error) {
+	var resp struct {
+		Revoked int `json:"revoked"`
+	}
+	if err := c.do("DELETE", "/api/v1/users/"+userID+"/sessions", nil, &resp); err != nil {
+		return 0, err
+	}
+	return resp.Revoked, nil
+}
+
+// --- Commands ---
+
+var sessionCmd = &cobra.Command{
+	Use:   "session",
+	Short: "Manage user sessions (admin)",
+	Long: `List and revoke the login sessions of users. Revoking a session stops
+its refresh token and its current access token at once.`,
+}
+
+var sessionListAll bool
+
+var sessionListCmd = &cobra.Command{
+	Use:   "list USER_ID",
+	Short: "List a user's sessions",
+	Long: `List the active sessions of a user, newest first.
+
+Examples:
+  teamvault session list 5f1c...
+  teamvault session list 5f1c... --all   # include revoked and expired ones`,
+	Args: cobra.ExactArgs(1),
+	RunE: runSessionList,
+}
+
+var sessionRevokeUser string
+
+var sessionRevokeCmd = &cobra.Command{
+	Use:   "revoke [SESSION_ID]",
+	Short: "Revoke a session, or all sessions of a user",
+	Long: `Revoke one session by ID, or with --user every active session of a user.
+
+Examples:
+  teamvault session revoke 9a2e...
+  teamvault session revoke --user 5f1c...`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runSessionRevoke,
+}
+
+func init() {
+	sessionListCmd.Flags().BoolVar(&sessionListAll, "all", false, "Include revoked and expired sessions")
+	sessionRevokeCmd.Flags().StringVar(&sessionRevokeUser, "user", "", "Revoke every active session of this user ID")
+
+	sessionCmd.AddCommand(sessionListCmd)
+	sessionCmd.AddCommand(sessionRevokeCmd)
+}
+
+func runSessionList(cmd *cobra.Command, args []string) error {
+	client, err := NewClient()
+	if err != nil {
+		return err
+	}
+
+	sessions, err := client.ListUserSessions(args[0], sessionListAll)
+	if err != nil {
+		return fmt.Errorf("failed to list sessions: %w", err)
+	}
+	if len(sessions) == 0 {
+		fmt.Fprintf(os.Stderr, "No sessions\n")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tIP\tCREATED\tLAST USED\tSTATUS\tCLIENT")
+	for _, s := range sessions {
+		status := "active"
+		if s.RevokedAt != nil {
+			status = "revoked"
+		} else if s.ExpiresAt.Before(time.Now()) {
+			status = "expired"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", s.ID, s.IP,
+			s.CreatedAt.Local().Format("2006-01-02 15:04"), s.LastUsedAt.Local().Format("2006-01-02 15:04"),
+			status, s.UserAgent)
+	}
+	w.Flush()
+	return nil
+}
+
+func runSessionRevoke(cmd *cobra.Command, args []string) error {
+	if (len(args) == 1) == (sessionRevokeUser != "") {
+		return fmt.Errorf("give either a session ID or --user")
+	}
+
+	client, err := NewClient()
+	if err != nil {
+		return err
+	}
+
+	if sessionRevokeUser != "" {
+		n, err := client.RevokeUserSessions(sessionRevokeUser)
+		if err != nil {
+			return fmt.Errorf("failed to revoke sessions: %w", err)
+		}
+		fmt.Fprintf(os.Stderr, "✓ Revoked %d session(s) of %s\n", n, sessionRevokeUser)
+		return nil
+	}
+
+	if err := client.RevokeSession(args[0]); err != nil {
+		return fmt.Errorf("failed to revoke session %s: %w", args[0], err)
+	}
+	fmt.Fprintf(os.Stderr, "✓ Session %s revoked\n", args[0])
+	return nil
+}
@@ -0,0 +1,336 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/teamvault/teamvault/internal/jsonfield"
+)
+
+// --- Response wrapping API types ---
+
+// WrapInfo describes a wrapping token: a response stored on the server that
+// can be unwrapped exactly once before it expires.
+type WrapInfo struct {
+	Token        string    `json:"token"`
+	Accessor     string    `json:"accessor"`
+	TTL          int       `json:"ttl"`
+	ExpiresAt    time.Time `json:"expires_at"`
+	CreationPath string    `json:"creation_path"`
+}
+
+// WrappingToken is what the creator of a wrapping token can see of it.
+type WrappingToken struct {
+	Accessor        string     `json:"accessor"`
+	CreationPath    string     `json:"creation_path"`
+	CreatedBy       string     `json:"created_by"`
+	ExpiresAt       time.Time  `json:"expires_at"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UnwrappedAt     *time.Time `json:"unwrapped_at,omitempty"`
+	UnwrappedByType string     `json:"unwrapped_by_type,omitempty"`
+	UnwrappedBy     string     `json:"unwrapped_by,omitempty"`
+}
+
+// --- API client methods ---
+
+// WrapSecret reads a secret (or one field of it) and returns a wrapping token
+// for the response instead of the value.
+func (c *APIClient) WrapSecret(project, path, field string, version int, ttl string) (*WrapInfo, error) {
+	q := url.Values{}
+	if field != "" {
+		q.Set("field", field)
+	}
+	if version > 0 {
+		q.Set("version", strconv.Itoa(version))
+	}
+	endpoint := fmt.Sprintf("/api/v1/secrets/%s/%s", project, path)
+	if len(q) > 0 {
+		endpoint += "?" + q.Encode()
+	}
+
+	var resp struct {
+		WrapInfo *WrapInfo `json:"wrap_info"`
+	}
+	if err := c.doWithHeaders("GET", endpoint, map[string]string{"X-TeamVault-Wrap-TTL": ttl}, nil, &resp); err != nil {
+		return nil, err
+	}
+	if resp.WrapInfo == nil {
+		return nil, fmt.Errorf("server did not wrap the response (does it support response wrapping?)")
+	}
+	return resp.WrapInfo, nil
+}
+
+// WrapData returns a wrapping token for arbitrary data.
+func (c *APIClient) WrapData(data interface{}, ttl string) (*WrapInfo, error) {
+	var resp struct {
+		WrapInfo *WrapInfo `json:"wrap_info"`
+	}
+	if err := c.do("POST", "/api/v1/sys/wrap", map[string]interface{}{"data": data, "ttl": ttl}, &resp); err != nil {
+		return nil, err
+	}
+	return resp.WrapInfo, nil
+}
+
+// Unwrap returns the response stored under a wrapping token, which is
+// destroyed on the server. It works without logging in.
+func (c *APIClient) Unwrap(token string) (json.RawMessage, error) {
+	var resp json.RawMessage
+	if err := c.do("POST", "/api/v1/sys/unwrap", map[string]string{"token": token}, &resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// LookupWrappingToken shows whether a wrapping token has been unwrapped.
+func (c *APIClient) LookupWrappingToken(accessor string) (*WrappingToken, error) {
+	var resp WrappingToken
+	if err := c.do("GET", "/api/v1/sys/wrapping/"+accessor, nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// RevokeWrappingToken destroys an unused wrapping token.
+func (c *APIClient) RevokeWrappingToken(accessor string) error {
+	return c.do("DELETE", "/api/v1/sys/wrapping/"+accessor, nil, nil)
+}
+
+// --- Cobra commands ---
+
+var shareCmd = &cobra.Command{
+	Use:   "share",
+	Short: "Share a secret once through a single-use link",
+	Long: `Share a secret with someone exactly once. The secret is stored on the
+server under a wrapping token that can be opened a single time, by anyone
+holding it, until it expires. Opening it needs no TeamVault account; the audit
+log records who opened it and from where.
+
+Examples:
+  teamvault share create myapp/db/password --ttl 1h
+  teamvault share create myapp/db/config#password
+  echo -n "temporary-pass" | teamvault share create --stdin
+  teamvault share open wrap.3f9a... --server https://vault.example.com
+  teamvault share status 6c1d...
+  teamvault share revoke 6c1d...`,
+}
+
+var (
+	shareTTL     string
+	shareVersion int
+	shareStdin   bool
+	shareLink    string
+	shareServer  string
+)
+
+var shareCreateCmd = &cobra.Command{
+	Use:   "create [PROJECT/PATH[#FIELD]]",
+	Short: "Create a single-use token for a secret",
+	Long: `Read a secret and store it under a single-use wrapping token instead of
+printing it. The token is printed to stdout; hand it over through any channel,
+as it is useless once opened or expired. With --stdin, the text read from
+stdin is shared instead of a stored secret.
+
+Secrets of end-to-end encrypted projects cannot be shared this way, as the
+server cannot read them.
+
+Examples:
+  teamvault share create myapp/db/password
+  teamvault share create myapp/db/password --ttl 30m --version 3
+  teamvault share create myapp/db/password --link https://vault.example.com
+  echo -n "temporary-pass" | teamvault share create --stdin --ttl 2h`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runShareCreate,
+}
+
+var shareOpenCmd = &cobra.Command{
+	Use:   "open TOKEN",
+	Short: "Open a shared secret (works only once)",
+	Long: `Unwrap a wrapping token and print the secret to stdout. The token is
+destroyed on the server, so this works only once. No login is needed; without
+one, --server tells which TeamVault server the token belongs to.
+
+Examples:
+  teamvault share open wrap.3f9a...
+  teamvault share open wrap.3f9a... --server https://vault.example.com > db-password`,
+	Args: cobra.ExactArgs(1),
+	RunE: runShareOpen,
+}
+
+var shareStatusCmd = &cobra.Command{
+	Use:   "status ACCESSOR",
+	Short: "Show whether a shared secret has been opened",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runShareStatus,
+}
+
+var shareRevokeCmd = &cobra.Command{
+	Use:   "revoke ACCESSOR",
+	Short: "Destroy a shared secret before it is opened",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runShareRevoke,
+}
+
+func init() {
+	shareCreateCmd.Flags().StringVar(&shareTTL, "ttl", "24h", "How long the token can be opened (at most 168h)")
+	shareCreateCmd.Flags().IntVar(&shareVersion, "version", 0, "Share a specific version instead of the latest")
+	shareCreateCmd.Flags().BoolVar(&shareStdin, "stdin", false, "Share text read from stdin instead of a stored secret")
+	shareCreateCmd.Flags().StringVar(&shareLink, "link", "", "Also print a link to the share page of the web console at this URL")
+
+	shareOpenCmd.Flags().StringVar(&shareServer, "server", "", "TeamVault server URL (default: the one logged in to)")
+
+	shareCmd.AddCommand(shareCreateCmd)
+	shareCmd.AddCommand(shareOpenCmd)
+	shareCmd.AddCommand(shareStatusCmd)
+	shareCmd.AddCommand(shareRevokeCmd)
+}
+
+func runShareCreate(cmd *cobra.Command, args []string) error {
+	if shareStdin == (len(args) == 1) {
+		return fmt.Errorf("give either PROJECT/PATH or --stdin")
+	}
+
+	client, err := NewClient()
+	if err != nil {
+		return err
+	}
+
+	var info *WrapInfo
+	what := "stdin"
+	if shareStdin {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return fmt.Errorf("failed to read stdin: %w", err)
+		}
+		if len(data) == 0 {
+			return fmt.Errorf("nothing to share on stdin")
+		}
+		if info, err = client.WrapData(string(data), shareTTL); err != nil {
+			return fmt.Errorf("failed to share: %w", err)
+		}
+	} else {
+		project, path, err := parseProjectPath(args[0])
+		if err != nil {
+			return err
+		}
+		e2e, err := client.e2eProject(project)
+		if err != nil {
+			return err
+		}
+		if e2e != nil {
+			return fmt.Errorf("%s is end-to-end encrypted: its secrets cannot be shared through the server (use --stdin to share a value deliberately)", project)
+		}
+		path, field := jsonfield.Split(path)
+		if info, err = client.WrapSecret(project, path, field, shareVersion, shareTTL); err != nil {
+			return fmt.Errorf("failed to share %s: %w", args[0], err)
+		}
+		what = args[0]
+	}
+
+	// Only the token goes to stdout, so it can be piped
+	fmt.Println(info.Token)
+	fmt.Fprintf(os.Stderr, "✓ Shared %s until %s (single use)\n", what, info.ExpiresAt.Local().Format(time.RFC1123))
+	fmt.Fprintf(os.Stderr, "  Accessor: %s\n", info.Accessor)
+	fmt.Fprintf(os.Stderr, "  Open with: teamvault share open %s --server %s\n", info.Token, client.BaseURL)
+	if shareLink != "" {
+		fmt.Fprintf(os.Stderr, "  Link: %s/share#%s\n", strings.TrimRight(shareLink, "/"), info.Token)
+	}
+	return nil
+}
+
+func runShareOpen(cmd *cobra.Command, args []string) error {
+	var client *APIClient
+	if shareServer != "" {
+		client = NewClientWithURL(shareServer)
+		// Authenticate if logged in to the same server, so the audit log
+		// names the person who opened it
+		if tokenData, err := LoadToken(); err == nil && strings.TrimRight(tokenData.Server, "/") == client.BaseURL {
+			client.Token = tokenData.Token
+		}
+	} else {
+		var err error
+		if client, err = NewClient(); err != nil {
+			return fmt.Errorf("%w (or give --server)", err)
+		}
+	}
+
+	raw, err := client.Unwrap(strings.TrimSpace(args[0]))
+	if err != nil {
+		if apiErr, ok := err.(*APIError); ok && apiErr.StatusCode == 410 {
+			return fmt.Errorf("%s: ask the sender to share it again", apiErr.Message)
+		}
+		return fmt.Errorf("failed to open: %w", err)
+	}
+
+	// A wrapped secret read has a value; wrapped data has data
+	var resp struct {
+		Value *string         `json:"value"`
+		Data  json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(raw, &resp); err != nil {
+		return fmt.Errorf("failed to parse shared response: %w", err)
+	}
+	switch {
+	case resp.Value != nil:
+		fmt.Print(*resp.Value)
+	case resp.Data != nil:
+		var s string
+		if json.Unmarshal(resp.Data, &s) == nil {
+			fmt.Print(s)
+		} else {
+			fmt.Print(string(resp.Data))
+		}
+	default:
+		fmt.Print(string(raw))
+	}
+	return nil
+}
+
+func runShareStatus(cmd *cobra.Command, args []string) error {
+	client, err := NewClient()
+	if err != nil {
+		return err
+	}
+
+	t, err := client.LookupWrappingToken(args[0])
+	if err != nil {
+		return fmt.Errorf("failed to look up %s: %w", args[0], err)
+	}
+
+	fmt.Fprintf(os.Stdout, "Shared:   %s\n", t.CreationPath)
+	fmt.Fprintf(os.Stdout, "Created:  %s\n", t.CreatedAt.Local().Format(time.RFC1123))
+	fmt.Fprintf(os.Stdout, "Expires:  %s\n", t.ExpiresAt.Local().Format(time.RFC1123))
+	switch {
+	case t.UnwrappedAt != nil:
+		by := t.UnwrappedByType
+		if t.UnwrappedBy != "" {
+			by += " " + t.UnwrappedBy
+		}
+		fmt.Fprintf(os.Stdout, "Opened:   %s by %s\n", t.UnwrappedAt.Local().Format(time.RFC1123), by)
+	case time.Now().After(t.ExpiresAt):
+		fmt.Fprintf(os.Stdout, "Opened:   no (expired)\n")
+	default:
+		fmt.Fprintf(os.Stdout, "Opened:   no\n")
+	}
+	return nil
+}
+
+func runShareRevoke(cmd *cobra.Command, args []string) error {
+	client, err := NewClient()
+	if err != nil {
+		return err
+	}
+
+	if err := client.RevokeWrappingToken(args[0]); err != nil {
+		return fmt.Errorf("failed to revoke %s: %w", args[0], err)
+	}
+
+	fmt.Fprintf(os.Stderr, "✓ Shared secret %s revoked\n", args[0])
+	return nil
+}
@@ -32,6 +32,19 @@ Examples:
 	RunE: runTokenCreate,
 }
 
+var tokenRotateCmd = &cobra.Command{
+	Use:   "rotate SERVICE_ACCOUNT_ID",
+	Short: "Replace a service account's token",
+	Long: `Replace the token of a service account with a new one. The old token
+stops working at once. Rotating also moves tokens issued before token IDs
+(listed with "legacy_token": true) to the faster lookup.
+
+Examples:
+  teamvault token rotate 5f1c...`,
+	Args: cobra.ExactArgs(1),
+	RunE: runTokenRotate,
+}
+
 func init() {
 	tokenCreateCmd.Flags().StringVar(&tokenProject, "project", "", "Project to scope the token to")
 	tokenCreateCmd.Flags().StringVar(&tokenScopes, "scopes", "read", "Comma-separated scopes (e.g. read,write)")
@@ -39,6 +52,7 @@ func init() {
 	tokenCreateCmd.MarkFlagRequired("project")
 
 	tokenCmd.AddCommand(tokenCreateCmd)
+	tokenCmd.AddCommand(tokenRotateCmd)
 }
 
 func runTokenCreate(cmd *cobra.Command, args []string) error {
@@ -89,7 +103,27 @@ func runTokenCreate(cmd *cobra.Command, args []string) error {
 	fmt.Print(result.Token)
 
 	fmt.Fprintf(os.Stderr, "\n\n⚠  Save this token now — it will not be shown again.\n")
-	fmt.Fprintf(os.Stderr, "   Use as: Authorization: Bearer sa.%s\n", result.Token)
+	fmt.Fprintf(os.Stderr, "   Use as: Authorization: Bearer %s\n", result.Token)
+
+	return nil
+}
 
+func runTokenRotate(cmd *cobra.Command, args []string) error {
+	client, err := NewClient()
+	if err != nil {
+		return err
+	}
+
+	token, err := client.RotateServiceAccountToken(args[0])
+	if err != nil {
+		return fmt.Errorf("failed to rotate token: %w", err)
+	}
+
+	fmt.Fprintf(os.Stderr, "✓ Service account token rotated\n\n")
+
+	// Print token to stdout so it can be captured by scripts
+	fmt.Print(token)
+
+	fmt.Fprintf(os.Stderr, "\n\n⚠  Save this token now — it will not be shown again.\n")
 	return nil
 }
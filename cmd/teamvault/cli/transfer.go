@@ -10,6 +10,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"net/http"
 	"os"
 	"time"
 
@@ -140,18 +141,27 @@ func runExport(cmd *cobra.Command, args []string) error {
 
 	fmt.Fprintf(os.Stderr, "Found %d secret(s). Fetching values...\n", len(secrets))
 
-	// Fetch full secret values
+	// Fetch full secret values in batches, with references as written so an
+	// import recreates them rather than copies of the values they point to
+	paths := make([]string, len(secrets))
+	for i, s := range secrets {
+		paths[i] = s.Path
+	}
+	results, err := client.BatchGetSecrets(exportProject, paths, true)
+	if err != nil {
+		return fmt.Errorf("failed to fetch secrets: %w", err)
+	}
+
 	var plainSecrets []plainSecret
-	for _, s := range secrets {
-		full, err := client.GetSecret(exportProject, s.Path)
-		if err != nil {
-			return fmt.Errorf("failed to fetch secret %s: %w", s.Path, err)
+	for i, r := range results {
+		if !r.OK() {
+			return fmt.Errorf("failed to fetch secret %s: %s (%d)", r.Path, r.Error, r.Status)
 		}
 		plainSecrets = append(plainSecrets, plainSecret{
-			Path:        s.Path,
-			Value:       full.Value,
-			Version:     s.Version,
-			Description: s.Description,
+			Path:        r.Path,
+			Value:       r.Value,
+			Version:     r.Version,
+			Description: secrets[i].Description,
 		})
 	}
 
@@ -303,6 +313,7 @@ func runImport(cmd *cobra.Command, args []string) error {
 	}
 
 	var imported, skipped, errored int
+	var items []BatchPutItem
 	for _, s := range envelope.Secrets {
 		// Decode ciphertext
 		ciphertext, err := base64.StdEncoding.DecodeString(s.EncryptedValue)
@@ -328,25 +339,60 @@ func runImport(cmd *cobra.Command, args []string) error {
 			continue
 		}
 
-		// Check if secret already exists (unless overwrite)
-		if !importOverwrite {
-			existing, err := client.GetSecret(project, s.Path)
-			if err == nil && existing != nil {
-				fmt.Fprintf(os.Stderr, "  ⏭ %s — already exists (v%d), skipping\n", s.Path, existing.Version)
+		items = append(items, BatchPutItem{
+			Path:        s.Path,
+			Value:       string(plaintext),
+			Description: s.Description,
+		})
+	}
+
+	// Skip secrets that already exist (unless overwrite). Secrets that do not
+	// exist yet are written with cas 0, so one created in the meantime is not
+	// overwritten either.
+	if !importOverwrite && len(items) > 0 {
+		paths := make([]string, len(items))
+		for i, item := range items {
+			paths[i] = item.Path
+		}
+		existing, err := client.BatchGetSecrets(project, paths, true)
+		if err != nil {
+			return fmt.Errorf("failed to check existing secrets: %w", err)
+		}
+		var missing []BatchPutItem
+		for i, r := range existing {
+			switch r.Status {
+			case http.StatusOK:
+				fmt.Fprintf(os.Stderr, "  ⏭ %s — already exists (v%d), skipping\n", r.Path, r.Version)
 				skipped++
-				continue
+			case http.StatusNotFound:
+				cas := 0
+				items[i].CAS = &cas
+				missing = append(missing, items[i])
+			default:
+				missing = append(missing, items[i])
 			}
 		}
+		items = missing
+	}
 
-		// Put the secret
-		if err := client.PutSecret(project, s.Path, string(plaintext)); err != nil {
-			fmt.Fprintf(os.Stderr, "  ✗ %s — failed to import: %v\n", s.Path, err)
-			errored++
+	// Write in batches; each batch is committed all-or-nothing
+	for start := 0; start < len(items); start += batchChunkSize {
+		chunk := items[start:min(start+batchChunkSize, len(items))]
+		results, err := client.BatchPutSecrets(project, chunk)
+		if err != nil {
+			for _, r := range results {
+				if r.Status != http.StatusFailedDependency {
+					fmt.Fprintf(os.Stderr, "  ✗ %s — %s\n", r.Path, r.Error)
+				}
+			}
+			fmt.Fprintf(os.Stderr, "  ✗ batch of %d secret(s) not imported: %v\n", len(chunk), err)
+			errored += len(chunk)
 			continue
 		}
-
-		fmt.Fprintf(os.Stderr, "  ✓ %s\n", s.Path)
-		imported++
+		for _, r := range results {
+			fmt.Fprintf(os.Stderr, "  ✓ %s\n", r.Path)
+		}
+		imported += len(results)
 	}
 
 	fmt.Fprintf(os.Stderr, "\nImport complete: %d imported, %d skipped, %d errors\n", imported, skipped, errored)
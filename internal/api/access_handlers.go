@@ -0,0 +1,465 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/teamvault/teamvault/internal/audit"
+	"github.com/teamvault/teamvault/internal/db"
+)
+
+// teamLeadRole is the team member role that may approve access requests
+// addressed to the team.
+const teamLeadRole = "lead"
+
+const (
+	defaultAccessDuration = time.Hour
+	maxAccessDuration     = 24 * time.Hour
+)
+
+// accessActions are the actions an access request may ask for.
+var accessActions = map[string]bool{"read": true, "list": true, "write": true, "delete": true}
+
+// createAccessRequestRequest is the body of an access request.
+type createAccessRequestRequest struct {
+	Resource      string   `json:"resource"` // "project/path", with wildcards
+	Actions       []string `json:"actions,omitempty"`
+	Justification string   `json:"justification"`
+	Duration      string   `json:"duration,omitempty"` // e.g. "4h"; default 1h
+	TeamID        string   `json:"team_id"`
+}
+
+// validateAccessResource checks the resource pattern of an access request:
+// it must name an existing project, without wildcards, that lists the team
+// among its access teams, and the team must belong to the project's
+// organization if it has one. It returns an error message or "".
+func (s *Server) validateAccessResource(ctx context.Context, resource string, team *db.Team) string {
+	projectName, path, _ := strings.Cut(resource, "/")
+	if projectName == "" || path == "" {
+		return "resource must be project/path (wildcards allowed in the path)"
+	}
+	if strings.ContainsAny(projectName, "*?[") {
+		return "resource must name a single project"
+	}
+	project, err := s.db.GetProjectByName(ctx, projectName)
+	if err != nil {
+		return "project not found"
+	}
+	if !slices.Contains(project.AccessTeams, team.ID) {
+		return "the team does not approve access to this project; its owner can add it to the project's access teams"
+	}
+	if project.OrgID != "" && project.OrgID != team.OrgID {
+		return "the team must belong to the project's organization"
+	}
+	return ""
+}
+
+// validateAccessTeams checks the access teams of a project settings update:
+// every one must be an existing team of the project's organization, if it
+// has one. It returns an error message or "".
+func (s *Server) validateAccessTeams(ctx context.Context, orgID string, teamIDs []string) string {
+	for _, id := range teamIDs {
+		if !isValidUUID(id) {
+			return "access_teams must be team IDs"
+		}
+		team, err := s.db.GetTeamByID(ctx, id)
+		if err != nil {
+			return "access team " + id + " not found"
+		}
+		if orgID != "" && team.OrgID != orgID {
+			return "access team " + id + " must belong to the project's organization"
+		}
+	}
+	return ""
+}
+
+// isTeamLead reports whether the caller leads a team.
+func (s *Server) isTeamLead(ctx context.Context, teamID string) bool {
+	claims := getUserClaims(ctx)
+	if claims == nil {
+		return false
+	}
+	member, err := s.db.GetTeamMember(ctx, teamID, claims.UserID)
+	return err == nil && member.Role == teamLeadRole
+}
+
+// accessRequestFor loads the access request named in the URL, writing a 404
+// if it does not exist or the caller may not see it: its requester, the
+// leads of its team and admins may.
+func (s *Server) accessRequestFor(w http.ResponseWriter, r *http.Request) (*db.AccessRequest, bool) {
+	ctx := r.Context()
+	id := r.PathValue("id")
+	if !isValidUUID(id) {
+		writeError(w, http.StatusNotFound, "access request not found")
+		return nil, false
+	}
+	ar, err := s.db.GetAccessRequest(ctx, id)
+	if err != nil || !(isAdmin(ctx) || getActorID(ctx) == ar.UserID || s.isTeamLead(ctx, ar.TeamID)) {
+		writeError(w, http.StatusNotFound, "access request not found")
+		return nil, false
+	}
+	return ar, true
+}
+
+// handleCreateAccessRequest asks the leads of a team for temporary access to
+// a resource pattern.
+// POST /api/v1/access-requests
+func (s *Server) handleCreateAccessRequest(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claims := getUserClaims(ctx)
+	if claims == nil {
+		writeError(w, http.StatusForbidden, "only users can request access")
+		return
+	}
+
+	var req createAccessRequestRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	req.Resource = strings.TrimPrefix(req.Resource, "/")
+	if req.Resource == "" || strings.TrimSpace(req.Justification) == "" {
+		writeError(w, http.StatusBadRequest, "resource and justification are required")
+		return
+	}
+	if !isValidUUID(req.TeamID) {
+		writeError(w, http.StatusBadRequest, "team_id must be a team ID")
+		return
+	}
+	if len(req.Actions) == 0 {
+		req.Actions = []string{"read"}
+	}
+	for _, a := range req.Actions {
+		if !accessActions[a] {
+			writeError(w, http.StatusBadRequest, "invalid action "+a+": must be read, list, write or delete")
+			return
+		}
+	}
+	duration := defaultAccessDuration
+	if req.Duration != "" {
+		d, err := time.ParseDuration(req.Duration)
+		if err != nil || d < time.Minute || d > maxAccessDuration {
+			writeError(w, http.StatusBadRequest, "duration must be between 1m and "+maxAccessDuration.String())
+			return
+		}
+		duration = d
+	}
+
+	team, err := s.db.GetTeamByID(ctx, req.TeamID)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "team not found")
+		return
+	}
+	if msg := s.validateAccessResource(ctx, req.Resource, team); msg != "" {
+		writeError(w, http.StatusBadRequest, msg)
+		return
+	}
+
+	ar, err := s.db.CreateAccessRequest(ctx, &db.AccessRequest{
+		UserID:          claims.UserID,
+		TeamID:          team.ID,
+		ResourcePattern: req.Resource,
+		Actions:         req.Actions,
+		Justification:   req.Justification,
+		DurationSeconds: int(duration / time.Second),
+	})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to create access request")
+		return
+	}
+
+	metadata, _ := json.Marshal(map[string]interface{}{
+		"access_request": ar.ID,
+		"team":           team.ID,
+		"actions":        ar.Actions,
+		"duration":       duration.String(),
+	})
+	s.audit.Log(ctx, audit.Event{
+		ActorType: "user",
+		ActorID:   claims.UserID,
+		Action:    "access.request",
+		Resource:  ar.ResourcePattern,
+		Outcome:   "success",
+		IP:        getClientIP(ctx),
+		Metadata:  metadata,
+	})
+
+	writeJSON(w, http.StatusCreated, ar)
+}
+
+// handleListAccessRequests lists the caller's access requests and those
+// addressed to teams the caller leads, newest first, optionally filtered by
+// status.
+// GET /api/v1/access-requests?status=pending
+func (s *Server) handleListAccessRequests(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claims := getUserClaims(ctx)
+	if claims == nil {
+		writeJSON(w, http.StatusOK, map[string]interface{}{"access_requests": []db.AccessRequest{}})
+		return
+	}
+
+	memberships, err := s.db.GetUserTeams(ctx, claims.UserID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to load teams")
+		return
+	}
+	led := []string{}
+	for _, m := range memberships {
+		if m.Role == teamLeadRole {
+			led = append(led, m.TeamID)
+		}
+	}
+
+	requests, err := s.db.ListAccessRequests(ctx, claims.UserID, led, r.URL.Query().Get("status"))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to list access requests")
+		return
+	}
+	if requests == nil {
+		requests = []db.AccessRequest{}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"access_requests": requests})
+}
+
+// handleGetAccessRequest returns an access request with its grant.
+// GET /api/v1/access-requests/{id}
+func (s *Server) handleGetAccessRequest(w http.ResponseWriter, r *http.Request) {
+	ar, ok := s.accessRequestFor(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, ar)
+}
+
+// handleApproveAccessRequest approves an access request, granting the
+// requester the access asked for until the requested duration has passed.
+// POST /api/v1/access-requests/{id}/approve
+func (s *Server) handleApproveAccessRequest(w http.ResponseWriter, r *http.Request) {
+	s.reviewAccessRequest(w, r, "approve")
+}
+
+// handleDenyAccessRequest denies an access request.
+// POST /api/v1/access-requests/{id}/deny
+func (s *Server) handleDenyAccessRequest(w http.ResponseWriter, r *http.Request) {
+	s.reviewAccessRequest(w, r, "deny")
+}
+
+// reviewAccessRequest records the decision of a lead of the request's team,
+// or an admin, other than the requester.
+func (s *Server) reviewAccessRequest(w http.ResponseWriter, r *http.Request, decision string) {
+	ctx := r.Context()
+	claims := getUserClaims(ctx)
+	if claims == nil {
+		writeError(w, http.StatusForbidden, "only users can review access requests")
+		return
+	}
+
+	ar, ok := s.accessRequestFor(w, r)
+	if !ok {
+		return
+	}
+	deny := func(reason string) {
+		metadata, _ := json.Marshal(map[string]string{"access_request": ar.ID, "reason": reason})
+		s.audit.Log(ctx, audit.Event{
+			ActorType: "user",
+			ActorID:   claims.UserID,
+			Action:    "access." + decision,
+			Resource:  ar.ResourcePattern,
+			Outcome:   "denied",
+			IP:        getClientIP(ctx),
+			Metadata:  metadata,
+		})
+		writeError(w, http.StatusForbidden, reason)
+	}
+	if ar.UserID == claims.UserID {
+		deny("you cannot review your own access request")
+		return
+	}
+	if !isAdmin(ctx) && !s.isTeamLead(ctx, ar.TeamID) {
+		deny("only leads of the team can review this access request")
+		return
+	}
+	if decision == "approve" && !isAdmin(ctx) {
+		// The project may have dropped the team since the request was made
+		team, err := s.db.GetTeamByID(ctx, ar.TeamID)
+		if err != nil {
+			deny("team not found")
+			return
+		}
+		if msg := s.validateAccessResource(ctx, ar.ResourcePattern, team); msg != "" {
+			deny(msg)
+			return
+		}
+	}
+
+	var req reviewRequest
+	if err := decodeJSON(r, &req); err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	var reviewed *db.AccessRequest
+	var err error
+	if decision == "approve" {
+		reviewed, err = s.db.ApproveAccessRequest(ctx, ar.ID, claims.UserID, req.Comment)
+	} else {
+		reviewed, err = s.db.DenyAccessRequest(ctx, ar.ID, claims.UserID, req.Comment)
+	}
+	if err != nil {
+		if strings.Contains(err.Error(), "no longer pending") {
+			writeError(w, http.StatusConflict, "access request is "+ar.Status)
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "failed to record review")
+		return
+	}
+
+	meta := map[string]interface{}{
+		"access_request": ar.ID,
+		"requested_by":   ar.UserID,
+	}
+	if reviewed.Grant != nil {
+		meta["grant"] = reviewed.Grant.ID
+		meta["expires_at"] = reviewed.Grant.ExpiresAt
+	}
+	metadata, _ := json.Marshal(meta)
+	s.audit.Log(ctx, audit.Event{
+		ActorType: "user",
+		ActorID:   claims.UserID,
+		Action:    "access." + decision,
+		Resource:  ar.ResourcePattern,
+		Outcome:   "success",
+		IP:        getClientIP(ctx),
+		Metadata:  metadata,
+	})
+
+	writeJSON(w, http.StatusOK, reviewed)
+}
+
+// handleCancelAccessRequest withdraws a pending access request. Only its
+// requester or an admin may.
+// POST /api/v1/access-requests/{id}/cancel
+func (s *Server) handleCancelAccessRequest(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	ar, ok := s.accessRequestFor(w, r)
+	if !ok {
+		return
+	}
+	actorID := getActorID(ctx)
+	if actorID != ar.UserID && !isAdmin(ctx) {
+		writeError(w, http.StatusForbidden, "only the requester or an admin can cancel an access request")
+		return
+	}
+
+	if err := s.db.CancelAccessRequest(ctx, ar.ID); err != nil {
+		if strings.Contains(err.Error(), "no longer pending") {
+			writeError(w, http.StatusConflict, "access request is "+ar.Status)
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "failed to cancel access request")
+		return
+	}
+
+	s.audit.Log(ctx, audit.Event{
+		ActorType: getActorType(ctx),
+		ActorID:   actorID,
+		Action:    "access.cancel",
+		Resource:  ar.ResourcePattern,
+		Outcome:   "success",
+		IP:        getClientIP(ctx),
+		Metadata:  json.RawMessage(`{"access_request":"` + ar.ID + `"}`),
+	})
+
+	ar.Status = db.AccessCancelled
+	writeJSON(w, http.StatusOK, ar)
+}
+
+// handleListAccessGrants lists the caller's active access grants.
+// GET /api/v1/access-grants
+func (s *Server) handleListAccessGrants(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	grants := []db.AccessGrant{}
+	if claims := getUserClaims(ctx); claims != nil {
+		active, err := s.db.ActiveAccessGrants(ctx, claims.UserID)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "failed to list access grants")
+			return
+		}
+		grants = append(grants, active...)
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"access_grants": grants})
+}
+
+// handleRevokeAccessGrant ends an access grant before it expires. Its
+// holder, the leads of the team that granted it and admins may revoke it.
+// DELETE /api/v1/access-grants/{id}
+func (s *Server) handleRevokeAccessGrant(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id := r.PathValue("id")
+	if !isValidUUID(id) {
+		writeError(w, http.StatusNotFound, "access grant not found")
+		return
+	}
+	grant, err := s.db.GetAccessGrant(ctx, id)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "access grant not found")
+		return
+	}
+	// Leads of the team that approved a grant may end it; break-glass
+	// grants have no request and are ended by their holder or an admin
+	lead := false
+	if grant.RequestID != nil {
+		if ar, err := s.db.GetAccessRequest(ctx, *grant.RequestID); err == nil {
+			lead = s.isTeamLead(ctx, ar.TeamID)
+		}
+	}
+	actorID := getActorID(ctx)
+	if actorID != grant.UserID && !isAdmin(ctx) && !lead {
+		writeError(w, http.StatusNotFound, "access grant not found")
+		return
+	}
+
+	revoked, err := s.db.RevokeAccessGrant(ctx, id, actorID)
+	if err != nil {
+		if strings.Contains(err.Error(), "no longer active") {
+			writeError(w, http.StatusConflict, "access grant is no longer active")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "failed to revoke access grant")
+		return
+	}
+
+	metadata, _ := json.Marshal(map[string]interface{}{
+		"grant":          revoked.ID,
+		"access_request": revoked.RequestID,
+		"break_glass":    revoked.BreakGlass,
+		"holder":         revoked.UserID,
+	})
+	s.audit.Log(ctx, audit.Event{
+		ActorType: getActorType(ctx),
+		ActorID:   actorID,
+		Action:    "access.revoke",
+		Resource:  revoked.ResourcePattern,
+		Outcome:   "success",
+		IP:        getClientIP(ctx),
+		Metadata:  metadata,
+	})
+
+	writeJSON(w, http.StatusOK, revoked)
+}
+
+// grantMeta returns a JSON member naming the access grant that allowed a
+// read, to append to its audit metadata, or "" if policies allowed it.
+func grantMeta(grantID string) string {
+	if grantID == "" {
+		return ""
+	}
+	return `,"grant":"` + grantID + `"`
+}
@@ -1,8 +1,10 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
+	"regexp"
 	"strings"
 	"time"
 
@@ -10,14 +12,29 @@ import (
 	"github.com/teamvault/teamvault/internal/db"
 )
 
+// agentRoleRegex is what an agent role may look like: policies compare it
+// verbatim.
+var agentRoleRegex = regexp.MustCompile(`^[a-z][a-z0-9_-]{0,63}$`)
+
 type createAgentRequest struct {
 	Name        string          `json:"name"`
 	Description string          `json:"description"`
 	Scopes      []string        `json:"scopes"`
+	Role        string          `json:"role,omitempty"` // role presented to policies
 	Metadata    json.RawMessage `json:"metadata"`
 	ExpiresIn   string          `json:"expires_in"` // e.g., "24h", "720h"
 }
 
+type setAgentRoleRequest struct {
+	Role string `json:"role"` // "" clears it
+}
+
+// canManageAgents reports whether the caller may create agents in a team and
+// set their roles: its leads and admins may.
+func (s *Server) canManageAgents(ctx context.Context, teamID string) bool {
+	return isAdmin(ctx) || s.isTeamLead(ctx, teamID)
+}
+
 func (s *Server) handleCreateAgent(w http.ResponseWriter, r *http.Request) {
 	claims := getUserClaims(r.Context())
 	if claims == nil {
@@ -38,6 +55,12 @@ func (s *Server) handleCreateAgent(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// An agent acts as a member of its team in policies
+	if !s.canManageAgents(r.Context(), teamID) {
+		writeError(w, http.StatusForbidden, "only a lead of the team or an admin can create agents")
+		return
+	}
+
 	var req createAgentRequest
 	if err := decodeJSON(r, &req); err != nil {
 		writeError(w, http.StatusBadRequest, "invalid request body")
@@ -49,12 +72,17 @@ func (s *Server) handleCreateAgent(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if req.Role != "" && !agentRoleRegex.MatchString(req.Role) {
+		writeError(w, http.StatusBadRequest, "role must be lowercase letters, digits, '-' or '_'")
+		return
+	}
+
 	if len(req.Scopes) == 0 {
 		req.Scopes = []string{"read"}
 	}
 
 	// Generate agent token (reusing the service account token generation)
-	rawToken, tokenHash, err := s.auth.GenerateServiceAccountToken()
+	tokenID, rawToken, tokenHash, err := s.auth.GenerateServiceAccountToken()
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, "failed to generate agent token")
 		return
@@ -71,7 +99,7 @@ func (s *Server) handleCreateAgent(w http.ResponseWriter, r *http.Request) {
 		expiresAt = &t
 	}
 
-	agent, err := s.db.CreateAgent(r.Context(), teamID, req.Name, req.Description, tokenHash, req.Scopes, req.Metadata, claims.UserID, expiresAt)
+	agent, err := s.db.CreateAgent(r.Context(), teamID, req.Name, req.Description, tokenID, tokenHash, req.Scopes, req.Role, req.Metadata, claims.UserID, expiresAt)
 	if err != nil {
 		if strings.Contains(err.Error(), "duplicate") || strings.Contains(err.Error(), "unique") {
 			writeError(w, http.StatusConflict, "agent name already exists in this team")
@@ -175,3 +203,111 @@ func (s *Server) handleDeleteAgent(w http.ResponseWriter, r *http.Request) {
 
 	writeJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
 }
+
+// handleRotateAgentToken replaces the token of an agent with a new one, which
+// is returned once. The old token stops working at once. This is also how
+// tokens issued before token IDs are migrated. The agent's creator and admins
+// may rotate it.
+// POST /api/v1/agents/{agentId}/rotate-token
+func (s *Server) handleRotateAgentToken(w http.ResponseWriter, r *http.Request) {
+	claims := getUserClaims(r.Context())
+	if claims == nil {
+		writeError(w, http.StatusUnauthorized, "user authentication required")
+		return
+	}
+
+	agentID := r.PathValue("agentId")
+	if !isValidUUID(agentID) {
+		writeError(w, http.StatusNotFound, "agent not found")
+		return
+	}
+	agent, err := s.db.GetAgentByID(r.Context(), agentID)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "agent not found")
+		return
+	}
+	if agent.CreatedBy != claims.UserID && claims.Role != "admin" {
+		writeError(w, http.StatusForbidden, "only the agent's creator or an admin can rotate its token")
+		return
+	}
+
+	tokenID, rawToken, tokenHash, err := s.auth.GenerateServiceAccountToken()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to generate agent token")
+		return
+	}
+	agent, err = s.db.RotateAgentToken(r.Context(), agentID, tokenID, tokenHash)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to rotate agent token")
+		return
+	}
+
+	s.audit.Log(r.Context(), audit.Event{
+		ActorType: "user",
+		ActorID:   claims.UserID,
+		Action:    "agent.rotate_token",
+		Resource:  "agent:" + agent.ID,
+		Outcome:   "success",
+		IP:        getClientIP(r.Context()),
+	})
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"agent": agent,
+		"token": "agent." + rawToken,
+	})
+}
+
+// handleSetAgentRole sets the role an agent presents to policies. Leads of
+// the agent's team and admins may.
+// PUT /api/v1/agents/{agentId}/role
+func (s *Server) handleSetAgentRole(w http.ResponseWriter, r *http.Request) {
+	claims := getUserClaims(r.Context())
+	if claims == nil {
+		writeError(w, http.StatusUnauthorized, "user authentication required")
+		return
+	}
+
+	agentID := r.PathValue("agentId")
+	if !isValidUUID(agentID) {
+		writeError(w, http.StatusNotFound, "agent not found")
+		return
+	}
+	agent, err := s.db.GetAgentByID(r.Context(), agentID)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "agent not found")
+		return
+	}
+	if !s.canManageAgents(r.Context(), agent.TeamID) {
+		writeError(w, http.StatusForbidden, "only a lead of the agent's team or an admin can set its role")
+		return
+	}
+
+	var req setAgentRoleRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if req.Role != "" && !agentRoleRegex.MatchString(req.Role) {
+		writeError(w, http.StatusBadRequest, "role must be lowercase letters, digits, '-' or '_'")
+		return
+	}
+
+	agent, err = s.db.SetAgentRole(r.Context(), agentID, req.Role)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to set agent role")
+		return
+	}
+
+	metadata, _ := json.Marshal(map[string]string{"role": req.Role})
+	s.audit.Log(r.Context(), audit.Event{
+		ActorType: "user",
+		ActorID:   claims.UserID,
+		Action:    "agent.set_role",
+		Resource:  "agent:" + agent.ID,
+		Outcome:   "success",
+		IP:        getClientIP(r.Context()),
+		Metadata:  metadata,
+	})
+
+	writeJSON(w, http.StatusOK, agent)
+}
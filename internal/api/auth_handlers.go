@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/teamvault/teamvault/internal/audit"
 )
@@ -21,9 +22,12 @@ type loginRequest struct {
 	Password string `json:"password"`
 }
 
-// tokenResponse represents a token response.
+// tokenResponse represents a token response: a short-lived access token and
+// the refresh token that renews it.
 type tokenResponse struct {
-	Token string `json:"token"`
+	Token        string    `json:"token"`
+	RefreshToken string    `json:"refresh_token"`
+	ExpiresAt    time.Time `json:"expires_at"` // of the access token
 }
 
 func (s *Server) handleRegister(w http.ResponseWriter, r *http.Request) {
@@ -72,15 +76,17 @@ func (s *Server) handleRegister(w http.ResponseWriter, r *http.Request) {
 		IP:        clientIP(r),
 	})
 
-	token, err := s.auth.GenerateJWT(user.ID, user.Email, user.Role)
+	tokens, err := s.startSession(r, user, []string{"pwd"}, false)
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, "failed to generate token")
 		return
 	}
 
 	writeJSON(w, http.StatusCreated, map[string]interface{}{
-		"user":  user,
-		"token": token,
+		"user":          user,
+		"token":         tokens.Token,
+		"refresh_token": tokens.RefreshToken,
+		"expires_at":    tokens.ExpiresAt,
 	})
 }
 
@@ -118,7 +124,19 @@ func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, err := s.auth.GenerateJWT(user.ID, user.Email, user.Role)
+	// With MFA enabled the password is only the first step: the client
+	// completes the login at /auth/login/mfa with the challenge token
+	challenge, err := s.mfaChallenge(r.Context(), user, "pwd")
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to start login")
+		return
+	}
+	if challenge != nil {
+		writeJSON(w, http.StatusOK, challenge)
+		return
+	}
+
+	tokens, err := s.startSession(r, user, []string{"pwd"}, false)
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, "failed to generate token")
 		return
@@ -135,8 +153,10 @@ func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
 	})
 
 	writeJSON(w, http.StatusOK, map[string]interface{}{
-		"user":  user,
-		"token": token,
+		"user":          user,
+		"token":         tokens.Token,
+		"refresh_token": tokens.RefreshToken,
+		"expires_at":    tokens.ExpiresAt,
 	})
 }
 
@@ -0,0 +1,289 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/teamvault/teamvault/internal/audit"
+	"github.com/teamvault/teamvault/internal/db"
+	"github.com/teamvault/teamvault/internal/policy"
+	"github.com/teamvault/teamvault/internal/webhooks"
+)
+
+// breakGlassWindow is how long a break-glass use grants read access. It is
+// fixed so nobody is tempted to ask for more than the incident needs.
+const breakGlassWindow = 30 * time.Minute
+
+// minBreakGlassJustification is the shortest justification accepted, so a
+// reviewer has more to go on than "urgent".
+const minBreakGlassJustification = 20
+
+// breakGlassRequest is the body of a break-glass use.
+type breakGlassRequest struct {
+	Resource      string `json:"resource"` // "project/path" of one secret
+	Justification string `json:"justification"`
+}
+
+// setBreakGlassRulesRequest is the body of a break-glass rules update.
+type setBreakGlassRulesRequest struct {
+	Rules []db.BreakGlassRule `json:"rules"`
+}
+
+// handleSetBreakGlassRules replaces the rules of an organization saying
+// which teams may break glass on which secrets. The org's creator and admins
+// may set them; without rules nobody can break glass in the org.
+// PUT /api/v1/orgs/{id}/break-glass
+func (s *Server) handleSetBreakGlassRules(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	org, err := s.db.GetOrgByID(ctx, r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusNotFound, "organization not found")
+		return
+	}
+	if getActorID(ctx) != org.CreatedBy && !isAdmin(ctx) {
+		writeError(w, http.StatusForbidden, "only the organization's creator or an admin can set break-glass rules")
+		return
+	}
+
+	var req setBreakGlassRulesRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	for _, rule := range req.Rules {
+		if rule.Path == "" || !strings.Contains(rule.Path, "/") {
+			writeError(w, http.StatusBadRequest, "every break-glass rule needs a path of the form project/path")
+			return
+		}
+		if !isValidUUID(rule.TeamID) {
+			writeError(w, http.StatusBadRequest, "break-glass rule "+rule.Path+": team_id must be a team ID")
+			return
+		}
+		team, err := s.db.GetTeamByID(ctx, rule.TeamID)
+		if err != nil || team.OrgID != org.ID {
+			writeError(w, http.StatusBadRequest, "break-glass rule "+rule.Path+": team not found in the organization")
+			return
+		}
+	}
+
+	if err := s.db.SetOrgBreakGlassRules(ctx, org.ID, req.Rules); err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to set break-glass rules")
+		return
+	}
+
+	metadata, _ := json.Marshal(map[string]interface{}{"rules": req.Rules})
+	s.audit.Log(ctx, audit.Event{
+		ActorType: getActorType(ctx),
+		ActorID:   getActorID(ctx),
+		Action:    "org.break_glass.update",
+		Resource:  "org:" + org.ID,
+		Outcome:   "success",
+		IP:        getClientIP(ctx),
+		Metadata:  metadata,
+	})
+
+	org.BreakGlassRules = req.Rules
+	if org.BreakGlassRules == nil {
+		org.BreakGlassRules = []db.BreakGlassRule{}
+	}
+	writeJSON(w, http.StatusOK, org)
+}
+
+// handleBreakGlass gives the caller read access to one secret for
+// breakGlassWindow, without anyone's approval, if a break-glass rule of the
+// project's organization covers the secret and one of the caller's teams.
+// The use is audited and announced at high severity right away, and leaves a
+// review item for an admin to acknowledge.
+// POST /api/v1/break-glass
+func (s *Server) handleBreakGlass(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claims := getUserClaims(ctx)
+	if claims == nil {
+		writeError(w, http.StatusForbidden, "only users can break glass")
+		return
+	}
+
+	var req breakGlassRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	resource := strings.TrimPrefix(req.Resource, "/")
+	justification := strings.TrimSpace(req.Justification)
+	projectName, path, _ := strings.Cut(resource, "/")
+	if projectName == "" || path == "" || strings.ContainsAny(resource, "*?[#") {
+		writeError(w, http.StatusBadRequest, "resource must be the project/path of one secret")
+		return
+	}
+	if len(justification) < minBreakGlassJustification {
+		writeError(w, http.StatusBadRequest, "justification must be at least "+itoa(minBreakGlassJustification)+" characters")
+		return
+	}
+
+	project, err := s.db.GetProjectByName(ctx, projectName)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "project not found")
+		return
+	}
+
+	// deny audits and announces a refused attempt as loudly as a use
+	deny := func(orgID, reason string) {
+		metadata, _ := json.Marshal(map[string]string{
+			"severity":      "high",
+			"reason":        reason,
+			"justification": justification,
+		})
+		s.audit.Log(ctx, audit.Event{
+			ActorType: "user",
+			ActorID:   claims.UserID,
+			Action:    "access.break_glass",
+			Resource:  resource,
+			Outcome:   "denied",
+			IP:        getClientIP(ctx),
+			Metadata:  metadata,
+		})
+		if orgID != "" && s.webhookManager != nil {
+			s.webhookManager.Fire(ctx, orgID, webhooks.EventBreakGlassDenied, map[string]string{
+				"user_id":       claims.UserID,
+				"resource":      resource,
+				"justification": justification,
+				"reason":        reason,
+			})
+		}
+		writeError(w, http.StatusForbidden, reason)
+	}
+	if project.OrgID == "" {
+		deny("", "break glass is not enabled for this project")
+		return
+	}
+	org, err := s.db.GetOrgByID(ctx, project.OrgID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to load organization")
+		return
+	}
+
+	teamID := ""
+	for _, rule := range org.BreakGlassRules {
+		if !policy.MatchResource(rule.Path, resource) {
+			continue
+		}
+		if _, err := s.db.GetTeamMember(ctx, rule.TeamID, claims.UserID); err == nil {
+			teamID = rule.TeamID
+			break
+		}
+	}
+	if teamID == "" {
+		deny(org.ID, "no break-glass rule of the organization covers this secret for your teams")
+		return
+	}
+
+	grant, review, err := s.db.BreakGlass(ctx, claims.UserID, org.ID, teamID, resource, justification, time.Now().Add(breakGlassWindow))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to break glass")
+		return
+	}
+
+	metadata, _ := json.Marshal(map[string]interface{}{
+		"severity":      "high",
+		"grant":         grant.ID,
+		"review":        review.ID,
+		"team":          teamID,
+		"justification": justification,
+		"expires_at":    grant.ExpiresAt,
+	})
+	s.audit.Log(ctx, audit.Event{
+		ActorType: "user",
+		ActorID:   claims.UserID,
+		Action:    "access.break_glass",
+		Resource:  resource,
+		Outcome:   "success",
+		IP:        getClientIP(ctx),
+		Metadata:  metadata,
+	})
+	if s.webhookManager != nil {
+		s.webhookManager.Fire(ctx, org.ID, webhooks.EventBreakGlassUsed, review)
+	}
+
+	writeJSON(w, http.StatusCreated, map[string]interface{}{
+		"grant":  grant,
+		"review": review,
+	})
+}
+
+// handleListBreakGlassReviews lists break-glass uses, newest first: by
+// default those no admin has acknowledged yet, with ?all=true all of them.
+// GET /api/v1/break-glass
+func (s *Server) handleListBreakGlassReviews(w http.ResponseWriter, r *http.Request) {
+	reviews, err := s.db.ListBreakGlassReviews(r.Context(), r.URL.Query().Get("all") != "true")
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to list break-glass reviews")
+		return
+	}
+	if reviews == nil {
+		reviews = []db.BreakGlassReview{}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"break_glass": reviews})
+}
+
+// handleAcknowledgeBreakGlass records that an admin reviewed a break-glass
+// use. Admins cannot acknowledge their own.
+// POST /api/v1/break-glass/{id}/acknowledge
+func (s *Server) handleAcknowledgeBreakGlass(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claims := getUserClaims(ctx)
+	id := r.PathValue("id")
+	if !isValidUUID(id) {
+		writeError(w, http.StatusNotFound, "break-glass review not found")
+		return
+	}
+	review, err := s.db.GetBreakGlassReview(ctx, id)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "break-glass review not found")
+		return
+	}
+	if review.UserID == claims.UserID {
+		writeError(w, http.StatusForbidden, "you cannot acknowledge your own break-glass use")
+		return
+	}
+
+	var req reviewRequest
+	if err := decodeJSON(r, &req); err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	acknowledged, err := s.db.AcknowledgeBreakGlassReview(ctx, id, claims.UserID, req.Comment)
+	if err != nil {
+		if strings.Contains(err.Error(), "already acknowledged") {
+			writeError(w, http.StatusConflict, "break-glass use already acknowledged")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "failed to acknowledge break-glass use")
+		return
+	}
+
+	metadata, _ := json.Marshal(map[string]string{
+		"review":  acknowledged.ID,
+		"grant":   acknowledged.GrantID,
+		"user":    acknowledged.UserID,
+		"comment": acknowledged.Comment,
+	})
+	s.audit.Log(ctx, audit.Event{
+		ActorType: "user",
+		ActorID:   claims.UserID,
+		Action:    "access.break_glass.acknowledge",
+		Resource:  acknowledged.Resource,
+		Outcome:   "success",
+		IP:        getClientIP(ctx),
+		Metadata:  metadata,
+	})
+	if s.webhookManager != nil {
+		s.webhookManager.Fire(ctx, acknowledged.OrgID, webhooks.EventBreakGlassAcknowledged, acknowledged)
+	}
+
+	writeJSON(w, http.StatusOK, acknowledged)
+}
@@ -0,0 +1,620 @@
+package api
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/teamvault/teamvault/internal/audit"
+	"github.com/teamvault/teamvault/internal/crypto"
+	"github.com/teamvault/teamvault/internal/db"
+	"github.com/teamvault/teamvault/internal/e2e"
+	"github.com/teamvault/teamvault/internal/policy"
+	"github.com/teamvault/teamvault/internal/webhooks"
+)
+
+// changeRequestTTL is how long a change request waits for approval before
+// it expires.
+const changeRequestTTL = 7 * 24 * time.Hour
+
+// changeRequestPurpose binds the encryption of a proposed value to the
+// change request holding it.
+const changeRequestPurpose = "change-request"
+
+// reviewRequest is the body of an approval or rejection.
+type reviewRequest struct {
+	Comment string `json:"comment,omitempty"`
+}
+
+// changeRequestResponse is a change request, with the proposed value when
+// asked for.
+type changeRequestResponse struct {
+	*db.ChangeRequest
+	Value      string `json:"value,omitempty"`
+	Encryption string `json:"encryption,omitempty"` // "e2e": value is a base64 client-encrypted blob
+}
+
+// validateApprovalRules checks the approval rules of a project settings
+// update: every rule needs a path, at least one approval and a team of the
+// project's organization, if it has one. It returns an error message or "".
+func (s *Server) validateApprovalRules(ctx context.Context, orgID string, rules []db.ApprovalRule) string {
+	for _, rule := range rules {
+		switch {
+		case rule.Path == "":
+			return "every approval rule needs a path"
+		case rule.Approvals < 1:
+			return "approval rule " + rule.Path + ": approvals must be at least 1"
+		case !isValidUUID(rule.TeamID):
+			return "approval rule " + rule.Path + ": team_id must be a team ID"
+		}
+		team, err := s.db.GetTeamByID(ctx, rule.TeamID)
+		if err != nil {
+			return "approval rule " + rule.Path + ": team not found"
+		}
+		if orgID != "" && team.OrgID != orgID {
+			return "approval rule " + rule.Path + ": team must belong to the project's organization"
+		}
+	}
+	return ""
+}
+
+// approvalRule returns the first approval rule of a project covering path,
+// or nil if writes to it need no approval. The project owner is never held
+// to the rules; admins are.
+func (s *Server) approvalRule(ctx context.Context, project *db.Project, path string) *db.ApprovalRule {
+	if getActorType(ctx) == "user" && getActorID(ctx) == project.CreatedBy {
+		return nil
+	}
+	for i, rule := range project.ApprovalRules {
+		if policy.MatchResource(rule.Path, path) {
+			return &project.ApprovalRules[i]
+		}
+	}
+	return nil
+}
+
+// protectedPathReason refuses changes to a path protected by an approval
+// rule through anything but a PUT, which opens a change request. It audits
+// the refusal under auditAction and returns the reason, or "" if the change
+// may go ahead.
+func (s *Server) protectedPathReason(ctx context.Context, project *db.Project, path, auditAction string) string {
+	rule := s.approvalRule(ctx, project, path)
+	if rule == nil {
+		return ""
+	}
+	reason := "secrets under " + rule.Path + " need approval to change: write them with PUT to open a change request"
+	metadata, _ := json.Marshal(map[string]string{"reason": reason})
+	s.audit.Log(ctx, audit.Event{
+		ActorType: getActorType(ctx),
+		ActorID:   getActorID(ctx),
+		Action:    auditAction,
+		Resource:  project.Name + "/" + path,
+		Outcome:   "denied",
+		IP:        getClientIP(ctx),
+		Metadata:  metadata,
+	})
+	return reason
+}
+
+// fireChangeRequest notifies the watchers of a change request through their
+// webhooks. Failures are only logged.
+func (s *Server) fireChangeRequest(ctx context.Context, event string, cr *db.ChangeRequest) {
+	if s.webhookManager == nil {
+		return
+	}
+	watchers, err := s.db.ChangeRequestWatchers(ctx, cr)
+	if err != nil {
+		log.Printf("Change request %s: notifying watchers: %v", cr.ID, err)
+		return
+	}
+	for _, id := range watchers {
+		s.webhookManager.Fire(ctx, id, event, cr)
+	}
+}
+
+// requestChange stores a write to a path protected by rule as a change
+// request instead of applying it, and responds 202 with the request. The
+// change is based on the version cas names, or the latest one, and is only
+// applied if the secret is still at that version once approved.
+func (s *Server) requestChange(w http.ResponseWriter, r *http.Request, project *db.Project, path string, rule *db.ApprovalRule, req putSecretRequest, secretType string, metadata json.RawMessage, blob []byte, cas *int) {
+	ctx := r.Context()
+	actorType := getActorType(ctx)
+	actorID := getActorID(ctx)
+
+	base := 0
+	if secret, err := s.db.GetSecret(ctx, project.ID, path); err == nil {
+		next, err := s.db.GetNextSecretVersion(ctx, secret.ID)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "failed to determine version")
+			return
+		}
+		base = next - 1
+	}
+	if cas != nil && *cas != base {
+		if base == 0 {
+			writeError(w, http.StatusConflict, "version mismatch: secret does not exist")
+		} else {
+			writeError(w, http.StatusConflict, "version mismatch: latest version is "+itoa(base))
+		}
+		return
+	}
+
+	cr, err := s.db.CreateChangeRequest(ctx, &db.ChangeRequest{
+		ProjectID:         project.ID,
+		Path:              path,
+		Description:       req.Description,
+		SecretType:        secretType,
+		Metadata:          metadata,
+		Labels:            req.Labels,
+		BaseVersion:       base,
+		TeamID:            rule.TeamID,
+		RequiredApprovals: rule.Approvals,
+		Comment:           req.Comment,
+		RequestedByType:   actorType,
+		RequestedBy:       actorID,
+		ExpiresAt:         time.Now().Add(changeRequestTTL),
+	}, func(id string) (*db.SecretVersion, error) {
+		encrypted := e2eEncryptedData(blob)
+		if blob == nil {
+			var err error
+			encrypted, err = s.encryptForProject(ctx, project.ID, []byte(req.Value), &crypto.EncryptionContext{
+				ProjectID: project.ID,
+				SecretID:  id,
+				Purpose:   changeRequestPurpose,
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+		return &db.SecretVersion{
+			Ciphertext:       encrypted.Ciphertext,
+			Nonce:            encrypted.Nonce,
+			EncryptedDEK:     encrypted.EncryptedDEK,
+			DEKNonce:         encrypted.DEKNonce,
+			MasterKeyVersion: encrypted.MasterKeyVersion,
+			KEKVersion:       encrypted.KEKVersion,
+			FormatVersion:    encrypted.Format,
+		}, nil
+	})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to create change request")
+		return
+	}
+
+	meta, _ := json.Marshal(map[string]interface{}{
+		"change_request": cr.ID,
+		"base_version":   cr.BaseVersion,
+		"rule":           rule.Path,
+		"approvals":      rule.Approvals,
+	})
+	s.audit.Log(ctx, audit.Event{
+		ActorType: actorType,
+		ActorID:   actorID,
+		Action:    "secret.change.request",
+		Resource:  project.Name + "/" + path,
+		Outcome:   "success",
+		IP:        getClientIP(ctx),
+		Metadata:  meta,
+	})
+	s.fireChangeRequest(ctx, webhooks.EventChangeRequestCreated, cr)
+
+	writeJSON(w, http.StatusAccepted, map[string]interface{}{"change_request": cr})
+}
+
+// changeRequestValue decrypts the value a change request proposes. For
+// end-to-end encrypted projects it returns the client-encrypted blob.
+func (s *Server) changeRequestValue(ctx context.Context, cr *db.ChangeRequest) (plaintext, blob []byte, err error) {
+	if cr.Ciphertext == nil {
+		return nil, nil, errors.New("change request value has been wiped")
+	}
+	if cr.FormatVersion == crypto.FormatE2E {
+		return nil, cr.Ciphertext, nil
+	}
+	plaintext, err = s.decryptForProject(ctx, cr.ProjectID, &crypto.EncryptedData{
+		Ciphertext:       cr.Ciphertext,
+		Nonce:            cr.Nonce,
+		EncryptedDEK:     cr.EncryptedDEK,
+		DEKNonce:         cr.DEKNonce,
+		MasterKeyVersion: cr.MasterKeyVersion,
+		KEKVersion:       cr.KEKVersion,
+		Format:           cr.FormatVersion,
+	}, &crypto.EncryptionContext{
+		ProjectID: cr.ProjectID,
+		SecretID:  cr.ID,
+		Purpose:   changeRequestPurpose,
+	})
+	return plaintext, nil, err
+}
+
+// applyChangeRequest writes an approved change request as the next version
+// of its secret, on behalf of the requester, and records the outcome. It
+// returns the request as it ends up.
+func (s *Server) applyChangeRequest(ctx context.Context, project *db.Project, cr *db.ChangeRequest) *db.ChangeRequest {
+	resource := project.Name + "/" + cr.Path
+	approvedBy := []string{}
+	for _, review := range cr.Reviews {
+		if review.Decision == "approve" {
+			approvedBy = append(approvedBy, review.UserID)
+		}
+	}
+
+	fail := func(reason string) *db.ChangeRequest {
+		if err := s.db.FinishChangeRequest(ctx, cr.ID, db.ChangeFailed, nil, reason); err != nil {
+			log.Printf("Change request %s: recording failure: %v", cr.ID, err)
+		}
+		metadata, _ := json.Marshal(map[string]interface{}{
+			"change_request": cr.ID,
+			"approved_by":    approvedBy,
+			"reason":         reason,
+		})
+		s.audit.Log(ctx, audit.Event{
+			ActorType: cr.RequestedByType,
+			ActorID:   cr.RequestedBy,
+			Action:    "secret.write",
+			Resource:  resource,
+			Outcome:   "error",
+			Metadata:  metadata,
+		})
+		cr.Status = db.ChangeFailed
+		cr.Error = reason
+		s.fireChangeRequest(ctx, webhooks.EventChangeRequestFailed, cr)
+		return cr
+	}
+
+	plaintext, blob, err := s.changeRequestValue(ctx, cr)
+	if err != nil {
+		return fail("failed to decrypt the proposed value")
+	}
+	if blob != nil {
+		if !project.IsE2E() {
+			return fail("the project is no longer end-to-end encrypted")
+		}
+		if version, err := e2e.KeyVersion(blob); err != nil || version != project.E2EKeyVersion {
+			return fail("the project key was rotated since the change was requested")
+		}
+	} else if project.IsE2E() {
+		return fail("the project became end-to-end encrypted since the change was requested")
+	}
+
+	// Like any write, in one transaction with the base version as CAS
+	written, err := s.db.WriteSecretVersions(ctx, project.ID, cr.RequestedBy, []db.SecretWrite{{
+		Path:        cr.Path,
+		Description: cr.Description,
+		SecretType:  cr.SecretType,
+		Metadata:    cr.Metadata,
+		Labels:      cr.Labels,
+		CAS:         &cr.BaseVersion,
+		Encrypt:     s.versionEncrypter(ctx, project, plaintext, blob),
+	}})
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), "is deleted"):
+			return fail("the secret was deleted since the change was requested")
+		case strings.Contains(err.Error(), "version mismatch"):
+			return fail(err.Error())
+		case isDBConflictError(err):
+			return fail("version mismatch: secret was written concurrently")
+		default:
+			return fail("failed to store secret version")
+		}
+	}
+	secret, sv := written[0].Secret, written[0].Version
+
+	if err := s.db.FinishChangeRequest(ctx, cr.ID, db.ChangeApplied, &sv.Version, ""); err != nil {
+		log.Printf("Change request %s: recording outcome: %v", cr.ID, err)
+	}
+	metadata, _ := json.Marshal(map[string]interface{}{
+		"version":        sv.Version,
+		"type":           cr.SecretType,
+		"change_request": cr.ID,
+		"approved_by":    approvedBy,
+	})
+	s.audit.Log(ctx, audit.Event{
+		ActorType: cr.RequestedByType,
+		ActorID:   cr.RequestedBy,
+		Action:    "secret.write",
+		Resource:  resource,
+		Outcome:   "success",
+		Metadata:  metadata,
+	})
+
+	s.pruneSecretVersions(ctx, project, secret)
+
+	cr.Status = db.ChangeApplied
+	cr.AppliedVersion = &sv.Version
+	s.fireChangeRequest(ctx, webhooks.EventChangeRequestApplied, cr)
+	return cr
+}
+
+// isApprover reports whether the caller is a member of a change request's
+// approver team.
+func (s *Server) isApprover(ctx context.Context, cr *db.ChangeRequest) bool {
+	claims := getUserClaims(ctx)
+	if claims == nil {
+		return false
+	}
+	_, err := s.db.GetTeamMember(ctx, cr.TeamID, claims.UserID)
+	return err == nil
+}
+
+// canSeeChangeRequest reports whether the caller may see a change request:
+// its requester, its approvers, the project owner and admins may.
+func (s *Server) canSeeChangeRequest(ctx context.Context, project *db.Project, cr *db.ChangeRequest) bool {
+	actorID := getActorID(ctx)
+	return isAdmin(ctx) || actorID == project.CreatedBy || actorID == cr.RequestedBy || s.isApprover(ctx, cr)
+}
+
+// changeRequestFor loads the change request named in the URL with its
+// project, writing a 404 if it does not exist or the caller may not see it.
+func (s *Server) changeRequestFor(w http.ResponseWriter, r *http.Request) (*db.ChangeRequest, *db.Project, bool) {
+	ctx := r.Context()
+	id := r.PathValue("id")
+	if !isValidUUID(id) {
+		writeError(w, http.StatusNotFound, "change request not found")
+		return nil, nil, false
+	}
+	cr, err := s.db.GetChangeRequest(ctx, id)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "change request not found")
+		return nil, nil, false
+	}
+	project, err := s.db.GetProjectByID(ctx, cr.ProjectID)
+	if err != nil || !s.canSeeChangeRequest(ctx, project, cr) {
+		writeError(w, http.StatusNotFound, "change request not found")
+		return nil, nil, false
+	}
+	return cr, project, true
+}
+
+// handleListChangeRequests lists the change requests of a project the
+// caller may see, newest first, optionally filtered by status.
+// GET /api/v1/projects/{project}/change-requests?status=pending
+func (s *Server) handleListChangeRequests(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	project, err := s.db.GetProjectByName(ctx, r.PathValue("project"))
+	if err != nil {
+		writeError(w, http.StatusNotFound, "project not found")
+		return
+	}
+
+	requests, err := s.db.ListChangeRequests(ctx, project.ID, r.URL.Query().Get("status"))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to list change requests")
+		return
+	}
+
+	actorID := getActorID(ctx)
+	visible := make([]db.ChangeRequest, 0, len(requests))
+	if isAdmin(ctx) || actorID == project.CreatedBy {
+		visible = append(visible, requests...)
+	} else {
+		teams := map[string]bool{}
+		if claims := getUserClaims(ctx); claims != nil {
+			memberships, err := s.db.GetUserTeams(ctx, claims.UserID)
+			if err != nil {
+				writeError(w, http.StatusInternalServerError, "failed to load teams")
+				return
+			}
+			for _, m := range memberships {
+				teams[m.TeamID] = true
+			}
+		}
+		for _, cr := range requests {
+			if cr.RequestedBy == actorID || teams[cr.TeamID] {
+				visible = append(visible, cr)
+			}
+		}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"change_requests": visible})
+}
+
+// handleGetChangeRequest returns a change request with its reviews. With
+// ?value=true, a pending request's proposed value is included for callers
+// who may also read the secret, so approvers can check what they approve.
+// GET /api/v1/change-requests/{id}
+func (s *Server) handleGetChangeRequest(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	cr, project, ok := s.changeRequestFor(w, r)
+	if !ok {
+		return
+	}
+	resp := changeRequestResponse{ChangeRequest: cr}
+	if r.URL.Query().Get("value") != "true" {
+		writeJSON(w, http.StatusOK, resp)
+		return
+	}
+
+	resource := project.Name + "/" + cr.Path
+	if cr.Status != db.ChangePending {
+		writeError(w, http.StatusGone, "change request is "+cr.Status+"; its value has been wiped")
+		return
+	}
+	policyResult, err := s.policy.Evaluate(ctx, s.projectPolicyRequest(ctx, "read", project, cr.Path, nil))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "policy evaluation failed")
+		return
+	}
+	if !policyResult.Allowed {
+		s.audit.Log(ctx, audit.Event{
+			ActorType: getActorType(ctx),
+			ActorID:   getActorID(ctx),
+			Action:    "secret.change.read",
+			Resource:  resource,
+			Outcome:   "denied",
+			IP:        getClientIP(ctx),
+			Metadata:  json.RawMessage(`{"reason":"` + policyResult.Reason + `"}`),
+		})
+		writeError(w, http.StatusForbidden, policyResult.Reason)
+		return
+	}
+
+	plaintext, blob, err := s.changeRequestValue(ctx, cr)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "decryption failed")
+		return
+	}
+	if blob != nil {
+		resp.Value = base64.StdEncoding.EncodeToString(blob)
+		resp.Encryption = db.EncryptionModeE2E
+	} else {
+		resp.Value = string(plaintext)
+	}
+
+	s.audit.Log(ctx, audit.Event{
+		ActorType: getActorType(ctx),
+		ActorID:   getActorID(ctx),
+		Action:    "secret.change.read",
+		Resource:  resource,
+		Outcome:   "success",
+		IP:        getClientIP(ctx),
+		Metadata:  json.RawMessage(`{"change_request":"` + cr.ID + `"}`),
+	})
+
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// handleApproveChangeRequest approves a change request. The approval that
+// reaches the required number applies the change.
+// POST /api/v1/change-requests/{id}/approve
+func (s *Server) handleApproveChangeRequest(w http.ResponseWriter, r *http.Request) {
+	s.reviewChangeRequest(w, r, "approve")
+}
+
+// handleRejectChangeRequest rejects a change request; a single rejection
+// closes it.
+// POST /api/v1/change-requests/{id}/reject
+func (s *Server) handleRejectChangeRequest(w http.ResponseWriter, r *http.Request) {
+	s.reviewChangeRequest(w, r, "reject")
+}
+
+// reviewChangeRequest records a review by a member of the approver team
+// other than the requester.
+func (s *Server) reviewChangeRequest(w http.ResponseWriter, r *http.Request, decision string) {
+	ctx := r.Context()
+	claims := getUserClaims(ctx)
+	if claims == nil {
+		writeError(w, http.StatusForbidden, "only users can review change requests")
+		return
+	}
+
+	cr, project, ok := s.changeRequestFor(w, r)
+	if !ok {
+		return
+	}
+	resource := project.Name + "/" + cr.Path
+	deny := func(reason string) {
+		metadata, _ := json.Marshal(map[string]string{"change_request": cr.ID, "reason": reason})
+		s.audit.Log(ctx, audit.Event{
+			ActorType: "user",
+			ActorID:   claims.UserID,
+			Action:    "secret.change." + decision,
+			Resource:  resource,
+			Outcome:   "denied",
+			IP:        getClientIP(ctx),
+			Metadata:  metadata,
+		})
+		writeError(w, http.StatusForbidden, reason)
+	}
+	if cr.RequestedBy == claims.UserID {
+		deny("you cannot review your own change request")
+		return
+	}
+	if !s.isApprover(ctx, cr) {
+		deny("only members of the approver team can review this change request")
+		return
+	}
+
+	var req reviewRequest
+	if err := decodeJSON(r, &req); err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	reviewed, err := s.db.ReviewChangeRequest(ctx, cr.ID, claims.UserID, decision, req.Comment)
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), "expired"):
+			s.fireChangeRequest(ctx, webhooks.EventChangeRequestExpired, reviewed)
+			writeError(w, http.StatusConflict, "change request expired")
+		case strings.HasPrefix(err.Error(), "change request is"):
+			writeError(w, http.StatusConflict, err.Error())
+		case isDBConflictError(err):
+			writeError(w, http.StatusConflict, "you have already reviewed this change request")
+		default:
+			writeError(w, http.StatusInternalServerError, "failed to record review")
+		}
+		return
+	}
+
+	metadata, _ := json.Marshal(map[string]interface{}{
+		"change_request": cr.ID,
+		"approvals":      reviewed.Approvals,
+		"required":       reviewed.RequiredApprovals,
+	})
+	s.audit.Log(ctx, audit.Event{
+		ActorType: "user",
+		ActorID:   claims.UserID,
+		Action:    "secret.change." + decision,
+		Resource:  resource,
+		Outcome:   "success",
+		IP:        getClientIP(ctx),
+		Metadata:  metadata,
+	})
+
+	switch reviewed.Status {
+	case db.ChangeRejected:
+		s.fireChangeRequest(ctx, webhooks.EventChangeRequestRejected, reviewed)
+	case db.ChangeApproved:
+		s.fireChangeRequest(ctx, webhooks.EventChangeRequestApproved, reviewed)
+		reviewed = s.applyChangeRequest(ctx, project, reviewed)
+	}
+
+	writeJSON(w, http.StatusOK, changeRequestResponse{ChangeRequest: reviewed})
+}
+
+// handleCancelChangeRequest withdraws a pending change request. The
+// requester, the project owner and admins may cancel it.
+// POST /api/v1/change-requests/{id}/cancel
+func (s *Server) handleCancelChangeRequest(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	cr, project, ok := s.changeRequestFor(w, r)
+	if !ok {
+		return
+	}
+	actorID := getActorID(ctx)
+	if actorID != cr.RequestedBy && actorID != project.CreatedBy && !isAdmin(ctx) {
+		writeError(w, http.StatusForbidden, "only the requester, the project owner or an admin can cancel a change request")
+		return
+	}
+
+	if err := s.db.CancelChangeRequest(ctx, cr.ID); err != nil {
+		if strings.Contains(err.Error(), "no longer pending") {
+			writeError(w, http.StatusConflict, "change request is "+cr.Status)
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "failed to cancel change request")
+		return
+	}
+
+	s.audit.Log(ctx, audit.Event{
+		ActorType: getActorType(ctx),
+		ActorID:   actorID,
+		Action:    "secret.change.cancel",
+		Resource:  project.Name + "/" + cr.Path,
+		Outcome:   "success",
+		IP:        getClientIP(ctx),
+		Metadata:  json.RawMessage(`{"change_request":"` + cr.ID + `"}`),
+	})
+
+	cr.Status = db.ChangeCancelled
+	s.fireChangeRequest(ctx, webhooks.EventChangeRequestCancelled, cr)
+	writeJSON(w, http.StatusOK, changeRequestResponse{ChangeRequest: cr})
+}
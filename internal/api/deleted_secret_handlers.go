@@ -0,0 +1,193 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/teamvault/teamvault/internal/audit"
+)
+
+type destroySecretVersionsRequest struct {
+	Versions []int `json:"versions"`
+}
+
+// authorizeSecretDelete checks the "delete" permission (and, for service
+// accounts, the write scope) needed to undelete or destroy a secret. It writes
+// the error response and returns false if the caller is not allowed.
+func (s *Server) authorizeSecretDelete(w http.ResponseWriter, r *http.Request, action, projectName, secretPath string) bool {
+	ctx := r.Context()
+	actorType := getActorType(ctx)
+	actorID := getActorID(ctx)
+	resource := projectName + "/" + secretPath
+
+	policyReq, err := s.secretPolicyRequest(ctx, "delete", projectName, secretPath, nil)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to load project")
+		return false
+	}
+	policyResult, err := s.policy.Evaluate(ctx, policyReq)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "policy evaluation failed")
+		return false
+	}
+	if !policyResult.Allowed {
+		s.audit.Log(ctx, audit.Event{
+			ActorType: actorType,
+			ActorID:   actorID,
+			Action:    action,
+			Resource:  resource,
+			Outcome:   "denied",
+			IP:        getClientIP(ctx),
+			Metadata:  json.RawMessage(`{"reason":"` + policyResult.Reason + `"}`),
+		})
+		writeError(w, http.StatusForbidden, policyResult.Reason)
+		return false
+	}
+
+	if scopes, kind, ok := tokenScopes(ctx); ok {
+		if !scopeAllows(scopes, "write", resource) {
+			writeError(w, http.StatusForbidden, kind+" lacks write scope")
+			return false
+		}
+	}
+	return true
+}
+
+// handleUndeleteSecret restores a soft-deleted secret with its full version
+// history.
+// POST /api/v1/secrets/{project}/{path...}/undelete
+func (s *Server) handleUndeleteSecret(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	projectName := r.PathValue("project")
+	secretPath := strings.TrimSuffix(r.PathValue("path"), "/undelete")
+
+	if projectName == "" || secretPath == "" {
+		writeError(w, http.StatusBadRequest, "project and path are required")
+		return
+	}
+
+	resource := projectName + "/" + secretPath
+	if !s.authorizeSecretDelete(w, r, "secret.undelete", projectName, secretPath) {
+		return
+	}
+
+	project, err := s.db.GetProjectByName(ctx, projectName)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "project not found")
+		return
+	}
+	if reason := s.protectedPathReason(ctx, project, secretPath, "secret.undelete"); reason != "" {
+		writeError(w, http.StatusForbidden, reason)
+		return
+	}
+
+	secret, err := s.db.UndeleteSecret(ctx, project.ID, secretPath)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			writeError(w, http.StatusNotFound, "deleted secret not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "failed to undelete secret")
+		return
+	}
+
+	s.audit.Log(ctx, audit.Event{
+		ActorType: getActorType(ctx),
+		ActorID:   getActorID(ctx),
+		Action:    "secret.undelete",
+		Resource:  resource,
+		Outcome:   "success",
+		IP:        getClientIP(ctx),
+	})
+
+	writeJSON(w, http.StatusOK, secretResponse{
+		ID:          secret.ID,
+		ProjectID:   project.ID,
+		Project:     project.Name,
+		Path:        secret.Path,
+		Description: secret.Description,
+		SecretType:  secret.SecretType,
+		Metadata:    secret.Metadata,
+		Labels:      secret.Labels,
+		CreatedBy:   secret.CreatedBy,
+		CreatedAt:   secret.CreatedAt.Format("2006-01-02T15:04:05Z"),
+	})
+}
+
+// handleDestroySecretVersions permanently wipes the ciphertext of chosen
+// versions of a secret. Destroyed versions stay in the history but can no
+// longer be read or rolled back to.
+// POST /api/v1/secrets/{project}/{path...}/destroy
+func (s *Server) handleDestroySecretVersions(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	projectName := r.PathValue("project")
+	secretPath := strings.TrimSuffix(r.PathValue("path"), "/destroy")
+
+	if projectName == "" || secretPath == "" {
+		writeError(w, http.StatusBadRequest, "project and path are required")
+		return
+	}
+
+	resource := projectName + "/" + secretPath
+	if !s.authorizeSecretDelete(w, r, "secret.destroy", projectName, secretPath) {
+		return
+	}
+
+	var req destroySecretVersionsRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if len(req.Versions) == 0 {
+		writeError(w, http.StatusBadRequest, "versions is required")
+		return
+	}
+	for _, v := range req.Versions {
+		if v < 1 {
+			writeError(w, http.StatusBadRequest, "versions must be positive integers")
+			return
+		}
+	}
+
+	project, err := s.db.GetProjectByName(ctx, projectName)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "project not found")
+		return
+	}
+	if reason := s.protectedPathReason(ctx, project, secretPath, "secret.destroy"); reason != "" {
+		writeError(w, http.StatusForbidden, reason)
+		return
+	}
+
+	secret, err := s.db.GetSecret(ctx, project.ID, secretPath)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "secret not found")
+		return
+	}
+
+	destroyed, err := s.db.DestroySecretVersions(ctx, secret.ID, req.Versions)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to destroy versions")
+		return
+	}
+
+	metadata, _ := json.Marshal(map[string]interface{}{
+		"versions":  req.Versions,
+		"destroyed": destroyed,
+	})
+	s.audit.Log(ctx, audit.Event{
+		ActorType: getActorType(ctx),
+		ActorID:   getActorID(ctx),
+		Action:    "secret.destroy",
+		Resource:  resource,
+		Outcome:   "success",
+		IP:        getClientIP(ctx),
+		Metadata:  metadata,
+	})
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"status":    "destroyed",
+		"destroyed": destroyed,
+	})
+}
@@ -0,0 +1,379 @@
+package api
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/teamvault/teamvault/internal/audit"
+	"github.com/teamvault/teamvault/internal/crypto"
+	"github.com/teamvault/teamvault/internal/db"
+	"github.com/teamvault/teamvault/internal/e2e"
+)
+
+type setPublicKeyRequest struct {
+	PublicKey []byte `json:"public_key"` // base64 X25519 public key
+}
+
+type publicKeyResponse struct {
+	UserID      string `json:"user_id"`
+	Email       string `json:"email"`
+	PublicKey   []byte `json:"public_key"`
+	Fingerprint string `json:"fingerprint"`
+}
+
+// projectE2EResponse describes a project's encryption mode and, for E2E
+// projects, its members and the project keys sealed to the caller.
+type projectE2EResponse struct {
+	Project        string                `json:"project"`
+	ProjectID      string                `json:"project_id"`
+	EncryptionMode string                `json:"encryption_mode"`
+	KeyVersion     int                   `json:"key_version"`
+	Members        []db.E2EMember        `json:"members,omitempty"`
+	Keys           []db.ProjectMemberKey `json:"keys,omitempty"`
+}
+
+type sealedKey struct {
+	UserID     string `json:"user_id,omitempty"`
+	KeyVersion int    `json:"key_version,omitempty"`
+	SealedKey  []byte `json:"sealed_key"`
+}
+
+type addE2EMemberRequest struct {
+	Email string      `json:"email"`
+	Keys  []sealedKey `json:"keys"` // every key version, sealed to the new member
+}
+
+type rotateE2EKeyRequest struct {
+	KeyVersion int         `json:"key_version"` // must be the current version + 1
+	Members    []sealedKey `json:"members"`     // the new key, sealed to each member
+}
+
+// e2eBlob decodes and checks a value written to an E2E project. Values must
+// be encrypted with the project's current key version, so members removed
+// by a rotation cannot be written for anymore.
+func e2eBlob(project *db.Project, value string) ([]byte, string) {
+	blob, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return nil, "value must be base64 for end-to-end encrypted projects"
+	}
+	version, err := e2e.KeyVersion(blob)
+	if err != nil {
+		return nil, "value is not end-to-end encrypted"
+	}
+	if version != project.E2EKeyVersion {
+		return nil, "value must be encrypted with project key v" + itoa(project.E2EKeyVersion)
+	}
+	return blob, ""
+}
+
+// e2eEncryptedData wraps a client-encrypted blob for storage. There is no
+// server-side DEK.
+func e2eEncryptedData(blob []byte) *crypto.EncryptedData {
+	return &crypto.EncryptedData{
+		Ciphertext:   blob,
+		Nonce:        []byte{},
+		EncryptedDEK: []byte{},
+		DEKNonce:     []byte{},
+		Format:       crypto.FormatE2E,
+	}
+}
+
+// canWriteE2E reports whether the caller holds the current key of an E2E
+// project. Only members can produce values other members can read.
+func (s *Server) canWriteE2E(ctx context.Context, project *db.Project) (bool, error) {
+	claims := getUserClaims(ctx)
+	if claims == nil {
+		return false, nil
+	}
+	return s.db.IsE2EMember(ctx, project.ID, claims.UserID)
+}
+
+// handleSetPublicKey registers the caller's X25519 public key.
+// PUT /api/v1/auth/me/public-key
+func (s *Server) handleSetPublicKey(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claims := getUserClaims(ctx)
+	if claims == nil {
+		writeError(w, http.StatusUnauthorized, "user authentication required")
+		return
+	}
+
+	var req setPublicKeyRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if len(req.PublicKey) != e2e.KeySize {
+		writeError(w, http.StatusBadRequest, "public_key must be a base64 X25519 public key")
+		return
+	}
+
+	if err := s.db.SetUserPublicKey(ctx, claims.UserID, req.PublicKey); err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to store public key")
+		return
+	}
+
+	fingerprint := e2e.Fingerprint(req.PublicKey)
+	s.audit.Log(ctx, audit.Event{
+		ActorType: "user",
+		ActorID:   claims.UserID,
+		Action:    "user.public_key.set",
+		Resource:  "user:" + claims.UserID,
+		Outcome:   "success",
+		IP:        getClientIP(ctx),
+		Metadata:  json.RawMessage(`{"fingerprint":"` + fingerprint + `"}`),
+	})
+
+	writeJSON(w, http.StatusOK, publicKeyResponse{
+		UserID:      claims.UserID,
+		Email:       claims.Email,
+		PublicKey:   req.PublicKey,
+		Fingerprint: fingerprint,
+	})
+}
+
+// handleGetPublicKey looks up a user's public key by email.
+// GET /api/v1/users/public-key?email=
+func (s *Server) handleGetPublicKey(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	email := r.URL.Query().Get("email")
+	if email == "" {
+		writeError(w, http.StatusBadRequest, "email is required")
+		return
+	}
+
+	user, err := s.db.GetUserByEmail(ctx, email)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "user not found")
+		return
+	}
+	publicKey, err := s.db.GetUserPublicKey(ctx, user.ID)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "user has no public key")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, publicKeyResponse{
+		UserID:      user.ID,
+		Email:       user.Email,
+		PublicKey:   publicKey,
+		Fingerprint: e2e.Fingerprint(publicKey),
+	})
+}
+
+// handleGetProjectE2E returns a project's encryption mode. For E2E projects
+// it also returns the key versions sealed to the caller and, for members,
+// the creator and admins, the member list.
+// GET /api/v1/projects/{project}/e2e
+func (s *Server) handleGetProjectE2E(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	project, err := s.db.GetProjectByName(ctx, r.PathValue("project"))
+	if err != nil {
+		writeError(w, http.StatusNotFound, "project not found")
+		return
+	}
+
+	resp := projectE2EResponse{
+		Project:        project.Name,
+		ProjectID:      project.ID,
+		EncryptionMode: project.EncryptionMode,
+		KeyVersion:     project.E2EKeyVersion,
+	}
+	claims := getUserClaims(ctx)
+	if !project.IsE2E() || claims == nil {
+		writeJSON(w, http.StatusOK, resp)
+		return
+	}
+
+	resp.Keys, err = s.db.ListProjectMemberKeys(ctx, project.ID, claims.UserID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to list project keys")
+		return
+	}
+
+	if len(resp.Keys) > 0 || project.CreatedBy == claims.UserID || claims.Role == "admin" {
+		resp.Members, err = s.db.ListE2EMembers(ctx, project.ID)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "failed to list members")
+			return
+		}
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// handleAddE2EMember shares every project key version with a new member.
+// The caller must be a member: only members can open, and therefore seal,
+// the project key.
+// POST /api/v1/projects/{project}/e2e/members
+func (s *Server) handleAddE2EMember(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	project, ok := s.e2eProjectForMember(w, r)
+	if !ok {
+		return
+	}
+
+	var req addE2EMemberRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	user, err := s.db.GetUserByEmail(ctx, req.Email)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "user not found")
+		return
+	}
+	if _, err := s.db.GetUserPublicKey(ctx, user.ID); err != nil {
+		writeError(w, http.StatusBadRequest, "user has no public key")
+		return
+	}
+
+	keys := make([]db.ProjectMemberKey, 0, len(req.Keys))
+	hasCurrent := false
+	for _, k := range req.Keys {
+		if k.KeyVersion < 1 || k.KeyVersion > project.E2EKeyVersion || len(k.SealedKey) == 0 {
+			writeError(w, http.StatusBadRequest, "invalid sealed key for version "+itoa(k.KeyVersion))
+			return
+		}
+		hasCurrent = hasCurrent || k.KeyVersion == project.E2EKeyVersion
+		keys = append(keys, db.ProjectMemberKey{UserID: user.ID, KeyVersion: k.KeyVersion, SealedKey: k.SealedKey})
+	}
+	if !hasCurrent {
+		writeError(w, http.StatusBadRequest, "keys must include the current key version "+itoa(project.E2EKeyVersion))
+		return
+	}
+
+	if err := s.db.AddProjectMemberKeys(ctx, project.ID, getActorID(ctx), keys); err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to add member")
+		return
+	}
+
+	s.audit.Log(ctx, audit.Event{
+		ActorType: getActorType(ctx),
+		ActorID:   getActorID(ctx),
+		Action:    "project.e2e.member_add",
+		Resource:  project.Name,
+		Outcome:   "success",
+		IP:        getClientIP(ctx),
+		Metadata:  json.RawMessage(`{"user_id":"` + user.ID + `","key_versions":` + itoa(len(keys)) + `}`),
+	})
+
+	writeJSON(w, http.StatusOK, map[string]string{"status": "added"})
+}
+
+// handleRotateE2EKey publishes a new project key version sealed to exactly
+// the listed members; anyone left out is removed from the project. The first
+// key (version 1) is published by the project creator or an admin.
+// POST /api/v1/projects/{project}/e2e/rotate
+func (s *Server) handleRotateE2EKey(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claims := getUserClaims(ctx)
+	if claims == nil {
+		writeError(w, http.StatusUnauthorized, "user authentication required")
+		return
+	}
+
+	project, err := s.db.GetProjectByName(ctx, r.PathValue("project"))
+	if err != nil {
+		writeError(w, http.StatusNotFound, "project not found")
+		return
+	}
+	if !project.IsE2E() {
+		writeError(w, http.StatusBadRequest, "project is not end-to-end encrypted")
+		return
+	}
+
+	if project.E2EKeyVersion == 0 {
+		if project.CreatedBy != claims.UserID && claims.Role != "admin" {
+			writeError(w, http.StatusForbidden, "only the project creator can publish the first key")
+			return
+		}
+	} else if member, err := s.db.IsE2EMember(ctx, project.ID, claims.UserID); err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to check membership")
+		return
+	} else if !member {
+		writeError(w, http.StatusForbidden, "not a member of this project")
+		return
+	}
+
+	var req rotateE2EKeyRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if req.KeyVersion != project.E2EKeyVersion+1 {
+		writeError(w, http.StatusConflict, "key_version must be "+itoa(project.E2EKeyVersion+1))
+		return
+	}
+
+	keys := make([]db.ProjectMemberKey, 0, len(req.Members))
+	includesCaller := false
+	seen := map[string]bool{}
+	for _, m := range req.Members {
+		if m.UserID == "" || len(m.SealedKey) == 0 || seen[m.UserID] {
+			writeError(w, http.StatusBadRequest, "each member needs a unique user_id and a sealed_key")
+			return
+		}
+		seen[m.UserID] = true
+		if _, err := s.db.GetUserPublicKey(ctx, m.UserID); err != nil {
+			writeError(w, http.StatusBadRequest, "user "+m.UserID+" has no public key")
+			return
+		}
+		includesCaller = includesCaller || m.UserID == claims.UserID
+		keys = append(keys, db.ProjectMemberKey{UserID: m.UserID, KeyVersion: req.KeyVersion, SealedKey: m.SealedKey})
+	}
+	if !includesCaller {
+		writeError(w, http.StatusBadRequest, "members must include yourself")
+		return
+	}
+
+	if err := s.db.RotateE2EProjectKey(ctx, project.ID, project.E2EKeyVersion, claims.UserID, keys); err != nil {
+		if isDBConflictError(err) || strings.Contains(err.Error(), "rotated concurrently") {
+			writeError(w, http.StatusConflict, "project key was rotated concurrently")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "failed to rotate project key")
+		return
+	}
+
+	s.audit.Log(ctx, audit.Event{
+		ActorType: "user",
+		ActorID:   claims.UserID,
+		Action:    "project.e2e.rotate",
+		Resource:  project.Name,
+		Outcome:   "success",
+		IP:        getClientIP(ctx),
+		Metadata:  json.RawMessage(`{"key_version":` + itoa(req.KeyVersion) + `,"members":` + itoa(len(keys)) + `}`),
+	})
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"key_version": req.KeyVersion, "members": len(keys)})
+}
+
+// e2eProjectForMember resolves the E2E project in the request path and
+// checks that the caller holds its current key.
+func (s *Server) e2eProjectForMember(w http.ResponseWriter, r *http.Request) (*db.Project, bool) {
+	ctx := r.Context()
+	project, err := s.db.GetProjectByName(ctx, r.PathValue("project"))
+	if err != nil {
+		writeError(w, http.StatusNotFound, "project not found")
+		return nil, false
+	}
+	if !project.IsE2E() {
+		writeError(w, http.StatusBadRequest, "project is not end-to-end encrypted")
+		return nil, false
+	}
+
+	member, err := s.canWriteE2E(ctx, project)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to check membership")
+		return nil, false
+	}
+	if !member {
+		writeError(w, http.StatusForbidden, "not a member of this project")
+		return nil, false
+	}
+	return project, true
+}
@@ -0,0 +1,485 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/teamvault/teamvault/internal/audit"
+	"github.com/teamvault/teamvault/internal/crypto"
+	"github.com/teamvault/teamvault/internal/db"
+)
+
+// validateEnvironments checks the environments of a project: named, without
+// '/', '#' or '*', unique, and with every parent listed before its children (so
+// inheritance cannot form a cycle). It returns an error message or "".
+func validateEnvironments(envs []db.Environment) string {
+	seen := make(map[string]bool, len(envs))
+	for _, env := range envs {
+		switch {
+		case env.Name == "":
+			return "every environment needs a name"
+		case strings.ContainsAny(env.Name, "/#*"):
+			return "environment " + env.Name + ": name must not contain '/', '#' or '*'"
+		case seen[env.Name]:
+			return "duplicate environment " + env.Name
+		case env.Parent != "" && !seen[env.Parent]:
+			return "environment " + env.Name + ": parent " + env.Parent + " must be listed before it"
+		}
+		seen[env.Name] = true
+	}
+	return ""
+}
+
+// inheritedSecret returns the secret that a path of a child environment
+// inherits: the one with the same key in the nearest ancestor environment
+// that defines it. It returns nil if the path is not in an environment or no
+// ancestor defines the key.
+func (s *Server) inheritedSecret(ctx context.Context, project *db.Project, path string) *db.Secret {
+	env, key := project.SplitEnvironment(path)
+	if env == "" {
+		return nil
+	}
+	for _, ancestor := range project.EnvironmentAncestors(env) {
+		if secret, err := s.db.GetSecret(ctx, project.ID, ancestor+"/"+key); err == nil {
+			return secret
+		}
+	}
+	return nil
+}
+
+// environmentInfo is an environment of a project as listed by the API.
+type environmentInfo struct {
+	Name      string   `json:"name"`
+	Parent    string   `json:"parent,omitempty"`
+	Inherits  []string `json:"inherits,omitempty"`   // ancestors, nearest first
+	PromoteTo string   `json:"promote_to,omitempty"` // default promotion target
+}
+
+// handleListEnvironments lists the environments of a project in promotion
+// order. Like the project's encryption mode, they are visible to any caller.
+// GET /api/v1/projects/{project}/environments
+func (s *Server) handleListEnvironments(w http.ResponseWriter, r *http.Request) {
+	project, err := s.db.GetProjectByName(r.Context(), r.PathValue("project"))
+	if err != nil {
+		writeError(w, http.StatusNotFound, "project not found")
+		return
+	}
+
+	envs := make([]environmentInfo, 0, len(project.Environments))
+	for _, env := range project.Environments {
+		envs = append(envs, environmentInfo{
+			Name:      env.Name,
+			Parent:    env.Parent,
+			Inherits:  project.EnvironmentAncestors(env.Name),
+			PromoteTo: project.NextEnvironment(env.Name),
+		})
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"project":      project.Name,
+		"environments": envs,
+	})
+}
+
+// environmentSecret is a secret as an environment sees it: its own, or
+// inherited from an ancestor environment.
+type environmentSecret struct {
+	Key           string            `json:"key"`
+	Path          string            `json:"path"` // where the secret is stored
+	Description   string            `json:"description,omitempty"`
+	SecretType    string            `json:"secret_type"`
+	Labels        map[string]string `json:"labels,omitempty"`
+	InheritedFrom string            `json:"inherited_from,omitempty"` // environment the key comes from
+	CreatedAt     string            `json:"created_at"`
+}
+
+// environmentSecrets returns the effective secrets of an environment, sorted
+// by key: its own, and every key it does not define inherited from the
+// nearest ancestor that does.
+func environmentSecrets(project *db.Project, env string, secrets []db.Secret) []environmentSecret {
+	items := make([]environmentSecret, 0)
+	seen := make(map[string]bool)
+	for _, name := range append([]string{env}, project.EnvironmentAncestors(env)...) {
+		for _, sec := range secrets {
+			key, ok := strings.CutPrefix(sec.Path, name+"/")
+			if !ok || key == "" || seen[key] {
+				continue
+			}
+			seen[key] = true
+			item := environmentSecret{
+				Key:         key,
+				Path:        sec.Path,
+				Description: sec.Description,
+				SecretType:  sec.SecretType,
+				Labels:      sec.Labels,
+				CreatedAt:   sec.CreatedAt.Format("2006-01-02T15:04:05Z"),
+			}
+			if name != env {
+				item.InheritedFrom = name
+			}
+			items = append(items, item)
+		}
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].Key < items[j].Key })
+	return items
+}
+
+// handleListEnvironmentSecrets lists the effective secrets of an environment,
+// including the ones it inherits (metadata only, no values). It needs "read"
+// on "project/<env>/*", or permission to list the whole project.
+// GET /api/v1/projects/{project}/environments/{env}/secrets
+func (s *Server) handleListEnvironmentSecrets(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	project, err := s.db.GetProjectByName(ctx, r.PathValue("project"))
+	if err != nil {
+		writeError(w, http.StatusNotFound, "project not found")
+		return
+	}
+	env := r.PathValue("env")
+	if project.Environment(env) == nil {
+		writeError(w, http.StatusNotFound, "environment not found")
+		return
+	}
+
+	policyResult, err := s.policy.Evaluate(ctx, s.projectPolicyRequest(ctx, "read", project, env+"/*", map[string]string{}))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "policy evaluation failed")
+		return
+	}
+	if !policyResult.Allowed {
+		allowed, err := s.canListProject(ctx, project)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "policy evaluation failed")
+			return
+		}
+		if !allowed {
+			writeError(w, http.StatusForbidden, "access denied")
+			return
+		}
+	}
+
+	secrets, err := s.db.ListSecrets(ctx, project.ID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to list secrets")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"project":     project.Name,
+		"environment": env,
+		"parent":      project.Environment(env).Parent,
+		"secrets":     environmentSecrets(project, env, secrets),
+	})
+}
+
+type promoteRequest struct {
+	From string `json:"from"`
+	// Defaults to the next environment after From
+	To string `json:"to,omitempty"`
+	// Keys to promote; defaults to every key of From, inherited ones included
+	Keys   []string `json:"keys,omitempty"`
+	DryRun bool     `json:"dry_run,omitempty"` // only report what would change
+}
+
+// promoteResult is the outcome of promoting one key. Change is "create",
+// "update" or "unchanged"; values are never returned.
+type promoteResult struct {
+	Key         string `json:"key"`
+	Status      int    `json:"status"`
+	Error       string `json:"error,omitempty"`
+	Change      string `json:"change,omitempty"`
+	FromPath    string `json:"from_path,omitempty"` // where the promoted value is stored
+	FromVersion int    `json:"from_version,omitempty"`
+	ToVersion   int    `json:"to_version,omitempty"` // current version in the target, or the one written
+}
+
+// handlePromoteEnvironment copies the latest versions of secrets of one
+// environment to another, by default the next one in the promotion order.
+// Each key needs "read" in the source environment (and where it is
+// inherited from) and "write" in the target. Keys whose value and type match
+// the target's are left alone. With dry_run the result is only a preview of
+// what would change. Otherwise every change is written in one transaction,
+// which fails with 409 if any target secret changed since it was compared.
+// Values are copied as stored: references in them are not resolved.
+// POST /api/v1/projects/{project}/promote
+func (s *Server) handlePromoteEnvironment(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	actorType := getActorType(ctx)
+	actorID := getActorID(ctx)
+
+	if scopes, kind, ok := tokenScopes(ctx); ok {
+		if !scopeAllows(scopes, "read", "") || !scopeAllows(scopes, "write", "") {
+			writeError(w, http.StatusForbidden, kind+" needs read and write scopes to promote secrets")
+			return
+		}
+	}
+
+	var req promoteRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	project, err := s.db.GetProjectByName(ctx, r.PathValue("project"))
+	if err != nil {
+		writeError(w, http.StatusNotFound, "project not found")
+		return
+	}
+	if project.IsE2E() {
+		writeError(w, http.StatusBadRequest, "secrets of end-to-end encrypted projects cannot be promoted by the server")
+		return
+	}
+	if project.Environment(req.From) == nil {
+		writeError(w, http.StatusBadRequest, "from must name an environment of the project")
+		return
+	}
+	if req.To == "" {
+		if req.To = project.NextEnvironment(req.From); req.To == "" {
+			writeError(w, http.StatusBadRequest, "environment "+req.From+" has no next environment; name one with to")
+			return
+		}
+	}
+	if project.Environment(req.To) == nil {
+		writeError(w, http.StatusBadRequest, "to must name an environment of the project")
+		return
+	}
+	if req.To == req.From {
+		writeError(w, http.StatusBadRequest, "from and to are the same environment")
+		return
+	}
+
+	keys := req.Keys
+	if len(keys) == 0 {
+		secrets, err := s.db.ListSecrets(ctx, project.ID)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "failed to list secrets")
+			return
+		}
+		for _, sec := range environmentSecrets(project, req.From, secrets) {
+			keys = append(keys, sec.Key)
+		}
+		if len(keys) == 0 {
+			writeError(w, http.StatusBadRequest, "environment "+req.From+" has no secrets to promote")
+			return
+		}
+	}
+	if msg := checkBatchPaths(keys); msg != "" {
+		writeError(w, http.StatusBadRequest, strings.Replace(msg, "path", "key", 1))
+		return
+	}
+
+	results := make([]promoteResult, len(keys))
+	var writes []db.SecretWrite
+	var written []int // index into results of each write
+	failed := 0
+	fail := func(i, status int, msg string) {
+		results[i].Status = status
+		results[i].Error = msg
+		failed++
+	}
+	for i, key := range keys {
+		res := &results[i]
+		res.Key = key
+		fromPath, toPath := req.From+"/"+key, req.To+"/"+key
+
+		if strings.Contains(key, "#") {
+			fail(i, http.StatusBadRequest, "key must not contain '#' (it names a field)")
+			continue
+		}
+
+		source, err := s.db.GetSecret(ctx, project.ID, fromPath)
+		if err != nil {
+			source = s.inheritedSecret(ctx, project, fromPath)
+		}
+		reason, err := s.authorizeBatchItem(ctx, "read", "secret.read", project, fromPath, "", nil)
+		if err == nil && reason == "" && source != nil && source.Path != fromPath {
+			reason, err = s.authorizeBatchItem(ctx, "read", "secret.read", project, source.Path, "", source.Labels)
+		}
+		if err == nil && reason == "" {
+			reason, err = s.authorizeBatchItem(ctx, "write", "secret.write", project, toPath, "", nil)
+		}
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "policy evaluation failed")
+			return
+		}
+		if reason != "" {
+			fail(i, http.StatusForbidden, reason)
+			continue
+		}
+		if source == nil {
+			fail(i, http.StatusNotFound, "secret not found in "+req.From)
+			continue
+		}
+		res.FromPath = source.Path
+
+		sv, err := s.db.GetLatestSecretVersion(ctx, source.ID)
+		if err != nil {
+			fail(i, http.StatusNotFound, "no versions found")
+			continue
+		}
+		if sv.DestroyedAt != nil {
+			fail(i, http.StatusGone, "version "+itoa(sv.Version)+" has been destroyed")
+			continue
+		}
+		res.FromVersion = sv.Version
+		value, _, err := s.secretValue(ctx, project, source, sv)
+		if err != nil {
+			fail(i, http.StatusInternalServerError, "decryption failed")
+			continue
+		}
+
+		// Compare with the target's own secret; what it inherits does not
+		// count, the promoted value replaces that
+		cas := 0
+		var secretLabels map[string]string
+		target, err := s.db.GetSecret(ctx, project.ID, toPath)
+		if err != nil {
+			res.Change = "create"
+			secretLabels = source.Labels
+			// The labels the new secret gets must allow the write as well
+			reason, err := s.authorizeBatchItem(ctx, "write", "secret.write", project, toPath, "", secretLabels)
+			if err != nil {
+				writeError(w, http.StatusInternalServerError, "policy evaluation failed")
+				return
+			}
+			if reason != "" {
+				fail(i, http.StatusForbidden, reason)
+				continue
+			}
+		} else {
+			res.Change = "update"
+			current, err := s.db.GetLatestSecretVersion(ctx, target.ID)
+			if err == nil {
+				cas = current.Version
+				res.ToVersion = current.Version
+				if current.DestroyedAt == nil && target.SecretType == source.SecretType {
+					currentValue, _, err := s.secretValue(ctx, project, target, current)
+					if err != nil {
+						fail(i, http.StatusInternalServerError, "decryption failed")
+						continue
+					}
+					if currentValue == value {
+						res.Change = "unchanged"
+					}
+				}
+			}
+		}
+		res.Status = http.StatusOK
+		if res.Change == "unchanged" {
+			continue
+		}
+
+		expected := cas
+		plaintext := []byte(value)
+		writes = append(writes, db.SecretWrite{
+			Path:        toPath,
+			Description: source.Description,
+			SecretType:  source.SecretType,
+			Metadata:    source.Metadata,
+			Labels:      secretLabels,
+			CAS:         &expected,
+			Encrypt: func(secret *db.Secret, version int) (*db.SecretVersion, error) {
+				encrypted, err := s.encryptForProject(ctx, project.ID, plaintext, &crypto.EncryptionContext{
+					ProjectID: project.ID,
+					SecretID:  secret.ID,
+					Version:   version,
+				})
+				if err != nil {
+					return nil, err
+				}
+				return &db.SecretVersion{
+					Ciphertext:       encrypted.Ciphertext,
+					Nonce:            encrypted.Nonce,
+					EncryptedDEK:     encrypted.EncryptedDEK,
+					DEKNonce:         encrypted.DEKNonce,
+					MasterKeyVersion: encrypted.MasterKeyVersion,
+					KEKVersion:       encrypted.KEKVersion,
+					FormatVersion:    encrypted.Format,
+				}, nil
+			},
+		})
+		written = append(written, i)
+	}
+
+	if failed > 0 {
+		status := 0
+		for i := range results {
+			if results[i].Error == "" {
+				results[i].Status = http.StatusFailedDependency
+				results[i].Error = "not promoted: another key failed"
+			} else if status == 0 {
+				status = results[i].Status
+			}
+		}
+		writeJSON(w, status, map[string]interface{}{
+			"error":   "promotion aborted, no secrets were written",
+			"results": results,
+		})
+		return
+	}
+
+	if !req.DryRun && len(writes) > 0 {
+		versions, err := s.db.WriteSecretVersions(ctx, project.ID, actorID, writes)
+		if err != nil {
+			switch {
+			case strings.Contains(err.Error(), "version mismatch"):
+				writeError(w, http.StatusConflict, "a target secret changed since it was compared: "+err.Error())
+			case strings.Contains(err.Error(), "is deleted"):
+				writeError(w, http.StatusConflict, err.Error())
+			case isDBConflictError(err):
+				writeError(w, http.StatusConflict, "concurrent write conflict, please retry")
+			default:
+				writeError(w, http.StatusInternalServerError, "failed to promote secrets")
+			}
+			return
+		}
+		for n, sv := range versions {
+			res := &results[written[n]]
+			meta, _ := json.Marshal(map[string]interface{}{
+				"version":       sv.Version.Version,
+				"type":          sv.Secret.SecretType,
+				"promoted_from": project.Name + "/" + res.FromPath,
+				"from_version":  res.FromVersion,
+			})
+			s.audit.Log(ctx, audit.Event{
+				ActorType: actorType,
+				ActorID:   actorID,
+				Action:    "secret.write",
+				Resource:  project.Name + "/" + sv.Secret.Path,
+				Outcome:   "success",
+				IP:        getClientIP(ctx),
+				Metadata:  meta,
+			})
+			s.pruneSecretVersions(ctx, project, sv.Secret)
+			res.ToVersion = sv.Version.Version
+		}
+	}
+
+	// Audit the promotion itself, preview or not (NEVER log secret values)
+	metadata, _ := json.Marshal(map[string]interface{}{
+		"to":      req.To,
+		"keys":    len(keys),
+		"changes": len(writes),
+		"dry_run": req.DryRun,
+	})
+	s.audit.Log(ctx, audit.Event{
+		ActorType: actorType,
+		ActorID:   actorID,
+		Action:    "secret.promote",
+		Resource:  project.Name + "/" + req.From,
+		Outcome:   "success",
+		IP:        getClientIP(ctx),
+		Metadata:  metadata,
+	})
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"project": project.Name,
+		"from":    req.From,
+		"to":      req.To,
+		"dry_run": req.DryRun,
+		"results": results,
+	})
+}
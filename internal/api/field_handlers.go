@@ -0,0 +1,213 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/teamvault/teamvault/internal/audit"
+	"github.com/teamvault/teamvault/internal/db"
+	"github.com/teamvault/teamvault/internal/jsonfield"
+	"github.com/teamvault/teamvault/internal/policy"
+)
+
+// fieldResource returns the policy resource of one field of a secret,
+// "project/path#field", or the secret itself if field is empty.
+func fieldResource(resource, field string) string {
+	if field == "" {
+		return resource
+	}
+	return resource + "#" + field
+}
+
+// evaluateFieldPolicy evaluates req for one field of the secret it names.
+// Rules on the field ("project/path#field") decide if any matches, so a
+// policy can allow single fields or deny one field of a secret; otherwise
+// access to the whole secret does. An empty field evaluates req as is.
+func (s *Server) evaluateFieldPolicy(ctx context.Context, req policy.Request, field string) (*policy.Result, error) {
+	if field == "" {
+		return s.policy.Evaluate(ctx, req)
+	}
+	whole := req.Resource
+	req.Resource = fieldResource(whole, field)
+	result, err := s.policy.Evaluate(ctx, req)
+	if err != nil || !result.IsDefaultDeny() {
+		return result, err
+	}
+	req.Resource = whole
+	return s.policy.Evaluate(ctx, req)
+}
+
+// secretField extracts a field from a decrypted secret value. On failure it
+// returns the HTTP status and error message to send.
+func secretField(secret *db.Secret, value, encryption, field string) (string, int, string) {
+	if encryption == db.EncryptionModeE2E {
+		return "", http.StatusBadRequest, "fields of end-to-end encrypted secrets can only be read by the client"
+	}
+	if secret.SecretType != "json" {
+		return "", http.StatusBadRequest, "field access requires a json secret"
+	}
+	v, err := jsonfield.Get([]byte(value), field)
+	if errors.Is(err, jsonfield.ErrNotFound) {
+		return "", http.StatusNotFound, "field " + field + " not found"
+	}
+	if err != nil {
+		return "", http.StatusUnprocessableEntity, err.Error()
+	}
+	return v, 0, ""
+}
+
+// patchSecretFields writes a new version of a JSON secret with a merge patch
+// applied, so single fields can change without resending the document. Each
+// field the patch touches needs write permission.
+func (s *Server) patchSecretFields(w http.ResponseWriter, r *http.Request, patch json.RawMessage, bodyCAS *int) {
+	ctx := r.Context()
+	projectName := r.PathValue("project")
+	secretPath := r.PathValue("path")
+	actorType := getActorType(ctx)
+	actorID := getActorID(ctx)
+	resource := projectName + "/" + secretPath
+
+	fields, err := jsonfield.PatchedFields(patch)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if len(fields) == 0 {
+		writeError(w, http.StatusBadRequest, "fields must not be empty")
+		return
+	}
+
+	policyReq, err := s.secretPolicyRequest(ctx, "write", projectName, secretPath, nil)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to load project")
+		return
+	}
+	for _, field := range fields {
+		if err := jsonfield.Validate(field); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		policyResult, err := s.evaluateFieldPolicy(ctx, policyReq, field)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "policy evaluation failed")
+			return
+		}
+		if !policyResult.Allowed {
+			s.audit.Log(ctx, audit.Event{
+				ActorType: actorType,
+				ActorID:   actorID,
+				Action:    "secret.write",
+				Resource:  fieldResource(resource, field),
+				Outcome:   "denied",
+				IP:        getClientIP(ctx),
+				Metadata:  json.RawMessage(`{"reason":"` + policyResult.Reason + `"}`),
+			})
+			writeError(w, http.StatusForbidden, policyResult.Reason)
+			return
+		}
+	}
+
+	if scopes, kind, ok := tokenScopes(ctx); ok {
+		if !scopeAllows(scopes, "write", resource) {
+			writeError(w, http.StatusForbidden, kind+" lacks write scope")
+			return
+		}
+	}
+
+	project, err := s.db.GetProjectByName(ctx, projectName)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "project not found")
+		return
+	}
+	if reason := s.protectedPathReason(ctx, project, secretPath, "secret.write"); reason != "" {
+		writeError(w, http.StatusForbidden, reason)
+		return
+	}
+	if project.IsE2E() {
+		writeError(w, http.StatusBadRequest, "fields of end-to-end encrypted secrets can only be patched by the client")
+		return
+	}
+
+	cas, msg := casVersion(r, bodyCAS)
+	if msg != "" {
+		writeError(w, http.StatusBadRequest, msg)
+		return
+	}
+	if cas == nil && project.RequireCAS {
+		writeError(w, http.StatusPreconditionRequired, "this project requires check-and-set writes (send If-Match or cas)")
+		return
+	}
+
+	secret, err := s.db.GetSecret(ctx, project.ID, secretPath)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "secret not found")
+		return
+	}
+	if secret.SecretType != "json" {
+		writeError(w, http.StatusBadRequest, "field access requires a json secret")
+		return
+	}
+
+	latest, err := s.db.GetLatestSecretVersion(ctx, secret.ID)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "no versions found")
+		return
+	}
+	if latest.DestroyedAt != nil {
+		writeError(w, http.StatusGone, "version "+itoa(latest.Version)+" has been destroyed")
+		return
+	}
+	value, _, err := s.secretValue(ctx, project, secret, latest)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "decryption failed")
+		return
+	}
+	doc, err := jsonfield.MergePatch([]byte(value), patch)
+	if err != nil {
+		writeError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	// The patch applies to the version just read; a concurrent write in
+	// between fails the store rather than being overwritten
+	if cas == nil {
+		cas = &latest.Version
+	}
+	sv, status, msg := s.storeSecretVersion(ctx, project, secret, doc, nil, actorID, cas)
+	if msg != "" {
+		writeError(w, status, msg)
+		return
+	}
+
+	// Audit the write (NEVER log the secret value)
+	meta, _ := json.Marshal(map[string]interface{}{"version": sv.Version, "fields": fields})
+	s.audit.Log(ctx, audit.Event{
+		ActorType: actorType,
+		ActorID:   actorID,
+		Action:    "secret.write",
+		Resource:  resource,
+		Outcome:   "success",
+		IP:        getClientIP(ctx),
+		Metadata:  meta,
+	})
+
+	s.pruneSecretVersions(ctx, project, secret)
+
+	w.Header().Set("ETag", etag(sv.Version))
+	writeJSON(w, http.StatusOK, secretResponse{
+		ID:                   secret.ID,
+		ProjectID:            project.ID,
+		Project:              project.Name,
+		Path:                 secret.Path,
+		Description:          secret.Description,
+		SecretType:           secret.SecretType,
+		Version:              sv.Version,
+		CreatedBy:            actorID,
+		CreatedAt:            secret.CreatedAt.Format("2006-01-02T15:04:05Z"),
+		MaxVersions:          secret.MaxVersions,
+		MaxVersionAgeSeconds: secret.MaxVersionAgeSeconds,
+		Labels:               secret.Labels,
+	})
+}
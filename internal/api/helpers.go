@@ -36,6 +36,12 @@ func isDBInvalidInputError(err error) bool {
 	return strings.Contains(msg, "invalid input syntax") || strings.Contains(msg, "22P02")
 }
 
+// isDBNotFoundError checks whether a database error is a lookup of a single
+// row that found none.
+func isDBNotFoundError(err error) bool {
+	return strings.Contains(err.Error(), "no rows in result set")
+}
+
 // writeJSON writes a JSON response.
 func writeJSON(w http.ResponseWriter, status int, data interface{}) {
 	w.Header().Set("Content-Type", "application/json")
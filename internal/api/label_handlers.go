@@ -0,0 +1,344 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/teamvault/teamvault/internal/audit"
+	"github.com/teamvault/teamvault/internal/db"
+	"github.com/teamvault/teamvault/internal/labels"
+	"github.com/teamvault/teamvault/internal/policy"
+)
+
+// maxSearchResults caps the secrets returned by a search.
+const maxSearchResults = 1000
+
+// requestAttributes returns the attributes of the caller that every policy
+// request carries: the IP, and a user's role and MFA status or an agent's
+// name, team and role.
+func requestAttributes(ctx context.Context) *policy.RequestAttributes {
+	attrs := &policy.RequestAttributes{IP: getClientIP(ctx)}
+	if claims := getUserClaims(ctx); claims != nil {
+		attrs.Role = claims.Role
+		attrs.MFA = claims.MFA
+	}
+	if claims := getAgentClaims(ctx); claims != nil {
+		attrs.AgentName = claims.Name
+		attrs.Team = claims.TeamName
+		attrs.Role = claims.Role
+	}
+	return attrs
+}
+
+// secretPolicyRequest builds the policy request for an action on a secret of
+// the named project. See projectPolicyRequest. Failing to load the project
+// is an error, lest IAM policies be skipped; only a missing project goes on
+// without one.
+func (s *Server) secretPolicyRequest(ctx context.Context, action, projectName, secretPath string, secretLabels map[string]string) (policy.Request, error) {
+	project, err := s.db.GetProjectByName(ctx, projectName)
+	if err != nil && !isDBNotFoundError(err) {
+		return policy.Request{}, err
+	}
+	req := s.projectPolicyRequest(ctx, action, project, secretPath, secretLabels)
+	req.Resource = projectName + "/" + secretPath
+	return req, nil
+}
+
+// projectPolicyRequest builds the policy request for an action on a secret
+// of a project. The request carries what IAM policies match on: the caller's
+// attributes (see requestAttributes), the environment the secret is in and,
+// if the project belongs to an organization, the secret's labels. When
+// secretLabels is nil they are read from the secret, if it exists. A nil
+// project (not found) only gets legacy policies, so the handler can still
+// answer 403 before 404.
+func (s *Server) projectPolicyRequest(ctx context.Context, action string, project *db.Project, secretPath string, secretLabels map[string]string) policy.Request {
+	req := policy.Request{
+		SubjectType: getActorType(ctx),
+		SubjectID:   getActorID(ctx),
+		Action:      action,
+		IsAdmin:     isAdmin(ctx),
+	}
+	if project == nil {
+		return req
+	}
+	req.Resource = project.Name + "/" + secretPath
+	if req.IsAdmin {
+		return req
+	}
+
+	attrs := requestAttributes(ctx)
+	attrs.Environment, _ = project.SplitEnvironment(secretPath)
+	req.Attributes = attrs
+	if project.OrgID == "" {
+		return req
+	}
+
+	req.OrgID = project.OrgID
+	attrs.Labels = secretLabels
+	if attrs.Labels == nil && secretPath != "*" {
+		if secret, err := s.db.GetSecret(ctx, project.ID, secretPath); err == nil {
+			attrs.Labels = secret.Labels
+		}
+	}
+	return req
+}
+
+// canListProject reports whether the caller may list the secrets of a
+// project: "read" on project/*, or being its creator or an admin.
+func (s *Server) canListProject(ctx context.Context, project *db.Project) (bool, error) {
+	policyResult, err := s.policy.Evaluate(ctx, s.projectPolicyRequest(ctx, "read", project, "*", map[string]string{}))
+	if err != nil {
+		return false, err
+	}
+	if policyResult.Allowed {
+		return true, nil
+	}
+	claims := getUserClaims(ctx)
+	return claims != nil && (project.CreatedBy == claims.UserID || claims.Role == "admin"), nil
+}
+
+type patchSecretRequest struct {
+	// Labels to set; a null value removes the label
+	Labels map[string]*string `json:"labels,omitempty"`
+	// Fields of a JSON secret to change, as a JSON merge patch (RFC 7396)
+	Fields json.RawMessage `json:"fields,omitempty"`
+	CAS    *int            `json:"cas,omitempty"` // for fields, as for PUT
+}
+
+// handlePatchSecret changes the labels of a secret, or single fields of a
+// JSON secret, without resending its value.
+// PATCH /api/v1/secrets/{project}/{path...}
+func (s *Server) handlePatchSecret(w http.ResponseWriter, r *http.Request) {
+	if r.PathValue("project") == "" || r.PathValue("path") == "" {
+		writeError(w, http.StatusBadRequest, "project and path are required")
+		return
+	}
+
+	var req patchSecretRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	switch {
+	case req.Labels != nil && req.Fields != nil:
+		writeError(w, http.StatusBadRequest, "send either labels or fields, not both")
+	case req.Labels != nil:
+		s.patchSecretLabels(w, r, req.Labels)
+	case req.Fields != nil:
+		s.patchSecretFields(w, r, req.Fields, req.CAS)
+	default:
+		writeError(w, http.StatusBadRequest, "labels or fields is required")
+	}
+}
+
+// patchSecretLabels adds, changes or removes labels of a secret without
+// writing a new version.
+func (s *Server) patchSecretLabels(w http.ResponseWriter, r *http.Request, changes map[string]*string) {
+	ctx := r.Context()
+	projectName := r.PathValue("project")
+	secretPath := r.PathValue("path")
+	actorType := getActorType(ctx)
+	actorID := getActorID(ctx)
+
+	resource := projectName + "/" + secretPath
+
+	// Relabeling needs write permission under both the current and the new
+	// labels, so labels cannot be used to step around a policy
+	authorize := func(policyReq policy.Request) bool {
+		policyResult, err := s.policy.Evaluate(ctx, policyReq)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "policy evaluation failed")
+			return false
+		}
+		if !policyResult.Allowed {
+			s.audit.Log(ctx, audit.Event{
+				ActorType: actorType,
+				ActorID:   actorID,
+				Action:    "secret.labels",
+				Resource:  resource,
+				Outcome:   "denied",
+				IP:        getClientIP(ctx),
+				Metadata:  json.RawMessage(`{"reason":"` + policyResult.Reason + `"}`),
+			})
+			writeError(w, http.StatusForbidden, policyResult.Reason)
+			return false
+		}
+		return true
+	}
+	policyReq, err := s.secretPolicyRequest(ctx, "write", projectName, secretPath, nil)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to load project")
+		return
+	}
+	if !authorize(policyReq) {
+		return
+	}
+
+	if scopes, kind, ok := tokenScopes(ctx); ok {
+		if !scopeAllows(scopes, "write", resource) {
+			writeError(w, http.StatusForbidden, kind+" lacks write scope")
+			return
+		}
+	}
+
+	project, err := s.db.GetProjectByName(ctx, projectName)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "project not found")
+		return
+	}
+	secret, err := s.db.GetSecret(ctx, project.ID, secretPath)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "secret not found")
+		return
+	}
+
+	updated := make(map[string]string, len(secret.Labels)+len(changes))
+	for k, v := range secret.Labels {
+		updated[k] = v
+	}
+	for k, v := range changes {
+		if v == nil {
+			delete(updated, k)
+		} else {
+			updated[k] = *v
+		}
+	}
+	if err := labels.Validate(updated); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if !authorize(s.projectPolicyRequest(ctx, "write", project, secretPath, updated)) {
+		return
+	}
+
+	if err := s.db.SetSecretLabels(ctx, secret.ID, updated); err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to update labels")
+		return
+	}
+
+	// Label values are not secret, but keep the audit trail to the keys
+	keys := make([]string, 0, len(changes))
+	for k := range changes {
+		keys = append(keys, k)
+	}
+	meta, _ := json.Marshal(map[string]interface{}{"keys": keys})
+	s.audit.Log(ctx, audit.Event{
+		ActorType: actorType,
+		ActorID:   actorID,
+		Action:    "secret.labels",
+		Resource:  resource,
+		Outcome:   "success",
+		IP:        getClientIP(ctx),
+		Metadata:  meta,
+	})
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"project": project.Name,
+		"path":    secret.Path,
+		"labels":  updated,
+	})
+}
+
+type searchResultItem struct {
+	ID          string            `json:"id"`
+	Project     string            `json:"project"`
+	Path        string            `json:"path"`
+	Description string            `json:"description,omitempty"`
+	SecretType  string            `json:"secret_type"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	CreatedBy   string            `json:"created_by"`
+	CreatedAt   string            `json:"created_at"`
+}
+
+// handleSearchSecrets finds secrets by label selector and path prefix, in one
+// project or across every project the caller can list. Only metadata is
+// returned, never values.
+// GET /api/v1/search/secrets?project=&prefix=&selector=&limit=
+func (s *Server) handleSearchSecrets(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	q := r.URL.Query()
+
+	selector, err := labels.Parse(q.Get("selector"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	limit := maxSearchResults
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			writeError(w, http.StatusBadRequest, "limit must be a positive integer")
+			return
+		}
+		if n < limit {
+			limit = n
+		}
+	}
+
+	search := db.SecretSearch{
+		PathPrefix: strings.TrimPrefix(q.Get("prefix"), "/"),
+		Selector:   selector,
+		Limit:      limit,
+	}
+	if name := q.Get("project"); name != "" {
+		project, err := s.db.GetProjectByName(ctx, name)
+		if err != nil {
+			writeError(w, http.StatusNotFound, "project not found")
+			return
+		}
+		ok, err := s.canListProject(ctx, project)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "policy evaluation failed")
+			return
+		}
+		if !ok {
+			writeError(w, http.StatusForbidden, "access denied")
+			return
+		}
+		search.ProjectID = project.ID
+	}
+
+	found, err := s.db.SearchSecrets(ctx, search)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to search secrets")
+		return
+	}
+
+	// Across projects, drop the secrets of projects the caller cannot list
+	listable := make(map[string]bool)
+	items := make([]searchResultItem, 0, len(found))
+	for _, sec := range found {
+		if search.ProjectID == "" {
+			ok, checked := listable[sec.ProjectID]
+			if !checked {
+				project, err := s.db.GetProjectByID(ctx, sec.ProjectID)
+				if err == nil {
+					ok, err = s.canListProject(ctx, project)
+				}
+				if err != nil {
+					writeError(w, http.StatusInternalServerError, "policy evaluation failed")
+					return
+				}
+				listable[sec.ProjectID] = ok
+			}
+			if !ok {
+				continue
+			}
+		}
+		items = append(items, searchResultItem{
+			ID:          sec.ID,
+			Project:     sec.ProjectName,
+			Path:        sec.Path,
+			Description: sec.Description,
+			SecretType:  sec.SecretType,
+			Labels:      sec.Labels,
+			CreatedBy:   sec.CreatedBy,
+			CreatedAt:   sec.CreatedAt.Format("2006-01-02T15:04:05Z"),
+		})
+	}
+
+	writeJSON(w, http.StatusOK, items)
+}
@@ -11,6 +11,7 @@ import (
 type issueDatabaseLeaseRequest struct {
 	TTLSeconds int    `json:"ttl_seconds"` // Default: 3600 (1h)
 	OrgID      string `json:"org_id,omitempty"`
+	Project    string `json:"project,omitempty"` // Optional: scope the lease to a project's KEK
 }
 
 func (s *Server) handleIssueDatabaseLease(w http.ResponseWriter, r *http.Request) {
@@ -34,7 +35,21 @@ func (s *Server) handleIssueDatabaseLease(w http.ResponseWriter, r *http.Request
 		orgID = &req.OrgID
 	}
 
-	leaseResp, err := s.leaseManager.IssueDatabaseLease(ctx, actorID, req.TTLSeconds, orgID)
+	var projectID *string
+	if req.Project != "" {
+		project, err := s.db.GetProjectByName(ctx, req.Project)
+		if err != nil {
+			writeError(w, http.StatusNotFound, "project not found")
+			return
+		}
+		if project.IsE2E() {
+			writeError(w, http.StatusConflict, "leases are not available for end-to-end encrypted projects")
+			return
+		}
+		projectID = &project.ID
+	}
+
+	leaseResp, err := s.leaseManager.IssueDatabaseLease(ctx, actorID, req.TTLSeconds, orgID, projectID)
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, "failed to issue lease")
 		return
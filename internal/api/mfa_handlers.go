@@ -0,0 +1,571 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/teamvault/teamvault/internal/audit"
+	"github.com/teamvault/teamvault/internal/auth"
+	"github.com/teamvault/teamvault/internal/db"
+)
+
+const (
+	mfaIssuer            = "TeamVault"
+	mfaChallengeDuration = 5 * time.Minute
+	mfaChallengeAttempts = 5
+	recoveryCodeCount    = 10
+)
+
+// errMFAThrottled is returned by verifyMFACode when a user tried too many
+// codes in a short time.
+var errMFAThrottled = errors.New("too many mfa attempts")
+
+// mfaCodeRequest carries a TOTP code or a recovery code.
+type mfaCodeRequest struct {
+	Code string `json:"code"`
+}
+
+// loginMFARequest is the second login step.
+type loginMFARequest struct {
+	MFAToken string `json:"mfa_token"`
+	Code     string `json:"code"`
+}
+
+// mfaChallengeResponse is returned instead of tokens when a user with MFA
+// enabled passed the first login step.
+type mfaChallengeResponse struct {
+	MFARequired bool      `json:"mfa_required"`
+	MFAToken    string    `json:"mfa_token"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+// mfaChallenge starts the second login step for a user who authenticated
+// with method ("pwd" or "oidc"), if they have MFA enabled. It returns nil if
+// they have not.
+func (s *Server) mfaChallenge(ctx context.Context, user *db.User, method string) (*mfaChallengeResponse, error) {
+	mfa, err := s.db.GetUserMFA(ctx, user.ID)
+	if err != nil {
+		if strings.Contains(err.Error(), "not enrolled") {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if mfa.EnabledAt == nil {
+		return nil, nil
+	}
+
+	token, hash, err := auth.GenerateMFAToken()
+	if err != nil {
+		return nil, err
+	}
+	expiresAt := time.Now().Add(mfaChallengeDuration)
+	if err := s.db.CreateMFAChallenge(ctx, user.ID, hash, method, expiresAt); err != nil {
+		return nil, err
+	}
+	return &mfaChallengeResponse{MFARequired: true, MFAToken: token, ExpiresAt: expiresAt}, nil
+}
+
+// verifyMFACode checks a code of a user with MFA enabled: a 6-digit TOTP
+// code, which works once, or else an unused recovery code, which is then
+// used up. It returns the method that matched, "otp" or "recovery", or ""
+// if none did.
+func (s *Server) verifyMFACode(ctx context.Context, mfa *db.UserMFA, code string) (string, error) {
+	if !s.mfaLimiter.allow(mfa.UserID) {
+		return "", errMFAThrottled
+	}
+	code = strings.ReplaceAll(strings.TrimSpace(code), " ", "")
+	if code == "" {
+		return "", nil
+	}
+
+	if isTOTPCode(code) {
+		secret, err := s.auth.OpenTOTPSecret(mfa.TOTPSecret)
+		if err != nil {
+			return "", err
+		}
+		step, ok := auth.ValidateTOTP(secret, code, time.Now())
+		if !ok {
+			return "", nil
+		}
+		used, err := s.db.UseTOTPStep(ctx, mfa.UserID, step)
+		if err != nil || !used {
+			return "", err
+		}
+		return "otp", nil
+	}
+
+	codes, err := s.db.ListRecoveryCodes(ctx, mfa.UserID)
+	if err != nil {
+		return "", err
+	}
+	for _, c := range codes {
+		if s.auth.ValidateRecoveryCode(code, c.CodeHash) {
+			used, err := s.db.UseRecoveryCode(ctx, c.ID)
+			if err != nil || !used {
+				return "", err
+			}
+			return "recovery", nil
+		}
+	}
+	return "", nil
+}
+
+func isTOTPCode(code string) bool {
+	if len(code) != 6 {
+		return false
+	}
+	for _, c := range code {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// enabledMFA returns the confirmed MFA enrollment of the calling user, or
+// writes an error.
+func (s *Server) enabledMFA(w http.ResponseWriter, r *http.Request, userID string) *db.UserMFA {
+	mfa, err := s.db.GetUserMFA(r.Context(), userID)
+	if err != nil {
+		if strings.Contains(err.Error(), "not enrolled") {
+			writeError(w, http.StatusBadRequest, "mfa is not enabled")
+			return nil
+		}
+		writeError(w, http.StatusInternalServerError, "failed to get mfa")
+		return nil
+	}
+	if mfa.EnabledAt == nil {
+		writeError(w, http.StatusBadRequest, "mfa is not enabled")
+		return nil
+	}
+	return mfa
+}
+
+// checkMFACode verifies the code of a request from a user with MFA enabled,
+// or writes an error and audits the failure as action.
+func (s *Server) checkMFACode(w http.ResponseWriter, r *http.Request, mfa *db.UserMFA, code, action string) string {
+	method, err := s.verifyMFACode(r.Context(), mfa, code)
+	if errors.Is(err, errMFAThrottled) {
+		writeError(w, http.StatusTooManyRequests, "too many attempts, try again later")
+		return ""
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to verify code")
+		return ""
+	}
+	if method == "" {
+		s.audit.Log(r.Context(), audit.Event{
+			ActorType: "user",
+			ActorID:   mfa.UserID,
+			Action:    action,
+			Resource:  "user:" + mfa.UserID,
+			Outcome:   "denied",
+			IP:        clientIP(r),
+			Metadata:  json.RawMessage(`{"reason":"invalid_mfa_code"}`),
+		})
+		writeError(w, http.StatusUnauthorized, "invalid mfa code")
+		return ""
+	}
+	return method
+}
+
+// handleLoginMFA completes a login with the token from the first step and a
+// TOTP or recovery code. The tokens issued carry the mfa claim.
+// POST /api/v1/auth/login/mfa
+func (s *Server) handleLoginMFA(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var req loginMFARequest
+	if err := decodeJSON(r, &req); err != nil || req.MFAToken == "" || req.Code == "" {
+		writeError(w, http.StatusBadRequest, "mfa_token and code are required")
+		return
+	}
+
+	challenge, err := s.db.GetMFAChallenge(ctx, auth.HashMFAToken(req.MFAToken), mfaChallengeAttempts)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, "invalid or expired mfa token")
+		return
+	}
+	user, err := s.db.GetUserByID(ctx, challenge.UserID)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, "invalid or expired mfa token")
+		return
+	}
+	mfa := s.enabledMFA(w, r, user.ID)
+	if mfa == nil {
+		return
+	}
+
+	loginAction := "auth.login"
+	if challenge.Method == "oidc" {
+		loginAction = "auth.oidc_login"
+	}
+	method := s.checkMFACode(w, r, mfa, req.Code, loginAction)
+	if method == "" {
+		s.db.FailMFAChallenge(ctx, challenge.ID)
+		return
+	}
+	if ok, err := s.db.CompleteMFAChallenge(ctx, challenge.ID); err != nil || !ok {
+		writeError(w, http.StatusUnauthorized, "invalid or expired mfa token")
+		return
+	}
+
+	tokens, err := s.startSession(r, user, []string{challenge.Method, method}, true)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to generate token")
+		return
+	}
+
+	metadata, _ := json.Marshal(map[string]string{"mfa": method})
+	s.audit.Log(ctx, audit.Event{
+		ActorType: "user",
+		ActorID:   user.ID,
+		Action:    loginAction,
+		Resource:  "user:" + user.ID,
+		Outcome:   "success",
+		IP:        clientIP(r),
+		Metadata:  metadata,
+	})
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"user":          user,
+		"token":         tokens.Token,
+		"refresh_token": tokens.RefreshToken,
+		"expires_at":    tokens.ExpiresAt,
+	})
+}
+
+// handleMFAStatus reports whether the caller has MFA enabled and whether
+// their current token counts as MFA-verified.
+// GET /api/v1/auth/mfa
+func (s *Server) handleMFAStatus(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claims := getUserClaims(ctx)
+	if claims == nil {
+		writeError(w, http.StatusBadRequest, "mfa is only available to users")
+		return
+	}
+
+	resp := map[string]interface{}{"enabled": false, "verified": claims.MFA}
+	mfa, err := s.db.GetUserMFA(ctx, claims.UserID)
+	if err != nil && !strings.Contains(err.Error(), "not enrolled") {
+		writeError(w, http.StatusInternalServerError, "failed to get mfa")
+		return
+	}
+	if mfa != nil && mfa.EnabledAt != nil {
+		codes, err := s.db.ListRecoveryCodes(ctx, claims.UserID)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "failed to get mfa")
+			return
+		}
+		resp["enabled"] = true
+		resp["enabled_at"] = mfa.EnabledAt
+		resp["recovery_codes_left"] = len(codes)
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// handleMFAEnroll starts TOTP enrollment: it returns a new secret and its
+// otpauth:// URI for an authenticator app. MFA is enabled once the user
+// confirms with a code.
+// POST /api/v1/auth/mfa/enroll
+func (s *Server) handleMFAEnroll(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claims := getUserClaims(ctx)
+	if claims == nil {
+		writeError(w, http.StatusBadRequest, "mfa is only available to users")
+		return
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to generate secret")
+		return
+	}
+	sealed, err := s.auth.SealTOTPSecret(secret)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to generate secret")
+		return
+	}
+	if err := s.db.StartMFAEnrollment(ctx, claims.UserID, sealed); err != nil {
+		if strings.Contains(err.Error(), "already enabled") {
+			writeError(w, http.StatusConflict, "mfa is already enabled; disable it first")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "failed to start enrollment")
+		return
+	}
+
+	s.audit.Log(ctx, audit.Event{
+		ActorType: "user",
+		ActorID:   claims.UserID,
+		Action:    "auth.mfa.enroll",
+		Resource:  "user:" + claims.UserID,
+		Outcome:   "success",
+		IP:        getClientIP(ctx),
+	})
+
+	writeJSON(w, http.StatusOK, map[string]string{
+		"secret":      secret,
+		"otpauth_uri": auth.TOTPURI(mfaIssuer, claims.Email, secret),
+	})
+}
+
+// handleMFAConfirm enables MFA with a first code from the authenticator app
+// and returns the recovery codes, which are shown only this once.
+// POST /api/v1/auth/mfa/confirm
+func (s *Server) handleMFAConfirm(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claims := getUserClaims(ctx)
+	if claims == nil {
+		writeError(w, http.StatusBadRequest, "mfa is only available to users")
+		return
+	}
+	var req mfaCodeRequest
+	if err := decodeJSON(r, &req); err != nil || req.Code == "" {
+		writeError(w, http.StatusBadRequest, "code is required")
+		return
+	}
+
+	mfa, err := s.db.GetUserMFA(ctx, claims.UserID)
+	if err != nil || mfa.EnabledAt != nil {
+		writeError(w, http.StatusBadRequest, "no pending mfa enrollment")
+		return
+	}
+	if !s.mfaLimiter.allow(claims.UserID) {
+		writeError(w, http.StatusTooManyRequests, "too many attempts, try again later")
+		return
+	}
+	secret, err := s.auth.OpenTOTPSecret(mfa.TOTPSecret)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to verify code")
+		return
+	}
+	step, ok := auth.ValidateTOTP(secret, strings.TrimSpace(req.Code), time.Now())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "invalid mfa code")
+		return
+	}
+
+	codes, hashes, err := s.auth.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to generate recovery codes")
+		return
+	}
+	if err := s.db.EnableMFA(ctx, claims.UserID, step, hashes); err != nil {
+		if strings.Contains(err.Error(), "no pending") {
+			writeError(w, http.StatusBadRequest, "no pending mfa enrollment")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "failed to enable mfa")
+		return
+	}
+
+	s.audit.Log(ctx, audit.Event{
+		ActorType: "user",
+		ActorID:   claims.UserID,
+		Action:    "auth.mfa.enable",
+		Resource:  "user:" + claims.UserID,
+		Outcome:   "success",
+		IP:        getClientIP(ctx),
+	})
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"enabled": true, "recovery_codes": codes})
+}
+
+// handleMFAVerify is the step-up: a user re-verifies MFA and gets a new
+// access token for the current session that carries the mfa claim, so
+// policies requiring MFA allow it. Refreshed tokens keep the claim until the
+// verification is older than the MFA max age. The refresh token is unchanged.
+// POST /api/v1/auth/mfa/verify
+func (s *Server) handleMFAVerify(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claims := getUserClaims(ctx)
+	if claims == nil {
+		writeError(w, http.StatusBadRequest, "mfa is only available to users")
+		return
+	}
+	if claims.SessionID == "" {
+		writeError(w, http.StatusBadRequest, "token has no session; log in again")
+		return
+	}
+	var req mfaCodeRequest
+	if err := decodeJSON(r, &req); err != nil || req.Code == "" {
+		writeError(w, http.StatusBadRequest, "code is required")
+		return
+	}
+
+	mfa := s.enabledMFA(w, r, claims.UserID)
+	if mfa == nil {
+		return
+	}
+	method := s.checkMFACode(w, r, mfa, req.Code, "auth.mfa.verify")
+	if method == "" {
+		return
+	}
+
+	user, err := s.db.GetUserByID(ctx, claims.UserID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to get user")
+		return
+	}
+	session, err := s.db.GetSession(ctx, claims.SessionID)
+	if err != nil || !session.Active() {
+		writeError(w, http.StatusUnauthorized, "session expired or revoked")
+		return
+	}
+	amr := session.AMR
+	if !slices.Contains(amr, method) {
+		amr = append(amr, method)
+	}
+	token, newClaims, err := s.auth.GenerateJWT(user.ID, user.Email, user.Role, session.ID, amr, true)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to generate token")
+		return
+	}
+	if _, err := s.db.StepUpSession(ctx, session.ID, method, newClaims.ID, newClaims.ExpiresAt.Time); err != nil {
+		if strings.Contains(err.Error(), "no longer active") {
+			writeError(w, http.StatusUnauthorized, "session expired or revoked")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "failed to verify mfa")
+		return
+	}
+
+	metadata, _ := json.Marshal(map[string]string{"mfa": method})
+	s.audit.Log(ctx, audit.Event{
+		ActorType: "user",
+		ActorID:   claims.UserID,
+		Action:    "auth.mfa.verify",
+		Resource:  "session:" + session.ID,
+		Outcome:   "success",
+		IP:        getClientIP(ctx),
+		Metadata:  metadata,
+	})
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"token": token, "expires_at": newClaims.ExpiresAt.Time})
+}
+
+// handleMFARecoveryCodes replaces the caller's recovery codes with new ones,
+// which are shown only this once.
+// POST /api/v1/auth/mfa/recovery-codes
+func (s *Server) handleMFARecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claims := getUserClaims(ctx)
+	if claims == nil {
+		writeError(w, http.StatusBadRequest, "mfa is only available to users")
+		return
+	}
+	var req mfaCodeRequest
+	if err := decodeJSON(r, &req); err != nil || req.Code == "" {
+		writeError(w, http.StatusBadRequest, "code is required")
+		return
+	}
+
+	mfa := s.enabledMFA(w, r, claims.UserID)
+	if mfa == nil {
+		return
+	}
+	if s.checkMFACode(w, r, mfa, req.Code, "auth.mfa.recovery_codes") == "" {
+		return
+	}
+
+	codes, hashes, err := s.auth.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to generate recovery codes")
+		return
+	}
+	if err := s.db.ReplaceRecoveryCodes(ctx, claims.UserID, hashes); err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to replace recovery codes")
+		return
+	}
+
+	s.audit.Log(ctx, audit.Event{
+		ActorType: "user",
+		ActorID:   claims.UserID,
+		Action:    "auth.mfa.recovery_codes",
+		Resource:  "user:" + claims.UserID,
+		Outcome:   "success",
+		IP:        getClientIP(ctx),
+	})
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"recovery_codes": codes})
+}
+
+// handleMFADisable turns off MFA for the caller, who must give a current
+// code.
+// POST /api/v1/auth/mfa/disable
+func (s *Server) handleMFADisable(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claims := getUserClaims(ctx)
+	if claims == nil {
+		writeError(w, http.StatusBadRequest, "mfa is only available to users")
+		return
+	}
+	var req mfaCodeRequest
+	if err := decodeJSON(r, &req); err != nil || req.Code == "" {
+		writeError(w, http.StatusBadRequest, "code is required")
+		return
+	}
+
+	mfa := s.enabledMFA(w, r, claims.UserID)
+	if mfa == nil {
+		return
+	}
+	if s.checkMFACode(w, r, mfa, req.Code, "auth.mfa.disable") == "" {
+		return
+	}
+	if err := s.db.DisableMFA(ctx, claims.UserID); err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to disable mfa")
+		return
+	}
+
+	s.audit.Log(ctx, audit.Event{
+		ActorType: "user",
+		ActorID:   claims.UserID,
+		Action:    "auth.mfa.disable",
+		Resource:  "user:" + claims.UserID,
+		Outcome:   "success",
+		IP:        getClientIP(ctx),
+	})
+
+	writeJSON(w, http.StatusOK, map[string]bool{"enabled": false})
+}
+
+// handleResetUserMFA removes the MFA enrollment of a user who lost both
+// their authenticator and their recovery codes, so they can log in with
+// their password and enroll again.
+// DELETE /api/v1/users/{id}/mfa
+func (s *Server) handleResetUserMFA(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claims := getUserClaims(ctx)
+	userID := r.PathValue("id")
+	if !isValidUUID(userID) {
+		writeError(w, http.StatusNotFound, "user not found")
+		return
+	}
+
+	if err := s.db.DisableMFA(ctx, userID); err != nil {
+		if strings.Contains(err.Error(), "not enrolled") {
+			writeError(w, http.StatusNotFound, "user has no mfa enrollment")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "failed to reset mfa")
+		return
+	}
+
+	s.audit.Log(ctx, audit.Event{
+		ActorType: "user",
+		ActorID:   claims.UserID,
+		Action:    "auth.mfa.reset",
+		Resource:  "user:" + userID,
+		Outcome:   "success",
+		IP:        getClientIP(ctx),
+	})
+
+	writeJSON(w, http.StatusOK, map[string]bool{"enabled": false})
+}
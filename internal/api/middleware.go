@@ -11,6 +11,7 @@ import (
 	"time"
 
 	"github.com/teamvault/teamvault/internal/auth"
+	"github.com/teamvault/teamvault/internal/db"
 )
 
 // securityHeadersMiddleware adds standard security headers to all responses.
@@ -29,8 +30,9 @@ func securityHeadersMiddleware(next http.Handler) http.Handler {
 func corsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Request-ID")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Request-ID, If-Match, X-TeamVault-Wrap-TTL")
+		w.Header().Set("Access-Control-Expose-Headers", "ETag")
 		w.Header().Set("Access-Control-Max-Age", "86400")
 
 		if r.Method == http.MethodOptions {
@@ -45,12 +47,14 @@ func corsMiddleware(next http.Handler) http.Handler {
 type contextKey string
 
 const (
-	ctxUserClaims  contextKey = "user_claims"
-	ctxSAClaims    contextKey = "sa_claims"
-	ctxActorType   contextKey = "actor_type"
-	ctxActorID     contextKey = "actor_id"
-	ctxClientIP    contextKey = "client_ip"
-	ctxRequestID   contextKey = "request_id"
+	ctxUserClaims      contextKey = "user_claims"
+	ctxSAClaims        contextKey = "sa_claims"
+	ctxAgentClaims     contextKey = "agent_claims"
+	ctxActorType       contextKey = "actor_type"
+	ctxActorID         contextKey = "actor_id"
+	ctxClientIP        contextKey = "client_ip"
+	ctxRequestID       contextKey = "request_id"
+	ctxWrappedProjects contextKey = "wrapped_projects"
 )
 
 // ---- Rate Limiter (Token Bucket per IP) ----
@@ -235,8 +239,10 @@ func (sr *statusRecorder) WriteHeader(code int) {
 	sr.ResponseWriter.WriteHeader(code)
 }
 
-// authMiddleware validates JWT or service account tokens.
+// authMiddleware validates JWT or service account tokens. Authenticated
+// requests may ask for their response to be wrapped (see responseWrapping).
 func (s *Server) authMiddleware(next http.Handler) http.Handler {
+	next = s.responseWrapping(next)
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		header := r.Header.Get("Authorization")
 		if header == "" {
@@ -255,10 +261,7 @@ func (s *Server) authMiddleware(next http.Handler) http.Handler {
 
 		// Check if this is a service account token (prefixed with "sa.")
 		if strings.HasPrefix(token, "sa.") {
-			saToken := strings.TrimPrefix(token, "sa.")
-			sa, err := s.db.FindServiceAccountByToken(ctx, func(hash string) bool {
-				return s.auth.ValidateServiceAccountToken(saToken, hash) == nil
-			})
+			sa, err := s.serviceAccountByToken(ctx, strings.TrimPrefix(token, "sa."))
 			if err != nil {
 				writeError(w, http.StatusUnauthorized, "invalid service account token")
 				return
@@ -282,6 +285,42 @@ func (s *Server) authMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
+		// Check if this is an agent token (prefixed with "agent.")
+		if strings.HasPrefix(token, "agent.") {
+			agent, err := s.agentByToken(ctx, strings.TrimPrefix(token, "agent."))
+			if err != nil {
+				writeError(w, http.StatusUnauthorized, "invalid agent token")
+				return
+			}
+
+			// Check expiration
+			if agent.ExpiresAt != nil && agent.ExpiresAt.Before(time.Now()) {
+				writeError(w, http.StatusUnauthorized, "agent token expired")
+				return
+			}
+
+			team, err := s.db.GetTeamByID(ctx, agent.TeamID)
+			if err != nil {
+				writeError(w, http.StatusUnauthorized, "invalid agent token")
+				return
+			}
+
+			agentClaims := &auth.AgentClaims{
+				AgentID:  agent.ID,
+				Name:     agent.Name,
+				TeamID:   team.ID,
+				TeamName: team.Name,
+				OrgID:    team.OrgID,
+				Role:     agent.Role,
+				Scopes:   agent.Scopes,
+			}
+			ctx = context.WithValue(ctx, ctxAgentClaims, agentClaims)
+			ctx = context.WithValue(ctx, ctxActorType, "agent")
+			ctx = context.WithValue(ctx, ctxActorID, agent.ID)
+			next.ServeHTTP(w, r.WithContext(ctx))
+			return
+		}
+
 		// Regular JWT token
 		claims, err := s.auth.ValidateJWT(token)
 		if err != nil {
@@ -289,6 +328,19 @@ func (s *Server) authMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
+		// Tokens of revoked sessions are denied until they expire
+		if claims.ID != "" {
+			revoked, err := s.db.IsTokenRevoked(ctx, claims.ID)
+			if err != nil {
+				writeError(w, http.StatusInternalServerError, "failed to check token")
+				return
+			}
+			if revoked {
+				writeError(w, http.StatusUnauthorized, "token revoked")
+				return
+			}
+		}
+
 		ctx = context.WithValue(ctx, ctxUserClaims, claims)
 		ctx = context.WithValue(ctx, ctxActorType, "user")
 		ctx = context.WithValue(ctx, ctxActorID, claims.UserID)
@@ -296,6 +348,46 @@ func (s *Server) authMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+// serviceAccountByToken returns the service account of a token without its
+// "sa." prefix. A token with a token ID is looked up by it and checked against
+// a single hash; a legacy token is compared with every account that still has
+// one.
+func (s *Server) serviceAccountByToken(ctx context.Context, rawToken string) (*db.ServiceAccount, error) {
+	tokenID, secret, ok := auth.SplitServiceAccountToken(rawToken)
+	if !ok {
+		return s.db.FindServiceAccountByToken(ctx, func(hash string) bool {
+			return s.auth.ValidateServiceAccountToken(secret, hash) == nil
+		})
+	}
+	sa, err := s.db.GetServiceAccountByTokenID(ctx, tokenID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.auth.ValidateServiceAccountToken(secret, sa.TokenHash); err != nil {
+		return nil, err
+	}
+	return sa, nil
+}
+
+// agentByToken is serviceAccountByToken for agent tokens, without their
+// "agent." prefix.
+func (s *Server) agentByToken(ctx context.Context, rawToken string) (*db.Agent, error) {
+	tokenID, secret, ok := auth.SplitServiceAccountToken(rawToken)
+	if !ok {
+		return s.db.FindAgentByToken(ctx, func(hash string) bool {
+			return s.auth.ValidateServiceAccountToken(secret, hash) == nil
+		})
+	}
+	agent, err := s.db.GetAgentByTokenID(ctx, tokenID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.auth.ValidateServiceAccountToken(secret, agent.TokenHash); err != nil {
+		return nil, err
+	}
+	return agent, nil
+}
+
 // getUserClaims extracts user claims from context.
 func getUserClaims(ctx context.Context) *auth.Claims {
 	claims, _ := ctx.Value(ctxUserClaims).(*auth.Claims)
@@ -308,6 +400,25 @@ func getSAClaims(ctx context.Context) *auth.ServiceAccountClaims {
 	return claims
 }
 
+// getAgentClaims extracts agent claims from context.
+func getAgentClaims(ctx context.Context) *auth.AgentClaims {
+	claims, _ := ctx.Value(ctxAgentClaims).(*auth.AgentClaims)
+	return claims
+}
+
+// tokenScopes returns the scopes of the service account or agent token the
+// caller authenticated with, and the kind of token for error messages. ok is
+// false for users, who have no scopes.
+func tokenScopes(ctx context.Context) (scopes []string, kind string, ok bool) {
+	if claims := getSAClaims(ctx); claims != nil {
+		return claims.Scopes, "service account", true
+	}
+	if claims := getAgentClaims(ctx); claims != nil {
+		return claims.Scopes, "agent", true
+	}
+	return nil, "", false
+}
+
 // getActorType returns the actor type from context.
 func getActorType(ctx context.Context) string {
 	t, _ := ctx.Value(ctxActorType).(string)
@@ -94,8 +94,19 @@ func (s *Server) handleOIDCCallback(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	// Users with MFA enabled still need their second factor
+	challenge, err := s.mfaChallenge(ctx, user, "oidc")
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to start login")
+		return
+	}
+	if challenge != nil {
+		writeJSON(w, http.StatusOK, challenge)
+		return
+	}
+
 	// Generate JWT token
-	token, err := s.auth.GenerateJWT(user.ID, user.Email, user.Role)
+	tokens, err := s.startSession(r, user, []string{"oidc"}, false)
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, "failed to generate token")
 		return
@@ -112,7 +123,9 @@ func (s *Server) handleOIDCCallback(w http.ResponseWriter, r *http.Request) {
 	})
 
 	writeJSON(w, http.StatusOK, map[string]interface{}{
-		"user":  user,
-		"token": token,
+		"user":          user,
+		"token":         tokens.Token,
+		"refresh_token": tokens.RefreshToken,
+		"expires_at":    tokens.ExpiresAt,
 	})
 }
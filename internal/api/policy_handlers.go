@@ -43,8 +43,8 @@ func (s *Server) handleCreatePolicy(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusBadRequest, "effect must be 'allow' or 'deny'")
 		return
 	}
-	if req.SubjectType != "user" && req.SubjectType != "service_account" {
-		writeError(w, http.StatusBadRequest, "subject_type must be 'user' or 'service_account'")
+	if req.SubjectType != "user" && req.SubjectType != "service_account" && req.SubjectType != "agent" {
+		writeError(w, http.StatusBadRequest, "subject_type must be 'user', 'service_account' or 'agent'")
 		return
 	}
 
@@ -1,6 +1,7 @@
 package api
 
 import (
+	"encoding/json"
 	"net/http"
 	"strings"
 
@@ -9,8 +10,9 @@ import (
 )
 
 type createProjectRequest struct {
-	Name        string `json:"name"`
-	Description string `json:"description"`
+	Name           string `json:"name"`
+	Description    string `json:"description"`
+	EncryptionMode string `json:"encryption_mode"` // "server" (default) or "e2e"; fixed at creation
 }
 
 func (s *Server) handleCreateProject(w http.ResponseWriter, r *http.Request) {
@@ -31,7 +33,15 @@ func (s *Server) handleCreateProject(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	project, err := s.db.CreateProject(r.Context(), req.Name, req.Description, claims.UserID)
+	if req.EncryptionMode == "" {
+		req.EncryptionMode = db.EncryptionModeServer
+	}
+	if req.EncryptionMode != db.EncryptionModeServer && req.EncryptionMode != db.EncryptionModeE2E {
+		writeError(w, http.StatusBadRequest, "encryption_mode must be 'server' or 'e2e'")
+		return
+	}
+
+	project, err := s.db.CreateProject(r.Context(), req.Name, req.Description, req.EncryptionMode, claims.UserID)
 	if err != nil {
 		if strings.Contains(err.Error(), "duplicate") || strings.Contains(err.Error(), "unique") {
 			writeError(w, http.StatusConflict, "project name already exists")
@@ -48,11 +58,136 @@ func (s *Server) handleCreateProject(w http.ResponseWriter, r *http.Request) {
 		Resource:  project.Name,
 		Outcome:   "success",
 		IP:        getClientIP(r.Context()),
+		Metadata:  json.RawMessage(`{"encryption_mode":"` + project.EncryptionMode + `"}`),
 	})
 
 	writeJSON(w, http.StatusCreated, project)
 }
 
+type updateProjectRequest struct {
+	RequireCAS    *bool   `json:"require_cas,omitempty"`
+	MaxVersions   *int    `json:"max_versions,omitempty"`    // versions kept per secret, 0 = unlimited
+	MaxVersionAge *string `json:"max_version_age,omitempty"` // e.g. "2160h", "0" = unlimited
+	OrgID         *string `json:"org_id,omitempty"`          // org whose IAM policies apply to the project
+	// Replaces the environments, in promotion order; [] removes them all
+	Environments []db.Environment `json:"environments,omitempty"`
+	// Replaces the approval rules (two-person approval); [] removes them all
+	ApprovalRules []db.ApprovalRule `json:"approval_rules,omitempty"`
+	// Replaces the teams whose leads approve access requests; [] removes them all
+	AccessTeams []string `json:"access_teams,omitempty"`
+}
+
+// handleUpdateProject changes project settings. Only the project creator or
+// an admin may do so.
+// PATCH /api/v1/projects/{project}
+func (s *Server) handleUpdateProject(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claims := getUserClaims(ctx)
+	if claims == nil {
+		writeError(w, http.StatusUnauthorized, "user authentication required")
+		return
+	}
+
+	project, err := s.db.GetProjectByName(ctx, r.PathValue("project"))
+	if err != nil {
+		writeError(w, http.StatusNotFound, "project not found")
+		return
+	}
+	if project.CreatedBy != claims.UserID && claims.Role != "admin" {
+		writeError(w, http.StatusForbidden, "only the project creator or an admin can change project settings")
+		return
+	}
+
+	var req updateProjectRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	settings := db.ProjectSettings{RequireCAS: req.RequireCAS}
+	if req.MaxVersions != nil {
+		if *req.MaxVersions < 0 {
+			writeError(w, http.StatusBadRequest, "max_versions must not be negative")
+			return
+		}
+		settings.MaxVersions = req.MaxVersions
+	}
+	if req.MaxVersionAge != nil {
+		seconds, msg := parseVersionAge(*req.MaxVersionAge)
+		if msg != "" {
+			writeError(w, http.StatusBadRequest, msg)
+			return
+		}
+		settings.MaxVersionAgeSeconds = &seconds
+	}
+	if req.OrgID != nil {
+		org, err := s.db.GetOrgByID(ctx, *req.OrgID)
+		if err != nil {
+			writeError(w, http.StatusNotFound, "organization not found")
+			return
+		}
+		// Attaching subjects the project to the org's policies and teams, so
+		// it takes the org's creator; moving between orgs takes an admin
+		if project.OrgID != "" && project.OrgID != org.ID && claims.Role != "admin" {
+			writeError(w, http.StatusForbidden, "only an admin can move a project to another organization")
+			return
+		}
+		if org.CreatedBy != claims.UserID && claims.Role != "admin" {
+			writeError(w, http.StatusForbidden, "only the organization's creator or an admin can attach projects to it")
+			return
+		}
+		settings.OrgID = req.OrgID
+	}
+	if req.Environments != nil {
+		if msg := validateEnvironments(req.Environments); msg != "" {
+			writeError(w, http.StatusBadRequest, msg)
+			return
+		}
+		settings.Environments = req.Environments
+	}
+	if req.ApprovalRules != nil {
+		orgID := project.OrgID
+		if req.OrgID != nil {
+			orgID = *req.OrgID
+		}
+		if msg := s.validateApprovalRules(ctx, orgID, req.ApprovalRules); msg != "" {
+			writeError(w, http.StatusBadRequest, msg)
+			return
+		}
+		settings.ApprovalRules = req.ApprovalRules
+	}
+	if req.AccessTeams != nil {
+		orgID := project.OrgID
+		if req.OrgID != nil {
+			orgID = *req.OrgID
+		}
+		if msg := s.validateAccessTeams(ctx, orgID, req.AccessTeams); msg != "" {
+			writeError(w, http.StatusBadRequest, msg)
+			return
+		}
+		settings.AccessTeams = req.AccessTeams
+	}
+
+	project, err = s.db.UpdateProjectSettings(ctx, project.ID, settings)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to update project")
+		return
+	}
+
+	metadata, _ := json.Marshal(req)
+	s.audit.Log(ctx, audit.Event{
+		ActorType: "user",
+		ActorID:   claims.UserID,
+		Action:    "project.update",
+		Resource:  project.Name,
+		Outcome:   "success",
+		IP:        getClientIP(ctx),
+		Metadata:  metadata,
+	})
+
+	writeJSON(w, http.StatusOK, project)
+}
+
 func (s *Server) handleListProjects(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	claims := getUserClaims(ctx)
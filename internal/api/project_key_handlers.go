@@ -0,0 +1,151 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/teamvault/teamvault/internal/audit"
+	"github.com/teamvault/teamvault/internal/crypto"
+	"github.com/teamvault/teamvault/internal/db"
+)
+
+// encryptForProject encrypts a value belonging to a project. The DEK is
+// wrapped by the project's KEK, or by the master key if no KEK manager is
+// configured.
+func (s *Server) encryptForProject(ctx context.Context, projectID string, plaintext []byte, ectx *crypto.EncryptionContext) (*crypto.EncryptedData, error) {
+	if s.kekManager == nil {
+		return s.crypto.Encrypt(plaintext, ectx)
+	}
+	return s.kekManager.Encrypt(ctx, projectID, plaintext, ectx)
+}
+
+// decryptForProject decrypts a value belonging to a project.
+func (s *Server) decryptForProject(ctx context.Context, projectID string, data *crypto.EncryptedData, ectx *crypto.EncryptionContext) ([]byte, error) {
+	noteProjectRead(ctx, projectID)
+	if s.kekManager == nil {
+		return s.crypto.Decrypt(data, ectx)
+	}
+	return s.kekManager.Decrypt(ctx, projectID, data, ectx)
+}
+
+// projectKEK loads KEK version of a project for callers that decrypt
+// elsewhere, such as the TEE enclave. It returns nil for version 0.
+func (s *Server) projectKEK(ctx context.Context, projectID string, version int) (*crypto.KEK, error) {
+	if s.kekManager == nil || version == 0 {
+		return nil, nil
+	}
+	return s.kekManager.ForVersion(ctx, projectID, version)
+}
+
+// handleListProjectKeys lists a project's KEK versions (metadata only).
+// GET /api/v1/projects/{project}/keys
+func (s *Server) handleListProjectKeys(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if s.kekManager == nil {
+		writeError(w, http.StatusServiceUnavailable, "project keys not available")
+		return
+	}
+
+	project, err := s.db.GetProjectByName(ctx, r.PathValue("project"))
+	if err != nil {
+		writeError(w, http.StatusNotFound, "project not found")
+		return
+	}
+
+	keys, err := s.kekManager.Keys(ctx, project.ID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to list project keys")
+		return
+	}
+	if keys == nil {
+		keys = []db.ProjectKey{}
+	}
+
+	writeJSON(w, http.StatusOK, keys)
+}
+
+// handleRekeyProject creates a new KEK version for a project, re-wraps all of
+// its DEKs and destroys the previous versions.
+// POST /api/v1/projects/{project}/rekey
+func (s *Server) handleRekeyProject(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if s.kekManager == nil {
+		writeError(w, http.StatusServiceUnavailable, "project keys not available")
+		return
+	}
+
+	project, err := s.db.GetProjectByName(ctx, r.PathValue("project"))
+	if err != nil {
+		writeError(w, http.StatusNotFound, "project not found")
+		return
+	}
+
+	result, err := s.kekManager.Rekey(ctx, project.ID)
+	if err != nil {
+		if isDBConflictError(err) {
+			writeError(w, http.StatusConflict, "project is already being re-keyed")
+			return
+		}
+		s.audit.Log(ctx, audit.Event{
+			ActorType: getActorType(ctx),
+			ActorID:   getActorID(ctx),
+			Action:    "project.rekey",
+			Resource:  project.Name,
+			Outcome:   "error",
+			IP:        getClientIP(ctx),
+		})
+		writeError(w, http.StatusInternalServerError, "failed to re-key project")
+		return
+	}
+
+	outcome := "success"
+	if result.Failed > 0 {
+		outcome = "error"
+	}
+	meta, _ := json.Marshal(result)
+	s.audit.Log(ctx, audit.Event{
+		ActorType: getActorType(ctx),
+		ActorID:   getActorID(ctx),
+		Action:    "project.rekey",
+		Resource:  project.Name,
+		Outcome:   outcome,
+		IP:        getClientIP(ctx),
+		Metadata:  meta,
+	})
+
+	writeJSON(w, http.StatusOK, result)
+}
+
+// handleDeleteProject deletes a project and crypto-shreds its data: all KEK
+// versions are destroyed, so no secret version or lease of the project can
+// be decrypted again.
+// DELETE /api/v1/projects/{project}
+func (s *Server) handleDeleteProject(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	project, err := s.db.GetProjectByName(ctx, r.PathValue("project"))
+	if err != nil {
+		writeError(w, http.StatusNotFound, "project not found")
+		return
+	}
+
+	result, err := s.db.ShredProject(ctx, project.ID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to delete project")
+		return
+	}
+
+	meta, _ := json.Marshal(result)
+	s.audit.Log(ctx, audit.Event{
+		ActorType: getActorType(ctx),
+		ActorID:   getActorID(ctx),
+		Action:    "project.delete",
+		Resource:  project.Name,
+		Outcome:   "success",
+		IP:        getClientIP(ctx),
+		Metadata:  meta,
+	})
+
+	writeJSON(w, http.StatusOK, result)
+}
@@ -0,0 +1,153 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/teamvault/teamvault/internal/audit"
+	"github.com/teamvault/teamvault/internal/db"
+	"github.com/teamvault/teamvault/internal/refs"
+)
+
+// refError is a failure to read a referenced secret, with the HTTP status
+// the read of the referencing secret fails with.
+type refError struct {
+	status int
+	msg    string
+}
+
+func (e *refError) Error() string { return e.msg }
+
+// renderSecretValue resolves the ${ref:...} references in a decrypted value
+// of the secret self, from the latest versions of the referenced secrets.
+// Each referenced path is authorized, against policy and the scopes of the
+// caller's token, and audited as a read by the caller.
+// cache holds values already looked up for this request and may be nil. On
+// failure it returns the HTTP status and error message to send.
+func (s *Server) renderSecretValue(ctx context.Context, self refs.Ref, value string, cache map[string]string) (string, int, string) {
+	if !refs.Contains(value) {
+		return value, 0, ""
+	}
+	if cache == nil {
+		cache = make(map[string]string)
+	}
+
+	lookup := func(r refs.Ref) (string, error) {
+		if v, ok := cache[r.String()]; ok {
+			return v, nil
+		}
+		resource := fieldResource(r.Project+"/"+r.Path, r.Field)
+
+		policyReq, err := s.secretPolicyRequest(ctx, "read", r.Project, r.Path, nil)
+		if err != nil {
+			return "", &refError{http.StatusInternalServerError, "failed to load project"}
+		}
+		policyResult, err := s.evaluateFieldPolicy(ctx, policyReq, r.Field)
+		if err != nil {
+			return "", &refError{http.StatusInternalServerError, "policy evaluation failed"}
+		}
+		if !policyResult.Allowed {
+			s.audit.Log(ctx, audit.Event{
+				ActorType: getActorType(ctx),
+				ActorID:   getActorID(ctx),
+				Action:    "secret.read",
+				Resource:  resource,
+				Outcome:   "denied",
+				IP:        getClientIP(ctx),
+				Metadata:  json.RawMessage(`{"reason":"` + policyResult.Reason + `","via":"` + self.String() + `"}`),
+			})
+			return "", &refError{http.StatusForbidden, policyResult.Reason}
+		}
+		if scopes, kind, ok := tokenScopes(ctx); ok && !scopeAllows(scopes, "read", r.Project+"/"+r.Path) {
+			return "", &refError{http.StatusForbidden, kind + " lacks read scope"}
+		}
+		grantID := policyResult.GrantID
+
+		project, err := s.db.GetProjectByName(ctx, r.Project)
+		if err != nil {
+			return "", &refError{http.StatusUnprocessableEntity, "project not found"}
+		}
+		secret, err := s.db.GetSecret(ctx, project.ID, r.Path)
+		if err != nil {
+			// Follow the alias of a moved secret, or inherit from a parent
+			// environment, as a direct read would
+			aliasProject, aliased := s.secretAlias(ctx, project, r.Path)
+			if aliased == nil {
+				if aliased = s.inheritedSecret(ctx, project, r.Path); aliased == nil {
+					return "", &refError{http.StatusUnprocessableEntity, "secret not found"}
+				}
+				aliasProject = project
+			}
+			policyResult, err := s.evaluateFieldPolicy(ctx, s.projectPolicyRequest(ctx, "read", aliasProject, aliased.Path, aliased.Labels), r.Field)
+			if err != nil {
+				return "", &refError{http.StatusInternalServerError, "policy evaluation failed"}
+			}
+			if !policyResult.Allowed {
+				s.audit.Log(ctx, audit.Event{
+					ActorType: getActorType(ctx),
+					ActorID:   getActorID(ctx),
+					Action:    "secret.read",
+					Resource:  fieldResource(aliasProject.Name+"/"+aliased.Path, r.Field),
+					Outcome:   "denied",
+					IP:        getClientIP(ctx),
+					Metadata:  json.RawMessage(`{"reason":"` + policyResult.Reason + `","via":"` + self.String() + `"}`),
+				})
+				return "", &refError{http.StatusForbidden, policyResult.Reason}
+			}
+			if scopes, kind, ok := tokenScopes(ctx); ok && !scopeAllows(scopes, "read", aliasProject.Name+"/"+aliased.Path) {
+				return "", &refError{http.StatusForbidden, kind + " lacks read scope"}
+			}
+			if policyResult.GrantID != "" {
+				grantID = policyResult.GrantID
+			}
+			project, secret = aliasProject, aliased
+		}
+		sv, err := s.db.GetLatestSecretVersion(ctx, secret.ID)
+		if err != nil || sv.DestroyedAt != nil {
+			return "", &refError{http.StatusUnprocessableEntity, "secret has no readable version"}
+		}
+		v, encryption, err := s.secretValue(ctx, project, secret, sv)
+		if err != nil {
+			return "", &refError{http.StatusInternalServerError, "decryption failed"}
+		}
+		if encryption == db.EncryptionModeE2E {
+			return "", &refError{http.StatusUnprocessableEntity, "end-to-end encrypted secrets cannot be referenced"}
+		}
+		if r.Field != "" {
+			var status int
+			var msg string
+			if v, status, msg = secretField(secret, v, encryption, r.Field); msg != "" {
+				if status != http.StatusInternalServerError {
+					status = http.StatusUnprocessableEntity
+				}
+				return "", &refError{status, msg}
+			}
+		}
+
+		// Audit the read (NEVER log the secret value)
+		s.audit.Log(ctx, audit.Event{
+			ActorType: getActorType(ctx),
+			ActorID:   getActorID(ctx),
+			Action:    "secret.read",
+			Resource:  resource,
+			Outcome:   "success",
+			IP:        getClientIP(ctx),
+			Metadata:  json.RawMessage(`{"version":` + itoa(sv.Version) + `,"via":"` + self.String() + `"` + grantMeta(grantID) + `}`),
+		})
+
+		cache[r.String()] = v
+		return v, nil
+	}
+
+	rendered, err := refs.Render(self, value, lookup)
+	if err != nil {
+		var re *refError
+		if errors.As(err, &re) {
+			return "", re.status, err.Error()
+		}
+		return "", http.StatusUnprocessableEntity, err.Error()
+	}
+	return rendered, 0, ""
+}
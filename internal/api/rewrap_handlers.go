@@ -0,0 +1,63 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/teamvault/teamvault/internal/rewrap"
+)
+
+// rewrapStatusResponse describes the master keyring and re-wrap progress.
+type rewrapStatusResponse struct {
+	KeyProvider       string               `json:"key_provider"`
+	CurrentKeyVersion int                  `json:"current_key_version"`
+	KeyVersions       []int                `json:"key_versions"`
+	Pending           rewrap.PendingCounts `json:"pending"`
+	Job               rewrap.Progress      `json:"job"`
+}
+
+// handleRewrapStatus reports keyring versions, how many DEKs are still wrapped
+// by older master keys, and the progress of the current or last re-wrap run.
+// GET /api/v1/sys/rewrap
+func (s *Server) handleRewrapStatus(w http.ResponseWriter, r *http.Request) {
+	if s.rewrapJob == nil {
+		writeError(w, http.StatusServiceUnavailable, "re-wrap job not available")
+		return
+	}
+
+	pending, err := s.rewrapJob.Pending(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to count pending DEKs")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, rewrapStatusResponse{
+		KeyProvider:       s.crypto.Provider().Name(),
+		CurrentKeyVersion: s.crypto.CurrentKeyVersion(),
+		KeyVersions:       s.crypto.KeyVersions(),
+		Pending:           pending,
+		Job:               s.rewrapJob.Status(),
+	})
+}
+
+// handleStartRewrap starts re-wrapping every DEK under the newest master key.
+// POST /api/v1/sys/rewrap
+func (s *Server) handleStartRewrap(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if s.rewrapJob == nil {
+		writeError(w, http.StatusServiceUnavailable, "re-wrap job not available")
+		return
+	}
+
+	progress, err := s.rewrapJob.Start(ctx, getActorType(ctx), getActorID(ctx), getClientIP(ctx))
+	if err != nil {
+		if errors.Is(err, rewrap.ErrAlreadyRunning) {
+			writeError(w, http.StatusConflict, err.Error())
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "failed to start re-wrap")
+		return
+	}
+
+	writeJSON(w, http.StatusAccepted, progress)
+}
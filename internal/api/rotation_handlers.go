@@ -83,6 +83,10 @@ func (s *Server) handleSetRotation(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusNotFound, "project not found")
 		return
 	}
+	if project.IsE2E() {
+		writeError(w, http.StatusConflict, rotation.ErrE2EProject.Error())
+		return
+	}
 
 	secret, err := s.db.GetSecret(ctx, project.ID, secretPath)
 	if err != nil {
@@ -192,6 +196,14 @@ func (s *Server) handleManualRotate(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusNotFound, "project not found")
 		return
 	}
+	if project.IsE2E() {
+		writeError(w, http.StatusConflict, rotation.ErrE2EProject.Error())
+		return
+	}
+	if reason := s.protectedPathReason(ctx, project, secretPath, "rotation.manual"); reason != "" {
+		writeError(w, http.StatusForbidden, reason)
+		return
+	}
 
 	secret, err := s.db.GetSecret(ctx, project.ID, secretPath)
 	if err != nil {
@@ -0,0 +1,207 @@
+package api
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/teamvault/teamvault/internal/audit"
+	"github.com/teamvault/teamvault/internal/seal"
+)
+
+type initRequest struct {
+	SecretShares    int `json:"secret_shares"`
+	SecretThreshold int `json:"secret_threshold"`
+}
+
+type initResponse struct {
+	Shares          []string `json:"shares"`
+	SecretShares    int      `json:"secret_shares"`
+	SecretThreshold int      `json:"secret_threshold"`
+}
+
+type unsealRequest struct {
+	Share string `json:"share"`
+	Reset bool   `json:"reset"`
+}
+
+// unsealedOnly rejects requests with 503 while the vault is sealed.
+// Wrap every route that needs to encrypt or decrypt secret material.
+func (s *Server) unsealedOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.sealManager != nil && s.sealManager.Sealed() {
+			writeError(w, http.StatusServiceUnavailable, "vault is sealed")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// handleSealStatus reports whether the vault is initialized and sealed.
+// GET /api/v1/sys/seal-status
+func (s *Server) handleSealStatus(w http.ResponseWriter, r *http.Request) {
+	if s.sealManager == nil {
+		writeJSON(w, http.StatusOK, seal.Status{Initialized: true, Sealed: false})
+		return
+	}
+	writeJSON(w, http.StatusOK, s.sealManager.Status())
+}
+
+// handleInit seals the master keyring under a new root key and returns the
+// root key's Shamir shares. The shares are shown exactly once.
+// POST /api/v1/sys/init
+func (s *Server) handleInit(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if s.sealManager == nil {
+		writeError(w, http.StatusServiceUnavailable, "seal mode not enabled (set KEY_PROVIDER=shamir)")
+		return
+	}
+
+	var req initRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if req.SecretShares == 0 {
+		req.SecretShares = 5
+	}
+	if req.SecretThreshold == 0 {
+		req.SecretThreshold = 3
+	}
+
+	shares, err := s.sealManager.Init(ctx, req.SecretShares, req.SecretThreshold, getActorID(ctx))
+	if err != nil {
+		if errors.Is(err, seal.ErrAlreadyInitialized) || strings.Contains(err.Error(), "already initialized") {
+			writeError(w, http.StatusConflict, "vault is already initialized")
+			return
+		}
+		if strings.Contains(err.Error(), "invalid share configuration") {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "failed to initialize vault")
+		return
+	}
+
+	resp := initResponse{
+		Shares:          make([]string, len(shares)),
+		SecretShares:    req.SecretShares,
+		SecretThreshold: req.SecretThreshold,
+	}
+	for i, share := range shares {
+		resp.Shares[i] = hex.EncodeToString(share)
+	}
+
+	s.audit.Log(ctx, audit.Event{
+		ActorType: getActorType(ctx),
+		ActorID:   getActorID(ctx),
+		Action:    "sys.init",
+		Resource:  "sys/seal",
+		Outcome:   "success",
+		IP:        getClientIP(ctx),
+		Metadata:  json.RawMessage(fmt.Sprintf(`{"secret_shares":%d,"secret_threshold":%d}`, req.SecretShares, req.SecretThreshold)),
+	})
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// handleUnseal accepts one unseal share. Every attempt is audited.
+// POST /api/v1/sys/unseal
+func (s *Server) handleUnseal(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if s.sealManager == nil {
+		writeError(w, http.StatusServiceUnavailable, "seal mode not enabled (set KEY_PROVIDER=shamir)")
+		return
+	}
+
+	var req unsealRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	logAttempt := func(outcome, reason string, st seal.Status) {
+		meta, _ := json.Marshal(map[string]interface{}{
+			"reason":    reason,
+			"progress":  st.Progress,
+			"threshold": st.Threshold,
+			"sealed":    st.Sealed,
+		})
+		s.audit.Log(ctx, audit.Event{
+			ActorType: getActorType(ctx),
+			ActorID:   getActorID(ctx),
+			Action:    "sys.unseal",
+			Resource:  "sys/seal",
+			Outcome:   outcome,
+			IP:        getClientIP(ctx),
+			Metadata:  meta,
+		})
+	}
+
+	if req.Reset {
+		st := s.sealManager.ResetUnseal()
+		logAttempt("success", "reset", st)
+		writeJSON(w, http.StatusOK, st)
+		return
+	}
+
+	share, err := hex.DecodeString(strings.TrimSpace(req.Share))
+	if err != nil || len(share) < 2 {
+		logAttempt("denied", "malformed_share", s.sealManager.Status())
+		writeError(w, http.StatusBadRequest, "share must be a hex-encoded unseal share")
+		return
+	}
+
+	st, err := s.sealManager.Unseal(share)
+	if err != nil {
+		switch {
+		case errors.Is(err, seal.ErrNotInitialized):
+			logAttempt("error", "not_initialized", st)
+			writeError(w, http.StatusBadRequest, "vault is not initialized")
+		case errors.Is(err, seal.ErrInvalidShares):
+			logAttempt("denied", "invalid_shares", st)
+			writeError(w, http.StatusBadRequest, "unseal failed: shares are invalid, progress reset")
+		case strings.Contains(err.Error(), "already submitted"):
+			logAttempt("denied", "duplicate_share", st)
+			writeError(w, http.StatusBadRequest, "share already submitted")
+		default:
+			logAttempt("error", "internal", st)
+			writeError(w, http.StatusInternalServerError, "unseal failed")
+		}
+		return
+	}
+
+	reason := "share_accepted"
+	if !st.Sealed {
+		reason = "unsealed"
+	}
+	logAttempt("success", reason, st)
+	writeJSON(w, http.StatusOK, st)
+}
+
+// handleSeal drops the master keyring from memory. Secret endpoints return
+// 503 until the vault is unsealed again.
+// POST /api/v1/sys/seal
+func (s *Server) handleSeal(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if s.sealManager == nil {
+		writeError(w, http.StatusServiceUnavailable, "seal mode not enabled (set KEY_PROVIDER=shamir)")
+		return
+	}
+
+	st := s.sealManager.Seal()
+
+	s.audit.Log(ctx, audit.Event{
+		ActorType: getActorType(ctx),
+		ActorID:   getActorID(ctx),
+		Action:    "sys.seal",
+		Resource:  "sys/seal",
+		Outcome:   "success",
+		IP:        getClientIP(ctx),
+	})
+
+	writeJSON(w, http.StatusOK, st)
+}
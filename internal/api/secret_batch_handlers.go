@@ -0,0 +1,485 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/teamvault/teamvault/internal/audit"
+	"github.com/teamvault/teamvault/internal/db"
+	"github.com/teamvault/teamvault/internal/jsonfield"
+	"github.com/teamvault/teamvault/internal/labels"
+	"github.com/teamvault/teamvault/internal/refs"
+)
+
+// maxBatchSize is the most secrets a single batch request may read or write.
+const maxBatchSize = 500
+
+type batchGetRequest struct {
+	Paths []string `json:"paths"`
+	Raw   bool     `json:"raw,omitempty"` // return values as stored, with references unresolved
+}
+
+type batchPutItem struct {
+	Path        string            `json:"path"`
+	Value       string            `json:"value"`
+	Description string            `json:"description,omitempty"`
+	Type        string            `json:"type,omitempty"`
+	Filename    string            `json:"filename,omitempty"`
+	ContentType string            `json:"content_type,omitempty"`
+	CAS         *int              `json:"cas,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"` // replace the secret's labels if set
+}
+
+type batchPutRequest struct {
+	Secrets []batchPutItem `json:"secrets"`
+}
+
+// batchResult is the outcome of one item of a batch request. Status is the
+// HTTP status the item would have had as a single request.
+type batchResult struct {
+	Path       string `json:"path"`
+	Status     int    `json:"status"`
+	Error      string `json:"error,omitempty"`
+	Version    int    `json:"version,omitempty"`
+	Value      string `json:"value,omitempty"`
+	Encryption string `json:"encryption,omitempty"` // "e2e": value is a base64 client-encrypted blob
+	SecretType string `json:"secret_type,omitempty"`
+	MovedTo    string `json:"moved_to,omitempty"` // "project/path" the secret was read from, via an alias
+	// "project/path" in a parent environment the value is inherited from
+	InheritedFrom string `json:"inherited_from,omitempty"`
+}
+
+// handleSecretsBatch dispatches the batch endpoints of a project.
+// POST /api/v1/secrets/{project}:batchGet
+// POST /api/v1/secrets/{project}:batchPut
+func (s *Server) handleSecretsBatch(w http.ResponseWriter, r *http.Request) {
+	project, method, _ := strings.Cut(r.PathValue("project"), ":")
+	switch method {
+	case "batchGet":
+		s.handleBatchGetSecrets(w, r, project)
+	case "batchPut":
+		s.handleBatchPutSecrets(w, r, project)
+	default:
+		writeError(w, http.StatusNotFound, "use POST /api/v1/secrets/{project}:batchGet or :batchPut")
+	}
+}
+
+// authorizeBatchItem evaluates policy for one secret of a batch, or one field
+// of it, auditing a denial under auditAction. secretLabels are as for
+// projectPolicyRequest. Items outside the scopes of a service account or agent
+// token are refused too, as are writes to paths protected by an approval rule,
+// as batches cannot open change requests. It returns an empty string
+// if the item is allowed, otherwise the reason.
+func (s *Server) authorizeBatchItem(ctx context.Context, action, auditAction string, project *db.Project, path, field string, secretLabels map[string]string) (string, error) {
+	reason, _, err := s.authorizeBatchItemGrant(ctx, action, auditAction, project, path, field, secretLabels)
+	return reason, err
+}
+
+// authorizeBatchItemGrant is authorizeBatchItem that also returns the access
+// grant that allowed the item, if one did, for the audit entry of the read.
+func (s *Server) authorizeBatchItemGrant(ctx context.Context, action, auditAction string, project *db.Project, path, field string, secretLabels map[string]string) (string, string, error) {
+	resource := fieldResource(project.Name+"/"+path, field)
+	policyResult, err := s.evaluateFieldPolicy(ctx, s.projectPolicyRequest(ctx, action, project, path, secretLabels), field)
+	if err != nil {
+		return "", "", err
+	}
+	if policyResult.Allowed {
+		if scopes, kind, ok := tokenScopes(ctx); ok && !scopeAllows(scopes, action, project.Name+"/"+path) {
+			return kind + " lacks " + action + " scope", "", nil
+		}
+		if action == "write" {
+			return s.protectedPathReason(ctx, project, path, auditAction), "", nil
+		}
+		return "", policyResult.GrantID, nil
+	}
+	s.audit.Log(ctx, audit.Event{
+		ActorType: getActorType(ctx),
+		ActorID:   getActorID(ctx),
+		Action:    auditAction,
+		Resource:  resource,
+		Outcome:   "denied",
+		IP:        getClientIP(ctx),
+		Metadata:  json.RawMessage(`{"reason":"` + policyResult.Reason + `","batch":true}`),
+	})
+	return policyResult.Reason, "", nil
+}
+
+// checkBatchPaths validates the paths of a batch request: present, within the
+// size limit and without duplicates. It returns an error message or "".
+func checkBatchPaths(paths []string) string {
+	if len(paths) == 0 {
+		return "at least one secret is required"
+	}
+	if len(paths) > maxBatchSize {
+		return "at most " + itoa(maxBatchSize) + " secrets per batch"
+	}
+	seen := make(map[string]bool, len(paths))
+	for _, p := range paths {
+		if p == "" {
+			return "every secret needs a path"
+		}
+		if seen[p] {
+			return "duplicate path " + p
+		}
+		seen[p] = true
+	}
+	return ""
+}
+
+// handleBatchGetSecrets reads the latest version of several secrets of a
+// project from one consistent snapshot. A path may name one field of a JSON
+// secret as "path#field". Policy is evaluated per path; denied or missing
+// secrets are reported in their result without failing the batch. Unless raw
+// is set, references in the values are resolved to the latest versions of the
+// secrets they name. Paths left behind by a move with an alias are read from
+// where the secret is now, outside the snapshot; keys a child environment
+// does not define are read from its ancestors.
+func (s *Server) handleBatchGetSecrets(w http.ResponseWriter, r *http.Request, projectName string) {
+	ctx := r.Context()
+
+	if scopes, kind, ok := tokenScopes(ctx); ok {
+		if !scopeAllows(scopes, "read", "") {
+			writeError(w, http.StatusForbidden, kind+" lacks read scope")
+			return
+		}
+	}
+
+	var req batchGetRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if msg := checkBatchPaths(req.Paths); msg != "" {
+		writeError(w, http.StatusBadRequest, msg)
+		return
+	}
+
+	project, err := s.db.GetProjectByName(ctx, projectName)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "project not found")
+		return
+	}
+
+	// Keys of child environments may be inherited, so read the same keys of
+	// their ancestors too
+	paths := make([]string, 0, len(req.Paths))
+	for _, ref := range req.Paths {
+		path, _ := jsonfield.Split(ref)
+		paths = append(paths, path)
+		if env, key := project.SplitEnvironment(path); env != "" {
+			for _, ancestor := range project.EnvironmentAncestors(env) {
+				paths = append(paths, ancestor+"/"+key)
+			}
+		}
+	}
+
+	// Read everything first so policy sees the labels of the same snapshot;
+	// values are only decrypted for the secrets the caller may read
+	secrets, err := s.db.GetLatestSecretVersions(ctx, project.ID, paths)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to read secrets")
+		return
+	}
+
+	results := make([]batchResult, len(req.Paths))
+	resolved := make(map[string]string)
+	for i, ref := range req.Paths {
+		res := &results[i]
+		res.Path = ref
+		path, field := jsonfield.Split(ref)
+		if field != "" {
+			if err := jsonfield.Validate(field); err != nil {
+				res.Status = http.StatusBadRequest
+				res.Error = err.Error()
+				continue
+			}
+		}
+
+		sv, ok := secrets[path]
+		secretProject, movedTo, inheritedFrom := project, "", ""
+		if !ok {
+			if aliasProject, aliased := s.secretAlias(ctx, project, path); aliased != nil {
+				if latest, err := s.db.GetLatestSecretVersion(ctx, aliased.ID); err == nil {
+					sv, ok = db.SecretWithVersion{Secret: aliased, Version: latest}, true
+					secretProject, movedTo = aliasProject, aliasProject.Name+"/"+aliased.Path
+				}
+			}
+		}
+		if env, key := project.SplitEnvironment(path); !ok && env != "" {
+			for _, ancestor := range project.EnvironmentAncestors(env) {
+				if sv, ok = secrets[ancestor+"/"+key]; ok {
+					inheritedFrom = project.Name + "/" + sv.Secret.Path
+					break
+				}
+			}
+		}
+		secretLabels := map[string]string{}
+		if ok {
+			secretLabels = sv.Secret.Labels
+		}
+		reason, grantID, err := s.authorizeBatchItemGrant(ctx, "read", "secret.read", project, path, field, secretLabels)
+		if err == nil && reason == "" && (movedTo != "" || inheritedFrom != "") {
+			var sourceGrant string
+			if reason, sourceGrant, err = s.authorizeBatchItemGrant(ctx, "read", "secret.read", secretProject, sv.Secret.Path, field, secretLabels); sourceGrant != "" {
+				grantID = sourceGrant
+			}
+		}
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "policy evaluation failed")
+			return
+		}
+		if reason != "" {
+			res.Status = http.StatusForbidden
+			res.Error = reason
+			continue
+		}
+
+		if !ok {
+			res.Status = http.StatusNotFound
+			res.Error = "secret not found"
+			continue
+		}
+		if sv.Version.DestroyedAt != nil {
+			res.Status = http.StatusGone
+			res.Error = "version " + itoa(sv.Version.Version) + " has been destroyed"
+			continue
+		}
+		value, encryption, err := s.secretValue(ctx, secretProject, sv.Secret, sv.Version)
+		if err != nil {
+			res.Status = http.StatusInternalServerError
+			res.Error = "decryption failed"
+			continue
+		}
+		if field != "" {
+			var msg string
+			if value, res.Status, msg = secretField(sv.Secret, value, encryption, field); msg != "" {
+				res.Error = msg
+				continue
+			}
+		}
+		if encryption == "" && !req.Raw {
+			var msg string
+			self := refs.Ref{Project: secretProject.Name, Path: sv.Secret.Path, Field: field}
+			if value, res.Status, msg = s.renderSecretValue(ctx, self, value, resolved); msg != "" {
+				res.Error = msg
+				continue
+			}
+		}
+
+		// Audit the read (NEVER log the secret value)
+		readMeta := `{"version":` + itoa(sv.Version.Version) + `,"batch":true` + grantMeta(grantID) + `}`
+		if movedTo != "" {
+			readMeta = `{"version":` + itoa(sv.Version.Version) + `,"batch":true,"moved_to":"` + movedTo + `"` + grantMeta(grantID) + `}`
+		}
+		if inheritedFrom != "" {
+			readMeta = `{"version":` + itoa(sv.Version.Version) + `,"batch":true,"inherited_from":"` + inheritedFrom + `"` + grantMeta(grantID) + `}`
+		}
+		s.audit.Log(ctx, audit.Event{
+			ActorType: getActorType(ctx),
+			ActorID:   getActorID(ctx),
+			Action:    "secret.read",
+			Resource:  fieldResource(projectName+"/"+path, field),
+			Outcome:   "success",
+			IP:        getClientIP(ctx),
+			Metadata:  json.RawMessage(readMeta),
+		})
+
+		res.Status = http.StatusOK
+		res.Version = sv.Version.Version
+		res.Value = value
+		res.Encryption = encryption
+		res.SecretType = sv.Secret.SecretType
+		res.MovedTo = movedTo
+		res.InheritedFrom = inheritedFrom
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"project": project.Name,
+		"results": results,
+	})
+}
+
+// handleBatchPutSecrets writes several secrets of a project in one database
+// transaction. Every item is validated and authorized first; if any fails,
+// nothing is written and the per-item results say why.
+func (s *Server) handleBatchPutSecrets(w http.ResponseWriter, r *http.Request, projectName string) {
+	ctx := r.Context()
+	actorType := getActorType(ctx)
+	actorID := getActorID(ctx)
+
+	if scopes, kind, ok := tokenScopes(ctx); ok {
+		if !scopeAllows(scopes, "write", "") {
+			writeError(w, http.StatusForbidden, kind+" lacks write scope")
+			return
+		}
+	}
+
+	var req batchPutRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	paths := make([]string, len(req.Secrets))
+	for i, item := range req.Secrets {
+		paths[i] = item.Path
+	}
+	if msg := checkBatchPaths(paths); msg != "" {
+		writeError(w, http.StatusBadRequest, msg)
+		return
+	}
+
+	project, err := s.db.GetProjectByName(ctx, projectName)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "project not found")
+		return
+	}
+
+	if project.IsE2E() {
+		member, err := s.canWriteE2E(ctx, project)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "failed to check membership")
+			return
+		}
+		if !member {
+			writeError(w, http.StatusForbidden, "only project members can write to end-to-end encrypted projects")
+			return
+		}
+	}
+
+	results := make([]batchResult, len(req.Secrets))
+	writes := make([]db.SecretWrite, len(req.Secrets))
+	failed := 0
+	fail := func(i, status int, msg string) {
+		results[i].Status = status
+		results[i].Error = msg
+		failed++
+	}
+	for i, item := range req.Secrets {
+		results[i].Path = item.Path
+
+		reason, err := s.authorizeBatchItem(ctx, "write", "secret.write", project, item.Path, "", nil)
+		if err == nil && reason == "" && item.Labels != nil {
+			// The new labels must allow the write as well
+			reason, err = s.authorizeBatchItem(ctx, "write", "secret.write", project, item.Path, "", item.Labels)
+		}
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "policy evaluation failed")
+			return
+		}
+		if reason != "" {
+			fail(i, http.StatusForbidden, reason)
+			continue
+		}
+
+		if strings.Contains(item.Path, "#") {
+			fail(i, http.StatusBadRequest, "path must not contain '#' (it names a field)")
+			continue
+		}
+		if item.Value == "" {
+			fail(i, http.StatusBadRequest, "value is required")
+			continue
+		}
+		secretType, metadata, msg := secretTypeMetadata(item.Type, item.Filename, item.ContentType)
+		if msg != "" {
+			fail(i, http.StatusBadRequest, msg)
+			continue
+		}
+		if _, err := refs.Parse(item.Value); err != nil {
+			fail(i, http.StatusBadRequest, err.Error())
+			continue
+		}
+		if err := labels.Validate(item.Labels); err != nil {
+			fail(i, http.StatusBadRequest, err.Error())
+			continue
+		}
+		if item.CAS != nil && *item.CAS < 0 {
+			fail(i, http.StatusBadRequest, "cas must not be negative")
+			continue
+		}
+		if item.CAS == nil && project.RequireCAS {
+			fail(i, http.StatusPreconditionRequired, "this project requires check-and-set writes (send cas)")
+			continue
+		}
+
+		value := []byte(item.Value)
+		var blob []byte
+		if project.IsE2E() {
+			if blob, msg = e2eBlob(project, item.Value); msg != "" {
+				fail(i, http.StatusBadRequest, msg)
+				continue
+			}
+		}
+
+		writes[i] = db.SecretWrite{
+			Path:        item.Path,
+			Description: item.Description,
+			SecretType:  secretType,
+			Metadata:    metadata,
+			Labels:      item.Labels,
+			CAS:         item.CAS,
+			Encrypt:     s.versionEncrypter(ctx, project, value, blob),
+		}
+	}
+
+	if failed > 0 {
+		s.abortBatch(w, results)
+		return
+	}
+
+	written, err := s.db.WriteSecretVersions(ctx, project.ID, actorID, writes)
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), "version mismatch"), strings.Contains(err.Error(), "is deleted"):
+			writeError(w, http.StatusConflict, err.Error())
+		case isDBConflictError(err):
+			writeError(w, http.StatusConflict, "concurrent write conflict, please retry")
+		default:
+			writeError(w, http.StatusInternalServerError, "failed to write secrets")
+		}
+		return
+	}
+
+	for i, sv := range written {
+		// Audit the write (NEVER log the secret value)
+		s.audit.Log(ctx, audit.Event{
+			ActorType: actorType,
+			ActorID:   actorID,
+			Action:    "secret.write",
+			Resource:  projectName + "/" + sv.Secret.Path,
+			Outcome:   "success",
+			IP:        getClientIP(ctx),
+			Metadata:  json.RawMessage(`{"version":` + itoa(sv.Version.Version) + `,"type":"` + sv.Secret.SecretType + `","batch":true}`),
+		})
+		s.pruneSecretVersions(ctx, project, sv.Secret)
+
+		results[i].Status = http.StatusOK
+		results[i].Version = sv.Version.Version
+		results[i].SecretType = sv.Secret.SecretType
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"project": project.Name,
+		"results": results,
+	})
+}
+
+// abortBatch reports a batch write in which some items failed validation or
+// authorization. Nothing was written; items that were fine are reported with
+// 424 Failed Dependency. The response status is that of the first failure.
+func (s *Server) abortBatch(w http.ResponseWriter, results []batchResult) {
+	status := 0
+	for i := range results {
+		if results[i].Status == 0 {
+			results[i].Status = http.StatusFailedDependency
+			results[i].Error = "not written: another secret in the batch failed"
+		} else if status == 0 {
+			status = results[i].Status
+		}
+	}
+	writeJSON(w, status, map[string]interface{}{
+		"error":   "batch aborted, no secrets were written",
+		"results": results,
+	})
+}
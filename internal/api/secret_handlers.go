@@ -1,14 +1,23 @@
 package api
 
 import (
+	"context"
+	"encoding/base64"
 	"encoding/json"
+	"log"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/teamvault/teamvault/internal/audit"
 	"github.com/teamvault/teamvault/internal/crypto"
 	"github.com/teamvault/teamvault/internal/db"
+	"github.com/teamvault/teamvault/internal/e2e"
+	"github.com/teamvault/teamvault/internal/jsonfield"
+	"github.com/teamvault/teamvault/internal/labels"
 	"github.com/teamvault/teamvault/internal/policy"
+	"github.com/teamvault/teamvault/internal/refs"
 )
 
 type putSecretRequest struct {
@@ -18,6 +27,17 @@ type putSecretRequest struct {
 	Type        string `json:"type,omitempty"`         // "kv", "json", "file" (default: "kv")
 	Filename    string `json:"filename,omitempty"`      // For file type
 	ContentType string `json:"content_type,omitempty"`  // For file type (e.g., "application/x-pem-file")
+	// Check-and-set: the version this write replaces (0 = secret must not
+	// exist). Same as sending If-Match.
+	CAS *int `json:"cas,omitempty"`
+	// Version limits for this secret, overriding the project's. -1 and ""
+	// respectively revert to the project setting.
+	MaxVersions   *int    `json:"max_versions,omitempty"`
+	MaxVersionAge *string `json:"max_version_age,omitempty"`
+	// Labels replace the secret's labels if set; omit to keep them
+	Labels map[string]string `json:"labels,omitempty"`
+	// Comment for the approvers, if the write opens a change request
+	Comment string `json:"comment,omitempty"`
 }
 
 type secretResponse struct {
@@ -29,9 +49,18 @@ type secretResponse struct {
 	SecretType  string          `json:"secret_type"`
 	Metadata    json.RawMessage `json:"metadata,omitempty"`
 	Version     int             `json:"version"`
+	Field       string          `json:"field,omitempty"` // the field of a JSON secret that value holds
 	Value       string          `json:"value,omitempty"`
-	CreatedBy   string          `json:"created_by"`
-	CreatedAt   string          `json:"created_at"`
+	Encryption  string          `json:"encryption,omitempty"` // "e2e": value is a base64 client-encrypted blob
+	MovedTo     string          `json:"moved_to,omitempty"`   // "project/path" the secret was read from, via an alias
+	// "project/path" in a parent environment the value is inherited from
+	InheritedFrom string `json:"inherited_from,omitempty"`
+	CreatedBy     string `json:"created_by"`
+	CreatedAt     string `json:"created_at"`
+	// The secret's own version limits, if it overrides the project's
+	MaxVersions          *int              `json:"max_versions,omitempty"`
+	MaxVersionAgeSeconds *int64            `json:"max_version_age_seconds,omitempty"`
+	Labels               map[string]string `json:"labels,omitempty"`
 }
 
 // fileMetadata is stored in the secret's metadata column for file-type secrets.
@@ -55,6 +84,11 @@ func (s *Server) handlePutSecret(w http.ResponseWriter, r *http.Request) {
 	// Strip /versions suffix if accidentally routed here
 	secretPath = strings.TrimSuffix(secretPath, "/versions")
 
+	if strings.Contains(secretPath, "#") {
+		writeError(w, http.StatusBadRequest, "path must not contain '#' (it names a field)")
+		return
+	}
+
 	// Redirect rotation PUTs to the rotation handler
 	if strings.HasSuffix(secretPath, "/rotation") {
 		s.handleSetRotation(w, r)
@@ -68,13 +102,12 @@ func (s *Server) handlePutSecret(w http.ResponseWriter, r *http.Request) {
 	resource := projectName + "/" + secretPath
 
 	// Policy check
-	policyResult, err := s.policy.Evaluate(ctx, policy.Request{
-		SubjectType: actorType,
-		SubjectID:   actorID,
-		Action:      "write",
-		Resource:    resource,
-		IsAdmin:     isAdmin(ctx),
-	})
+	policyReq, err := s.secretPolicyRequest(ctx, "write", projectName, secretPath, nil)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to load project")
+		return
+	}
+	policyResult, err := s.policy.Evaluate(ctx, policyReq)
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, "policy evaluation failed")
 		return
@@ -94,9 +127,9 @@ func (s *Server) handlePutSecret(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Check SA scope
-	if saClaims := getSAClaims(ctx); saClaims != nil {
-		if !hasScope(saClaims.Scopes, "write") {
-			writeError(w, http.StatusForbidden, "service account lacks write scope")
+	if scopes, kind, ok := tokenScopes(ctx); ok {
+		if !scopeAllows(scopes, "write", resource) {
+			writeError(w, http.StatusForbidden, kind+" lacks write scope")
 			return
 		}
 	}
@@ -112,34 +145,26 @@ func (s *Server) handlePutSecret(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Determine secret type
-	secretType := req.Type
-	if secretType == "" {
-		secretType = "kv"
+	secretType, metadata, msg := secretTypeMetadata(req.Type, req.Filename, req.ContentType)
+	if msg != "" {
+		writeError(w, http.StatusBadRequest, msg)
+		return
 	}
-	if secretType != "kv" && secretType != "json" && secretType != "file" {
-		writeError(w, http.StatusBadRequest, "type must be 'kv', 'json', or 'file'")
+
+	if _, err := refs.Parse(req.Value); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	// For file type, filename is required
-	if secretType == "file" && req.Filename == "" {
-		writeError(w, http.StatusBadRequest, "filename is required for file type secrets")
+	maxVersions, maxAgeSeconds, limitsChanged, msg := secretVersionLimits(req)
+	if msg != "" {
+		writeError(w, http.StatusBadRequest, msg)
 		return
 	}
 
-	// Build metadata for file type
-	var metadata json.RawMessage
-	if secretType == "file" {
-		ct := req.ContentType
-		if ct == "" {
-			ct = "application/octet-stream"
-		}
-		fm := fileMetadata{
-			Filename:    req.Filename,
-			ContentType: ct,
-		}
-		metadata, _ = json.Marshal(fm)
+	if err := labels.Validate(req.Labels); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
 	}
 
 	// Get or create the project
@@ -149,60 +174,106 @@ func (s *Server) handlePutSecret(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Get or create the secret
-	secret, err := s.db.GetSecret(ctx, project.ID, secretPath)
-	if err != nil {
-		// Create a new secret with type
-		secret, err = s.db.CreateSecretWithType(ctx, project.ID, secretPath, req.Description, secretType, metadata, actorID)
+	// New labels must allow the write too, so a secret cannot be labeled
+	// into a class the caller may not write
+	if req.Labels != nil {
+		policyResult, err := s.policy.Evaluate(ctx, s.projectPolicyRequest(ctx, "write", project, secretPath, req.Labels))
 		if err != nil {
-			writeError(w, http.StatusInternalServerError, "failed to create secret")
+			writeError(w, http.StatusInternalServerError, "policy evaluation failed")
 			return
 		}
-	} else {
-		// Update existing secret's type and metadata if changed
-		if secretType != secret.SecretType || metadata != nil {
-			if err := s.db.UpdateSecretType(ctx, secret.ID, secretType, metadata); err != nil {
-				writeError(w, http.StatusInternalServerError, "failed to update secret type")
-				return
-			}
-			secret.SecretType = secretType
-			secret.Metadata = metadata
+		if !policyResult.Allowed {
+			s.audit.Log(ctx, audit.Event{
+				ActorType: actorType,
+				ActorID:   actorID,
+				Action:    "secret.write",
+				Resource:  resource,
+				Outcome:   "denied",
+				IP:        getClientIP(ctx),
+				Metadata:  json.RawMessage(`{"reason":"` + policyResult.Reason + `"}`),
+			})
+			writeError(w, http.StatusForbidden, policyResult.Reason)
+			return
 		}
 	}
 
-	// Encrypt the secret value using envelope encryption
-	encrypted, err := s.crypto.Encrypt([]byte(req.Value))
-	if err != nil {
-		writeError(w, http.StatusInternalServerError, "encryption failed")
+	// End-to-end encrypted projects only accept blobs encrypted client-side
+	// by a member; they are stored as is
+	var blob []byte
+	if project.IsE2E() {
+		member, err := s.canWriteE2E(ctx, project)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "failed to check membership")
+			return
+		}
+		if !member {
+			writeError(w, http.StatusForbidden, "only project members can write to end-to-end encrypted projects")
+			return
+		}
+		var msg string
+		if blob, msg = e2eBlob(project, req.Value); msg != "" {
+			writeError(w, http.StatusBadRequest, msg)
+			return
+		}
+	}
+
+	cas, msg := casVersion(r, req.CAS)
+	if msg != "" {
+		writeError(w, http.StatusBadRequest, msg)
+		return
+	}
+	if cas == nil && project.RequireCAS {
+		writeError(w, http.StatusPreconditionRequired, "this project requires check-and-set writes (send If-Match or cas)")
 		return
 	}
 
-	// Get next version number and create the version.
-	// Retry on conflict (concurrent writes can race on version number).
-	var sv *db.SecretVersion
-	for attempts := 0; attempts < 3; attempts++ {
-		nextVersion, err := s.db.GetNextSecretVersion(ctx, secret.ID)
-		if err != nil {
-			writeError(w, http.StatusInternalServerError, "failed to determine version")
+	// Writes to protected paths wait for approval as change requests
+	if rule := s.approvalRule(ctx, project, secretPath); rule != nil {
+		if limitsChanged {
+			writeError(w, http.StatusBadRequest, "version limits of secrets under "+rule.Path+" can only be changed by the project owner")
 			return
 		}
+		s.requestChange(w, r, project, secretPath, rule, req, secretType, metadata, blob, cas)
+		return
+	}
 
-		sv, err = s.db.CreateSecretVersion(ctx, secret.ID, nextVersion,
-			encrypted.Ciphertext, encrypted.Nonce,
-			encrypted.EncryptedDEK, encrypted.DEKNonce,
-			encrypted.MasterKeyVersion, actorID)
-		if err != nil {
-			if isDBConflictError(err) && attempts < 2 {
-				continue // retry with next version number
-			}
-			if isDBConflictError(err) {
-				writeError(w, http.StatusConflict, "concurrent write conflict, please retry")
-				return
-			}
+	// Create the secret if needed and store the version in one transaction,
+	// so a failed write leaves neither an empty secret nor changed metadata
+	written, err := s.db.WriteSecretVersions(ctx, project.ID, actorID, []db.SecretWrite{{
+		Path:        secretPath,
+		Description: req.Description,
+		SecretType:  secretType,
+		Metadata:    metadata,
+		Labels:      req.Labels,
+		CAS:         cas,
+		Encrypt:     s.versionEncrypter(ctx, project, []byte(req.Value), blob),
+	}})
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), "version mismatch"), strings.Contains(err.Error(), "is deleted"):
+			writeError(w, http.StatusConflict, err.Error())
+		case isDBConflictError(err):
+			writeError(w, http.StatusConflict, "concurrent write conflict, please retry")
+		default:
 			writeError(w, http.StatusInternalServerError, "failed to store secret version")
+		}
+		return
+	}
+	secret, sv := written[0].Secret, written[0].Version
+
+	if limitsChanged {
+		if maxVersions == nil && req.MaxVersions == nil {
+			maxVersions = secret.MaxVersions
+		}
+		if maxAgeSeconds == nil && req.MaxVersionAge == nil {
+			maxAgeSeconds = secret.MaxVersionAgeSeconds
+		}
+		if err := s.db.SetSecretVersionLimits(ctx, secret.ID, maxVersions, maxAgeSeconds); err != nil {
+			writeError(w, http.StatusInternalServerError, "failed to update version limits")
 			return
 		}
-		break
+		secret.MaxVersions = maxVersions
+		secret.MaxVersionAgeSeconds = maxAgeSeconds
 	}
 
 	// Audit the write (NEVER log the secret value)
@@ -216,17 +287,23 @@ func (s *Server) handlePutSecret(w http.ResponseWriter, r *http.Request) {
 		Metadata:  json.RawMessage(`{"version":` + itoa(sv.Version) + `,"type":"` + secretType + `"}`),
 	})
 
+	s.pruneSecretVersions(ctx, project, secret)
+
+	w.Header().Set("ETag", etag(sv.Version))
 	writeJSON(w, http.StatusOK, secretResponse{
-		ID:          secret.ID,
-		ProjectID:   project.ID,
-		Project:     project.Name,
-		Path:        secret.Path,
-		Description: secret.Description,
-		SecretType:  secretType,
-		Metadata:    metadata,
-		Version:     sv.Version,
-		CreatedBy:   actorID,
-		CreatedAt:   secret.CreatedAt.Format("2006-01-02T15:04:05Z"),
+		ID:                   secret.ID,
+		ProjectID:            project.ID,
+		Project:              project.Name,
+		Path:                 secret.Path,
+		Description:          secret.Description,
+		SecretType:           secretType,
+		Metadata:             metadata,
+		Version:              sv.Version,
+		CreatedBy:            actorID,
+		CreatedAt:            secret.CreatedAt.Format("2006-01-02T15:04:05Z"),
+		MaxVersions:          secret.MaxVersions,
+		MaxVersionAgeSeconds: secret.MaxVersionAgeSeconds,
+		Labels:               secret.Labels,
 	})
 }
 
@@ -254,16 +331,24 @@ func (s *Server) handleGetSecret(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	resource := projectName + "/" + secretPath
+	// ?field=a.b reads one field of a JSON secret; policy may allow just
+	// that field ("project/path#a.b")
+	field := r.URL.Query().Get("field")
+	if field != "" {
+		if err := jsonfield.Validate(field); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	resource := fieldResource(projectName+"/"+secretPath, field)
 
 	// Policy check
-	policyResult, err := s.policy.Evaluate(ctx, policy.Request{
-		SubjectType: actorType,
-		SubjectID:   actorID,
-		Action:      "read",
-		Resource:    resource,
-		IsAdmin:     isAdmin(ctx),
-	})
+	policyReq, err := s.secretPolicyRequest(ctx, "read", projectName, secretPath, nil)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to load project")
+		return
+	}
+	policyResult, err := s.evaluateFieldPolicy(ctx, policyReq, field)
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, "policy evaluation failed")
 		return
@@ -281,11 +366,12 @@ func (s *Server) handleGetSecret(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusForbidden, policyResult.Reason)
 		return
 	}
+	grantID := policyResult.GrantID
 
 	// Check SA scope
-	if saClaims := getSAClaims(ctx); saClaims != nil {
-		if !hasScope(saClaims.Scopes, "read") {
-			writeError(w, http.StatusForbidden, "service account lacks read scope")
+	if scopes, kind, ok := tokenScopes(ctx); ok {
+		if !scopeAllows(scopes, "read", projectName+"/"+secretPath) {
+			writeError(w, http.StatusForbidden, kind+" lacks read scope")
 			return
 		}
 	}
@@ -296,32 +382,113 @@ func (s *Server) handleGetSecret(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// A secret moved away with an alias is still read at its old path, and a
+	// child environment reads the keys it does not define from its parents,
+	// if the caller may also read the secret where it is
+	var movedTo, inheritedFrom string
 	secret, err := s.db.GetSecret(ctx, project.ID, secretPath)
 	if err != nil {
-		writeError(w, http.StatusNotFound, "secret not found")
-		return
+		sourceProject, source := s.secretAlias(ctx, project, secretPath)
+		via := `"alias":"` + resource + `"`
+		if source != nil {
+			movedTo = sourceProject.Name + "/" + source.Path
+		} else if source = s.inheritedSecret(ctx, project, secretPath); source != nil {
+			sourceProject, inheritedFrom = project, project.Name+"/"+source.Path
+			via = `"inherited_by":"` + resource + `"`
+		} else {
+			writeError(w, http.StatusNotFound, "secret not found")
+			return
+		}
+		policyResult, err := s.evaluateFieldPolicy(ctx, s.projectPolicyRequest(ctx, "read", sourceProject, source.Path, source.Labels), field)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "policy evaluation failed")
+			return
+		}
+		if !policyResult.Allowed {
+			s.audit.Log(ctx, audit.Event{
+				ActorType: actorType,
+				ActorID:   actorID,
+				Action:    "secret.read",
+				Resource:  fieldResource(sourceProject.Name+"/"+source.Path, field),
+				Outcome:   "denied",
+				IP:        getClientIP(ctx),
+				Metadata:  json.RawMessage(`{"reason":"` + policyResult.Reason + `",` + via + `}`),
+			})
+			writeError(w, http.StatusForbidden, policyResult.Reason)
+			return
+		}
+		if scopes, kind, ok := tokenScopes(ctx); ok {
+			if !scopeAllows(scopes, "read", sourceProject.Name+"/"+source.Path) {
+				writeError(w, http.StatusForbidden, kind+" lacks read scope")
+				return
+			}
+		}
+		if policyResult.GrantID != "" {
+			grantID = policyResult.GrantID
+		}
+		project, secret = sourceProject, source
 	}
 
-	sv, err := s.db.GetLatestSecretVersion(ctx, secret.ID)
-	if err != nil {
-		writeError(w, http.StatusNotFound, "no versions found")
+	// ?version=N reads an older version instead of the latest
+	var sv *db.SecretVersion
+	if v := r.URL.Query().Get("version"); v != "" {
+		version, err := strconv.Atoi(v)
+		if err != nil || version < 1 {
+			writeError(w, http.StatusBadRequest, "version must be a positive integer")
+			return
+		}
+		sv, err = s.db.GetSecretVersion(ctx, secret.ID, version)
+		if err != nil {
+			writeError(w, http.StatusNotFound, "version not found")
+			return
+		}
+	} else {
+		sv, err = s.db.GetLatestSecretVersion(ctx, secret.ID)
+		if err != nil {
+			writeError(w, http.StatusNotFound, "no versions found")
+			return
+		}
+	}
+
+	if sv.DestroyedAt != nil {
+		writeError(w, http.StatusGone, "version "+itoa(sv.Version)+" has been destroyed")
 		return
 	}
 
-	// Decrypt the secret value
-	plaintext, err := s.crypto.Decrypt(&crypto.EncryptedData{
-		Ciphertext:       sv.Ciphertext,
-		Nonce:            sv.Nonce,
-		EncryptedDEK:     sv.EncryptedDEK,
-		DEKNonce:         sv.DEKNonce,
-		MasterKeyVersion: sv.MasterKeyVersion,
-	})
+	value, encryption, err := s.secretValue(ctx, project, secret, sv)
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, "decryption failed")
 		return
 	}
+	if field != "" {
+		var status int
+		var msg string
+		if value, status, msg = secretField(secret, value, encryption, field); msg != "" {
+			writeError(w, status, msg)
+			return
+		}
+	}
+
+	// References to other secrets are resolved unless ?raw=true asks for the
+	// value as stored
+	if encryption == "" && r.URL.Query().Get("raw") != "true" {
+		var status int
+		var msg string
+		self := refs.Ref{Project: project.Name, Path: secret.Path, Field: field}
+		if value, status, msg = s.renderSecretValue(ctx, self, value, nil); msg != "" {
+			writeError(w, status, msg)
+			return
+		}
+	}
 
 	// Audit the read (NEVER log the secret value)
+	readMeta := `{"version":` + itoa(sv.Version) + grantMeta(grantID) + `}`
+	if movedTo != "" {
+		readMeta = `{"version":` + itoa(sv.Version) + `,"moved_to":"` + movedTo + `"` + grantMeta(grantID) + `}`
+	}
+	if inheritedFrom != "" {
+		readMeta = `{"version":` + itoa(sv.Version) + `,"inherited_from":"` + inheritedFrom + `"` + grantMeta(grantID) + `}`
+	}
 	s.audit.Log(ctx, audit.Event{
 		ActorType: actorType,
 		ActorID:   actorID,
@@ -329,7 +496,7 @@ func (s *Server) handleGetSecret(w http.ResponseWriter, r *http.Request) {
 		Resource:  resource,
 		Outcome:   "success",
 		IP:        getClientIP(ctx),
-		Metadata:  json.RawMessage(`{"version":` + itoa(sv.Version) + `}`),
+		Metadata:  json.RawMessage(readMeta),
 	})
 
 	// For file-type secrets, set content-type header if metadata contains it
@@ -341,26 +508,32 @@ func (s *Server) handleGetSecret(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	w.Header().Set("ETag", etag(sv.Version))
 	writeJSON(w, http.StatusOK, secretResponse{
-		ID:          secret.ID,
-		ProjectID:   project.ID,
-		Project:     project.Name,
-		Path:        secret.Path,
-		Description: secret.Description,
-		SecretType:  secret.SecretType,
-		Metadata:    secret.Metadata,
-		Version:     sv.Version,
-		Value:       string(plaintext),
-		CreatedBy:   sv.CreatedBy,
-		CreatedAt:   secret.CreatedAt.Format("2006-01-02T15:04:05Z"),
+		ID:                   secret.ID,
+		ProjectID:            project.ID,
+		Project:              project.Name,
+		Path:                 secret.Path,
+		Description:          secret.Description,
+		SecretType:           secret.SecretType,
+		Metadata:             secret.Metadata,
+		Version:              sv.Version,
+		Field:                field,
+		Value:                value,
+		Encryption:           encryption,
+		MovedTo:              movedTo,
+		InheritedFrom:        inheritedFrom,
+		CreatedBy:            sv.CreatedBy,
+		CreatedAt:            secret.CreatedAt.Format("2006-01-02T15:04:05Z"),
+		MaxVersions:          secret.MaxVersions,
+		MaxVersionAgeSeconds: secret.MaxVersionAgeSeconds,
+		Labels:               secret.Labels,
 	})
 }
 
 func (s *Server) handleListSecrets(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	projectName := r.PathValue("project")
-	actorType := getActorType(ctx)
-	actorID := getActorID(ctx)
 
 	project, err := s.db.GetProjectByName(ctx, projectName)
 	if err != nil {
@@ -368,28 +541,26 @@ func (s *Server) handleListSecrets(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Policy check: require "list" or "read" permission on the project
-	policyResult, err := s.policy.Evaluate(ctx, policy.Request{
-		SubjectType: actorType,
-		SubjectID:   actorID,
-		Action:      "read",
-		Resource:    projectName + "/*",
-		IsAdmin:     isAdmin(ctx),
-	})
+	// Policy check: require "read" permission on the project, or having
+	// created it
+	allowed, err := s.canListProject(ctx, project)
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, "policy evaluation failed")
 		return
 	}
-	if !policyResult.Allowed {
-		// Fall back: allow if user created the project
-		claims := getUserClaims(ctx)
-		if claims == nil || (project.CreatedBy != claims.UserID && claims.Role != "admin") {
-			writeError(w, http.StatusForbidden, "access denied")
-			return
-		}
+	if !allowed {
+		writeError(w, http.StatusForbidden, "access denied")
+		return
 	}
 
-	secrets, err := s.db.ListSecrets(ctx, project.ID)
+	// ?deleted=true lists soft-deleted secrets that can still be restored
+	deleted := r.URL.Query().Get("deleted") == "true"
+	var secrets []db.Secret
+	if deleted {
+		secrets, err = s.db.ListDeletedSecrets(ctx, project.ID)
+	} else {
+		secrets, err = s.db.ListSecrets(ctx, project.ID)
+	}
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, "failed to list secrets")
 		return
@@ -397,26 +568,37 @@ func (s *Server) handleListSecrets(w http.ResponseWriter, r *http.Request) {
 
 	// Return metadata only (no values)
 	type secretListItem struct {
-		ID          string          `json:"id"`
-		Path        string          `json:"path"`
-		Description string          `json:"description,omitempty"`
-		SecretType  string          `json:"secret_type"`
-		Metadata    json.RawMessage `json:"metadata,omitempty"`
-		CreatedBy   string          `json:"created_by"`
-		CreatedAt   string          `json:"created_at"`
+		ID          string            `json:"id"`
+		Path        string            `json:"path"`
+		Description string            `json:"description,omitempty"`
+		SecretType  string            `json:"secret_type"`
+		Metadata    json.RawMessage   `json:"metadata,omitempty"`
+		Labels      map[string]string `json:"labels,omitempty"`
+		CreatedBy   string            `json:"created_by"`
+		CreatedAt   string            `json:"created_at"`
+		DeletedAt   string            `json:"deleted_at,omitempty"`
+		PurgeAt     string            `json:"purge_at,omitempty"` // when the retention job removes it for good
 	}
 
 	items := make([]secretListItem, 0, len(secrets))
 	for _, sec := range secrets {
-		items = append(items, secretListItem{
+		item := secretListItem{
 			ID:          sec.ID,
 			Path:        sec.Path,
 			Description: sec.Description,
 			SecretType:  sec.SecretType,
 			Metadata:    sec.Metadata,
+			Labels:      sec.Labels,
 			CreatedBy:   sec.CreatedBy,
 			CreatedAt:   sec.CreatedAt.Format("2006-01-02T15:04:05Z"),
-		})
+		}
+		if sec.DeletedAt != nil {
+			item.DeletedAt = sec.DeletedAt.Format("2006-01-02T15:04:05Z")
+			if s.secretPurger != nil && s.secretPurger.Retention() > 0 {
+				item.PurgeAt = sec.DeletedAt.Add(s.secretPurger.Retention()).Format("2006-01-02T15:04:05Z")
+			}
+		}
+		items = append(items, item)
 	}
 
 	writeJSON(w, http.StatusOK, items)
@@ -432,13 +614,12 @@ func (s *Server) handleDeleteSecret(w http.ResponseWriter, r *http.Request) {
 	resource := projectName + "/" + secretPath
 
 	// Policy check
-	policyResult, err := s.policy.Evaluate(ctx, policy.Request{
-		SubjectType: actorType,
-		SubjectID:   actorID,
-		Action:      "delete",
-		Resource:    resource,
-		IsAdmin:     isAdmin(ctx),
-	})
+	policyReq, err := s.secretPolicyRequest(ctx, "delete", projectName, secretPath, nil)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to load project")
+		return
+	}
+	policyResult, err := s.policy.Evaluate(ctx, policyReq)
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, "policy evaluation failed")
 		return
@@ -461,6 +642,10 @@ func (s *Server) handleDeleteSecret(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusNotFound, "project not found")
 		return
 	}
+	if reason := s.protectedPathReason(ctx, project, secretPath, "secret.delete"); reason != "" {
+		writeError(w, http.StatusForbidden, reason)
+		return
+	}
 
 	if err := s.db.SoftDeleteSecret(ctx, project.ID, secretPath); err != nil {
 		writeError(w, http.StatusNotFound, "secret not found")
@@ -484,9 +669,39 @@ func (s *Server) handleListSecretVersions(w http.ResponseWriter, r *http.Request
 	projectName := r.PathValue("project")
 	secretPath := r.PathValue("path")
 
+	actorType := getActorType(ctx)
+	actorID := getActorID(ctx)
+
 	// Strip /versions suffix
 	secretPath = strings.TrimSuffix(secretPath, "/versions")
 
+	resource := projectName + "/" + secretPath
+
+	// Policy check
+	policyReq, err := s.secretPolicyRequest(ctx, "read", projectName, secretPath, nil)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to load project")
+		return
+	}
+	policyResult, err := s.policy.Evaluate(ctx, policyReq)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "policy evaluation failed")
+		return
+	}
+	if !policyResult.Allowed {
+		s.audit.Log(ctx, audit.Event{
+			ActorType: actorType,
+			ActorID:   actorID,
+			Action:    "secret.versions",
+			Resource:  resource,
+			Outcome:   "denied",
+			IP:        getClientIP(ctx),
+			Metadata:  json.RawMessage(`{"reason":"` + policyResult.Reason + `"}`),
+		})
+		writeError(w, http.StatusForbidden, policyResult.Reason)
+		return
+	}
+
 	project, err := s.db.GetProjectByName(ctx, projectName)
 	if err != nil {
 		writeError(w, http.StatusNotFound, "project not found")
@@ -506,29 +721,421 @@ func (s *Server) handleListSecretVersions(w http.ResponseWriter, r *http.Request
 	}
 
 	type versionItem struct {
-		ID        string `json:"id"`
-		Version   int    `json:"version"`
-		CreatedBy string `json:"created_by"`
-		CreatedAt string `json:"created_at"`
+		ID          string `json:"id"`
+		Version     int    `json:"version"`
+		CreatedBy   string `json:"created_by"`
+		CreatedAt   string `json:"created_at"`
+		DestroyedAt string `json:"destroyed_at,omitempty"`
 	}
 
 	items := make([]versionItem, 0, len(versions))
 	for _, v := range versions {
-		items = append(items, versionItem{
+		item := versionItem{
 			ID:        v.ID,
 			Version:   v.Version,
 			CreatedBy: v.CreatedBy,
 			CreatedAt: v.CreatedAt.Format("2006-01-02T15:04:05Z"),
-		})
+		}
+		if v.DestroyedAt != nil {
+			item.DestroyedAt = v.DestroyedAt.Format("2006-01-02T15:04:05Z")
+		}
+		items = append(items, item)
 	}
 
 	writeJSON(w, http.StatusOK, items)
 }
 
-// hasScope checks if a scope list contains the requested scope.
-func hasScope(scopes []string, scope string) bool {
+type rollbackSecretRequest struct {
+	Version int  `json:"version"`
+	CAS     *int `json:"cas,omitempty"`
+}
+
+// handleRollbackSecret restores an older version by writing it again as a
+// new version, so history is never rewritten.
+// POST /api/v1/secrets/{project}/{path...}/rollback
+func (s *Server) handleRollbackSecret(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	projectName := r.PathValue("project")
+	secretPath := strings.TrimSuffix(r.PathValue("path"), "/rollback")
+	actorType := getActorType(ctx)
+	actorID := getActorID(ctx)
+
+	if projectName == "" || secretPath == "" {
+		writeError(w, http.StatusBadRequest, "project and path are required")
+		return
+	}
+
+	resource := projectName + "/" + secretPath
+
+	// Policy check
+	policyReq, err := s.secretPolicyRequest(ctx, "write", projectName, secretPath, nil)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to load project")
+		return
+	}
+	policyResult, err := s.policy.Evaluate(ctx, policyReq)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "policy evaluation failed")
+		return
+	}
+	if !policyResult.Allowed {
+		s.audit.Log(ctx, audit.Event{
+			ActorType: actorType,
+			ActorID:   actorID,
+			Action:    "secret.rollback",
+			Resource:  resource,
+			Outcome:   "denied",
+			IP:        getClientIP(ctx),
+			Metadata:  json.RawMessage(`{"reason":"` + policyResult.Reason + `"}`),
+		})
+		writeError(w, http.StatusForbidden, policyResult.Reason)
+		return
+	}
+
+	// Check SA scope
+	if scopes, kind, ok := tokenScopes(ctx); ok {
+		if !scopeAllows(scopes, "write", resource) {
+			writeError(w, http.StatusForbidden, kind+" lacks write scope")
+			return
+		}
+	}
+
+	var req rollbackSecretRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if req.Version < 1 {
+		writeError(w, http.StatusBadRequest, "version must be a positive integer")
+		return
+	}
+
+	project, err := s.db.GetProjectByName(ctx, projectName)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "project not found")
+		return
+	}
+	if reason := s.protectedPathReason(ctx, project, secretPath, "secret.rollback"); reason != "" {
+		writeError(w, http.StatusForbidden, reason)
+		return
+	}
+
+	cas, msg := casVersion(r, req.CAS)
+	if msg != "" {
+		writeError(w, http.StatusBadRequest, msg)
+		return
+	}
+	if cas == nil && project.RequireCAS {
+		writeError(w, http.StatusPreconditionRequired, "this project requires check-and-set writes (send If-Match or cas)")
+		return
+	}
+
+	secret, err := s.db.GetSecret(ctx, project.ID, secretPath)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "secret not found")
+		return
+	}
+
+	target, err := s.db.GetSecretVersion(ctx, secret.ID, req.Version)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "version not found")
+		return
+	}
+	if target.DestroyedAt != nil {
+		writeError(w, http.StatusGone, "version "+itoa(target.Version)+" has been destroyed")
+		return
+	}
+
+	// Server-encrypted values are re-encrypted for the new version number.
+	// End-to-end encrypted blobs are bound to the path only and are copied,
+	// but like any write they must use the project's current key.
+	var plaintext, blob []byte
+	if target.FormatVersion == crypto.FormatE2E {
+		member, err := s.canWriteE2E(ctx, project)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "failed to check membership")
+			return
+		}
+		if !member {
+			writeError(w, http.StatusForbidden, "only project members can write to end-to-end encrypted projects")
+			return
+		}
+		if keyVersion, err := e2e.KeyVersion(target.Ciphertext); err != nil || keyVersion != project.E2EKeyVersion {
+			writeError(w, http.StatusConflict, "version is encrypted with an older project key; write its value again from the client")
+			return
+		}
+		blob = target.Ciphertext
+	} else {
+		value, _, err := s.secretValue(ctx, project, secret, target)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "decryption failed")
+			return
+		}
+		plaintext = []byte(value)
+	}
+
+	sv, status, msg := s.storeSecretVersion(ctx, project, secret, plaintext, blob, actorID, cas)
+	if msg != "" {
+		writeError(w, status, msg)
+		return
+	}
+
+	s.audit.Log(ctx, audit.Event{
+		ActorType: actorType,
+		ActorID:   actorID,
+		Action:    "secret.rollback",
+		Resource:  resource,
+		Outcome:   "success",
+		IP:        getClientIP(ctx),
+		Metadata:  json.RawMessage(`{"version":` + itoa(sv.Version) + `,"from_version":` + itoa(target.Version) + `}`),
+	})
+
+	s.pruneSecretVersions(ctx, project, secret)
+
+	w.Header().Set("ETag", etag(sv.Version))
+	writeJSON(w, http.StatusOK, secretResponse{
+		ID:          secret.ID,
+		ProjectID:   project.ID,
+		Project:     project.Name,
+		Path:        secret.Path,
+		Description: secret.Description,
+		SecretType:  secret.SecretType,
+		Metadata:    secret.Metadata,
+		Version:     sv.Version,
+		CreatedBy:   actorID,
+		CreatedAt:   secret.CreatedAt.Format("2006-01-02T15:04:05Z"),
+	})
+}
+
+// versionEncrypter returns the Encrypt function of a db.SecretWrite: it
+// encrypts plaintext for the project, bound to the secret and version it is
+// stored as, or for end-to-end encrypted projects returns blob as is.
+func (s *Server) versionEncrypter(ctx context.Context, project *db.Project, plaintext, blob []byte) func(*db.Secret, int) (*db.SecretVersion, error) {
+	return func(secret *db.Secret, version int) (*db.SecretVersion, error) {
+		encrypted := e2eEncryptedData(blob)
+		if blob == nil {
+			var err error
+			encrypted, err = s.encryptForProject(ctx, project.ID, plaintext, &crypto.EncryptionContext{
+				ProjectID: project.ID,
+				SecretID:  secret.ID,
+				Version:   version,
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+		return &db.SecretVersion{
+			Ciphertext:       encrypted.Ciphertext,
+			Nonce:            encrypted.Nonce,
+			EncryptedDEK:     encrypted.EncryptedDEK,
+			DEKNonce:         encrypted.DEKNonce,
+			MasterKeyVersion: encrypted.MasterKeyVersion,
+			KEKVersion:       encrypted.KEKVersion,
+			FormatVersion:    encrypted.Format,
+		}, nil
+	}
+}
+
+// storeSecretVersion encrypts a value and stores it as the secret's next
+// version. For end-to-end encrypted projects blob is the client-encrypted
+// value and is stored as is. Unconditional writes that race on the version
+// number are retried; with cas set, the write only succeeds if it creates
+// version cas+1. On failure it returns the HTTP status and error message to
+// send.
+func (s *Server) storeSecretVersion(ctx context.Context, project *db.Project, secret *db.Secret, plaintext, blob []byte, createdBy string, cas *int) (*db.SecretVersion, int, string) {
+	for attempts := 0; ; attempts++ {
+		nextVersion, err := s.db.GetNextSecretVersion(ctx, secret.ID)
+		if err != nil {
+			return nil, http.StatusInternalServerError, "failed to determine version"
+		}
+		if cas != nil && nextVersion != *cas+1 {
+			return nil, http.StatusConflict, "version mismatch: latest version is " + itoa(nextVersion-1)
+		}
+
+		// Encrypt the secret value using envelope encryption, bound to the
+		// exact version it is stored as
+		encrypted := e2eEncryptedData(blob)
+		if blob == nil {
+			encrypted, err = s.encryptForProject(ctx, project.ID, plaintext, &crypto.EncryptionContext{
+				ProjectID: project.ID,
+				SecretID:  secret.ID,
+				Version:   nextVersion,
+			})
+			if err != nil {
+				return nil, http.StatusInternalServerError, "encryption failed"
+			}
+		}
+
+		sv, err := s.db.CreateSecretVersion(ctx, secret.ID, nextVersion,
+			encrypted.Ciphertext, encrypted.Nonce,
+			encrypted.EncryptedDEK, encrypted.DEKNonce,
+			encrypted.MasterKeyVersion, encrypted.KEKVersion, encrypted.Format, createdBy)
+		if err != nil {
+			if isDBConflictError(err) && cas != nil {
+				return nil, http.StatusConflict, "version mismatch: secret was written concurrently"
+			}
+			if isDBConflictError(err) && attempts < 2 {
+				continue // retry with next version number
+			}
+			if isDBConflictError(err) {
+				return nil, http.StatusConflict, "concurrent write conflict, please retry"
+			}
+			return nil, http.StatusInternalServerError, "failed to store secret version"
+		}
+		return sv, 0, ""
+	}
+}
+
+// secretTypeMetadata validates the type of a secret write and builds the
+// metadata stored for file secrets. A non-empty message reports a bad request.
+func secretTypeMetadata(secretType, filename, contentType string) (string, json.RawMessage, string) {
+	if secretType == "" {
+		secretType = "kv"
+	}
+	if secretType != "kv" && secretType != "json" && secretType != "file" {
+		return "", nil, "type must be 'kv', 'json', or 'file'"
+	}
+	if secretType != "file" {
+		return secretType, nil, ""
+	}
+
+	// For file type, filename is required
+	if filename == "" {
+		return "", nil, "filename is required for file type secrets"
+	}
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	metadata, _ := json.Marshal(fileMetadata{
+		Filename:    filename,
+		ContentType: contentType,
+	})
+	return secretType, metadata, ""
+}
+
+// pruneSecretVersions destroys the versions of a secret that a write has
+// pushed outside its version limits. Failures are only logged: the write has
+// succeeded and the background pruner will retry.
+func (s *Server) pruneSecretVersions(ctx context.Context, project *db.Project, secret *db.Secret) {
+	limits := secret.VersionLimits(project)
+	if s.versionPruner == nil || limits.IsZero() {
+		return
+	}
+	_, err := s.versionPruner.PruneSecret(ctx, db.PrunableSecret{
+		ID:          secret.ID,
+		ProjectName: project.Name,
+		Path:        secret.Path,
+		Limits:      limits,
+	})
+	if err != nil {
+		log.Printf("pruning versions of %s/%s: %v", project.Name, secret.Path, err)
+	}
+}
+
+// secretVersionLimits validates the version limits of a write request. nil
+// results with changed set mean the setting reverts to the project's (or, if
+// the field was not sent, is left as is).
+func secretVersionLimits(req putSecretRequest) (maxVersions *int, maxAgeSeconds *int64, changed bool, msg string) {
+	if req.MaxVersions != nil {
+		changed = true
+		if *req.MaxVersions < -1 {
+			return nil, nil, false, "max_versions must be -1 (project default) or more"
+		}
+		if *req.MaxVersions >= 0 {
+			maxVersions = req.MaxVersions
+		}
+	}
+	if req.MaxVersionAge != nil {
+		changed = true
+		if *req.MaxVersionAge != "" {
+			seconds, msg := parseVersionAge(*req.MaxVersionAge)
+			if msg != "" {
+				return nil, nil, false, msg
+			}
+			maxAgeSeconds = &seconds
+		}
+	}
+	return maxVersions, maxAgeSeconds, changed, ""
+}
+
+// parseVersionAge parses a max_version_age duration ("720h", "0" for
+// unlimited) into whole seconds.
+func parseVersionAge(s string) (int64, string) {
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, "max_version_age must be a non-negative duration such as \"720h\""
+	}
+	return int64(d / time.Second), ""
+}
+
+// secretValue decrypts a stored secret version. End-to-end encrypted values
+// are returned as stored, base64-encoded, for the client to decrypt, with
+// encryption set to "e2e".
+func (s *Server) secretValue(ctx context.Context, project *db.Project, secret *db.Secret, sv *db.SecretVersion) (value, encryption string, err error) {
+	if sv.FormatVersion == crypto.FormatE2E {
+		noteProjectRead(ctx, project.ID)
+		return base64.StdEncoding.EncodeToString(sv.Ciphertext), db.EncryptionModeE2E, nil
+	}
+	plaintext, err := s.decryptForProject(ctx, project.ID, &crypto.EncryptedData{
+		Ciphertext:       sv.Ciphertext,
+		Nonce:            sv.Nonce,
+		EncryptedDEK:     sv.EncryptedDEK,
+		DEKNonce:         sv.DEKNonce,
+		MasterKeyVersion: sv.MasterKeyVersion,
+		KEKVersion:       sv.KEKVersion,
+		Format:           sv.FormatVersion,
+	}, &crypto.EncryptionContext{
+		ProjectID: project.ID,
+		SecretID:  secret.ID,
+		Version:   sv.Version,
+	})
+	if err != nil {
+		return "", "", err
+	}
+	return string(plaintext), "", nil
+}
+
+// casVersion returns the version a write expects to replace, taken from the
+// If-Match header (the ETag of an earlier read) or the cas field of the body.
+// nil means the write is unconditional. A non-empty message reports a
+// malformed request.
+func casVersion(r *http.Request, bodyCAS *int) (*int, string) {
+	cas := bodyCAS
+	if h := r.Header.Get("If-Match"); h != "" {
+		v, err := strconv.Atoi(strings.Trim(strings.TrimPrefix(h, "W/"), `"`))
+		if err != nil {
+			return nil, "If-Match must be a secret version ETag"
+		}
+		if cas != nil && *cas != v {
+			return nil, "If-Match and cas disagree"
+		}
+		cas = &v
+	}
+	if cas != nil && *cas < 0 {
+		return nil, "cas must not be negative"
+	}
+	return cas, ""
+}
+
+// etag returns the ETag of a secret version.
+func etag(version int) string {
+	return `"` + itoa(version) + `"`
+}
+
+// scopeAllows checks if a scope list allows action on resource. Besides a
+// bare action and "*", a scope may limit an action to the resources matching
+// a pattern, as in "read:services/payment/*". An empty resource asks whether
+// the action is allowed anywhere; batches then check each secret as well.
+func scopeAllows(scopes []string, action, resource string) bool {
 	for _, s := range scopes {
-		if s == scope || s == "*" {
+		if s == action || s == "*" {
+			return true
+		}
+		scopeAction, pattern, ok := strings.Cut(s, ":")
+		if !ok || (scopeAction != action && scopeAction != "*") {
+			continue
+		}
+		if resource == "" || policy.MatchResource(pattern, resource) {
 			return true
 		}
 	}
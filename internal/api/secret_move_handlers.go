@@ -0,0 +1,311 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/teamvault/teamvault/internal/audit"
+	"github.com/teamvault/teamvault/internal/crypto"
+	"github.com/teamvault/teamvault/internal/db"
+	"github.com/teamvault/teamvault/internal/policy"
+)
+
+type transferSecretRequest struct {
+	To string `json:"to"` // destination as "project/path"
+	// Moves only: keep reads of the old path working for this long ("720h")
+	AliasTTL string `json:"alias_ttl,omitempty"`
+	// End-to-end encrypted secrets only: every version that has not been
+	// destroyed, encrypted again by the client for the destination
+	Values map[int]string `json:"values,omitempty"`
+}
+
+// handleMoveSecret moves a secret with its full version history to another
+// path or project, optionally leaving an alias at the old path.
+// POST /api/v1/secrets/{project}/{path...}/move
+func (s *Server) handleMoveSecret(w http.ResponseWriter, r *http.Request) {
+	s.transferSecret(w, r, true)
+}
+
+// handleCopySecret copies a secret with its full version history to another
+// path or project.
+// POST /api/v1/secrets/{project}/{path...}/copy
+func (s *Server) handleCopySecret(w http.ResponseWriter, r *http.Request) {
+	s.transferSecret(w, r, false)
+}
+
+// transferSecret moves or copies a secret. The source needs read permission
+// (and delete, for a move); the destination needs write permission under the
+// secret's labels. Server-encrypted versions are re-encrypted for the
+// destination here; end-to-end encrypted ones must be sent re-encrypted by
+// the client, as their ciphertext is bound to the project and path.
+func (s *Server) transferSecret(w http.ResponseWriter, r *http.Request, move bool) {
+	ctx := r.Context()
+	actorType := getActorType(ctx)
+	actorID := getActorID(ctx)
+
+	action, suffix, verb := "secret.copy", "/copy", "copy"
+	if move {
+		action, suffix, verb = "secret.move", "/move", "move"
+	}
+	projectName := r.PathValue("project")
+	secretPath := strings.TrimSuffix(r.PathValue("path"), suffix)
+	if projectName == "" || secretPath == "" {
+		writeError(w, http.StatusBadRequest, "project and path are required")
+		return
+	}
+
+	var req transferSecretRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	dstProjectName, dstPath, ok := strings.Cut(req.To, "/")
+	if !ok || dstProjectName == "" || dstPath == "" {
+		writeError(w, http.StatusBadRequest, "to must be project/path")
+		return
+	}
+	if strings.Contains(dstPath, "#") {
+		writeError(w, http.StatusBadRequest, "path must not contain '#' (it names a field)")
+		return
+	}
+	if dstProjectName == projectName && dstPath == secretPath {
+		writeError(w, http.StatusBadRequest, "source and destination are the same")
+		return
+	}
+
+	var aliasUntil *time.Time
+	if req.AliasTTL != "" {
+		if !move {
+			writeError(w, http.StatusBadRequest, "alias_ttl only applies to moves")
+			return
+		}
+		d, err := time.ParseDuration(req.AliasTTL)
+		if err != nil || d <= 0 {
+			writeError(w, http.StatusBadRequest, "alias_ttl must be a positive duration such as \"720h\"")
+			return
+		}
+		t := time.Now().Add(d)
+		aliasUntil = &t
+	}
+
+	resource := projectName + "/" + secretPath
+	dstResource := dstProjectName + "/" + dstPath
+
+	authorize := func(resource string, policyReq policy.Request) bool {
+		policyResult, err := s.policy.Evaluate(ctx, policyReq)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "policy evaluation failed")
+			return false
+		}
+		if !policyResult.Allowed {
+			s.audit.Log(ctx, audit.Event{
+				ActorType: actorType,
+				ActorID:   actorID,
+				Action:    action,
+				Resource:  resource,
+				Outcome:   "denied",
+				IP:        getClientIP(ctx),
+				Metadata:  json.RawMessage(`{"reason":"` + policyResult.Reason + `","action":"` + policyReq.Action + `"}`),
+			})
+			writeError(w, http.StatusForbidden, policyResult.Reason)
+			return false
+		}
+		return true
+	}
+	readReq, err := s.secretPolicyRequest(ctx, "read", projectName, secretPath, nil)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to load project")
+		return
+	}
+	if !authorize(resource, readReq) {
+		return
+	}
+	deleteReq := readReq
+	deleteReq.Action = "delete"
+	if move && !authorize(resource, deleteReq) {
+		return
+	}
+
+	if scopes, kind, ok := tokenScopes(ctx); ok {
+		if !scopeAllows(scopes, "read", resource) || !scopeAllows(scopes, "write", dstResource) ||
+			(move && !scopeAllows(scopes, "write", resource)) {
+			writeError(w, http.StatusForbidden, kind+" needs read and write scopes to "+verb+" secrets")
+			return
+		}
+	}
+
+	project, err := s.db.GetProjectByName(ctx, projectName)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "project not found")
+		return
+	}
+	secret, err := s.db.GetSecret(ctx, project.ID, secretPath)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "secret not found")
+		return
+	}
+	dstProject := project
+	if dstProjectName != projectName {
+		if dstProject, err = s.db.GetProjectByName(ctx, dstProjectName); err != nil {
+			writeError(w, http.StatusNotFound, "destination project not found")
+			return
+		}
+	}
+	if !authorize(dstResource, s.projectPolicyRequest(ctx, "write", dstProject, dstPath, secret.Labels)) {
+		return
+	}
+	reason := ""
+	if move {
+		reason = s.protectedPathReason(ctx, project, secretPath, action)
+	}
+	if reason == "" {
+		reason = s.protectedPathReason(ctx, dstProject, dstPath, action)
+	}
+	if reason != "" {
+		writeError(w, http.StatusForbidden, reason)
+		return
+	}
+
+	if project.IsE2E() != dstProject.IsE2E() {
+		writeError(w, http.StatusBadRequest, "secrets cannot be moved or copied between end-to-end encrypted and server-encrypted projects")
+		return
+	}
+	blobs := make(map[int][]byte, len(req.Values))
+	if dstProject.IsE2E() {
+		member, err := s.canWriteE2E(ctx, dstProject)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "failed to check membership")
+			return
+		}
+		if !member {
+			writeError(w, http.StatusForbidden, "only project members can write to end-to-end encrypted projects")
+			return
+		}
+		for version, value := range req.Values {
+			blob, msg := e2eBlob(dstProject, value)
+			if msg != "" {
+				writeError(w, http.StatusBadRequest, "version "+itoa(version)+": "+msg)
+				return
+			}
+			blobs[version] = blob
+		}
+	} else if len(req.Values) > 0 {
+		writeError(w, http.StatusBadRequest, "values are only sent for end-to-end encrypted projects")
+		return
+	}
+
+	transfer := db.SecretTransfer{
+		SecretID:   secret.ID,
+		ProjectID:  dstProject.ID,
+		Path:       dstPath,
+		CreatedBy:  actorID,
+		AliasUntil: aliasUntil,
+		Encrypt: func(dst *db.Secret, sv *db.SecretVersion) (*db.SecretVersion, error) {
+			var encrypted *crypto.EncryptedData
+			if dstProject.IsE2E() {
+				blob, ok := blobs[sv.Version]
+				if !ok {
+					return nil, fmt.Errorf("missing from values")
+				}
+				encrypted = e2eEncryptedData(blob)
+			} else {
+				value, _, err := s.secretValue(ctx, project, secret, sv)
+				if err != nil {
+					return nil, err
+				}
+				encrypted, err = s.encryptForProject(ctx, dstProject.ID, []byte(value), &crypto.EncryptionContext{
+					ProjectID: dstProject.ID,
+					SecretID:  dst.ID,
+					Version:   sv.Version,
+				})
+				if err != nil {
+					return nil, err
+				}
+			}
+			return &db.SecretVersion{
+				Ciphertext:       encrypted.Ciphertext,
+				Nonce:            encrypted.Nonce,
+				EncryptedDEK:     encrypted.EncryptedDEK,
+				DEKNonce:         encrypted.DEKNonce,
+				MasterKeyVersion: encrypted.MasterKeyVersion,
+				KEKVersion:       encrypted.KEKVersion,
+				FormatVersion:    encrypted.Format,
+			}, nil
+		},
+	}
+	transferFn := s.db.CopySecret
+	if move {
+		transferFn = s.db.MoveSecret
+	}
+	dst, versions, err := transferFn(ctx, transfer)
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), "already exists"):
+			writeError(w, http.StatusConflict, err.Error())
+		case strings.Contains(err.Error(), "missing from values"):
+			writeError(w, http.StatusBadRequest, err.Error())
+		case strings.Contains(err.Error(), "secret not found"):
+			writeError(w, http.StatusNotFound, "secret not found")
+		case isDBConflictError(err):
+			writeError(w, http.StatusConflict, "concurrent write conflict, please retry")
+		default:
+			writeError(w, http.StatusInternalServerError, "failed to "+verb+" secret")
+		}
+		return
+	}
+
+	// Audit the move or copy (NEVER log the secret value)
+	meta := map[string]interface{}{"to": dstResource, "versions": versions}
+	if aliasUntil != nil {
+		meta["alias_until"] = aliasUntil.UTC().Format(time.RFC3339)
+	}
+	metadata, _ := json.Marshal(meta)
+	s.audit.Log(ctx, audit.Event{
+		ActorType: actorType,
+		ActorID:   actorID,
+		Action:    action,
+		Resource:  resource,
+		Outcome:   "success",
+		IP:        getClientIP(ctx),
+		Metadata:  metadata,
+	})
+
+	// The destination project may keep fewer versions than the source did
+	s.pruneSecretVersions(ctx, dstProject, dst)
+
+	resp := map[string]interface{}{
+		"id":       dst.ID,
+		"project":  dstProject.Name,
+		"path":     dst.Path,
+		"from":     resource,
+		"versions": versions,
+	}
+	if aliasUntil != nil {
+		resp["alias_expires_at"] = aliasUntil.UTC().Format("2006-01-02T15:04:05Z")
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// secretAlias returns the secret that a live alias at a path of project
+// redirects to, with the project it is in now, or nils if there is none.
+func (s *Server) secretAlias(ctx context.Context, project *db.Project, path string) (*db.Project, *db.Secret) {
+	alias, err := s.db.GetSecretAlias(ctx, project.ID, path)
+	if err != nil {
+		return nil, nil
+	}
+	secret, err := s.db.GetSecretByID(ctx, alias.SecretID)
+	if err != nil || secret.DeletedAt != nil {
+		return nil, nil
+	}
+	target := project
+	if secret.ProjectID != project.ID {
+		if target, err = s.db.GetProjectByID(ctx, secret.ProjectID); err != nil {
+			return nil, nil
+		}
+	}
+	return target, secret
+}
@@ -8,10 +8,15 @@ import (
 	"github.com/teamvault/teamvault/internal/auth"
 	"github.com/teamvault/teamvault/internal/crypto"
 	"github.com/teamvault/teamvault/internal/db"
+	"github.com/teamvault/teamvault/internal/kek"
 	"github.com/teamvault/teamvault/internal/lease"
 	"github.com/teamvault/teamvault/internal/policy"
 	"github.com/teamvault/teamvault/internal/replication"
+	"github.com/teamvault/teamvault/internal/retention"
+	"github.com/teamvault/teamvault/internal/rewrap"
 	"github.com/teamvault/teamvault/internal/rotation"
+	"github.com/teamvault/teamvault/internal/seal"
+	"github.com/teamvault/teamvault/internal/transit"
 	"github.com/teamvault/teamvault/internal/webhooks"
 )
 
@@ -29,8 +34,15 @@ type Server struct {
 	zkHandlers          *ZKHandlers
 	webhookManager      *webhooks.WebhookManager
 	replicationManager  *replication.ReplicationManager
+	rewrapJob           *rewrap.Job
+	sealManager         *seal.Manager
+	transitManager      *transit.Manager
+	kekManager          *kek.Manager
+	secretPurger        *retention.Purger
+	versionPruner       *retention.Pruner
 	mux                 *http.ServeMux
 	rl                  *rateLimiter
+	mfaLimiter          *rateLimiter // MFA code checks, keyed by user ID
 }
 
 // ServerConfig holds optional dependencies for the server.
@@ -42,6 +54,12 @@ type ServerConfig struct {
 	ZKHandlers         *ZKHandlers
 	WebhookManager     *webhooks.WebhookManager
 	ReplicationManager *replication.ReplicationManager
+	RewrapJob          *rewrap.Job
+	SealManager        *seal.Manager // nil unless KEY_PROVIDER=shamir
+	TransitManager     *transit.Manager
+	KEKManager         *kek.Manager // nil wraps every DEK with the master key
+	SecretPurger       *retention.Purger
+	VersionPruner      *retention.Pruner
 }
 
 // NewServer creates a new API server with all routes configured.
@@ -64,8 +82,15 @@ func NewServerWithConfig(database *db.DB, authSvc *auth.Auth, cryptoSvc *crypto.
 		zkHandlers:          config.ZKHandlers,
 		webhookManager:      config.WebhookManager,
 		replicationManager:  config.ReplicationManager,
+		rewrapJob:           config.RewrapJob,
+		sealManager:         config.SealManager,
+		transitManager:      config.TransitManager,
+		kekManager:          config.KEKManager,
+		secretPurger:        config.SecretPurger,
+		versionPruner:       config.VersionPruner,
 		mux:                 http.NewServeMux(),
 		rl:                  newRateLimiter(100, 200), // 100 req/s per IP, burst 200
+		mfaLimiter:          newRateLimiter(1.0/30, 5), // per user: 5 codes, then 1 every 30s
 	}
 
 	s.setupRoutes()
@@ -98,6 +123,8 @@ func (s *Server) setupRoutes() {
 	// Auth endpoints (no auth required)
 	s.mux.HandleFunc("POST /api/v1/auth/register", s.handleRegister)
 	s.mux.HandleFunc("POST /api/v1/auth/login", s.handleLogin)
+	s.mux.HandleFunc("POST /api/v1/auth/login/mfa", s.handleLoginMFA)
+	s.mux.HandleFunc("POST /api/v1/auth/refresh", s.handleRefresh)
 
 	// OIDC endpoints (no auth required)
 	s.mux.HandleFunc("GET /api/v1/auth/oidc/authorize", s.handleOIDCAuthorize)
@@ -105,26 +132,89 @@ func (s *Server) setupRoutes() {
 
 	// Auth-required endpoints
 	s.mux.Handle("GET /api/v1/auth/me", s.authMiddleware(http.HandlerFunc(s.handleMe)))
+	s.mux.Handle("POST /api/v1/auth/logout", s.authMiddleware(http.HandlerFunc(s.handleLogout)))
+
+	// MFA (TOTP): enrollment, step-up verification
+	s.mux.Handle("GET /api/v1/auth/mfa", s.authMiddleware(http.HandlerFunc(s.handleMFAStatus)))
+	s.mux.Handle("POST /api/v1/auth/mfa/enroll", s.authMiddleware(http.HandlerFunc(s.handleMFAEnroll)))
+	s.mux.Handle("POST /api/v1/auth/mfa/confirm", s.authMiddleware(http.HandlerFunc(s.handleMFAConfirm)))
+	s.mux.Handle("POST /api/v1/auth/mfa/verify", s.authMiddleware(http.HandlerFunc(s.handleMFAVerify)))
+	s.mux.Handle("POST /api/v1/auth/mfa/recovery-codes", s.authMiddleware(http.HandlerFunc(s.handleMFARecoveryCodes)))
+	s.mux.Handle("POST /api/v1/auth/mfa/disable", s.authMiddleware(http.HandlerFunc(s.handleMFADisable)))
+	s.mux.Handle("PUT /api/v1/auth/me/public-key", s.authMiddleware(http.HandlerFunc(s.handleSetPublicKey)))
+	s.mux.Handle("GET /api/v1/users/public-key", s.authMiddleware(http.HandlerFunc(s.handleGetPublicKey)))
+
+	// Sessions (admin)
+	s.mux.Handle("GET /api/v1/users/{id}/sessions", s.authMiddleware(s.adminOnly(http.HandlerFunc(s.handleListUserSessions))))
+	s.mux.Handle("DELETE /api/v1/users/{id}/sessions", s.authMiddleware(s.adminOnly(http.HandlerFunc(s.handleRevokeUserSessions))))
+	s.mux.Handle("DELETE /api/v1/sessions/{id}", s.authMiddleware(s.adminOnly(http.HandlerFunc(s.handleRevokeSession))))
+	s.mux.Handle("DELETE /api/v1/users/{id}/mfa", s.authMiddleware(s.adminOnly(http.HandlerFunc(s.handleResetUserMFA))))
 
 	// Projects
 	s.mux.Handle("POST /api/v1/projects", s.authMiddleware(http.HandlerFunc(s.handleCreateProject)))
 	s.mux.Handle("GET /api/v1/projects", s.authMiddleware(http.HandlerFunc(s.handleListProjects)))
+	s.mux.Handle("PATCH /api/v1/projects/{project}", s.authMiddleware(http.HandlerFunc(s.handleUpdateProject)))
+	s.mux.Handle("DELETE /api/v1/projects/{project}", s.authMiddleware(s.adminOnly(http.HandlerFunc(s.handleDeleteProject))))
+
+	// Environments (secrets under "<env>/", inherited from parent environments)
+	s.mux.Handle("GET /api/v1/projects/{project}/environments", s.authMiddleware(http.HandlerFunc(s.handleListEnvironments)))
+	s.mux.Handle("GET /api/v1/projects/{project}/environments/{env}/secrets", s.authMiddleware(s.unsealedOnly(http.HandlerFunc(s.handleListEnvironmentSecrets))))
+	s.mux.Handle("POST /api/v1/projects/{project}/promote", s.authMiddleware(s.unsealedOnly(http.HandlerFunc(s.handlePromoteEnvironment))))
+
+	// Change requests (two-person approval for writes to protected paths)
+	s.mux.Handle("GET /api/v1/projects/{project}/change-requests", s.authMiddleware(http.HandlerFunc(s.handleListChangeRequests)))
+	s.mux.Handle("GET /api/v1/change-requests/{id}", s.authMiddleware(s.unsealedOnly(http.HandlerFunc(s.handleGetChangeRequest))))
+	s.mux.Handle("POST /api/v1/change-requests/{id}/approve", s.authMiddleware(s.unsealedOnly(http.HandlerFunc(s.handleApproveChangeRequest))))
+	s.mux.Handle("POST /api/v1/change-requests/{id}/reject", s.authMiddleware(http.HandlerFunc(s.handleRejectChangeRequest)))
+	s.mux.Handle("POST /api/v1/change-requests/{id}/cancel", s.authMiddleware(http.HandlerFunc(s.handleCancelChangeRequest)))
+
+	// Just-in-time access (temporary grants approved by a team lead)
+	s.mux.Handle("POST /api/v1/access-requests", s.authMiddleware(http.HandlerFunc(s.handleCreateAccessRequest)))
+	s.mux.Handle("GET /api/v1/access-requests", s.authMiddleware(http.HandlerFunc(s.handleListAccessRequests)))
+	s.mux.Handle("GET /api/v1/access-requests/{id}", s.authMiddleware(http.HandlerFunc(s.handleGetAccessRequest)))
+	s.mux.Handle("POST /api/v1/access-requests/{id}/approve", s.authMiddleware(http.HandlerFunc(s.handleApproveAccessRequest)))
+	s.mux.Handle("POST /api/v1/access-requests/{id}/deny", s.authMiddleware(http.HandlerFunc(s.handleDenyAccessRequest)))
+	s.mux.Handle("POST /api/v1/access-requests/{id}/cancel", s.authMiddleware(http.HandlerFunc(s.handleCancelAccessRequest)))
+	s.mux.Handle("GET /api/v1/access-grants", s.authMiddleware(http.HandlerFunc(s.handleListAccessGrants)))
+	s.mux.Handle("DELETE /api/v1/access-grants/{id}", s.authMiddleware(http.HandlerFunc(s.handleRevokeAccessGrant)))
+
+	// Break-glass access (fixed short window, reviewed by an admin afterwards)
+	s.mux.Handle("POST /api/v1/break-glass", s.authMiddleware(http.HandlerFunc(s.handleBreakGlass)))
+	s.mux.Handle("GET /api/v1/break-glass", s.authMiddleware(s.adminOnly(http.HandlerFunc(s.handleListBreakGlassReviews))))
+	s.mux.Handle("POST /api/v1/break-glass/{id}/acknowledge", s.authMiddleware(s.adminOnly(http.HandlerFunc(s.handleAcknowledgeBreakGlass))))
+
+	// Project key encryption keys (admin-only)
+	s.mux.Handle("GET /api/v1/projects/{project}/keys", s.authMiddleware(s.adminOnly(http.HandlerFunc(s.handleListProjectKeys))))
+	s.mux.Handle("POST /api/v1/projects/{project}/rekey", s.authMiddleware(s.adminOnly(s.unsealedOnly(http.HandlerFunc(s.handleRekeyProject)))))
+
+	// End-to-end encrypted projects (keys are sealed client-side to members)
+	s.mux.Handle("GET /api/v1/projects/{project}/e2e", s.authMiddleware(http.HandlerFunc(s.handleGetProjectE2E)))
+	s.mux.Handle("POST /api/v1/projects/{project}/e2e/members", s.authMiddleware(http.HandlerFunc(s.handleAddE2EMember)))
+	s.mux.Handle("POST /api/v1/projects/{project}/e2e/rotate", s.authMiddleware(http.HandlerFunc(s.handleRotateE2EKey)))
 
 	// Secrets
-	s.mux.Handle("PUT /api/v1/secrets/{project}/{path...}", s.authMiddleware(http.HandlerFunc(s.handlePutSecret)))
-	s.mux.Handle("GET /api/v1/secrets/{project}/{path...}", s.authMiddleware(http.HandlerFunc(s.handleGetSecret)))
-	s.mux.Handle("GET /api/v1/secrets/{project}", s.authMiddleware(http.HandlerFunc(s.handleListSecrets)))
-	s.mux.Handle("DELETE /api/v1/secrets/{project}/{path...}", s.authMiddleware(http.HandlerFunc(s.handleDeleteSecret)))
+	s.mux.Handle("PUT /api/v1/secrets/{project}/{path...}", s.authMiddleware(s.unsealedOnly(http.HandlerFunc(s.handlePutSecret))))
+	s.mux.Handle("GET /api/v1/secrets/{project}/{path...}", s.authMiddleware(s.unsealedOnly(http.HandlerFunc(s.handleGetSecret))))
+	s.mux.Handle("GET /api/v1/secrets/{project}", s.authMiddleware(s.unsealedOnly(http.HandlerFunc(s.handleListSecrets))))
+	s.mux.Handle("DELETE /api/v1/secrets/{project}/{path...}", s.authMiddleware(s.unsealedOnly(http.HandlerFunc(s.handleDeleteSecret))))
+	s.mux.Handle("PATCH /api/v1/secrets/{project}/{path...}", s.authMiddleware(s.unsealedOnly(http.HandlerFunc(s.handlePatchSecret))))
+
+	// Search by label selector and path prefix
+	s.mux.Handle("GET /api/v1/search/secrets", s.authMiddleware(http.HandlerFunc(s.handleSearchSecrets)))
+
+	// Batch reads and writes ({project}:batchGet, {project}:batchPut)
+	s.mux.Handle("POST /api/v1/secrets/{project}", s.authMiddleware(s.unsealedOnly(http.HandlerFunc(s.handleSecretsBatch))))
 
 	// Rotation (POST to path-based endpoints, handled via path suffix matching)
-	s.mux.Handle("POST /api/v1/secrets/{project}/{path...}", s.authMiddleware(http.HandlerFunc(s.handleSecretPost)))
+	s.mux.Handle("POST /api/v1/secrets/{project}/{path...}", s.authMiddleware(s.unsealedOnly(http.HandlerFunc(s.handleSecretPost))))
 
 	// Secret versions
-	s.mux.Handle("GET /api/v1/secret-versions/{project}/{path...}", s.authMiddleware(http.HandlerFunc(s.handleListSecretVersions)))
+	s.mux.Handle("GET /api/v1/secret-versions/{project}/{path...}", s.authMiddleware(s.unsealedOnly(http.HandlerFunc(s.handleListSecretVersions))))
 
 	// Service Accounts
 	s.mux.Handle("POST /api/v1/service-accounts", s.authMiddleware(http.HandlerFunc(s.handleCreateServiceAccount)))
 	s.mux.Handle("GET /api/v1/service-accounts", s.authMiddleware(http.HandlerFunc(s.handleListServiceAccounts)))
+	s.mux.Handle("POST /api/v1/service-accounts/{id}/rotate-token", s.authMiddleware(http.HandlerFunc(s.handleRotateServiceAccountToken)))
 
 	// Policies
 	s.mux.Handle("POST /api/v1/policies", s.authMiddleware(s.adminOnly(http.HandlerFunc(s.handleCreatePolicy))))
@@ -137,6 +227,7 @@ func (s *Server) setupRoutes() {
 	s.mux.Handle("POST /api/v1/orgs", s.authMiddleware(http.HandlerFunc(s.handleCreateOrg)))
 	s.mux.Handle("GET /api/v1/orgs", s.authMiddleware(http.HandlerFunc(s.handleListOrgs)))
 	s.mux.Handle("GET /api/v1/orgs/{id}", s.authMiddleware(http.HandlerFunc(s.handleGetOrg)))
+	s.mux.Handle("PUT /api/v1/orgs/{id}/break-glass", s.authMiddleware(http.HandlerFunc(s.handleSetBreakGlassRules)))
 
 	// Teams (nested under orgs)
 	s.mux.Handle("POST /api/v1/orgs/{id}/teams", s.authMiddleware(http.HandlerFunc(s.handleCreateTeam)))
@@ -152,6 +243,8 @@ func (s *Server) setupRoutes() {
 	s.mux.Handle("GET /api/v1/teams/{id}/agents", s.authMiddleware(http.HandlerFunc(s.handleListAgents)))
 	s.mux.Handle("GET /api/v1/agents/{agentId}", s.authMiddleware(http.HandlerFunc(s.handleGetAgent)))
 	s.mux.Handle("DELETE /api/v1/agents/{agentId}", s.authMiddleware(http.HandlerFunc(s.handleDeleteAgent)))
+	s.mux.Handle("POST /api/v1/agents/{agentId}/rotate-token", s.authMiddleware(http.HandlerFunc(s.handleRotateAgentToken)))
+	s.mux.Handle("PUT /api/v1/agents/{agentId}/role", s.authMiddleware(http.HandlerFunc(s.handleSetAgentRole)))
 
 	// IAM Policies
 	s.mux.Handle("POST /api/v1/iam-policies", s.authMiddleware(http.HandlerFunc(s.handleCreateIAMPolicy)))
@@ -161,7 +254,7 @@ func (s *Server) setupRoutes() {
 	s.mux.Handle("DELETE /api/v1/iam-policies/{id}", s.authMiddleware(http.HandlerFunc(s.handleDeleteIAMPolicy)))
 
 	// Leases (Dynamic Secrets)
-	s.mux.Handle("POST /api/v1/lease/database", s.authMiddleware(http.HandlerFunc(s.handleIssueDatabaseLease)))
+	s.mux.Handle("POST /api/v1/lease/database", s.authMiddleware(s.unsealedOnly(http.HandlerFunc(s.handleIssueDatabaseLease))))
 	s.mux.Handle("POST /api/v1/lease/{id}/revoke", s.authMiddleware(http.HandlerFunc(s.handleRevokeLease)))
 	s.mux.Handle("GET /api/v1/leases", s.authMiddleware(http.HandlerFunc(s.handleListLeases)))
 
@@ -177,7 +270,7 @@ func (s *Server) setupRoutes() {
 	// TEE (Trusted Execution Environment)
 	s.mux.Handle("GET /api/v1/tee/attestation", s.authMiddleware(http.HandlerFunc(s.handleTEEAttestation)))
 	s.mux.Handle("POST /api/v1/tee/session", s.authMiddleware(http.HandlerFunc(s.handleTEESession)))
-	s.mux.Handle("POST /api/v1/tee/read", s.authMiddleware(http.HandlerFunc(s.handleTEERead)))
+	s.mux.Handle("POST /api/v1/tee/read", s.authMiddleware(s.unsealedOnly(http.HandlerFunc(s.handleTEERead))))
 
 	// ZK (Zero-Knowledge) Auth
 	s.mux.Handle("POST /api/v1/auth/zk/credential", s.authMiddleware(http.HandlerFunc(s.handleZKCredential)))
@@ -193,12 +286,48 @@ func (s *Server) setupRoutes() {
 	s.mux.Handle("POST /api/v1/replication/push", s.authMiddleware(http.HandlerFunc(s.handleReplicationPush)))
 	s.mux.Handle("POST /api/v1/replication/pull", s.authMiddleware(http.HandlerFunc(s.handleReplicationPull)))
 	s.mux.Handle("GET /api/v1/replication/status", s.authMiddleware(http.HandlerFunc(s.handleReplicationStatus)))
+
+	// Master key re-wrap (admin-only)
+	s.mux.Handle("GET /api/v1/sys/rewrap", s.authMiddleware(s.adminOnly(http.HandlerFunc(s.handleRewrapStatus))))
+	s.mux.Handle("POST /api/v1/sys/rewrap", s.authMiddleware(s.adminOnly(s.unsealedOnly(http.HandlerFunc(s.handleStartRewrap)))))
+
+	// Seal / unseal (status is public; init, unseal and seal are admin-only)
+	s.mux.HandleFunc("GET /api/v1/sys/seal-status", s.handleSealStatus)
+	s.mux.Handle("POST /api/v1/sys/init", s.authMiddleware(s.adminOnly(http.HandlerFunc(s.handleInit))))
+	s.mux.Handle("POST /api/v1/sys/unseal", s.authMiddleware(s.adminOnly(http.HandlerFunc(s.handleUnseal))))
+	s.mux.Handle("POST /api/v1/sys/seal", s.authMiddleware(s.adminOnly(http.HandlerFunc(s.handleSeal))))
+
+	// Response wrapping (unwrapping needs no login: the token is the credential)
+	s.mux.Handle("POST /api/v1/sys/wrap", s.authMiddleware(s.unsealedOnly(http.HandlerFunc(s.handleWrap))))
+	s.mux.Handle("POST /api/v1/sys/unwrap", s.optionalAuth(s.unsealedOnly(http.HandlerFunc(s.handleUnwrap))))
+	s.mux.Handle("GET /api/v1/sys/wrapping/{accessor}", s.authMiddleware(http.HandlerFunc(s.handleLookupWrappingToken)))
+	s.mux.Handle("DELETE /api/v1/sys/wrapping/{accessor}", s.authMiddleware(http.HandlerFunc(s.handleRevokeWrappingToken)))
+
+	// Transit keys (admin-only management)
+	s.mux.Handle("POST /api/v1/transit/keys", s.authMiddleware(s.adminOnly(s.unsealedOnly(http.HandlerFunc(s.handleCreateTransitKey)))))
+	s.mux.Handle("GET /api/v1/transit/keys", s.authMiddleware(s.adminOnly(http.HandlerFunc(s.handleListTransitKeys))))
+	s.mux.Handle("GET /api/v1/transit/keys/{key}", s.authMiddleware(s.adminOnly(http.HandlerFunc(s.handleGetTransitKey))))
+	s.mux.Handle("POST /api/v1/transit/keys/{key}/rotate", s.authMiddleware(s.adminOnly(s.unsealedOnly(http.HandlerFunc(s.handleRotateTransitKey)))))
+	s.mux.Handle("PUT /api/v1/transit/keys/{key}/config", s.authMiddleware(s.adminOnly(http.HandlerFunc(s.handleUpdateTransitKeyConfig))))
+
+	// Transit operations (per-key policy capabilities on "transit/{key}")
+	s.mux.Handle("POST /api/v1/transit/{key}/encrypt", s.authMiddleware(s.unsealedOnly(http.HandlerFunc(s.handleTransitEncrypt))))
+	s.mux.Handle("POST /api/v1/transit/{key}/decrypt", s.authMiddleware(s.unsealedOnly(http.HandlerFunc(s.handleTransitDecrypt))))
+	s.mux.Handle("POST /api/v1/transit/{key}/rewrap", s.authMiddleware(s.unsealedOnly(http.HandlerFunc(s.handleTransitRewrap))))
+	s.mux.Handle("POST /api/v1/transit/{key}/sign", s.authMiddleware(s.unsealedOnly(http.HandlerFunc(s.handleTransitSign))))
+	s.mux.Handle("POST /api/v1/transit/{key}/verify", s.authMiddleware(s.unsealedOnly(http.HandlerFunc(s.handleTransitVerify))))
+	s.mux.Handle("POST /api/v1/transit/{key}/hmac", s.authMiddleware(s.unsealedOnly(http.HandlerFunc(s.handleTransitHMAC))))
 }
 
 // handleSecretPost dispatches POST requests to secrets paths based on suffix.
 // POST /api/v1/secrets/{project}/{path...} handles:
 //   - .../rotation → set rotation schedule
 //   - .../rotate → manual rotate
+//   - .../rollback → restore an older version
+//   - .../undelete → restore a soft-deleted secret
+//   - .../destroy → wipe chosen versions
+//   - .../move → move to another path or project
+//   - .../copy → copy to another path or project
 func (s *Server) handleSecretPost(w http.ResponseWriter, r *http.Request) {
 	path := r.PathValue("path")
 
@@ -210,8 +339,28 @@ func (s *Server) handleSecretPost(w http.ResponseWriter, r *http.Request) {
 		s.handleManualRotate(w, r)
 		return
 	}
+	if strings.HasSuffix(path, "/rollback") {
+		s.handleRollbackSecret(w, r)
+		return
+	}
+	if strings.HasSuffix(path, "/undelete") {
+		s.handleUndeleteSecret(w, r)
+		return
+	}
+	if strings.HasSuffix(path, "/destroy") {
+		s.handleDestroySecretVersions(w, r)
+		return
+	}
+	if strings.HasSuffix(path, "/move") {
+		s.handleMoveSecret(w, r)
+		return
+	}
+	if strings.HasSuffix(path, "/copy") {
+		s.handleCopySecret(w, r)
+		return
+	}
 
-	writeError(w, http.StatusBadRequest, "use PUT to create/update secrets, or POST to .../rotation or .../rotate")
+	writeError(w, http.StatusBadRequest, "use PUT to create/update secrets, or POST to .../rotation, .../rotate, .../rollback, .../undelete, .../destroy, .../move or .../copy")
 }
 
 func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
@@ -223,5 +372,16 @@ func (s *Server) handleReady(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusServiceUnavailable, "database not ready")
 		return
 	}
-	writeJSON(w, http.StatusOK, map[string]string{"status": "ready"})
+	if s.sealManager != nil {
+		st := s.sealManager.Status()
+		if st.Sealed {
+			writeJSON(w, http.StatusServiceUnavailable, map[string]interface{}{
+				"status":      "sealed",
+				"sealed":      true,
+				"initialized": st.Initialized,
+			})
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"status": "ready", "sealed": false})
 }
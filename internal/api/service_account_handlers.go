@@ -45,7 +45,7 @@ func (s *Server) handleCreateServiceAccount(w http.ResponseWriter, r *http.Reque
 	}
 
 	// Generate token
-	rawToken, tokenHash, err := s.auth.GenerateServiceAccountToken()
+	tokenID, rawToken, tokenHash, err := s.auth.GenerateServiceAccountToken()
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, "failed to generate token")
 		return
@@ -63,7 +63,7 @@ func (s *Server) handleCreateServiceAccount(w http.ResponseWriter, r *http.Reque
 		expiresAt = &t
 	}
 
-	sa, err := s.db.CreateServiceAccount(r.Context(), req.Name, tokenHash, req.ProjectID, req.Scopes, claims.UserID, expiresAt)
+	sa, err := s.db.CreateServiceAccount(r.Context(), req.Name, tokenID, tokenHash, req.ProjectID, req.Scopes, claims.UserID, expiresAt)
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, "failed to create service account")
 		return
@@ -86,6 +86,59 @@ func (s *Server) handleCreateServiceAccount(w http.ResponseWriter, r *http.Reque
 	})
 }
 
+// handleRotateServiceAccountToken replaces the token of a service account
+// with a new one, which is returned once. The old token stops working at
+// once. This is also how tokens issued before token IDs are migrated. The
+// account's creator and admins may rotate it.
+// POST /api/v1/service-accounts/{id}/rotate-token
+func (s *Server) handleRotateServiceAccountToken(w http.ResponseWriter, r *http.Request) {
+	claims := getUserClaims(r.Context())
+	if claims == nil {
+		writeError(w, http.StatusUnauthorized, "user authentication required")
+		return
+	}
+
+	id := r.PathValue("id")
+	if !isValidUUID(id) {
+		writeError(w, http.StatusNotFound, "service account not found")
+		return
+	}
+	sa, err := s.db.GetServiceAccountByID(r.Context(), id)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "service account not found")
+		return
+	}
+	if sa.CreatedBy != claims.UserID && claims.Role != "admin" {
+		writeError(w, http.StatusForbidden, "only the service account's creator or an admin can rotate its token")
+		return
+	}
+
+	tokenID, rawToken, tokenHash, err := s.auth.GenerateServiceAccountToken()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to generate token")
+		return
+	}
+	sa, err = s.db.RotateServiceAccountToken(r.Context(), id, tokenID, tokenHash)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to rotate token")
+		return
+	}
+
+	s.audit.Log(r.Context(), audit.Event{
+		ActorType: "user",
+		ActorID:   claims.UserID,
+		Action:    "service_account.rotate_token",
+		Resource:  "sa:" + sa.ID,
+		Outcome:   "success",
+		IP:        getClientIP(r.Context()),
+	})
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"service_account": sa,
+		"token":           "sa." + rawToken,
+	})
+}
+
 func (s *Server) handleListServiceAccounts(w http.ResponseWriter, r *http.Request) {
 	accounts, err := s.db.ListServiceAccounts(r.Context())
 	if err != nil {
@@ -0,0 +1,237 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/teamvault/teamvault/internal/audit"
+	"github.com/teamvault/teamvault/internal/auth"
+	"github.com/teamvault/teamvault/internal/db"
+)
+
+// refreshRequest is the body of a token refresh.
+type refreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// startSession opens a session for a user who just authenticated with the
+// methods in amr, and issues its first access and refresh tokens. mfa is set
+// if the user verified MFA.
+func (s *Server) startSession(r *http.Request, user *db.User, amr []string, mfa bool) (*tokenResponse, error) {
+	ctx := r.Context()
+	refreshToken, refreshHash, err := s.auth.GenerateRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+	session, err := s.db.CreateSession(ctx, user.ID, refreshHash, clientIP(r), r.UserAgent(), amr, mfa, time.Now().Add(s.auth.RefreshDuration()))
+	if err != nil {
+		return nil, err
+	}
+	token, claims, err := s.auth.GenerateJWT(user.ID, user.Email, user.Role, session.ID, amr, mfa)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.db.SetSessionAccessToken(ctx, session.ID, claims.ID, claims.ExpiresAt.Time); err != nil {
+		return nil, err
+	}
+	return &tokenResponse{Token: token, RefreshToken: refreshToken, ExpiresAt: claims.ExpiresAt.Time}, nil
+}
+
+// handleRefresh exchanges a refresh token for a new access token and a new
+// refresh token; the old ones stop working. The user's email and role are
+// read again, so changes to them apply from the next refresh, and the mfa
+// claim is kept while the session's MFA verification is fresh. Presenting a
+// refresh token that was already exchanged means it leaked: the session is
+// revoked.
+// POST /api/v1/auth/refresh
+func (s *Server) handleRefresh(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var req refreshRequest
+	if err := decodeJSON(r, &req); err != nil || req.RefreshToken == "" {
+		writeError(w, http.StatusBadRequest, "refresh_token is required")
+		return
+	}
+
+	oldHash := auth.HashRefreshToken(req.RefreshToken)
+	session, reused, err := s.db.FindSessionByRefreshToken(ctx, oldHash)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, "invalid refresh token")
+		return
+	}
+	if reused {
+		if _, err := s.db.RevokeSession(ctx, session.ID, ""); err == nil {
+			s.audit.Log(ctx, audit.Event{
+				ActorType: "user",
+				ActorID:   session.UserID,
+				Action:    "auth.refresh",
+				Resource:  "session:" + session.ID,
+				Outcome:   "denied",
+				IP:        clientIP(r),
+				Metadata:  json.RawMessage(`{"reason":"refresh_token_reused","session_revoked":true}`),
+			})
+		}
+		writeError(w, http.StatusUnauthorized, "invalid refresh token")
+		return
+	}
+	if !session.Active() {
+		writeError(w, http.StatusUnauthorized, "session expired or revoked")
+		return
+	}
+
+	user, err := s.db.GetUserByID(ctx, session.UserID)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, "invalid refresh token")
+		return
+	}
+	refreshToken, refreshHash, err := s.auth.GenerateRefreshToken()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to generate token")
+		return
+	}
+	token, claims, err := s.auth.GenerateJWT(user.ID, user.Email, user.Role, session.ID, session.AMR, session.MFAFresh(s.auth.MFAMaxAge()))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to generate token")
+		return
+	}
+	if _, err := s.db.RotateSession(ctx, session.ID, oldHash, refreshHash, claims.ID, claims.ExpiresAt.Time, time.Now().Add(s.auth.RefreshDuration())); err != nil {
+		if strings.Contains(err.Error(), "no longer active") {
+			writeError(w, http.StatusUnauthorized, "invalid refresh token")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "failed to refresh session")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, tokenResponse{Token: token, RefreshToken: refreshToken, ExpiresAt: claims.ExpiresAt.Time})
+}
+
+// handleLogout ends the caller's session: its refresh token and the access
+// token used for the request stop working.
+// POST /api/v1/auth/logout
+func (s *Server) handleLogout(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claims := getUserClaims(ctx)
+	if claims == nil {
+		writeError(w, http.StatusBadRequest, "only user sessions can log out")
+		return
+	}
+	if claims.SessionID == "" {
+		// Tokens issued before sessions cannot be revoked; they expire on their own
+		writeJSON(w, http.StatusOK, map[string]string{"status": "logged out"})
+		return
+	}
+
+	if _, err := s.db.RevokeSession(ctx, claims.SessionID, claims.UserID); err != nil && !strings.Contains(err.Error(), "already revoked") {
+		writeError(w, http.StatusInternalServerError, "failed to log out")
+		return
+	}
+
+	s.audit.Log(ctx, audit.Event{
+		ActorType: "user",
+		ActorID:   claims.UserID,
+		Action:    "auth.logout",
+		Resource:  "session:" + claims.SessionID,
+		Outcome:   "success",
+		IP:        getClientIP(ctx),
+	})
+
+	writeJSON(w, http.StatusOK, map[string]string{"status": "logged out"})
+}
+
+// handleListUserSessions lists the sessions of a user, newest first: by
+// default the active ones, with ?all=true also the revoked and expired ones.
+// GET /api/v1/users/{id}/sessions
+func (s *Server) handleListUserSessions(w http.ResponseWriter, r *http.Request) {
+	userID := r.PathValue("id")
+	if !isValidUUID(userID) {
+		writeError(w, http.StatusNotFound, "user not found")
+		return
+	}
+	if _, err := s.db.GetUserByID(r.Context(), userID); err != nil {
+		writeError(w, http.StatusNotFound, "user not found")
+		return
+	}
+
+	sessions, err := s.db.ListSessions(r.Context(), userID, r.URL.Query().Get("all") != "true")
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to list sessions")
+		return
+	}
+	if sessions == nil {
+		sessions = []db.Session{}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"sessions": sessions})
+}
+
+// handleRevokeUserSessions revokes every active session of a user, signing
+// them out everywhere.
+// DELETE /api/v1/users/{id}/sessions
+func (s *Server) handleRevokeUserSessions(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claims := getUserClaims(ctx)
+	userID := r.PathValue("id")
+	if !isValidUUID(userID) {
+		writeError(w, http.StatusNotFound, "user not found")
+		return
+	}
+	if _, err := s.db.GetUserByID(ctx, userID); err != nil {
+		writeError(w, http.StatusNotFound, "user not found")
+		return
+	}
+
+	sessions, err := s.db.RevokeUserSessions(ctx, userID, claims.UserID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to revoke sessions")
+		return
+	}
+
+	metadata, _ := json.Marshal(map[string]int{"sessions": len(sessions)})
+	s.audit.Log(ctx, audit.Event{
+		ActorType: "user",
+		ActorID:   claims.UserID,
+		Action:    "auth.session.revoke",
+		Resource:  "user:" + userID,
+		Outcome:   "success",
+		IP:        getClientIP(ctx),
+		Metadata:  metadata,
+	})
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"revoked": len(sessions)})
+}
+
+// handleRevokeSession revokes one session.
+// DELETE /api/v1/sessions/{id}
+func (s *Server) handleRevokeSession(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	claims := getUserClaims(ctx)
+	id := r.PathValue("id")
+	if !isValidUUID(id) {
+		writeError(w, http.StatusNotFound, "session not found")
+		return
+	}
+
+	session, err := s.db.RevokeSession(ctx, id, claims.UserID)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			writeError(w, http.StatusNotFound, "session not found or already revoked")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "failed to revoke session")
+		return
+	}
+
+	metadata, _ := json.Marshal(map[string]string{"user": session.UserID})
+	s.audit.Log(ctx, audit.Event{
+		ActorType: "user",
+		ActorID:   claims.UserID,
+		Action:    "auth.session.revoke",
+		Resource:  "session:" + session.ID,
+		Outcome:   "success",
+		IP:        getClientIP(ctx),
+		Metadata:  metadata,
+	})
+
+	writeJSON(w, http.StatusOK, session)
+}
@@ -53,7 +53,8 @@ func (s *Server) handleCreateTeam(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	team, err := s.db.CreateTeam(r.Context(), orgID, req.Name, req.Description)
+	// The creator leads the team, so it can take members without an admin
+	team, err := s.db.CreateTeam(r.Context(), orgID, req.Name, req.Description, claims.UserID, teamLeadRole)
 	if err != nil {
 		if strings.Contains(err.Error(), "duplicate") || strings.Contains(err.Error(), "unique") {
 			writeError(w, http.StatusConflict, "team name already exists in this organization")
@@ -115,6 +116,13 @@ func (s *Server) handleAddTeamMember(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Team roles decide who approves access, so only leads and admins may
+	// hand them out
+	if !isAdmin(r.Context()) && !s.isTeamLead(r.Context(), teamID) {
+		writeError(w, http.StatusForbidden, "only a lead of the team or an admin can add members")
+		return
+	}
+
 	var req addMemberRequest
 	if err := decodeJSON(r, &req); err != nil {
 		writeError(w, http.StatusBadRequest, "invalid request body")
@@ -170,6 +178,11 @@ func (s *Server) handleRemoveTeamMember(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	if !isAdmin(r.Context()) && !s.isTeamLead(r.Context(), teamID) {
+		writeError(w, http.StatusForbidden, "only a lead of the team or an admin can remove members")
+		return
+	}
+
 	var req removeMemberRequest
 	if err := decodeJSON(r, &req); err != nil {
 		writeError(w, http.StatusBadRequest, "invalid request body")
@@ -0,0 +1,110 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/teamvault/teamvault/internal/audit"
+	"github.com/teamvault/teamvault/internal/auth"
+	"github.com/teamvault/teamvault/internal/crypto"
+	"github.com/teamvault/teamvault/internal/db"
+	"github.com/teamvault/teamvault/internal/policy"
+)
+
+// newTestServer returns a server on the database named by
+// TEAMVAULT_TEST_DATABASE_URL, migrated to the current schema, and skips the
+// test when it is unset.
+func newTestServer(t *testing.T) *Server {
+	t.Helper()
+	url := os.Getenv("TEAMVAULT_TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEAMVAULT_TEST_DATABASE_URL is not set")
+	}
+	ctx := context.Background()
+	database, err := db.New(ctx, url)
+	if err != nil {
+		t.Fatalf("connecting to the test database: %v", err)
+	}
+	t.Cleanup(database.Close)
+	if err := database.RunMigrations(ctx, "../../migrations"); err != nil {
+		t.Fatalf("running migrations: %v", err)
+	}
+	ec, err := crypto.NewEnvelopeCrypto(bytes.Repeat([]byte{0x42}, 32))
+	if err != nil {
+		t.Fatalf("NewEnvelopeCrypto: %v", err)
+	}
+	return NewServer(database, auth.New("test-jwt-secret"), ec, policy.NewEngine(database), audit.NewLogger(database))
+}
+
+// newTestUser creates a user with a unique email and returns its ID and a
+// token for it.
+func newTestUser(t *testing.T, s *Server, role string) (id, token string) {
+	t.Helper()
+	suffix := make([]byte, 6)
+	if _, err := rand.Read(suffix); err != nil {
+		t.Fatal(err)
+	}
+	email := "user-" + hex.EncodeToString(suffix) + "@example.com"
+	user, err := s.db.CreateUser(context.Background(), email, "unused", "Test User", role)
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	token, _, err = s.auth.GenerateJWT(user.ID, email, role, "", []string{"pwd"}, false)
+	if err != nil {
+		t.Fatalf("GenerateJWT: %v", err)
+	}
+	return user.ID, token
+}
+
+// do sends a JSON request as the holder of token, checks the response status
+// and decodes the response body into out, if given.
+func do(t *testing.T, s *Server, token, method, path string, body any, wantStatus int, out any) {
+	t.Helper()
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	req := httptest.NewRequest(method, path, &buf)
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, req)
+	if rec.Code != wantStatus {
+		t.Fatalf("%s %s = %d %s, want %d", method, path, rec.Code, rec.Body, wantStatus)
+	}
+	if out != nil {
+		if err := json.Unmarshal(rec.Body.Bytes(), out); err != nil {
+			t.Fatalf("decoding %s %s response: %v", method, path, err)
+		}
+	}
+}
+
+func TestCreatorLeadsTeam(t *testing.T) {
+	s := newTestServer(t)
+	creatorID, creator := newTestUser(t, s, "member")
+	memberID, member := newTestUser(t, s, "member")
+
+	var org db.Org
+	do(t, s, creator, "POST", "/api/v1/orgs", map[string]string{"name": "org-" + creatorID}, http.StatusCreated, &org)
+	var team db.Team
+	do(t, s, creator, "POST", "/api/v1/orgs/"+org.ID+"/teams", map[string]string{"name": "payments"}, http.StatusCreated, &team)
+
+	var members []db.TeamMember
+	do(t, s, creator, "GET", "/api/v1/teams/"+team.ID+"/members", nil, http.StatusOK, &members)
+	if len(members) != 1 || members[0].UserID != creatorID || members[0].Role != teamLeadRole {
+		t.Fatalf("members of a new team = %+v, want its creator as %s", members, teamLeadRole)
+	}
+
+	do(t, s, creator, "POST", "/api/v1/teams/"+team.ID+"/members", map[string]string{"user_id": memberID}, http.StatusCreated, nil)
+	// A plain member is not a lead and cannot add members in turn
+	do(t, s, member, "POST", "/api/v1/teams/"+team.ID+"/members", map[string]string{"user_id": creatorID}, http.StatusForbidden, nil)
+}
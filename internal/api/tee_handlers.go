@@ -8,6 +8,7 @@ import (
 	"sync"
 
 	"github.com/teamvault/teamvault/internal/audit"
+	"github.com/teamvault/teamvault/internal/crypto"
 	"github.com/teamvault/teamvault/internal/tee"
 )
 
@@ -188,6 +189,10 @@ func (s *Server) handleTEERead(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusNotFound, "project not found")
 		return
 	}
+	if project.IsE2E() {
+		writeError(w, http.StatusConflict, "TEE read is not available for end-to-end encrypted projects")
+		return
+	}
 
 	secret, err := s.db.GetSecret(ctx, project.ID, req.Path)
 	if err != nil {
@@ -201,10 +206,27 @@ func (s *Server) handleTEERead(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	kek, err := s.projectKEK(ctx, project.ID, sv.KEKVersion)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "enclave decryption failed")
+		return
+	}
+	defer kek.Zero()
+
 	// Decrypt inside the enclave
-	plaintext, err := s.teeHandlers.enclave.Decrypt(
-		sv.Ciphertext, sv.EncryptedDEK, sv.Nonce, sv.DEKNonce,
-	)
+	plaintext, err := s.teeHandlers.enclave.Decrypt(&crypto.EncryptedData{
+		Ciphertext:       sv.Ciphertext,
+		Nonce:            sv.Nonce,
+		EncryptedDEK:     sv.EncryptedDEK,
+		DEKNonce:         sv.DEKNonce,
+		MasterKeyVersion: sv.MasterKeyVersion,
+		KEKVersion:       sv.KEKVersion,
+		Format:           sv.FormatVersion,
+	}, &crypto.EncryptionContext{
+		ProjectID: project.ID,
+		SecretID:  secret.ID,
+		Version:   sv.Version,
+	}, kek)
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, "enclave decryption failed")
 		return
@@ -0,0 +1,413 @@
+package api
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/teamvault/teamvault/internal/audit"
+	"github.com/teamvault/teamvault/internal/policy"
+	"github.com/teamvault/teamvault/internal/transit"
+)
+
+type createTransitKeyRequest struct {
+	Name string `json:"name"`
+	Type string `json:"type"` // "aes256-gcm" (default) or "ed25519"
+}
+
+type transitKeyConfigRequest struct {
+	MinDecryptVersion int `json:"min_decrypt_version"`
+}
+
+// transitDataRequest is the body of every transit operation. Binary fields
+// (plaintext, context, input) are base64-encoded.
+type transitDataRequest struct {
+	Plaintext  string `json:"plaintext,omitempty"`
+	Ciphertext string `json:"ciphertext,omitempty"`
+	Context    string `json:"context,omitempty"`
+	Input      string `json:"input,omitempty"`
+	Signature  string `json:"signature,omitempty"`
+	HMAC       string `json:"hmac,omitempty"`
+}
+
+type transitDataResponse struct {
+	Ciphertext string `json:"ciphertext,omitempty"`
+	Plaintext  string `json:"plaintext,omitempty"`
+	Signature  string `json:"signature,omitempty"`
+	HMAC       string `json:"hmac,omitempty"`
+	KeyVersion int    `json:"key_version,omitempty"`
+}
+
+// ---- Key management (admin) ----
+
+// handleCreateTransitKey creates a named transit key.
+// POST /api/v1/transit/keys
+func (s *Server) handleCreateTransitKey(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if s.transitManager == nil {
+		writeError(w, http.StatusServiceUnavailable, "transit not available")
+		return
+	}
+
+	var req createTransitKeyRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	key, err := s.transitManager.CreateKey(ctx, req.Name, req.Type, getActorID(ctx))
+	if err != nil {
+		if isDBConflictError(err) {
+			writeError(w, http.StatusConflict, "transit key already exists")
+			return
+		}
+		writeTransitError(w, err)
+		return
+	}
+
+	s.audit.Log(ctx, audit.Event{
+		ActorType: getActorType(ctx),
+		ActorID:   getActorID(ctx),
+		Action:    "transit.key.create",
+		Resource:  "transit/" + key.Name,
+		Outcome:   "success",
+		IP:        getClientIP(ctx),
+		Metadata:  json.RawMessage(`{"type":"` + key.KeyType + `"}`),
+	})
+
+	writeJSON(w, http.StatusCreated, key)
+}
+
+// handleListTransitKeys lists transit keys (metadata only).
+// GET /api/v1/transit/keys
+func (s *Server) handleListTransitKeys(w http.ResponseWriter, r *http.Request) {
+	if s.transitManager == nil {
+		writeError(w, http.StatusServiceUnavailable, "transit not available")
+		return
+	}
+
+	keys, err := s.transitManager.ListKeys(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to list transit keys")
+		return
+	}
+	if keys == nil {
+		writeJSON(w, http.StatusOK, []interface{}{})
+		return
+	}
+	writeJSON(w, http.StatusOK, keys)
+}
+
+// handleGetTransitKey returns a transit key's metadata.
+// GET /api/v1/transit/keys/{key}
+func (s *Server) handleGetTransitKey(w http.ResponseWriter, r *http.Request) {
+	if s.transitManager == nil {
+		writeError(w, http.StatusServiceUnavailable, "transit not available")
+		return
+	}
+
+	key, err := s.transitManager.GetKey(r.Context(), r.PathValue("key"))
+	if err != nil {
+		writeTransitError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, key)
+}
+
+// handleRotateTransitKey adds a new version to a transit key.
+// POST /api/v1/transit/keys/{key}/rotate
+func (s *Server) handleRotateTransitKey(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if s.transitManager == nil {
+		writeError(w, http.StatusServiceUnavailable, "transit not available")
+		return
+	}
+
+	name := r.PathValue("key")
+	key, err := s.transitManager.RotateKey(ctx, name)
+	if err != nil {
+		writeTransitError(w, err)
+		return
+	}
+
+	s.audit.Log(ctx, audit.Event{
+		ActorType: getActorType(ctx),
+		ActorID:   getActorID(ctx),
+		Action:    "transit.key.rotate",
+		Resource:  "transit/" + name,
+		Outcome:   "success",
+		IP:        getClientIP(ctx),
+		Metadata:  json.RawMessage(`{"latest_version":` + itoa(key.LatestVersion) + `}`),
+	})
+
+	writeJSON(w, http.StatusOK, key)
+}
+
+// handleUpdateTransitKeyConfig updates a transit key's min_decrypt_version.
+// PUT /api/v1/transit/keys/{key}/config
+func (s *Server) handleUpdateTransitKeyConfig(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if s.transitManager == nil {
+		writeError(w, http.StatusServiceUnavailable, "transit not available")
+		return
+	}
+
+	var req transitKeyConfigRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	name := r.PathValue("key")
+	key, err := s.transitManager.SetMinDecryptVersion(ctx, name, req.MinDecryptVersion)
+	if err != nil {
+		writeTransitError(w, err)
+		return
+	}
+
+	s.audit.Log(ctx, audit.Event{
+		ActorType: getActorType(ctx),
+		ActorID:   getActorID(ctx),
+		Action:    "transit.key.config",
+		Resource:  "transit/" + name,
+		Outcome:   "success",
+		IP:        getClientIP(ctx),
+		Metadata:  json.RawMessage(`{"min_decrypt_version":` + itoa(key.MinDecryptVersion) + `}`),
+	})
+
+	writeJSON(w, http.StatusOK, key)
+}
+
+// ---- Operations ----
+
+// handleTransitEncrypt encrypts base64 plaintext with the latest key version.
+// POST /api/v1/transit/{key}/encrypt
+func (s *Server) handleTransitEncrypt(w http.ResponseWriter, r *http.Request) {
+	req, ok := s.authorizeTransit(w, r, transit.OpEncrypt)
+	if !ok {
+		return
+	}
+	plaintext, err := base64.StdEncoding.DecodeString(req.Plaintext)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "plaintext must be base64-encoded")
+		return
+	}
+	aad, ok := decodeTransitContext(w, req)
+	if !ok {
+		return
+	}
+
+	ciphertext, version, err := s.transitManager.Encrypt(r.Context(), r.PathValue("key"), plaintext, aad)
+	s.finishTransit(w, r, transit.OpEncrypt, version, err, transitDataResponse{Ciphertext: ciphertext, KeyVersion: version})
+}
+
+// handleTransitDecrypt decrypts a transit ciphertext and returns base64 plaintext.
+// POST /api/v1/transit/{key}/decrypt
+func (s *Server) handleTransitDecrypt(w http.ResponseWriter, r *http.Request) {
+	req, ok := s.authorizeTransit(w, r, transit.OpDecrypt)
+	if !ok {
+		return
+	}
+	aad, ok := decodeTransitContext(w, req)
+	if !ok {
+		return
+	}
+
+	plaintext, version, err := s.transitManager.Decrypt(r.Context(), r.PathValue("key"), req.Ciphertext, aad)
+	s.finishTransit(w, r, transit.OpDecrypt, version, err, transitDataResponse{
+		Plaintext:  base64.StdEncoding.EncodeToString(plaintext),
+		KeyVersion: version,
+	})
+}
+
+// handleTransitRewrap re-encrypts a ciphertext under the latest key version.
+// POST /api/v1/transit/{key}/rewrap
+func (s *Server) handleTransitRewrap(w http.ResponseWriter, r *http.Request) {
+	req, ok := s.authorizeTransit(w, r, transit.OpRewrap)
+	if !ok {
+		return
+	}
+	aad, ok := decodeTransitContext(w, req)
+	if !ok {
+		return
+	}
+
+	ciphertext, version, err := s.transitManager.Rewrap(r.Context(), r.PathValue("key"), req.Ciphertext, aad)
+	s.finishTransit(w, r, transit.OpRewrap, version, err, transitDataResponse{Ciphertext: ciphertext, KeyVersion: version})
+}
+
+// handleTransitSign signs base64 input with an Ed25519 key.
+// POST /api/v1/transit/{key}/sign
+func (s *Server) handleTransitSign(w http.ResponseWriter, r *http.Request) {
+	req, ok := s.authorizeTransit(w, r, transit.OpSign)
+	if !ok {
+		return
+	}
+	input, err := base64.StdEncoding.DecodeString(req.Input)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "input must be base64-encoded")
+		return
+	}
+
+	signature, version, err := s.transitManager.Sign(r.Context(), r.PathValue("key"), input)
+	s.finishTransit(w, r, transit.OpSign, version, err, transitDataResponse{Signature: signature, KeyVersion: version})
+}
+
+// handleTransitVerify checks a signature (Ed25519 keys) or an HMAC (any key).
+// POST /api/v1/transit/{key}/verify
+func (s *Server) handleTransitVerify(w http.ResponseWriter, r *http.Request) {
+	req, ok := s.authorizeTransit(w, r, transit.OpVerify)
+	if !ok {
+		return
+	}
+	input, err := base64.StdEncoding.DecodeString(req.Input)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "input must be base64-encoded")
+		return
+	}
+	if (req.Signature == "") == (req.HMAC == "") {
+		writeError(w, http.StatusBadRequest, "exactly one of signature or hmac is required")
+		return
+	}
+
+	var valid bool
+	if req.Signature != "" {
+		valid, err = s.transitManager.Verify(r.Context(), r.PathValue("key"), input, req.Signature)
+	} else {
+		valid, err = s.transitManager.VerifyHMAC(r.Context(), r.PathValue("key"), input, req.HMAC)
+	}
+	s.finishTransit(w, r, transit.OpVerify, 0, err, map[string]bool{"valid": valid})
+}
+
+// handleTransitHMAC computes an HMAC-SHA256 of base64 input.
+// POST /api/v1/transit/{key}/hmac
+func (s *Server) handleTransitHMAC(w http.ResponseWriter, r *http.Request) {
+	req, ok := s.authorizeTransit(w, r, transit.OpHMAC)
+	if !ok {
+		return
+	}
+	input, err := base64.StdEncoding.DecodeString(req.Input)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "input must be base64-encoded")
+		return
+	}
+
+	mac, version, err := s.transitManager.HMAC(r.Context(), r.PathValue("key"), input)
+	s.finishTransit(w, r, transit.OpHMAC, version, err, transitDataResponse{HMAC: mac, KeyVersion: version})
+}
+
+// ---- Helpers ----
+
+// authorizeTransit decodes the request body and checks that the caller holds
+// the op capability on "transit/{key}". Transit keys belong to no
+// organization, but an agent's request is also checked against the IAM
+// policies of its team's organization. It writes the error response and
+// returns false if the request cannot proceed.
+func (s *Server) authorizeTransit(w http.ResponseWriter, r *http.Request, op string) (*transitDataRequest, bool) {
+	ctx := r.Context()
+	if s.transitManager == nil {
+		writeError(w, http.StatusServiceUnavailable, "transit not available")
+		return nil, false
+	}
+
+	resource := "transit/" + r.PathValue("key")
+	policyReq := policy.Request{
+		SubjectType: getActorType(ctx),
+		SubjectID:   getActorID(ctx),
+		Action:      op,
+		Resource:    resource,
+		IsAdmin:     isAdmin(ctx),
+		Attributes:  requestAttributes(ctx),
+	}
+	if claims := getAgentClaims(ctx); claims != nil {
+		policyReq.OrgID = claims.OrgID
+	}
+	policyResult, err := s.policy.Evaluate(ctx, policyReq)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "policy evaluation failed")
+		return nil, false
+	}
+	if !policyResult.Allowed {
+		s.audit.Log(ctx, audit.Event{
+			ActorType: getActorType(ctx),
+			ActorID:   getActorID(ctx),
+			Action:    "transit." + op,
+			Resource:  resource,
+			Outcome:   "denied",
+			IP:        getClientIP(ctx),
+			Metadata:  json.RawMessage(`{"reason":"` + policyResult.Reason + `"}`),
+		})
+		writeError(w, http.StatusForbidden, policyResult.Reason)
+		return nil, false
+	}
+
+	var req transitDataRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return nil, false
+	}
+	return &req, true
+}
+
+// finishTransit audits a transit operation (never including data or key
+// material) and writes either the result or the mapped error.
+func (s *Server) finishTransit(w http.ResponseWriter, r *http.Request, op string, version int, opErr error, result interface{}) {
+	ctx := r.Context()
+	outcome := "success"
+	if opErr != nil {
+		outcome = "error"
+	}
+	var meta json.RawMessage
+	if version > 0 {
+		meta = json.RawMessage(`{"key_version":` + itoa(version) + `}`)
+	}
+	s.audit.Log(ctx, audit.Event{
+		ActorType: getActorType(ctx),
+		ActorID:   getActorID(ctx),
+		Action:    "transit." + op,
+		Resource:  "transit/" + r.PathValue("key"),
+		Outcome:   outcome,
+		IP:        getClientIP(ctx),
+		Metadata:  meta,
+	})
+
+	if opErr != nil {
+		writeTransitError(w, opErr)
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// decodeTransitContext decodes the optional base64 context (AES-GCM
+// associated data) of an encrypt, decrypt or rewrap request.
+func decodeTransitContext(w http.ResponseWriter, req *transitDataRequest) ([]byte, bool) {
+	if req.Context == "" {
+		return nil, true
+	}
+	aad, err := base64.StdEncoding.DecodeString(req.Context)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "context must be base64-encoded")
+		return nil, false
+	}
+	return aad, true
+}
+
+// writeTransitError maps transit errors to HTTP responses.
+func writeTransitError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, transit.ErrKeyNotFound):
+		writeError(w, http.StatusNotFound, "transit key not found")
+	case errors.Is(err, transit.ErrInvalidKeyName):
+		writeError(w, http.StatusBadRequest, "key name must be 1-64 characters of [a-zA-Z0-9_-] and not \"keys\"")
+	case errors.Is(err, transit.ErrInvalidKeyType):
+		writeError(w, http.StatusBadRequest, "type must be \"aes256-gcm\" or \"ed25519\"")
+	case errors.Is(err, transit.ErrUnsupportedOperation),
+		errors.Is(err, transit.ErrInvalidConfig),
+		errors.Is(err, transit.ErrInvalidCiphertext),
+		errors.Is(err, transit.ErrVersionDisabled):
+		writeError(w, http.StatusBadRequest, err.Error())
+	default:
+		writeError(w, http.StatusInternalServerError, "transit operation failed")
+	}
+}
@@ -0,0 +1,423 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/teamvault/teamvault/internal/audit"
+	"github.com/teamvault/teamvault/internal/crypto"
+	"github.com/teamvault/teamvault/internal/db"
+)
+
+// wrapTTLHeader asks for the response of a request to be wrapped: stored
+// under a single-use token valid for the given TTL ("24h" or seconds) and
+// replaced by the token.
+const wrapTTLHeader = "X-TeamVault-Wrap-TTL"
+
+// maxWrapTTL caps how long a wrapped response can wait to be unwrapped.
+const maxWrapTTL = 7 * 24 * time.Hour
+
+// wrappingTokenPrefix marks wrapping tokens, like "sa." marks service
+// account tokens.
+const wrappingTokenPrefix = "wrap."
+
+// wrapInfo is returned instead of a wrapped response.
+type wrapInfo struct {
+	Token        string    `json:"token"`
+	Accessor     string    `json:"accessor"`
+	TTL          int       `json:"ttl"` // seconds
+	ExpiresAt    time.Time `json:"expires_at"`
+	CreationPath string    `json:"creation_path"`
+}
+
+type wrapRequest struct {
+	Data json.RawMessage `json:"data"`
+	TTL  string          `json:"ttl,omitempty"` // default 24h
+}
+
+type unwrapRequest struct {
+	Token string `json:"token"`
+}
+
+// parseWrapTTL parses a wrapping TTL given as a duration or in seconds.
+func parseWrapTTL(v string) (time.Duration, error) {
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		secs, serr := strconv.Atoi(v)
+		if serr != nil {
+			return 0, fmt.Errorf("wrap ttl must be a duration such as \"24h\" or a number of seconds")
+		}
+		d = time.Duration(secs) * time.Second
+	}
+	if d <= 0 || d > maxWrapTTL {
+		return 0, fmt.Errorf("wrap ttl must be positive and at most %s", maxWrapTTL)
+	}
+	return d, nil
+}
+
+// wrappingTokenHash returns the hash a wrapping token is stored under. The
+// token has 256 random bits, so a plain SHA-256 is enough.
+func wrappingTokenHash(token string) string {
+	sum := sha256.Sum256([]byte(strings.TrimPrefix(token, wrappingTokenPrefix)))
+	return hex.EncodeToString(sum[:])
+}
+
+// wrappingContext binds a wrapped response to its token.
+func wrappingContext(tokenHash string) *crypto.EncryptionContext {
+	return &crypto.EncryptionContext{Purpose: "wrapped-response", SecretID: tokenHash}
+}
+
+// wrappedProjects collects the projects whose secret values a request with a
+// wrapped response reads, so the wrapping token can be revoked when one of
+// them is deleted.
+type wrappedProjects struct {
+	mu  sync.Mutex
+	ids []string
+}
+
+// noteProjectRead records that the request read secret values of a project,
+// if its response is being wrapped.
+func noteProjectRead(ctx context.Context, projectID string) {
+	wp, _ := ctx.Value(ctxWrappedProjects).(*wrappedProjects)
+	if wp == nil {
+		return
+	}
+	wp.mu.Lock()
+	defer wp.mu.Unlock()
+	if !slices.Contains(wp.ids, projectID) {
+		wp.ids = append(wp.ids, projectID)
+	}
+}
+
+// wrapResponse encrypts a response body under a new wrapping token and
+// audits its creation. It never logs the body. projectIDs are the projects
+// whose secret values the body holds.
+func (s *Server) wrapResponse(ctx context.Context, body []byte, ttl time.Duration, creationPath string, projectIDs []string) (*wrapInfo, error) {
+	tokenBytes := make([]byte, 32)
+	if _, err := rand.Read(tokenBytes); err != nil {
+		return nil, fmt.Errorf("generating wrapping token: %w", err)
+	}
+	token := wrappingTokenPrefix + hex.EncodeToString(tokenBytes)
+	tokenHash := wrappingTokenHash(token)
+
+	encrypted, err := s.crypto.Encrypt(body, wrappingContext(tokenHash))
+	if err != nil {
+		return nil, fmt.Errorf("encrypting wrapped response: %w", err)
+	}
+
+	// Nothing else removes expired tokens while deleted secret purging is off
+	s.db.DeleteExpiredWrappingTokens(ctx)
+
+	t, err := s.db.CreateWrappingToken(ctx, &db.WrappingToken{
+		TokenHash:        tokenHash,
+		Ciphertext:       encrypted.Ciphertext,
+		Nonce:            encrypted.Nonce,
+		EncryptedDEK:     encrypted.EncryptedDEK,
+		DEKNonce:         encrypted.DEKNonce,
+		MasterKeyVersion: encrypted.MasterKeyVersion,
+		FormatVersion:    encrypted.Format,
+		CreationPath:     creationPath,
+		ProjectIDs:       projectIDs,
+		CreatedByType:    getActorType(ctx),
+		CreatedBy:        getActorID(ctx),
+		ExpiresAt:        time.Now().Add(ttl),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	metadata, _ := json.Marshal(map[string]interface{}{
+		"creation_path": creationPath,
+		"ttl":           int(ttl.Seconds()),
+		"expires_at":    t.ExpiresAt.UTC().Format(time.RFC3339),
+	})
+	s.audit.Log(ctx, audit.Event{
+		ActorType: getActorType(ctx),
+		ActorID:   getActorID(ctx),
+		Action:    "response.wrap",
+		Resource:  "wrapping/" + t.ID,
+		Outcome:   "success",
+		IP:        getClientIP(ctx),
+		Metadata:  metadata,
+	})
+
+	return &wrapInfo{
+		Token:        token,
+		Accessor:     t.ID,
+		TTL:          int(ttl.Seconds()),
+		ExpiresAt:    t.ExpiresAt.UTC(),
+		CreationPath: creationPath,
+	}, nil
+}
+
+// wrapRecorder buffers a response so it can be wrapped.
+type wrapRecorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (rec *wrapRecorder) Header() http.Header         { return rec.header }
+func (rec *wrapRecorder) WriteHeader(code int)        { rec.status = code }
+func (rec *wrapRecorder) Write(b []byte) (int, error) { return rec.body.Write(b) }
+
+// responseWrapping wraps the response of any authenticated request that sets
+// the X-TeamVault-Wrap-TTL header. Successful responses are replaced by a
+// wrap_info holding a single-use token; errors are returned unchanged, as
+// there is nothing to protect in them.
+func (s *Server) responseWrapping(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := r.Header.Get(wrapTTLHeader)
+		if header == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ttl, err := parseWrapTTL(header)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		rec := &wrapRecorder{header: http.Header{}, status: http.StatusOK}
+		projects := &wrappedProjects{}
+		next.ServeHTTP(rec, r.WithContext(context.WithValue(r.Context(), ctxWrappedProjects, projects)))
+		if rec.status < 200 || rec.status > 299 {
+			for k, v := range rec.header {
+				w.Header()[k] = v
+			}
+			w.WriteHeader(rec.status)
+			w.Write(rec.body.Bytes())
+			return
+		}
+
+		info, err := s.wrapResponse(r.Context(), rec.body.Bytes(), ttl, r.URL.Path, projects.ids)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "failed to wrap response")
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"wrap_info": info})
+	})
+}
+
+// optionalAuth authenticates requests that carry credentials and lets
+// anonymous ones through, for endpoints such as unwrapping where the token
+// in the body is the credential.
+func (s *Server) optionalAuth(next http.Handler) http.Handler {
+	authenticated := s.authMiddleware(next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "" {
+			authenticated.ServeHTTP(w, r)
+			return
+		}
+		ctx := context.WithValue(r.Context(), ctxClientIP, clientIP(r))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// handleWrap wraps arbitrary data, for sharing something that is not stored
+// in the vault.
+// POST /api/v1/sys/wrap
+func (s *Server) handleWrap(w http.ResponseWriter, r *http.Request) {
+	var req wrapRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if len(req.Data) == 0 || string(req.Data) == "null" {
+		writeError(w, http.StatusBadRequest, "data is required")
+		return
+	}
+	ttl := 24 * time.Hour
+	if req.TTL != "" {
+		var err error
+		if ttl, err = parseWrapTTL(req.TTL); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	body, _ := json.Marshal(map[string]json.RawMessage{"data": req.Data})
+	info, err := s.wrapResponse(r.Context(), body, ttl, r.URL.Path, nil)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to wrap data")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"wrap_info": info})
+}
+
+// handleUnwrap returns the response stored under a wrapping token and
+// destroys it, so it can be unwrapped only once. No login is needed: the
+// token is the credential. Callers that do authenticate are recorded as the
+// unwrapper; anonymous ones are recorded by token accessor and IP.
+// POST /api/v1/sys/unwrap
+func (s *Server) handleUnwrap(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var req unwrapRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	token := strings.TrimSpace(req.Token)
+	if !strings.HasPrefix(token, wrappingTokenPrefix) {
+		writeError(w, http.StatusBadRequest, "token must be a wrapping token")
+		return
+	}
+
+	actorType, actorID := getActorType(ctx), getActorID(ctx)
+	unwrapperType := actorType
+	if unwrapperType == "" {
+		unwrapperType = "anonymous"
+	}
+
+	var body []byte
+	t, err := s.db.UnwrapToken(ctx, wrappingTokenHash(token), unwrapperType, actorID, func(t *db.WrappingToken) error {
+		var err error
+		body, err = s.crypto.Decrypt(&crypto.EncryptedData{
+			Ciphertext:       t.Ciphertext,
+			Nonce:            t.Nonce,
+			EncryptedDEK:     t.EncryptedDEK,
+			DEKNonce:         t.DEKNonce,
+			MasterKeyVersion: t.MasterKeyVersion,
+			Format:           t.FormatVersion,
+		}, wrappingContext(t.TokenHash))
+		return err
+	})
+	if t == nil {
+		if err != nil && strings.Contains(err.Error(), "not found") {
+			writeError(w, http.StatusNotFound, "wrapping token not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "failed to unwrap")
+		return
+	}
+
+	// Anonymous unwrappers have no ID of their own; the accessor ties the
+	// event to the token's creation
+	if actorType == "" {
+		actorType, actorID = "wrapping_token", t.ID
+	}
+	meta := map[string]interface{}{
+		"creation_path":   t.CreationPath,
+		"created_by":      t.CreatedBy,
+		"created_by_type": t.CreatedByType,
+		"user_agent":      r.UserAgent(),
+	}
+	event := audit.Event{
+		ActorType: actorType,
+		ActorID:   actorID,
+		Action:    "response.unwrap",
+		Resource:  "wrapping/" + t.ID,
+		Outcome:   "success",
+		IP:        getClientIP(ctx),
+	}
+
+	if err != nil {
+		status, msg := http.StatusInternalServerError, "failed to unwrap"
+		switch {
+		case strings.Contains(err.Error(), "already used"):
+			status, msg = http.StatusGone, "wrapping token already used"
+			meta["unwrapped_at"] = t.UnwrappedAt.UTC().Format(time.RFC3339)
+		case strings.Contains(err.Error(), "expired"):
+			status, msg = http.StatusGone, "wrapping token expired"
+		}
+		meta["reason"] = msg
+		event.Outcome = "denied"
+		if status == http.StatusInternalServerError {
+			event.Outcome = "error"
+		}
+		event.Metadata, _ = json.Marshal(meta)
+		s.audit.Log(ctx, event)
+		writeError(w, status, msg)
+		return
+	}
+
+	event.Metadata, _ = json.Marshal(meta)
+	s.audit.Log(ctx, event)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
+
+// wrappingTokenFor loads a wrapping token by accessor for its creator or an
+// admin, writing the error response if that fails.
+func (s *Server) wrappingTokenFor(w http.ResponseWriter, r *http.Request) *db.WrappingToken {
+	ctx := r.Context()
+	accessor := r.PathValue("accessor")
+	if !isValidUUID(accessor) {
+		writeError(w, http.StatusNotFound, "wrapping token not found")
+		return nil
+	}
+	t, err := s.db.GetWrappingToken(ctx, accessor)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			writeError(w, http.StatusNotFound, "wrapping token not found")
+		} else {
+			writeError(w, http.StatusInternalServerError, "failed to get wrapping token")
+		}
+		return nil
+	}
+	if !isAdmin(ctx) && (t.CreatedByType != getActorType(ctx) || t.CreatedBy != getActorID(ctx)) {
+		writeError(w, http.StatusForbidden, "only the creator of a wrapping token or an admin can manage it")
+		return nil
+	}
+	return t
+}
+
+// handleLookupWrappingToken shows whether a wrapping token has been used, and
+// by whom, without using it.
+// GET /api/v1/sys/wrapping/{accessor}
+func (s *Server) handleLookupWrappingToken(w http.ResponseWriter, r *http.Request) {
+	t := s.wrappingTokenFor(w, r)
+	if t == nil {
+		return
+	}
+	writeJSON(w, http.StatusOK, t)
+}
+
+// handleRevokeWrappingToken destroys an unused wrapping token.
+// DELETE /api/v1/sys/wrapping/{accessor}
+func (s *Server) handleRevokeWrappingToken(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	t := s.wrappingTokenFor(w, r)
+	if t == nil {
+		return
+	}
+	if t.UnwrappedAt != nil {
+		writeError(w, http.StatusConflict, "wrapping token already used")
+		return
+	}
+	if err := s.db.RevokeWrappingToken(ctx, t.ID); err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			writeError(w, http.StatusConflict, "wrapping token already used")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "failed to revoke wrapping token")
+		return
+	}
+
+	metadata, _ := json.Marshal(map[string]string{"creation_path": t.CreationPath})
+	s.audit.Log(ctx, audit.Event{
+		ActorType: getActorType(ctx),
+		ActorID:   getActorID(ctx),
+		Action:    "response.revoke",
+		Resource:  "wrapping/" + t.ID,
+		Outcome:   "success",
+		IP:        getClientIP(ctx),
+		Metadata:  metadata,
+	})
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -24,6 +24,10 @@ func NewLogger(database *db.DB) *Logger {
 	return &Logger{database: database}
 }
 
+// SystemActorID is the actor ID of events recorded by background jobs rather
+// than a user or service account (actor_id is a UUID column).
+const SystemActorID = "00000000-0000-0000-0000-000000000000"
+
 // Event represents the data for creating an audit event.
 type Event struct {
 	ActorType string          // "user" or "service_account"
@@ -1,23 +1,30 @@
 // Package auth handles JWT token generation/validation, password hashing,
-// and service account token generation.
+// refresh tokens, TOTP multi-factor authentication, and service account token
+// generation.
 package auth
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"golang.org/x/crypto/bcrypt"
 )
 
-// Claims represents JWT claims for a user session.
+// Claims represents JWT claims for a user session. The JWT ID (jti) lets
+// the token be revoked before it expires.
 type Claims struct {
-	UserID string `json:"user_id"`
-	Email  string `json:"email"`
-	Role   string `json:"role"`
+	UserID    string   `json:"user_id"`
+	Email     string   `json:"email"`
+	Role      string   `json:"role"`
+	SessionID string   `json:"sid,omitempty"` // the session the token was issued for
+	AMR       []string `json:"amr,omitempty"` // how the user authenticated: "pwd", "oidc", "otp", "recovery"
+	MFA       bool     `json:"mfa,omitempty"` // whether MFA was verified recently enough to count
 	jwt.RegisteredClaims
 }
 
@@ -28,20 +35,46 @@ type ServiceAccountClaims struct {
 	Scopes           []string `json:"scopes"`
 }
 
+// AgentClaims represents claims for an agent token validation context.
+type AgentClaims struct {
+	AgentID  string   `json:"agent_id"`
+	Name     string   `json:"name"`
+	TeamID   string   `json:"team_id"`
+	TeamName string   `json:"team_name"`
+	OrgID    string   `json:"org_id"` // of the team
+	Role     string   `json:"role,omitempty"`
+	Scopes   []string `json:"scopes"`
+}
+
 // Auth handles authentication operations.
 type Auth struct {
-	jwtSecret     []byte
-	tokenDuration time.Duration
+	jwtSecret       []byte
+	tokenDuration   time.Duration
+	refreshDuration time.Duration
+	mfaMaxAge       time.Duration
 }
 
 // New creates a new Auth instance.
 func New(jwtSecret string) *Auth {
 	return &Auth{
-		jwtSecret:     []byte(jwtSecret),
-		tokenDuration: 1 * time.Hour,
+		jwtSecret:       []byte(jwtSecret),
+		tokenDuration:   1 * time.Hour,
+		refreshDuration: 30 * 24 * time.Hour,
+		mfaMaxAge:       12 * time.Hour,
 	}
 }
 
+// RefreshDuration is how long a session lasts without being refreshed.
+func (a *Auth) RefreshDuration() time.Duration {
+	return a.refreshDuration
+}
+
+// MFAMaxAge is how long an MFA verification counts for a session; after
+// that its tokens no longer carry the mfa claim until the user steps up.
+func (a *Auth) MFAMaxAge() time.Duration {
+	return a.mfaMaxAge
+}
+
 // HashPassword hashes a password using bcrypt.
 func (a *Auth) HashPassword(password string) (string, error) {
 	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
@@ -56,14 +89,25 @@ func (a *Auth) CheckPassword(password, hash string) error {
 	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
 }
 
-// GenerateJWT creates a signed JWT token for a user.
-func (a *Auth) GenerateJWT(userID, email, role string) (string, error) {
+// GenerateJWT creates a signed JWT token for a user's session, with the
+// authentication methods used and whether MFA counts. It returns the claims
+// too, for the token's ID and expiry.
+func (a *Auth) GenerateJWT(userID, email, role, sessionID string, amr []string, mfa bool) (string, *Claims, error) {
+	jtiBytes := make([]byte, 16)
+	if _, err := rand.Read(jtiBytes); err != nil {
+		return "", nil, fmt.Errorf("generating token id: %w", err)
+	}
+
 	now := time.Now()
 	claims := &Claims{
-		UserID: userID,
-		Email:  email,
-		Role:   role,
+		UserID:    userID,
+		Email:     email,
+		Role:      role,
+		SessionID: sessionID,
+		AMR:       amr,
+		MFA:       mfa,
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        hex.EncodeToString(jtiBytes),
 			ExpiresAt: jwt.NewNumericDate(now.Add(a.tokenDuration)),
 			IssuedAt:  jwt.NewNumericDate(now),
 			NotBefore: jwt.NewNumericDate(now),
@@ -71,8 +115,29 @@ func (a *Auth) GenerateJWT(userID, email, role string) (string, error) {
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(a.jwtSecret)
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(a.jwtSecret)
+	if err != nil {
+		return "", nil, err
+	}
+	return token, claims, nil
+}
+
+// GenerateRefreshToken generates a random refresh token. Returns the raw
+// token (to give to the user) and its hash (to store in DB).
+func (a *Auth) GenerateRefreshToken() (rawToken, tokenHash string, err error) {
+	tokenBytes := make([]byte, 32)
+	if _, err := rand.Read(tokenBytes); err != nil {
+		return "", "", fmt.Errorf("generating refresh token: %w", err)
+	}
+	rawToken = hex.EncodeToString(tokenBytes)
+	return rawToken, HashRefreshToken(rawToken), nil
+}
+
+// HashRefreshToken returns the hash a refresh token is stored and looked up
+// by. The token is random, so a plain SHA-256 is enough.
+func HashRefreshToken(rawToken string) string {
+	sum := sha256.Sum256([]byte(rawToken))
+	return hex.EncodeToString(sum[:])
 }
 
 // ValidateJWT parses and validates a JWT token.
@@ -95,22 +160,41 @@ func (a *Auth) ValidateJWT(tokenString string) (*Claims, error) {
 	return claims, nil
 }
 
-// GenerateServiceAccountToken generates a random token for a service account.
-// Returns the raw token (to give to the user) and the bcrypt hash (to store in DB).
-func (a *Auth) GenerateServiceAccountToken() (rawToken string, tokenHash string, err error) {
+// GenerateServiceAccountToken generates a random token for a service account
+// or agent. The token is "<token ID>.<secret>": the token ID is public and
+// stored as is, so the account can be looked up by it, and only the secret is
+// hashed. Returns the token ID, the raw token (to give to the user) and the
+// bcrypt hash of the secret (to store in DB).
+func (a *Auth) GenerateServiceAccountToken() (tokenID, rawToken, tokenHash string, err error) {
+	idBytes := make([]byte, 8)
+	if _, err := rand.Read(idBytes); err != nil {
+		return "", "", "", fmt.Errorf("generating token id: %w", err)
+	}
 	tokenBytes := make([]byte, 32)
 	if _, err := rand.Read(tokenBytes); err != nil {
-		return "", "", fmt.Errorf("generating random token: %w", err)
+		return "", "", "", fmt.Errorf("generating random token: %w", err)
 	}
 
-	rawToken = hex.EncodeToString(tokenBytes)
+	tokenID = hex.EncodeToString(idBytes)
+	secret := hex.EncodeToString(tokenBytes)
 
-	hash, err := bcrypt.GenerateFromPassword([]byte(rawToken), bcrypt.DefaultCost)
+	hash, err := bcrypt.GenerateFromPassword([]byte(secret), bcrypt.DefaultCost)
 	if err != nil {
-		return "", "", fmt.Errorf("hashing token: %w", err)
+		return "", "", "", fmt.Errorf("hashing token: %w", err)
 	}
 
-	return rawToken, string(hash), nil
+	return tokenID, tokenID + "." + secret, string(hash), nil
+}
+
+// SplitServiceAccountToken splits a raw service account or agent token (without
+// its "sa." or "agent." prefix) into its token ID and secret. ok is false for
+// tokens issued before tokens had IDs, which are the secret alone.
+func SplitServiceAccountToken(rawToken string) (tokenID, secret string, ok bool) {
+	tokenID, secret, ok = strings.Cut(rawToken, ".")
+	if !ok || tokenID == "" || secret == "" {
+		return "", rawToken, false
+	}
+	return tokenID, secret, true
 }
 
 // ValidateServiceAccountToken checks a raw token against a bcrypt hash.
@@ -0,0 +1,173 @@
+package auth
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// TOTP parameters (RFC 6238 defaults, which every authenticator app supports).
+const (
+	totpPeriod = 30 * time.Second
+	totpDigits = 6
+	totpSkew   = 1 // steps accepted before and after the current one
+)
+
+// recoveryCodeAlphabet leaves out characters that are easy to misread.
+const recoveryCodeAlphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+
+var b32 = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateTOTPSecret generates a random TOTP secret, base32-encoded as
+// authenticator apps expect it.
+func GenerateTOTPSecret() (string, error) {
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generating TOTP secret: %w", err)
+	}
+	return b32.EncodeToString(b), nil
+}
+
+// TOTPURI returns the otpauth:// URI of a TOTP secret, which authenticator
+// apps import directly or from a QR code of it.
+func TOTPURI(issuer, account, secret string) string {
+	v := url.Values{}
+	v.Set("secret", secret)
+	v.Set("issuer", issuer)
+	v.Set("algorithm", "SHA1")
+	v.Set("digits", fmt.Sprint(totpDigits))
+	v.Set("period", fmt.Sprint(int(totpPeriod.Seconds())))
+	return "otpauth://totp/" + url.PathEscape(issuer+":"+account) + "?" + v.Encode()
+}
+
+// ValidateTOTP checks a code against a TOTP secret at time now, allowing for
+// clock skew of one period. It returns the time step the code belongs to, so
+// the caller can refuse a code that was already used.
+func ValidateTOTP(secret, code string, now time.Time) (step int64, ok bool) {
+	key, err := b32.DecodeString(strings.ToUpper(secret))
+	if err != nil || len(code) != totpDigits {
+		return 0, false
+	}
+	current := now.Unix() / int64(totpPeriod.Seconds())
+	for s := current - totpSkew; s <= current+totpSkew; s++ {
+		if subtle.ConstantTimeCompare([]byte(totpCode(key, s)), []byte(code)) == 1 {
+			return s, true
+		}
+	}
+	return 0, false
+}
+
+// totpCode computes the code of a time step (RFC 4226 dynamic truncation).
+func totpCode(key []byte, step int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	n := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, n%1000000)
+}
+
+// SealTOTPSecret encrypts a TOTP secret for storage with a key derived from
+// the JWT secret. Unlike secret values it must stay readable while the vault
+// is sealed, or admins with MFA could not log in to unseal it.
+func (a *Auth) SealTOTPSecret(secret string) (string, error) {
+	gcm, err := a.totpCipher()
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("generating nonce: %w", err)
+	}
+	return base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, []byte(secret), nil)), nil
+}
+
+// OpenTOTPSecret decrypts a TOTP secret sealed by SealTOTPSecret.
+func (a *Auth) OpenTOTPSecret(sealed string) (string, error) {
+	gcm, err := a.totpCipher()
+	if err != nil {
+		return "", err
+	}
+	b, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil || len(b) < gcm.NonceSize() {
+		return "", errors.New("malformed TOTP secret")
+	}
+	secret, err := gcm.Open(nil, b[:gcm.NonceSize()], b[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", fmt.Errorf("decrypting TOTP secret: %w", err)
+	}
+	return string(secret), nil
+}
+
+func (a *Auth) totpCipher() (cipher.AEAD, error) {
+	mac := hmac.New(sha256.New, a.jwtSecret)
+	mac.Write([]byte("teamvault totp secret"))
+	block, err := aes.NewCipher(mac.Sum(nil))
+	if err != nil {
+		return nil, fmt.Errorf("creating cipher: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// GenerateRecoveryCodes generates n single-use recovery codes of the form
+// "xxxxx-xxxxx". Returns the codes (to give to the user) and their bcrypt
+// hashes (to store in DB).
+func (a *Auth) GenerateRecoveryCodes(n int) (codes, hashes []string, err error) {
+	for i := 0; i < n; i++ {
+		b := make([]byte, 10)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, fmt.Errorf("generating recovery code: %w", err)
+		}
+		for j := range b {
+			b[j] = recoveryCodeAlphabet[int(b[j])%len(recoveryCodeAlphabet)]
+		}
+		code := string(b[:5]) + "-" + string(b[5:])
+		hash, err := bcrypt.GenerateFromPassword([]byte(code), bcrypt.DefaultCost)
+		if err != nil {
+			return nil, nil, fmt.Errorf("hashing recovery code: %w", err)
+		}
+		codes = append(codes, code)
+		hashes = append(hashes, string(hash))
+	}
+	return codes, hashes, nil
+}
+
+// ValidateRecoveryCode checks a recovery code against a bcrypt hash.
+func (a *Auth) ValidateRecoveryCode(code, hash string) bool {
+	code = strings.ToLower(strings.TrimSpace(code))
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(code)) == nil
+}
+
+// GenerateMFAToken generates the token of a pending second login step.
+// Returns the raw token (to give to the user) and its hash (to store in DB).
+func GenerateMFAToken() (rawToken, tokenHash string, err error) {
+	tokenBytes := make([]byte, 32)
+	if _, err := rand.Read(tokenBytes); err != nil {
+		return "", "", fmt.Errorf("generating mfa token: %w", err)
+	}
+	rawToken = hex.EncodeToString(tokenBytes)
+	return rawToken, HashMFAToken(rawToken), nil
+}
+
+// HashMFAToken returns the hash a second login step token is stored and
+// looked up by.
+func HashMFAToken(rawToken string) string {
+	return HashRefreshToken(rawToken)
+}
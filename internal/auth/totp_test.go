@@ -0,0 +1,166 @@
+package auth
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA-1 seed of the RFC 6238 test vectors, the ASCII
+// string "12345678901234567890", base32-encoded.
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// RFC 6238 appendix B lists 8-digit codes; 6-digit codes are their last six
+// digits.
+var rfc6238Vectors = []struct {
+	unix int64
+	code string
+}{
+	{59, "287082"},
+	{1111111109, "081804"},
+	{1111111111, "050471"},
+	{1234567890, "005924"},
+	{2000000000, "279037"},
+	{20000000000, "353130"},
+}
+
+func TestTOTPCodeRFC6238(t *testing.T) {
+	key, err := b32.DecodeString(rfc6238Secret)
+	if err != nil {
+		t.Fatalf("decoding secret: %v", err)
+	}
+	for _, tt := range rfc6238Vectors {
+		if got := totpCode(key, tt.unix/30); got != tt.code {
+			t.Errorf("totpCode at %d = %s, want %s", tt.unix, got, tt.code)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	for _, tt := range rfc6238Vectors {
+		now := time.Unix(tt.unix, 0)
+		step, ok := ValidateTOTP(rfc6238Secret, tt.code, now)
+		if !ok || step != tt.unix/30 {
+			t.Errorf("ValidateTOTP(%s) at %d = %d, %v, want %d, true", tt.code, tt.unix, step, ok, tt.unix/30)
+		}
+	}
+
+	// 1111111111 is step 37037037; its code is valid one step either side
+	code := "050471"
+	tests := []struct {
+		name   string
+		secret string
+		code   string
+		unix   int64
+		wantOK bool
+	}{
+		{"same step", rfc6238Secret, code, 1111111111, true},
+		{"one step later", rfc6238Secret, code, 1111111111 + 30, true},
+		{"one step earlier", rfc6238Secret, code, 1111111111 - 30, true},
+		{"two steps later", rfc6238Secret, code, 1111111111 + 60, false},
+		{"two steps earlier", rfc6238Secret, code, 1111111111 - 60, false},
+		{"lowercase secret", strings.ToLower(rfc6238Secret), code, 1111111111, true},
+		{"wrong code", rfc6238Secret, "050472", 1111111111, false},
+		{"8-digit code", rfc6238Secret, "14050471", 1111111111, false},
+		{"short code", rfc6238Secret, "50471", 1111111111, false},
+		{"empty code", rfc6238Secret, "", 1111111111, false},
+		{"invalid secret", "not base32!", code, 1111111111, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, ok := ValidateTOTP(tt.secret, tt.code, time.Unix(tt.unix, 0))
+			if ok != tt.wantOK {
+				t.Fatalf("ValidateTOTP = %v, want %v", ok, tt.wantOK)
+			}
+			if ok && step != 37037037 {
+				t.Errorf("step = %d, want the step the code belongs to, 37037037", step)
+			}
+		})
+	}
+}
+
+func TestGenerateTOTPSecret(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatalf("GenerateTOTPSecret: %v", err)
+	}
+	key, err := b32.DecodeString(secret)
+	if err != nil || len(key) != 20 {
+		t.Fatalf("secret %q is not 20 base32-encoded bytes: %v", secret, err)
+	}
+	code := totpCode(key, time.Now().Unix()/30)
+	if _, ok := ValidateTOTP(secret, code, time.Now()); !ok {
+		t.Error("a current code of a generated secret does not validate")
+	}
+}
+
+func TestTOTPURI(t *testing.T) {
+	uri := TOTPURI("TeamVault", "alice@example.com", rfc6238Secret)
+	u, err := url.Parse(uri)
+	if err != nil {
+		t.Fatalf("parsing %q: %v", uri, err)
+	}
+	if u.Scheme != "otpauth" || u.Host != "totp" || u.Path != "/TeamVault:alice@example.com" {
+		t.Errorf("URI %q does not name a TOTP account TeamVault:alice@example.com", uri)
+	}
+	want := map[string]string{
+		"secret":    rfc6238Secret,
+		"issuer":    "TeamVault",
+		"algorithm": "SHA1",
+		"digits":    "6",
+		"period":    "30",
+	}
+	for k, v := range want {
+		if got := u.Query().Get(k); got != v {
+			t.Errorf("%s = %q, want %q", k, got, v)
+		}
+	}
+}
+
+func TestSealTOTPSecret(t *testing.T) {
+	a := New("test-jwt-secret")
+	sealed, err := a.SealTOTPSecret(rfc6238Secret)
+	if err != nil {
+		t.Fatalf("SealTOTPSecret: %v", err)
+	}
+	if strings.Contains(sealed, rfc6238Secret) {
+		t.Fatal("sealed secret contains the secret")
+	}
+	got, err := a.OpenTOTPSecret(sealed)
+	if err != nil || got != rfc6238Secret {
+		t.Fatalf("OpenTOTPSecret = %q, %v, want %q", got, err, rfc6238Secret)
+	}
+
+	if _, err := New("other-jwt-secret").OpenTOTPSecret(sealed); err == nil {
+		t.Error("a secret sealed under one JWT secret opened under another")
+	}
+	if _, err := a.OpenTOTPSecret("AAAA"); err == nil {
+		t.Error("OpenTOTPSecret accepted a malformed value")
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	a := New("test-jwt-secret")
+	codes, hashes, err := a.GenerateRecoveryCodes(3)
+	if err != nil {
+		t.Fatalf("GenerateRecoveryCodes: %v", err)
+	}
+	if len(codes) != 3 || len(hashes) != 3 {
+		t.Fatalf("got %d codes and %d hashes, want 3 each", len(codes), len(hashes))
+	}
+	for i, code := range codes {
+		if len(code) != 11 || code[5] != '-' {
+			t.Errorf("code %q is not of the form xxxxx-xxxxx", code)
+		}
+		if !a.ValidateRecoveryCode(code, hashes[i]) {
+			t.Errorf("code %q does not match its hash", code)
+		}
+		if !a.ValidateRecoveryCode(" "+strings.ToUpper(code)+"\n", hashes[i]) {
+			t.Errorf("code %q typed in uppercase with spaces does not match", code)
+		}
+		if a.ValidateRecoveryCode(code, hashes[(i+1)%len(hashes)]) {
+			t.Errorf("code %q matches another code's hash", code)
+		}
+	}
+}
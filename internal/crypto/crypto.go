@@ -1,5 +1,11 @@
 // Package crypto implements envelope encryption for secret values.
-// Each secret version gets a unique DEK (Data Encryption Key) encrypted by a master key.
+// Each secret version gets a unique DEK (Data Encryption Key) encrypted by a
+// master key, either directly or through a per-project KEK (Key Encryption
+// Key) that is itself wrapped by the master key.
+// Master key wrapping is done by a KeyProvider: either an in-memory versioned
+// keyring (the default) or an external KMS reached over HTTP. New DEKs are
+// always wrapped with the newest master key version, while older versions
+// remain available to decrypt rows that have not been re-wrapped yet.
 package crypto
 
 import (
@@ -11,22 +17,78 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"strconv"
 	"strings"
 )
 
+// Ciphertext formats, recorded per row so data written before associated
+// data was introduced keeps decrypting.
+const (
+	// FormatV1 ciphertexts were sealed without associated data.
+	FormatV1 = 1
+	// FormatV2 ciphertexts bind the value to its EncryptionContext via
+	// AES-GCM associated data, so rows cannot be swapped between secrets
+	// or versions.
+	FormatV2 = 2
+	// FormatE2E values were encrypted client-side to an end-to-end
+	// encrypted project's key (see package e2e). The server stores them
+	// as opaque blobs and can never decrypt them.
+	FormatE2E = 3
+)
+
 // EncryptedData holds all the components of an envelope-encrypted value.
 type EncryptedData struct {
 	Ciphertext       []byte
 	Nonce            []byte
 	EncryptedDEK     []byte
 	DEKNonce         []byte
-	MasterKeyVersion int
+	MasterKeyVersion int // master key that wraps the DEK; 0 when KEKVersion is set
+	KEKVersion       int // project KEK that wraps the DEK; 0 means the master key does
+	Format           int // FormatV1 or FormatV2; 0 is treated as FormatV1
+}
+
+// KEK is an unwrapped per-project key encryption key. Callers must Zero it
+// once the operation that needed it is done.
+type KEK struct {
+	Version int
+	Key     []byte
+}
+
+// Zero overwrites the key bytes.
+func (k *KEK) Zero() {
+	if k == nil {
+		return
+	}
+	for i := range k.Key {
+		k.Key[i] = 0
+	}
+}
+
+// EncryptionContext identifies the secret version a ciphertext belongs to.
+// It is authenticated (not encrypted) as AES-GCM associated data.
+type EncryptionContext struct {
+	ProjectID string
+	SecretID  string
+	Version   int
+	// Purpose separates values that are not secret versions (e.g.
+	// "transit-key") from secrets with the same IDs. Empty means "secret".
+	Purpose string
+}
+
+// AAD returns the associated data bytes for the context.
+func (c *EncryptionContext) AAD() []byte {
+	purpose := c.Purpose
+	if purpose == "" {
+		purpose = "secret"
+	}
+	return []byte(fmt.Sprintf("teamvault/%s/v2\x00%s\x00%s\x00%d", purpose, c.ProjectID, c.SecretID, c.Version))
 }
 
 // EnvelopeCrypto handles envelope encryption using AES-256-GCM.
+// DEK wrapping is delegated to a KeyProvider so the root key can live
+// outside the API process.
 type EnvelopeCrypto struct {
-	masterKey        []byte
-	masterKeyVersion int
+	provider KeyProvider
 }
 
 // NewEnvelopeCrypto creates a new EnvelopeCrypto instance.
@@ -34,23 +96,75 @@ type EnvelopeCrypto struct {
 //   - MASTER_KEY env var (hex-encoded 32 bytes)
 //   - MASTER_KEY_FILE env var (path to file containing hex-encoded key)
 //   - Direct byte slice
+//
+// A single key is registered as master key version 1.
 func NewEnvelopeCrypto(masterKey []byte) (*EnvelopeCrypto, error) {
-	if len(masterKey) != 32 {
-		return nil, fmt.Errorf("master key must be exactly 32 bytes, got %d", len(masterKey))
+	return NewEnvelopeCryptoWithKeyring(map[int][]byte{1: masterKey})
+}
+
+// NewEnvelopeCryptoWithKeyring creates an EnvelopeCrypto backed by an
+// in-memory keyring of master keys indexed by version.
+func NewEnvelopeCryptoWithKeyring(keys map[int][]byte) (*EnvelopeCrypto, error) {
+	provider, err := NewLocalKeyProvider(keys)
+	if err != nil {
+		return nil, err
 	}
-	return &EnvelopeCrypto{
-		masterKey:        masterKey,
-		masterKeyVersion: 1,
-	}, nil
+	return NewEnvelopeCryptoWithProvider(provider)
+}
+
+// NewEnvelopeCryptoWithProvider creates an EnvelopeCrypto that wraps DEKs
+// with the given key provider.
+func NewEnvelopeCryptoWithProvider(provider KeyProvider) (*EnvelopeCrypto, error) {
+	if provider == nil {
+		return nil, errors.New("key provider is required")
+	}
+	return &EnvelopeCrypto{provider: provider}, nil
 }
 
-// NewEnvelopeCryptoFromEnv loads the master key from environment variables.
+// NewEnvelopeCryptoFromEnv builds an EnvelopeCrypto from environment variables.
+//
+// KEY_PROVIDER selects where the root key lives: "local" (default) keeps the
+// keyring in process memory, "kms" delegates wrapping to an external KMS
+// (see NewHTTPKMSProviderFromEnv). Sealed mode ("shamir") is set up by the
+// server itself via NewEnvelopeCryptoWithProvider.
+//
+// For the local provider, MASTER_KEY (or the contents of MASTER_KEY_FILE) is
+// either a single hex key, which becomes version 1, or a keyring of
+// "version:hexkey" entries separated by commas or newlines, e.g.
+// "1:ab12...,2:cd34...". The highest version is used for new encryptions;
+// older versions are kept for decryption only.
 func NewEnvelopeCryptoFromEnv() (*EnvelopeCrypto, error) {
+	switch providerName := os.Getenv("KEY_PROVIDER"); providerName {
+	case "", "local":
+	case "kms":
+		provider, err := NewHTTPKMSProviderFromEnv()
+		if err != nil {
+			return nil, err
+		}
+		return NewEnvelopeCryptoWithProvider(provider)
+	default:
+		return nil, fmt.Errorf("unknown KEY_PROVIDER %q (expected \"local\" or \"kms\")", providerName)
+	}
+
+	keys, err := KeyringFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	if keys == nil {
+		return nil, errors.New("MASTER_KEY or MASTER_KEY_FILE environment variable required")
+	}
+
+	return NewEnvelopeCryptoWithKeyring(keys)
+}
+
+// KeyringFromEnv parses the keyring in MASTER_KEY or MASTER_KEY_FILE.
+// It returns nil, nil if neither variable is set.
+func KeyringFromEnv() (map[int][]byte, error) {
 	keyHex := os.Getenv("MASTER_KEY")
 	if keyHex == "" {
 		keyFile := os.Getenv("MASTER_KEY_FILE")
 		if keyFile == "" {
-			return nil, errors.New("MASTER_KEY or MASTER_KEY_FILE environment variable required")
+			return nil, nil
 		}
 		data, err := os.ReadFile(keyFile)
 		if err != nil {
@@ -59,19 +173,86 @@ func NewEnvelopeCryptoFromEnv() (*EnvelopeCrypto, error) {
 		keyHex = strings.TrimSpace(string(data))
 	}
 
-	key, err := hex.DecodeString(keyHex)
-	if err != nil {
-		return nil, fmt.Errorf("decoding master key hex: %w", err)
+	return ParseKeyring(keyHex)
+}
+
+// ParseKeyring parses a master key specification into a keyring.
+// See NewEnvelopeCryptoFromEnv for the accepted formats.
+func ParseKeyring(spec string) (map[int][]byte, error) {
+	spec = strings.TrimSpace(spec)
+	if !strings.Contains(spec, ":") {
+		key, err := hex.DecodeString(spec)
+		if err != nil {
+			return nil, fmt.Errorf("decoding master key hex: %w", err)
+		}
+		return map[int][]byte{1: key}, nil
+	}
+
+	keys := make(map[int][]byte)
+	entries := strings.FieldsFunc(spec, func(r rune) bool {
+		return r == ',' || r == '\n' || r == '\r' || r == ' ' || r == '\t'
+	})
+	for _, entry := range entries {
+		parts := strings.SplitN(entry, ":", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid keyring entry %q: expected VERSION:HEXKEY", entry)
+		}
+		version, err := strconv.Atoi(parts[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid master key version %q", parts[0])
+		}
+		if _, dup := keys[version]; dup {
+			return nil, fmt.Errorf("duplicate master key version %d", version)
+		}
+		key, err := hex.DecodeString(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("decoding master key v%d hex: %w", version, err)
+		}
+		keys[version] = key
 	}
+	return keys, nil
+}
+
+// Provider returns the key provider that wraps DEKs.
+func (ec *EnvelopeCrypto) Provider() KeyProvider {
+	return ec.provider
+}
+
+// CurrentKeyVersion returns the master key version used for new encryptions.
+func (ec *EnvelopeCrypto) CurrentKeyVersion() int {
+	return ec.provider.CurrentVersion()
+}
+
+// KeyVersions returns all master key versions known to the provider, oldest
+// first.
+func (ec *EnvelopeCrypto) KeyVersions() []int {
+	return ec.provider.Versions()
+}
 
-	return NewEnvelopeCrypto(key)
+// Sealed reports whether the key provider is currently unable to wrap or
+// unwrap DEKs because it is sealed. Providers that cannot be sealed never are.
+func (ec *EnvelopeCrypto) Sealed() bool {
+	if sp, ok := ec.provider.(interface{ Sealed() bool }); ok {
+		return sp.Sealed()
+	}
+	return false
 }
 
 // Encrypt performs envelope encryption on plaintext.
 // 1. Generate a random DEK
-// 2. Encrypt plaintext with DEK using AES-256-GCM
+// 2. Encrypt plaintext with DEK using AES-256-GCM, binding ectx as AAD
 // 3. Encrypt DEK with master key using AES-256-GCM
-func (ec *EnvelopeCrypto) Encrypt(plaintext []byte) (*EncryptedData, error) {
+//
+// ectx should identify the secret version being written. A nil context
+// produces a FormatV1 ciphertext and is only meant for values that do not
+// belong to a secret (e.g. lease credentials).
+func (ec *EnvelopeCrypto) Encrypt(plaintext []byte, ectx *EncryptionContext) (*EncryptedData, error) {
+	return ec.EncryptWithKEK(plaintext, ectx, nil)
+}
+
+// EncryptWithKEK is Encrypt with the DEK wrapped by a project KEK instead of
+// the master key. A nil kek wraps with the master key.
+func (ec *EnvelopeCrypto) EncryptWithKEK(plaintext []byte, ectx *EncryptionContext, kek *KEK) (*EncryptedData, error) {
 	// Generate random DEK (32 bytes for AES-256)
 	dek := make([]byte, 32)
 	if _, err := io.ReadFull(rand.Reader, dek); err != nil {
@@ -79,43 +260,69 @@ func (ec *EnvelopeCrypto) Encrypt(plaintext []byte) (*EncryptedData, error) {
 	}
 
 	// Encrypt plaintext with DEK
-	ciphertext, nonce, err := aesGCMEncrypt(dek, plaintext)
+	format, aad := FormatV1, []byte(nil)
+	if ectx != nil {
+		format, aad = FormatV2, ectx.AAD()
+	}
+	ciphertext, nonce, err := aesGCMEncrypt(dek, plaintext, aad)
 	if err != nil {
 		return nil, fmt.Errorf("encrypting plaintext with DEK: %w", err)
 	}
 
-	// Encrypt DEK with master key
-	encryptedDEK, dekNonce, err := aesGCMEncrypt(ec.masterKey, dek)
-	if err != nil {
-		return nil, fmt.Errorf("encrypting DEK with master key: %w", err)
-	}
+	// Wrap DEK with the KEK or the provider's current master key
+	wrapped, err := ec.wrapDEK(dek, kek)
 
 	// Zero out plaintext DEK from memory
 	for i := range dek {
 		dek[i] = 0
 	}
 
-	return &EncryptedData{
-		Ciphertext:       ciphertext,
-		Nonce:            nonce,
-		EncryptedDEK:     encryptedDEK,
-		DEKNonce:         dekNonce,
-		MasterKeyVersion: ec.masterKeyVersion,
-	}, nil
+	if err != nil {
+		return nil, err
+	}
+
+	wrapped.Ciphertext = ciphertext
+	wrapped.Nonce = nonce
+	wrapped.Format = format
+	return wrapped, nil
 }
 
 // Decrypt performs envelope decryption.
-// 1. Decrypt DEK with master key
-// 2. Decrypt ciphertext with DEK
-func (ec *EnvelopeCrypto) Decrypt(data *EncryptedData) ([]byte, error) {
-	// Decrypt DEK with master key
-	dek, err := aesGCMDecrypt(ec.masterKey, data.EncryptedDEK, data.DEKNonce)
+// 1. Decrypt DEK with the master key version recorded on the data
+// 2. Decrypt ciphertext with DEK, verifying ectx for FormatV2 data
+//
+// ectx must describe where the row was read from; a FormatV2 ciphertext
+// that was moved to another secret or version fails to decrypt.
+func (ec *EnvelopeCrypto) Decrypt(data *EncryptedData, ectx *EncryptionContext) ([]byte, error) {
+	return ec.DecryptWithKEK(data, ectx, nil)
+}
+
+// DecryptWithKEK is Decrypt for data whose DEK may be wrapped by a project
+// KEK. kek must be the version recorded in data.KEKVersion, or nil when the
+// DEK is wrapped by the master key.
+func (ec *EnvelopeCrypto) DecryptWithKEK(data *EncryptedData, ectx *EncryptionContext, kek *KEK) ([]byte, error) {
+	var aad []byte
+	switch data.Format {
+	case 0, FormatV1:
+	case FormatV2:
+		if ectx == nil {
+			return nil, errors.New("encryption context required for format v2 ciphertext")
+		}
+		aad = ectx.AAD()
+	case FormatE2E:
+		return nil, errors.New("end-to-end encrypted value cannot be decrypted by the server")
+	default:
+		return nil, fmt.Errorf("unknown ciphertext format %d", data.Format)
+	}
+
+	// Unwrap DEK with the KEK or master key version it was wrapped under
+	dek, err := ec.unwrapDEK(data, kek)
 	if err != nil {
-		return nil, fmt.Errorf("decrypting DEK: %w", err)
+		return nil, err
 	}
 
 	// Decrypt ciphertext with DEK
-	plaintext, err := aesGCMDecrypt(dek, data.Ciphertext, data.Nonce)
+	plaintext, err := aesGCMDecrypt(dek, data.Ciphertext, data.Nonce, aad)
 	if err != nil {
 		// Zero out DEK before returning error
 		for i := range dek {
@@ -132,8 +339,138 @@ func (ec *EnvelopeCrypto) Decrypt(data *EncryptedData) ([]byte, error) {
 	return plaintext, nil
 }
 
+// RewrapDEK re-encrypts the DEK of data under the current master key.
+// The ciphertext and its nonce are left untouched, so the returned value
+// decrypts to the same plaintext without the plaintext ever being produced.
+func (ec *EnvelopeCrypto) RewrapDEK(data *EncryptedData) (*EncryptedData, error) {
+	return ec.RewrapDEKWithKEK(data, nil, nil)
+}
+
+// RewrapDEKWithKEK moves the DEK of data from one wrapping key to another:
+// from and to are project KEKs, or nil for the master key. Like RewrapDEK it
+// never touches the ciphertext.
+func (ec *EnvelopeCrypto) RewrapDEKWithKEK(data *EncryptedData, from, to *KEK) (*EncryptedData, error) {
+	dek, err := ec.unwrapDEK(data, from)
+	if err != nil {
+		return nil, err
+	}
+
+	rewrapped, err := ec.wrapDEK(dek, to)
+
+	// Zero out DEK from memory
+	for i := range dek {
+		dek[i] = 0
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	rewrapped.Ciphertext = data.Ciphertext
+	rewrapped.Nonce = data.Nonce
+	rewrapped.Format = data.Format
+	return rewrapped, nil
+}
+
+// NewKEK generates a project KEK of the given version and wraps it with the
+// current master key. The wrapped form is returned in the EncryptedDEK,
+// DEKNonce and MasterKeyVersion fields, so RewrapDEK also re-wraps KEKs.
+func (ec *EnvelopeCrypto) NewKEK(version int) (*KEK, *EncryptedData, error) {
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, nil, fmt.Errorf("generating KEK: %w", err)
+	}
+
+	wrapped, err := ec.wrapDEK(key, nil)
+	if err != nil {
+		for i := range key {
+			key[i] = 0
+		}
+		return nil, nil, fmt.Errorf("wrapping KEK: %w", err)
+	}
+	return &KEK{Version: version, Key: key}, wrapped, nil
+}
+
+// UnwrapKEK decrypts a project KEK produced by NewKEK.
+func (ec *EnvelopeCrypto) UnwrapKEK(wrapped *EncryptedData, version int) (*KEK, error) {
+	key, err := ec.provider.UnwrapDEK(wrapped.EncryptedDEK, wrapped.DEKNonce, wrapped.MasterKeyVersion)
+	if err != nil {
+		return nil, fmt.Errorf("decrypting KEK: %w", err)
+	}
+	return &KEK{Version: version, Key: key}, nil
+}
+
+// wrapDEK wraps dek with kek, or with the current master key if kek is nil.
+// Only the wrapping fields of the result are set.
+func (ec *EnvelopeCrypto) wrapDEK(dek []byte, kek *KEK) (*EncryptedData, error) {
+	if kek != nil {
+		encryptedDEK, dekNonce, err := aesGCMEncrypt(kek.Key, dek, nil)
+		if err != nil {
+			return nil, fmt.Errorf("wrapping DEK with KEK: %w", err)
+		}
+		return &EncryptedData{
+			EncryptedDEK: encryptedDEK,
+			DEKNonce:     dekNonce,
+			KEKVersion:   kek.Version,
+		}, nil
+	}
+
+	encryptedDEK, dekNonce, version, err := ec.provider.WrapDEK(dek)
+	if err != nil {
+		return nil, fmt.Errorf("wrapping DEK: %w", err)
+	}
+	return &EncryptedData{
+		EncryptedDEK:     encryptedDEK,
+		DEKNonce:         dekNonce,
+		MasterKeyVersion: version,
+	}, nil
+}
+
+// unwrapDEK unwraps the DEK of data with kek, which must match the KEK
+// version recorded on data (nil for master-key-wrapped DEKs).
+func (ec *EnvelopeCrypto) unwrapDEK(data *EncryptedData, kek *KEK) ([]byte, error) {
+	if data.KEKVersion == 0 {
+		dek, err := ec.provider.UnwrapDEK(data.EncryptedDEK, data.DEKNonce, data.MasterKeyVersion)
+		if err != nil {
+			return nil, fmt.Errorf("decrypting DEK: %w", err)
+		}
+		return dek, nil
+	}
+
+	if kek == nil || kek.Version != data.KEKVersion {
+		return nil, fmt.Errorf("project KEK v%d required to decrypt DEK", data.KEKVersion)
+	}
+	dek, err := aesGCMDecrypt(kek.Key, data.EncryptedDEK, data.DEKNonce, nil)
+	if err != nil {
+		return nil, fmt.Errorf("decrypting DEK with KEK: %w", err)
+	}
+	return dek, nil
+}
+
+// EncryptWithKey encrypts plaintext directly with a 32-byte key using
+// AES-256-GCM and a random nonce. aad may be nil. It is meant for callers
+// that manage their own data keys, such as transit keys.
+func EncryptWithKey(key, plaintext, aad []byte) (ciphertext, nonce []byte, err error) {
+	if len(key) != 32 {
+		return nil, nil, fmt.Errorf("key must be exactly 32 bytes, got %d", len(key))
+	}
+	return aesGCMEncrypt(key, plaintext, aad)
+}
+
+// DecryptWithKey reverses EncryptWithKey.
+func DecryptWithKey(key, ciphertext, nonce, aad []byte) ([]byte, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("key must be exactly 32 bytes, got %d", len(key))
+	}
+	return aesGCMDecrypt(key, ciphertext, nonce, aad)
+}
+
+// NonceSize is the AES-GCM nonce length used by EncryptWithKey.
+const NonceSize = 12
+
 // aesGCMEncrypt encrypts data using AES-256-GCM with a random nonce.
-func aesGCMEncrypt(key, plaintext []byte) (ciphertext, nonce []byte, err error) {
+// aad may be nil.
+func aesGCMEncrypt(key, plaintext, aad []byte) (ciphertext, nonce []byte, err error) {
 	block, err := aes.NewCipher(key)
 	if err != nil {
 		return nil, nil, err
@@ -149,12 +486,12 @@ func aesGCMEncrypt(key, plaintext []byte) (ciphertext, nonce []byte, err error)
 		return nil, nil, err
 	}
 
-	ciphertext = gcm.Seal(nil, nonce, plaintext, nil)
+	ciphertext = gcm.Seal(nil, nonce, plaintext, aad)
 	return ciphertext, nonce, nil
 }
 
 // aesGCMDecrypt decrypts data using AES-256-GCM.
-func aesGCMDecrypt(key, ciphertext, nonce []byte) ([]byte, error) {
+func aesGCMDecrypt(key, ciphertext, nonce, aad []byte) ([]byte, error) {
 	block, err := aes.NewCipher(key)
 	if err != nil {
 		return nil, err
@@ -165,5 +502,5 @@ func aesGCMDecrypt(key, ciphertext, nonce []byte) ([]byte, error) {
 		return nil, err
 	}
 
-	return gcm.Open(nil, nonce, ciphertext, nil)
+	return gcm.Open(nil, nonce, ciphertext, aad)
 }
@@ -0,0 +1,135 @@
+package crypto
+
+import (
+	"bytes"
+	"testing"
+)
+
+func newTestCrypto(t *testing.T) *EnvelopeCrypto {
+	t.Helper()
+	ec, err := NewEnvelopeCrypto(bytes.Repeat([]byte{0x42}, 32))
+	if err != nil {
+		t.Fatalf("NewEnvelopeCrypto: %v", err)
+	}
+	return ec
+}
+
+func TestDecryptChecksEncryptionContext(t *testing.T) {
+	ec := newTestCrypto(t)
+	plaintext := []byte("s3cr3t")
+	written := &EncryptionContext{ProjectID: "p1", SecretID: "s1", Version: 3}
+
+	tests := []struct {
+		name   string
+		ectx   *EncryptionContext
+		wantOK bool
+	}{
+		{"same context", &EncryptionContext{ProjectID: "p1", SecretID: "s1", Version: 3}, true},
+		{"explicit secret purpose", &EncryptionContext{ProjectID: "p1", SecretID: "s1", Version: 3, Purpose: "secret"}, true},
+		{"other project", &EncryptionContext{ProjectID: "p2", SecretID: "s1", Version: 3}, false},
+		{"other secret", &EncryptionContext{ProjectID: "p1", SecretID: "s2", Version: 3}, false},
+		{"other version", &EncryptionContext{ProjectID: "p1", SecretID: "s1", Version: 4}, false},
+		{"other purpose", &EncryptionContext{ProjectID: "p1", SecretID: "s1", Version: 3, Purpose: "transit-key"}, false},
+		{"no context", nil, false},
+	}
+
+	for _, kek := range []*KEK{nil, {Version: 1, Key: bytes.Repeat([]byte{0x17}, 32)}} {
+		name := "master key"
+		if kek != nil {
+			name = "project KEK"
+		}
+		t.Run(name, func(t *testing.T) {
+			data, err := ec.EncryptWithKEK(plaintext, written, kek)
+			if err != nil {
+				t.Fatalf("EncryptWithKEK: %v", err)
+			}
+			if data.Format != FormatV2 {
+				t.Fatalf("format = %d, want %d", data.Format, FormatV2)
+			}
+			for _, tt := range tests {
+				t.Run(tt.name, func(t *testing.T) {
+					got, err := ec.DecryptWithKEK(data, tt.ectx, kek)
+					if tt.wantOK {
+						if err != nil {
+							t.Fatalf("DecryptWithKEK: %v", err)
+						}
+						if !bytes.Equal(got, plaintext) {
+							t.Errorf("got %q, want %q", got, plaintext)
+						}
+						return
+					}
+					if err == nil {
+						t.Errorf("DecryptWithKEK succeeded with a mismatched context")
+					}
+				})
+			}
+		})
+	}
+}
+
+func TestDecryptFormatV1IgnoresContext(t *testing.T) {
+	ec := newTestCrypto(t)
+	data, err := ec.Encrypt([]byte("legacy"), nil)
+	if err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+	if data.Format != FormatV1 {
+		t.Fatalf("format = %d, want %d", data.Format, FormatV1)
+	}
+	for _, ectx := range []*EncryptionContext{nil, {ProjectID: "p1", SecretID: "s1", Version: 1}} {
+		got, err := ec.Decrypt(data, ectx)
+		if err != nil {
+			t.Fatalf("Decrypt(%v): %v", ectx, err)
+		}
+		if string(got) != "legacy" {
+			t.Errorf("Decrypt(%v) = %q, want %q", ectx, got, "legacy")
+		}
+	}
+}
+
+func TestDecryptRejectsTamperedFormat(t *testing.T) {
+	ec := newTestCrypto(t)
+	ectx := &EncryptionContext{ProjectID: "p1", SecretID: "s1", Version: 1}
+	data, err := ec.Encrypt([]byte("bound"), ectx)
+	if err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		format int
+	}{
+		// Claiming v1 drops the associated data, which must not verify
+		{"downgraded to v1", FormatV1},
+		{"unset format", 0},
+		{"end-to-end", FormatE2E},
+		{"unknown", 99},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tampered := *data
+			tampered.Format = tt.format
+			if _, err := ec.Decrypt(&tampered, ectx); err == nil {
+				t.Error("Decrypt succeeded, want an error")
+			}
+		})
+	}
+}
+
+func TestAADSeparatesFields(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b EncryptionContext
+	}{
+		{"project and secret boundary", EncryptionContext{ProjectID: "ab", SecretID: "c"}, EncryptionContext{ProjectID: "a", SecretID: "bc"}},
+		{"version", EncryptionContext{ProjectID: "p", SecretID: "s", Version: 1}, EncryptionContext{ProjectID: "p", SecretID: "s", Version: 11}},
+		{"purpose", EncryptionContext{ProjectID: "p", SecretID: "s"}, EncryptionContext{ProjectID: "p", SecretID: "s", Purpose: "wrapped-response"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if bytes.Equal(tt.a.AAD(), tt.b.AAD()) {
+				t.Errorf("AAD of %+v and %+v are equal", tt.a, tt.b)
+			}
+		})
+	}
+}
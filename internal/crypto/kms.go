@@ -0,0 +1,232 @@
+package crypto
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HTTPKMSProvider delegates DEK wrapping to an external KMS over HTTP.
+// The root key never enters the API process; only wrapped DEKs cross the wire.
+//
+// The KMS must implement:
+//
+//	GET  {addr}/v1/keys/{key_id}         -> {"key_id","current_version","versions"}
+//	POST {addr}/v1/keys/{key_id}/wrap    {"plaintext"}                  -> {"ciphertext","nonce","version"}
+//	POST {addr}/v1/keys/{key_id}/unwrap  {"ciphertext","nonce","version"} -> {"plaintext"}
+//
+// Binary fields are base64-encoded. Requests carry "Authorization: Bearer
+// <token>" when a token is configured. KMSStub implements this protocol for
+// local use.
+type HTTPKMSProvider struct {
+	addr       string
+	keyID      string
+	token      string
+	httpClient *http.Client
+
+	mu       sync.RWMutex
+	current  int
+	versions []int
+}
+
+// KMSKeyInfo describes a KMS key and its versions.
+type KMSKeyInfo struct {
+	KeyID          string `json:"key_id"`
+	CurrentVersion int    `json:"current_version"`
+	Versions       []int  `json:"versions"`
+}
+
+type kmsWrapRequest struct {
+	Plaintext []byte `json:"plaintext"`
+}
+
+type kmsWrapResponse struct {
+	Ciphertext []byte `json:"ciphertext"`
+	Nonce      []byte `json:"nonce"`
+	Version    int    `json:"version"`
+}
+
+type kmsUnwrapRequest struct {
+	Ciphertext []byte `json:"ciphertext"`
+	Nonce      []byte `json:"nonce"`
+	Version    int    `json:"version"`
+}
+
+type kmsUnwrapResponse struct {
+	Plaintext []byte `json:"plaintext"`
+}
+
+// NewHTTPKMSProvider connects to a KMS and loads the key's version metadata.
+func NewHTTPKMSProvider(addr, keyID, token string) (*HTTPKMSProvider, error) {
+	if addr == "" {
+		return nil, errors.New("KMS address is required")
+	}
+	if keyID == "" {
+		return nil, errors.New("KMS key ID is required")
+	}
+
+	p := &HTTPKMSProvider{
+		addr:  strings.TrimRight(addr, "/"),
+		keyID: keyID,
+		token: token,
+		httpClient: &http.Client{
+			Timeout: 10 * time.Second,
+		},
+	}
+	if err := p.Refresh(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// NewHTTPKMSProviderFromEnv creates a KMS provider from KMS_ADDR, KMS_KEY_ID
+// and KMS_TOKEN (or KMS_TOKEN_FILE).
+func NewHTTPKMSProviderFromEnv() (*HTTPKMSProvider, error) {
+	addr := os.Getenv("KMS_ADDR")
+	if addr == "" {
+		return nil, errors.New("KMS_ADDR environment variable required when KEY_PROVIDER=kms")
+	}
+	keyID := os.Getenv("KMS_KEY_ID")
+	if keyID == "" {
+		keyID = "teamvault"
+	}
+
+	token := os.Getenv("KMS_TOKEN")
+	if token == "" {
+		if tokenFile := os.Getenv("KMS_TOKEN_FILE"); tokenFile != "" {
+			data, err := os.ReadFile(tokenFile)
+			if err != nil {
+				return nil, fmt.Errorf("reading KMS token file: %w", err)
+			}
+			token = strings.TrimSpace(string(data))
+		}
+	}
+
+	return NewHTTPKMSProvider(addr, keyID, token)
+}
+
+// Name returns "kms".
+func (p *HTTPKMSProvider) Name() string {
+	return "kms"
+}
+
+// CurrentVersion returns the KMS key version last reported as current.
+func (p *HTTPKMSProvider) CurrentVersion() int {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.current
+}
+
+// Versions returns the KMS key versions last reported, oldest first.
+func (p *HTTPKMSProvider) Versions() []int {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	versions := make([]int, len(p.versions))
+	copy(versions, p.versions)
+	return versions
+}
+
+// Refresh reloads the key's version metadata from the KMS, e.g. after the
+// key has been rotated there.
+func (p *HTTPKMSProvider) Refresh() error {
+	var info KMSKeyInfo
+	if err := p.call(http.MethodGet, "", nil, &info); err != nil {
+		return fmt.Errorf("loading KMS key %s: %w", p.keyID, err)
+	}
+	if info.CurrentVersion < 1 {
+		return fmt.Errorf("KMS key %s reported invalid current version %d", p.keyID, info.CurrentVersion)
+	}
+
+	p.mu.Lock()
+	p.current = info.CurrentVersion
+	p.versions = info.Versions
+	p.mu.Unlock()
+	return nil
+}
+
+// WrapDEK asks the KMS to encrypt dek under its current key version.
+func (p *HTTPKMSProvider) WrapDEK(dek []byte) ([]byte, []byte, int, error) {
+	var resp kmsWrapResponse
+	if err := p.call(http.MethodPost, "/wrap", kmsWrapRequest{Plaintext: dek}, &resp); err != nil {
+		return nil, nil, 0, fmt.Errorf("KMS wrap: %w", err)
+	}
+	if len(resp.Ciphertext) == 0 || resp.Version < 1 {
+		return nil, nil, 0, errors.New("KMS wrap: malformed response")
+	}
+
+	// The KMS may have rotated since we last looked; track the version it used.
+	p.mu.Lock()
+	if resp.Version > p.current {
+		p.current = resp.Version
+		p.versions = append(p.versions, resp.Version)
+	}
+	p.mu.Unlock()
+
+	return resp.Ciphertext, resp.Nonce, resp.Version, nil
+}
+
+// UnwrapDEK asks the KMS to decrypt a DEK wrapped under the given version.
+func (p *HTTPKMSProvider) UnwrapDEK(encryptedDEK, dekNonce []byte, version int) ([]byte, error) {
+	if version == 0 {
+		version = 1
+	}
+	var resp kmsUnwrapResponse
+	req := kmsUnwrapRequest{Ciphertext: encryptedDEK, Nonce: dekNonce, Version: version}
+	if err := p.call(http.MethodPost, "/unwrap", req, &resp); err != nil {
+		return nil, fmt.Errorf("KMS unwrap: %w", err)
+	}
+	return resp.Plaintext, nil
+}
+
+// call performs a JSON request against the configured key.
+func (p *HTTPKMSProvider) call(method, suffix string, body, result interface{}) error {
+	var reqBody io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("marshaling request: %w", err)
+		}
+		reqBody = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, p.addr+"/v1/keys/"+url.PathEscape(p.keyID)+suffix, reqBody)
+	if err != nil {
+		return fmt.Errorf("creating request: %w", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if p.token != "" {
+		req.Header.Set("Authorization", "Bearer "+p.token)
+	}
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("sending request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		var errResp struct {
+			Error string `json:"error"`
+		}
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		if json.Unmarshal(data, &errResp) == nil && errResp.Error != "" {
+			return fmt.Errorf("KMS returned %d: %s", resp.StatusCode, errResp.Error)
+		}
+		return fmt.Errorf("KMS returned %d", resp.StatusCode)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return fmt.Errorf("decoding response: %w", err)
+	}
+	return nil
+}
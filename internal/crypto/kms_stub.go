@@ -0,0 +1,117 @@
+package crypto
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// KMSStub is a local stand-in for an external KMS. It serves the protocol
+// expected by HTTPKMSProvider from an in-memory keyring, so the KMS code path
+// can be exercised in development and tests (e.g. behind httptest.NewServer)
+// without real cloud credentials. It must not be used in production.
+type KMSStub struct {
+	keyID    string
+	token    string
+	provider *LocalKeyProvider
+	mux      *http.ServeMux
+}
+
+// NewKMSStub creates a stand-in KMS serving a single key. If token is
+// non-empty, requests must present it as a bearer token.
+func NewKMSStub(keyID, token string, keys map[int][]byte) (*KMSStub, error) {
+	provider, err := NewLocalKeyProvider(keys)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &KMSStub{
+		keyID:    keyID,
+		token:    token,
+		provider: provider,
+		mux:      http.NewServeMux(),
+	}
+	s.mux.HandleFunc("GET /v1/keys/{key}", s.handleKeyInfo)
+	s.mux.HandleFunc("POST /v1/keys/{key}/wrap", s.handleWrap)
+	s.mux.HandleFunc("POST /v1/keys/{key}/unwrap", s.handleUnwrap)
+	return s, nil
+}
+
+// ServeHTTP implements http.Handler.
+func (s *KMSStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.token != "" {
+		presented := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(presented), []byte(s.token)) != 1 {
+			writeKMSError(w, http.StatusUnauthorized, "invalid token")
+			return
+		}
+	}
+	s.mux.ServeHTTP(w, r)
+}
+
+func (s *KMSStub) checkKey(w http.ResponseWriter, r *http.Request) bool {
+	if r.PathValue("key") != s.keyID {
+		writeKMSError(w, http.StatusNotFound, "key not found")
+		return false
+	}
+	return true
+}
+
+func (s *KMSStub) handleKeyInfo(w http.ResponseWriter, r *http.Request) {
+	if !s.checkKey(w, r) {
+		return
+	}
+	writeKMSJSON(w, KMSKeyInfo{
+		KeyID:          s.keyID,
+		CurrentVersion: s.provider.CurrentVersion(),
+		Versions:       s.provider.Versions(),
+	})
+}
+
+func (s *KMSStub) handleWrap(w http.ResponseWriter, r *http.Request) {
+	if !s.checkKey(w, r) {
+		return
+	}
+	var req kmsWrapRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.Plaintext) == 0 {
+		writeKMSError(w, http.StatusBadRequest, "plaintext is required")
+		return
+	}
+
+	ciphertext, nonce, version, err := s.provider.WrapDEK(req.Plaintext)
+	if err != nil {
+		writeKMSError(w, http.StatusInternalServerError, "wrap failed")
+		return
+	}
+	writeKMSJSON(w, kmsWrapResponse{Ciphertext: ciphertext, Nonce: nonce, Version: version})
+}
+
+func (s *KMSStub) handleUnwrap(w http.ResponseWriter, r *http.Request) {
+	if !s.checkKey(w, r) {
+		return
+	}
+	var req kmsUnwrapRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeKMSError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	plaintext, err := s.provider.UnwrapDEK(req.Ciphertext, req.Nonce, req.Version)
+	if err != nil {
+		writeKMSError(w, http.StatusBadRequest, "unwrap failed")
+		return
+	}
+	writeKMSJSON(w, kmsUnwrapResponse{Plaintext: plaintext})
+}
+
+func writeKMSJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeKMSError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": msg})
+}
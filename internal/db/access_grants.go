@@ -0,0 +1,280 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Access request states. A request is pending until a lead of its team
+// approves or denies it, or the requester cancels it. An approved request has
+// a grant, which lasts for the requested duration unless revoked.
+const (
+	AccessPending   = "pending"
+	AccessApproved  = "approved"
+	AccessDenied    = "denied"
+	AccessCancelled = "cancelled"
+)
+
+// AccessRequest is a user's request for temporary access to the secrets
+// matching ResourcePattern ("project/path", with the usual wildcards),
+// addressed to the leads of the team TeamID.
+type AccessRequest struct {
+	ID              string     `json:"id"`
+	UserID          string     `json:"user_id"`
+	TeamID          string     `json:"team_id"`
+	ResourcePattern string     `json:"resource_pattern"`
+	Actions         []string   `json:"actions"`
+	Justification   string     `json:"justification"`
+	DurationSeconds int        `json:"duration_seconds"`
+	Status          string     `json:"status"`
+	ReviewedBy      *string    `json:"reviewed_by,omitempty"`
+	ReviewComment   string     `json:"review_comment,omitempty"`
+	ReviewedAt      *time.Time `json:"reviewed_at,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+
+	Grant *AccessGrant `json:"grant,omitempty"`
+}
+
+// AccessGrant is the temporary permission an approved access request gives
+// its requester, or a break-glass use its user (without a request). It is
+// active until ExpiresAt unless revoked before.
+type AccessGrant struct {
+	ID              string     `json:"id"`
+	RequestID       *string    `json:"request_id,omitempty"`
+	BreakGlass      bool       `json:"break_glass,omitempty"`
+	UserID          string     `json:"user_id"`
+	ResourcePattern string     `json:"resource_pattern"`
+	Actions         []string   `json:"actions"`
+	GrantedBy       string     `json:"granted_by"`
+	ExpiresAt       time.Time  `json:"expires_at"`
+	RevokedAt       *time.Time `json:"revoked_at,omitempty"`
+	RevokedBy       *string    `json:"revoked_by,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+}
+
+// Active reports whether the grant allows access at time t.
+func (g *AccessGrant) Active(t time.Time) bool {
+	return g.RevokedAt == nil && t.Before(g.ExpiresAt)
+}
+
+const accessRequestColumns = `id, user_id, team_id, resource_pattern, actions, justification, duration_seconds,
+	status, reviewed_by, review_comment, reviewed_at, created_at`
+
+const accessGrantColumns = `id, request_id, break_glass, user_id, resource_pattern, actions, granted_by,
+	expires_at, revoked_at, revoked_by, created_at`
+
+func scanAccessRequest(row pgx.Row) (*AccessRequest, error) {
+	ar := &AccessRequest{}
+	err := row.Scan(&ar.ID, &ar.UserID, &ar.TeamID, &ar.ResourcePattern, &ar.Actions, &ar.Justification, &ar.DurationSeconds,
+		&ar.Status, &ar.ReviewedBy, &ar.ReviewComment, &ar.ReviewedAt, &ar.CreatedAt)
+	return ar, err
+}
+
+func scanAccessGrant(row pgx.Row) (*AccessGrant, error) {
+	g := &AccessGrant{}
+	err := row.Scan(&g.ID, &g.RequestID, &g.BreakGlass, &g.UserID, &g.ResourcePattern, &g.Actions, &g.GrantedBy,
+		&g.ExpiresAt, &g.RevokedAt, &g.RevokedBy, &g.CreatedAt)
+	return g, err
+}
+
+// CreateAccessRequest stores a pending access request.
+func (db *DB) CreateAccessRequest(ctx context.Context, ar *AccessRequest) (*AccessRequest, error) {
+	created, err := scanAccessRequest(db.Pool.QueryRow(ctx,
+		`INSERT INTO access_requests (user_id, team_id, resource_pattern, actions, justification, duration_seconds)
+		 VALUES ($1, $2, $3, $4, $5, $6)
+		 RETURNING `+accessRequestColumns,
+		ar.UserID, ar.TeamID, ar.ResourcePattern, ar.Actions, ar.Justification, ar.DurationSeconds,
+	))
+	if err != nil {
+		return nil, fmt.Errorf("creating access request: %w", err)
+	}
+	return created, nil
+}
+
+// GetAccessRequest returns an access request with its grant, if approved.
+func (db *DB) GetAccessRequest(ctx context.Context, id string) (*AccessRequest, error) {
+	ar, err := scanAccessRequest(db.Pool.QueryRow(ctx,
+		`SELECT `+accessRequestColumns+` FROM access_requests WHERE id = $1`,
+		id,
+	))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("access request not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("getting access request: %w", err)
+	}
+	if ar.Status == AccessApproved {
+		g, err := scanAccessGrant(db.Pool.QueryRow(ctx,
+			`SELECT `+accessGrantColumns+` FROM access_grants WHERE request_id = $1`,
+			id,
+		))
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("getting access grant: %w", err)
+		}
+		if err == nil {
+			ar.Grant = g
+		}
+	}
+	return ar, nil
+}
+
+// ListAccessRequests returns, newest first, the access requests made by
+// userID or addressed to one of teamIDs, optionally only those with the given
+// status. Grants are not loaded.
+func (db *DB) ListAccessRequests(ctx context.Context, userID string, teamIDs []string, status string) ([]AccessRequest, error) {
+	rows, err := db.Pool.Query(ctx,
+		`SELECT `+accessRequestColumns+`
+		 FROM access_requests
+		 WHERE (user_id = $1 OR team_id = ANY($2::uuid[])) AND ($3 = '' OR status = $3)
+		 ORDER BY created_at DESC`,
+		userID, teamIDs, status,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("listing access requests: %w", err)
+	}
+	defer rows.Close()
+
+	var requests []AccessRequest
+	for rows.Next() {
+		ar, err := scanAccessRequest(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scanning access request: %w", err)
+		}
+		requests = append(requests, *ar)
+	}
+	return requests, rows.Err()
+}
+
+// ApproveAccessRequest approves a pending access request and creates its
+// grant, which expires the requested duration from now.
+func (db *DB) ApproveAccessRequest(ctx context.Context, id, reviewerID, comment string) (*AccessRequest, error) {
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("beginning transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	ar, err := scanAccessRequest(tx.QueryRow(ctx,
+		`UPDATE access_requests
+		 SET status = $2, reviewed_by = $3, review_comment = $4, reviewed_at = now()
+		 WHERE id = $1 AND status = $5
+		 RETURNING `+accessRequestColumns,
+		id, AccessApproved, reviewerID, comment, AccessPending,
+	))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("access request is no longer pending")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("approving access request: %w", err)
+	}
+
+	ar.Grant, err = scanAccessGrant(tx.QueryRow(ctx,
+		`INSERT INTO access_grants (request_id, user_id, resource_pattern, actions, granted_by, expires_at)
+		 VALUES ($1, $2, $3, $4, $5, now() + make_interval(secs => $6))
+		 RETURNING `+accessGrantColumns,
+		ar.ID, ar.UserID, ar.ResourcePattern, ar.Actions, reviewerID, ar.DurationSeconds,
+	))
+	if err != nil {
+		return nil, fmt.Errorf("creating access grant: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("committing transaction: %w", err)
+	}
+	return ar, nil
+}
+
+// DenyAccessRequest denies a pending access request.
+func (db *DB) DenyAccessRequest(ctx context.Context, id, reviewerID, comment string) (*AccessRequest, error) {
+	ar, err := scanAccessRequest(db.Pool.QueryRow(ctx,
+		`UPDATE access_requests
+		 SET status = $2, reviewed_by = $3, review_comment = $4, reviewed_at = now()
+		 WHERE id = $1 AND status = $5
+		 RETURNING `+accessRequestColumns,
+		id, AccessDenied, reviewerID, comment, AccessPending,
+	))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("access request is no longer pending")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("denying access request: %w", err)
+	}
+	return ar, nil
+}
+
+// CancelAccessRequest withdraws a pending access request.
+func (db *DB) CancelAccessRequest(ctx context.Context, id string) error {
+	result, err := db.Pool.Exec(ctx,
+		`UPDATE access_requests SET status = $2 WHERE id = $1 AND status = $3`,
+		id, AccessCancelled, AccessPending,
+	)
+	if err != nil {
+		return fmt.Errorf("cancelling access request: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("access request is no longer pending")
+	}
+	return nil
+}
+
+// RevokeAccessGrant ends an active grant before it expires.
+func (db *DB) RevokeAccessGrant(ctx context.Context, id, revokedBy string) (*AccessGrant, error) {
+	g, err := scanAccessGrant(db.Pool.QueryRow(ctx,
+		`UPDATE access_grants SET revoked_at = now(), revoked_by = $2
+		 WHERE id = $1 AND revoked_at IS NULL AND expires_at > now()
+		 RETURNING `+accessGrantColumns,
+		id, revokedBy,
+	))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("access grant not found or no longer active")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("revoking access grant: %w", err)
+	}
+	return g, nil
+}
+
+// GetAccessGrant returns an access grant.
+func (db *DB) GetAccessGrant(ctx context.Context, id string) (*AccessGrant, error) {
+	g, err := scanAccessGrant(db.Pool.QueryRow(ctx,
+		`SELECT `+accessGrantColumns+` FROM access_grants WHERE id = $1`,
+		id,
+	))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("access grant not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("getting access grant: %w", err)
+	}
+	return g, nil
+}
+
+// ActiveAccessGrants returns the grants of a user that are neither expired
+// nor revoked, soonest to expire first.
+func (db *DB) ActiveAccessGrants(ctx context.Context, userID string) ([]AccessGrant, error) {
+	rows, err := db.Pool.Query(ctx,
+		`SELECT `+accessGrantColumns+`
+		 FROM access_grants
+		 WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > now()
+		 ORDER BY expires_at`,
+		userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("listing access grants: %w", err)
+	}
+	defer rows.Close()
+
+	var grants []AccessGrant
+	for rows.Next() {
+		g, err := scanAccessGrant(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scanning access grant: %w", err)
+		}
+		grants = append(grants, *g)
+	}
+	return grants, rows.Err()
+}
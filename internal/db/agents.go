@@ -3,20 +3,30 @@ package db
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
+
+	"github.com/jackc/pgx/v5"
 )
 
+const agentColumns = `id, team_id, name, COALESCE(description, ''), token_hash, scopes, role, metadata, created_by, created_at, expires_at, token_id IS NULL`
+
+func scanAgent(row pgx.Row) (*Agent, error) {
+	a := &Agent{}
+	err := row.Scan(&a.ID, &a.TeamID, &a.Name, &a.Description, &a.TokenHash,
+		&a.Scopes, &a.Role, &a.Metadata, &a.CreatedBy, &a.CreatedAt, &a.ExpiresAt, &a.LegacyToken)
+	return a, err
+}
+
 // CreateAgent inserts a new agent for a team.
-func (db *DB) CreateAgent(ctx context.Context, teamID, name, description, tokenHash string, scopes []string, metadata json.RawMessage, createdBy string, expiresAt *time.Time) (*Agent, error) {
-	agent := &Agent{}
-	err := db.Pool.QueryRow(ctx,
-		`INSERT INTO agents (team_id, name, description, token_hash, scopes, metadata, created_by, expires_at)
-		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
-		 RETURNING id, team_id, name, COALESCE(description, ''), token_hash, scopes, metadata, created_by, created_at, expires_at`,
-		teamID, name, description, tokenHash, scopes, metadata, createdBy, expiresAt,
-	).Scan(&agent.ID, &agent.TeamID, &agent.Name, &agent.Description, &agent.TokenHash,
-		&agent.Scopes, &agent.Metadata, &agent.CreatedBy, &agent.CreatedAt, &agent.ExpiresAt)
+func (db *DB) CreateAgent(ctx context.Context, teamID, name, description, tokenID, tokenHash string, scopes []string, role string, metadata json.RawMessage, createdBy string, expiresAt *time.Time) (*Agent, error) {
+	agent, err := scanAgent(db.Pool.QueryRow(ctx,
+		`INSERT INTO agents (team_id, name, description, token_id, token_hash, scopes, role, metadata, created_by, expires_at)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		 RETURNING `+agentColumns,
+		teamID, name, description, tokenID, tokenHash, scopes, role, metadata, createdBy, expiresAt,
+	))
 	if err != nil {
 		return nil, fmt.Errorf("creating agent: %w", err)
 	}
@@ -25,13 +35,11 @@ func (db *DB) CreateAgent(ctx context.Context, teamID, name, description, tokenH
 
 // GetAgentByID retrieves an agent by ID.
 func (db *DB) GetAgentByID(ctx context.Context, id string) (*Agent, error) {
-	agent := &Agent{}
-	err := db.Pool.QueryRow(ctx,
-		`SELECT id, team_id, name, COALESCE(description, ''), token_hash, scopes, metadata, created_by, created_at, expires_at
+	agent, err := scanAgent(db.Pool.QueryRow(ctx,
+		`SELECT `+agentColumns+`
 		 FROM agents WHERE id = $1`,
 		id,
-	).Scan(&agent.ID, &agent.TeamID, &agent.Name, &agent.Description, &agent.TokenHash,
-		&agent.Scopes, &agent.Metadata, &agent.CreatedBy, &agent.CreatedAt, &agent.ExpiresAt)
+	))
 	if err != nil {
 		return nil, fmt.Errorf("getting agent by id: %w", err)
 	}
@@ -41,7 +49,7 @@ func (db *DB) GetAgentByID(ctx context.Context, id string) (*Agent, error) {
 // ListAgentsByTeam returns all agents for a team.
 func (db *DB) ListAgentsByTeam(ctx context.Context, teamID string) ([]Agent, error) {
 	rows, err := db.Pool.Query(ctx,
-		`SELECT id, team_id, name, COALESCE(description, ''), token_hash, scopes, metadata, created_by, created_at, expires_at
+		`SELECT `+agentColumns+`
 		 FROM agents WHERE team_id = $1 ORDER BY created_at DESC`,
 		teamID,
 	)
@@ -52,12 +60,11 @@ func (db *DB) ListAgentsByTeam(ctx context.Context, teamID string) ([]Agent, err
 
 	var agents []Agent
 	for rows.Next() {
-		var a Agent
-		if err := rows.Scan(&a.ID, &a.TeamID, &a.Name, &a.Description, &a.TokenHash,
-			&a.Scopes, &a.Metadata, &a.CreatedBy, &a.CreatedAt, &a.ExpiresAt); err != nil {
+		a, err := scanAgent(rows)
+		if err != nil {
 			return nil, fmt.Errorf("scanning agent: %w", err)
 		}
-		agents = append(agents, a)
+		agents = append(agents, *a)
 	}
 	return agents, rows.Err()
 }
@@ -74,13 +81,32 @@ func (db *DB) DeleteAgent(ctx context.Context, id string) error {
 	return nil
 }
 
-// FindAgentByToken finds an agent by iterating through all non-expired agents
-// and comparing the token hash using the provided function.
+// GetAgentByTokenID retrieves the non-expired agent whose token carries
+// tokenID. The caller still has to check the token's secret against the hash.
+func (db *DB) GetAgentByTokenID(ctx context.Context, tokenID string) (*Agent, error) {
+	agent, err := scanAgent(db.Pool.QueryRow(ctx,
+		`SELECT `+agentColumns+`
+		 FROM agents
+		 WHERE token_id = $1 AND (expires_at IS NULL OR expires_at > now())`,
+		tokenID,
+	))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("agent not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("getting agent by token id: %w", err)
+	}
+	return agent, nil
+}
+
+// FindAgentByToken finds the agent of a legacy token, one issued before
+// tokens had IDs, by iterating through the non-expired agents that still have
+// one and comparing the token hash using the provided function.
 func (db *DB) FindAgentByToken(ctx context.Context, checkFn func(hash string) bool) (*Agent, error) {
 	rows, err := db.Pool.Query(ctx,
-		`SELECT id, team_id, name, COALESCE(description, ''), token_hash, scopes, metadata, created_by, created_at, expires_at
+		`SELECT `+agentColumns+`
 		 FROM agents
-		 WHERE (expires_at IS NULL OR expires_at > now())`,
+		 WHERE token_id IS NULL AND (expires_at IS NULL OR expires_at > now())`,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("querying agents: %w", err)
@@ -88,13 +114,12 @@ func (db *DB) FindAgentByToken(ctx context.Context, checkFn func(hash string) bo
 	defer rows.Close()
 
 	for rows.Next() {
-		var a Agent
-		if err := rows.Scan(&a.ID, &a.TeamID, &a.Name, &a.Description, &a.TokenHash,
-			&a.Scopes, &a.Metadata, &a.CreatedBy, &a.CreatedAt, &a.ExpiresAt); err != nil {
+		a, err := scanAgent(rows)
+		if err != nil {
 			return nil, fmt.Errorf("scanning agent: %w", err)
 		}
 		if checkFn(a.TokenHash) {
-			return &a, nil
+			return a, nil
 		}
 	}
 	if err := rows.Err(); err != nil {
@@ -102,3 +127,38 @@ func (db *DB) FindAgentByToken(ctx context.Context, checkFn func(hash string) bo
 	}
 	return nil, fmt.Errorf("agent not found")
 }
+
+// RotateAgentToken replaces the token of an agent. The old token stops
+// working at once.
+func (db *DB) RotateAgentToken(ctx context.Context, id, tokenID, tokenHash string) (*Agent, error) {
+	agent, err := scanAgent(db.Pool.QueryRow(ctx,
+		`UPDATE agents SET token_id = $2, token_hash = $3
+		 WHERE id = $1
+		 RETURNING `+agentColumns,
+		id, tokenID, tokenHash,
+	))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("agent not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("rotating agent token: %w", err)
+	}
+	return agent, nil
+}
+
+// SetAgentRole changes the role an agent presents to policies.
+func (db *DB) SetAgentRole(ctx context.Context, id, role string) (*Agent, error) {
+	agent, err := scanAgent(db.Pool.QueryRow(ctx,
+		`UPDATE agents SET role = $2
+		 WHERE id = $1
+		 RETURNING `+agentColumns,
+		id, role,
+	))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("agent not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("setting agent role: %w", err)
+	}
+	return agent, nil
+}
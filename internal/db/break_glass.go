@@ -0,0 +1,168 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// BreakGlassRule lets members of the team TeamID break glass on the secrets
+// of the org's projects matching Path ("project/path", with the usual
+// wildcards).
+type BreakGlassRule struct {
+	TeamID string `json:"team_id"`
+	Path   string `json:"path"`
+}
+
+// BreakGlassReview is the review item left by a break-glass use. It stays
+// pending until an admin acknowledges it.
+type BreakGlassReview struct {
+	ID             string     `json:"id"`
+	GrantID        string     `json:"grant_id"`
+	UserID         string     `json:"user_id"`
+	OrgID          string     `json:"org_id"`
+	TeamID         string     `json:"team_id"`
+	Resource       string     `json:"resource"`
+	Justification  string     `json:"justification"`
+	ExpiresAt      time.Time  `json:"expires_at"` // of the grant
+	CreatedAt      time.Time  `json:"created_at"`
+	AcknowledgedBy *string    `json:"acknowledged_by,omitempty"`
+	AcknowledgedAt *time.Time `json:"acknowledged_at,omitempty"`
+	Comment        string     `json:"comment,omitempty"`
+}
+
+const breakGlassReviewColumns = `r.id, r.grant_id, r.user_id, r.org_id, r.team_id, r.resource, r.justification,
+	(SELECT g.expires_at FROM access_grants g WHERE g.id = r.grant_id),
+	r.created_at, r.acknowledged_by, r.acknowledged_at, r.comment`
+
+func scanBreakGlassReview(row pgx.Row) (*BreakGlassReview, error) {
+	r := &BreakGlassReview{}
+	err := row.Scan(&r.ID, &r.GrantID, &r.UserID, &r.OrgID, &r.TeamID, &r.Resource, &r.Justification,
+		&r.ExpiresAt, &r.CreatedAt, &r.AcknowledgedBy, &r.AcknowledgedAt, &r.Comment)
+	return r, err
+}
+
+// SetOrgBreakGlassRules replaces the break-glass rules of an organization.
+func (db *DB) SetOrgBreakGlassRules(ctx context.Context, orgID string, rules []BreakGlassRule) error {
+	if rules == nil {
+		rules = []BreakGlassRule{}
+	}
+	b, _ := json.Marshal(rules)
+	result, err := db.Pool.Exec(ctx,
+		`UPDATE orgs SET break_glass_rules = $2::jsonb WHERE id = $1`,
+		orgID, string(b),
+	)
+	if err != nil {
+		return fmt.Errorf("setting break-glass rules: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("org not found")
+	}
+	return nil
+}
+
+// BreakGlass gives a user read access to resource until expiresAt and
+// records the review item for it, in one transaction.
+func (db *DB) BreakGlass(ctx context.Context, userID, orgID, teamID, resource, justification string, expiresAt time.Time) (*AccessGrant, *BreakGlassReview, error) {
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("beginning transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	grant, err := scanAccessGrant(tx.QueryRow(ctx,
+		`INSERT INTO access_grants (break_glass, user_id, resource_pattern, actions, granted_by, expires_at)
+		 VALUES (true, $1, $2, '{"read"}', $1, $3)
+		 RETURNING `+accessGrantColumns,
+		userID, resource, expiresAt,
+	))
+	if err != nil {
+		return nil, nil, fmt.Errorf("creating break-glass grant: %w", err)
+	}
+
+	var id string
+	err = tx.QueryRow(ctx,
+		`INSERT INTO break_glass_reviews (grant_id, user_id, org_id, team_id, resource, justification)
+		 VALUES ($1, $2, $3, $4, $5, $6)
+		 RETURNING id`,
+		grant.ID, userID, orgID, teamID, resource, justification,
+	).Scan(&id)
+	if err != nil {
+		return nil, nil, fmt.Errorf("creating break-glass review: %w", err)
+	}
+	review, err := scanBreakGlassReview(tx.QueryRow(ctx,
+		`SELECT `+breakGlassReviewColumns+` FROM break_glass_reviews r WHERE r.id = $1`,
+		id,
+	))
+	if err != nil {
+		return nil, nil, fmt.Errorf("getting break-glass review: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, nil, fmt.Errorf("committing transaction: %w", err)
+	}
+	return grant, review, nil
+}
+
+// GetBreakGlassReview returns a break-glass review item.
+func (db *DB) GetBreakGlassReview(ctx context.Context, id string) (*BreakGlassReview, error) {
+	r, err := scanBreakGlassReview(db.Pool.QueryRow(ctx,
+		`SELECT `+breakGlassReviewColumns+` FROM break_glass_reviews r WHERE r.id = $1`,
+		id,
+	))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("break-glass review not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("getting break-glass review: %w", err)
+	}
+	return r, nil
+}
+
+// ListBreakGlassReviews returns break-glass review items, newest first; only
+// those not yet acknowledged if pending is set.
+func (db *DB) ListBreakGlassReviews(ctx context.Context, pending bool) ([]BreakGlassReview, error) {
+	rows, err := db.Pool.Query(ctx,
+		`SELECT `+breakGlassReviewColumns+`
+		 FROM break_glass_reviews r
+		 WHERE NOT $1 OR r.acknowledged_at IS NULL
+		 ORDER BY r.created_at DESC`,
+		pending,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("listing break-glass reviews: %w", err)
+	}
+	defer rows.Close()
+
+	var reviews []BreakGlassReview
+	for rows.Next() {
+		r, err := scanBreakGlassReview(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scanning break-glass review: %w", err)
+		}
+		reviews = append(reviews, *r)
+	}
+	return reviews, rows.Err()
+}
+
+// AcknowledgeBreakGlassReview records that an admin reviewed a break-glass
+// use.
+func (db *DB) AcknowledgeBreakGlassReview(ctx context.Context, id, adminID, comment string) (*BreakGlassReview, error) {
+	r, err := scanBreakGlassReview(db.Pool.QueryRow(ctx,
+		`UPDATE break_glass_reviews r SET acknowledged_by = $2, acknowledged_at = now(), comment = $3
+		 WHERE r.id = $1 AND r.acknowledged_at IS NULL
+		 RETURNING `+breakGlassReviewColumns,
+		id, adminID, comment,
+	))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("break-glass review already acknowledged")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("acknowledging break-glass review: %w", err)
+	}
+	return r, nil
+}
@@ -0,0 +1,364 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ApprovalRule protects the secrets of a project whose paths match Path
+// (a glob such as "prod/**"): writes by anyone but the project owner become
+// change requests that need Approvals approvals from members of the team
+// TeamID before they are applied.
+type ApprovalRule struct {
+	Path      string `json:"path"`
+	TeamID    string `json:"team_id"`
+	Approvals int    `json:"approvals"`
+}
+
+// Change request states. A request is pending until it is rejected,
+// cancelled or expires, or gets enough approvals; an approved request is
+// applied right away and ends applied, or failed if the secret changed in the
+// meantime.
+const (
+	ChangePending   = "pending"
+	ChangeApproved  = "approved"
+	ChangeApplied   = "applied"
+	ChangeFailed    = "failed"
+	ChangeRejected  = "rejected"
+	ChangeCancelled = "cancelled"
+	ChangeExpired   = "expired"
+)
+
+// ChangeRequest is a write to a protected secret waiting for approval. The
+// proposed value is encrypted like a secret version of the project and is
+// wiped once the request is resolved.
+type ChangeRequest struct {
+	ID          string            `json:"id"`
+	ProjectID   string            `json:"project_id"`
+	ProjectName string            `json:"project"`
+	Path        string            `json:"path"`
+	Description string            `json:"description,omitempty"`
+	SecretType  string            `json:"secret_type"`
+	Metadata    json.RawMessage   `json:"metadata,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"` // nil keeps the secret's labels
+	// The latest version when the change was requested (0: the secret did not
+	// exist); the change is only applied on top of it
+	BaseVersion       int        `json:"base_version"`
+	Ciphertext        []byte     `json:"-"`
+	Nonce             []byte     `json:"-"`
+	EncryptedDEK      []byte     `json:"-"`
+	DEKNonce          []byte     `json:"-"`
+	MasterKeyVersion  int        `json:"-"`
+	KEKVersion        int        `json:"-"`
+	FormatVersion     int        `json:"-"`
+	TeamID            string     `json:"team_id"`
+	RequiredApprovals int        `json:"required_approvals"`
+	Approvals         int        `json:"approvals"`
+	Status            string     `json:"status"`
+	Error             string     `json:"error,omitempty"`
+	Comment           string     `json:"comment,omitempty"`
+	RequestedByType   string     `json:"requested_by_type"`
+	RequestedBy       string     `json:"requested_by"`
+	AppliedVersion    *int       `json:"applied_version,omitempty"`
+	ExpiresAt         time.Time  `json:"expires_at"`
+	CreatedAt         time.Time  `json:"created_at"`
+	ResolvedAt        *time.Time `json:"resolved_at,omitempty"`
+
+	Reviews []ChangeReview `json:"reviews,omitempty"`
+}
+
+// ChangeReview is one approver's decision on a change request.
+type ChangeReview struct {
+	UserID    string    `json:"user_id"`
+	Decision  string    `json:"decision"` // "approve" or "reject"
+	Comment   string    `json:"comment,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+const changeRequestColumns = `cr.id, cr.project_id, (SELECT p.name FROM projects p WHERE p.id = cr.project_id), cr.path, cr.description, cr.secret_type, cr.metadata, cr.labels,
+	cr.base_version, cr.ciphertext, cr.nonce, cr.encrypted_dek, cr.dek_nonce,
+	cr.master_key_version, cr.kek_version, cr.format_version, cr.team_id, cr.required_approvals,
+	(SELECT COUNT(*) FROM change_request_reviews r WHERE r.request_id = cr.id AND r.decision = 'approve'),
+	cr.status, cr.error, cr.comment, cr.requested_by_type, cr.requested_by, cr.applied_version,
+	cr.expires_at, cr.created_at, cr.resolved_at`
+
+// wipeChangeRequest clears the proposed value of a resolved request.
+const wipeChangeRequest = `ciphertext = NULL, nonce = NULL, encrypted_dek = NULL, dek_nonce = NULL, resolved_at = now()`
+
+func scanChangeRequest(row pgx.Row) (*ChangeRequest, error) {
+	cr := &ChangeRequest{}
+	err := row.Scan(&cr.ID, &cr.ProjectID, &cr.ProjectName, &cr.Path, &cr.Description, &cr.SecretType, &cr.Metadata, &cr.Labels,
+		&cr.BaseVersion, &cr.Ciphertext, &cr.Nonce, &cr.EncryptedDEK, &cr.DEKNonce,
+		&cr.MasterKeyVersion, &cr.KEKVersion, &cr.FormatVersion, &cr.TeamID, &cr.RequiredApprovals,
+		&cr.Approvals,
+		&cr.Status, &cr.Error, &cr.Comment, &cr.RequestedByType, &cr.RequestedBy, &cr.AppliedVersion,
+		&cr.ExpiresAt, &cr.CreatedAt, &cr.ResolvedAt)
+	return cr, err
+}
+
+// approvalRulesJSON encodes approval rules for a JSONB parameter; nil stays
+// NULL so COALESCE keeps the current value.
+func approvalRulesJSON(rules []ApprovalRule) interface{} {
+	if rules == nil {
+		return nil
+	}
+	b, _ := json.Marshal(rules)
+	return string(b)
+}
+
+// CreateChangeRequest stores a change request. The ID is generated; encrypt
+// is called with it, in the same transaction, for the ciphertext fields of
+// the proposed value, so the value can be bound to the request.
+func (db *DB) CreateChangeRequest(ctx context.Context, cr *ChangeRequest, encrypt func(id string) (*SecretVersion, error)) (*ChangeRequest, error) {
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("beginning transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var id string
+	err = tx.QueryRow(ctx,
+		`INSERT INTO change_requests (project_id, path, description, secret_type, metadata, labels, base_version,
+		   team_id, required_approvals, comment, requested_by_type, requested_by, expires_at)
+		 VALUES ($1, $2, $3, $4, $5, $6::jsonb, $7, $8, $9, $10, $11, $12, $13)
+		 RETURNING id`,
+		cr.ProjectID, cr.Path, cr.Description, cr.SecretType, cr.Metadata, labelsJSON(cr.Labels), cr.BaseVersion,
+		cr.TeamID, cr.RequiredApprovals, cr.Comment, cr.RequestedByType, cr.RequestedBy, cr.ExpiresAt,
+	).Scan(&id)
+	if err != nil {
+		return nil, fmt.Errorf("creating change request: %w", err)
+	}
+
+	enc, err := encrypt(id)
+	if err != nil {
+		return nil, fmt.Errorf("encrypting change request: %w", err)
+	}
+	created, err := scanChangeRequest(tx.QueryRow(ctx,
+		`UPDATE change_requests cr
+		 SET ciphertext = $2, nonce = $3, encrypted_dek = $4, dek_nonce = $5,
+		     master_key_version = $6, kek_version = $7, format_version = $8
+		 WHERE cr.id = $1
+		 RETURNING `+changeRequestColumns,
+		id, enc.Ciphertext, enc.Nonce, enc.EncryptedDEK, enc.DEKNonce,
+		enc.MasterKeyVersion, enc.KEKVersion, enc.FormatVersion,
+	))
+	if err != nil {
+		return nil, fmt.Errorf("storing change request value: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("committing transaction: %w", err)
+	}
+	return created, nil
+}
+
+// GetChangeRequest returns a change request with its reviews.
+func (db *DB) GetChangeRequest(ctx context.Context, id string) (*ChangeRequest, error) {
+	cr, err := scanChangeRequest(db.Pool.QueryRow(ctx,
+		`SELECT `+changeRequestColumns+` FROM change_requests cr WHERE cr.id = $1`,
+		id,
+	))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("change request not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("getting change request: %w", err)
+	}
+
+	rows, err := db.Pool.Query(ctx,
+		`SELECT user_id, decision, comment, created_at
+		 FROM change_request_reviews WHERE request_id = $1 ORDER BY created_at`,
+		id,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("listing change request reviews: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var r ChangeReview
+		if err := rows.Scan(&r.UserID, &r.Decision, &r.Comment, &r.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scanning change request review: %w", err)
+		}
+		cr.Reviews = append(cr.Reviews, r)
+	}
+	return cr, rows.Err()
+}
+
+// ListChangeRequests returns the change requests of a project, newest first,
+// optionally only those with the given status. Reviews are not loaded.
+func (db *DB) ListChangeRequests(ctx context.Context, projectID, status string) ([]ChangeRequest, error) {
+	rows, err := db.Pool.Query(ctx,
+		`SELECT `+changeRequestColumns+`
+		 FROM change_requests cr
+		 WHERE cr.project_id = $1 AND ($2 = '' OR cr.status = $2)
+		 ORDER BY cr.created_at DESC`,
+		projectID, status,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("listing change requests: %w", err)
+	}
+	defer rows.Close()
+
+	var requests []ChangeRequest
+	for rows.Next() {
+		cr, err := scanChangeRequest(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scanning change request: %w", err)
+		}
+		requests = append(requests, *cr)
+	}
+	return requests, rows.Err()
+}
+
+// ReviewChangeRequest records an approver's decision on a pending change
+// request. A rejection rejects the request; the approval that reaches the
+// required number marks it approved, after which the caller applies it. A
+// request found past its expiry is expired instead and an error returned.
+func (db *DB) ReviewChangeRequest(ctx context.Context, id, userID, decision, comment string) (*ChangeRequest, error) {
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("beginning transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	cr, err := scanChangeRequest(tx.QueryRow(ctx,
+		`SELECT `+changeRequestColumns+` FROM change_requests cr WHERE cr.id = $1 FOR UPDATE`,
+		id,
+	))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("change request not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("getting change request: %w", err)
+	}
+	if cr.Status != ChangePending {
+		return cr, fmt.Errorf("change request is %s", cr.Status)
+	}
+	if !cr.ExpiresAt.After(time.Now()) {
+		if _, err := tx.Exec(ctx, `UPDATE change_requests SET status = $2, `+wipeChangeRequest+` WHERE id = $1`, id, ChangeExpired); err != nil {
+			return nil, fmt.Errorf("expiring change request: %w", err)
+		}
+		if err := tx.Commit(ctx); err != nil {
+			return nil, fmt.Errorf("committing transaction: %w", err)
+		}
+		cr.Status = ChangeExpired
+		return cr, fmt.Errorf("change request expired")
+	}
+
+	_, err = tx.Exec(ctx,
+		`INSERT INTO change_request_reviews (request_id, user_id, decision, comment) VALUES ($1, $2, $3, $4)`,
+		id, userID, decision, comment,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("recording review: %w", err)
+	}
+
+	status := ""
+	switch {
+	case decision == "reject":
+		status = ChangeRejected
+	case cr.Approvals+1 >= cr.RequiredApprovals:
+		status = ChangeApproved
+	}
+	switch status {
+	case ChangeRejected:
+		_, err = tx.Exec(ctx, `UPDATE change_requests SET status = $2, `+wipeChangeRequest+` WHERE id = $1`, id, status)
+	case ChangeApproved:
+		_, err = tx.Exec(ctx, `UPDATE change_requests SET status = $2 WHERE id = $1`, id, status)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("updating change request: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("committing transaction: %w", err)
+	}
+	return db.GetChangeRequest(ctx, id)
+}
+
+// CancelChangeRequest withdraws a pending change request.
+func (db *DB) CancelChangeRequest(ctx context.Context, id string) error {
+	result, err := db.Pool.Exec(ctx,
+		`UPDATE change_requests SET status = $2, `+wipeChangeRequest+` WHERE id = $1 AND status = $3`,
+		id, ChangeCancelled, ChangePending,
+	)
+	if err != nil {
+		return fmt.Errorf("cancelling change request: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("change request is no longer pending")
+	}
+	return nil
+}
+
+// FinishChangeRequest records the outcome of applying an approved change
+// request: ChangeApplied with the version written, or ChangeFailed with the
+// reason.
+func (db *DB) FinishChangeRequest(ctx context.Context, id, status string, appliedVersion *int, reason string) error {
+	_, err := db.Pool.Exec(ctx,
+		`UPDATE change_requests SET status = $2, applied_version = $3, error = $4, `+wipeChangeRequest+`
+		 WHERE id = $1 AND status = $5`,
+		id, status, appliedVersion, reason, ChangeApproved,
+	)
+	if err != nil {
+		return fmt.Errorf("finishing change request: %w", err)
+	}
+	return nil
+}
+
+// ExpireChangeRequests expires every pending change request past its expiry
+// and returns them.
+func (db *DB) ExpireChangeRequests(ctx context.Context) ([]ChangeRequest, error) {
+	rows, err := db.Pool.Query(ctx,
+		`UPDATE change_requests cr SET status = $1, `+wipeChangeRequest+`
+		 WHERE cr.status = $2 AND cr.expires_at <= now()
+		 RETURNING `+changeRequestColumns,
+		ChangeExpired, ChangePending,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("expiring change requests: %w", err)
+	}
+	defer rows.Close()
+
+	var expired []ChangeRequest
+	for rows.Next() {
+		cr, err := scanChangeRequest(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scanning change request: %w", err)
+		}
+		expired = append(expired, *cr)
+	}
+	return expired, rows.Err()
+}
+
+// ChangeRequestWatchers returns who is notified about a change request: the
+// project's organization and owner, the requester and the approver team's
+// members, without duplicates.
+func (db *DB) ChangeRequestWatchers(ctx context.Context, cr *ChangeRequest) ([]string, error) {
+	project, err := db.GetProjectByID(ctx, cr.ProjectID)
+	if err != nil {
+		return nil, err
+	}
+	members, err := db.ListTeamMembers(ctx, cr.TeamID)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := []string{project.OrgID, project.CreatedBy, cr.RequestedBy}
+	for _, m := range members {
+		ids = append(ids, m.UserID)
+	}
+	seen := make(map[string]bool, len(ids))
+	var watchers []string
+	for _, id := range ids {
+		if id != "" && !seen[id] {
+			seen[id] = true
+			watchers = append(watchers, id)
+		}
+	}
+	return watchers, nil
+}
@@ -0,0 +1,191 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// SetUserPublicKey registers or replaces a user's X25519 public key.
+func (db *DB) SetUserPublicKey(ctx context.Context, userID string, publicKey []byte) error {
+	_, err := db.Pool.Exec(ctx,
+		`INSERT INTO user_public_keys (user_id, public_key)
+		 VALUES ($1, $2)
+		 ON CONFLICT (user_id) DO UPDATE SET public_key = EXCLUDED.public_key, updated_at = now()`,
+		userID, publicKey,
+	)
+	if err != nil {
+		return fmt.Errorf("setting user public key: %w", err)
+	}
+	return nil
+}
+
+// GetUserPublicKey returns a user's X25519 public key.
+func (db *DB) GetUserPublicKey(ctx context.Context, userID string) ([]byte, error) {
+	var publicKey []byte
+	err := db.Pool.QueryRow(ctx,
+		`SELECT public_key FROM user_public_keys WHERE user_id = $1`,
+		userID,
+	).Scan(&publicKey)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("public key not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("getting user public key: %w", err)
+	}
+	return publicKey, nil
+}
+
+// ListE2EMembers returns the users holding the current key version of an
+// end-to-end encrypted project, with their registered public keys.
+func (db *DB) ListE2EMembers(ctx context.Context, projectID string) ([]E2EMember, error) {
+	rows, err := db.Pool.Query(ctx,
+		`SELECT u.id, u.email, pk.public_key, mk.key_version
+		 FROM project_member_keys mk
+		 JOIN projects p ON p.id = mk.project_id AND p.e2e_key_version = mk.key_version
+		 JOIN users u ON u.id = mk.user_id
+		 LEFT JOIN user_public_keys pk ON pk.user_id = mk.user_id
+		 WHERE mk.project_id = $1
+		 ORDER BY u.email`,
+		projectID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("listing e2e members: %w", err)
+	}
+	defer rows.Close()
+
+	var members []E2EMember
+	for rows.Next() {
+		var m E2EMember
+		if err := rows.Scan(&m.UserID, &m.Email, &m.PublicKey, &m.KeyVersion); err != nil {
+			return nil, fmt.Errorf("scanning e2e member: %w", err)
+		}
+		members = append(members, m)
+	}
+	return members, rows.Err()
+}
+
+// ListProjectMemberKeys returns every project key version sealed to a user,
+// oldest first.
+func (db *DB) ListProjectMemberKeys(ctx context.Context, projectID, userID string) ([]ProjectMemberKey, error) {
+	rows, err := db.Pool.Query(ctx,
+		`SELECT project_id, user_id, key_version, sealed_key, COALESCE(created_by::text, ''), created_at
+		 FROM project_member_keys
+		 WHERE project_id = $1 AND user_id = $2
+		 ORDER BY key_version`,
+		projectID, userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("listing project member keys: %w", err)
+	}
+	defer rows.Close()
+
+	var keys []ProjectMemberKey
+	for rows.Next() {
+		var k ProjectMemberKey
+		if err := rows.Scan(&k.ProjectID, &k.UserID, &k.KeyVersion, &k.SealedKey, &k.CreatedBy, &k.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scanning project member key: %w", err)
+		}
+		keys = append(keys, k)
+	}
+	return keys, rows.Err()
+}
+
+// IsE2EMember reports whether a user holds the current key version of a
+// project.
+func (db *DB) IsE2EMember(ctx context.Context, projectID, userID string) (bool, error) {
+	var exists bool
+	err := db.Pool.QueryRow(ctx,
+		`SELECT EXISTS (
+		   SELECT 1 FROM project_member_keys mk
+		   JOIN projects p ON p.id = mk.project_id AND p.e2e_key_version = mk.key_version
+		   WHERE mk.project_id = $1 AND mk.user_id = $2
+		 )`,
+		projectID, userID,
+	).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("checking e2e membership: %w", err)
+	}
+	return exists, nil
+}
+
+// AddProjectMemberKeys stores project key versions sealed to a member. Keys
+// already stored for the same user and version are replaced.
+func (db *DB) AddProjectMemberKeys(ctx context.Context, projectID, createdBy string, keys []ProjectMemberKey) error {
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("beginning transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err := insertProjectMemberKeys(ctx, tx, projectID, createdBy, keys); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("committing project member keys: %w", err)
+	}
+	return nil
+}
+
+// RotateE2EProjectKey makes prevVersion+1 the project's current key version,
+// sealed to exactly the members in keys. Members left out lose every sealed
+// key of the project. It fails if the current version is no longer
+// prevVersion.
+func (db *DB) RotateE2EProjectKey(ctx context.Context, projectID string, prevVersion int, createdBy string, keys []ProjectMemberKey) error {
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("beginning transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	result, err := tx.Exec(ctx,
+		`UPDATE projects SET e2e_key_version = $3
+		 WHERE id = $1 AND e2e_key_version = $2 AND encryption_mode = 'e2e'`,
+		projectID, prevVersion, prevVersion+1,
+	)
+	if err != nil {
+		return fmt.Errorf("rotating e2e project key: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("project key was rotated concurrently")
+	}
+
+	members := make([]string, 0, len(keys))
+	for _, k := range keys {
+		members = append(members, k.UserID)
+	}
+	if _, err := tx.Exec(ctx,
+		`DELETE FROM project_member_keys WHERE project_id = $1 AND NOT (user_id = ANY($2::uuid[]))`,
+		projectID, members,
+	); err != nil {
+		return fmt.Errorf("removing e2e members: %w", err)
+	}
+
+	if err := insertProjectMemberKeys(ctx, tx, projectID, createdBy, keys); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("committing e2e key rotation: %w", err)
+	}
+	return nil
+}
+
+func insertProjectMemberKeys(ctx context.Context, tx pgx.Tx, projectID, createdBy string, keys []ProjectMemberKey) error {
+	for _, k := range keys {
+		_, err := tx.Exec(ctx,
+			`INSERT INTO project_member_keys (project_id, user_id, key_version, sealed_key, created_by)
+			 VALUES ($1, $2, $3, $4, $5)
+			 ON CONFLICT (project_id, user_id, key_version)
+			 DO UPDATE SET sealed_key = EXCLUDED.sealed_key, created_by = EXCLUDED.created_by, created_at = now()`,
+			projectID, k.UserID, k.KeyVersion, k.SealedKey, createdBy,
+		)
+		if err != nil {
+			return fmt.Errorf("storing project member key: %w", err)
+		}
+	}
+	return nil
+}
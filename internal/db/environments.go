@@ -0,0 +1,80 @@
+package db
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// Environment is a stage of a project, such as "dev", "staging" or "prod".
+// The secrets of an environment are the ones under "<name>/". An environment
+// with a parent inherits every key it does not define itself from the
+// parent, and from the parent's parent in turn.
+//
+// Environments without a parent form the promotion order of the project, in
+// the order they are listed; child environments are only promoted to when
+// named explicitly.
+type Environment struct {
+	Name   string `json:"name"`
+	Parent string `json:"parent,omitempty"`
+}
+
+// Environment returns the environment of the project named name, or nil.
+func (p *Project) Environment(name string) *Environment {
+	for i := range p.Environments {
+		if p.Environments[i].Name == name {
+			return &p.Environments[i]
+		}
+	}
+	return nil
+}
+
+// SplitEnvironment returns the environment a secret path is in and the key of
+// the secret within it. env is "" if the path is not in an environment.
+func (p *Project) SplitEnvironment(path string) (env, key string) {
+	name, key, ok := strings.Cut(path, "/")
+	if !ok || key == "" || p.Environment(name) == nil {
+		return "", path
+	}
+	return name, key
+}
+
+// EnvironmentAncestors returns the environments that environment name
+// inherits from, nearest first.
+func (p *Project) EnvironmentAncestors(name string) []string {
+	var ancestors []string
+	env := p.Environment(name)
+	// Parents are always listed before their children, but a bad row must
+	// not loop forever
+	for env != nil && env.Parent != "" && len(ancestors) < len(p.Environments) {
+		ancestors = append(ancestors, env.Parent)
+		env = p.Environment(env.Parent)
+	}
+	return ancestors
+}
+
+// NextEnvironment returns the environment that secrets of environment name
+// are promoted to by default: the next environment without a parent. It
+// returns "" for the last one and for child environments.
+func (p *Project) NextEnvironment(name string) string {
+	found := false
+	for _, env := range p.Environments {
+		if env.Parent != "" {
+			continue
+		}
+		if found {
+			return env.Name
+		}
+		found = env.Name == name
+	}
+	return ""
+}
+
+// environmentsJSON encodes environments for a JSONB parameter; nil stays
+// NULL so COALESCE keeps the current value.
+func environmentsJSON(envs []Environment) interface{} {
+	if envs == nil {
+		return nil
+	}
+	b, _ := json.Marshal(envs)
+	return string(b)
+}
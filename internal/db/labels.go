@@ -0,0 +1,115 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/teamvault/teamvault/internal/labels"
+)
+
+// SecretSearch selects active secrets by project, path prefix and labels.
+type SecretSearch struct {
+	ProjectID  string // empty searches every project
+	PathPrefix string
+	Selector   labels.Selector
+	Limit      int
+}
+
+// SecretSearchResult is a secret found by SearchSecrets.
+type SecretSearchResult struct {
+	Secret
+	ProjectName string
+}
+
+// labelsJSON encodes labels for a JSONB parameter; nil stays NULL.
+func labelsJSON(l map[string]string) interface{} {
+	if l == nil {
+		return nil
+	}
+	b, _ := json.Marshal(l)
+	return string(b)
+}
+
+// SetSecretLabels replaces the labels of a secret.
+func (db *DB) SetSecretLabels(ctx context.Context, secretID string, l map[string]string) error {
+	if l == nil {
+		l = map[string]string{}
+	}
+	_, err := db.Pool.Exec(ctx,
+		`UPDATE secrets SET labels = $2::jsonb WHERE id = $1`,
+		secretID, labelsJSON(l),
+	)
+	if err != nil {
+		return fmt.Errorf("updating secret labels: %w", err)
+	}
+	return nil
+}
+
+// SearchSecrets returns the active secrets matching a search, ordered by
+// project and path.
+func (db *DB) SearchSecrets(ctx context.Context, search SecretSearch) ([]SecretSearchResult, error) {
+	var args []interface{}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	where := []string{
+		"deleted_at IS NULL",
+		"project_id IN (SELECT id FROM projects WHERE deleted_at IS NULL)",
+	}
+	if search.ProjectID != "" {
+		where = append(where, "project_id = "+arg(search.ProjectID))
+	}
+	if search.PathPrefix != "" {
+		where = append(where, "starts_with(path, "+arg(search.PathPrefix)+")")
+	}
+	for _, r := range search.Selector {
+		switch r.Operator {
+		case labels.Equals:
+			where = append(where, "labels @> "+arg(labelsJSON(map[string]string{r.Key: r.Values[0]}))+"::jsonb")
+		case labels.NotEquals:
+			where = append(where, "NOT labels @> "+arg(labelsJSON(map[string]string{r.Key: r.Values[0]}))+"::jsonb")
+		case labels.In:
+			where = append(where, "labels->>"+arg(r.Key)+" = ANY("+arg(r.Values)+"::text[])")
+		case labels.NotIn:
+			where = append(where, "NOT COALESCE(labels->>"+arg(r.Key)+" = ANY("+arg(r.Values)+"::text[]), false)")
+		case labels.Exists:
+			where = append(where, "labels ? "+arg(r.Key))
+		case labels.DoesNotExist:
+			where = append(where, "NOT labels ? "+arg(r.Key))
+		default:
+			return nil, fmt.Errorf("unsupported selector operator %q", r.Operator)
+		}
+	}
+	limit := search.Limit
+	if limit <= 0 {
+		limit = 1000
+	}
+
+	rows, err := db.Pool.Query(ctx,
+		`SELECT `+secretColumns+`, (SELECT name FROM projects WHERE id = secrets.project_id) AS project_name
+		 FROM secrets
+		 WHERE `+strings.Join(where, " AND ")+`
+		 ORDER BY project_name, path
+		 LIMIT `+arg(limit),
+		args...,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("searching secrets: %w", err)
+	}
+	defer rows.Close()
+
+	var results []SecretSearchResult
+	for rows.Next() {
+		var r SecretSearchResult
+		if err := rows.Scan(append(secretFields(&r.Secret), &r.ProjectName)...); err != nil {
+			return nil, fmt.Errorf("scanning secret: %w", err)
+		}
+		results = append(results, r)
+	}
+	return results, rows.Err()
+}
@@ -6,19 +6,20 @@ import (
 	"time"
 )
 
-// CreateLease inserts a new lease.
-func (db *DB) CreateLease(ctx context.Context, orgID *string, secretPath, leaseType string,
-	valueCiphertext, encryptedDEK, nonce, dekNonce []byte,
+// CreateLease inserts a new lease. projectID is optional; when set, the DEK is
+// wrapped by that project's KEK version kekVersion.
+func (db *DB) CreateLease(ctx context.Context, orgID, projectID *string, secretPath, leaseType string,
+	valueCiphertext, encryptedDEK, nonce, dekNonce []byte, masterKeyVersion, kekVersion int,
 	issuedTo string, expiresAt time.Time) (*Lease, error) {
 
 	lease := &Lease{}
 	err := db.Pool.QueryRow(ctx,
-		`INSERT INTO leases (org_id, secret_path, lease_type, value_ciphertext, encrypted_dek, nonce, dek_nonce, issued_to, expires_at)
-		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
-		 RETURNING id, org_id, secret_path, lease_type, value_ciphertext, encrypted_dek, nonce, dek_nonce, issued_to, issued_at, expires_at, revoked_at`,
-		orgID, secretPath, leaseType, valueCiphertext, encryptedDEK, nonce, dekNonce, issuedTo, expiresAt,
-	).Scan(&lease.ID, &lease.OrgID, &lease.SecretPath, &lease.LeaseType,
-		&lease.ValueCiphertext, &lease.EncryptedDEK, &lease.Nonce, &lease.DEKNonce,
+		`INSERT INTO leases (org_id, project_id, secret_path, lease_type, value_ciphertext, encrypted_dek, nonce, dek_nonce, master_key_version, kek_version, issued_to, expires_at)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		 RETURNING id, org_id, project_id, secret_path, lease_type, value_ciphertext, encrypted_dek, nonce, dek_nonce, master_key_version, kek_version, issued_to, issued_at, expires_at, revoked_at`,
+		orgID, projectID, secretPath, leaseType, valueCiphertext, encryptedDEK, nonce, dekNonce, masterKeyVersion, kekVersion, issuedTo, expiresAt,
+	).Scan(&lease.ID, &lease.OrgID, &lease.ProjectID, &lease.SecretPath, &lease.LeaseType,
+		&lease.ValueCiphertext, &lease.EncryptedDEK, &lease.Nonce, &lease.DEKNonce, &lease.MasterKeyVersion, &lease.KEKVersion,
 		&lease.IssuedTo, &lease.IssuedAt, &lease.ExpiresAt, &lease.RevokedAt)
 	if err != nil {
 		return nil, fmt.Errorf("creating lease: %w", err)
@@ -30,11 +31,11 @@ func (db *DB) CreateLease(ctx context.Context, orgID *string, secretPath, leaseT
 func (db *DB) GetLeaseByID(ctx context.Context, id string) (*Lease, error) {
 	lease := &Lease{}
 	err := db.Pool.QueryRow(ctx,
-		`SELECT id, org_id, secret_path, lease_type, value_ciphertext, encrypted_dek, nonce, dek_nonce, issued_to, issued_at, expires_at, revoked_at
+		`SELECT id, org_id, project_id, secret_path, lease_type, value_ciphertext, encrypted_dek, nonce, dek_nonce, master_key_version, kek_version, issued_to, issued_at, expires_at, revoked_at
 		 FROM leases WHERE id = $1`,
 		id,
-	).Scan(&lease.ID, &lease.OrgID, &lease.SecretPath, &lease.LeaseType,
-		&lease.ValueCiphertext, &lease.EncryptedDEK, &lease.Nonce, &lease.DEKNonce,
+	).Scan(&lease.ID, &lease.OrgID, &lease.ProjectID, &lease.SecretPath, &lease.LeaseType,
+		&lease.ValueCiphertext, &lease.EncryptedDEK, &lease.Nonce, &lease.DEKNonce, &lease.MasterKeyVersion, &lease.KEKVersion,
 		&lease.IssuedTo, &lease.IssuedAt, &lease.ExpiresAt, &lease.RevokedAt)
 	if err != nil {
 		return nil, fmt.Errorf("getting lease by id: %w", err)
@@ -45,7 +46,7 @@ func (db *DB) GetLeaseByID(ctx context.Context, id string) (*Lease, error) {
 // ListActiveLeases returns all non-revoked, non-expired leases.
 func (db *DB) ListActiveLeases(ctx context.Context) ([]Lease, error) {
 	rows, err := db.Pool.Query(ctx,
-		`SELECT id, org_id, secret_path, lease_type, value_ciphertext, encrypted_dek, nonce, dek_nonce, issued_to, issued_at, expires_at, revoked_at
+		`SELECT id, org_id, project_id, secret_path, lease_type, value_ciphertext, encrypted_dek, nonce, dek_nonce, master_key_version, kek_version, issued_to, issued_at, expires_at, revoked_at
 		 FROM leases
 		 WHERE revoked_at IS NULL AND expires_at > now()
 		 ORDER BY issued_at DESC`,
@@ -58,8 +59,8 @@ func (db *DB) ListActiveLeases(ctx context.Context) ([]Lease, error) {
 	var leases []Lease
 	for rows.Next() {
 		var l Lease
-		if err := rows.Scan(&l.ID, &l.OrgID, &l.SecretPath, &l.LeaseType,
-			&l.ValueCiphertext, &l.EncryptedDEK, &l.Nonce, &l.DEKNonce,
+		if err := rows.Scan(&l.ID, &l.OrgID, &l.ProjectID, &l.SecretPath, &l.LeaseType,
+			&l.ValueCiphertext, &l.EncryptedDEK, &l.Nonce, &l.DEKNonce, &l.MasterKeyVersion, &l.KEKVersion,
 			&l.IssuedTo, &l.IssuedAt, &l.ExpiresAt, &l.RevokedAt); err != nil {
 			return nil, fmt.Errorf("scanning lease: %w", err)
 		}
@@ -0,0 +1,263 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// UserMFA is the TOTP enrollment of a user. TOTPSecret is encrypted.
+type UserMFA struct {
+	UserID       string     `json:"user_id"`
+	TOTPSecret   string     `json:"-"`
+	EnabledAt    *time.Time `json:"enabled_at,omitempty"` // nil while enrollment is unconfirmed
+	LastUsedStep int64      `json:"-"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+// RecoveryCode is an unused recovery code of a user.
+type RecoveryCode struct {
+	ID       string
+	CodeHash string
+}
+
+// MFAChallenge is a pending second login step.
+type MFAChallenge struct {
+	ID        string
+	UserID    string
+	Method    string // how the user passed the first step: "pwd" or "oidc"
+	Attempts  int
+	ExpiresAt time.Time
+}
+
+// GetUserMFA returns the TOTP enrollment of a user, confirmed or not.
+func (db *DB) GetUserMFA(ctx context.Context, userID string) (*UserMFA, error) {
+	m := &UserMFA{}
+	err := db.Pool.QueryRow(ctx,
+		`SELECT user_id, totp_secret, enabled_at, last_used_step, created_at
+		 FROM user_mfa WHERE user_id = $1`,
+		userID,
+	).Scan(&m.UserID, &m.TOTPSecret, &m.EnabledAt, &m.LastUsedStep, &m.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("mfa not enrolled")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("getting user mfa: %w", err)
+	}
+	return m, nil
+}
+
+// StartMFAEnrollment stores a new, unconfirmed TOTP secret for a user,
+// replacing an earlier unconfirmed one. It fails if MFA is already enabled.
+func (db *DB) StartMFAEnrollment(ctx context.Context, userID, totpSecret string) error {
+	tag, err := db.Pool.Exec(ctx,
+		`INSERT INTO user_mfa (user_id, totp_secret) VALUES ($1, $2)
+		 ON CONFLICT (user_id) DO UPDATE SET totp_secret = EXCLUDED.totp_secret, last_used_step = 0, created_at = now()
+		 WHERE user_mfa.enabled_at IS NULL`,
+		userID, totpSecret,
+	)
+	if err != nil {
+		return fmt.Errorf("starting mfa enrollment: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("mfa already enabled")
+	}
+	return nil
+}
+
+// EnableMFA confirms the TOTP enrollment of a user with the time step of the
+// code they confirmed it with, and replaces their recovery codes.
+func (db *DB) EnableMFA(ctx context.Context, userID string, step int64, recoveryHashes []string) error {
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("beginning transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx,
+		`UPDATE user_mfa SET enabled_at = now(), last_used_step = $2
+		 WHERE user_id = $1 AND enabled_at IS NULL`,
+		userID, step,
+	)
+	if err != nil {
+		return fmt.Errorf("enabling mfa: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("no pending mfa enrollment")
+	}
+	if err := replaceRecoveryCodes(ctx, tx, userID, recoveryHashes); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("committing transaction: %w", err)
+	}
+	return nil
+}
+
+// DisableMFA removes the TOTP enrollment and recovery codes of a user.
+func (db *DB) DisableMFA(ctx context.Context, userID string) error {
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("beginning transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, `DELETE FROM user_mfa WHERE user_id = $1`, userID)
+	if err != nil {
+		return fmt.Errorf("disabling mfa: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("mfa not enrolled")
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("deleting recovery codes: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("committing transaction: %w", err)
+	}
+	return nil
+}
+
+// UseTOTPStep records that a user's TOTP code of the given time step was
+// used. It reports false if a code of that step or a later one was used
+// already, so each code works once.
+func (db *DB) UseTOTPStep(ctx context.Context, userID string, step int64) (bool, error) {
+	tag, err := db.Pool.Exec(ctx,
+		`UPDATE user_mfa SET last_used_step = $2
+		 WHERE user_id = $1 AND enabled_at IS NOT NULL AND last_used_step < $2`,
+		userID, step,
+	)
+	if err != nil {
+		return false, fmt.Errorf("using totp code: %w", err)
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// ListRecoveryCodes returns the unused recovery codes of a user.
+func (db *DB) ListRecoveryCodes(ctx context.Context, userID string) ([]RecoveryCode, error) {
+	rows, err := db.Pool.Query(ctx,
+		`SELECT id, code_hash FROM mfa_recovery_codes WHERE user_id = $1 AND used_at IS NULL`,
+		userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("listing recovery codes: %w", err)
+	}
+	defer rows.Close()
+
+	var codes []RecoveryCode
+	for rows.Next() {
+		var c RecoveryCode
+		if err := rows.Scan(&c.ID, &c.CodeHash); err != nil {
+			return nil, fmt.Errorf("scanning recovery code: %w", err)
+		}
+		codes = append(codes, c)
+	}
+	return codes, rows.Err()
+}
+
+// UseRecoveryCode marks a recovery code used. It reports false if it was
+// used already.
+func (db *DB) UseRecoveryCode(ctx context.Context, id string) (bool, error) {
+	tag, err := db.Pool.Exec(ctx,
+		`UPDATE mfa_recovery_codes SET used_at = now() WHERE id = $1 AND used_at IS NULL`,
+		id,
+	)
+	if err != nil {
+		return false, fmt.Errorf("using recovery code: %w", err)
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// ReplaceRecoveryCodes replaces all recovery codes of a user.
+func (db *DB) ReplaceRecoveryCodes(ctx context.Context, userID string, hashes []string) error {
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("beginning transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err := replaceRecoveryCodes(ctx, tx, userID, hashes); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("committing transaction: %w", err)
+	}
+	return nil
+}
+
+func replaceRecoveryCodes(ctx context.Context, tx pgx.Tx, userID string, hashes []string) error {
+	if _, err := tx.Exec(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("deleting recovery codes: %w", err)
+	}
+	for _, h := range hashes {
+		if _, err := tx.Exec(ctx,
+			`INSERT INTO mfa_recovery_codes (user_id, code_hash) VALUES ($1, $2)`,
+			userID, h,
+		); err != nil {
+			return fmt.Errorf("inserting recovery code: %w", err)
+		}
+	}
+	return nil
+}
+
+// CreateMFAChallenge records a pending second login step for a user, found
+// by the hash of its token. Expired challenges are dropped.
+func (db *DB) CreateMFAChallenge(ctx context.Context, userID, tokenHash, method string, expiresAt time.Time) error {
+	if _, err := db.Pool.Exec(ctx, `DELETE FROM mfa_challenges WHERE expires_at < now()`); err != nil {
+		return fmt.Errorf("pruning mfa challenges: %w", err)
+	}
+	_, err := db.Pool.Exec(ctx,
+		`INSERT INTO mfa_challenges (user_id, token_hash, method, expires_at) VALUES ($1, $2, $3, $4)`,
+		userID, tokenHash, method, expiresAt,
+	)
+	if err != nil {
+		return fmt.Errorf("creating mfa challenge: %w", err)
+	}
+	return nil
+}
+
+// GetMFAChallenge returns the open challenge with the given token hash:
+// not expired, not completed and with attempts left.
+func (db *DB) GetMFAChallenge(ctx context.Context, tokenHash string, maxAttempts int) (*MFAChallenge, error) {
+	c := &MFAChallenge{}
+	err := db.Pool.QueryRow(ctx,
+		`SELECT id, user_id, method, attempts, expires_at FROM mfa_challenges
+		 WHERE token_hash = $1 AND used_at IS NULL AND expires_at > now() AND attempts < $2`,
+		tokenHash, maxAttempts,
+	).Scan(&c.ID, &c.UserID, &c.Method, &c.Attempts, &c.ExpiresAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("mfa challenge not found or expired")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("getting mfa challenge: %w", err)
+	}
+	return c, nil
+}
+
+// FailMFAChallenge counts a wrong code against a challenge.
+func (db *DB) FailMFAChallenge(ctx context.Context, id string) error {
+	_, err := db.Pool.Exec(ctx, `UPDATE mfa_challenges SET attempts = attempts + 1 WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("updating mfa challenge: %w", err)
+	}
+	return nil
+}
+
+// CompleteMFAChallenge marks a challenge completed. It reports false if it
+// was completed already.
+func (db *DB) CompleteMFAChallenge(ctx context.Context, id string) (bool, error) {
+	tag, err := db.Pool.Exec(ctx,
+		`UPDATE mfa_challenges SET used_at = now() WHERE id = $1 AND used_at IS NULL`,
+		id,
+	)
+	if err != nil {
+		return false, fmt.Errorf("completing mfa challenge: %w", err)
+	}
+	return tag.RowsAffected() == 1, nil
+}
@@ -15,40 +15,73 @@ type User struct {
 	CreatedAt    time.Time `json:"created_at"`
 }
 
+// Project encryption modes.
+const (
+	// EncryptionModeServer projects are envelope-encrypted by the server.
+	EncryptionModeServer = "server"
+	// EncryptionModeE2E projects hold values encrypted client-side to a
+	// project key the server never sees.
+	EncryptionModeE2E = "e2e"
+)
+
 // Project represents a secrets project/namespace.
 type Project struct {
-	ID          string    `json:"id"`
-	Name        string    `json:"name"`
-	Description string    `json:"description,omitempty"`
-	CreatedBy   string    `json:"created_by"`
-	CreatedAt   time.Time `json:"created_at"`
+	ID                   string    `json:"id"`
+	Name                 string    `json:"name"`
+	Description          string    `json:"description,omitempty"`
+	EncryptionMode       string    `json:"encryption_mode"`
+	E2EKeyVersion        int       `json:"e2e_key_version,omitempty"` // current client-side project key
+	RequireCAS           bool      `json:"require_cas"`               // every secret write must pass cas
+	MaxVersions          int       `json:"max_versions"`              // default version limit, 0 = unlimited
+	MaxVersionAgeSeconds int64     `json:"max_version_age_seconds"`   // default version max age, 0 = unlimited
+	OrgID                string    `json:"org_id,omitempty"`          // org whose IAM policies apply
+	CreatedBy            string    `json:"created_by"`
+	CreatedAt            time.Time `json:"created_at"`
+
+	// Environments in promotion order; see Environment
+	Environments []Environment `json:"environments,omitempty"`
+	// Paths whose writes need approval; see ApprovalRule
+	ApprovalRules []ApprovalRule `json:"approval_rules,omitempty"`
+	// Teams whose leads approve access requests to the project's secrets
+	AccessTeams []string `json:"access_teams,omitempty"`
+}
+
+// IsE2E reports whether the project is end-to-end encrypted.
+func (p *Project) IsE2E() bool {
+	return p.EncryptionMode == EncryptionModeE2E
 }
 
 // Secret represents a secret entry (metadata only, no value).
 type Secret struct {
-	ID          string          `json:"id"`
-	ProjectID   string          `json:"project_id"`
-	Path        string          `json:"path"`
-	Description string          `json:"description,omitempty"`
-	SecretType  string          `json:"secret_type"`
-	Metadata    json.RawMessage `json:"metadata,omitempty"`
-	CreatedBy   string          `json:"created_by"`
-	CreatedAt   time.Time       `json:"created_at"`
-	DeletedAt   *time.Time      `json:"deleted_at,omitempty"`
+	ID                   string            `json:"id"`
+	ProjectID            string            `json:"project_id"`
+	Path                 string            `json:"path"`
+	Description          string            `json:"description,omitempty"`
+	SecretType           string            `json:"secret_type"`
+	Metadata             json.RawMessage   `json:"metadata,omitempty"`
+	Labels               map[string]string `json:"labels,omitempty"`
+	MaxVersions          *int              `json:"max_versions,omitempty"`            // nil = project default
+	MaxVersionAgeSeconds *int64            `json:"max_version_age_seconds,omitempty"` // nil = project default
+	CreatedBy            string            `json:"created_by"`
+	CreatedAt            time.Time         `json:"created_at"`
+	DeletedAt            *time.Time        `json:"deleted_at,omitempty"`
 }
 
 // SecretVersion represents an encrypted version of a secret value.
 type SecretVersion struct {
-	ID               string    `json:"id"`
-	SecretID         string    `json:"secret_id"`
-	Version          int       `json:"version"`
-	Ciphertext       []byte    `json:"-"` // Never expose raw crypto in JSON
-	Nonce            []byte    `json:"-"`
-	EncryptedDEK     []byte    `json:"-"`
-	DEKNonce         []byte    `json:"-"`
-	MasterKeyVersion int       `json:"-"`
-	CreatedBy        string    `json:"created_by"`
-	CreatedAt        time.Time `json:"created_at"`
+	ID               string     `json:"id"`
+	SecretID         string     `json:"secret_id"`
+	Version          int        `json:"version"`
+	Ciphertext       []byte     `json:"-"` // Never expose raw crypto in JSON
+	Nonce            []byte     `json:"-"`
+	EncryptedDEK     []byte     `json:"-"`
+	DEKNonce         []byte     `json:"-"`
+	MasterKeyVersion int        `json:"-"`
+	KEKVersion       int        `json:"-"`
+	FormatVersion    int        `json:"-"`
+	CreatedBy        string     `json:"created_by"`
+	CreatedAt        time.Time  `json:"created_at"`
+	DestroyedAt      *time.Time `json:"destroyed_at,omitempty"` // ciphertext wiped
 }
 
 // ServiceAccount represents a service account for programmatic access.
@@ -61,6 +94,8 @@ type ServiceAccount struct {
 	CreatedBy string    `json:"created_by"`
 	CreatedAt time.Time `json:"created_at"`
 	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	// LegacyToken is set while the token predates token IDs; rotate it
+	LegacyToken bool `json:"legacy_token,omitempty"`
 }
 
 // Policy represents an access control policy.
@@ -83,6 +118,9 @@ type Org struct {
 	Description string    `json:"description,omitempty"`
 	CreatedBy   string    `json:"created_by"`
 	CreatedAt   time.Time `json:"created_at"`
+
+	// Which teams may break glass, and on which secrets
+	BreakGlassRules []BreakGlassRule `json:"break_glass_rules"`
 }
 
 // Team represents a team within an organization.
@@ -110,10 +148,12 @@ type Agent struct {
 	Description string          `json:"description,omitempty"`
 	TokenHash   string          `json:"-"` // Never expose in JSON
 	Scopes      []string        `json:"scopes"`
+	Role        string          `json:"role,omitempty"` // role presented to policies; set by a team lead or admin
 	Metadata    json.RawMessage `json:"metadata,omitempty"`
 	CreatedBy   string          `json:"created_by"`
 	CreatedAt   time.Time       `json:"created_at"`
 	ExpiresAt   *time.Time      `json:"expires_at,omitempty"`
+	LegacyToken bool            `json:"legacy_token,omitempty"` // token predates token IDs; rotate it
 }
 
 // IAMPolicy represents an enterprise IAM policy (RBAC, ABAC, or PBAC).
@@ -161,16 +201,88 @@ type RotationSchedule struct {
 
 // Lease represents a dynamic secret lease.
 type Lease struct {
-	ID              string     `json:"id"`
-	OrgID           *string    `json:"org_id,omitempty"`
-	SecretPath      string     `json:"secret_path"`
-	LeaseType       string     `json:"lease_type"`
-	ValueCiphertext []byte     `json:"-"`
-	EncryptedDEK    []byte     `json:"-"`
-	Nonce           []byte     `json:"-"`
-	DEKNonce        []byte     `json:"-"`
-	IssuedTo        string     `json:"issued_to"`
-	IssuedAt        time.Time  `json:"issued_at"`
-	ExpiresAt       time.Time  `json:"expires_at"`
-	RevokedAt       *time.Time `json:"revoked_at,omitempty"`
+	ID               string     `json:"id"`
+	OrgID            *string    `json:"org_id,omitempty"`
+	SecretPath       string     `json:"secret_path"`
+	LeaseType        string     `json:"lease_type"`
+	ValueCiphertext  []byte     `json:"-"`
+	EncryptedDEK     []byte     `json:"-"`
+	Nonce            []byte     `json:"-"`
+	DEKNonce         []byte     `json:"-"`
+	MasterKeyVersion int        `json:"-"`
+	ProjectID        *string    `json:"project_id,omitempty"`
+	KEKVersion       int        `json:"-"`
+	IssuedTo         string     `json:"issued_to"`
+	IssuedAt         time.Time  `json:"issued_at"`
+	ExpiresAt        time.Time  `json:"expires_at"`
+	RevokedAt        *time.Time `json:"revoked_at,omitempty"`
+}
+
+// SealConfig holds the sealed master keyring and Shamir parameters.
+type SealConfig struct {
+	SecretShares     int       `json:"secret_shares"`
+	SecretThreshold  int       `json:"secret_threshold"`
+	EncryptedKeyring []byte    `json:"-"`
+	KeyringNonce     []byte    `json:"-"`
+	InitializedBy    *string   `json:"initialized_by,omitempty"`
+	CreatedAt        time.Time `json:"created_at"`
+}
+
+// TransitKey is a named encryption/signing key used by the transit API.
+type TransitKey struct {
+	ID                string    `json:"id"`
+	Name              string    `json:"name"`
+	KeyType           string    `json:"type"`
+	LatestVersion     int       `json:"latest_version"`
+	MinDecryptVersion int       `json:"min_decrypt_version"`
+	CreatedBy         *string   `json:"created_by,omitempty"`
+	CreatedAt         time.Time `json:"created_at"`
+	UpdatedAt         time.Time `json:"updated_at"`
+}
+
+// TransitKeyVersion holds the envelope-encrypted material of one key version.
+type TransitKeyVersion struct {
+	ID               string    `json:"id"`
+	KeyID            string    `json:"key_id"`
+	Version          int       `json:"version"`
+	Ciphertext       []byte    `json:"-"`
+	Nonce            []byte    `json:"-"`
+	EncryptedDEK     []byte    `json:"-"`
+	DEKNonce         []byte    `json:"-"`
+	MasterKeyVersion int       `json:"-"`
+	FormatVersion    int       `json:"-"`
+	CreatedAt        time.Time `json:"created_at"`
+}
+
+// ProjectKey is one version of a project's key encryption key, wrapped by the
+// master key. EncryptedKEK is nil once the version has been destroyed.
+type ProjectKey struct {
+	ID               string     `json:"id"`
+	ProjectID        string     `json:"project_id"`
+	Version          int        `json:"version"`
+	EncryptedKEK     []byte     `json:"-"`
+	KEKNonce         []byte     `json:"-"`
+	MasterKeyVersion int        `json:"master_key_version"`
+	CreatedAt        time.Time  `json:"created_at"`
+	DestroyedAt      *time.Time `json:"destroyed_at,omitempty"`
+}
+
+// ProjectMemberKey is an E2E project key version sealed to one member's
+// X25519 public key. Only the member's private key can open it.
+type ProjectMemberKey struct {
+	ProjectID  string    `json:"project_id"`
+	UserID     string    `json:"user_id"`
+	Email      string    `json:"email,omitempty"`
+	KeyVersion int       `json:"key_version"`
+	SealedKey  []byte    `json:"sealed_key"`
+	CreatedBy  string    `json:"created_by"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// E2EMember is a user holding the current key of an E2E project.
+type E2EMember struct {
+	UserID     string `json:"user_id"`
+	Email      string `json:"email"`
+	PublicKey  []byte `json:"public_key,omitempty"`
+	KeyVersion int    `json:"key_version"`
 }
@@ -11,9 +11,9 @@ func (db *DB) CreateOrg(ctx context.Context, name, description, createdBy string
 	err := db.Pool.QueryRow(ctx,
 		`INSERT INTO orgs (name, description, created_by)
 		 VALUES ($1, $2, $3)
-		 RETURNING id, name, COALESCE(description, ''), created_by, created_at`,
+		 RETURNING id, name, COALESCE(description, ''), created_by, created_at, break_glass_rules`,
 		name, description, createdBy,
-	).Scan(&org.ID, &org.Name, &org.Description, &org.CreatedBy, &org.CreatedAt)
+	).Scan(&org.ID, &org.Name, &org.Description, &org.CreatedBy, &org.CreatedAt, &org.BreakGlassRules)
 	if err != nil {
 		return nil, fmt.Errorf("creating org: %w", err)
 	}
@@ -24,10 +24,10 @@ func (db *DB) CreateOrg(ctx context.Context, name, description, createdBy string
 func (db *DB) GetOrgByID(ctx context.Context, id string) (*Org, error) {
 	org := &Org{}
 	err := db.Pool.QueryRow(ctx,
-		`SELECT id, name, COALESCE(description, ''), created_by, created_at
+		`SELECT id, name, COALESCE(description, ''), created_by, created_at, break_glass_rules
 		 FROM orgs WHERE id = $1`,
 		id,
-	).Scan(&org.ID, &org.Name, &org.Description, &org.CreatedBy, &org.CreatedAt)
+	).Scan(&org.ID, &org.Name, &org.Description, &org.CreatedBy, &org.CreatedAt, &org.BreakGlassRules)
 	if err != nil {
 		return nil, fmt.Errorf("getting org by id: %w", err)
 	}
@@ -38,10 +38,10 @@ func (db *DB) GetOrgByID(ctx context.Context, id string) (*Org, error) {
 func (db *DB) GetOrgByName(ctx context.Context, name string) (*Org, error) {
 	org := &Org{}
 	err := db.Pool.QueryRow(ctx,
-		`SELECT id, name, COALESCE(description, ''), created_by, created_at
+		`SELECT id, name, COALESCE(description, ''), created_by, created_at, break_glass_rules
 		 FROM orgs WHERE name = $1`,
 		name,
-	).Scan(&org.ID, &org.Name, &org.Description, &org.CreatedBy, &org.CreatedAt)
+	).Scan(&org.ID, &org.Name, &org.Description, &org.CreatedBy, &org.CreatedAt, &org.BreakGlassRules)
 	if err != nil {
 		return nil, fmt.Errorf("getting org by name: %w", err)
 	}
@@ -51,7 +51,7 @@ func (db *DB) GetOrgByName(ctx context.Context, name string) (*Org, error) {
 // ListOrgs returns all organizations.
 func (db *DB) ListOrgs(ctx context.Context) ([]Org, error) {
 	rows, err := db.Pool.Query(ctx,
-		`SELECT id, name, COALESCE(description, ''), created_by, created_at
+		`SELECT id, name, COALESCE(description, ''), created_by, created_at, break_glass_rules
 		 FROM orgs ORDER BY created_at DESC`,
 	)
 	if err != nil {
@@ -62,7 +62,7 @@ func (db *DB) ListOrgs(ctx context.Context) ([]Org, error) {
 	var orgs []Org
 	for rows.Next() {
 		var o Org
-		if err := rows.Scan(&o.ID, &o.Name, &o.Description, &o.CreatedBy, &o.CreatedAt); err != nil {
+		if err := rows.Scan(&o.ID, &o.Name, &o.Description, &o.CreatedBy, &o.CreatedAt, &o.BreakGlassRules); err != nil {
 			return nil, fmt.Errorf("scanning org: %w", err)
 		}
 		orgs = append(orgs, o)
@@ -0,0 +1,224 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const projectKeyColumns = `id, project_id, version, encrypted_kek, kek_nonce, master_key_version, created_at, destroyed_at`
+
+func scanProjectKey(row pgx.Row) (*ProjectKey, error) {
+	k := &ProjectKey{}
+	err := row.Scan(&k.ID, &k.ProjectID, &k.Version, &k.EncryptedKEK, &k.KEKNonce,
+		&k.MasterKeyVersion, &k.CreatedAt, &k.DestroyedAt)
+	return k, err
+}
+
+// ListProjectKeys returns every KEK version of a project, destroyed ones
+// included, oldest first.
+func (db *DB) ListProjectKeys(ctx context.Context, projectID string) ([]ProjectKey, error) {
+	rows, err := db.Pool.Query(ctx,
+		`SELECT `+projectKeyColumns+` FROM project_keys WHERE project_id = $1 ORDER BY version`,
+		projectID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("listing project keys: %w", err)
+	}
+	defer rows.Close()
+
+	var keys []ProjectKey
+	for rows.Next() {
+		k, err := scanProjectKey(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scanning project key: %w", err)
+		}
+		keys = append(keys, *k)
+	}
+	return keys, rows.Err()
+}
+
+// GetProjectKey retrieves one KEK version of a project.
+func (db *DB) GetProjectKey(ctx context.Context, projectID string, version int) (*ProjectKey, error) {
+	k, err := scanProjectKey(db.Pool.QueryRow(ctx,
+		`SELECT `+projectKeyColumns+` FROM project_keys WHERE project_id = $1 AND version = $2`,
+		projectID, version,
+	))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("project key not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("getting project key: %w", err)
+	}
+	return k, nil
+}
+
+// CreateProjectKey stores a new wrapped KEK version. It fails with a unique
+// violation if the version already exists.
+func (db *DB) CreateProjectKey(ctx context.Context, projectID string, version int, encryptedKEK, kekNonce []byte, masterKeyVersion int) (*ProjectKey, error) {
+	k, err := scanProjectKey(db.Pool.QueryRow(ctx,
+		`INSERT INTO project_keys (project_id, version, encrypted_kek, kek_nonce, master_key_version)
+		 VALUES ($1, $2, $3, $4, $5)
+		 RETURNING `+projectKeyColumns,
+		projectID, version, encryptedKEK, kekNonce, masterKeyVersion,
+	))
+	if err != nil {
+		return nil, fmt.Errorf("creating project key: %w", err)
+	}
+	return k, nil
+}
+
+// DestroyProjectKeysBelow destroys every KEK version of a project older than
+// version by clearing the wrapped key. Returns the number destroyed.
+func (db *DB) DestroyProjectKeysBelow(ctx context.Context, projectID string, version int) (int64, error) {
+	result, err := db.Pool.Exec(ctx,
+		`UPDATE project_keys SET encrypted_kek = NULL, kek_nonce = NULL, destroyed_at = now()
+		 WHERE project_id = $1 AND version < $2 AND destroyed_at IS NULL`,
+		projectID, version,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("destroying project keys: %w", err)
+	}
+	return result.RowsAffected(), nil
+}
+
+// ListProjectDEKs returns up to limit DEKs of a project's secret versions,
+// leases or pending change requests that are not yet wrapped by KEK version
+// targetKEK, ordered by ID and starting after afterID.
+func (db *DB) ListProjectDEKs(ctx context.Context, table, projectID string, targetKEK int, afterID string, limit int) ([]WrappedDEK, error) {
+	var query string
+	switch table {
+	case DEKTableSecretVersions:
+		query = `SELECT sv.id, sv.encrypted_dek, sv.dek_nonce, sv.master_key_version, sv.kek_version
+		 FROM secret_versions sv
+		 JOIN secrets s ON s.id = sv.secret_id
+		 WHERE s.project_id = $1 AND sv.kek_version <> $2 AND sv.format_version <> 3 AND sv.destroyed_at IS NULL AND sv.id > $3
+		 ORDER BY sv.id
+		 LIMIT $4`
+	case DEKTableLeases:
+		query = `SELECT id, encrypted_dek, dek_nonce, master_key_version, kek_version
+		 FROM leases
+		 WHERE project_id = $1 AND kek_version <> $2 AND id > $3
+		 ORDER BY id
+		 LIMIT $4`
+	case DEKTableChangeRequests:
+		query = `SELECT id, encrypted_dek, dek_nonce, master_key_version, kek_version
+		 FROM change_requests
+		 WHERE project_id = $1 AND kek_version <> $2 AND format_version <> 3 AND encrypted_dek IS NOT NULL AND id > $3
+		 ORDER BY id
+		 LIMIT $4`
+	default:
+		return nil, fmt.Errorf("unknown project DEK table %q", table)
+	}
+	if afterID == "" {
+		afterID = "00000000-0000-0000-0000-000000000000"
+	}
+
+	rows, err := db.Pool.Query(ctx, query, projectID, targetKEK, afterID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("listing project DEKs in %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	var deks []WrappedDEK
+	for rows.Next() {
+		var d WrappedDEK
+		if err := rows.Scan(&d.ID, &d.EncryptedDEK, &d.DEKNonce, &d.MasterKeyVersion, &d.KEKVersion); err != nil {
+			return nil, fmt.Errorf("scanning project DEK: %w", err)
+		}
+		deks = append(deks, d)
+	}
+	return deks, rows.Err()
+}
+
+// UpdateProjectDEK replaces a secret version's, lease's or change request's
+// wrapped DEK after project re-keying. The update only applies if the row is
+// still wrapped by oldKEK.
+func (db *DB) UpdateProjectDEK(ctx context.Context, table, id string, encryptedDEK, dekNonce []byte, masterKeyVersion, oldKEK, newKEK int) error {
+	if table != DEKTableSecretVersions && table != DEKTableLeases && table != DEKTableChangeRequests {
+		return fmt.Errorf("unknown project DEK table %q", table)
+	}
+	result, err := db.Pool.Exec(ctx,
+		`UPDATE `+table+` SET encrypted_dek = $2, dek_nonce = $3, master_key_version = $4, kek_version = $6
+		 WHERE id = $1 AND kek_version = $5`,
+		id, encryptedDEK, dekNonce, masterKeyVersion, oldKEK, newKEK,
+	)
+	if err != nil {
+		return fmt.Errorf("updating project DEK in %s: %w", table, err)
+	}
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("row %s changed during re-key", id)
+	}
+	return nil
+}
+
+// ShredResult reports what ShredProject destroyed.
+type ShredResult struct {
+	KeysDestroyed         int64 `json:"keys_destroyed"`
+	SecretsDeleted        int64 `json:"secrets_deleted"`
+	LegacyDEKsWiped       int64 `json:"legacy_deks_wiped"`
+	LeasesRevoked         int64 `json:"leases_revoked"`
+	WrappingTokensRevoked int64 `json:"wrapping_tokens_revoked"`
+}
+
+// ShredProject deletes a project and crypto-shreds its data in a single
+// transaction: every KEK version is destroyed, DEKs still wrapped directly by
+// the master key (rows written before project KEKs existed) are wiped,
+// secrets are soft-deleted, active leases are revoked, pending change
+// requests are cancelled and wiped, and unused wrapping tokens holding the
+// project's secrets (encrypted under the master key) are deleted. Ciphertext
+// rows are kept but can never be decrypted again.
+func (db *DB) ShredProject(ctx context.Context, projectID string) (*ShredResult, error) {
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("beginning transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	result, err := tx.Exec(ctx,
+		`UPDATE projects SET deleted_at = now() WHERE id = $1 AND deleted_at IS NULL`,
+		projectID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("deleting project: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return nil, fmt.Errorf("project not found")
+	}
+
+	res := &ShredResult{}
+	steps := []struct {
+		query string
+		count *int64
+	}{
+		{`UPDATE project_keys SET encrypted_kek = NULL, kek_nonce = NULL, destroyed_at = now()
+		  WHERE project_id = $1 AND destroyed_at IS NULL`, &res.KeysDestroyed},
+		{`UPDATE secret_versions SET encrypted_dek = ''::bytea, dek_nonce = ''::bytea, destroyed_at = now()
+		  WHERE kek_version = 0 AND destroyed_at IS NULL AND secret_id IN (SELECT id FROM secrets WHERE project_id = $1)`, &res.LegacyDEKsWiped},
+		{`UPDATE secrets SET deleted_at = now() WHERE project_id = $1 AND deleted_at IS NULL`, &res.SecretsDeleted},
+		{`UPDATE leases SET revoked_at = now() WHERE project_id = $1 AND revoked_at IS NULL`, &res.LeasesRevoked},
+		{`UPDATE leases SET encrypted_dek = ''::bytea, dek_nonce = ''::bytea
+		  WHERE project_id = $1 AND kek_version = 0`, nil},
+		{`UPDATE change_requests SET ciphertext = NULL, nonce = NULL, encrypted_dek = NULL, dek_nonce = NULL,
+		    status = CASE WHEN status = 'pending' THEN 'cancelled' ELSE status END, resolved_at = COALESCE(resolved_at, now())
+		  WHERE project_id = $1 AND ciphertext IS NOT NULL`, nil},
+		{`DELETE FROM project_member_keys WHERE project_id = $1`, nil},
+		{`DELETE FROM wrapping_tokens WHERE unwrapped_at IS NULL AND $1 = ANY(project_ids)`, &res.WrappingTokensRevoked},
+	}
+	for _, step := range steps {
+		tag, err := tx.Exec(ctx, step.query, projectID)
+		if err != nil {
+			return nil, fmt.Errorf("shredding project: %w", err)
+		}
+		if step.count != nil {
+			*step.count = tag.RowsAffected()
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("committing project shred: %w", err)
+	}
+	return res, nil
+}
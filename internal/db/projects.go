@@ -2,18 +2,31 @@ package db
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+
+	"github.com/jackc/pgx/v5"
 )
 
-// CreateProject inserts a new project.
-func (db *DB) CreateProject(ctx context.Context, name, description, createdBy string) (*Project, error) {
-	project := &Project{}
-	err := db.Pool.QueryRow(ctx,
-		`INSERT INTO projects (name, description, created_by)
-		 VALUES ($1, $2, $3)
-		 RETURNING id, name, description, created_by, created_at`,
-		name, description, createdBy,
-	).Scan(&project.ID, &project.Name, &project.Description, &project.CreatedBy, &project.CreatedAt)
+const projectColumns = `id, name, COALESCE(description, ''), encryption_mode, e2e_key_version, require_cas, max_versions, max_version_age_seconds, COALESCE(org_id::text, ''), environments, approval_rules, access_teams, created_by, created_at`
+
+func scanProject(row pgx.Row) (*Project, error) {
+	p := &Project{}
+	err := row.Scan(&p.ID, &p.Name, &p.Description, &p.EncryptionMode, &p.E2EKeyVersion,
+		&p.RequireCAS, &p.MaxVersions, &p.MaxVersionAgeSeconds, &p.OrgID, &p.Environments, &p.ApprovalRules, &p.AccessTeams, &p.CreatedBy, &p.CreatedAt)
+	return p, err
+}
+
+// CreateProject inserts a new project. encryptionMode is EncryptionModeServer
+// or EncryptionModeE2E and cannot be changed later.
+func (db *DB) CreateProject(ctx context.Context, name, description, encryptionMode, createdBy string) (*Project, error) {
+	project, err := scanProject(db.Pool.QueryRow(ctx,
+		`INSERT INTO projects (name, description, encryption_mode, created_by)
+		 VALUES ($1, $2, $3, $4)
+		 RETURNING `+projectColumns,
+		name, description, encryptionMode, createdBy,
+	))
 	if err != nil {
 		return nil, fmt.Errorf("creating project: %w", err)
 	}
@@ -23,8 +36,8 @@ func (db *DB) CreateProject(ctx context.Context, name, description, createdBy st
 // ListProjects returns all projects.
 func (db *DB) ListProjects(ctx context.Context) ([]Project, error) {
 	rows, err := db.Pool.Query(ctx,
-		`SELECT id, name, COALESCE(description, ''), created_by, created_at
-		 FROM projects ORDER BY created_at DESC`,
+		`SELECT `+projectColumns+`
+		 FROM projects WHERE deleted_at IS NULL ORDER BY created_at DESC`,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("listing projects: %w", err)
@@ -33,23 +46,22 @@ func (db *DB) ListProjects(ctx context.Context) ([]Project, error) {
 
 	var projects []Project
 	for rows.Next() {
-		var p Project
-		if err := rows.Scan(&p.ID, &p.Name, &p.Description, &p.CreatedBy, &p.CreatedAt); err != nil {
+		p, err := scanProject(rows)
+		if err != nil {
 			return nil, fmt.Errorf("scanning project: %w", err)
 		}
-		projects = append(projects, p)
+		projects = append(projects, *p)
 	}
 	return projects, rows.Err()
 }
 
 // GetProjectByName retrieves a project by name.
 func (db *DB) GetProjectByName(ctx context.Context, name string) (*Project, error) {
-	project := &Project{}
-	err := db.Pool.QueryRow(ctx,
-		`SELECT id, name, COALESCE(description, ''), created_by, created_at
-		 FROM projects WHERE name = $1`,
+	project, err := scanProject(db.Pool.QueryRow(ctx,
+		`SELECT `+projectColumns+`
+		 FROM projects WHERE name = $1 AND deleted_at IS NULL`,
 		name,
-	).Scan(&project.ID, &project.Name, &project.Description, &project.CreatedBy, &project.CreatedAt)
+	))
 	if err != nil {
 		return nil, fmt.Errorf("getting project by name: %w", err)
 	}
@@ -58,14 +70,61 @@ func (db *DB) GetProjectByName(ctx context.Context, name string) (*Project, erro
 
 // GetProjectByID retrieves a project by ID.
 func (db *DB) GetProjectByID(ctx context.Context, id string) (*Project, error) {
-	project := &Project{}
-	err := db.Pool.QueryRow(ctx,
-		`SELECT id, name, COALESCE(description, ''), created_by, created_at
-		 FROM projects WHERE id = $1`,
+	project, err := scanProject(db.Pool.QueryRow(ctx,
+		`SELECT `+projectColumns+`
+		 FROM projects WHERE id = $1 AND deleted_at IS NULL`,
 		id,
-	).Scan(&project.ID, &project.Name, &project.Description, &project.CreatedBy, &project.CreatedAt)
+	))
 	if err != nil {
 		return nil, fmt.Errorf("getting project by id: %w", err)
 	}
 	return project, nil
 }
+
+// ProjectSettings holds the mutable settings of a project. Nil fields are
+// left unchanged.
+type ProjectSettings struct {
+	RequireCAS           *bool
+	MaxVersions          *int
+	MaxVersionAgeSeconds *int64
+	OrgID                *string
+	Environments         []Environment  // replaces the environments if not nil
+	ApprovalRules        []ApprovalRule // replaces the approval rules if not nil
+	AccessTeams          []string       // replaces the access teams if not nil
+}
+
+// accessTeamsJSON encodes access teams for a JSONB parameter; nil stays NULL
+// so COALESCE keeps the current value.
+func accessTeamsJSON(teamIDs []string) interface{} {
+	if teamIDs == nil {
+		return nil
+	}
+	b, _ := json.Marshal(teamIDs)
+	return string(b)
+}
+
+// UpdateProjectSettings changes the settings of a project and returns the
+// updated project.
+func (db *DB) UpdateProjectSettings(ctx context.Context, id string, settings ProjectSettings) (*Project, error) {
+	project, err := scanProject(db.Pool.QueryRow(ctx,
+		`UPDATE projects
+		 SET require_cas = COALESCE($2, require_cas),
+		     max_versions = COALESCE($3, max_versions),
+		     max_version_age_seconds = COALESCE($4, max_version_age_seconds),
+		     org_id = COALESCE($5::uuid, org_id),
+		     environments = COALESCE($6::jsonb, environments),
+		     approval_rules = COALESCE($7::jsonb, approval_rules),
+		     access_teams = COALESCE($8::jsonb, access_teams)
+		 WHERE id = $1 AND deleted_at IS NULL
+		 RETURNING `+projectColumns,
+		id, settings.RequireCAS, settings.MaxVersions, settings.MaxVersionAgeSeconds, settings.OrgID,
+		environmentsJSON(settings.Environments), approvalRulesJSON(settings.ApprovalRules), accessTeamsJSON(settings.AccessTeams),
+	))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("project not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("updating project: %w", err)
+	}
+	return project, nil
+}
@@ -0,0 +1,266 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// PurgedSecret is a soft-deleted secret removed by PurgeDeletedSecrets.
+type PurgedSecret struct {
+	ID          string
+	ProjectID   string
+	ProjectName string
+	Path        string
+	DeletedAt   time.Time
+	Versions    int64
+}
+
+// ListDeletedSecrets lists the soft-deleted secrets of a project, most
+// recently deleted first.
+func (db *DB) ListDeletedSecrets(ctx context.Context, projectID string) ([]Secret, error) {
+	rows, err := db.Pool.Query(ctx,
+		`SELECT `+secretColumns+`
+		 FROM secrets WHERE project_id = $1 AND deleted_at IS NOT NULL
+		 ORDER BY deleted_at DESC`,
+		projectID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("listing deleted secrets: %w", err)
+	}
+	defer rows.Close()
+
+	var secrets []Secret
+	for rows.Next() {
+		s, err := scanSecret(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scanning secret: %w", err)
+		}
+		secrets = append(secrets, *s)
+	}
+	return secrets, rows.Err()
+}
+
+// UndeleteSecret restores a soft-deleted secret with its version history.
+func (db *DB) UndeleteSecret(ctx context.Context, projectID, path string) (*Secret, error) {
+	secret, err := scanSecret(db.Pool.QueryRow(ctx,
+		`UPDATE secrets SET deleted_at = NULL
+		 WHERE project_id = $1 AND path = $2 AND deleted_at IS NOT NULL
+		 RETURNING `+secretColumns,
+		projectID, path,
+	))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("deleted secret not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("undeleting secret: %w", err)
+	}
+	return secret, nil
+}
+
+// DestroySecretVersions wipes the ciphertext and wrapped DEK of the given
+// versions. The rows remain, marked destroyed, so version numbers are never
+// reused. It returns how many versions were destroyed; versions already
+// destroyed or that do not exist are skipped.
+func (db *DB) DestroySecretVersions(ctx context.Context, secretID string, versions []int) (int64, error) {
+	result, err := db.Pool.Exec(ctx,
+		`UPDATE secret_versions
+		 SET ciphertext = ''::bytea, nonce = ''::bytea, encrypted_dek = ''::bytea, dek_nonce = ''::bytea, destroyed_at = now()
+		 WHERE secret_id = $1 AND version = ANY($2::int[]) AND destroyed_at IS NULL`,
+		secretID, versions,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("destroying secret versions: %w", err)
+	}
+	return result.RowsAffected(), nil
+}
+
+// PurgeDeletedSecrets permanently removes up to limit secrets soft-deleted
+// before cutoff, with all their versions and rotation schedules.
+func (db *DB) PurgeDeletedSecrets(ctx context.Context, cutoff time.Time, limit int) ([]PurgedSecret, error) {
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("beginning transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx,
+		`SELECT s.id, s.project_id, p.name, s.path, s.deleted_at
+		 FROM secrets s
+		 JOIN projects p ON p.id = s.project_id
+		 WHERE s.deleted_at IS NOT NULL AND s.deleted_at < $1
+		 ORDER BY s.deleted_at
+		 LIMIT $2
+		 FOR UPDATE OF s SKIP LOCKED`,
+		cutoff, limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("listing expired deleted secrets: %w", err)
+	}
+	var purged []PurgedSecret
+	for rows.Next() {
+		var p PurgedSecret
+		if err := rows.Scan(&p.ID, &p.ProjectID, &p.ProjectName, &p.Path, &p.DeletedAt); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("scanning deleted secret: %w", err)
+		}
+		purged = append(purged, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("listing expired deleted secrets: %w", err)
+	}
+
+	for i := range purged {
+		id := purged[i].ID
+		result, err := tx.Exec(ctx, `DELETE FROM secret_versions WHERE secret_id = $1`, id)
+		if err != nil {
+			return nil, fmt.Errorf("purging secret versions: %w", err)
+		}
+		purged[i].Versions = result.RowsAffected()
+		if _, err := tx.Exec(ctx, `DELETE FROM rotation_schedules WHERE secret_id = $1`, id); err != nil {
+			return nil, fmt.Errorf("purging rotation schedule: %w", err)
+		}
+		if _, err := tx.Exec(ctx, `DELETE FROM secrets WHERE id = $1`, id); err != nil {
+			return nil, fmt.Errorf("purging secret: %w", err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("committing purge: %w", err)
+	}
+	return purged, nil
+}
+
+// VersionLimits bounds how many versions of a secret are kept and for how
+// long. Zero values mean unlimited. The latest version is always kept.
+type VersionLimits struct {
+	MaxVersions int
+	MaxAge      time.Duration
+}
+
+// IsZero reports whether the limits keep every version.
+func (l VersionLimits) IsZero() bool {
+	return l.MaxVersions <= 0 && l.MaxAge <= 0
+}
+
+// VersionLimits returns the limits in effect for the secret: its own
+// settings where set, otherwise those of its project.
+func (s *Secret) VersionLimits(p *Project) VersionLimits {
+	limits := VersionLimits{
+		MaxVersions: p.MaxVersions,
+		MaxAge:      time.Duration(p.MaxVersionAgeSeconds) * time.Second,
+	}
+	if s.MaxVersions != nil {
+		limits.MaxVersions = *s.MaxVersions
+	}
+	if s.MaxVersionAgeSeconds != nil {
+		limits.MaxAge = time.Duration(*s.MaxVersionAgeSeconds) * time.Second
+	}
+	return limits
+}
+
+// PrunableSecret is a secret with version limits in effect.
+type PrunableSecret struct {
+	ID          string
+	ProjectName string
+	Path        string
+	Limits      VersionLimits
+}
+
+// SetSecretVersionLimits sets a secret's own version limits. A nil value
+// makes the secret inherit the project setting.
+func (db *DB) SetSecretVersionLimits(ctx context.Context, secretID string, maxVersions *int, maxVersionAgeSeconds *int64) error {
+	_, err := db.Pool.Exec(ctx,
+		`UPDATE secrets SET max_versions = $2, max_version_age_seconds = $3 WHERE id = $1`,
+		secretID, maxVersions, maxVersionAgeSeconds,
+	)
+	if err != nil {
+		return fmt.Errorf("updating secret version limits: %w", err)
+	}
+	return nil
+}
+
+// ListPrunableSecrets returns up to limit active secrets with an id greater
+// than afterID (keyset pagination) whose effective version limits are not
+// unlimited.
+func (db *DB) ListPrunableSecrets(ctx context.Context, afterID string, limit int) ([]PrunableSecret, error) {
+	if afterID == "" {
+		afterID = "00000000-0000-0000-0000-000000000000"
+	}
+	rows, err := db.Pool.Query(ctx,
+		`SELECT s.id, p.name, s.path,
+		        COALESCE(s.max_versions, p.max_versions),
+		        COALESCE(s.max_version_age_seconds, p.max_version_age_seconds)
+		 FROM secrets s
+		 JOIN projects p ON p.id = s.project_id
+		 WHERE s.deleted_at IS NULL AND p.deleted_at IS NULL AND s.id > $1
+		   AND (COALESCE(s.max_versions, p.max_versions) > 0
+		        OR COALESCE(s.max_version_age_seconds, p.max_version_age_seconds) > 0)
+		 ORDER BY s.id
+		 LIMIT $2`,
+		afterID, limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("listing prunable secrets: %w", err)
+	}
+	defer rows.Close()
+
+	var secrets []PrunableSecret
+	for rows.Next() {
+		var ps PrunableSecret
+		var maxAgeSeconds int64
+		if err := rows.Scan(&ps.ID, &ps.ProjectName, &ps.Path, &ps.Limits.MaxVersions, &maxAgeSeconds); err != nil {
+			return nil, fmt.Errorf("scanning prunable secret: %w", err)
+		}
+		ps.Limits.MaxAge = time.Duration(maxAgeSeconds) * time.Second
+		secrets = append(secrets, ps)
+	}
+	return secrets, rows.Err()
+}
+
+// PruneSecretVersions destroys the versions of a secret that fall outside
+// limits: all but the newest MaxVersions version numbers, and those created
+// more than MaxAge ago. The latest version is never destroyed. Destroyed
+// versions are wiped as in DestroySecretVersions. It returns the versions
+// destroyed, in ascending order.
+func (db *DB) PruneSecretVersions(ctx context.Context, secretID string, limits VersionLimits) ([]int, error) {
+	if limits.IsZero() {
+		return nil, nil
+	}
+	rows, err := db.Pool.Query(ctx,
+		`WITH latest AS (
+		     SELECT MAX(version) AS version FROM secret_versions WHERE secret_id = $1
+		 )
+		 UPDATE secret_versions sv
+		 SET ciphertext = ''::bytea, nonce = ''::bytea, encrypted_dek = ''::bytea, dek_nonce = ''::bytea, destroyed_at = now()
+		 FROM latest
+		 WHERE sv.secret_id = $1 AND sv.destroyed_at IS NULL AND sv.version < latest.version
+		   AND (($2::int > 0 AND sv.version <= latest.version - $2::int)
+		        OR ($3::bigint > 0 AND sv.created_at < now() - $3::bigint * interval '1 second'))
+		 RETURNING sv.version`,
+		secretID, limits.MaxVersions, int64(limits.MaxAge/time.Second),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("pruning secret versions: %w", err)
+	}
+	defer rows.Close()
+
+	var versions []int
+	for rows.Next() {
+		var v int
+		if err := rows.Scan(&v); err != nil {
+			return nil, fmt.Errorf("scanning pruned version: %w", err)
+		}
+		versions = append(versions, v)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("pruning secret versions: %w", err)
+	}
+	sort.Ints(versions)
+	return versions, nil
+}
@@ -0,0 +1,131 @@
+package db
+
+import (
+	"context"
+	"fmt"
+)
+
+// WrappedDEK is the wrapped DEK of a single secret version, lease, transit key
+// version, wrapping token, change request or project KEK row, as needed by
+// the re-wrap jobs. Ciphertexts are never loaded.
+type WrappedDEK struct {
+	ID               string
+	EncryptedDEK     []byte
+	DEKNonce         []byte
+	MasterKeyVersion int
+	KEKVersion       int
+}
+
+// Tables whose DEKs (or, for project_keys, KEKs) are wrapped by the master key.
+const (
+	DEKTableSecretVersions     = "secret_versions"
+	DEKTableLeases             = "leases"
+	DEKTableTransitKeyVersions = "transit_key_versions"
+	DEKTableProjectKeys        = "project_keys"
+	DEKTableWrappingTokens     = "wrapping_tokens"
+	DEKTableChangeRequests     = "change_requests"
+)
+
+// dekTable describes where a table keeps its master-key-wrapped key and
+// which rows are wrapped by the master key at all.
+type dekTable struct {
+	keyCol   string
+	nonceCol string
+	filter   string
+}
+
+var dekTables = map[string]dekTable{
+	// DEKs wrapped by a project KEK are re-wrapped by project re-keying;
+	// format 3 (end-to-end encrypted) rows have no server-side DEK.
+	DEKTableSecretVersions:     {"encrypted_dek", "dek_nonce", "kek_version = 0 AND format_version <> 3 AND destroyed_at IS NULL"},
+	DEKTableLeases:             {"encrypted_dek", "dek_nonce", "kek_version = 0"},
+	DEKTableTransitKeyVersions: {"encrypted_dek", "dek_nonce", "true"},
+	DEKTableProjectKeys:        {"encrypted_kek", "kek_nonce", "destroyed_at IS NULL"},
+	// Used wrapping tokens have had their ciphertext wiped
+	DEKTableWrappingTokens: {"encrypted_dek", "dek_nonce", "encrypted_dek IS NOT NULL"},
+	// Resolved change requests have had their ciphertext wiped
+	DEKTableChangeRequests: {"encrypted_dek", "dek_nonce", "encrypted_dek IS NOT NULL AND kek_version = 0 AND format_version <> 3"},
+}
+
+// CountStaleDEKs returns how many rows in a DEK table are wrapped by a master
+// key version other than currentVersion.
+func (db *DB) CountStaleDEKs(ctx context.Context, table string, currentVersion int) (int64, error) {
+	t, err := lookupDEKTable(table)
+	if err != nil {
+		return 0, err
+	}
+	var count int64
+	err = db.Pool.QueryRow(ctx,
+		`SELECT COUNT(*) FROM `+table+` WHERE master_key_version <> $1 AND `+t.filter,
+		currentVersion,
+	).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("counting stale DEKs in %s: %w", table, err)
+	}
+	return count, nil
+}
+
+// ListStaleDEKs returns up to limit rows wrapped by a master key version other
+// than currentVersion, ordered by ID and starting after afterID (keyset
+// pagination, so rows that fail to re-wrap are not returned again).
+func (db *DB) ListStaleDEKs(ctx context.Context, table string, currentVersion int, afterID string, limit int) ([]WrappedDEK, error) {
+	t, err := lookupDEKTable(table)
+	if err != nil {
+		return nil, err
+	}
+	if afterID == "" {
+		afterID = "00000000-0000-0000-0000-000000000000"
+	}
+	rows, err := db.Pool.Query(ctx,
+		`SELECT id, `+t.keyCol+`, `+t.nonceCol+`, master_key_version
+		 FROM `+table+`
+		 WHERE master_key_version <> $1 AND id > $2 AND `+t.filter+`
+		 ORDER BY id
+		 LIMIT $3`,
+		currentVersion, afterID, limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("listing stale DEKs in %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	var deks []WrappedDEK
+	for rows.Next() {
+		var d WrappedDEK
+		if err := rows.Scan(&d.ID, &d.EncryptedDEK, &d.DEKNonce, &d.MasterKeyVersion); err != nil {
+			return nil, fmt.Errorf("scanning wrapped DEK: %w", err)
+		}
+		deks = append(deks, d)
+	}
+	return deks, rows.Err()
+}
+
+// UpdateWrappedDEK replaces a row's wrapped DEK. The update only applies if the
+// row is still wrapped by oldVersion, so a concurrent re-wrap cannot be undone.
+func (db *DB) UpdateWrappedDEK(ctx context.Context, table, id string, encryptedDEK, dekNonce []byte, oldVersion, newVersion int) error {
+	t, err := lookupDEKTable(table)
+	if err != nil {
+		return err
+	}
+	result, err := db.Pool.Exec(ctx,
+		`UPDATE `+table+` SET `+t.keyCol+` = $2, `+t.nonceCol+` = $3, master_key_version = $5
+		 WHERE id = $1 AND master_key_version = $4 AND `+t.filter,
+		id, encryptedDEK, dekNonce, oldVersion, newVersion,
+	)
+	if err != nil {
+		return fmt.Errorf("updating wrapped DEK in %s: %w", table, err)
+	}
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("row %s changed during re-wrap", id)
+	}
+	return nil
+}
+
+// lookupDEKTable guards the table name interpolated into re-wrap queries.
+func lookupDEKTable(table string) (dekTable, error) {
+	t, ok := dekTables[table]
+	if !ok {
+		return dekTable{}, fmt.Errorf("unknown DEK table %q", table)
+	}
+	return t, nil
+}
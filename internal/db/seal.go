@@ -0,0 +1,51 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// GetSealConfig returns the seal configuration, or nil if the vault has not
+// been initialized.
+func (db *DB) GetSealConfig(ctx context.Context) (*SealConfig, error) {
+	var c SealConfig
+	err := db.Pool.QueryRow(ctx,
+		`SELECT secret_shares, secret_threshold, encrypted_keyring, keyring_nonce, initialized_by, created_at
+		 FROM seal_config WHERE id = true`,
+	).Scan(&c.SecretShares, &c.SecretThreshold, &c.EncryptedKeyring, &c.KeyringNonce, &c.InitializedBy, &c.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("getting seal config: %w", err)
+	}
+	return &c, nil
+}
+
+// CreateSealConfig stores the seal configuration. It fails if the vault has
+// already been initialized.
+func (db *DB) CreateSealConfig(ctx context.Context, shares, threshold int, encryptedKeyring, keyringNonce []byte, initializedBy string) (*SealConfig, error) {
+	var by *string
+	if initializedBy != "" {
+		by = &initializedBy
+	}
+
+	c := &SealConfig{}
+	err := db.Pool.QueryRow(ctx,
+		`INSERT INTO seal_config (secret_shares, secret_threshold, encrypted_keyring, keyring_nonce, initialized_by)
+		 VALUES ($1, $2, $3, $4, $5)
+		 ON CONFLICT (id) DO NOTHING
+		 RETURNING secret_shares, secret_threshold, encrypted_keyring, keyring_nonce, initialized_by, created_at`,
+		shares, threshold, encryptedKeyring, keyringNonce, by,
+	).Scan(&c.SecretShares, &c.SecretThreshold, &c.EncryptedKeyring, &c.KeyringNonce, &c.InitializedBy, &c.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("vault already initialized")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("creating seal config: %w", err)
+	}
+	return c, nil
+}
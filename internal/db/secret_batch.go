@@ -0,0 +1,188 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// SecretWithVersion is a secret together with one of its versions.
+type SecretWithVersion struct {
+	Secret  *Secret
+	Version *SecretVersion
+}
+
+// GetLatestSecretVersions reads the active secrets at paths in a project with
+// their latest versions, from a single consistent snapshot. Paths that do not
+// exist, or have no versions, are missing from the result.
+func (db *DB) GetLatestSecretVersions(ctx context.Context, projectID string, paths []string) (map[string]SecretWithVersion, error) {
+	tx, err := db.Pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return nil, fmt.Errorf("beginning transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx,
+		`SELECT `+secretColumns+`
+		 FROM secrets WHERE project_id = $1 AND path = ANY($2::text[]) AND deleted_at IS NULL`,
+		projectID, paths,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("getting secrets: %w", err)
+	}
+	byID := make(map[string]*Secret)
+	var ids []string
+	for rows.Next() {
+		s, err := scanSecret(rows)
+		if err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("scanning secret: %w", err)
+		}
+		byID[s.ID] = s
+		ids = append(ids, s.ID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("getting secrets: %w", err)
+	}
+
+	rows, err = tx.Query(ctx,
+		`SELECT DISTINCT ON (secret_id) `+secretVersionColumns+`
+		 FROM secret_versions WHERE secret_id = ANY($1::uuid[])
+		 ORDER BY secret_id, version DESC`,
+		ids,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("getting latest secret versions: %w", err)
+	}
+	defer rows.Close()
+
+	result := make(map[string]SecretWithVersion, len(ids))
+	for rows.Next() {
+		sv, err := scanSecretVersion(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scanning secret version: %w", err)
+		}
+		secret := byID[sv.SecretID]
+		result[secret.Path] = SecretWithVersion{Secret: secret, Version: sv}
+	}
+	return result, rows.Err()
+}
+
+// SecretWrite is one write of a WriteSecretVersions batch.
+type SecretWrite struct {
+	Path        string
+	Description string
+	SecretType  string
+	Metadata    json.RawMessage   // replaces the secret's metadata if not nil
+	Labels      map[string]string // replaces the secret's labels if not nil
+	CAS         *int              // the version this write replaces (0 = must not exist); nil = unconditional
+	// Encrypt returns the ciphertext fields of the new version, bound to the
+	// secret and version number it is stored as.
+	Encrypt func(secret *Secret, version int) (*SecretVersion, error)
+}
+
+// WriteSecretVersions writes a new version of each secret in one transaction:
+// either every write is committed or none is. Missing secrets are created;
+// soft-deleted ones fail the batch, as only UndeleteSecret restores them.
+// Each secret row is locked until commit, so CAS checks cannot race with
+// other batches. Results are in the order of writes.
+func (db *DB) WriteSecretVersions(ctx context.Context, projectID, createdBy string, writes []SecretWrite) ([]SecretWithVersion, error) {
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("beginning transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// Lock secrets in path order so concurrent batches cannot deadlock
+	order := make([]int, len(writes))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(a, b int) bool { return writes[order[a]].Path < writes[order[b]].Path })
+
+	results := make([]SecretWithVersion, len(writes))
+	for _, i := range order {
+		w := writes[i]
+		if w.SecretType == "" {
+			w.SecretType = "kv"
+		}
+
+		secret, err := scanSecret(tx.QueryRow(ctx,
+			`SELECT `+secretColumns+`
+			 FROM secrets WHERE project_id = $1 AND path = $2
+			 FOR UPDATE`,
+			projectID, w.Path,
+		))
+		exists := err == nil
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			secret, err = scanSecret(tx.QueryRow(ctx,
+				`INSERT INTO secrets (project_id, path, description, secret_type, metadata, labels, created_by)
+				 VALUES ($1, $2, $3, $4, $5, COALESCE($6::jsonb, '{}'::jsonb), $7)
+				 RETURNING `+secretColumns,
+				projectID, w.Path, w.Description, w.SecretType, w.Metadata, labelsJSON(w.Labels), createdBy,
+			))
+			if err != nil {
+				return nil, fmt.Errorf("creating secret %s: %w", w.Path, err)
+			}
+		case err != nil:
+			return nil, fmt.Errorf("getting secret %s: %w", w.Path, err)
+		case secret.DeletedAt != nil:
+			return nil, fmt.Errorf("secret %s is deleted; undelete it first", w.Path)
+		case w.SecretType != secret.SecretType || w.Metadata != nil || w.Labels != nil:
+			metadata := w.Metadata
+			if metadata == nil && w.SecretType == secret.SecretType {
+				metadata = secret.Metadata
+			}
+			secret, err = scanSecret(tx.QueryRow(ctx,
+				`UPDATE secrets
+				 SET secret_type = $2, metadata = $3,
+				     description = COALESCE(NULLIF($4, ''), description),
+				     labels = COALESCE($5::jsonb, labels)
+				 WHERE id = $1
+				 RETURNING `+secretColumns,
+				secret.ID, w.SecretType, metadata, w.Description, labelsJSON(w.Labels),
+			))
+			if err != nil {
+				return nil, fmt.Errorf("updating secret %s: %w", w.Path, err)
+			}
+		}
+
+		var latest int
+		if err := tx.QueryRow(ctx,
+			`SELECT COALESCE(MAX(version), 0) FROM secret_versions WHERE secret_id = $1`,
+			secret.ID,
+		).Scan(&latest); err != nil {
+			return nil, fmt.Errorf("getting max version of %s: %w", w.Path, err)
+		}
+		if w.CAS != nil && ((!exists && *w.CAS != 0) || (exists && *w.CAS != latest)) {
+			return nil, fmt.Errorf("version mismatch for %s: latest version is %d", w.Path, latest)
+		}
+
+		encrypted, err := w.Encrypt(secret, latest+1)
+		if err != nil {
+			return nil, fmt.Errorf("encrypting %s: %w", w.Path, err)
+		}
+		sv, err := scanSecretVersion(tx.QueryRow(ctx,
+			`INSERT INTO secret_versions (secret_id, version, ciphertext, nonce, encrypted_dek, dek_nonce, master_key_version, kek_version, format_version, created_by)
+			 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+			 RETURNING `+secretVersionColumns,
+			secret.ID, latest+1, encrypted.Ciphertext, encrypted.Nonce, encrypted.EncryptedDEK, encrypted.DEKNonce,
+			encrypted.MasterKeyVersion, encrypted.KEKVersion, encrypted.FormatVersion, createdBy,
+		))
+		if err != nil {
+			return nil, fmt.Errorf("creating secret version of %s: %w", w.Path, err)
+		}
+		results[i] = SecretWithVersion{Secret: secret, Version: sv}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("committing secret writes: %w", err)
+	}
+	return results, nil
+}
@@ -0,0 +1,226 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// SecretAlias redirects reads of the path a secret was moved from to the
+// secret, until it expires.
+type SecretAlias struct {
+	ProjectID string
+	Path      string
+	SecretID  string
+	ExpiresAt time.Time
+}
+
+// SecretTransfer moves or copies a secret with its full version history.
+type SecretTransfer struct {
+	SecretID  string // the secret to move or copy
+	ProjectID string // destination project
+	Path      string // destination path
+	CreatedBy string // owner of a copy; a moved secret keeps its owner
+	// AliasUntil, for a move, keeps the old path readable until then
+	AliasUntil *time.Time
+	// Encrypt returns the ciphertext fields of version sv of the source,
+	// bound to the destination secret. It is not called for destroyed
+	// versions, which stay wiped.
+	Encrypt func(secret *Secret, sv *SecretVersion) (*SecretVersion, error)
+}
+
+// MoveSecret moves a secret with every version to another path, in the same
+// or another project, in one transaction. The secret gets a new ID, so
+// ciphertext and in-flight writes stay bound to where they were made; its
+// rotation schedule and any aliases pointing at it move along.
+func (db *DB) MoveSecret(ctx context.Context, t SecretTransfer) (*Secret, int, error) {
+	return db.transferSecret(ctx, t, true)
+}
+
+// CopySecret copies a secret with every version, and its rotation schedule,
+// to another path in the same or another project, in one transaction.
+func (db *DB) CopySecret(ctx context.Context, t SecretTransfer) (*Secret, int, error) {
+	return db.transferSecret(ctx, t, false)
+}
+
+// transferSecret copies a secret and, if move is set, removes the source. It
+// returns the new secret and how many versions it has.
+func (db *DB) transferSecret(ctx context.Context, t SecretTransfer, move bool) (*Secret, int, error) {
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return nil, 0, fmt.Errorf("beginning transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	src, err := scanSecret(tx.QueryRow(ctx,
+		`SELECT `+secretColumns+`
+		 FROM secrets WHERE id = $1 AND deleted_at IS NULL
+		 FOR UPDATE`,
+		t.SecretID,
+	))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, 0, fmt.Errorf("secret not found")
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("getting secret: %w", err)
+	}
+
+	var deletedAt *time.Time
+	err = tx.QueryRow(ctx,
+		`SELECT deleted_at FROM secrets WHERE project_id = $1 AND path = $2`,
+		t.ProjectID, t.Path,
+	).Scan(&deletedAt)
+	switch {
+	case err == nil && deletedAt == nil:
+		return nil, 0, fmt.Errorf("destination %s already exists", t.Path)
+	case err == nil:
+		return nil, 0, fmt.Errorf("destination %s already exists as a deleted secret; purge or undelete it first", t.Path)
+	case !errors.Is(err, pgx.ErrNoRows):
+		return nil, 0, fmt.Errorf("checking destination: %w", err)
+	}
+
+	createdBy, createdAt := t.CreatedBy, time.Now()
+	if move {
+		createdBy, createdAt = src.CreatedBy, src.CreatedAt
+	}
+	dst, err := scanSecret(tx.QueryRow(ctx,
+		`INSERT INTO secrets (project_id, path, description, secret_type, metadata, labels,
+		                      max_versions, max_version_age_seconds, created_by, created_at)
+		 VALUES ($1, $2, $3, $4, $5, COALESCE($6::jsonb, '{}'::jsonb), $7, $8, $9, $10)
+		 RETURNING `+secretColumns,
+		t.ProjectID, t.Path, src.Description, src.SecretType, src.Metadata, labelsJSON(src.Labels),
+		src.MaxVersions, src.MaxVersionAgeSeconds, createdBy, createdAt,
+	))
+	if err != nil {
+		return nil, 0, fmt.Errorf("creating secret: %w", err)
+	}
+
+	rows, err := tx.Query(ctx,
+		`SELECT `+secretVersionColumns+`
+		 FROM secret_versions WHERE secret_id = $1
+		 ORDER BY version`,
+		src.ID,
+	)
+	if err != nil {
+		return nil, 0, fmt.Errorf("listing secret versions: %w", err)
+	}
+	var versions []*SecretVersion
+	for rows.Next() {
+		sv, err := scanSecretVersion(rows)
+		if err != nil {
+			rows.Close()
+			return nil, 0, fmt.Errorf("scanning secret version: %w", err)
+		}
+		versions = append(versions, sv)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("listing secret versions: %w", err)
+	}
+
+	for _, sv := range versions {
+		encrypted := sv
+		if sv.DestroyedAt == nil {
+			if encrypted, err = t.Encrypt(dst, sv); err != nil {
+				return nil, 0, fmt.Errorf("encrypting version %d: %w", sv.Version, err)
+			}
+		}
+		if _, err := tx.Exec(ctx,
+			`INSERT INTO secret_versions (secret_id, version, ciphertext, nonce, encrypted_dek, dek_nonce,
+			                              master_key_version, kek_version, format_version, created_by, created_at, destroyed_at)
+			 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`,
+			dst.ID, sv.Version, encrypted.Ciphertext, encrypted.Nonce, encrypted.EncryptedDEK, encrypted.DEKNonce,
+			encrypted.MasterKeyVersion, encrypted.KEKVersion, encrypted.FormatVersion, sv.CreatedBy, sv.CreatedAt, sv.DestroyedAt,
+		); err != nil {
+			return nil, 0, fmt.Errorf("copying version %d: %w", sv.Version, err)
+		}
+	}
+
+	// The new secret takes over the destination path from any alias there
+	if _, err := tx.Exec(ctx,
+		`DELETE FROM secret_aliases WHERE project_id = $1 AND path = $2`,
+		t.ProjectID, t.Path,
+	); err != nil {
+		return nil, 0, fmt.Errorf("removing alias at destination: %w", err)
+	}
+
+	if !move {
+		if _, err := tx.Exec(ctx,
+			`INSERT INTO rotation_schedules (secret_id, cron_expression, connector_type, connector_config, next_rotation_at, status)
+			 SELECT $2, cron_expression, connector_type, connector_config, next_rotation_at, status
+			 FROM rotation_schedules WHERE secret_id = $1`,
+			src.ID, dst.ID,
+		); err != nil {
+			return nil, 0, fmt.Errorf("copying rotation schedule: %w", err)
+		}
+		if err := tx.Commit(ctx); err != nil {
+			return nil, 0, fmt.Errorf("committing secret copy: %w", err)
+		}
+		return dst, len(versions), nil
+	}
+
+	if _, err := tx.Exec(ctx,
+		`UPDATE rotation_schedules SET secret_id = $2, updated_at = now() WHERE secret_id = $1`,
+		src.ID, dst.ID,
+	); err != nil {
+		return nil, 0, fmt.Errorf("moving rotation schedule: %w", err)
+	}
+	if _, err := tx.Exec(ctx,
+		`UPDATE secret_aliases SET secret_id = $2 WHERE secret_id = $1`,
+		src.ID, dst.ID,
+	); err != nil {
+		return nil, 0, fmt.Errorf("moving aliases: %w", err)
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM secret_versions WHERE secret_id = $1`, src.ID); err != nil {
+		return nil, 0, fmt.Errorf("removing source versions: %w", err)
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM secrets WHERE id = $1`, src.ID); err != nil {
+		return nil, 0, fmt.Errorf("removing source secret: %w", err)
+	}
+	if t.AliasUntil != nil {
+		if _, err := tx.Exec(ctx,
+			`INSERT INTO secret_aliases (project_id, path, secret_id, expires_at)
+			 VALUES ($1, $2, $3, $4)
+			 ON CONFLICT (project_id, path) DO UPDATE
+			 SET secret_id = EXCLUDED.secret_id, expires_at = EXCLUDED.expires_at, created_at = now()`,
+			src.ProjectID, src.Path, dst.ID, *t.AliasUntil,
+		); err != nil {
+			return nil, 0, fmt.Errorf("creating alias: %w", err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, 0, fmt.Errorf("committing secret move: %w", err)
+	}
+	return dst, len(versions), nil
+}
+
+// GetSecretAlias returns the alias at a path of a project, if it has not
+// expired and no secret has been created at the path since.
+func (db *DB) GetSecretAlias(ctx context.Context, projectID, path string) (*SecretAlias, error) {
+	a := &SecretAlias{}
+	err := db.Pool.QueryRow(ctx,
+		`SELECT a.project_id, a.path, a.secret_id, a.expires_at
+		 FROM secret_aliases a
+		 WHERE a.project_id = $1 AND a.path = $2 AND a.expires_at > now()
+		   AND NOT EXISTS (SELECT 1 FROM secrets s WHERE s.project_id = a.project_id AND s.path = a.path)`,
+		projectID, path,
+	).Scan(&a.ProjectID, &a.Path, &a.SecretID, &a.ExpiresAt)
+	if err != nil {
+		return nil, fmt.Errorf("getting secret alias: %w", err)
+	}
+	return a, nil
+}
+
+// DeleteExpiredSecretAliases removes aliases past their expiry and returns
+// how many were removed.
+func (db *DB) DeleteExpiredSecretAliases(ctx context.Context) (int64, error) {
+	result, err := db.Pool.Exec(ctx, `DELETE FROM secret_aliases WHERE expires_at <= now()`)
+	if err != nil {
+		return 0, fmt.Errorf("deleting expired secret aliases: %w", err)
+	}
+	return result.RowsAffected(), nil
+}
@@ -3,27 +3,53 @@ package db
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+
+	"github.com/jackc/pgx/v5"
 )
 
+const secretColumns = `id, project_id, path, COALESCE(description, ''), COALESCE(secret_type, 'kv'), metadata, labels, max_versions, max_version_age_seconds, created_by, created_at, deleted_at`
+
+func scanSecret(row pgx.Row) (*Secret, error) {
+	s := &Secret{}
+	err := row.Scan(secretFields(s)...)
+	return s, err
+}
+
+// secretFields returns the scan destinations for secretColumns.
+func secretFields(s *Secret) []interface{} {
+	return []interface{}{&s.ID, &s.ProjectID, &s.Path, &s.Description, &s.SecretType, &s.Metadata, &s.Labels,
+		&s.MaxVersions, &s.MaxVersionAgeSeconds, &s.CreatedBy, &s.CreatedAt, &s.DeletedAt}
+}
+
+const secretVersionColumns = `id, secret_id, version, ciphertext, nonce, encrypted_dek, dek_nonce, master_key_version, kek_version, format_version, created_by, created_at, destroyed_at`
+
+func scanSecretVersion(row pgx.Row) (*SecretVersion, error) {
+	sv := &SecretVersion{}
+	err := row.Scan(&sv.ID, &sv.SecretID, &sv.Version, &sv.Ciphertext, &sv.Nonce,
+		&sv.EncryptedDEK, &sv.DEKNonce, &sv.MasterKeyVersion, &sv.KEKVersion, &sv.FormatVersion,
+		&sv.CreatedBy, &sv.CreatedAt, &sv.DestroyedAt)
+	return sv, err
+}
+
 // CreateSecret creates a new secret entry (metadata only).
 func (db *DB) CreateSecret(ctx context.Context, projectID, path, description, createdBy string) (*Secret, error) {
 	return db.CreateSecretWithType(ctx, projectID, path, description, "kv", nil, createdBy)
 }
 
-// CreateSecretWithType creates a new secret entry with a specific type and metadata.
+// CreateSecretWithType creates a new secret entry with a specific type and
+// metadata.
 func (db *DB) CreateSecretWithType(ctx context.Context, projectID, path, description, secretType string, metadata json.RawMessage, createdBy string) (*Secret, error) {
 	if secretType == "" {
 		secretType = "kv"
 	}
-	secret := &Secret{}
-	err := db.Pool.QueryRow(ctx,
+	secret, err := scanSecret(db.Pool.QueryRow(ctx,
 		`INSERT INTO secrets (project_id, path, description, secret_type, metadata, created_by)
 		 VALUES ($1, $2, $3, $4, $5, $6)
-		 RETURNING id, project_id, path, COALESCE(description, ''), secret_type, metadata, created_by, created_at, deleted_at`,
+		 RETURNING `+secretColumns,
 		projectID, path, description, secretType, metadata, createdBy,
-	).Scan(&secret.ID, &secret.ProjectID, &secret.Path, &secret.Description,
-		&secret.SecretType, &secret.Metadata, &secret.CreatedBy, &secret.CreatedAt, &secret.DeletedAt)
+	))
 	if err != nil {
 		return nil, fmt.Errorf("creating secret: %w", err)
 	}
@@ -44,13 +70,11 @@ func (db *DB) UpdateSecretType(ctx context.Context, secretID, secretType string,
 
 // GetSecret retrieves a secret by project ID and path.
 func (db *DB) GetSecret(ctx context.Context, projectID, path string) (*Secret, error) {
-	secret := &Secret{}
-	err := db.Pool.QueryRow(ctx,
-		`SELECT id, project_id, path, COALESCE(description, ''), COALESCE(secret_type, 'kv'), metadata, created_by, created_at, deleted_at
+	secret, err := scanSecret(db.Pool.QueryRow(ctx,
+		`SELECT `+secretColumns+`
 		 FROM secrets WHERE project_id = $1 AND path = $2 AND deleted_at IS NULL`,
 		projectID, path,
-	).Scan(&secret.ID, &secret.ProjectID, &secret.Path, &secret.Description,
-		&secret.SecretType, &secret.Metadata, &secret.CreatedBy, &secret.CreatedAt, &secret.DeletedAt)
+	))
 	if err != nil {
 		return nil, fmt.Errorf("getting secret: %w", err)
 	}
@@ -59,13 +83,11 @@ func (db *DB) GetSecret(ctx context.Context, projectID, path string) (*Secret, e
 
 // GetSecretByID retrieves a secret by its ID.
 func (db *DB) GetSecretByID(ctx context.Context, id string) (*Secret, error) {
-	secret := &Secret{}
-	err := db.Pool.QueryRow(ctx,
-		`SELECT id, project_id, path, COALESCE(description, ''), COALESCE(secret_type, 'kv'), metadata, created_by, created_at, deleted_at
+	secret, err := scanSecret(db.Pool.QueryRow(ctx,
+		`SELECT `+secretColumns+`
 		 FROM secrets WHERE id = $1`,
 		id,
-	).Scan(&secret.ID, &secret.ProjectID, &secret.Path, &secret.Description,
-		&secret.SecretType, &secret.Metadata, &secret.CreatedBy, &secret.CreatedAt, &secret.DeletedAt)
+	))
 	if err != nil {
 		return nil, fmt.Errorf("getting secret by id: %w", err)
 	}
@@ -75,7 +97,7 @@ func (db *DB) GetSecretByID(ctx context.Context, id string) (*Secret, error) {
 // ListSecrets lists all active secrets in a project.
 func (db *DB) ListSecrets(ctx context.Context, projectID string) ([]Secret, error) {
 	rows, err := db.Pool.Query(ctx,
-		`SELECT id, project_id, path, COALESCE(description, ''), COALESCE(secret_type, 'kv'), metadata, created_by, created_at, deleted_at
+		`SELECT `+secretColumns+`
 		 FROM secrets WHERE project_id = $1 AND deleted_at IS NULL
 		 ORDER BY path`,
 		projectID,
@@ -87,12 +109,11 @@ func (db *DB) ListSecrets(ctx context.Context, projectID string) ([]Secret, erro
 
 	var secrets []Secret
 	for rows.Next() {
-		var s Secret
-		if err := rows.Scan(&s.ID, &s.ProjectID, &s.Path, &s.Description,
-			&s.SecretType, &s.Metadata, &s.CreatedBy, &s.CreatedAt, &s.DeletedAt); err != nil {
+		s, err := scanSecret(rows)
+		if err != nil {
 			return nil, fmt.Errorf("scanning secret: %w", err)
 		}
-		secrets = append(secrets, s)
+		secrets = append(secrets, *s)
 	}
 	return secrets, rows.Err()
 }
@@ -114,17 +135,16 @@ func (db *DB) SoftDeleteSecret(ctx context.Context, projectID, path string) erro
 }
 
 // CreateSecretVersion inserts a new encrypted version of a secret.
+// kekVersion is the project KEK wrapping the DEK, or 0 for the master key.
 func (db *DB) CreateSecretVersion(ctx context.Context, secretID string, version int,
-	ciphertext, nonce, encryptedDEK, dekNonce []byte, masterKeyVersion int, createdBy string) (*SecretVersion, error) {
+	ciphertext, nonce, encryptedDEK, dekNonce []byte, masterKeyVersion, kekVersion, formatVersion int, createdBy string) (*SecretVersion, error) {
 
-	sv := &SecretVersion{}
-	err := db.Pool.QueryRow(ctx,
-		`INSERT INTO secret_versions (secret_id, version, ciphertext, nonce, encrypted_dek, dek_nonce, master_key_version, created_by)
-		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
-		 RETURNING id, secret_id, version, ciphertext, nonce, encrypted_dek, dek_nonce, master_key_version, created_by, created_at`,
-		secretID, version, ciphertext, nonce, encryptedDEK, dekNonce, masterKeyVersion, createdBy,
-	).Scan(&sv.ID, &sv.SecretID, &sv.Version, &sv.Ciphertext, &sv.Nonce,
-		&sv.EncryptedDEK, &sv.DEKNonce, &sv.MasterKeyVersion, &sv.CreatedBy, &sv.CreatedAt)
+	sv, err := scanSecretVersion(db.Pool.QueryRow(ctx,
+		`INSERT INTO secret_versions (secret_id, version, ciphertext, nonce, encrypted_dek, dek_nonce, master_key_version, kek_version, format_version, created_by)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		 RETURNING `+secretVersionColumns,
+		secretID, version, ciphertext, nonce, encryptedDEK, dekNonce, masterKeyVersion, kekVersion, formatVersion, createdBy,
+	))
 	if err != nil {
 		return nil, fmt.Errorf("creating secret version: %w", err)
 	}
@@ -133,20 +153,34 @@ func (db *DB) CreateSecretVersion(ctx context.Context, secretID string, version
 
 // GetLatestSecretVersion retrieves the latest version of a secret.
 func (db *DB) GetLatestSecretVersion(ctx context.Context, secretID string) (*SecretVersion, error) {
-	sv := &SecretVersion{}
-	err := db.Pool.QueryRow(ctx,
-		`SELECT id, secret_id, version, ciphertext, nonce, encrypted_dek, dek_nonce, master_key_version, created_by, created_at
+	sv, err := scanSecretVersion(db.Pool.QueryRow(ctx,
+		`SELECT `+secretVersionColumns+`
 		 FROM secret_versions WHERE secret_id = $1
 		 ORDER BY version DESC LIMIT 1`,
 		secretID,
-	).Scan(&sv.ID, &sv.SecretID, &sv.Version, &sv.Ciphertext, &sv.Nonce,
-		&sv.EncryptedDEK, &sv.DEKNonce, &sv.MasterKeyVersion, &sv.CreatedBy, &sv.CreatedAt)
+	))
 	if err != nil {
 		return nil, fmt.Errorf("getting latest secret version: %w", err)
 	}
 	return sv, nil
 }
 
+// GetSecretVersion retrieves a specific version of a secret.
+func (db *DB) GetSecretVersion(ctx context.Context, secretID string, version int) (*SecretVersion, error) {
+	sv, err := scanSecretVersion(db.Pool.QueryRow(ctx,
+		`SELECT `+secretVersionColumns+`
+		 FROM secret_versions WHERE secret_id = $1 AND version = $2`,
+		secretID, version,
+	))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("secret version not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("getting secret version: %w", err)
+	}
+	return sv, nil
+}
+
 // GetNextSecretVersion returns the next version number for a secret.
 func (db *DB) GetNextSecretVersion(ctx context.Context, secretID string) (int, error) {
 	var maxVersion *int
@@ -166,7 +200,7 @@ func (db *DB) GetNextSecretVersion(ctx context.Context, secretID string) (int, e
 // ListSecretVersions returns all versions of a secret (metadata only, no ciphertext).
 func (db *DB) ListSecretVersions(ctx context.Context, secretID string) ([]SecretVersion, error) {
 	rows, err := db.Pool.Query(ctx,
-		`SELECT id, secret_id, version, created_by, created_at
+		`SELECT id, secret_id, version, created_by, created_at, destroyed_at
 		 FROM secret_versions WHERE secret_id = $1
 		 ORDER BY version DESC`,
 		secretID,
@@ -179,10 +213,85 @@ func (db *DB) ListSecretVersions(ctx context.Context, secretID string) ([]Secret
 	var versions []SecretVersion
 	for rows.Next() {
 		var sv SecretVersion
-		if err := rows.Scan(&sv.ID, &sv.SecretID, &sv.Version, &sv.CreatedBy, &sv.CreatedAt); err != nil {
+		if err := rows.Scan(&sv.ID, &sv.SecretID, &sv.Version, &sv.CreatedBy, &sv.CreatedAt, &sv.DestroyedAt); err != nil {
 			return nil, fmt.Errorf("scanning secret version: %w", err)
 		}
 		versions = append(versions, sv)
 	}
 	return versions, rows.Err()
 }
+
+// LegacySecretVersion is a secret version still stored in ciphertext format 1,
+// together with the project it belongs to.
+type LegacySecretVersion struct {
+	SecretVersion
+	ProjectID string
+}
+
+// CountLegacySecretVersions returns how many secret versions still use
+// ciphertext format 1.
+func (db *DB) CountLegacySecretVersions(ctx context.Context) (int64, error) {
+	var count int64
+	err := db.Pool.QueryRow(ctx,
+		`SELECT COUNT(*) FROM secret_versions WHERE format_version = 1 AND destroyed_at IS NULL`,
+	).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("counting legacy secret versions: %w", err)
+	}
+	return count, nil
+}
+
+// ListLegacySecretVersions returns up to limit format 1 secret versions with
+// an id greater than afterID, ordered by id (keyset pagination).
+func (db *DB) ListLegacySecretVersions(ctx context.Context, afterID string, limit int) ([]LegacySecretVersion, error) {
+	if afterID == "" {
+		afterID = "00000000-0000-0000-0000-000000000000"
+	}
+	rows, err := db.Pool.Query(ctx,
+		`SELECT sv.id, sv.secret_id, sv.version, sv.ciphertext, sv.nonce, sv.encrypted_dek, sv.dek_nonce,
+		        sv.master_key_version, sv.kek_version, sv.format_version, s.project_id
+		 FROM secret_versions sv
+		 JOIN secrets s ON s.id = sv.secret_id
+		 WHERE sv.format_version = 1 AND sv.destroyed_at IS NULL AND sv.id > $1
+		 ORDER BY sv.id
+		 LIMIT $2`,
+		afterID, limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("listing legacy secret versions: %w", err)
+	}
+	defer rows.Close()
+
+	var versions []LegacySecretVersion
+	for rows.Next() {
+		var v LegacySecretVersion
+		if err := rows.Scan(&v.ID, &v.SecretID, &v.Version, &v.Ciphertext, &v.Nonce, &v.EncryptedDEK, &v.DEKNonce,
+			&v.MasterKeyVersion, &v.KEKVersion, &v.FormatVersion, &v.ProjectID); err != nil {
+			return nil, fmt.Errorf("scanning legacy secret version: %w", err)
+		}
+		versions = append(versions, v)
+	}
+	return versions, rows.Err()
+}
+
+// UpgradeSecretVersionCiphertext replaces a format 1 row's ciphertext and DEK
+// with a re-encrypted value in the given format. The update only applies if
+// the row is still format 1, so concurrent upgrades are harmless.
+func (db *DB) UpgradeSecretVersionCiphertext(ctx context.Context, id string,
+	ciphertext, nonce, encryptedDEK, dekNonce []byte, masterKeyVersion, kekVersion, formatVersion int) error {
+
+	result, err := db.Pool.Exec(ctx,
+		`UPDATE secret_versions
+		 SET ciphertext = $2, nonce = $3, encrypted_dek = $4, dek_nonce = $5,
+		     master_key_version = $6, kek_version = $7, format_version = $8
+		 WHERE id = $1 AND format_version = 1`,
+		id, ciphertext, nonce, encryptedDEK, dekNonce, masterKeyVersion, kekVersion, formatVersion,
+	)
+	if err != nil {
+		return fmt.Errorf("upgrading secret version ciphertext: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("secret version %s already upgraded", id)
+	}
+	return nil
+}
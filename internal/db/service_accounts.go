@@ -2,19 +2,30 @@ package db
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
+
+	"github.com/jackc/pgx/v5"
 )
 
-// CreateServiceAccount inserts a new service account.
-func (db *DB) CreateServiceAccount(ctx context.Context, name, tokenHash, projectID string, scopes []string, createdBy string, expiresAt *time.Time) (*ServiceAccount, error) {
+const serviceAccountColumns = `id, name, token_hash, project_id, scopes, created_by, created_at, expires_at, token_id IS NULL`
+
+func scanServiceAccount(row pgx.Row) (*ServiceAccount, error) {
 	sa := &ServiceAccount{}
-	err := db.Pool.QueryRow(ctx,
-		`INSERT INTO service_accounts (name, token_hash, project_id, scopes, created_by, expires_at)
-		 VALUES ($1, $2, $3, $4, $5, $6)
-		 RETURNING id, name, token_hash, project_id, scopes, created_by, created_at, expires_at`,
-		name, tokenHash, projectID, scopes, createdBy, expiresAt,
-	).Scan(&sa.ID, &sa.Name, &sa.TokenHash, &sa.ProjectID, &sa.Scopes, &sa.CreatedBy, &sa.CreatedAt, &sa.ExpiresAt)
+	err := row.Scan(&sa.ID, &sa.Name, &sa.TokenHash, &sa.ProjectID, &sa.Scopes,
+		&sa.CreatedBy, &sa.CreatedAt, &sa.ExpiresAt, &sa.LegacyToken)
+	return sa, err
+}
+
+// CreateServiceAccount inserts a new service account.
+func (db *DB) CreateServiceAccount(ctx context.Context, name, tokenID, tokenHash, projectID string, scopes []string, createdBy string, expiresAt *time.Time) (*ServiceAccount, error) {
+	sa, err := scanServiceAccount(db.Pool.QueryRow(ctx,
+		`INSERT INTO service_accounts (name, token_id, token_hash, project_id, scopes, created_by, expires_at)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7)
+		 RETURNING `+serviceAccountColumns,
+		name, tokenID, tokenHash, projectID, scopes, createdBy, expiresAt,
+	))
 	if err != nil {
 		return nil, fmt.Errorf("creating service account: %w", err)
 	}
@@ -24,7 +35,7 @@ func (db *DB) CreateServiceAccount(ctx context.Context, name, tokenHash, project
 // ListServiceAccounts returns all service accounts.
 func (db *DB) ListServiceAccounts(ctx context.Context) ([]ServiceAccount, error) {
 	rows, err := db.Pool.Query(ctx,
-		`SELECT id, name, token_hash, project_id, scopes, created_by, created_at, expires_at
+		`SELECT `+serviceAccountColumns+`
 		 FROM service_accounts ORDER BY created_at DESC`,
 	)
 	if err != nil {
@@ -34,25 +45,22 @@ func (db *DB) ListServiceAccounts(ctx context.Context) ([]ServiceAccount, error)
 
 	var accounts []ServiceAccount
 	for rows.Next() {
-		var sa ServiceAccount
-		if err := rows.Scan(&sa.ID, &sa.Name, &sa.TokenHash, &sa.ProjectID, &sa.Scopes,
-			&sa.CreatedBy, &sa.CreatedAt, &sa.ExpiresAt); err != nil {
+		sa, err := scanServiceAccount(rows)
+		if err != nil {
 			return nil, fmt.Errorf("scanning service account: %w", err)
 		}
-		accounts = append(accounts, sa)
+		accounts = append(accounts, *sa)
 	}
 	return accounts, rows.Err()
 }
 
 // GetServiceAccountByID retrieves a service account by ID.
 func (db *DB) GetServiceAccountByID(ctx context.Context, id string) (*ServiceAccount, error) {
-	sa := &ServiceAccount{}
-	err := db.Pool.QueryRow(ctx,
-		`SELECT id, name, token_hash, project_id, scopes, created_by, created_at, expires_at
+	sa, err := scanServiceAccount(db.Pool.QueryRow(ctx,
+		`SELECT `+serviceAccountColumns+`
 		 FROM service_accounts WHERE id = $1`,
 		id,
-	).Scan(&sa.ID, &sa.Name, &sa.TokenHash, &sa.ProjectID, &sa.Scopes,
-		&sa.CreatedBy, &sa.CreatedAt, &sa.ExpiresAt)
+	))
 	if err != nil {
 		return nil, fmt.Errorf("getting service account: %w", err)
 	}
@@ -62,7 +70,7 @@ func (db *DB) GetServiceAccountByID(ctx context.Context, id string) (*ServiceAcc
 // ListServiceAccountsByProject returns all service accounts for a project.
 func (db *DB) ListServiceAccountsByProject(ctx context.Context, projectID string) ([]ServiceAccount, error) {
 	rows, err := db.Pool.Query(ctx,
-		`SELECT id, name, token_hash, project_id, scopes, created_by, created_at, expires_at
+		`SELECT `+serviceAccountColumns+`
 		 FROM service_accounts WHERE project_id = $1 ORDER BY created_at DESC`,
 		projectID,
 	)
@@ -73,23 +81,43 @@ func (db *DB) ListServiceAccountsByProject(ctx context.Context, projectID string
 
 	var accounts []ServiceAccount
 	for rows.Next() {
-		var sa ServiceAccount
-		if err := rows.Scan(&sa.ID, &sa.Name, &sa.TokenHash, &sa.ProjectID, &sa.Scopes,
-			&sa.CreatedBy, &sa.CreatedAt, &sa.ExpiresAt); err != nil {
+		sa, err := scanServiceAccount(rows)
+		if err != nil {
 			return nil, fmt.Errorf("scanning service account: %w", err)
 		}
-		accounts = append(accounts, sa)
+		accounts = append(accounts, *sa)
 	}
 	return accounts, rows.Err()
 }
 
-// FindServiceAccountByToken finds a service account by iterating through all accounts
-// and comparing the token hash. This is O(n) but necessary since we can't look up by token directly.
+// GetServiceAccountByTokenID retrieves the non-expired service account whose
+// token carries tokenID. The caller still has to check the token's secret
+// against the hash.
+func (db *DB) GetServiceAccountByTokenID(ctx context.Context, tokenID string) (*ServiceAccount, error) {
+	sa, err := scanServiceAccount(db.Pool.QueryRow(ctx,
+		`SELECT `+serviceAccountColumns+`
+		 FROM service_accounts
+		 WHERE token_id = $1 AND (expires_at IS NULL OR expires_at > now())`,
+		tokenID,
+	))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("service account not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("getting service account by token id: %w", err)
+	}
+	return sa, nil
+}
+
+// FindServiceAccountByToken finds the service account of a legacy token, one
+// issued before tokens had IDs, by iterating through the accounts that still
+// have one and comparing the token hash. This is O(n), which is why newer
+// tokens are looked up by GetServiceAccountByTokenID instead.
 func (db *DB) FindServiceAccountByToken(ctx context.Context, checkFn func(hash string) bool) (*ServiceAccount, error) {
 	rows, err := db.Pool.Query(ctx,
-		`SELECT id, name, token_hash, project_id, scopes, created_by, created_at, expires_at
+		`SELECT `+serviceAccountColumns+`
 		 FROM service_accounts
-		 WHERE (expires_at IS NULL OR expires_at > now())`,
+		 WHERE token_id IS NULL AND (expires_at IS NULL OR expires_at > now())`,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("querying service accounts: %w", err)
@@ -97,13 +125,12 @@ func (db *DB) FindServiceAccountByToken(ctx context.Context, checkFn func(hash s
 	defer rows.Close()
 
 	for rows.Next() {
-		var sa ServiceAccount
-		if err := rows.Scan(&sa.ID, &sa.Name, &sa.TokenHash, &sa.ProjectID, &sa.Scopes,
-			&sa.CreatedBy, &sa.CreatedAt, &sa.ExpiresAt); err != nil {
+		sa, err := scanServiceAccount(rows)
+		if err != nil {
 			return nil, fmt.Errorf("scanning service account: %w", err)
 		}
 		if checkFn(sa.TokenHash) {
-			return &sa, nil
+			return sa, nil
 		}
 	}
 	if err := rows.Err(); err != nil {
@@ -111,3 +138,21 @@ func (db *DB) FindServiceAccountByToken(ctx context.Context, checkFn func(hash s
 	}
 	return nil, fmt.Errorf("service account not found")
 }
+
+// RotateServiceAccountToken replaces the token of a service account. The old
+// token stops working at once.
+func (db *DB) RotateServiceAccountToken(ctx context.Context, id, tokenID, tokenHash string) (*ServiceAccount, error) {
+	sa, err := scanServiceAccount(db.Pool.QueryRow(ctx,
+		`UPDATE service_accounts SET token_id = $2, token_hash = $3
+		 WHERE id = $1
+		 RETURNING `+serviceAccountColumns,
+		id, tokenID, tokenHash,
+	))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("service account not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("rotating service account token: %w", err)
+	}
+	return sa, nil
+}
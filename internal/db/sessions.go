@@ -0,0 +1,328 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Session is a login of a user: the refresh token that renews its access
+// tokens, and the access token last issued for it.
+type Session struct {
+	ID               string     `json:"id"`
+	UserID           string     `json:"user_id"`
+	RefreshTokenHash string     `json:"-"`
+	AccessJTI        *string    `json:"-"`
+	AccessExpiresAt  *time.Time `json:"-"`
+	IP               string     `json:"ip,omitempty"`
+	UserAgent        string     `json:"user_agent,omitempty"`
+	AMR              []string   `json:"amr"`              // how the user authenticated
+	MFAAt            *time.Time `json:"mfa_at,omitempty"` // when MFA was last verified
+	CreatedAt        time.Time  `json:"created_at"`
+	LastUsedAt       time.Time  `json:"last_used_at"`
+	ExpiresAt        time.Time  `json:"expires_at"`
+	RevokedAt        *time.Time `json:"revoked_at,omitempty"`
+	RevokedBy        *string    `json:"revoked_by,omitempty"`
+}
+
+const sessionColumns = `id, user_id, refresh_token_hash, access_jti, access_expires_at, ip, user_agent,
+	amr, mfa_at, created_at, last_used_at, expires_at, revoked_at, revoked_by`
+
+func scanSession(row pgx.Row) (*Session, error) {
+	s := &Session{}
+	err := row.Scan(&s.ID, &s.UserID, &s.RefreshTokenHash, &s.AccessJTI, &s.AccessExpiresAt, &s.IP, &s.UserAgent,
+		&s.AMR, &s.MFAAt, &s.CreatedAt, &s.LastUsedAt, &s.ExpiresAt, &s.RevokedAt, &s.RevokedBy)
+	return s, err
+}
+
+// Active reports whether the session is neither revoked nor expired.
+func (s *Session) Active() bool {
+	return s.RevokedAt == nil && s.ExpiresAt.After(time.Now())
+}
+
+// MFAFresh reports whether MFA was verified for the session within maxAge.
+func (s *Session) MFAFresh(maxAge time.Duration) bool {
+	return s.MFAAt != nil && time.Since(*s.MFAAt) < maxAge
+}
+
+// CreateSession starts a session for a user with the hash of its first
+// refresh token, the methods the user authenticated with and whether MFA was
+// one of them.
+func (db *DB) CreateSession(ctx context.Context, userID, refreshHash, ip, userAgent string, amr []string, mfa bool, expiresAt time.Time) (*Session, error) {
+	s, err := scanSession(db.Pool.QueryRow(ctx,
+		`INSERT INTO sessions (user_id, refresh_token_hash, ip, user_agent, amr, mfa_at, expires_at)
+		 VALUES ($1, $2, $3, $4, $5, CASE WHEN $6 THEN now() END, $7)
+		 RETURNING `+sessionColumns,
+		userID, refreshHash, ip, userAgent, amr, mfa, expiresAt,
+	))
+	if err != nil {
+		return nil, fmt.Errorf("creating session: %w", err)
+	}
+	return s, nil
+}
+
+// SetSessionAccessToken records the access token issued for a session.
+func (db *DB) SetSessionAccessToken(ctx context.Context, id, jti string, expiresAt time.Time) error {
+	_, err := db.Pool.Exec(ctx,
+		`UPDATE sessions SET access_jti = $2, access_expires_at = $3 WHERE id = $1`,
+		id, jti, expiresAt,
+	)
+	if err != nil {
+		return fmt.Errorf("setting session access token: %w", err)
+	}
+	return nil
+}
+
+// GetSession returns a session.
+func (db *DB) GetSession(ctx context.Context, id string) (*Session, error) {
+	s, err := scanSession(db.Pool.QueryRow(ctx,
+		`SELECT `+sessionColumns+` FROM sessions WHERE id = $1`,
+		id,
+	))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("session not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("getting session: %w", err)
+	}
+	return s, nil
+}
+
+// FindSessionByRefreshToken returns the session whose current or previous
+// refresh token has the given hash. reused is set if it was the previous one,
+// which was already exchanged for a new token.
+func (db *DB) FindSessionByRefreshToken(ctx context.Context, refreshHash string) (s *Session, reused bool, err error) {
+	s, err = scanSession(db.Pool.QueryRow(ctx,
+		`SELECT `+sessionColumns+` FROM sessions
+		 WHERE refresh_token_hash = $1 OR previous_refresh_hash = $1`,
+		refreshHash,
+	))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, false, fmt.Errorf("session not found")
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("finding session: %w", err)
+	}
+	return s, s.RefreshTokenHash != refreshHash, nil
+}
+
+// RotateSession exchanges the refresh token of an active session for a new
+// one and records the new access token, extending the session to expiresAt.
+// The access token issued before is revoked.
+func (db *DB) RotateSession(ctx context.Context, id, oldHash, newHash, jti string, accessExpiresAt, expiresAt time.Time) (*Session, error) {
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("beginning transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	old, err := scanSession(tx.QueryRow(ctx,
+		`SELECT `+sessionColumns+` FROM sessions
+		 WHERE id = $1 AND refresh_token_hash = $2 AND revoked_at IS NULL AND expires_at > now()
+		 FOR UPDATE`,
+		id, oldHash,
+	))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("session no longer active")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("locking session: %w", err)
+	}
+	if err := denyAccessToken(ctx, tx, old); err != nil {
+		return nil, err
+	}
+
+	s, err := scanSession(tx.QueryRow(ctx,
+		`UPDATE sessions SET previous_refresh_hash = refresh_token_hash, refresh_token_hash = $2,
+		 access_jti = $3, access_expires_at = $4, last_used_at = now(), expires_at = $5
+		 WHERE id = $1
+		 RETURNING `+sessionColumns,
+		id, newHash, jti, accessExpiresAt, expiresAt,
+	))
+	if err != nil {
+		return nil, fmt.Errorf("rotating session: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("committing transaction: %w", err)
+	}
+	return s, nil
+}
+
+// StepUpSession records that the user of an active session verified MFA
+// again, with method, and records the new access token issued for it. The
+// access token issued before is revoked.
+func (db *DB) StepUpSession(ctx context.Context, id, method, jti string, accessExpiresAt time.Time) (*Session, error) {
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("beginning transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	old, err := scanSession(tx.QueryRow(ctx,
+		`SELECT `+sessionColumns+` FROM sessions
+		 WHERE id = $1 AND revoked_at IS NULL AND expires_at > now()
+		 FOR UPDATE`,
+		id,
+	))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("session no longer active")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("locking session: %w", err)
+	}
+	if err := denyAccessToken(ctx, tx, old); err != nil {
+		return nil, err
+	}
+
+	s, err := scanSession(tx.QueryRow(ctx,
+		`UPDATE sessions SET mfa_at = now(), access_jti = $3, access_expires_at = $4, last_used_at = now(),
+		 amr = CASE WHEN $2 = ANY(amr) THEN amr ELSE array_append(amr, $2) END
+		 WHERE id = $1
+		 RETURNING `+sessionColumns,
+		id, method, jti, accessExpiresAt,
+	))
+	if err != nil {
+		return nil, fmt.Errorf("stepping up session: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("committing transaction: %w", err)
+	}
+	return s, nil
+}
+
+// RevokeSession ends a session and revokes its current access token.
+// revokedBy is the user who revoked it, or "" if the server did.
+func (db *DB) RevokeSession(ctx context.Context, id, revokedBy string) (*Session, error) {
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("beginning transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	s, err := scanSession(tx.QueryRow(ctx,
+		`UPDATE sessions SET revoked_at = now(), revoked_by = NULLIF($2, '')::uuid
+		 WHERE id = $1 AND revoked_at IS NULL
+		 RETURNING `+sessionColumns,
+		id, revokedBy,
+	))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("session not found or already revoked")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("revoking session: %w", err)
+	}
+	if err := denyAccessToken(ctx, tx, s); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("committing transaction: %w", err)
+	}
+	return s, nil
+}
+
+// RevokeUserSessions ends every active session of a user and revokes their
+// access tokens. It returns the sessions revoked.
+func (db *DB) RevokeUserSessions(ctx context.Context, userID, revokedBy string) ([]Session, error) {
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("beginning transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx,
+		`UPDATE sessions SET revoked_at = now(), revoked_by = NULLIF($2, '')::uuid
+		 WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > now()
+		 RETURNING `+sessionColumns,
+		userID, revokedBy,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("revoking sessions: %w", err)
+	}
+	var sessions []Session
+	for rows.Next() {
+		s, err := scanSession(rows)
+		if err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("scanning session: %w", err)
+		}
+		sessions = append(sessions, *s)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range sessions {
+		if err := denyAccessToken(ctx, tx, &sessions[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("committing transaction: %w", err)
+	}
+	return sessions, nil
+}
+
+// denyAccessToken adds the access token last issued for a session to the
+// denylist, if it has not expired yet, and drops entries that have.
+func denyAccessToken(ctx context.Context, tx pgx.Tx, s *Session) error {
+	if s.AccessJTI == nil || s.AccessExpiresAt == nil || !s.AccessExpiresAt.After(time.Now()) {
+		return nil
+	}
+	if _, err := tx.Exec(ctx,
+		`INSERT INTO revoked_tokens (jti, expires_at) VALUES ($1, $2) ON CONFLICT (jti) DO NOTHING`,
+		*s.AccessJTI, *s.AccessExpiresAt,
+	); err != nil {
+		return fmt.Errorf("revoking access token: %w", err)
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM revoked_tokens WHERE expires_at < now()`); err != nil {
+		return fmt.Errorf("pruning revoked tokens: %w", err)
+	}
+	return nil
+}
+
+// IsTokenRevoked reports whether the access token with the given JTI is on
+// the denylist.
+func (db *DB) IsTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	var revoked bool
+	err := db.Pool.QueryRow(ctx,
+		`SELECT EXISTS (SELECT 1 FROM revoked_tokens WHERE jti = $1)`,
+		jti,
+	).Scan(&revoked)
+	if err != nil {
+		return false, fmt.Errorf("checking revoked token: %w", err)
+	}
+	return revoked, nil
+}
+
+// ListSessions returns the sessions of a user, newest first; only active
+// ones if activeOnly is set.
+func (db *DB) ListSessions(ctx context.Context, userID string, activeOnly bool) ([]Session, error) {
+	rows, err := db.Pool.Query(ctx,
+		`SELECT `+sessionColumns+` FROM sessions
+		 WHERE user_id = $1 AND (NOT $2 OR (revoked_at IS NULL AND expires_at > now()))
+		 ORDER BY created_at DESC`,
+		userID, activeOnly,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("listing sessions: %w", err)
+	}
+	defer rows.Close()
+
+	var sessions []Session
+	for rows.Next() {
+		s, err := scanSession(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scanning session: %w", err)
+		}
+		sessions = append(sessions, *s)
+	}
+	return sessions, rows.Err()
+}
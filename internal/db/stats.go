@@ -29,7 +29,7 @@ func (db *DB) GetDashboardStats(ctx context.Context) (*DashboardStats, error) {
 
 	// Total projects
 	err = db.Pool.QueryRow(ctx,
-		`SELECT COUNT(*) FROM projects`,
+		`SELECT COUNT(*) FROM projects WHERE deleted_at IS NULL`,
 	).Scan(&stats.TotalProjects)
 	if err != nil {
 		return nil, fmt.Errorf("counting projects: %w", err)
@@ -5,10 +5,17 @@ import (
 	"fmt"
 )
 
-// CreateTeam inserts a new team within an organization.
-func (db *DB) CreateTeam(ctx context.Context, orgID, name, description string) (*Team, error) {
+// CreateTeam inserts a new team within an organization and adds its creator
+// to it with creatorRole, in one transaction.
+func (db *DB) CreateTeam(ctx context.Context, orgID, name, description, creatorID, creatorRole string) (*Team, error) {
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("beginning transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
 	team := &Team{}
-	err := db.Pool.QueryRow(ctx,
+	err = tx.QueryRow(ctx,
 		`INSERT INTO teams (org_id, name, description)
 		 VALUES ($1, $2, $3)
 		 RETURNING id, org_id, name, COALESCE(description, ''), created_at`,
@@ -17,6 +24,18 @@ func (db *DB) CreateTeam(ctx context.Context, orgID, name, description string) (
 	if err != nil {
 		return nil, fmt.Errorf("creating team: %w", err)
 	}
+
+	_, err = tx.Exec(ctx,
+		`INSERT INTO team_members (team_id, user_id, role) VALUES ($1, $2, $3)`,
+		team.ID, creatorID, creatorRole,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("adding team creator: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("committing transaction: %w", err)
+	}
 	return team, nil
 }
 
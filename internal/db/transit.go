@@ -0,0 +1,168 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const transitKeyColumns = `id, name, key_type, latest_version, min_decrypt_version, created_by, created_at, updated_at`
+
+func scanTransitKey(row pgx.Row) (*TransitKey, error) {
+	k := &TransitKey{}
+	err := row.Scan(&k.ID, &k.Name, &k.KeyType, &k.LatestVersion, &k.MinDecryptVersion,
+		&k.CreatedBy, &k.CreatedAt, &k.UpdatedAt)
+	return k, err
+}
+
+// CreateTransitKey inserts a transit key together with its first version.
+func (db *DB) CreateTransitKey(ctx context.Context, name, keyType, createdBy string, first *TransitKeyVersion) (*TransitKey, error) {
+	var by *string
+	if createdBy != "" {
+		by = &createdBy
+	}
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("beginning transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	key, err := scanTransitKey(tx.QueryRow(ctx,
+		`INSERT INTO transit_keys (name, key_type, latest_version, min_decrypt_version, created_by)
+		 VALUES ($1, $2, 1, 1, $3)
+		 RETURNING `+transitKeyColumns,
+		name, keyType, by,
+	))
+	if err != nil {
+		return nil, fmt.Errorf("creating transit key: %w", err)
+	}
+
+	if err := insertTransitKeyVersion(ctx, tx, key.ID, 1, first); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("committing transit key: %w", err)
+	}
+	return key, nil
+}
+
+// GetTransitKey retrieves a transit key by name.
+func (db *DB) GetTransitKey(ctx context.Context, name string) (*TransitKey, error) {
+	key, err := scanTransitKey(db.Pool.QueryRow(ctx,
+		`SELECT `+transitKeyColumns+` FROM transit_keys WHERE name = $1`,
+		name,
+	))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("transit key not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("getting transit key: %w", err)
+	}
+	return key, nil
+}
+
+// ListTransitKeys returns all transit keys ordered by name.
+func (db *DB) ListTransitKeys(ctx context.Context) ([]TransitKey, error) {
+	rows, err := db.Pool.Query(ctx,
+		`SELECT `+transitKeyColumns+` FROM transit_keys ORDER BY name`,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("listing transit keys: %w", err)
+	}
+	defer rows.Close()
+
+	var keys []TransitKey
+	for rows.Next() {
+		k, err := scanTransitKey(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scanning transit key: %w", err)
+		}
+		keys = append(keys, *k)
+	}
+	return keys, rows.Err()
+}
+
+// GetTransitKeyVersion retrieves the encrypted material of one key version.
+func (db *DB) GetTransitKeyVersion(ctx context.Context, keyID string, version int) (*TransitKeyVersion, error) {
+	kv := &TransitKeyVersion{}
+	err := db.Pool.QueryRow(ctx,
+		`SELECT id, key_id, version, ciphertext, nonce, encrypted_dek, dek_nonce, master_key_version, format_version, created_at
+		 FROM transit_key_versions WHERE key_id = $1 AND version = $2`,
+		keyID, version,
+	).Scan(&kv.ID, &kv.KeyID, &kv.Version, &kv.Ciphertext, &kv.Nonce,
+		&kv.EncryptedDEK, &kv.DEKNonce, &kv.MasterKeyVersion, &kv.FormatVersion, &kv.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("transit key version not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("getting transit key version: %w", err)
+	}
+	return kv, nil
+}
+
+// AddTransitKeyVersion stores a new key version and makes it the latest.
+// It fails if the key's latest version is no longer prevVersion, so two
+// concurrent rotations cannot create the same version.
+func (db *DB) AddTransitKeyVersion(ctx context.Context, keyID string, prevVersion int, kv *TransitKeyVersion) (*TransitKey, error) {
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("beginning transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	key, err := scanTransitKey(tx.QueryRow(ctx,
+		`UPDATE transit_keys SET latest_version = $3, updated_at = now()
+		 WHERE id = $1 AND latest_version = $2
+		 RETURNING `+transitKeyColumns,
+		keyID, prevVersion, prevVersion+1,
+	))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("transit key was rotated concurrently")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("rotating transit key: %w", err)
+	}
+
+	if err := insertTransitKeyVersion(ctx, tx, keyID, key.LatestVersion, kv); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("committing transit key rotation: %w", err)
+	}
+	return key, nil
+}
+
+// UpdateTransitKeyMinDecryptVersion sets the oldest key version that may
+// still decrypt, verify or rewrap.
+func (db *DB) UpdateTransitKeyMinDecryptVersion(ctx context.Context, keyID string, minVersion int) (*TransitKey, error) {
+	key, err := scanTransitKey(db.Pool.QueryRow(ctx,
+		`UPDATE transit_keys SET min_decrypt_version = $2, updated_at = now()
+		 WHERE id = $1
+		 RETURNING `+transitKeyColumns,
+		keyID, minVersion,
+	))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("transit key not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("updating transit key config: %w", err)
+	}
+	return key, nil
+}
+
+func insertTransitKeyVersion(ctx context.Context, tx pgx.Tx, keyID string, version int, kv *TransitKeyVersion) error {
+	_, err := tx.Exec(ctx,
+		`INSERT INTO transit_key_versions (key_id, version, ciphertext, nonce, encrypted_dek, dek_nonce, master_key_version, format_version)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		keyID, version, kv.Ciphertext, kv.Nonce, kv.EncryptedDEK, kv.DEKNonce, kv.MasterKeyVersion, kv.FormatVersion,
+	)
+	if err != nil {
+		return fmt.Errorf("creating transit key version: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// WrappingToken is a response stored under a single-use token instead of
+// being returned to the caller. Only the SHA-256 hash of the token is stored;
+// the ID doubles as the token's accessor, which identifies it in the audit
+// log and can revoke it without being able to unwrap it.
+type WrappingToken struct {
+	ID               string     `json:"accessor"`
+	TokenHash        string     `json:"-"`
+	Ciphertext       []byte     `json:"-"` // nil once unwrapped
+	Nonce            []byte     `json:"-"`
+	EncryptedDEK     []byte     `json:"-"`
+	DEKNonce         []byte     `json:"-"`
+	MasterKeyVersion int        `json:"-"`
+	FormatVersion    int        `json:"-"`
+	CreationPath     string     `json:"creation_path"`
+	ProjectIDs       []string   `json:"-"` // projects whose secret values it holds
+	CreatedByType    string     `json:"created_by_type"`
+	CreatedBy        string     `json:"created_by"`
+	ExpiresAt        time.Time  `json:"expires_at"`
+	CreatedAt        time.Time  `json:"created_at"`
+	UnwrappedAt      *time.Time `json:"unwrapped_at,omitempty"`
+	UnwrappedByType  *string    `json:"unwrapped_by_type,omitempty"`
+	UnwrappedBy      *string    `json:"unwrapped_by,omitempty"`
+}
+
+const wrappingTokenColumns = `id, token_hash, ciphertext, nonce, encrypted_dek, dek_nonce,
+	master_key_version, format_version, creation_path, project_ids::text[], created_by_type, created_by,
+	expires_at, created_at, unwrapped_at, unwrapped_by_type, unwrapped_by`
+
+func scanWrappingToken(row pgx.Row) (*WrappingToken, error) {
+	t := &WrappingToken{}
+	err := row.Scan(&t.ID, &t.TokenHash, &t.Ciphertext, &t.Nonce, &t.EncryptedDEK, &t.DEKNonce,
+		&t.MasterKeyVersion, &t.FormatVersion, &t.CreationPath, &t.ProjectIDs, &t.CreatedByType, &t.CreatedBy,
+		&t.ExpiresAt, &t.CreatedAt, &t.UnwrappedAt, &t.UnwrappedByType, &t.UnwrappedBy)
+	return t, err
+}
+
+// CreateWrappingToken stores a wrapped response. The ID is generated.
+func (db *DB) CreateWrappingToken(ctx context.Context, t *WrappingToken) (*WrappingToken, error) {
+	created, err := scanWrappingToken(db.Pool.QueryRow(ctx,
+		`INSERT INTO wrapping_tokens (token_hash, ciphertext, nonce, encrypted_dek, dek_nonce,
+		   master_key_version, format_version, creation_path, project_ids, created_by_type, created_by, expires_at)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, COALESCE($9::uuid[], '{}'), $10, $11, $12)
+		 RETURNING `+wrappingTokenColumns,
+		t.TokenHash, t.Ciphertext, t.Nonce, t.EncryptedDEK, t.DEKNonce,
+		t.MasterKeyVersion, t.FormatVersion, t.CreationPath, t.ProjectIDs, t.CreatedByType, t.CreatedBy, t.ExpiresAt,
+	))
+	if err != nil {
+		return nil, fmt.Errorf("creating wrapping token: %w", err)
+	}
+	return created, nil
+}
+
+// UnwrapToken uses the wrapping token with the given hash. open is called
+// with the stored ciphertext inside the transaction; only if it succeeds is
+// the ciphertext wiped and the unwrapping recorded, so a token is used up
+// exactly once and never without its response being read. An empty actorID
+// records an anonymous unwrapping. For tokens that are already used or
+// expired the token is returned along with the error.
+func (db *DB) UnwrapToken(ctx context.Context, tokenHash, actorType, actorID string, open func(*WrappingToken) error) (*WrappingToken, error) {
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("beginning transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	t, err := scanWrappingToken(tx.QueryRow(ctx,
+		`SELECT `+wrappingTokenColumns+` FROM wrapping_tokens WHERE token_hash = $1 FOR UPDATE`,
+		tokenHash,
+	))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("wrapping token not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("getting wrapping token: %w", err)
+	}
+	if t.UnwrappedAt != nil {
+		return t, fmt.Errorf("wrapping token already used")
+	}
+	if !t.ExpiresAt.After(time.Now()) {
+		return t, fmt.Errorf("wrapping token expired")
+	}
+
+	if err := open(t); err != nil {
+		return t, err
+	}
+
+	err = tx.QueryRow(ctx,
+		`UPDATE wrapping_tokens
+		 SET ciphertext = NULL, nonce = NULL, encrypted_dek = NULL, dek_nonce = NULL,
+		     unwrapped_at = now(), unwrapped_by_type = $2, unwrapped_by = NULLIF($3, '')::uuid
+		 WHERE id = $1
+		 RETURNING unwrapped_at, unwrapped_by_type, unwrapped_by`,
+		t.ID, actorType, actorID,
+	).Scan(&t.UnwrappedAt, &t.UnwrappedByType, &t.UnwrappedBy)
+	if err != nil {
+		return t, fmt.Errorf("using wrapping token: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return t, fmt.Errorf("committing transaction: %w", err)
+	}
+	return t, nil
+}
+
+// GetWrappingToken returns a wrapping token by accessor.
+func (db *DB) GetWrappingToken(ctx context.Context, accessor string) (*WrappingToken, error) {
+	t, err := scanWrappingToken(db.Pool.QueryRow(ctx,
+		`SELECT `+wrappingTokenColumns+` FROM wrapping_tokens WHERE id = $1`,
+		accessor,
+	))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("wrapping token not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("getting wrapping token: %w", err)
+	}
+	return t, nil
+}
+
+// RevokeWrappingToken deletes an unused wrapping token by accessor, so it can
+// no longer be unwrapped.
+func (db *DB) RevokeWrappingToken(ctx context.Context, accessor string) error {
+	result, err := db.Pool.Exec(ctx,
+		`DELETE FROM wrapping_tokens WHERE id = $1 AND unwrapped_at IS NULL`,
+		accessor,
+	)
+	if err != nil {
+		return fmt.Errorf("revoking wrapping token: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("wrapping token not found")
+	}
+	return nil
+}
+
+// DeleteExpiredWrappingTokens removes wrapping tokens past their expiry,
+// used or not, and returns how many were removed.
+func (db *DB) DeleteExpiredWrappingTokens(ctx context.Context) (int64, error) {
+	result, err := db.Pool.Exec(ctx, `DELETE FROM wrapping_tokens WHERE expires_at <= now()`)
+	if err != nil {
+		return 0, fmt.Errorf("deleting expired wrapping tokens: %w", err)
+	}
+	return result.RowsAffected(), nil
+}
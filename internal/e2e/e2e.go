@@ -0,0 +1,185 @@
+// Package e2e implements the client-side cryptography of end-to-end encrypted
+// projects. It is used by the CLI; the server only uses it to validate blob
+// headers and never holds a project key.
+//
+// Every member has an X25519 key pair whose private half never leaves the
+// member's machine. A project has a versioned symmetric project key, sealed
+// to each member's public key with an anonymous NaCl box (sealed box). Secret
+// values are encrypted with the project key using AES-256-GCM, bound to the
+// project and secret path as associated data:
+//
+//	blob = "TVE1" || key version (uint32, big endian) || nonce || ciphertext
+package e2e
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/nacl/box"
+)
+
+// KeySize is the size of project keys and X25519 keys in bytes.
+const KeySize = 32
+
+// magic starts every value blob.
+var magic = []byte("TVE1")
+
+const (
+	nonceSize  = 12
+	headerSize = 4 + 4 // magic + key version
+)
+
+var (
+	// ErrInvalidBlob is returned for values that are not E2E blobs or fail
+	// authentication.
+	ErrInvalidBlob = errors.New("invalid end-to-end encrypted value")
+	// ErrInvalidKey is returned for keys of the wrong size.
+	ErrInvalidKey = errors.New("invalid key size")
+	// ErrSealedKey is returned when a sealed project key cannot be opened
+	// with the given key pair.
+	ErrSealedKey = errors.New("cannot open sealed project key with this key pair")
+)
+
+// GenerateKeyPair returns a new X25519 key pair.
+func GenerateKeyPair() (publicKey, privateKey []byte, err error) {
+	pub, priv, err := box.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("generating key pair: %w", err)
+	}
+	return pub[:], priv[:], nil
+}
+
+// NewProjectKey returns a random project key.
+func NewProjectKey() ([]byte, error) {
+	key := make([]byte, KeySize)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, fmt.Errorf("generating project key: %w", err)
+	}
+	return key, nil
+}
+
+// SealKey seals a project key to a member's public key.
+func SealKey(projectKey, recipientPublicKey []byte) ([]byte, error) {
+	if len(projectKey) != KeySize || len(recipientPublicKey) != KeySize {
+		return nil, ErrInvalidKey
+	}
+	var pub [KeySize]byte
+	copy(pub[:], recipientPublicKey)
+	sealed, err := box.SealAnonymous(nil, projectKey, &pub, rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("sealing project key: %w", err)
+	}
+	return sealed, nil
+}
+
+// OpenKey opens a project key sealed with SealKey.
+func OpenKey(sealed, publicKey, privateKey []byte) ([]byte, error) {
+	if len(publicKey) != KeySize || len(privateKey) != KeySize {
+		return nil, ErrInvalidKey
+	}
+	var pub, priv [KeySize]byte
+	copy(pub[:], publicKey)
+	copy(priv[:], privateKey)
+	defer zero(priv[:])
+
+	key, ok := box.OpenAnonymous(nil, sealed, &pub, &priv)
+	if !ok || len(key) != KeySize {
+		return nil, ErrSealedKey
+	}
+	return key, nil
+}
+
+// Encrypt encrypts a secret value with project key version keyVersion.
+func Encrypt(projectKey []byte, keyVersion int, projectID, path string, plaintext []byte) ([]byte, error) {
+	gcm, err := newGCM(projectKey)
+	if err != nil {
+		return nil, err
+	}
+
+	blob := make([]byte, headerSize+nonceSize, headerSize+nonceSize+len(plaintext)+gcm.Overhead())
+	copy(blob, magic)
+	binary.BigEndian.PutUint32(blob[4:headerSize], uint32(keyVersion))
+	nonce := blob[headerSize:]
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, fmt.Errorf("generating nonce: %w", err)
+	}
+	return gcm.Seal(blob, nonce, plaintext, aad(blob[:headerSize], projectID, path)), nil
+}
+
+// Decrypt decrypts a blob produced by Encrypt. keys maps project key
+// versions to keys.
+func Decrypt(keys map[int][]byte, projectID, path string, blob []byte) ([]byte, error) {
+	version, err := KeyVersion(blob)
+	if err != nil {
+		return nil, err
+	}
+	key, ok := keys[version]
+	if !ok {
+		return nil, fmt.Errorf("project key v%d not available", version)
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(blob) < headerSize+nonceSize+gcm.Overhead() {
+		return nil, ErrInvalidBlob
+	}
+
+	nonce := blob[headerSize : headerSize+nonceSize]
+	plaintext, err := gcm.Open(nil, nonce, blob[headerSize+nonceSize:], aad(blob[:headerSize], projectID, path))
+	if err != nil {
+		return nil, ErrInvalidBlob
+	}
+	return plaintext, nil
+}
+
+// KeyVersion returns the project key version a blob was encrypted with.
+func KeyVersion(blob []byte) (int, error) {
+	if len(blob) < headerSize+nonceSize || !bytes.Equal(blob[:4], magic) {
+		return 0, ErrInvalidBlob
+	}
+	return int(binary.BigEndian.Uint32(blob[4:headerSize])), nil
+}
+
+// Fingerprint returns a short, human-comparable identifier of a public key,
+// so members can verify out of band that the server handed them the right key.
+func Fingerprint(publicKey []byte) string {
+	sum := sha256.Sum256(publicKey)
+	return hex.EncodeToString(sum[:8])
+}
+
+// aad binds a value to its header, project and path, so the server cannot
+// move a blob to another secret or relabel its key version.
+func aad(header []byte, projectID, path string) []byte {
+	b := make([]byte, 0, len(header)+len(projectID)+len(path)+2)
+	b = append(b, header...)
+	b = append(b, 0)
+	b = append(b, projectID...)
+	b = append(b, 0)
+	return append(b, path...)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	if len(key) != KeySize {
+		return nil, ErrInvalidKey
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("creating cipher: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+func zero(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
@@ -0,0 +1,125 @@
+// Package jsonfield reads and patches single fields of JSON secrets.
+//
+// A field is named by a dot-separated path into nested objects, e.g.
+// "password" or "replica.password". A secret reference may name a field after
+// a '#': "db/config#password".
+package jsonfield
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ErrNotFound is returned when a document has no such field.
+var ErrNotFound = errors.New("field not found")
+
+// Split splits a secret reference "path#field" into its path and field. The
+// field is empty if the reference has none.
+func Split(ref string) (path, field string) {
+	path, field, _ = strings.Cut(ref, "#")
+	return path, field
+}
+
+// Validate checks that a field path has no empty segments.
+func Validate(field string) error {
+	for _, seg := range strings.Split(field, ".") {
+		if seg == "" {
+			return fmt.Errorf("invalid field %q", field)
+		}
+	}
+	return nil
+}
+
+// Get returns the value of a field of a JSON object. Strings are returned as
+// is, any other value as JSON.
+func Get(doc []byte, field string) (string, error) {
+	var v interface{}
+	if err := decode(doc, &v); err != nil {
+		return "", fmt.Errorf("secret is not valid JSON")
+	}
+	for _, seg := range strings.Split(field, ".") {
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return "", ErrNotFound
+		}
+		if v, ok = obj[seg]; !ok {
+			return "", ErrNotFound
+		}
+	}
+	if s, ok := v.(string); ok {
+		return s, nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// MergePatch applies a JSON merge patch (RFC 7396) to a JSON object: fields
+// in the patch replace those of the document, nested objects are merged and
+// null removes a field. The result must still be an object.
+func MergePatch(doc []byte, patch json.RawMessage) ([]byte, error) {
+	var target map[string]interface{}
+	if err := decode(doc, &target); err != nil {
+		return nil, fmt.Errorf("secret is not a JSON object")
+	}
+	var p map[string]interface{}
+	if err := decode(patch, &p); err != nil {
+		return nil, fmt.Errorf("patch must be a JSON object")
+	}
+	return json.Marshal(merge(target, p))
+}
+
+// decode unmarshals JSON keeping numbers exact.
+func decode(data []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
+
+func merge(target, patch map[string]interface{}) map[string]interface{} {
+	if target == nil {
+		target = make(map[string]interface{})
+	}
+	for k, v := range patch {
+		switch pv := v.(type) {
+		case nil:
+			delete(target, k)
+		case map[string]interface{}:
+			tv, _ := target[k].(map[string]interface{})
+			target[k] = merge(tv, pv)
+		default:
+			target[k] = v
+		}
+	}
+	return target
+}
+
+// PatchedFields returns the field paths a merge patch sets or removes, sorted.
+// Nested objects are descended into, so {"replica": {"password": "x"}}
+// touches "replica.password".
+func PatchedFields(patch json.RawMessage) ([]string, error) {
+	var p map[string]interface{}
+	if err := json.Unmarshal(patch, &p); err != nil {
+		return nil, fmt.Errorf("patch must be a JSON object")
+	}
+	var fields []string
+	var walk func(prefix string, obj map[string]interface{})
+	walk = func(prefix string, obj map[string]interface{}) {
+		for k, v := range obj {
+			if nested, ok := v.(map[string]interface{}); ok && len(nested) > 0 {
+				walk(prefix+k+".", nested)
+				continue
+			}
+			fields = append(fields, prefix+k)
+		}
+	}
+	walk("", p)
+	sort.Strings(fields)
+	return fields, nil
+}
@@ -0,0 +1,149 @@
+package jsonfield
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		ref, path, field string
+	}{
+		{"db/config", "db/config", ""},
+		{"db/config#password", "db/config", "password"},
+		{"db/config#replica.password", "db/config", "replica.password"},
+		{"db/config#", "db/config", ""},
+	}
+	for _, tt := range tests {
+		path, field := Split(tt.ref)
+		if path != tt.path || field != tt.field {
+			t.Errorf("Split(%q) = %q, %q, want %q, %q", tt.ref, path, field, tt.path, tt.field)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		field  string
+		wantOK bool
+	}{
+		{"password", true},
+		{"replica.password", true},
+		{"", false},
+		{".password", false},
+		{"replica.", false},
+		{"replica..password", false},
+	}
+	for _, tt := range tests {
+		if err := Validate(tt.field); (err == nil) != tt.wantOK {
+			t.Errorf("Validate(%q) = %v, want ok %v", tt.field, err, tt.wantOK)
+		}
+	}
+}
+
+func TestGet(t *testing.T) {
+	doc := []byte(`{"user":"app","port":5432,"big":12345678901234567890,"tls":true,
+		"replica":{"password":"r3pl","hosts":["a","b"]},"none":null}`)
+
+	tests := []struct {
+		field   string
+		want    string
+		wantErr error
+	}{
+		{"user", "app", nil},
+		{"port", "5432", nil},
+		{"big", "12345678901234567890", nil}, // numbers are kept exact
+		{"tls", "true", nil},
+		{"none", "null", nil},
+		{"replica.password", "r3pl", nil},
+		{"replica.hosts", `["a","b"]`, nil},
+		{"replica", `{"hosts":["a","b"],"password":"r3pl"}`, nil},
+		{"password", "", ErrNotFound},
+		{"replica.user", "", ErrNotFound},
+		{"user.name", "", ErrNotFound}, // not an object
+	}
+	for _, tt := range tests {
+		t.Run(tt.field, func(t *testing.T) {
+			got, err := Get(doc, tt.field)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Get error = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Get = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := Get([]byte("not json"), "user"); err == nil || errors.Is(err, ErrNotFound) {
+		t.Errorf("Get on invalid JSON = %v, want a parse error", err)
+	}
+}
+
+func TestMergePatch(t *testing.T) {
+	doc := []byte(`{"user":"app","password":"old","replica":{"host":"r1","password":"rold"}}`)
+
+	tests := []struct {
+		name    string
+		doc     []byte
+		patch   string
+		want    string
+		wantErr bool
+	}{
+		{"replace a field", doc, `{"password":"new"}`,
+			`{"password":"new","replica":{"host":"r1","password":"rold"},"user":"app"}`, false},
+		{"add a field", doc, `{"port":5432}`,
+			`{"password":"old","port":5432,"replica":{"host":"r1","password":"rold"},"user":"app"}`, false},
+		{"remove a field", doc, `{"password":null}`,
+			`{"replica":{"host":"r1","password":"rold"},"user":"app"}`, false},
+		{"merge a nested object", doc, `{"replica":{"password":"rnew"}}`,
+			`{"password":"old","replica":{"host":"r1","password":"rnew"},"user":"app"}`, false},
+		{"replace a value with an object", []byte(`{"replica":"none"}`), `{"replica":{"host":"r2"}}`,
+			`{"replica":{"host":"r2"}}`, false},
+		{"empty patch", doc, `{}`,
+			`{"password":"old","replica":{"host":"r1","password":"rold"},"user":"app"}`, false},
+		{"document not an object", []byte(`["a"]`), `{"a":1}`, "", true},
+		{"patch not an object", doc, `"password"`, "", true},
+		{"patch not JSON", doc, `{`, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := MergePatch(tt.doc, json.RawMessage(tt.patch))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("MergePatch error = %v, want error %v", err, tt.wantErr)
+			}
+			if string(got) != tt.want {
+				t.Errorf("MergePatch = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPatchedFields(t *testing.T) {
+	tests := []struct {
+		name    string
+		patch   string
+		want    []string
+		wantErr bool
+	}{
+		{"top-level fields", `{"user":"a","password":"b"}`, []string{"password", "user"}, false},
+		{"removed field", `{"password":null}`, []string{"password"}, false},
+		{"nested field", `{"replica":{"password":"x"}}`, []string{"replica.password"}, false},
+		{"deeply nested", `{"a":{"b":{"c":1,"d":null}},"e":[1]}`, []string{"a.b.c", "a.b.d", "e"}, false},
+		{"empty nested object", `{"replica":{}}`, []string{"replica"}, false},
+		{"empty patch", `{}`, nil, false},
+		{"not an object", `[1]`, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := PatchedFields(json.RawMessage(tt.patch))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("PatchedFields error = %v, want error %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("PatchedFields = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,251 @@
+// Package kek manages per-project key encryption keys. Every project has a
+// versioned KEK, wrapped by the master key, that in turn wraps the DEKs of the
+// project's secret versions and leases:
+//
+//	master key -> project KEK -> DEK -> value
+//
+// Destroying a project's KEK versions makes every value under them
+// undecryptable (crypto-shredding). A project can be re-keyed on its own:
+// a new KEK version is created, all of the project's DEKs are re-wrapped with
+// it and the previous versions are destroyed.
+package kek
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/teamvault/teamvault/internal/crypto"
+	"github.com/teamvault/teamvault/internal/db"
+)
+
+// ErrDestroyed is returned when the requested KEK version, or every KEK
+// version of a project, has been destroyed.
+var ErrDestroyed = errors.New("project key has been destroyed")
+
+// rekeyBatchSize is the number of DEKs re-wrapped per query during Rekey.
+const rekeyBatchSize = 500
+
+// dekTables are the tables holding project-scoped DEKs.
+var dekTables = []string{db.DEKTableSecretVersions, db.DEKTableLeases, db.DEKTableChangeRequests}
+
+// Manager loads, creates and destroys project KEKs.
+type Manager struct {
+	database  *db.DB
+	cryptoSvc *crypto.EnvelopeCrypto
+}
+
+// NewManager creates a new KEK manager.
+func NewManager(database *db.DB, cryptoSvc *crypto.EnvelopeCrypto) *Manager {
+	return &Manager{database: database, cryptoSvc: cryptoSvc}
+}
+
+// RekeyResult summarizes a project re-key.
+type RekeyResult struct {
+	Version   int   `json:"version"`
+	Rewrapped int64 `json:"rewrapped"`
+	Failed    int64 `json:"failed"`
+	Destroyed int64 `json:"destroyed"`
+}
+
+// Keys returns the KEK versions of a project, destroyed ones included.
+func (m *Manager) Keys(ctx context.Context, projectID string) ([]db.ProjectKey, error) {
+	return m.database.ListProjectKeys(ctx, projectID)
+}
+
+// Active returns the project's newest KEK, creating version 1 on first use.
+// The caller must Zero the returned key.
+func (m *Manager) Active(ctx context.Context, projectID string) (*crypto.KEK, error) {
+	keys, err := m.database.ListProjectKeys(ctx, projectID)
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		kek, createErr := m.create(ctx, projectID, 1)
+		if createErr == nil {
+			return kek, nil
+		}
+		// Another request may have created version 1 concurrently.
+		if keys, err = m.database.ListProjectKeys(ctx, projectID); err != nil {
+			return nil, err
+		}
+		if len(keys) == 0 {
+			return nil, fmt.Errorf("creating project key: %w", createErr)
+		}
+	}
+	return m.unwrap(&keys[len(keys)-1])
+}
+
+// ForVersion returns KEK version of a project. Version 0 means the DEK is
+// wrapped by the master key, for which ForVersion returns nil.
+// The caller must Zero the returned key.
+func (m *Manager) ForVersion(ctx context.Context, projectID string, version int) (*crypto.KEK, error) {
+	if version == 0 {
+		return nil, nil
+	}
+	key, err := m.database.GetProjectKey(ctx, projectID, version)
+	if err != nil {
+		return nil, err
+	}
+	return m.unwrap(key)
+}
+
+// Encrypt encrypts plaintext with a fresh DEK wrapped by the project's
+// active KEK.
+func (m *Manager) Encrypt(ctx context.Context, projectID string, plaintext []byte, ectx *crypto.EncryptionContext) (*crypto.EncryptedData, error) {
+	kek, err := m.Active(ctx, projectID)
+	if err != nil {
+		return nil, err
+	}
+	defer kek.Zero()
+	return m.cryptoSvc.EncryptWithKEK(plaintext, ectx, kek)
+}
+
+// Decrypt decrypts data whose DEK is wrapped by the project KEK version
+// recorded in data.KEKVersion, or by the master key if that is 0.
+func (m *Manager) Decrypt(ctx context.Context, projectID string, data *crypto.EncryptedData, ectx *crypto.EncryptionContext) ([]byte, error) {
+	kek, err := m.ForVersion(ctx, projectID, data.KEKVersion)
+	if err != nil {
+		return nil, err
+	}
+	defer kek.Zero()
+	return m.cryptoSvc.DecryptWithKEK(data, ectx, kek)
+}
+
+// Rekey creates a new KEK version for the project and re-wraps every DEK of
+// the project's secret versions and leases with it, including DEKs that are
+// still wrapped by the master key. Ciphertexts are not touched. If every DEK
+// was re-wrapped, all older KEK versions are destroyed; otherwise they are
+// kept so the failed rows stay readable and Rekey can be run again.
+func (m *Manager) Rekey(ctx context.Context, projectID string) (*RekeyResult, error) {
+	keys, err := m.database.ListProjectKeys(ctx, projectID)
+	if err != nil {
+		return nil, err
+	}
+	next := 1
+	if len(keys) > 0 {
+		next = keys[len(keys)-1].Version + 1
+	}
+
+	target, err := m.create(ctx, projectID, next)
+	if err != nil {
+		return nil, fmt.Errorf("creating project key: %w", err)
+	}
+	defer target.Zero()
+
+	// Old KEKs are unwrapped once and reused for every row wrapped by them.
+	old := map[int]*crypto.KEK{}
+	defer func() {
+		for _, k := range old {
+			k.Zero()
+		}
+	}()
+
+	result := &RekeyResult{Version: next}
+	// Writers that loaded the previous KEK just before the new version was
+	// created may still add rows under it, so keep sweeping until a pass
+	// finds nothing left to re-wrap.
+	for {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+		found := int64(0)
+		for _, table := range dekTables {
+			n, err := m.rewrapTable(ctx, table, projectID, target, old, result)
+			if err != nil {
+				return result, err
+			}
+			found += n
+		}
+		if found == 0 || result.Failed > 0 {
+			break
+		}
+	}
+
+	if result.Failed > 0 {
+		return result, nil
+	}
+	destroyed, err := m.database.DestroyProjectKeysBelow(ctx, projectID, next)
+	if err != nil {
+		return result, err
+	}
+	result.Destroyed = destroyed
+	return result, nil
+}
+
+// rewrapTable re-wraps one pass over a table and returns the number of rows
+// it saw.
+func (m *Manager) rewrapTable(ctx context.Context, table, projectID string, target *crypto.KEK, old map[int]*crypto.KEK, result *RekeyResult) (int64, error) {
+	var seen int64
+	afterID := ""
+	for {
+		batch, err := m.database.ListProjectDEKs(ctx, table, projectID, target.Version, afterID, rekeyBatchSize)
+		if err != nil {
+			return seen, err
+		}
+		if len(batch) == 0 {
+			return seen, nil
+		}
+
+		for _, row := range batch {
+			afterID = row.ID
+			seen++
+			if err := m.rewrapRow(ctx, table, projectID, row, target, old); err != nil {
+				log.Printf("Project re-key: %s %s: %v", table, row.ID, err)
+				result.Failed++
+				continue
+			}
+			result.Rewrapped++
+		}
+	}
+}
+
+func (m *Manager) rewrapRow(ctx context.Context, table, projectID string, row db.WrappedDEK, target *crypto.KEK, old map[int]*crypto.KEK) error {
+	from, ok := old[row.KEKVersion]
+	if !ok {
+		var err error
+		if from, err = m.ForVersion(ctx, projectID, row.KEKVersion); err != nil {
+			return err
+		}
+		old[row.KEKVersion] = from
+	}
+
+	rewrapped, err := m.cryptoSvc.RewrapDEKWithKEK(&crypto.EncryptedData{
+		EncryptedDEK:     row.EncryptedDEK,
+		DEKNonce:         row.DEKNonce,
+		MasterKeyVersion: row.MasterKeyVersion,
+		KEKVersion:       row.KEKVersion,
+	}, from, target)
+	if err != nil {
+		return err
+	}
+	return m.database.UpdateProjectDEK(ctx, table, row.ID,
+		rewrapped.EncryptedDEK, rewrapped.DEKNonce, rewrapped.MasterKeyVersion,
+		row.KEKVersion, target.Version)
+}
+
+// create generates, stores and returns KEK version of a project.
+func (m *Manager) create(ctx context.Context, projectID string, version int) (*crypto.KEK, error) {
+	kek, wrapped, err := m.cryptoSvc.NewKEK(version)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := m.database.CreateProjectKey(ctx, projectID, version,
+		wrapped.EncryptedDEK, wrapped.DEKNonce, wrapped.MasterKeyVersion); err != nil {
+		kek.Zero()
+		return nil, err
+	}
+	return kek, nil
+}
+
+func (m *Manager) unwrap(key *db.ProjectKey) (*crypto.KEK, error) {
+	if key.DestroyedAt != nil || key.EncryptedKEK == nil {
+		return nil, ErrDestroyed
+	}
+	return m.cryptoSvc.UnwrapKEK(&crypto.EncryptedData{
+		EncryptedDEK:     key.EncryptedKEK,
+		DEKNonce:         key.KEKNonce,
+		MasterKeyVersion: key.MasterKeyVersion,
+	}, key.Version)
+}
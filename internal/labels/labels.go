@@ -0,0 +1,202 @@
+// Package labels validates secret labels and parses label selectors.
+//
+// Labels are free-form key/value pairs (owner, service, environment,
+// data-classification, ...). Selectors use the Kubernetes syntax, with
+// comma-separated requirements that must all hold:
+//
+//	env=prod             label equals value (also env==prod)
+//	env!=prod            label differs from value or is absent
+//	tier in (web,api)    label is one of the values
+//	tier notin (web,api) label is none of the values or is absent
+//	owner                label is present
+//	!deprecated          label is absent
+package labels
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	// MaxLabels is the most labels a secret may have.
+	MaxLabels = 64
+	// MaxValueLength is the longest allowed label value.
+	MaxValueLength = 256
+)
+
+var (
+	keyPattern = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9._/-]{0,61}[A-Za-z0-9])?$`)
+	setPattern = regexp.MustCompile(`(?i)^(\S+)\s+(in|notin)\s*\((.*)\)$`)
+)
+
+// ValidateKey checks that a label key is 1-63 characters of letters, digits,
+// '.', '_', '-' and '/', starting and ending with a letter or digit.
+func ValidateKey(key string) error {
+	if !keyPattern.MatchString(key) {
+		return fmt.Errorf("invalid label key %q", key)
+	}
+	return nil
+}
+
+// Validate checks a set of labels.
+func Validate(labels map[string]string) error {
+	if len(labels) > MaxLabels {
+		return fmt.Errorf("at most %d labels are allowed", MaxLabels)
+	}
+	for k, v := range labels {
+		if err := ValidateKey(k); err != nil {
+			return err
+		}
+		if len(v) > MaxValueLength {
+			return fmt.Errorf("value of label %q is longer than %d characters", k, MaxValueLength)
+		}
+	}
+	return nil
+}
+
+// Operator is the comparison of a selector requirement.
+type Operator string
+
+const (
+	Equals       Operator = "="
+	NotEquals    Operator = "!="
+	In           Operator = "in"
+	NotIn        Operator = "notin"
+	Exists       Operator = "exists"
+	DoesNotExist Operator = "!"
+)
+
+// Requirement is one condition of a selector.
+type Requirement struct {
+	Key      string
+	Operator Operator
+	Values   []string // one value for = and !=, none for exists and !
+}
+
+// Matches reports whether labels satisfy the requirement.
+func (r Requirement) Matches(labels map[string]string) bool {
+	v, ok := labels[r.Key]
+	switch r.Operator {
+	case Equals:
+		return ok && v == r.Values[0]
+	case NotEquals:
+		return !ok || v != r.Values[0]
+	case In:
+		return ok && contains(r.Values, v)
+	case NotIn:
+		return !ok || !contains(r.Values, v)
+	case Exists:
+		return ok
+	case DoesNotExist:
+		return !ok
+	}
+	return false
+}
+
+// Selector is a set of requirements that must all hold. The empty selector
+// matches everything.
+type Selector []Requirement
+
+// Matches reports whether labels satisfy every requirement.
+func (s Selector) Matches(labels map[string]string) bool {
+	for _, r := range s {
+		if !r.Matches(labels) {
+			return false
+		}
+	}
+	return true
+}
+
+// Parse parses a selector such as "env=prod,tier in (web,api),!deprecated".
+func Parse(selector string) (Selector, error) {
+	var sel Selector
+	for _, part := range splitRequirements(selector) {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		r, err := parseRequirement(part)
+		if err != nil {
+			return nil, err
+		}
+		sel = append(sel, r)
+	}
+	return sel, nil
+}
+
+// splitRequirements splits a selector on the commas that are not inside a
+// value list.
+func splitRequirements(selector string) []string {
+	var parts []string
+	depth, start := 0, 0
+	for i, c := range selector {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				parts = append(parts, selector[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, selector[start:])
+}
+
+func parseRequirement(s string) (Requirement, error) {
+	if strings.HasPrefix(s, "!") && !strings.Contains(s, "=") {
+		key := strings.TrimSpace(s[1:])
+		return Requirement{Key: key, Operator: DoesNotExist}, ValidateKey(key)
+	}
+
+	if i := strings.Index(s, "!="); i >= 0 {
+		return keyValue(s[:i], NotEquals, s[i+2:])
+	}
+	if i := strings.Index(s, "=="); i >= 0 {
+		return keyValue(s[:i], Equals, s[i+2:])
+	}
+	if i := strings.Index(s, "="); i >= 0 {
+		return keyValue(s[:i], Equals, s[i+1:])
+	}
+
+	if m := setPattern.FindStringSubmatch(s); m != nil {
+		if err := ValidateKey(m[1]); err != nil {
+			return Requirement{}, err
+		}
+		var values []string
+		for _, v := range strings.Split(m[3], ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				values = append(values, v)
+			}
+		}
+		if len(values) == 0 {
+			return Requirement{}, fmt.Errorf("invalid selector %q: empty value list", s)
+		}
+		return Requirement{Key: m[1], Operator: Operator(strings.ToLower(m[2])), Values: values}, nil
+	}
+	if strings.ContainsAny(s, " \t()") {
+		return Requirement{}, fmt.Errorf("invalid selector %q", s)
+	}
+
+	return Requirement{Key: s, Operator: Exists}, ValidateKey(s)
+}
+
+func keyValue(key string, op Operator, value string) (Requirement, error) {
+	key = strings.TrimSpace(key)
+	if err := ValidateKey(key); err != nil {
+		return Requirement{}, err
+	}
+	return Requirement{Key: key, Operator: op, Values: []string{strings.TrimSpace(value)}}, nil
+}
+
+func contains(values []string, v string) bool {
+	for _, x := range values {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
@@ -12,20 +12,24 @@ import (
 
 	"github.com/teamvault/teamvault/internal/crypto"
 	"github.com/teamvault/teamvault/internal/db"
+	"github.com/teamvault/teamvault/internal/kek"
 )
 
 // Manager handles dynamic secret leases.
 type Manager struct {
 	database  *db.DB
 	cryptoSvc *crypto.EnvelopeCrypto
+	keks      *kek.Manager
 	stopCh    chan struct{}
 }
 
-// NewManager creates a new lease manager.
-func NewManager(database *db.DB, cryptoSvc *crypto.EnvelopeCrypto) *Manager {
+// NewManager creates a new lease manager. keks may be nil, in which case
+// project-scoped leases are wrapped by the master key directly.
+func NewManager(database *db.DB, cryptoSvc *crypto.EnvelopeCrypto, keks *kek.Manager) *Manager {
 	return &Manager{
 		database:  database,
 		cryptoSvc: cryptoSvc,
+		keks:      keks,
 		stopCh:    make(chan struct{}),
 	}
 }
@@ -50,6 +54,7 @@ type LeaseResponse struct {
 // LeaseInfo provides metadata about a lease (without secret data).
 type LeaseInfo struct {
 	ID         string     `json:"id"`
+	ProjectID  *string    `json:"project_id,omitempty"`
 	SecretPath string     `json:"secret_path"`
 	LeaseType  string     `json:"lease_type"`
 	IssuedTo   string     `json:"issued_to"`
@@ -59,7 +64,9 @@ type LeaseInfo struct {
 }
 
 // IssueDatabaseLease creates a mock temporary database credential with a TTL.
-func (m *Manager) IssueDatabaseLease(ctx context.Context, issuedTo string, ttlSeconds int, orgID *string) (*LeaseResponse, error) {
+// If projectID is set, the lease belongs to that project: its DEK is wrapped
+// by the project KEK and it is destroyed along with the project.
+func (m *Manager) IssueDatabaseLease(ctx context.Context, issuedTo string, ttlSeconds int, orgID, projectID *string) (*LeaseResponse, error) {
 	if ttlSeconds <= 0 {
 		ttlSeconds = 3600 // Default 1 hour
 	}
@@ -84,17 +91,23 @@ func (m *Manager) IssueDatabaseLease(ctx context.Context, issuedTo string, ttlSe
 		return nil, fmt.Errorf("marshaling credentials: %w", err)
 	}
 
-	// Encrypt the credentials
-	encrypted, err := m.cryptoSvc.Encrypt(credsJSON)
+	// Encrypt the credentials (leases are not secret versions, so no context)
+	var encrypted *crypto.EncryptedData
+	if projectID != nil && m.keks != nil {
+		encrypted, err = m.keks.Encrypt(ctx, *projectID, credsJSON, nil)
+	} else {
+		encrypted, err = m.cryptoSvc.Encrypt(credsJSON, nil)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("encrypting lease value: %w", err)
 	}
 
 	expiresAt := time.Now().Add(time.Duration(ttlSeconds) * time.Second)
 
-	lease, err := m.database.CreateLease(ctx, orgID, "dynamic/database",
+	lease, err := m.database.CreateLease(ctx, orgID, projectID, "dynamic/database",
 		"database", encrypted.Ciphertext, encrypted.EncryptedDEK,
-		encrypted.Nonce, encrypted.DEKNonce, issuedTo, expiresAt)
+		encrypted.Nonce, encrypted.DEKNonce, encrypted.MasterKeyVersion, encrypted.KEKVersion,
+		issuedTo, expiresAt)
 	if err != nil {
 		return nil, fmt.Errorf("creating lease: %w", err)
 	}
@@ -123,6 +136,7 @@ func (m *Manager) ListActiveLeases(ctx context.Context) ([]LeaseInfo, error) {
 	for _, l := range leases {
 		infos = append(infos, LeaseInfo{
 			ID:         l.ID,
+			ProjectID:  l.ProjectID,
 			SecretPath: l.SecretPath,
 			LeaseType:  l.LeaseType,
 			IssuedTo:   l.IssuedTo,
@@ -29,8 +29,8 @@ func NewEngine(database *db.DB) *Engine {
 type Request struct {
 	SubjectType string // "user", "service_account", or "agent"
 	SubjectID   string
-	Action      string // "read", "write", "delete", "list"
-	Resource    string // "project/path" format
+	Action      string // "read", "write", "delete", "list", or a transit operation ("encrypt", ...)
+	Resource    string // "project/path" format, or "transit/<key>"
 	IsAdmin     bool   // Admin users bypass policy checks
 
 	// IAM-specific fields
@@ -48,12 +48,25 @@ type RequestAttributes struct {
 	Team        string `json:"team,omitempty"`         // Team name
 	Role        string `json:"role,omitempty"`         // User/agent role
 	AgentName   string `json:"agent_name,omitempty"`   // Agent name (for PBAC subject matching)
+
+	// Labels of the secret being accessed, matched by "label.<key>" conditions
+	Labels map[string]string `json:"labels,omitempty"`
 }
 
 // Result represents the outcome of a policy evaluation.
 type Result struct {
 	Allowed bool
 	Reason  string
+	GrantID string // Set when a just-in-time access grant allowed the request
+}
+
+// defaultDenyReason is the reason given when no policy allows a request.
+const defaultDenyReason = "no matching allow policy (default deny)"
+
+// IsDefaultDeny reports whether the request was denied only because no
+// policy allowed it, rather than by a deny rule.
+func (r *Result) IsDefaultDeny() bool {
+	return !r.Allowed && r.Reason == defaultDenyReason
 }
 
 // PolicyDocument represents the JSON structure of an IAM policy document.
@@ -82,7 +95,7 @@ type PolicyRule struct {
 
 // PolicyCondition represents a condition that must be satisfied.
 type PolicyCondition struct {
-	Attribute string `json:"attribute"` // "environment", "mfa", "ip_cidr", "time_after", "time_before"
+	Attribute string `json:"attribute"` // "environment", "mfa", "ip_cidr", "team", "role", "label.<key>"
 	Operator  string `json:"operator"`  // "eq", "neq", "in", "not_in", "cidr_match"
 	Value     string `json:"value"`     // Expected value
 }
@@ -95,6 +108,7 @@ type PolicyCondition struct {
 //   - Then evaluate IAM policies (RBAC, ABAC, PBAC)
 //   - If any "deny" matches, deny
 //   - If any "allow" matches and no "deny" matches, allow
+//   - If nothing matches, an active access grant of the user may allow
 //   - Default: deny
 func (e *Engine) Evaluate(ctx context.Context, req Request) (*Result, error) {
 	// Admins bypass all policy checks
@@ -127,11 +141,35 @@ func (e *Engine) Evaluate(ctx context.Context, req Request) (*Result, error) {
 	}
 
 	// Fall back to legacy result
-	if legacyResult != nil {
+	if legacyResult != nil && !legacyResult.IsDefaultDeny() {
 		return legacyResult, nil
 	}
 
-	return &Result{Allowed: false, Reason: "no matching allow policy (default deny)"}, nil
+	// Phase 3: Just-in-time access grants fill in where no policy applies
+	return e.evaluateGrants(ctx, req)
+}
+
+// evaluateGrants allows a user's request covered by one of their active
+// access grants. Grants only add access: Evaluate consults them after deny
+// policies had their say.
+func (e *Engine) evaluateGrants(ctx context.Context, req Request) (*Result, error) {
+	if req.SubjectType != "user" || req.Resource == "" {
+		return &Result{Allowed: false, Reason: defaultDenyReason}, nil
+	}
+	grants, err := e.database.ActiveAccessGrants(ctx, req.SubjectID)
+	if err != nil {
+		return nil, err
+	}
+	for _, g := range grants {
+		if matchAction(g.Actions, req.Action) && matchResource(g.ResourcePattern, req.Resource) {
+			reason := "allowed by access grant " + g.ID
+			if g.BreakGlass {
+				reason = "allowed by break-glass grant " + g.ID
+			}
+			return &Result{Allowed: true, Reason: reason, GrantID: g.ID}, nil
+		}
+	}
+	return &Result{Allowed: false, Reason: defaultDenyReason}, nil
 }
 
 // evaluateLegacy evaluates legacy (v1) policies.
@@ -165,7 +203,7 @@ func (e *Engine) evaluateLegacy(ctx context.Context, req Request) (*Result, erro
 		return &Result{Allowed: true, Reason: "allowed by legacy policy"}, nil
 	}
 
-	return &Result{Allowed: false, Reason: "no matching allow policy (default deny)"}, nil
+	return &Result{Allowed: false, Reason: defaultDenyReason}, nil
 }
 
 // evaluateIAM evaluates IAM policies (RBAC, ABAC, PBAC) for the given org.
@@ -410,7 +448,11 @@ func evaluateCondition(cond PolicyCondition, attrs *RequestAttributes) bool {
 	case "role":
 		attrValue = attrs.Role
 	default:
-		return false // Unknown attribute
+		key, ok := strings.CutPrefix(cond.Attribute, "label.")
+		if !ok {
+			return false // Unknown attribute
+		}
+		attrValue = attrs.Labels[key] // A missing label matches as ""
 	}
 
 	switch cond.Operator {
@@ -473,6 +515,12 @@ func matchAction(policyActions []string, requestedAction string) bool {
 	return false
 }
 
+// MatchResource reports whether a resource path matches a glob pattern the
+// way policy resource patterns are matched, for other path-scoped rules.
+func MatchResource(pattern, resource string) bool {
+	return matchResource(pattern, resource)
+}
+
 // matchResource checks if the requested resource matches the policy's resource pattern.
 // Supports glob patterns like "myproject/*", "services/*/staging/*", etc.
 func matchResource(pattern, resource string) bool {
@@ -0,0 +1,144 @@
+// Package refs resolves references between secrets.
+//
+// A secret value may embed the value of another secret as
+// ${ref:project/path}, or one field of a JSON secret as
+// ${ref:project/path#field}. Referenced values may contain references
+// themselves; they are resolved recursively, up to MaxDepth levels, and
+// cycles are an error. $${ref:...} is left in place as a literal ${ref:...}.
+package refs
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/teamvault/teamvault/internal/jsonfield"
+)
+
+// MaxDepth is how deeply references may be nested.
+const MaxDepth = 8
+
+const open = "${ref:"
+
+// ErrCycle is returned when a secret refers back to itself, directly or
+// through other secrets.
+var ErrCycle = errors.New("reference cycle")
+
+// Ref names a referenced secret, or one field of it.
+type Ref struct {
+	Project string
+	Path    string
+	Field   string
+}
+
+// String returns the reference as written: "project/path" or
+// "project/path#field".
+func (r Ref) String() string {
+	s := r.Project + "/" + r.Path
+	if r.Field != "" {
+		s += "#" + r.Field
+	}
+	return s
+}
+
+// ParseRef parses "project/path" or "project/path#field".
+func ParseRef(s string) (Ref, error) {
+	project, rest, ok := strings.Cut(s, "/")
+	path, field := jsonfield.Split(rest)
+	if !ok || project == "" || path == "" {
+		return Ref{}, fmt.Errorf("invalid reference %q: expected project/path", s)
+	}
+	if field != "" {
+		if err := jsonfield.Validate(field); err != nil {
+			return Ref{}, fmt.Errorf("invalid reference %q: %w", s, err)
+		}
+	}
+	return Ref{Project: project, Path: path, Field: field}, nil
+}
+
+// Contains reports whether a value has references to resolve.
+func Contains(value string) bool {
+	return strings.Contains(value, open)
+}
+
+// Parse returns the references in a value, in order of appearance.
+func Parse(value string) ([]Ref, error) {
+	var found []Ref
+	_, err := scan(value, func(r Ref) (string, error) {
+		found = append(found, r)
+		return "", nil
+	})
+	return found, err
+}
+
+// Lookup returns the value a reference stands for, before its own references
+// are resolved: the referenced secret's latest value, or the field of it.
+type Lookup func(r Ref) (string, error)
+
+// Render resolves the references in value, the value of the secret self.
+// Errors from lookup are wrapped with the reference they occurred at.
+func Render(self Ref, value string, lookup Lookup) (string, error) {
+	return render(value, lookup, []Ref{self})
+}
+
+func render(value string, lookup Lookup, chain []Ref) (string, error) {
+	return scan(value, func(r Ref) (string, error) {
+		for _, c := range chain {
+			// A secret may refer to its own fields, as long as no field is
+			// needed to render itself
+			if c.Project == r.Project && c.Path == r.Path && (r.Field == "" || r.Field == c.Field) {
+				return "", fmt.Errorf("%w: %s", ErrCycle, formatChain(append(chain, r)))
+			}
+		}
+		if len(chain) >= MaxDepth {
+			return "", fmt.Errorf("references nested more than %d deep at %s", MaxDepth, r)
+		}
+		v, err := lookup(r)
+		if err != nil {
+			return "", fmt.Errorf("resolving ${ref:%s}: %w", r, err)
+		}
+		return render(v, lookup, append(chain[:len(chain):len(chain)], r))
+	})
+}
+
+// scan copies value, replacing each reference with what replace returns.
+func scan(value string, replace func(Ref) (string, error)) (string, error) {
+	var b strings.Builder
+	for {
+		i := strings.Index(value, open)
+		if i < 0 {
+			b.WriteString(value)
+			return b.String(), nil
+		}
+		if i > 0 && value[i-1] == '$' {
+			b.WriteString(value[:i-1] + open)
+			value = value[i+len(open):]
+			continue
+		}
+		b.WriteString(value[:i])
+		value = value[i+len(open):]
+
+		end := strings.IndexByte(value, '}')
+		if end < 0 {
+			return "", fmt.Errorf("unterminated reference (missing '}')")
+		}
+		r, err := ParseRef(value[:end])
+		if err != nil {
+			return "", err
+		}
+		v, err := replace(r)
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(v)
+		value = value[end+1:]
+	}
+}
+
+func formatChain(chain []Ref) string {
+	parts := make([]string, len(chain))
+	for i, r := range chain {
+		parts[i] = r.String()
+	}
+	return strings.Join(parts, " -> ")
+}
@@ -0,0 +1,196 @@
+package refs
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/teamvault/teamvault/internal/jsonfield"
+)
+
+// mapLookup looks references up in a map of "project/path" to value.
+func mapLookup(secrets map[string]string) Lookup {
+	return func(r Ref) (string, error) {
+		v, ok := secrets[r.Project+"/"+r.Path]
+		if !ok {
+			return "", errors.New("secret not found")
+		}
+		if r.Field != "" {
+			return jsonfield.Get([]byte(v), r.Field)
+		}
+		return v, nil
+	}
+}
+
+func TestParseRef(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Ref
+		wantErr bool
+	}{
+		{"app/db/password", Ref{Project: "app", Path: "db/password"}, false},
+		{"app/db/config#replica.password", Ref{Project: "app", Path: "db/config", Field: "replica.password"}, false},
+		{"app", Ref{}, true},
+		{"/db/password", Ref{}, true},
+		{"app/", Ref{}, true},
+		{"app/#field", Ref{}, true},
+		{"app/db/config#replica..password", Ref{}, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseRef(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseRef(%q) error = %v, want error %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseRef(%q) = %+v, want %+v", tt.in, got, tt.want)
+		}
+		if !tt.wantErr && got.String() != tt.in {
+			t.Errorf("ParseRef(%q).String() = %q", tt.in, got.String())
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    []Ref
+		wantErr bool
+	}{
+		{"no references", "plain value", nil, false},
+		{"two references", "postgres://${ref:app/db/user}:${ref:app/db/config#password}@host",
+			[]Ref{{Project: "app", Path: "db/user"}, {Project: "app", Path: "db/config", Field: "password"}}, false},
+		{"escaped reference", "literal $${ref:app/db/user}", nil, false},
+		{"unterminated", "x ${ref:app/db/user", nil, true},
+		{"malformed", "x ${ref:nopath}", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse error = %v, want error %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRender(t *testing.T) {
+	secrets := map[string]string{
+		"app/db/user":     "admin",
+		"app/db/password": "pw",
+		"app/db/config":   `{"host":"db1","port":5432,"dsn":"${ref:app/db/config#host}:${ref:app/db/config#port}"}`,
+		"app/db/url":      "postgres://${ref:app/db/user}:${ref:app/db/password}@${ref:app/db/config#host}",
+		"app/api/env":     "DB=${ref:app/db/url}",
+		"other/shared":    "from another project",
+	}
+	lookup := mapLookup(secrets)
+
+	tests := []struct {
+		name  string
+		value string
+		want  string
+	}{
+		{"no references", "plain", "plain"},
+		{"whole secret", "${ref:app/db/user}", "admin"},
+		{"field", "${ref:app/db/config#port}", "5432"},
+		{"other project", "x=${ref:other/shared}", "x=from another project"},
+		{"nested", "${ref:app/api/env}", "DB=postgres://admin:pw@db1"},
+		{"escaped", "$${ref:app/db/user} is ${ref:app/db/user}", "${ref:app/db/user} is admin"},
+		{"field referring to sibling fields", "${ref:app/db/config#dsn}", "db1:5432"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Render(Ref{Project: "app", Path: "self"}, tt.value, lookup)
+			if err != nil {
+				t.Fatalf("Render: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Render = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderCycles(t *testing.T) {
+	secrets := map[string]string{
+		"app/a":    "${ref:app/b}",
+		"app/b":    "${ref:app/c}",
+		"app/c":    "${ref:app/a}",
+		"app/self": "x${ref:app/self}",
+		"app/doc":  `{"a":"${ref:app/doc#b}","b":"${ref:app/doc#a}"}`,
+	}
+	lookup := mapLookup(secrets)
+
+	tests := []struct {
+		name  string
+		self  Ref
+		value string
+	}{
+		{"direct", Ref{Project: "app", Path: "self"}, secrets["app/self"]},
+		{"through other secrets", Ref{Project: "app", Path: "a"}, secrets["app/a"]},
+		{"reached from elsewhere", Ref{Project: "app", Path: "x"}, "${ref:app/b}"},
+		{"between fields", Ref{Project: "app", Path: "x"}, "${ref:app/doc#a}"},
+		{"whole secret from its field", Ref{Project: "app", Path: "doc", Field: "a"}, "${ref:app/doc}"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Render(tt.self, tt.value, lookup)
+			if !errors.Is(err, ErrCycle) {
+				t.Errorf("Render error = %v, want %v", err, ErrCycle)
+			}
+		})
+	}
+}
+
+func TestRenderDepth(t *testing.T) {
+	// app/s0 -> app/s1 -> ... -> app/s<n>, which is a plain value. With the
+	// rendered secret itself, n links make n+2 levels.
+	chain := func(n int) map[string]string {
+		secrets := map[string]string{fmt.Sprintf("app/s%d", n): "end"}
+		for i := 0; i < n; i++ {
+			secrets[fmt.Sprintf("app/s%d", i)] = fmt.Sprintf("${ref:app/s%d}", i+1)
+		}
+		return secrets
+	}
+
+	tests := []struct {
+		name    string
+		links   int
+		wantErr bool
+	}{
+		{"one level", 1, false},
+		{"at the limit", MaxDepth - 2, false},
+		{"past the limit", MaxDepth - 1, true},
+		{"far past the limit", 3 * MaxDepth, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Render(Ref{Project: "app", Path: "root"}, "${ref:app/s0}", mapLookup(chain(tt.links)))
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "nested more than") {
+					t.Errorf("Render error = %v, want a depth error", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Render: %v", err)
+			}
+			if got != "end" {
+				t.Errorf("Render = %q, want %q", got, "end")
+			}
+		})
+	}
+}
+
+func TestRenderLookupError(t *testing.T) {
+	_, err := Render(Ref{Project: "app", Path: "self"}, "${ref:app/missing}", mapLookup(nil))
+	if err == nil || !strings.Contains(err.Error(), "${ref:app/missing}") {
+		t.Errorf("Render error = %v, want it to name the reference", err)
+	}
+}
@@ -0,0 +1,104 @@
+package retention
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/teamvault/teamvault/internal/audit"
+	"github.com/teamvault/teamvault/internal/db"
+	"github.com/teamvault/teamvault/internal/webhooks"
+)
+
+// Expirer expires change requests that were not approved in time, wiping
+// their proposed values. Reviews also expire a request they find stale; the
+// background loop catches the ones nobody looks at.
+type Expirer struct {
+	database *db.DB
+	auditSvc *audit.Logger
+	webhooks *webhooks.WebhookManager // nil: no notifications
+	interval time.Duration
+	stopCh   chan struct{}
+}
+
+// NewExpirer creates a change request expirer.
+func NewExpirer(database *db.DB, auditSvc *audit.Logger, webhookManager *webhooks.WebhookManager) *Expirer {
+	return &Expirer{
+		database: database,
+		auditSvc: auditSvc,
+		webhooks: webhookManager,
+		interval: time.Hour,
+		stopCh:   make(chan struct{}),
+	}
+}
+
+// Start runs the expiry loop until ctx is cancelled or Stop is called.
+func (e *Expirer) Start(ctx context.Context) {
+	log.Printf("Change request expirer started (interval: %s)", e.interval)
+
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := e.RunOnce(ctx); err != nil {
+			log.Printf("Change request expiry error: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			log.Println("Change request expirer stopped (context cancelled)")
+			return
+		case <-e.stopCh:
+			log.Println("Change request expirer stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Stop signals the expiry loop to stop.
+func (e *Expirer) Stop() {
+	close(e.stopCh)
+}
+
+// RunOnce expires every pending change request past its expiry, audits it
+// and notifies its watchers. It returns the number expired.
+func (e *Expirer) RunOnce(ctx context.Context) (int, error) {
+	expired, err := e.database.ExpireChangeRequests(ctx)
+	if err != nil {
+		return 0, err
+	}
+	for i := range expired {
+		cr := &expired[i]
+		metadata, _ := json.Marshal(map[string]interface{}{
+			"change_request": cr.ID,
+			"requested_by":   cr.RequestedBy,
+			"approvals":      cr.Approvals,
+		})
+		e.auditSvc.Log(ctx, audit.Event{
+			ActorType: "system",
+			ActorID:   audit.SystemActorID,
+			Action:    "secret.change.expire",
+			Resource:  cr.ProjectName + "/" + cr.Path,
+			Outcome:   "success",
+			Metadata:  metadata,
+		})
+
+		if e.webhooks == nil {
+			continue
+		}
+		watchers, err := e.database.ChangeRequestWatchers(ctx, cr)
+		if err != nil {
+			log.Printf("Change request expiry: notifying about %s: %v", cr.ID, err)
+			continue
+		}
+		for _, id := range watchers {
+			e.webhooks.Fire(ctx, id, webhooks.EventChangeRequestExpired, cr)
+		}
+	}
+	if len(expired) > 0 {
+		log.Printf("Change request expiry: expired %d requests", len(expired))
+	}
+	return len(expired), nil
+}
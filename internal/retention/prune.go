@@ -0,0 +1,120 @@
+package retention
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/teamvault/teamvault/internal/audit"
+	"github.com/teamvault/teamvault/internal/db"
+)
+
+// Pruner destroys secret versions beyond their project's or secret's
+// max_versions and max_version_age limits. Writes through the API prune the
+// written secret immediately; the background loop catches versions that age
+// out and secrets written by other paths, such as rotation.
+type Pruner struct {
+	database  *db.DB
+	auditSvc  *audit.Logger
+	interval  time.Duration
+	batchSize int
+	stopCh    chan struct{}
+}
+
+// NewPruner creates a version pruner.
+func NewPruner(database *db.DB, auditSvc *audit.Logger) *Pruner {
+	return &Pruner{
+		database:  database,
+		auditSvc:  auditSvc,
+		interval:  time.Hour,
+		batchSize: 100,
+		stopCh:    make(chan struct{}),
+	}
+}
+
+// Start runs the prune loop until ctx is cancelled or Stop is called.
+func (p *Pruner) Start(ctx context.Context) {
+	log.Printf("Secret version pruner started (interval: %s)", p.interval)
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := p.RunOnce(ctx); err != nil {
+			log.Printf("Secret version prune error: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			log.Println("Secret version pruner stopped (context cancelled)")
+			return
+		case <-p.stopCh:
+			log.Println("Secret version pruner stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Stop signals the prune loop to stop.
+func (p *Pruner) Stop() {
+	close(p.stopCh)
+}
+
+// RunOnce prunes every secret with version limits, in batches. It returns the
+// number of versions destroyed.
+func (p *Pruner) RunOnce(ctx context.Context) (int, error) {
+	total := 0
+	afterID := ""
+	for {
+		secrets, err := p.database.ListPrunableSecrets(ctx, afterID, p.batchSize)
+		if err != nil {
+			return total, err
+		}
+		for _, s := range secrets {
+			pruned, err := p.PruneSecret(ctx, s)
+			if err != nil {
+				return total, err
+			}
+			total += len(pruned)
+		}
+		if len(secrets) < p.batchSize {
+			break
+		}
+		afterID = secrets[len(secrets)-1].ID
+	}
+	if total > 0 {
+		log.Printf("Secret version prune: destroyed %d versions", total)
+	}
+	return total, nil
+}
+
+// PruneSecret destroys the versions of one secret outside its limits and
+// audits the prune. It returns the versions destroyed.
+func (p *Pruner) PruneSecret(ctx context.Context, s db.PrunableSecret) ([]int, error) {
+	pruned, err := p.database.PruneSecretVersions(ctx, s.ID, s.Limits)
+	if err != nil || len(pruned) == 0 {
+		return nil, err
+	}
+
+	meta := map[string]interface{}{
+		"versions": pruned,
+	}
+	if s.Limits.MaxVersions > 0 {
+		meta["max_versions"] = s.Limits.MaxVersions
+	}
+	if s.Limits.MaxAge > 0 {
+		meta["max_version_age"] = s.Limits.MaxAge.String()
+	}
+	metadata, _ := json.Marshal(meta)
+	p.auditSvc.Log(ctx, audit.Event{
+		ActorType: "system",
+		ActorID:   audit.SystemActorID,
+		Action:    "secret.prune",
+		Resource:  s.ProjectName + "/" + s.Path,
+		Outcome:   "success",
+		Metadata:  metadata,
+	})
+	return pruned, nil
+}
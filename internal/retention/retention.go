@@ -0,0 +1,120 @@
+// Package retention permanently removes soft-deleted secrets once they have
+// been deleted for longer than the configured retention window, and destroys
+// secret versions that fall outside their version limits.
+package retention
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/teamvault/teamvault/internal/audit"
+	"github.com/teamvault/teamvault/internal/db"
+)
+
+// Purger runs in the background and purges expired deleted secrets.
+type Purger struct {
+	database  *db.DB
+	auditSvc  *audit.Logger
+	retention time.Duration
+	interval  time.Duration
+	batchSize int
+	stopCh    chan struct{}
+}
+
+// NewPurger creates a purger for secrets deleted longer than retention ago.
+// A retention of 0 disables purging.
+func NewPurger(database *db.DB, auditSvc *audit.Logger, retention time.Duration) *Purger {
+	return &Purger{
+		database:  database,
+		auditSvc:  auditSvc,
+		retention: retention,
+		interval:  time.Hour,
+		batchSize: 100,
+		stopCh:    make(chan struct{}),
+	}
+}
+
+// Retention returns how long deleted secrets are kept, or 0 if they are kept
+// forever.
+func (p *Purger) Retention() time.Duration {
+	return p.retention
+}
+
+// Start runs the purge loop until ctx is cancelled or Stop is called.
+func (p *Purger) Start(ctx context.Context) {
+	if p.retention <= 0 {
+		log.Println("Deleted secret purge disabled (retention 0)")
+		return
+	}
+	log.Printf("Deleted secret purge started (retention: %s, interval: %s)", p.retention, p.interval)
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := p.RunOnce(ctx); err != nil {
+			log.Printf("Deleted secret purge error: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			log.Println("Deleted secret purge stopped (context cancelled)")
+			return
+		case <-p.stopCh:
+			log.Println("Deleted secret purge stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Stop signals the purge loop to stop.
+func (p *Purger) Stop() {
+	close(p.stopCh)
+}
+
+// RunOnce purges every secret deleted before the retention window, in
+// batches, and audits each purge. It returns the number of secrets purged.
+func (p *Purger) RunOnce(ctx context.Context) (int, error) {
+	cutoff := time.Now().Add(-p.retention)
+	total := 0
+	for {
+		purged, err := p.database.PurgeDeletedSecrets(ctx, cutoff, p.batchSize)
+		if err != nil {
+			return total, err
+		}
+		for _, s := range purged {
+			metadata, _ := json.Marshal(map[string]interface{}{
+				"deleted_at": s.DeletedAt,
+				"versions":   s.Versions,
+			})
+			p.auditSvc.Log(ctx, audit.Event{
+				ActorType: "system",
+				ActorID:   audit.SystemActorID,
+				Action:    "secret.purge",
+				Resource:  s.ProjectName + "/" + s.Path,
+				Outcome:   "success",
+				Metadata:  metadata,
+			})
+		}
+		total += len(purged)
+		if len(purged) < p.batchSize {
+			break
+		}
+	}
+	if total > 0 {
+		log.Printf("Deleted secret purge: purged %d secrets", total)
+	}
+
+	// Aliases left behind by moves and wrapping tokens are not secrets;
+	// expired ones are simply dropped
+	if _, err := p.database.DeleteExpiredSecretAliases(ctx); err != nil {
+		return total, err
+	}
+	if _, err := p.database.DeleteExpiredWrappingTokens(ctx); err != nil {
+		return total, err
+	}
+	return total, nil
+}
@@ -0,0 +1,273 @@
+// Package rewrap re-encrypts stored DEKs under the newest master key after a
+// master key rotation. Only the wrapped DEKs change; secret, lease and
+// transit key ciphertexts are never decrypted or rewritten.
+package rewrap
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/teamvault/teamvault/internal/audit"
+	"github.com/teamvault/teamvault/internal/crypto"
+	"github.com/teamvault/teamvault/internal/db"
+)
+
+// ErrAlreadyRunning is returned by Start when a re-wrap is in progress.
+var ErrAlreadyRunning = errors.New("re-wrap job already running")
+
+// Job states.
+const (
+	StateIdle      = "idle"
+	StateRunning   = "running"
+	StateCompleted = "completed"
+	StateFailed    = "failed"
+	StateCancelled = "cancelled"
+)
+
+// Progress reports the state of the current or most recent re-wrap run.
+type Progress struct {
+	State         string     `json:"state"`
+	TargetVersion int        `json:"target_version,omitempty"`
+	Total         int64      `json:"total"`
+	Rewrapped     int64      `json:"rewrapped"`
+	Failed        int64      `json:"failed"`
+	StartedBy     string     `json:"started_by,omitempty"`
+	StartedAt     *time.Time `json:"started_at,omitempty"`
+	FinishedAt    *time.Time `json:"finished_at,omitempty"`
+	Error         string     `json:"error,omitempty"`
+}
+
+// Job re-wraps every encrypted_dek in secret_versions, leases and
+// transit_key_versions, and every encrypted_kek in project_keys, that is not
+// yet wrapped by the current master key. At most one run is active at a time.
+type Job struct {
+	database  *db.DB
+	cryptoSvc *crypto.EnvelopeCrypto
+	auditSvc  *audit.Logger
+	batchSize int
+
+	mu       sync.Mutex
+	progress Progress
+	cancel   context.CancelFunc
+}
+
+// NewJob creates a new re-wrap job.
+func NewJob(database *db.DB, cryptoSvc *crypto.EnvelopeCrypto, auditSvc *audit.Logger) *Job {
+	return &Job{
+		database:  database,
+		cryptoSvc: cryptoSvc,
+		auditSvc:  auditSvc,
+		batchSize: 500,
+		progress:  Progress{State: StateIdle},
+	}
+}
+
+// Status returns a snapshot of the job's progress.
+func (j *Job) Status() Progress {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.progress
+}
+
+// PendingCounts is the number of DEKs (and project KEKs) per table still
+// wrapped by an older master key. DEKs wrapped by a project KEK are not
+// counted; re-wrapping the project KEK covers them.
+type PendingCounts struct {
+	SecretVersions     int64 `json:"secret_versions"`
+	Leases             int64 `json:"leases"`
+	TransitKeyVersions int64 `json:"transit_key_versions"`
+	ProjectKeys        int64 `json:"project_keys"`
+	WrappingTokens     int64 `json:"wrapping_tokens"`
+	ChangeRequests     int64 `json:"change_requests"`
+}
+
+// Total returns the number of stale DEKs across all tables.
+func (p PendingCounts) Total() int64 {
+	return p.SecretVersions + p.Leases + p.TransitKeyVersions + p.ProjectKeys + p.WrappingTokens + p.ChangeRequests
+}
+
+// dekTables lists every table whose DEKs are re-wrapped, in run order.
+var dekTables = []string{db.DEKTableSecretVersions, db.DEKTableLeases, db.DEKTableTransitKeyVersions, db.DEKTableWrappingTokens, db.DEKTableChangeRequests, db.DEKTableProjectKeys}
+
+// Pending returns the number of DEKs still wrapped by an older master key.
+func (j *Job) Pending(ctx context.Context) (PendingCounts, error) {
+	current := j.cryptoSvc.CurrentKeyVersion()
+	var p PendingCounts
+	counts := map[string]*int64{
+		db.DEKTableSecretVersions:     &p.SecretVersions,
+		db.DEKTableLeases:             &p.Leases,
+		db.DEKTableTransitKeyVersions: &p.TransitKeyVersions,
+		db.DEKTableProjectKeys:        &p.ProjectKeys,
+		db.DEKTableWrappingTokens:     &p.WrappingTokens,
+		db.DEKTableChangeRequests:     &p.ChangeRequests,
+	}
+	for _, table := range dekTables {
+		n, err := j.database.CountStaleDEKs(ctx, table, current)
+		if err != nil {
+			return PendingCounts{}, err
+		}
+		*counts[table] = n
+	}
+	return p, nil
+}
+
+// Start launches a re-wrap run in the background on behalf of the given actor.
+// The run is detached from ctx (which is typically an HTTP request context);
+// use Stop to cancel it.
+func (j *Job) Start(ctx context.Context, actorType, actorID, ip string) (Progress, error) {
+	j.mu.Lock()
+	if j.progress.State == StateRunning {
+		p := j.progress
+		j.mu.Unlock()
+		return p, ErrAlreadyRunning
+	}
+
+	pending, err := j.Pending(ctx)
+	if err != nil {
+		j.mu.Unlock()
+		return Progress{}, fmt.Errorf("counting pending DEKs: %w", err)
+	}
+
+	now := time.Now().UTC()
+	runCtx, cancel := context.WithCancel(context.Background())
+	j.cancel = cancel
+	j.progress = Progress{
+		State:         StateRunning,
+		TargetVersion: j.cryptoSvc.CurrentKeyVersion(),
+		Total:         pending.Total(),
+		StartedBy:     actorID,
+		StartedAt:     &now,
+	}
+	p := j.progress
+	j.mu.Unlock()
+
+	j.audit(ctx, actorType, actorID, ip, "started", p)
+
+	go j.run(runCtx, actorType, actorID, ip)
+	return p, nil
+}
+
+// Stop cancels a running re-wrap. Rows already re-wrapped stay re-wrapped.
+func (j *Job) Stop() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.cancel != nil {
+		j.cancel()
+	}
+}
+
+// run processes every DEK table and records the final outcome.
+func (j *Job) run(ctx context.Context, actorType, actorID, ip string) {
+	target := j.cryptoSvc.CurrentKeyVersion()
+	log.Printf("Re-wrap: started (target master key v%d)", target)
+
+	var runErr error
+	for _, table := range dekTables {
+		if runErr = j.rewrapTable(ctx, table, target); runErr != nil {
+			break
+		}
+	}
+
+	now := time.Now().UTC()
+	j.mu.Lock()
+	j.progress.FinishedAt = &now
+	j.cancel = nil
+	switch {
+	case errors.Is(runErr, context.Canceled):
+		j.progress.State = StateCancelled
+	case runErr != nil:
+		j.progress.State = StateFailed
+		j.progress.Error = runErr.Error()
+	case j.progress.Failed > 0:
+		j.progress.State = StateFailed
+		j.progress.Error = "some rows could not be re-wrapped"
+	default:
+		j.progress.State = StateCompleted
+	}
+	p := j.progress
+	j.mu.Unlock()
+
+	log.Printf("Re-wrap: %s (%d re-wrapped, %d failed of %d)", p.State, p.Rewrapped, p.Failed, p.Total)
+
+	outcome := "success"
+	if p.State != StateCompleted {
+		outcome = "error"
+	}
+	// The request context is gone by now; audit with a fresh one.
+	j.audit(context.Background(), actorType, actorID, ip, outcome, p)
+}
+
+// rewrapTable re-wraps all stale DEKs of one table in batches.
+func (j *Job) rewrapTable(ctx context.Context, table string, target int) error {
+	afterID := ""
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		batch, err := j.database.ListStaleDEKs(ctx, table, target, afterID, j.batchSize)
+		if err != nil {
+			return err
+		}
+		if len(batch) == 0 {
+			return nil
+		}
+
+		for _, row := range batch {
+			afterID = row.ID
+			if err := j.rewrapRow(ctx, table, row); err != nil {
+				log.Printf("Re-wrap: %s %s: %v", table, row.ID, err)
+				j.mu.Lock()
+				j.progress.Failed++
+				j.mu.Unlock()
+				continue
+			}
+			j.mu.Lock()
+			j.progress.Rewrapped++
+			j.mu.Unlock()
+		}
+	}
+}
+
+// rewrapRow re-wraps a single DEK and stores it.
+func (j *Job) rewrapRow(ctx context.Context, table string, row db.WrappedDEK) error {
+	rewrapped, err := j.cryptoSvc.RewrapDEK(&crypto.EncryptedData{
+		EncryptedDEK:     row.EncryptedDEK,
+		DEKNonce:         row.DEKNonce,
+		MasterKeyVersion: row.MasterKeyVersion,
+	})
+	if err != nil {
+		return err
+	}
+	return j.database.UpdateWrappedDEK(ctx, table, row.ID,
+		rewrapped.EncryptedDEK, rewrapped.DEKNonce,
+		row.MasterKeyVersion, rewrapped.MasterKeyVersion)
+}
+
+// audit records a crypto.rewrap event (NEVER includes key material).
+func (j *Job) audit(ctx context.Context, actorType, actorID, ip, outcome string, p Progress) {
+	if j.auditSvc == nil {
+		return
+	}
+	meta, _ := json.Marshal(map[string]interface{}{
+		"state":          p.State,
+		"target_version": p.TargetVersion,
+		"total":          p.Total,
+		"rewrapped":      p.Rewrapped,
+		"failed":         p.Failed,
+	})
+	j.auditSvc.Log(ctx, audit.Event{
+		ActorType: actorType,
+		ActorID:   actorID,
+		Action:    "crypto.rewrap",
+		Resource:  "sys/master-key",
+		Outcome:   outcome,
+		IP:        ip,
+		Metadata:  meta,
+	})
+}
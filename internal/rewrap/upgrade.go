@@ -0,0 +1,111 @@
+package rewrap
+
+import (
+	"context"
+	"log"
+
+	"github.com/teamvault/teamvault/internal/crypto"
+	"github.com/teamvault/teamvault/internal/db"
+	"github.com/teamvault/teamvault/internal/kek"
+)
+
+// UpgradeResult summarizes a ciphertext format upgrade run.
+type UpgradeResult struct {
+	Total    int64
+	Upgraded int64
+	Failed   int64
+}
+
+// UpgradeCiphertexts re-encrypts every secret version still stored in
+// crypto.FormatV1 so that it is bound to its project, secret and version via
+// associated data. Each row gets a fresh DEK wrapped by its project's active
+// KEK, or by the current master key if keks is nil. Rows are processed in id
+// order; failures are logged and skipped.
+func UpgradeCiphertexts(ctx context.Context, database *db.DB, cryptoSvc *crypto.EnvelopeCrypto, keks *kek.Manager, batchSize int) (UpgradeResult, error) {
+	var result UpgradeResult
+	if batchSize <= 0 {
+		batchSize = 500
+	}
+
+	total, err := database.CountLegacySecretVersions(ctx)
+	if err != nil {
+		return result, err
+	}
+	result.Total = total
+
+	afterID := ""
+	for {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+
+		batch, err := database.ListLegacySecretVersions(ctx, afterID, batchSize)
+		if err != nil {
+			return result, err
+		}
+		if len(batch) == 0 {
+			return result, nil
+		}
+
+		for _, row := range batch {
+			afterID = row.ID
+			if err := upgradeRow(ctx, database, cryptoSvc, keks, row); err != nil {
+				log.Printf("Ciphertext upgrade: secret version %s: %v", row.ID, err)
+				result.Failed++
+				continue
+			}
+			result.Upgraded++
+		}
+		log.Printf("Ciphertext upgrade: %d/%d upgraded, %d failed", result.Upgraded, result.Total, result.Failed)
+	}
+}
+
+// upgradeRow decrypts a legacy row and stores it re-encrypted with context.
+func upgradeRow(ctx context.Context, database *db.DB, cryptoSvc *crypto.EnvelopeCrypto, keks *kek.Manager, row db.LegacySecretVersion) error {
+	data := &crypto.EncryptedData{
+		Ciphertext:       row.Ciphertext,
+		Nonce:            row.Nonce,
+		EncryptedDEK:     row.EncryptedDEK,
+		DEKNonce:         row.DEKNonce,
+		MasterKeyVersion: row.MasterKeyVersion,
+		KEKVersion:       row.KEKVersion,
+		Format:           crypto.FormatV1,
+	}
+	ectx := &crypto.EncryptionContext{
+		ProjectID: row.ProjectID,
+		SecretID:  row.SecretID,
+		Version:   row.Version,
+	}
+
+	var plaintext []byte
+	var err error
+	if keks != nil {
+		plaintext, err = keks.Decrypt(ctx, row.ProjectID, data, nil)
+	} else {
+		plaintext, err = cryptoSvc.Decrypt(data, nil)
+	}
+	if err != nil {
+		return err
+	}
+
+	var encrypted *crypto.EncryptedData
+	if keks != nil {
+		encrypted, err = keks.Encrypt(ctx, row.ProjectID, plaintext, ectx)
+	} else {
+		encrypted, err = cryptoSvc.Encrypt(plaintext, ectx)
+	}
+
+	// Zero out plaintext from memory
+	for i := range plaintext {
+		plaintext[i] = 0
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return database.UpgradeSecretVersionCiphertext(ctx, row.ID,
+		encrypted.Ciphertext, encrypted.Nonce,
+		encrypted.EncryptedDEK, encrypted.DEKNonce,
+		encrypted.MasterKeyVersion, encrypted.KEKVersion, encrypted.Format)
+}
@@ -2,6 +2,7 @@ package rotation
 
 import (
 	"context"
+	"errors"
 	"log"
 	"strings"
 	"strconv"
@@ -9,22 +10,36 @@ import (
 
 	"github.com/teamvault/teamvault/internal/crypto"
 	"github.com/teamvault/teamvault/internal/db"
+	"github.com/teamvault/teamvault/internal/kek"
+	"github.com/teamvault/teamvault/internal/policy"
 )
 
+// ErrE2EProject is returned when rotating a secret of an end-to-end encrypted
+// project: the server cannot encrypt the new value for the project members.
+var ErrE2EProject = errors.New("rotation is not available for end-to-end encrypted projects")
+
+// ErrProtectedPath is returned for scheduled rotations of a secret under an
+// approval rule: changes there go through a reviewed change request, which the
+// scheduler cannot open.
+var ErrProtectedPath = errors.New("secret is under an approval rule")
+
 // Scheduler manages periodic secret rotation.
 type Scheduler struct {
 	database  *db.DB
 	cryptoSvc *crypto.EnvelopeCrypto
+	keks      *kek.Manager
 	registry  *Registry
 	interval  time.Duration
 	stopCh    chan struct{}
 }
 
-// NewScheduler creates a new rotation scheduler.
-func NewScheduler(database *db.DB, cryptoSvc *crypto.EnvelopeCrypto) *Scheduler {
+// NewScheduler creates a new rotation scheduler. keks may be nil, in which
+// case rotated values are wrapped by the master key directly.
+func NewScheduler(database *db.DB, cryptoSvc *crypto.EnvelopeCrypto, keks *kek.Manager) *Scheduler {
 	return &Scheduler{
 		database:  database,
 		cryptoSvc: cryptoSvc,
+		keks:      keks,
 		registry:  NewRegistry(),
 		interval:  1 * time.Minute,
 		stopCh:    make(chan struct{}),
@@ -80,6 +95,12 @@ func (s *Scheduler) RotateSecret(ctx context.Context, secretID string) error {
 
 // runDueRotations checks for and executes any due rotations.
 func (s *Scheduler) runDueRotations(ctx context.Context) {
+	// Connectors change external credentials before the new value is stored,
+	// so never start a rotation that could not be persisted.
+	if s.cryptoSvc.Sealed() {
+		return
+	}
+
 	schedules, err := s.database.ListDueRotations(ctx)
 	if err != nil {
 		log.Printf("Rotation scheduler: error listing due rotations: %v", err)
@@ -96,6 +117,14 @@ func (s *Scheduler) runDueRotations(ctx context.Context) {
 			continue
 		}
 
+		if err := s.checkUnprotected(ctx, secret); err != nil {
+			log.Printf("Rotation scheduler: skipping secret %s: %v", secret.Path, err)
+			if markErr := s.database.MarkRotationFailed(ctx, schedule.ID); markErr != nil {
+				log.Printf("Rotation scheduler: error marking failed: %v", markErr)
+			}
+			continue
+		}
+
 		if err := s.executeRotation(ctx, &schedule, secret); err != nil {
 			log.Printf("Rotation scheduler: error rotating secret %s: %v", secret.Path, err)
 			if markErr := s.database.MarkRotationFailed(ctx, schedule.ID); markErr != nil {
@@ -114,8 +143,31 @@ func (s *Scheduler) runDueRotations(ctx context.Context) {
 	}
 }
 
+// checkUnprotected returns ErrProtectedPath if an approval rule of the
+// secret's project covers it.
+func (s *Scheduler) checkUnprotected(ctx context.Context, secret *db.Secret) error {
+	project, err := s.database.GetProjectByID(ctx, secret.ProjectID)
+	if err != nil {
+		return err
+	}
+	for _, rule := range project.ApprovalRules {
+		if policy.MatchResource(rule.Path, secret.Path) {
+			return ErrProtectedPath
+		}
+	}
+	return nil
+}
+
 // executeRotation runs the connector and stores the new secret version.
 func (s *Scheduler) executeRotation(ctx context.Context, schedule *db.RotationSchedule, secret *db.Secret) error {
+	project, err := s.database.GetProjectByID(ctx, secret.ProjectID)
+	if err != nil {
+		return err
+	}
+	if project.IsE2E() {
+		return ErrE2EProject
+	}
+
 	connector, err := s.registry.Get(schedule.ConnectorType)
 	if err != nil {
 		return err
@@ -127,14 +179,24 @@ func (s *Scheduler) executeRotation(ctx context.Context, schedule *db.RotationSc
 		return err
 	}
 
-	// Encrypt the new value
-	encrypted, err := s.cryptoSvc.Encrypt([]byte(newValue))
+	// Get next version
+	nextVersion, err := s.database.GetNextSecretVersion(ctx, secret.ID)
 	if err != nil {
 		return err
 	}
 
-	// Get next version
-	nextVersion, err := s.database.GetNextSecretVersion(ctx, secret.ID)
+	// Encrypt the new value, bound to the version it will be stored as
+	ectx := &crypto.EncryptionContext{
+		ProjectID: secret.ProjectID,
+		SecretID:  secret.ID,
+		Version:   nextVersion,
+	}
+	var encrypted *crypto.EncryptedData
+	if s.keks != nil {
+		encrypted, err = s.keks.Encrypt(ctx, secret.ProjectID, []byte(newValue), ectx)
+	} else {
+		encrypted, err = s.cryptoSvc.Encrypt([]byte(newValue), ectx)
+	}
 	if err != nil {
 		return err
 	}
@@ -143,7 +205,7 @@ func (s *Scheduler) executeRotation(ctx context.Context, schedule *db.RotationSc
 	_, err = s.database.CreateSecretVersion(ctx, secret.ID, nextVersion,
 		encrypted.Ciphertext, encrypted.Nonce,
 		encrypted.EncryptedDEK, encrypted.DEKNonce,
-		encrypted.MasterKeyVersion, "system:rotation")
+		encrypted.MasterKeyVersion, encrypted.KEKVersion, encrypted.Format, "system:rotation")
 	return err
 }
 
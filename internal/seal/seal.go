@@ -0,0 +1,335 @@
+// Package seal implements sealed-mode key management.
+//
+// In sealed mode the master keyring is stored in the database encrypted under
+// a root key that exists only as Shamir shares held by operators. The server
+// boots sealed; once a threshold of shares is submitted the root key is
+// reconstructed, the keyring is decrypted into memory and the root key is
+// discarded. Sealing drops the keyring from memory again.
+//
+// Manager implements crypto.KeyProvider, so EnvelopeCrypto can be built on
+// top of it at boot and simply fails with ErrSealed until unsealed.
+package seal
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/teamvault/teamvault/internal/crypto"
+	"github.com/teamvault/teamvault/internal/db"
+	"github.com/teamvault/teamvault/internal/shamir"
+)
+
+var (
+	// ErrSealed is returned by key operations while the vault is sealed.
+	ErrSealed = errors.New("vault is sealed")
+	// ErrNotInitialized is returned when unsealing before init.
+	ErrNotInitialized = errors.New("vault is not initialized")
+	// ErrAlreadyInitialized is returned when init is called twice.
+	ErrAlreadyInitialized = errors.New("vault is already initialized")
+	// ErrInvalidShares is returned when the submitted shares do not
+	// reconstruct the root key. Unseal progress is reset.
+	ErrInvalidShares = errors.New("unseal shares are invalid")
+)
+
+// keyringAAD binds the encrypted keyring to its purpose.
+var keyringAAD = []byte("teamvault-seal-keyring-v1")
+
+// Status describes the seal state.
+type Status struct {
+	Initialized bool `json:"initialized"`
+	Sealed      bool `json:"sealed"`
+	Shares      int  `json:"secret_shares,omitempty"`
+	Threshold   int  `json:"secret_threshold,omitempty"`
+	Progress    int  `json:"progress"`
+}
+
+// Manager tracks the seal state and, while unsealed, serves DEK wrapping
+// from the decrypted keyring.
+type Manager struct {
+	database *db.DB
+
+	mu         sync.RWMutex
+	config     *db.SealConfig
+	keyring    *crypto.LocalKeyProvider // nil while sealed
+	pending    [][]byte                 // shares submitted towards the next unseal
+	importKeys map[int][]byte           // existing keyring to seal at init, if any
+}
+
+// NewManager creates a sealed manager and loads the seal configuration.
+func NewManager(ctx context.Context, database *db.DB) (*Manager, error) {
+	config, err := database.GetSealConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &Manager{
+		database: database,
+		config:   config,
+	}, nil
+}
+
+// SetImportKeyring makes Init seal an existing keyring (e.g. the previous
+// MASTER_KEY) instead of generating a fresh master key, so deployments with
+// encrypted data can move to sealed mode.
+func (m *Manager) SetImportKeyring(keys map[int][]byte) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.importKeys = keys
+}
+
+// Status returns the current seal state.
+func (m *Manager) Status() Status {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.statusLocked()
+}
+
+func (m *Manager) statusLocked() Status {
+	st := Status{
+		Initialized: m.config != nil,
+		Sealed:      m.keyring == nil,
+		Progress:    len(m.pending),
+	}
+	if m.config != nil {
+		st.Shares = m.config.SecretShares
+		st.Threshold = m.config.SecretThreshold
+	}
+	return st
+}
+
+// Sealed reports whether key operations are currently unavailable.
+func (m *Manager) Sealed() bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.keyring == nil
+}
+
+// Init generates a root key, seals the master keyring under it and returns
+// the root key split into shares. The vault stays sealed afterwards; the
+// shares are returned exactly once and are never stored.
+func (m *Manager) Init(ctx context.Context, shares, threshold int, initializedBy string) ([][]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.config != nil {
+		return nil, ErrAlreadyInitialized
+	}
+	if threshold < 2 || shares < threshold || shares > 255 {
+		return nil, fmt.Errorf("invalid share configuration: need 2 <= threshold <= shares <= 255")
+	}
+
+	keys := m.importKeys
+	if len(keys) == 0 {
+		masterKey := make([]byte, 32)
+		if _, err := io.ReadFull(rand.Reader, masterKey); err != nil {
+			return nil, fmt.Errorf("generating master key: %w", err)
+		}
+		keys = map[int][]byte{1: masterKey}
+	}
+	// Validate the keyring before sealing it.
+	if _, err := crypto.NewLocalKeyProvider(keys); err != nil {
+		return nil, err
+	}
+
+	rootKey := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, rootKey); err != nil {
+		return nil, fmt.Errorf("generating root key: %w", err)
+	}
+	defer zero(rootKey)
+
+	plaintext, err := json.Marshal(keys)
+	if err != nil {
+		return nil, fmt.Errorf("encoding keyring: %w", err)
+	}
+	defer zero(plaintext)
+
+	encrypted, nonce, err := sealBytes(rootKey, plaintext)
+	if err != nil {
+		return nil, fmt.Errorf("encrypting keyring: %w", err)
+	}
+
+	parts, err := shamir.Split(rootKey, shares, threshold)
+	if err != nil {
+		return nil, fmt.Errorf("splitting root key: %w", err)
+	}
+
+	config, err := m.database.CreateSealConfig(ctx, shares, threshold, encrypted, nonce, initializedBy)
+	if err != nil {
+		return nil, err
+	}
+
+	m.config = config
+	m.importKeys = nil
+	return parts, nil
+}
+
+// Unseal submits one share. Once the threshold is reached the root key is
+// reconstructed and the keyring decrypted. If the shares are wrong, progress
+// is reset and ErrInvalidShares is returned.
+func (m *Manager) Unseal(share []byte) (Status, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.config == nil {
+		return m.statusLocked(), ErrNotInitialized
+	}
+	if m.keyring != nil {
+		return m.statusLocked(), nil
+	}
+
+	for _, p := range m.pending {
+		if shamir.ShareX(p) == shamir.ShareX(share) {
+			return m.statusLocked(), fmt.Errorf("share already submitted")
+		}
+	}
+	m.pending = append(m.pending, share)
+
+	if len(m.pending) < m.config.SecretThreshold {
+		return m.statusLocked(), nil
+	}
+
+	pending := m.pending
+	m.pending = nil
+	defer func() {
+		for _, p := range pending {
+			zero(p)
+		}
+	}()
+
+	rootKey, err := shamir.Combine(pending)
+	if err != nil {
+		return m.statusLocked(), ErrInvalidShares
+	}
+	defer zero(rootKey)
+
+	plaintext, err := openBytes(rootKey, m.config.EncryptedKeyring, m.config.KeyringNonce)
+	if err != nil {
+		return m.statusLocked(), ErrInvalidShares
+	}
+	defer zero(plaintext)
+
+	var keys map[int][]byte
+	if err := json.Unmarshal(plaintext, &keys); err != nil {
+		return m.statusLocked(), fmt.Errorf("decoding keyring: %w", err)
+	}
+	keyring, err := crypto.NewLocalKeyProvider(keys)
+	if err != nil {
+		return m.statusLocked(), err
+	}
+
+	m.keyring = keyring
+	return m.statusLocked(), nil
+}
+
+// ResetUnseal discards shares submitted so far.
+func (m *Manager) ResetUnseal() Status {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, p := range m.pending {
+		zero(p)
+	}
+	m.pending = nil
+	return m.statusLocked()
+}
+
+// Seal drops the decrypted keyring from memory. Key operations fail with
+// ErrSealed until the vault is unsealed again.
+func (m *Manager) Seal() Status {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.keyring = nil
+	for _, p := range m.pending {
+		zero(p)
+	}
+	m.pending = nil
+	return m.statusLocked()
+}
+
+// ---- crypto.KeyProvider ----
+
+// Name returns "shamir".
+func (m *Manager) Name() string {
+	return "shamir"
+}
+
+// CurrentVersion returns the current master key version, or 0 while sealed.
+func (m *Manager) CurrentVersion() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.keyring == nil {
+		return 0
+	}
+	return m.keyring.CurrentVersion()
+}
+
+// Versions returns the keyring versions, or nil while sealed.
+func (m *Manager) Versions() []int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.keyring == nil {
+		return nil
+	}
+	return m.keyring.Versions()
+}
+
+// WrapDEK wraps a DEK with the unsealed keyring.
+func (m *Manager) WrapDEK(dek []byte) ([]byte, []byte, int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.keyring == nil {
+		return nil, nil, 0, ErrSealed
+	}
+	return m.keyring.WrapDEK(dek)
+}
+
+// UnwrapDEK unwraps a DEK with the unsealed keyring.
+func (m *Manager) UnwrapDEK(encryptedDEK, dekNonce []byte, version int) ([]byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.keyring == nil {
+		return nil, ErrSealed
+	}
+	return m.keyring.UnwrapDEK(encryptedDEK, dekNonce, version)
+}
+
+// ---- Helpers ----
+
+func sealBytes(key, plaintext []byte) ([]byte, []byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, nil, err
+	}
+	return gcm.Seal(nil, nonce, plaintext, keyringAAD), nonce, nil
+}
+
+func openBytes(key, ciphertext, nonce []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	return gcm.Open(nil, nonce, ciphertext, keyringAAD)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func zero(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
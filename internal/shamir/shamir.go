@@ -0,0 +1,207 @@
+// Package shamir implements Shamir's Secret Sharing over GF(2^8).
+// A secret is split into N shares such that any K of them reconstruct it,
+// while K-1 shares reveal nothing about it. Each share is the secret length
+// plus one trailing byte holding the share's x-coordinate.
+package shamir
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Split divides secret into parts shares, any threshold of which can
+// reconstruct it. parts and threshold must be between 2 and 255.
+func Split(secret []byte, parts, threshold int) ([][]byte, error) {
+	if len(secret) == 0 {
+		return nil, errors.New("cannot split an empty secret")
+	}
+	if threshold < 2 || threshold > 255 {
+		return nil, fmt.Errorf("threshold must be between 2 and 255, got %d", threshold)
+	}
+	if parts < threshold || parts > 255 {
+		return nil, fmt.Errorf("parts must be between threshold (%d) and 255, got %d", threshold, parts)
+	}
+
+	// Assign each share a distinct, non-zero x-coordinate in random order.
+	xs, err := randomXCoordinates(parts)
+	if err != nil {
+		return nil, err
+	}
+
+	shares := make([][]byte, parts)
+	for i := range shares {
+		shares[i] = make([]byte, len(secret)+1)
+		shares[i][len(secret)] = xs[i]
+	}
+
+	// For every secret byte, build a random polynomial of degree threshold-1
+	// whose constant term is that byte, and evaluate it at each x.
+	coeffs := make([]byte, threshold)
+	for idx, b := range secret {
+		coeffs[0] = b
+		if _, err := io.ReadFull(rand.Reader, coeffs[1:]); err != nil {
+			return nil, fmt.Errorf("generating polynomial: %w", err)
+		}
+		for i, x := range xs {
+			shares[i][idx] = evaluate(coeffs, x)
+		}
+	}
+	for i := range coeffs {
+		coeffs[i] = 0
+	}
+
+	return shares, nil
+}
+
+// Combine reconstructs a secret from at least threshold shares. Combining
+// too few (or wrong) shares yields garbage rather than an error; callers
+// must verify the result, e.g. by decrypting a known value with it.
+func Combine(shares [][]byte) ([]byte, error) {
+	if len(shares) < 2 {
+		return nil, errors.New("at least two shares are required")
+	}
+
+	shareLen := len(shares[0])
+	if shareLen < 2 {
+		return nil, errors.New("shares are too short")
+	}
+
+	xs := make([]byte, len(shares))
+	seen := make(map[byte]bool, len(shares))
+	for i, share := range shares {
+		if len(share) != shareLen {
+			return nil, errors.New("all shares must be the same length")
+		}
+		x := share[shareLen-1]
+		if x == 0 {
+			return nil, errors.New("invalid share x-coordinate")
+		}
+		if seen[x] {
+			return nil, errors.New("duplicate share")
+		}
+		seen[x] = true
+		xs[i] = x
+	}
+
+	secret := make([]byte, shareLen-1)
+	ys := make([]byte, len(shares))
+	for idx := range secret {
+		for i, share := range shares {
+			ys[i] = share[idx]
+		}
+		secret[idx] = interpolateAtZero(xs, ys)
+	}
+
+	return secret, nil
+}
+
+// ShareX returns the x-coordinate of a share, which identifies it without
+// revealing anything about the secret.
+func ShareX(share []byte) byte {
+	if len(share) == 0 {
+		return 0
+	}
+	return share[len(share)-1]
+}
+
+// randomXCoordinates returns n distinct values from 1..255 in random order.
+func randomXCoordinates(n int) ([]byte, error) {
+	pool := make([]byte, 255)
+	for i := range pool {
+		pool[i] = byte(i + 1)
+	}
+	// Fisher-Yates shuffle driven by crypto/rand.
+	var buf [1]byte
+	for i := len(pool) - 1; i > 0; i-- {
+		for {
+			if _, err := io.ReadFull(rand.Reader, buf[:]); err != nil {
+				return nil, fmt.Errorf("generating share coordinates: %w", err)
+			}
+			// Reject values that would bias the modulo.
+			limit := 256 - 256%(i+1)
+			if int(buf[0]) < limit {
+				j := int(buf[0]) % (i + 1)
+				pool[i], pool[j] = pool[j], pool[i]
+				break
+			}
+		}
+	}
+	return pool[:n], nil
+}
+
+// evaluate computes the polynomial with the given coefficients at x
+// using Horner's method.
+func evaluate(coeffs []byte, x byte) byte {
+	var result byte
+	for i := len(coeffs) - 1; i >= 0; i-- {
+		result = add(mul(result, x), coeffs[i])
+	}
+	return result
+}
+
+// interpolateAtZero performs Lagrange interpolation of the points (xs, ys)
+// and returns the polynomial's value at x = 0.
+func interpolateAtZero(xs, ys []byte) byte {
+	var result byte
+	for i := range xs {
+		basis := byte(1)
+		for j := range xs {
+			if i == j {
+				continue
+			}
+			// basis *= x_j / (x_j - x_i); subtraction is XOR in GF(2^8).
+			basis = mul(basis, div(xs[j], add(xs[j], xs[i])))
+		}
+		result = add(result, mul(ys[i], basis))
+	}
+	return result
+}
+
+// ---- GF(2^8) arithmetic (AES polynomial x^8 + x^4 + x^3 + x + 1) ----
+
+var expTable, logTable = buildTables()
+
+func buildTables() ([510]byte, [256]byte) {
+	var exp [510]byte
+	var log [256]byte
+	x := byte(1)
+	for i := 0; i < 255; i++ {
+		exp[i] = x
+		exp[i+255] = x
+		log[x] = byte(i)
+		// Multiply by the generator 3: x*3 = x*2 XOR x.
+		x = add(xtime(x), x)
+	}
+	return exp, log
+}
+
+// xtime multiplies a field element by 2.
+func xtime(b byte) byte {
+	if b&0x80 != 0 {
+		return (b << 1) ^ 0x1b
+	}
+	return b << 1
+}
+
+func add(a, b byte) byte {
+	return a ^ b
+}
+
+func mul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return expTable[int(logTable[a])+int(logTable[b])]
+}
+
+func div(a, b byte) byte {
+	if b == 0 {
+		panic("shamir: division by zero")
+	}
+	if a == 0 {
+		return 0
+	}
+	return expTable[int(logTable[a])+255-int(logTable[b])]
+}
@@ -0,0 +1,135 @@
+package shamir
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSplitCombine(t *testing.T) {
+	secret := []byte("0123456789abcdef0123456789abcdef")
+
+	tests := []struct {
+		name      string
+		parts     int
+		threshold int
+		use       []int // indexes of the shares to combine
+		wantOK    bool
+	}{
+		{"2 of 3, first two", 3, 2, []int{0, 1}, true},
+		{"2 of 3, last two", 3, 2, []int{1, 2}, true},
+		{"3 of 5, any three", 5, 3, []int{4, 0, 2}, true},
+		{"3 of 5, all five", 5, 3, []int{0, 1, 2, 3, 4}, true},
+		{"5 of 5", 5, 5, []int{0, 1, 2, 3, 4}, true},
+		{"3 of 5, only two", 5, 3, []int{1, 3}, false},
+		{"5 of 5, only four", 5, 5, []int{0, 1, 2, 3}, false},
+		{"255 of 255, only 254", 255, 255, seq(254), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			shares, err := Split(secret, tt.parts, tt.threshold)
+			if err != nil {
+				t.Fatalf("Split: %v", err)
+			}
+			if len(shares) != tt.parts {
+				t.Fatalf("got %d shares, want %d", len(shares), tt.parts)
+			}
+
+			subset := make([][]byte, len(tt.use))
+			for i, idx := range tt.use {
+				subset[i] = shares[idx]
+			}
+			got, err := Combine(subset)
+			if err != nil {
+				t.Fatalf("Combine: %v", err)
+			}
+			// Fewer than threshold shares give garbage, not an error; a
+			// 32-byte secret matching by chance is out of the question
+			if ok := bytes.Equal(got, secret); ok != tt.wantOK {
+				t.Errorf("Combine recovered the secret = %v, want %v", ok, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestSplitShareCoordinates(t *testing.T) {
+	shares, err := Split([]byte("secret"), 255, 2)
+	if err != nil {
+		t.Fatalf("Split: %v", err)
+	}
+	seen := make(map[byte]bool)
+	for _, share := range shares {
+		if len(share) != len("secret")+1 {
+			t.Fatalf("share length = %d, want %d", len(share), len("secret")+1)
+		}
+		x := ShareX(share)
+		if x == 0 || seen[x] {
+			t.Fatalf("x-coordinate %d is zero or repeated", x)
+		}
+		seen[x] = true
+	}
+}
+
+func TestSplitErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		secret    []byte
+		parts     int
+		threshold int
+	}{
+		{"empty secret", nil, 3, 2},
+		{"threshold 1", []byte("s"), 3, 1},
+		{"threshold above 255", []byte("s"), 255, 256},
+		{"fewer parts than threshold", []byte("s"), 2, 3},
+		{"more than 255 parts", []byte("s"), 256, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Split(tt.secret, tt.parts, tt.threshold); err == nil {
+				t.Error("Split succeeded, want an error")
+			}
+		})
+	}
+}
+
+func TestCombineErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		shares [][]byte
+	}{
+		{"one share", [][]byte{{1, 1}}},
+		{"too short", [][]byte{{1}, {2}}},
+		{"different lengths", [][]byte{{1, 2, 1}, {1, 2}}},
+		{"zero x-coordinate", [][]byte{{1, 0}, {2, 1}}},
+		{"duplicate share", [][]byte{{1, 7}, {2, 7}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Combine(tt.shares); err == nil {
+				t.Error("Combine succeeded, want an error")
+			}
+		})
+	}
+}
+
+func TestFieldArithmetic(t *testing.T) {
+	// 0x53 * 0xca = 0x01 is the worked example of FIPS-197
+	if got := mul(0x53, 0xca); got != 0x01 {
+		t.Errorf("mul(0x53, 0xca) = %#x, want 0x01", got)
+	}
+	for a := 1; a < 256; a++ {
+		for b := 1; b < 256; b++ {
+			if got := div(mul(byte(a), byte(b)), byte(b)); got != byte(a) {
+				t.Fatalf("div(mul(%d, %d), %d) = %d", a, b, b, got)
+			}
+		}
+	}
+}
+
+// seq returns the indexes 0..n-1.
+func seq(n int) []int {
+	s := make([]int, n)
+	for i := range s {
+		s[i] = i
+	}
+	return s
+}
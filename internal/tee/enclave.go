@@ -20,7 +20,9 @@ import (
 // a software-only fallback for development.
 type EnclaveService interface {
 	// Decrypt performs envelope decryption within the enclave boundary.
-	Decrypt(ciphertext, encryptedDEK, nonce, dekNonce []byte) ([]byte, error)
+	// ectx identifies the secret version the data was read from; kek is the
+	// project KEK wrapping the DEK, or nil if the master key wraps it.
+	Decrypt(data *crypto.EncryptedData, ectx *crypto.EncryptionContext, kek *crypto.KEK) ([]byte, error)
 	// Attest produces cryptographic evidence of the enclave's identity and integrity.
 	Attest() (AttestationEvidence, error)
 	// SessionKey returns a fresh ephemeral key for establishing a secure channel.
@@ -138,15 +140,8 @@ func NewSoftwareEnclave(c *crypto.EnvelopeCrypto) (*SoftwareEnclave, error) {
 }
 
 // Decrypt performs envelope decryption inside the (simulated) enclave boundary.
-func (se *SoftwareEnclave) Decrypt(ciphertext, encryptedDEK, nonce, dekNonce []byte) ([]byte, error) {
-	data := &crypto.EncryptedData{
-		Ciphertext:       ciphertext,
-		Nonce:            nonce,
-		EncryptedDEK:     encryptedDEK,
-		DEKNonce:         dekNonce,
-		MasterKeyVersion: 1,
-	}
-	return se.crypto.Decrypt(data)
+func (se *SoftwareEnclave) Decrypt(data *crypto.EncryptedData, ectx *crypto.EncryptionContext, kek *crypto.KEK) ([]byte, error) {
+	return se.crypto.DecryptWithKEK(data, ectx, kek)
 }
 
 // Attest produces attestation evidence for the software enclave.
@@ -0,0 +1,435 @@
+// Package transit implements encryption as a service: named, versioned keys
+// that encrypt, sign and HMAC caller-supplied data. Key material never
+// leaves the server; it is stored envelope-encrypted like secret values and
+// only decrypted for the duration of a single operation.
+//
+// Ciphertexts, signatures and HMACs are returned as "teamvault:v<N>:<base64>",
+// where N is the key version that produced them. Rotating a key adds a new
+// version used for all new operations; older versions keep decrypting until
+// they fall below the key's min_decrypt_version.
+package transit
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/teamvault/teamvault/internal/crypto"
+	"github.com/teamvault/teamvault/internal/db"
+)
+
+// Key types.
+const (
+	// KeyTypeAES256GCM keys support encrypt, decrypt, rewrap and hmac.
+	KeyTypeAES256GCM = "aes256-gcm"
+	// KeyTypeEd25519 keys support sign, verify and hmac.
+	KeyTypeEd25519 = "ed25519"
+)
+
+// Operations, also used as policy capabilities on "transit/<key>".
+const (
+	OpEncrypt = "encrypt"
+	OpDecrypt = "decrypt"
+	OpRewrap  = "rewrap"
+	OpSign    = "sign"
+	OpVerify  = "verify"
+	OpHMAC    = "hmac"
+)
+
+var (
+	// ErrKeyNotFound is returned when no key has the requested name.
+	ErrKeyNotFound = errors.New("transit key not found")
+	// ErrInvalidKeyName is returned for names outside [a-zA-Z0-9_-]{1,64}.
+	ErrInvalidKeyName = errors.New("invalid transit key name")
+	// ErrInvalidKeyType is returned when creating a key of an unknown type.
+	ErrInvalidKeyType = errors.New("invalid transit key type")
+	// ErrUnsupportedOperation is returned when the key type cannot perform
+	// the requested operation (e.g. sign with an AES key).
+	ErrUnsupportedOperation = errors.New("operation not supported by key type")
+	// ErrInvalidCiphertext is returned for malformed ciphertexts, signatures
+	// and HMACs, and for ciphertexts that fail authentication.
+	ErrInvalidCiphertext = errors.New("invalid ciphertext")
+	// ErrVersionDisabled is returned when data was produced by a key
+	// version below min_decrypt_version.
+	ErrVersionDisabled = errors.New("key version is below min_decrypt_version")
+	// ErrInvalidConfig is returned for an out-of-range min_decrypt_version.
+	ErrInvalidConfig = errors.New("invalid transit key config")
+)
+
+// valuePrefix starts every ciphertext, signature and HMAC.
+const valuePrefix = "teamvault:v"
+
+// hmacKeyLabel derives a key version's HMAC key from its material, so the
+// same bytes are never used directly for two algorithms.
+var hmacKeyLabel = []byte("teamvault/transit/hmac")
+
+var keyNameRegex = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+
+// ValidKeyName reports whether name can be used for a transit key. "keys" is
+// reserved for the key management endpoints.
+func ValidKeyName(name string) bool {
+	return keyNameRegex.MatchString(name) && name != "keys"
+}
+
+// Manager performs transit key management and cryptographic operations.
+type Manager struct {
+	database  *db.DB
+	cryptoSvc *crypto.EnvelopeCrypto
+}
+
+// NewManager creates a new transit manager.
+func NewManager(database *db.DB, cryptoSvc *crypto.EnvelopeCrypto) *Manager {
+	return &Manager{
+		database:  database,
+		cryptoSvc: cryptoSvc,
+	}
+}
+
+// CreateKey generates a new key with a single version.
+func (m *Manager) CreateKey(ctx context.Context, name, keyType, createdBy string) (*db.TransitKey, error) {
+	if !ValidKeyName(name) {
+		return nil, ErrInvalidKeyName
+	}
+	if keyType == "" {
+		keyType = KeyTypeAES256GCM
+	}
+	if keyType != KeyTypeAES256GCM && keyType != KeyTypeEd25519 {
+		return nil, ErrInvalidKeyType
+	}
+
+	kv, err := m.newKeyVersion(name, 1)
+	if err != nil {
+		return nil, err
+	}
+	return m.database.CreateTransitKey(ctx, name, keyType, createdBy, kv)
+}
+
+// GetKey returns a key's metadata.
+func (m *Manager) GetKey(ctx context.Context, name string) (*db.TransitKey, error) {
+	key, err := m.database.GetTransitKey(ctx, name)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			return nil, ErrKeyNotFound
+		}
+		return nil, err
+	}
+	return key, nil
+}
+
+// ListKeys returns metadata for all keys.
+func (m *Manager) ListKeys(ctx context.Context) ([]db.TransitKey, error) {
+	return m.database.ListTransitKeys(ctx)
+}
+
+// RotateKey adds a new key version and makes it the version used for all
+// new encryptions, signatures and HMACs.
+func (m *Manager) RotateKey(ctx context.Context, name string) (*db.TransitKey, error) {
+	key, err := m.GetKey(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	kv, err := m.newKeyVersion(name, key.LatestVersion+1)
+	if err != nil {
+		return nil, err
+	}
+	return m.database.AddTransitKeyVersion(ctx, key.ID, key.LatestVersion, kv)
+}
+
+// SetMinDecryptVersion sets the oldest key version that may still decrypt,
+// rewrap or verify. Data produced by older versions becomes unreadable
+// until the setting is lowered again; the key versions themselves are kept.
+func (m *Manager) SetMinDecryptVersion(ctx context.Context, name string, minVersion int) (*db.TransitKey, error) {
+	key, err := m.GetKey(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if minVersion < 1 || minVersion > key.LatestVersion {
+		return nil, fmt.Errorf("%w: min_decrypt_version must be between 1 and %d", ErrInvalidConfig, key.LatestVersion)
+	}
+	return m.database.UpdateTransitKeyMinDecryptVersion(ctx, key.ID, minVersion)
+}
+
+// Encrypt encrypts plaintext with the latest key version. aad is optional
+// caller context that must be supplied again to decrypt.
+func (m *Manager) Encrypt(ctx context.Context, name string, plaintext, aad []byte) (string, int, error) {
+	key, err := m.keyFor(ctx, name, OpEncrypt)
+	if err != nil {
+		return "", 0, err
+	}
+	return m.encryptWithVersion(ctx, key, key.LatestVersion, plaintext, aad)
+}
+
+// Decrypt decrypts a ciphertext produced by Encrypt or Rewrap and reports
+// the key version that encrypted it.
+func (m *Manager) Decrypt(ctx context.Context, name, ciphertext string, aad []byte) ([]byte, int, error) {
+	key, err := m.keyFor(ctx, name, OpDecrypt)
+	if err != nil {
+		return nil, 0, err
+	}
+	return m.decrypt(ctx, key, ciphertext, aad)
+}
+
+// Rewrap re-encrypts a ciphertext under the latest key version without
+// returning the plaintext to the caller.
+func (m *Manager) Rewrap(ctx context.Context, name, ciphertext string, aad []byte) (string, int, error) {
+	key, err := m.keyFor(ctx, name, OpRewrap)
+	if err != nil {
+		return "", 0, err
+	}
+	plaintext, _, err := m.decrypt(ctx, key, ciphertext, aad)
+	if err != nil {
+		return "", 0, err
+	}
+	defer zero(plaintext)
+	return m.encryptWithVersion(ctx, key, key.LatestVersion, plaintext, aad)
+}
+
+// Sign signs input with the latest key version using Ed25519.
+func (m *Manager) Sign(ctx context.Context, name string, input []byte) (string, int, error) {
+	key, err := m.keyFor(ctx, name, OpSign)
+	if err != nil {
+		return "", 0, err
+	}
+	seed, err := m.material(ctx, key, key.LatestVersion)
+	if err != nil {
+		return "", 0, err
+	}
+	defer zero(seed)
+
+	sig := ed25519.Sign(ed25519.NewKeyFromSeed(seed), input)
+	return encodeValue(key.LatestVersion, sig), key.LatestVersion, nil
+}
+
+// Verify checks an Ed25519 signature produced by Sign.
+func (m *Manager) Verify(ctx context.Context, name string, input []byte, signature string) (bool, error) {
+	key, err := m.keyFor(ctx, name, OpVerify)
+	if err != nil {
+		return false, err
+	}
+	if key.KeyType != KeyTypeEd25519 {
+		return false, fmt.Errorf("%w: %s keys cannot verify signatures", ErrUnsupportedOperation, key.KeyType)
+	}
+	version, sig, err := decodeValue(signature)
+	if err != nil {
+		return false, err
+	}
+	seed, err := m.readableMaterial(ctx, key, version)
+	if err != nil {
+		return false, err
+	}
+	defer zero(seed)
+
+	pub := ed25519.NewKeyFromSeed(seed).Public().(ed25519.PublicKey)
+	return ed25519.Verify(pub, input, sig), nil
+}
+
+// HMAC computes HMAC-SHA256 of input with the latest key version.
+func (m *Manager) HMAC(ctx context.Context, name string, input []byte) (string, int, error) {
+	key, err := m.keyFor(ctx, name, OpHMAC)
+	if err != nil {
+		return "", 0, err
+	}
+	material, err := m.material(ctx, key, key.LatestVersion)
+	if err != nil {
+		return "", 0, err
+	}
+	defer zero(material)
+
+	return encodeValue(key.LatestVersion, computeHMAC(material, input)), key.LatestVersion, nil
+}
+
+// VerifyHMAC checks an HMAC produced by HMAC in constant time.
+func (m *Manager) VerifyHMAC(ctx context.Context, name string, input []byte, mac string) (bool, error) {
+	key, err := m.keyFor(ctx, name, OpVerify)
+	if err != nil {
+		return false, err
+	}
+	version, sum, err := decodeValue(mac)
+	if err != nil {
+		return false, err
+	}
+	material, err := m.readableMaterial(ctx, key, version)
+	if err != nil {
+		return false, err
+	}
+	defer zero(material)
+
+	return hmac.Equal(sum, computeHMAC(material, input)), nil
+}
+
+// SupportsOperation reports whether keys of keyType can perform op.
+func SupportsOperation(keyType, op string) bool {
+	switch op {
+	case OpHMAC, OpVerify:
+		// Every key type can HMAC. Signature verification additionally
+		// needs an Ed25519 key; Verify checks that itself.
+		return true
+	case OpEncrypt, OpDecrypt, OpRewrap:
+		return keyType == KeyTypeAES256GCM
+	case OpSign:
+		return keyType == KeyTypeEd25519
+	}
+	return false
+}
+
+// ---- Internals ----
+
+// keyFor loads a key and checks that its type supports op.
+func (m *Manager) keyFor(ctx context.Context, name, op string) (*db.TransitKey, error) {
+	key, err := m.GetKey(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if !SupportsOperation(key.KeyType, op) {
+		return nil, fmt.Errorf("%w: %s keys cannot %s", ErrUnsupportedOperation, key.KeyType, op)
+	}
+	return key, nil
+}
+
+func (m *Manager) encryptWithVersion(ctx context.Context, key *db.TransitKey, version int, plaintext, aad []byte) (string, int, error) {
+	material, err := m.material(ctx, key, version)
+	if err != nil {
+		return "", 0, err
+	}
+	defer zero(material)
+
+	ciphertext, nonce, err := crypto.EncryptWithKey(material, plaintext, aad)
+	if err != nil {
+		return "", 0, fmt.Errorf("encrypting: %w", err)
+	}
+	return encodeValue(version, append(nonce, ciphertext...)), version, nil
+}
+
+func (m *Manager) decrypt(ctx context.Context, key *db.TransitKey, ciphertext string, aad []byte) ([]byte, int, error) {
+	version, raw, err := decodeValue(ciphertext)
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(raw) < crypto.NonceSize {
+		return nil, 0, ErrInvalidCiphertext
+	}
+	material, err := m.readableMaterial(ctx, key, version)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer zero(material)
+
+	plaintext, err := crypto.DecryptWithKey(material, raw[crypto.NonceSize:], raw[:crypto.NonceSize], aad)
+	if err != nil {
+		return nil, 0, ErrInvalidCiphertext
+	}
+	return plaintext, version, nil
+}
+
+// readableMaterial returns key material for data produced by version,
+// enforcing min_decrypt_version.
+func (m *Manager) readableMaterial(ctx context.Context, key *db.TransitKey, version int) ([]byte, error) {
+	if version > key.LatestVersion {
+		return nil, ErrInvalidCiphertext
+	}
+	if version < key.MinDecryptVersion {
+		return nil, ErrVersionDisabled
+	}
+	return m.material(ctx, key, version)
+}
+
+// material decrypts the raw key bytes of one version. Callers must zero the
+// result when done.
+func (m *Manager) material(ctx context.Context, key *db.TransitKey, version int) ([]byte, error) {
+	kv, err := m.database.GetTransitKeyVersion(ctx, key.ID, version)
+	if err != nil {
+		return nil, err
+	}
+	return m.cryptoSvc.Decrypt(&crypto.EncryptedData{
+		Ciphertext:       kv.Ciphertext,
+		Nonce:            kv.Nonce,
+		EncryptedDEK:     kv.EncryptedDEK,
+		DEKNonce:         kv.DEKNonce,
+		MasterKeyVersion: kv.MasterKeyVersion,
+		Format:           kv.FormatVersion,
+	}, keyContext(key.Name, version))
+}
+
+// newKeyVersion generates and envelope-encrypts fresh key material. Both key
+// types use 32 random bytes: an AES-256 key or an Ed25519 seed.
+func (m *Manager) newKeyVersion(name string, version int) (*db.TransitKeyVersion, error) {
+	material := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, material); err != nil {
+		return nil, fmt.Errorf("generating key material: %w", err)
+	}
+	defer zero(material)
+
+	encrypted, err := m.cryptoSvc.Encrypt(material, keyContext(name, version))
+	if err != nil {
+		return nil, fmt.Errorf("encrypting key material: %w", err)
+	}
+	return &db.TransitKeyVersion{
+		Version:          version,
+		Ciphertext:       encrypted.Ciphertext,
+		Nonce:            encrypted.Nonce,
+		EncryptedDEK:     encrypted.EncryptedDEK,
+		DEKNonce:         encrypted.DEKNonce,
+		MasterKeyVersion: encrypted.MasterKeyVersion,
+		FormatVersion:    encrypted.Format,
+	}, nil
+}
+
+// keyContext binds stored key material to its key name and version. Names
+// are unique and never change.
+func keyContext(name string, version int) *crypto.EncryptionContext {
+	return &crypto.EncryptionContext{
+		Purpose:  "transit-key",
+		SecretID: name,
+		Version:  version,
+	}
+}
+
+func computeHMAC(material, input []byte) []byte {
+	kdf := hmac.New(sha256.New, material)
+	kdf.Write(hmacKeyLabel)
+	hmacKey := kdf.Sum(nil)
+	defer zero(hmacKey)
+
+	mac := hmac.New(sha256.New, hmacKey)
+	mac.Write(input)
+	return mac.Sum(nil)
+}
+
+func encodeValue(version int, raw []byte) string {
+	return valuePrefix + strconv.Itoa(version) + ":" + base64.StdEncoding.EncodeToString(raw)
+}
+
+func decodeValue(value string) (int, []byte, error) {
+	rest, ok := strings.CutPrefix(value, valuePrefix)
+	if !ok {
+		return 0, nil, ErrInvalidCiphertext
+	}
+	versionStr, encoded, ok := strings.Cut(rest, ":")
+	if !ok {
+		return 0, nil, ErrInvalidCiphertext
+	}
+	version, err := strconv.Atoi(versionStr)
+	if err != nil || version < 1 {
+		return 0, nil, ErrInvalidCiphertext
+	}
+	raw, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return 0, nil, ErrInvalidCiphertext
+	}
+	return version, raw, nil
+}
+
+func zero(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
@@ -27,8 +27,27 @@ const (
 	EventSecretDeleted = "secret.deleted"
 	EventSecretRotated = "secret.rotated"
 	EventPolicyChanged = "policy.changed"
+
+	EventChangeRequestCreated   = "change_request.created"
+	EventChangeRequestApproved  = "change_request.approved"
+	EventChangeRequestRejected  = "change_request.rejected"
+	EventChangeRequestApplied   = "change_request.applied"
+	EventChangeRequestFailed    = "change_request.failed"
+	EventChangeRequestCancelled = "change_request.cancelled"
+	EventChangeRequestExpired   = "change_request.expired"
+
+	EventBreakGlassUsed         = "break_glass.used"
+	EventBreakGlassDenied       = "break_glass.denied"
+	EventBreakGlassAcknowledged = "break_glass.acknowledged"
 )
 
+// highSeverityEvents are delivered with "severity": "high", so receivers can
+// page someone instead of filing them.
+var highSeverityEvents = map[string]bool{
+	EventBreakGlassUsed:   true,
+	EventBreakGlassDenied: true,
+}
+
 // AllEvents lists all supported event types.
 var AllEvents = []string{
 	EventSecretCreated,
@@ -36,6 +55,16 @@ var AllEvents = []string{
 	EventSecretDeleted,
 	EventSecretRotated,
 	EventPolicyChanged,
+	EventChangeRequestCreated,
+	EventChangeRequestApproved,
+	EventChangeRequestRejected,
+	EventChangeRequestApplied,
+	EventChangeRequestFailed,
+	EventChangeRequestCancelled,
+	EventChangeRequestExpired,
+	EventBreakGlassUsed,
+	EventBreakGlassDenied,
+	EventBreakGlassAcknowledged,
 }
 
 // Webhook represents a registered webhook endpoint.
@@ -53,6 +82,7 @@ type Webhook struct {
 type WebhookPayload struct {
 	ID        string          `json:"id"`
 	Event     string          `json:"event"`
+	Severity  string          `json:"severity,omitempty"` // "high" for events that need attention now
 	Timestamp time.Time       `json:"timestamp"`
 	Data      json.RawMessage `json:"data"`
 }
@@ -238,6 +268,9 @@ func (wm *WebhookManager) deliver(webhook Webhook, event string, data json.RawMe
 		Timestamp: time.Now().UTC(),
 		Data:      data,
 	}
+	if highSeverityEvents[event] {
+		payload.Severity = "high"
+	}
 
 	body, err := json.Marshal(payload)
 	if err != nil {
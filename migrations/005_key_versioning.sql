@@ -0,0 +1,7 @@
+-- Master key versioning: record which master key wrapped each lease DEK
+-- (secret_versions already carries master_key_version since 001).
+ALTER TABLE leases ADD COLUMN IF NOT EXISTS master_key_version INT NOT NULL DEFAULT 1;
+
+-- Speed up the re-wrap job's scan for rows still wrapped under old keys
+CREATE INDEX IF NOT EXISTS idx_secret_versions_mkv ON secret_versions(master_key_version);
+CREATE INDEX IF NOT EXISTS idx_leases_mkv ON leases(master_key_version);
@@ -0,0 +1,11 @@
+-- Seal configuration: the master keyring encrypted under a root key that is
+-- split into Shamir shares at init time. Single row; never holds the root key.
+CREATE TABLE IF NOT EXISTS seal_config (
+    id BOOLEAN PRIMARY KEY DEFAULT true CHECK (id),
+    secret_shares INT NOT NULL,
+    secret_threshold INT NOT NULL,
+    encrypted_keyring BYTEA NOT NULL,
+    keyring_nonce BYTEA NOT NULL,
+    initialized_by UUID,
+    created_at TIMESTAMPTZ DEFAULT now()
+);
@@ -0,0 +1,6 @@
+-- Ciphertext format: 1 = AES-GCM without associated data (legacy),
+-- 2 = AES-GCM bound to (project, secret, version) via associated data.
+ALTER TABLE secret_versions ADD COLUMN IF NOT EXISTS format_version INT NOT NULL DEFAULT 1;
+
+-- Speed up `server -upgrade-ciphertexts`, which rewrites legacy rows
+CREATE INDEX IF NOT EXISTS idx_secret_versions_legacy_format ON secret_versions(id) WHERE format_version = 1;
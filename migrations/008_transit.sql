@@ -0,0 +1,30 @@
+-- Transit keys: named keys that encrypt, sign and HMAC caller data without
+-- the key material ever leaving the server.
+CREATE TABLE IF NOT EXISTS transit_keys (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    name TEXT UNIQUE NOT NULL,
+    key_type TEXT NOT NULL,
+    latest_version INT NOT NULL DEFAULT 1,
+    min_decrypt_version INT NOT NULL DEFAULT 1,
+    created_by UUID REFERENCES users(id),
+    created_at TIMESTAMPTZ DEFAULT now(),
+    updated_at TIMESTAMPTZ DEFAULT now()
+);
+
+-- One row per key version. Key material is envelope-encrypted like secret
+-- values, so master key rotation and re-wrap cover it too.
+CREATE TABLE IF NOT EXISTS transit_key_versions (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    key_id UUID NOT NULL REFERENCES transit_keys(id) ON DELETE CASCADE,
+    version INT NOT NULL,
+    ciphertext BYTEA NOT NULL,
+    nonce BYTEA NOT NULL,
+    encrypted_dek BYTEA NOT NULL,
+    dek_nonce BYTEA NOT NULL,
+    master_key_version INT NOT NULL DEFAULT 1,
+    format_version INT NOT NULL DEFAULT 2,
+    created_at TIMESTAMPTZ DEFAULT now(),
+    UNIQUE(key_id, version)
+);
+
+CREATE INDEX IF NOT EXISTS idx_transit_key_versions_mkv ON transit_key_versions(master_key_version);
@@ -0,0 +1,27 @@
+-- Per-project key encryption keys: master key -> project KEK -> DEK.
+-- Destroying a project's KEKs (crypto-shredding) makes every secret version
+-- wrapped under them permanently unreadable without rewriting those rows.
+CREATE TABLE IF NOT EXISTS project_keys (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    project_id UUID NOT NULL REFERENCES projects(id),
+    version INT NOT NULL,
+    encrypted_kek BYTEA,          -- NULL once destroyed
+    kek_nonce BYTEA,
+    master_key_version INT NOT NULL DEFAULT 1,
+    created_at TIMESTAMPTZ DEFAULT now(),
+    destroyed_at TIMESTAMPTZ,
+    UNIQUE(project_id, version)
+);
+
+CREATE INDEX IF NOT EXISTS idx_project_keys_mkv ON project_keys(master_key_version) WHERE destroyed_at IS NULL;
+
+-- KEK version wrapping each DEK; 0 = wrapped directly by the master key
+ALTER TABLE secret_versions ADD COLUMN IF NOT EXISTS kek_version INT NOT NULL DEFAULT 0;
+ALTER TABLE leases ADD COLUMN IF NOT EXISTS project_id UUID REFERENCES projects(id);
+ALTER TABLE leases ADD COLUMN IF NOT EXISTS kek_version INT NOT NULL DEFAULT 0;
+
+-- Deleted (shredded) projects keep their row so history and audit references
+-- stay valid; the name becomes available again.
+ALTER TABLE projects ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+ALTER TABLE projects DROP CONSTRAINT IF EXISTS projects_name_key;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_projects_name_active ON projects(name) WHERE deleted_at IS NULL;
@@ -0,0 +1,27 @@
+-- End-to-end encrypted projects: values are encrypted client-side to a
+-- project key that is sealed (X25519 sealed box) to each member's public key.
+-- The server only ever stores opaque blobs and sealed keys.
+ALTER TABLE projects ADD COLUMN IF NOT EXISTS encryption_mode TEXT NOT NULL DEFAULT 'server'
+    CHECK (encryption_mode IN ('server', 'e2e'));
+ALTER TABLE projects ADD COLUMN IF NOT EXISTS e2e_key_version INT NOT NULL DEFAULT 0;
+
+-- One X25519 public key per user; the private key stays on the client
+CREATE TABLE IF NOT EXISTS user_public_keys (
+    user_id UUID PRIMARY KEY REFERENCES users(id),
+    public_key BYTEA NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT now(),
+    updated_at TIMESTAMPTZ DEFAULT now()
+);
+
+-- Project key versions sealed to members
+CREATE TABLE IF NOT EXISTS project_member_keys (
+    project_id UUID NOT NULL REFERENCES projects(id),
+    user_id UUID NOT NULL REFERENCES users(id),
+    key_version INT NOT NULL,
+    sealed_key BYTEA NOT NULL,
+    created_by UUID REFERENCES users(id),
+    created_at TIMESTAMPTZ DEFAULT now(),
+    PRIMARY KEY (project_id, user_id, key_version)
+);
+
+CREATE INDEX IF NOT EXISTS idx_project_member_keys_user ON project_member_keys(user_id);
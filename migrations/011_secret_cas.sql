@@ -0,0 +1,3 @@
+-- Check-and-set writes: when set, every secret write in the project must name
+-- the version it expects to replace.
+ALTER TABLE projects ADD COLUMN IF NOT EXISTS require_cas BOOLEAN NOT NULL DEFAULT false;
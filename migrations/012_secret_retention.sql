@@ -0,0 +1,6 @@
+-- Soft-deleted secrets can be listed, restored, or purged after a retention
+-- window. Individual versions can be destroyed: their ciphertext and wrapped
+-- DEK are wiped, but the row remains so version numbers are never reused.
+ALTER TABLE secret_versions ADD COLUMN IF NOT EXISTS destroyed_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS idx_secrets_deleted ON secrets(deleted_at) WHERE deleted_at IS NOT NULL;
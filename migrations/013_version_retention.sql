@@ -0,0 +1,9 @@
+-- Version retention: keep at most max_versions versions of a secret and/or
+-- destroy versions older than max_version_age_seconds. Project values are the
+-- default; a non-NULL secret value overrides it. 0 means unlimited. The latest
+-- version is never pruned.
+ALTER TABLE projects ADD COLUMN IF NOT EXISTS max_versions INT NOT NULL DEFAULT 0;
+ALTER TABLE projects ADD COLUMN IF NOT EXISTS max_version_age_seconds BIGINT NOT NULL DEFAULT 0;
+
+ALTER TABLE secrets ADD COLUMN IF NOT EXISTS max_versions INT;
+ALTER TABLE secrets ADD COLUMN IF NOT EXISTS max_version_age_seconds BIGINT;
@@ -0,0 +1,6 @@
+-- Free-form key/value labels on secrets (owner, service, environment,
+-- data-classification, ...), searchable with label selectors and available
+-- to IAM policy conditions as label.<key>.
+ALTER TABLE secrets ADD COLUMN IF NOT EXISTS labels JSONB NOT NULL DEFAULT '{}';
+
+CREATE INDEX IF NOT EXISTS idx_secrets_labels ON secrets USING GIN (labels);
@@ -0,0 +1,14 @@
+-- A secret moved to another path can leave an alias at its old path that
+-- redirects reads to it until the alias expires. Creating a secret at the
+-- old path ends the alias.
+CREATE TABLE IF NOT EXISTS secret_aliases (
+    project_id UUID NOT NULL REFERENCES projects(id),
+    path TEXT NOT NULL,
+    secret_id UUID NOT NULL REFERENCES secrets(id) ON DELETE CASCADE,
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT now(),
+    PRIMARY KEY (project_id, path)
+);
+
+CREATE INDEX IF NOT EXISTS idx_secret_aliases_secret ON secret_aliases(secret_id);
+CREATE INDEX IF NOT EXISTS idx_secret_aliases_expires ON secret_aliases(expires_at);
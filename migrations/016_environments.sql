@@ -0,0 +1,4 @@
+-- Ordered environments of a project (dev, staging, prod, ...). Secrets of an
+-- environment live under "<name>/"; an environment with a parent inherits the
+-- keys it does not define from it.
+ALTER TABLE projects ADD COLUMN IF NOT EXISTS environments JSONB NOT NULL DEFAULT '[]';
@@ -0,0 +1,24 @@
+-- Response wrapping: a response stored, encrypted, under a single-use token
+-- instead of being returned. Only a hash of the token is kept; the
+-- ciphertext is wiped when the token is used, the row is kept so reuse can be
+-- told apart from a wrong token, and expired rows are purged.
+CREATE TABLE IF NOT EXISTS wrapping_tokens (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    token_hash TEXT NOT NULL UNIQUE,
+    ciphertext BYTEA,
+    nonce BYTEA,
+    encrypted_dek BYTEA,
+    dek_nonce BYTEA,
+    master_key_version INT NOT NULL DEFAULT 1,
+    format_version INT NOT NULL DEFAULT 2,
+    creation_path TEXT NOT NULL,
+    created_by_type TEXT NOT NULL,
+    created_by UUID NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT now(),
+    unwrapped_at TIMESTAMPTZ,
+    unwrapped_by_type TEXT,
+    unwrapped_by UUID
+);
+
+CREATE INDEX IF NOT EXISTS idx_wrapping_tokens_expires ON wrapping_tokens(expires_at);
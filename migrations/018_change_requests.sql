@@ -0,0 +1,46 @@
+-- Two-person approval: writes by anyone but the project owner to paths
+-- matched by an approval rule become change requests, which hold the
+-- proposed value encrypted until enough members of the rule's approver team
+-- approve them. The ciphertext is wiped once a request is resolved.
+ALTER TABLE projects ADD COLUMN IF NOT EXISTS approval_rules JSONB NOT NULL DEFAULT '[]';
+
+CREATE TABLE IF NOT EXISTS change_requests (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    project_id UUID NOT NULL REFERENCES projects(id),
+    path TEXT NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    secret_type TEXT NOT NULL DEFAULT 'kv',
+    metadata JSONB,
+    labels JSONB,
+    base_version INT NOT NULL,
+    ciphertext BYTEA,
+    nonce BYTEA,
+    encrypted_dek BYTEA,
+    dek_nonce BYTEA,
+    master_key_version INT NOT NULL DEFAULT 0,
+    kek_version INT NOT NULL DEFAULT 0,
+    format_version INT NOT NULL DEFAULT 2,
+    team_id UUID NOT NULL,
+    required_approvals INT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending',
+    error TEXT NOT NULL DEFAULT '',
+    comment TEXT NOT NULL DEFAULT '',
+    requested_by_type TEXT NOT NULL,
+    requested_by UUID NOT NULL,
+    applied_version INT,
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT now(),
+    resolved_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_change_requests_project ON change_requests(project_id, status);
+CREATE INDEX IF NOT EXISTS idx_change_requests_expires ON change_requests(expires_at) WHERE status = 'pending';
+
+CREATE TABLE IF NOT EXISTS change_request_reviews (
+    request_id UUID NOT NULL REFERENCES change_requests(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id),
+    decision TEXT NOT NULL, -- 'approve' or 'reject'
+    comment TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ DEFAULT now(),
+    PRIMARY KEY (request_id, user_id)
+);
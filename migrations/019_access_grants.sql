@@ -0,0 +1,36 @@
+-- Just-in-time access: a user asks for temporary access to a resource
+-- pattern, with a justification, and a lead of the team the request is
+-- addressed to approves it. Approval creates a grant that policy evaluation
+-- honours until it expires or is revoked; deny policies still win over it.
+CREATE TABLE IF NOT EXISTS access_requests (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id),
+    team_id UUID NOT NULL REFERENCES teams(id) ON DELETE CASCADE,
+    resource_pattern TEXT NOT NULL,
+    actions TEXT[] NOT NULL DEFAULT '{"read"}',
+    justification TEXT NOT NULL,
+    duration_seconds INT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending',
+    reviewed_by UUID REFERENCES users(id),
+    review_comment TEXT NOT NULL DEFAULT '',
+    reviewed_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_access_requests_team ON access_requests(team_id, status);
+CREATE INDEX IF NOT EXISTS idx_access_requests_user ON access_requests(user_id);
+
+CREATE TABLE IF NOT EXISTS access_grants (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    request_id UUID NOT NULL UNIQUE REFERENCES access_requests(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id),
+    resource_pattern TEXT NOT NULL,
+    actions TEXT[] NOT NULL,
+    granted_by UUID NOT NULL REFERENCES users(id),
+    expires_at TIMESTAMPTZ NOT NULL,
+    revoked_at TIMESTAMPTZ,
+    revoked_by UUID REFERENCES users(id),
+    created_at TIMESTAMPTZ DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_access_grants_user ON access_grants(user_id, expires_at) WHERE revoked_at IS NULL;
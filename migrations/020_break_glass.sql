@@ -0,0 +1,24 @@
+-- Break-glass access: during an incident a member of a team the org allows
+-- may give themselves read access to a secret for a short fixed window,
+-- with a typed justification. The access is an access grant without a
+-- request, and every use leaves a review item an admin must acknowledge.
+ALTER TABLE orgs ADD COLUMN IF NOT EXISTS break_glass_rules JSONB NOT NULL DEFAULT '[]';
+
+ALTER TABLE access_grants ALTER COLUMN request_id DROP NOT NULL;
+ALTER TABLE access_grants ADD COLUMN IF NOT EXISTS break_glass BOOLEAN NOT NULL DEFAULT false;
+
+CREATE TABLE IF NOT EXISTS break_glass_reviews (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    grant_id UUID NOT NULL UNIQUE REFERENCES access_grants(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id),
+    org_id UUID NOT NULL REFERENCES orgs(id) ON DELETE CASCADE,
+    team_id UUID NOT NULL,
+    resource TEXT NOT NULL,
+    justification TEXT NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT now(),
+    acknowledged_by UUID REFERENCES users(id),
+    acknowledged_at TIMESTAMPTZ,
+    comment TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS idx_break_glass_reviews_pending ON break_glass_reviews(created_at) WHERE acknowledged_at IS NULL;
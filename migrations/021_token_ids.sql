@@ -0,0 +1,10 @@
+-- Service account and agent tokens carry a public token ID in front of their
+-- secret ("sa.<token_id>.<secret>"), so authentication looks the account up
+-- by index and checks a single hash instead of running bcrypt against every
+-- account. Accounts created before have no token ID: their tokens keep
+-- working through the old scan until they are rotated.
+ALTER TABLE service_accounts ADD COLUMN IF NOT EXISTS token_id TEXT;
+ALTER TABLE agents ADD COLUMN IF NOT EXISTS token_id TEXT;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_service_accounts_token_id ON service_accounts(token_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_agents_token_id ON agents(token_id);
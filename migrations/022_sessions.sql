@@ -0,0 +1,30 @@
+-- Login sessions: a session holds the SHA-256 hash of its current refresh
+-- token, which is replaced on every refresh. Presenting the one before it
+-- again means the token leaked, and revokes the session. The JTI of the
+-- access token last issued for a session is kept so revoking the session
+-- also revokes that token.
+CREATE TABLE IF NOT EXISTS sessions (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    refresh_token_hash TEXT NOT NULL UNIQUE,
+    previous_refresh_hash TEXT,
+    access_jti TEXT,
+    access_expires_at TIMESTAMPTZ,
+    ip TEXT NOT NULL DEFAULT '',
+    user_agent TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ DEFAULT now(),
+    last_used_at TIMESTAMPTZ DEFAULT now(),
+    expires_at TIMESTAMPTZ NOT NULL,
+    revoked_at TIMESTAMPTZ,
+    revoked_by UUID REFERENCES users(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_sessions_user ON sessions(user_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_sessions_previous_refresh ON sessions(previous_refresh_hash);
+
+-- Denylist of revoked access tokens by JTI, checked on every request. An
+-- entry is only needed until the token would have expired anyway.
+CREATE TABLE IF NOT EXISTS revoked_tokens (
+    jti TEXT PRIMARY KEY,
+    expires_at TIMESTAMPTZ NOT NULL
+);
@@ -0,0 +1,42 @@
+-- TOTP multi-factor authentication. The TOTP secret is encrypted with a key
+-- derived from the JWT secret, not the vault master key, so users can still
+-- log in while the vault is sealed. enabled_at stays NULL until the user
+-- confirms enrollment with a first code; last_used_step keeps a code from
+-- being used twice.
+CREATE TABLE IF NOT EXISTS user_mfa (
+    user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    totp_secret TEXT NOT NULL,
+    enabled_at TIMESTAMPTZ,
+    last_used_step BIGINT NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ DEFAULT now()
+);
+
+-- Single-use recovery codes (bcrypt hashes), for a lost authenticator.
+CREATE TABLE IF NOT EXISTS mfa_recovery_codes (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    code_hash TEXT NOT NULL,
+    used_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_mfa_recovery_codes_user ON mfa_recovery_codes(user_id);
+
+-- Pending second login steps: a user who passed the password check gets a
+-- short-lived challenge token (stored as its SHA-256 hash) to present with
+-- their code. A challenge allows a few attempts only.
+CREATE TABLE IF NOT EXISTS mfa_challenges (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    token_hash TEXT NOT NULL UNIQUE,
+    method TEXT NOT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ DEFAULT now(),
+    expires_at TIMESTAMPTZ NOT NULL,
+    used_at TIMESTAMPTZ
+);
+
+-- Sessions remember how the user authenticated and when MFA was last
+-- verified, so refreshed tokens keep the amr and mfa claims until MFA goes
+-- stale.
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS amr TEXT[] NOT NULL DEFAULT '{}';
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS mfa_at TIMESTAMPTZ;
@@ -0,0 +1,5 @@
+-- The role an agent presents to policies. It used to be read from the
+-- "role" of the agent's metadata, which whoever created the agent could set
+-- to anything; it is not copied over, so agents that relied on it need
+-- their role set again by a team lead or an admin.
+ALTER TABLE agents ADD COLUMN IF NOT EXISTS role TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,5 @@
+-- Teams whose leads may approve just-in-time access to a project's secrets.
+-- Set by the project owner or an admin; access requests addressed to any
+-- other team are refused, so a team cannot approve access to projects it has
+-- no say over.
+ALTER TABLE projects ADD COLUMN IF NOT EXISTS access_teams JSONB NOT NULL DEFAULT '[]';
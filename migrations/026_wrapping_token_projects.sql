@@ -0,0 +1,4 @@
+-- Projects whose secret values a wrapped response holds. Wrapped responses
+-- are encrypted under the master key, so deleting a project deletes its
+-- unused wrapping tokens to keep them from outliving the crypto-shred.
+ALTER TABLE wrapping_tokens ADD COLUMN IF NOT EXISTS project_ids UUID[] NOT NULL DEFAULT '{}';
@@ -34,6 +34,9 @@ type SecretRequest struct {
 	Value       string `json:"value"`
 	Description string `json:"description,omitempty"`
 	Type        string `json:"type,omitempty"`
+	// CAS, if set, is the version this write replaces (0 = secret must not
+	// exist). The server rejects the write with 409 if it is out of date.
+	CAS *int `json:"cas,omitempty"`
 }
 
 // SecretResponse represents the API response for a secret.
@@ -56,13 +59,23 @@ type ProjectRequest struct {
 	Description string `json:"description,omitempty"`
 }
 
+// ProjectUpdateRequest represents a project settings update.
+type ProjectUpdateRequest struct {
+	RequireCAS    *bool   `json:"require_cas,omitempty"`
+	MaxVersions   *int    `json:"max_versions,omitempty"`
+	MaxVersionAge *string `json:"max_version_age,omitempty"`
+}
+
 // ProjectResponse represents the API response for a project.
 type ProjectResponse struct {
-	ID          string `json:"id"`
-	Name        string `json:"name"`
-	Description string `json:"description,omitempty"`
-	CreatedBy   string `json:"created_by"`
-	CreatedAt   string `json:"created_at"`
+	ID                   string `json:"id"`
+	Name                 string `json:"name"`
+	Description          string `json:"description,omitempty"`
+	RequireCAS           bool   `json:"require_cas"`
+	MaxVersions          int    `json:"max_versions"`
+	MaxVersionAgeSeconds int64  `json:"max_version_age_seconds"`
+	CreatedBy            string `json:"created_by"`
+	CreatedAt            string `json:"created_at"`
 }
 
 // PolicyRequest represents a policy create/update request.
@@ -133,9 +146,13 @@ func (c *TeamVaultClient) PutSecret(project, path string, req *SecretRequest) (*
 	return &resp, nil
 }
 
-// GetSecret reads a secret.
-func (c *TeamVaultClient) GetSecret(project, path string) (*SecretResponse, error) {
+// GetSecret reads a secret. References in its value are resolved unless raw
+// is set.
+func (c *TeamVaultClient) GetSecret(project, path string, raw bool) (*SecretResponse, error) {
 	url := fmt.Sprintf("%s/api/v1/secrets/%s/%s", c.Address, project, path)
+	if raw {
+		url += "?raw=true"
+	}
 	var resp SecretResponse
 	if err := c.doRequest("GET", url, nil, &resp); err != nil {
 		return nil, err
@@ -161,6 +178,16 @@ func (c *TeamVaultClient) CreateProject(req *ProjectRequest) (*ProjectResponse,
 	return &resp, nil
 }
 
+// UpdateProject changes a project's settings.
+func (c *TeamVaultClient) UpdateProject(name string, req *ProjectUpdateRequest) (*ProjectResponse, error) {
+	url := fmt.Sprintf("%s/api/v1/projects/%s", c.Address, name)
+	var resp ProjectResponse
+	if err := c.doRequest("PATCH", url, req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
 // ListProjects lists all projects.
 func (c *TeamVaultClient) ListProjects() ([]ProjectResponse, error) {
 	url := fmt.Sprintf("%s/api/v1/projects", c.Address)
@@ -327,3 +354,12 @@ func IsNotFound(err error) bool {
 	}
 	return false
 }
+
+// IsConflict checks if an error is a 409 Conflict error, e.g. a failed
+// check-and-set write.
+func IsConflict(err error) bool {
+	if apiErr, ok := err.(*APIError); ok {
+		return apiErr.StatusCode == 409
+	}
+	return false
+}
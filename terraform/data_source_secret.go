@@ -61,7 +61,7 @@ func dataSourceSecretRead(ctx context.Context, d *schema.ResourceData, meta inte
 	project := d.Get("project").(string)
 	path := d.Get("path").(string)
 
-	resp, err := client.GetSecret(project, path)
+	resp, err := client.GetSecret(project, path, false)
 	if err != nil {
 		return diag.FromErr(fmt.Errorf("failed to read secret %s/%s: %w", project, path, err))
 	}
@@ -3,9 +3,11 @@ package main
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
 )
 
 func resourceProject() *schema.Resource {
@@ -33,6 +35,27 @@ func resourceProject() *schema.Resource {
 				Default:     "",
 				Description: "A human-readable description of the project.",
 			},
+			"require_cas": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     false,
+				Description: "Require check-and-set on every secret write in the project.",
+			},
+			"max_versions": {
+				Type:             schema.TypeInt,
+				Optional:         true,
+				Default:          0,
+				ValidateDiagFunc: validation.ToDiagFunc(validation.IntAtLeast(0)),
+				Description:      "Number of versions kept per secret; older versions are destroyed. 0 keeps every version.",
+			},
+			"max_version_age": {
+				Type:             schema.TypeString,
+				Optional:         true,
+				Default:          "0",
+				ValidateDiagFunc: validation.ToDiagFunc(validateDuration),
+				DiffSuppressFunc: suppressEquivalentDuration,
+				Description:      "Versions older than this (e.g. \"2160h\") are destroyed. The latest version is always kept. \"0\" keeps versions forever.",
+			},
 			"created_by": {
 				Type:        schema.TypeString,
 				Computed:    true,
@@ -63,13 +86,66 @@ func resourceProjectCreate(ctx context.Context, d *schema.ResourceData, meta int
 		return diag.FromErr(fmt.Errorf("failed to create project %q: %w", name, err))
 	}
 
+	if settings := projectSettings(d, false); settings != nil {
+		resp, err = client.UpdateProject(name, settings)
+		if err != nil {
+			return diag.FromErr(fmt.Errorf("failed to set settings on project %q: %w", name, err))
+		}
+	}
+
 	d.SetId(resp.ID)
+	setProjectData(d, resp)
+
+	return nil
+}
+
+// projectSettings builds the settings update for a project. On create
+// (changedOnly false) only non-default settings are sent; on update only the
+// changed ones. It returns nil if there is nothing to send.
+func projectSettings(d *schema.ResourceData, changedOnly bool) *ProjectUpdateRequest {
+	req := &ProjectUpdateRequest{}
+	send := false
+	if requireCAS := d.Get("require_cas").(bool); (changedOnly && d.HasChange("require_cas")) || (!changedOnly && requireCAS) {
+		req.RequireCAS = &requireCAS
+		send = true
+	}
+	if maxVersions := d.Get("max_versions").(int); (changedOnly && d.HasChange("max_versions")) || (!changedOnly && maxVersions != 0) {
+		req.MaxVersions = &maxVersions
+		send = true
+	}
+	if maxAge := d.Get("max_version_age").(string); (changedOnly && d.HasChange("max_version_age")) || (!changedOnly && maxAge != "0") {
+		req.MaxVersionAge = &maxAge
+		send = true
+	}
+	if !send {
+		return nil
+	}
+	return req
+}
+
+func setProjectData(d *schema.ResourceData, resp *ProjectResponse) {
 	d.Set("name", resp.Name)
 	d.Set("description", resp.Description)
+	d.Set("require_cas", resp.RequireCAS)
+	d.Set("max_versions", resp.MaxVersions)
+	d.Set("max_version_age", (time.Duration(resp.MaxVersionAgeSeconds) * time.Second).String())
 	d.Set("created_by", resp.CreatedBy)
 	d.Set("created_at", resp.CreatedAt)
+}
 
-	return nil
+func validateDuration(v interface{}, k string) ([]string, []error) {
+	if d, err := time.ParseDuration(v.(string)); err != nil || d < 0 {
+		return nil, []error{fmt.Errorf("%q must be a non-negative duration such as \"720h\", got %q", k, v)}
+	}
+	return nil, nil
+}
+
+// suppressEquivalentDuration ignores differences in how a duration is
+// written, e.g. "2160h" and "2160h0m0s".
+func suppressEquivalentDuration(k, old, new string, d *schema.ResourceData) bool {
+	o, err1 := time.ParseDuration(old)
+	n, err2 := time.ParseDuration(new)
+	return err1 == nil && err2 == nil && o == n
 }
 
 func resourceProjectRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
@@ -92,16 +168,22 @@ func resourceProjectRead(ctx context.Context, d *schema.ResourceData, meta inter
 	}
 
 	d.SetId(resp.ID)
-	d.Set("name", resp.Name)
-	d.Set("description", resp.Description)
-	d.Set("created_by", resp.CreatedBy)
-	d.Set("created_at", resp.CreatedAt)
+	setProjectData(d, resp)
 
 	return nil
 }
 
 func resourceProjectUpdate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
-	// The TeamVault API currently does not support project updates (PUT/PATCH).
+	client := meta.(*TeamVaultClient)
+
+	if settings := projectSettings(d, true); settings != nil {
+		name, _ := d.GetChange("name")
+		if _, err := client.UpdateProject(name.(string), settings); err != nil {
+			return diag.FromErr(fmt.Errorf("failed to update settings on project %q: %w", name, err))
+		}
+	}
+
+	// The TeamVault API currently only supports updating project settings.
 	// If the name changes, we must recreate; description changes are noted but
 	// cannot be applied until the API supports it.
 	if d.HasChange("name") {
@@ -54,6 +54,12 @@ func resourceSecret() *schema.Resource {
 				Optional:    true,
 				Description: "A human-readable description of the secret.",
 			},
+			"check_and_set": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     false,
+				Description: "Only write if the secret is unchanged since Terraform last saw it: creation fails if it already exists, and updates fail if another version was written in the meantime. Required for projects with require_cas.",
+			},
 			"version": {
 				Type:        schema.TypeInt,
 				Computed:    true,
@@ -82,9 +88,16 @@ func resourceSecretCreate(ctx context.Context, d *schema.ResourceData, meta inte
 		Description: description,
 		Type:        secretType,
 	}
+	if d.Get("check_and_set").(bool) {
+		cas := 0
+		req.CAS = &cas
+	}
 
 	resp, err := client.PutSecret(project, path, req)
 	if err != nil {
+		if IsConflict(err) {
+			return diag.FromErr(fmt.Errorf("secret %s/%s already exists; import it instead: %w", project, path, err))
+		}
 		return diag.FromErr(fmt.Errorf("failed to create secret %s/%s: %w", project, path, err))
 	}
 
@@ -104,7 +117,8 @@ func resourceSecretRead(ctx context.Context, d *schema.ResourceData, meta interf
 		return diag.FromErr(err)
 	}
 
-	resp, err := client.GetSecret(project, path)
+	// Read the value as written, so references are not reported as drift
+	resp, err := client.GetSecret(project, path, true)
 	if err != nil {
 		if IsNotFound(err) {
 			// Secret was deleted outside Terraform
@@ -139,9 +153,17 @@ func resourceSecretUpdate(ctx context.Context, d *schema.ResourceData, meta inte
 			Description: d.Get("description").(string),
 			Type:        d.Get("type").(string),
 		}
+		if d.Get("check_and_set").(bool) {
+			// The version in state is the one this plan was made against
+			cas := d.Get("version").(int)
+			req.CAS = &cas
+		}
 
 		resp, err := client.PutSecret(project, path, req)
 		if err != nil {
+			if IsConflict(err) {
+				return diag.FromErr(fmt.Errorf("secret %s/%s was changed outside Terraform since version %d; refresh and re-plan: %w", project, path, d.Get("version").(int), err))
+			}
 			return diag.FromErr(fmt.Errorf("failed to update secret %s/%s: %w", project, path, err))
 		}
 
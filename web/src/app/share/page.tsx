@@ -0,0 +1,124 @@
+"use client";
+
+import { useEffect, useState } from "react";
+import { wrapping, ApiError, type UnwrappedResponse } from "@/lib/api";
+import { useCopyToClipboard } from "@/lib/hooks";
+import { Button } from "@/components/ui/button";
+import { Card, CardContent, CardDescription, CardHeader, CardTitle } from "@/components/ui/card";
+import { Textarea } from "@/components/ui/textarea";
+import { Shield, Loader2, Eye, Copy, Check } from "lucide-react";
+
+// The token travels in the URL fragment, which browsers never send to a
+// server, so opening the link does not use it up; only "Reveal" does.
+function shareValue(res: UnwrappedResponse): string {
+  if (typeof res.value === "string") return res.value;
+  if (typeof res.data === "string") return res.data;
+  return JSON.stringify(res.data ?? res, null, 2);
+}
+
+export default function SharePage() {
+  const [token, setToken] = useState("");
+  const [value, setValue] = useState<string | null>(null);
+  const [error, setError] = useState("");
+  const [loading, setLoading] = useState(false);
+  const { copied, copy } = useCopyToClipboard();
+
+  useEffect(() => {
+    setToken(decodeURIComponent(window.location.hash.slice(1)));
+  }, []);
+
+  const handleReveal = async () => {
+    setError("");
+    setLoading(true);
+    try {
+      const res = await wrapping.unwrap(token);
+      setValue(shareValue(res));
+      // Drop the used token from the address bar and history
+      window.history.replaceState(null, "", window.location.pathname);
+    } catch (err) {
+      if (err instanceof ApiError && err.status === 410) {
+        setError("This link has already been opened or has expired. Ask the sender for a new one.");
+      } else if (err instanceof ApiError && err.status === 404) {
+        setError("This link is not valid.");
+      } else {
+        setError("Something went wrong. The secret has not been revealed; try again.");
+      }
+    } finally {
+      setLoading(false);
+    }
+  };
+
+  return (
+    <div className="min-h-screen flex items-center justify-center bg-background">
+      <div className="w-full max-w-lg px-4">
+        <div className="flex flex-col items-center mb-8">
+          <div className="flex items-center gap-3 mb-2">
+            <div className="h-10 w-10 rounded-lg bg-primary flex items-center justify-center">
+              <Shield className="h-6 w-6 text-primary-foreground" />
+            </div>
+            <h1 className="text-3xl font-bold tracking-tight">TeamVault</h1>
+          </div>
+        </div>
+
+        <Card className="border-border/50">
+          <CardHeader className="text-center">
+            <CardTitle className="text-xl">Shared secret</CardTitle>
+            <CardDescription>
+              {value === null
+                ? "This secret can be revealed only once. Make sure you are ready to store it."
+                : "This link no longer works. Store the secret somewhere safe before leaving."}
+            </CardDescription>
+          </CardHeader>
+          <CardContent className="space-y-4">
+            {error && (
+              <div className="rounded-md bg-destructive/10 border border-destructive/20 px-4 py-3 text-sm text-destructive">
+                {error}
+              </div>
+            )}
+
+            {!token && (
+              <p className="text-sm text-muted-foreground text-center">
+                This link is incomplete. Open the full link you were sent.
+              </p>
+            )}
+
+            {token && value === null && (
+              <Button className="w-full" onClick={handleReveal} disabled={loading}>
+                {loading ? (
+                  <>
+                    <Loader2 className="mr-2 h-4 w-4 animate-spin" />
+                    Revealing…
+                  </>
+                ) : (
+                  <>
+                    <Eye className="mr-2 h-4 w-4" />
+                    Reveal secret
+                  </>
+                )}
+              </Button>
+            )}
+
+            {value !== null && (
+              <>
+                <Textarea readOnly value={value} className="font-mono text-sm" rows={4} />
+                <Button variant="outline" className="w-full" onClick={() => copy(value)}>
+                  {copied ? (
+                    <>
+                      <Check className="mr-2 h-4 w-4" />
+                      Copied
+                    </>
+                  ) : (
+                    <>
+                      <Copy className="mr-2 h-4 w-4" />
+                      Copy to clipboard
+                    </>
+                  )}
+                </Button>
+              </>
+            )}
+          </CardContent>
+        </Card>
+      </div>
+    </div>
+  );
+}
@@ -712,6 +712,28 @@ export const leases = {
     }),
 };
 
+// ─── Response wrapping ───────────────────────────────────────────────────────
+
+// The response that was wrapped: a secret read ({ path, value, ... }) or
+// data wrapped directly ({ data })
+export interface UnwrappedResponse {
+  path?: string;
+  value?: string;
+  field?: string;
+  version?: number;
+  data?: unknown;
+  [key: string]: unknown;
+}
+
+export const wrapping = {
+  // Works without logging in; the token can only be unwrapped once
+  unwrap: (token: string) =>
+    apiFetch<UnwrappedResponse>("/sys/unwrap", {
+      method: "POST",
+      body: JSON.stringify({ token }),
+    }),
+};
+
 // ─── Health / Ready ──────────────────────────────────────────────────────────
 
 // Note: /health and /ready are mounted at the server root, not under /api/v1